@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// indexRootURLPattern 匹配index.html中以 / 开头的src/href属性，协议相对地址（//host）除外
+var indexRootURLPattern = regexp.MustCompile(`(\s(?:src|href)=["'])/([^/"'])`)
+
+// NormalizeBasePath 把 -ui-base-path 规范化为以 / 开头、不以 / 结尾的形式，"" 和 "/" 表示根路径
+func NormalizeBasePath(basePath string) (string, error) {
+	basePath = strings.TrimSpace(basePath)
+	if basePath == "" || basePath == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		return "", fmt.Errorf("invalid base path %q: must start with /", basePath)
+	}
+	basePath = strings.TrimRight(basePath, "/")
+	if strings.ContainsAny(basePath, "?#*:% \"'\\<>") || strings.Contains(basePath, "//") {
+		return "", fmt.Errorf("invalid base path %q", basePath)
+	}
+	for _, segment := range strings.Split(strings.TrimPrefix(basePath, "/"), "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid base path %q", basePath)
+		}
+	}
+	return basePath, nil
+}
+
+// trimBasePath 去掉请求路径中的BasePath前缀，路径不在BasePath之下时返回false
+func (s *Server) trimBasePath(path string) (string, bool) {
+	if s.BasePath == "" {
+		return path, true
+	}
+	if path == s.BasePath {
+		return "/", true
+	}
+	if rest, ok := strings.CutPrefix(path, s.BasePath+"/"); ok {
+		return "/" + rest, true
+	}
+	return "", false
+}
+
+// rewriteIndexHTML 让前端在BasePath之下工作：资源地址加上前缀，并通过 window.__PROXYCRAFT_BASE_PATH__
+// 告诉前端API和socket.io的路径前缀；没有设置BasePath时原样返回
+func (s *Server) rewriteIndexHTML(data []byte) []byte {
+	if s.BasePath == "" {
+		return data
+	}
+	data = indexRootURLPattern.ReplaceAll(data, []byte("${1}"+s.BasePath+"/${2}"))
+
+	// json.Marshal会转义<、>和&，结果可以安全地放在<script>中
+	value, _ := json.Marshal(s.BasePath)
+	script := []byte("<script>window.__PROXYCRAFT_BASE_PATH__=" + string(value) + ";</script>")
+	if index := bytes.Index(data, []byte("</head>")); index >= 0 {
+		return append(data[:index:index], append(script, data[index:]...)...)
+	}
+	return append(script, data...)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIBasePathServesPrefixedAssets(t *testing.T) {
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, "", handlers.StorageMemory)
+	require.NoError(t, err)
+	server := NewServerWithBasePath(webHandler, 0, "/proxycraft")
+	server.Dist = fstest.MapFS{
+		"dist/index.html":    {Data: []byte(`<html><head><script type="module" src="/assets/app.js"></script><link rel="icon" href="/favicon.ico"></head><body></body></html>`)},
+		"dist/assets/app.js": {Data: []byte("console.log('app')")},
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for _, path := range []string{"/proxycraft/", "/proxycraft/traffic/1"} {
+		rec := get(path)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		body := rec.Body.String()
+		assert.Contains(t, body, `src="/proxycraft/assets/app.js"`, path)
+		assert.Contains(t, body, `href="/proxycraft/favicon.ico"`, path)
+		assert.Contains(t, body, `<script>window.__PROXYCRAFT_BASE_PATH__="/proxycraft";</script></head>`, path)
+	}
+
+	rec := get("/proxycraft/assets/app.js")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "console.log('app')", rec.Body.String())
+	assert.Equal(t, http.StatusOK, get("/proxycraft/api/traffic").Code)
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+
+	// 前缀之外的路径不再提供UI和API
+	assert.Equal(t, http.StatusNotFound, get("/assets/app.js").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/traffic").Code)
+	assert.Equal(t, http.StatusNotFound, get("/other/").Code)
+
+	assert.Equal(t, "http://localhost:0/proxycraft/", server.URL())
+}
+
+func TestNormalizeBasePath(t *testing.T) {
+	cases := map[string]string{
+		"":             "",
+		"/":            "",
+		"/proxycraft":  "/proxycraft",
+		"/proxycraft/": "/proxycraft",
+		" /a/b/ ":      "/a/b",
+	}
+	for input, want := range cases {
+		got, err := NormalizeBasePath(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"proxycraft", "/a//b", "/a/../b", "/a?b", "/a b"} {
+		_, err := NormalizeBasePath(input)
+		assert.Error(t, err, input)
+	}
+}
@@ -1,10 +1,42 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
 )
 
+// textBody 返回用于显示的消息体，非UTF-8编码的文本转换为UTF-8
+func textBody(data []byte, contentType string) []byte {
+	if decoded, _, ok := proxy.DecodeText(data, contentType); ok {
+		return decoded
+	}
+	return data
+}
+
+// detailsBody 返回详情接口中的消息体：过大或二进制的消息体只返回说明，JSON解析为对象，其余作为文本返回
+// 先检查大小再转换字符集，过大的消息体不会被解码
+func detailsBody(data []byte, contentType, kind string) interface{} {
+	if len(data) > maxDetailsBodySize {
+		return fmt.Sprintf("<Large %s body, %d bytes>", kind, len(data))
+	}
+	text := textBody(data, contentType)
+	if strings.Contains(contentType, "application/json") {
+		var body interface{}
+		if err := json.Unmarshal(text, &body); err != nil {
+			return string(text)
+		}
+		return body
+	}
+	if isBinaryContent(text, contentType) {
+		return fmt.Sprintf("<Binary data, %d bytes>", len(data))
+	}
+	return string(text)
+}
+
 func isTextContentType(contentType string) bool {
 	if contentType == "" {
 		return false
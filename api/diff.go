@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// maxLineDiffCells 是逐行比较时LCS表的单元格上限（去掉相同的首尾行后两边行数之积），超过时只报告是否相同
+const maxLineDiffCells = 4 << 20
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// EntryDiff 是两个流量条目响应之间的差异
+type EntryDiff struct {
+	A       string       `json:"a"`
+	B       string       `json:"b"`
+	Status  *ValueChange `json:"status,omitempty"`
+	Headers []FieldDiff  `json:"headers"`
+	Body    BodyDiff     `json:"body"`
+}
+
+type ValueChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// FieldDiff 描述一个响应头或JSON路径上的变化
+type FieldDiff struct {
+	Name   string      `json:"name"`
+	Change string      `json:"change"`
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// BodyDiff 描述响应体的变化，Kind为json时填充Fields，text时填充Lines，binary时填充Binary
+type BodyDiff struct {
+	Kind      string      `json:"kind"`
+	Identical bool        `json:"identical"`
+	Fields    []FieldDiff `json:"fields,omitempty"`
+	Lines     []LineDiff  `json:"lines,omitempty"`
+	Binary    *BinaryDiff `json:"binary,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"` // 文本过长或差异过多，没有逐行比较
+}
+
+// LineDiff 是一行新增或删除的文本，行号从1开始
+type LineDiff struct {
+	Change string `json:"change"`
+	LineA  int    `json:"lineA,omitempty"`
+	LineB  int    `json:"lineB,omitempty"`
+	Text   string `json:"text"`
+}
+
+type BinaryDiff struct {
+	SizeA   int    `json:"sizeA"`
+	SizeB   int    `json:"sizeB"`
+	SHA256A string `json:"sha256A"`
+	SHA256B string `json:"sha256B"`
+}
+
+// getDiff 比较两个条目的响应状态码、响应头和响应体
+func (s *Server) getDiff(c *gin.Context) {
+	idA, idB := c.Query("a"), c.Query("b")
+	if idA == "" || idB == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Both a and b entry IDs are required",
+		})
+		return
+	}
+
+	// 按a、b的顺序检查，两个都不存在时总是报告a
+	entries := make([]*handlers.TrafficEntry, 2)
+	for i, id := range []string{idA, idB} {
+		if entries[i] = s.WebHandler.GetEntry(id); entries[i] == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Entry %s not found", id),
+			})
+			return
+		}
+	}
+	entryA, entryB := entries[0], entries[1]
+
+	c.JSON(http.StatusOK, DiffEntries(entryA, entryB))
+}
+
+// DiffEntries 计算两个条目响应之间的结构化差异
+func DiffEntries(a, b *handlers.TrafficEntry) *EntryDiff {
+	result := &EntryDiff{
+		A:       a.ID,
+		B:       b.ID,
+		Headers: diffHeaders(a.ResponseHeaders, b.ResponseHeaders),
+		Body: diffBodies(a.ResponseBody, b.ResponseBody,
+			a.EffectiveContentType(), b.EffectiveContentType()),
+	}
+	if a.StatusCode != b.StatusCode {
+		result.Status = &ValueChange{From: a.StatusCode, To: b.StatusCode}
+	}
+	return result
+}
+
+func diffHeaders(a, b http.Header) []FieldDiff {
+	names := make(map[string]bool)
+	for name := range a {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	for name := range b {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diffs := make([]FieldDiff, 0)
+	for _, name := range sorted {
+		valuesA, okA := a[name]
+		valuesB, okB := b[name]
+		from, to := strings.Join(valuesA, ", "), strings.Join(valuesB, ", ")
+		switch {
+		case okA && !okB:
+			diffs = append(diffs, FieldDiff{Name: name, Change: DiffRemoved, From: from})
+		case !okA && okB:
+			diffs = append(diffs, FieldDiff{Name: name, Change: DiffAdded, To: to})
+		case from != to:
+			diffs = append(diffs, FieldDiff{Name: name, Change: DiffChanged, From: from, To: to})
+		}
+	}
+	return diffs
+}
+
+func diffBodies(a, b []byte, contentTypeA, contentTypeB string) BodyDiff {
+	identical := bytes.Equal(a, b)
+
+	if isBinaryContent(a, contentTypeA) || isBinaryContent(b, contentTypeB) {
+		return BodyDiff{
+			Kind:      "binary",
+			Identical: identical,
+			Binary: &BinaryDiff{
+				SizeA:   len(a),
+				SizeB:   len(b),
+				SHA256A: sha256Hex(a),
+				SHA256B: sha256Hex(b),
+			},
+		}
+	}
+
+	var valueA, valueB interface{}
+	if json.Unmarshal(a, &valueA) == nil && json.Unmarshal(b, &valueB) == nil {
+		fields := make([]FieldDiff, 0)
+		diffJSON("$", valueA, valueB, &fields)
+		return BodyDiff{Kind: "json", Identical: len(fields) == 0, Fields: fields}
+	}
+
+	result := BodyDiff{Kind: "text", Identical: identical}
+	if identical {
+		return result
+	}
+	lines, ok := diffLines(splitLines(a), splitLines(b))
+	if !ok {
+		result.Truncated = true
+		return result
+	}
+	result.Lines = lines
+	return result
+}
+
+// diffJSON 递归比较两个JSON值，按JSONPath风格的路径记录新增、删除和修改的键
+func diffJSON(path string, a, b interface{}, diffs *[]FieldDiff) {
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		keys := make(map[string]bool)
+		for key := range mapA {
+			keys[key] = true
+		}
+		for key := range mapB {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			valueA, inA := mapA[key]
+			valueB, inB := mapB[key]
+			childPath := path + "." + key
+			switch {
+			case inA && !inB:
+				*diffs = append(*diffs, FieldDiff{Name: childPath, Change: DiffRemoved, From: valueA})
+			case !inA && inB:
+				*diffs = append(*diffs, FieldDiff{Name: childPath, Change: DiffAdded, To: valueB})
+			default:
+				diffJSON(childPath, valueA, valueB, diffs)
+			}
+		}
+		return
+	}
+
+	sliceA, okA := a.([]interface{})
+	sliceB, okB := b.([]interface{})
+	if okA && okB {
+		for i := 0; i < len(sliceA) || i < len(sliceB); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(sliceB):
+				*diffs = append(*diffs, FieldDiff{Name: childPath, Change: DiffRemoved, From: sliceA[i]})
+			case i >= len(sliceA):
+				*diffs = append(*diffs, FieldDiff{Name: childPath, Change: DiffAdded, To: sliceB[i]})
+			default:
+				diffJSON(childPath, sliceA[i], sliceB[i], diffs)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, FieldDiff{Name: path, Change: DiffChanged, From: a, To: b})
+	}
+}
+
+func splitLines(body []byte) []string {
+	if len(body) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+}
+
+// diffLines 基于最长公共子序列计算逐行差异，只返回新增和删除的行
+// 相同的首尾行不参与比较；剩余部分的LCS表超过maxLineDiffCells时返回false
+func diffLines(a, b []string) ([]LineDiff, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(a)+1)*(len(b)+1) > maxLineDiffCells {
+		return nil, false
+	}
+
+	// lcs[i*width+j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	width := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+			}
+		}
+	}
+
+	diffs := make([]LineDiff, 0)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[(i+1)*width+j] >= lcs[i*width+j+1]):
+			diffs = append(diffs, LineDiff{Change: DiffRemoved, LineA: prefix + i + 1, Text: a[i]})
+			i++
+		default:
+			diffs = append(diffs, LineDiff{Change: DiffAdded, LineB: prefix + j + 1, Text: b[j]})
+			j++
+		}
+	}
+	return diffs, true
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
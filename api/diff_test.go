@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordResponseEntry 通过WebHandler记录一条完整的请求/响应，返回条目ID
+func recordResponseEntry(t *testing.T, handler *handlers.WebHandler, status int, header http.Header, body string) string {
+	req, err := http.NewRequest("GET", "http://example.com/api/user", nil)
+	require.NoError(t, err)
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+	handler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewBufferString(body)),
+		},
+	})
+	return reqCtx.UserData["traffic_id"].(string)
+}
+
+func TestGetDiffJSONBodies(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	idA := recordResponseEntry(t, webHandler, http.StatusOK,
+		http.Header{"Content-Type": []string{"application/json"}, "X-Version": []string{"1"}},
+		`{"user":{"name":"alice","age":30},"tags":["a","b"],"legacy":true}`)
+	idB := recordResponseEntry(t, webHandler, http.StatusCreated,
+		http.Header{"Content-Type": []string{"application/json"}, "X-Request-Id": []string{"abc"}},
+		`{"user":{"name":"bob","age":30},"tags":["a","b","c"],"active":true}`)
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/diff?a="+idA+"&b="+idB, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var diff EntryDiff
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &diff))
+
+	require.NotNil(t, diff.Status)
+	assert.EqualValues(t, http.StatusOK, diff.Status.From)
+	assert.EqualValues(t, http.StatusCreated, diff.Status.To)
+
+	headerChanges := make(map[string]string)
+	for _, header := range diff.Headers {
+		headerChanges[header.Name] = header.Change
+	}
+	assert.Equal(t, map[string]string{"X-Version": DiffRemoved, "X-Request-Id": DiffAdded}, headerChanges)
+
+	assert.Equal(t, "json", diff.Body.Kind)
+	assert.False(t, diff.Body.Identical)
+	bodyChanges := make(map[string]string)
+	for _, field := range diff.Body.Fields {
+		bodyChanges[field.Name] = field.Change
+	}
+	assert.Equal(t, map[string]string{
+		"$.user.name": DiffChanged,
+		"$.tags[2]":   DiffAdded,
+		"$.legacy":    DiffRemoved,
+		"$.active":    DiffAdded,
+	}, bodyChanges)
+}
+
+func TestGetDiffMissingEntry(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	id := recordResponseEntry(t, webHandler, http.StatusOK, http.Header{}, "ok")
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/diff?a="+id+"&b=999", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "999")
+
+	// 两个都不存在时总是报告a
+	for i := 0; i < 5; i++ {
+		recorder = httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/diff?a=888&b=999", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "Entry 888 not found")
+	}
+
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/diff?a="+id, nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestDiffTextAndBinaryBodies(t *testing.T) {
+	text := diffBodies([]byte("one\ntwo\nthree\n"), []byte("one\nTWO\nthree\nfour\n"), "text/plain", "text/plain")
+	assert.Equal(t, "text", text.Kind)
+	assert.Equal(t, []LineDiff{
+		{Change: DiffRemoved, LineA: 2, Text: "two"},
+		{Change: DiffAdded, LineB: 2, Text: "TWO"},
+		{Change: DiffAdded, LineB: 4, Text: "four"},
+	}, text.Lines)
+
+	// 大文本中只改动一行时只比较改动的部分，行号仍然对应原文
+	var large, changed strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&large, "line %d\n", i)
+		if i == 12345 {
+			changed.WriteString("edited\n")
+		} else {
+			fmt.Fprintf(&changed, "line %d\n", i)
+		}
+	}
+	edited := diffBodies([]byte(large.String()), []byte(changed.String()), "text/plain", "text/plain")
+	assert.False(t, edited.Truncated)
+	assert.Equal(t, []LineDiff{
+		{Change: DiffRemoved, LineA: 12346, Text: "line 12345"},
+		{Change: DiffAdded, LineB: 12346, Text: "edited"},
+	}, edited.Lines)
+
+	// 差异过多时不逐行比较
+	rewritten := diffBodies([]byte(large.String()), []byte(strings.ReplaceAll(large.String(), "line", "row")), "text/plain", "text/plain")
+	assert.True(t, rewritten.Truncated)
+	assert.Empty(t, rewritten.Lines)
+
+	binary := diffBodies([]byte{0x89, 'P', 'N', 'G', 0}, []byte{0x89, 'P', 'N', 'G', 0, 1}, "image/png", "image/png")
+	assert.Equal(t, "binary", binary.Kind)
+	assert.False(t, binary.Identical)
+	require.NotNil(t, binary.Binary)
+	assert.Equal(t, 5, binary.Binary.SizeA)
+	assert.Equal(t, 6, binary.Binary.SizeB)
+	assert.NotEqual(t, binary.Binary.SHA256A, binary.Binary.SHA256B)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// jsonlEntry 是JSONL导出的一行，带 ?bodies=1 时附带请求/响应头和消息体
+// 文本消息体按原文输出，二进制消息体以base64编码并设置对应的Encoding字段
+type jsonlEntry struct {
+	*handlers.TrafficEntry
+	RequestHeaders       http.Header `json:"requestHeaders,omitempty"`
+	RequestBody          string      `json:"requestBody,omitempty"`
+	RequestBodyEncoding  string      `json:"requestBodyEncoding,omitempty"`
+	ResponseHeaders      http.Header `json:"responseHeaders,omitempty"`
+	ResponseBody         string      `json:"responseBody,omitempty"`
+	ResponseBodyEncoding string      `json:"responseBodyEncoding,omitempty"`
+}
+
+// exportJSONL 以JSON Lines格式流式导出流量条目，每行一个JSON对象，便于用jq等工具处理
+// 支持 host、contentType、errorKind 过滤，bodies=1 时附带消息体；边读取边写出，不会把全部条目加载到内存
+func (s *Server) exportJSONL(c *gin.Context) {
+	withBodies, _ := strconv.ParseBool(c.Query("bodies"))
+	filter := handlers.EntryFilter{
+		Host:        c.Query("host"),
+		ContentType: c.Query("contentType"),
+		ErrorKind:   c.Query("errorKind"),
+	}
+
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="proxycraft.jsonl"`)
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	encoder := json.NewEncoder(c.Writer)
+	count := 0
+	err := s.WebHandler.EachEntry(filter, func(entry *handlers.TrafficEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := &jsonlEntry{TrafficEntry: entry}
+		if withBodies {
+			if full := s.WebHandler.GetEntry(entry.ID); full != nil {
+				line = newJSONLEntryWithBodies(entry, full)
+			}
+		}
+		// Encoder在每个对象后写入换行
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		count++
+		return nil
+	})
+	if err != nil {
+		// 响应头已经发出，只能记录错误并提前结束输出
+		log.Printf("API: JSONL导出在 %d 条后中断: %v", count, err)
+	}
+}
+
+func newJSONLEntryWithBodies(summary, full *handlers.TrafficEntry) *jsonlEntry {
+	line := &jsonlEntry{
+		TrafficEntry:    summary,
+		RequestHeaders:  full.RequestHeaders,
+		ResponseHeaders: full.ResponseHeaders,
+	}
+	line.RequestBody, line.RequestBodyEncoding = encodeJSONLBody(full.RequestBody, full.RequestHeaders.Get("Content-Type"))
+	line.ResponseBody, line.ResponseBodyEncoding = encodeJSONLBody(full.ResponseBody, full.EffectiveContentType())
+	return line
+}
+
+// encodeJSONLBody 返回消息体的导出文本和编码方式，文本内容的编码方式为空
+func encodeJSONLBody(body []byte, contentType string) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if isBinaryContent(body, contentType) {
+		return base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return string(body), ""
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readJSONLines 要求每行都是一个完整的JSON对象，返回解析后的对象
+func readJSONLines(t *testing.T, body string) []map[string]interface{} {
+	t.Helper()
+	var objects []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var object map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &object), "line %q", scanner.Text())
+		objects = append(objects, object)
+	}
+	require.NoError(t, scanner.Err())
+	return objects
+}
+
+func TestExportJSONL(t *testing.T) {
+	for _, storage := range []handlers.StorageMode{handlers.StorageBoth, handlers.StorageMemory} {
+		t.Run(string(storage), func(t *testing.T) {
+			webHandler, err := handlers.NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "traffic.db"), storage)
+			require.NoError(t, err)
+			server := NewServer(webHandler, 0)
+
+			firstID := recordRequestEntry(t, webHandler, http.MethodPost, "https://api.example.com/v1/users",
+				"application/json", `{"name":"alice"}`)
+			recordRequestEntry(t, webHandler, http.MethodGet, "http://other.example.org/status", "", "")
+			lastID := recordRequestEntry(t, webHandler, http.MethodGet, "https://api.example.com/v1/users/1", "", "")
+
+			recorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/export.jsonl", nil))
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Contains(t, recorder.Header().Get("Content-Type"), "application/x-ndjson")
+			assert.True(t, strings.HasSuffix(recorder.Body.String(), "\n"))
+
+			lines := readJSONLines(t, recorder.Body.String())
+			require.Len(t, lines, 3)
+			assert.Equal(t, firstID, lines[0]["id"])
+			assert.Equal(t, lastID, lines[2]["id"])
+			assert.NotContains(t, lines[0], "requestBody")
+
+			recorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+				"/api/traffic/export.jsonl?host=API.example.com&contentType=application/json&bodies=1", nil))
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			lines = readJSONLines(t, recorder.Body.String())
+			require.Len(t, lines, 2)
+			for _, line := range lines {
+				assert.Equal(t, "api.example.com", line["host"])
+			}
+			assert.Equal(t, `{"name":"alice"}`, lines[0]["requestBody"])
+			assert.Equal(t, "{}", lines[0]["responseBody"])
+			assert.NotContains(t, lines[0], "requestBodyEncoding")
+			assert.Contains(t, lines[0]["requestHeaders"], "Authorization")
+
+			recorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/export.jsonl?contentType=text/html", nil))
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Empty(t, recorder.Body.String())
+		})
+	}
+}
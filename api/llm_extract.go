@@ -1,12 +1,12 @@
 package api
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
+	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/LubyRuffy/ProxyCraft/proxy"
 	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
 )
 
@@ -19,9 +19,18 @@ type LLMExtracted struct {
 }
 
 type LLMRequestInfo struct {
-	Prompt    string      `json:"prompt,omitempty"`
-	ToolCalls interface{} `json:"toolCalls,omitempty"`
-	Tools     interface{} `json:"tools,omitempty"`
+	Prompt      string          `json:"prompt,omitempty"`
+	ToolCalls   interface{}     `json:"toolCalls,omitempty"`
+	Tools       interface{}     `json:"tools,omitempty"`
+	ToolResults []LLMToolResult `json:"toolResults,omitempty"`
+}
+
+// LLMToolResult is a function/tool result sent back to the model in an agent loop.
+type LLMToolResult struct {
+	ToolCallID string      `json:"toolCallId,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Content    interface{} `json:"content,omitempty"`
+	IsError    bool        `json:"isError,omitempty"`
 }
 
 type LLMResponseInfo struct {
@@ -30,14 +39,33 @@ type LLMResponseInfo struct {
 	Reasoning string      `json:"reasoning,omitempty"`
 }
 
+// extractEntryLLM runs ExtractLLM unless webHandler records no bodies (-no-bodies):
+// there is nothing to parse then, and a provider guessed from headers alone would
+// show an empty conversation. Hosts declared with SetLLMHosts are recognized as well.
+func extractEntryLLM(webHandler *handlers.WebHandler, entry *handlers.TrafficEntry, includeRequest bool, includeResponse bool) *LLMExtracted {
+	if webHandler == nil {
+		return ExtractLLM(entry, includeRequest, includeResponse)
+	}
+	if webHandler.NoBodies() {
+		return nil
+	}
+	return ExtractLLMWithHosts(entry, webHandler.LLMHosts(), includeRequest, includeResponse)
+}
+
 // ExtractLLM extracts structured LLM request/response data.
 func ExtractLLM(entry *handlers.TrafficEntry, includeRequest bool, includeResponse bool) *LLMExtracted {
-	if entry == nil {
+	return ExtractLLMWithHosts(entry, nil, includeRequest, includeResponse)
+}
+
+// ExtractLLMWithHosts is ExtractLLM that also treats the given hosts as LLM
+// endpoints, so self-hosted servers are recognized even without JSON bodies.
+func ExtractLLMWithHosts(entry *handlers.TrafficEntry, hosts *proxy.LLMHosts, includeRequest bool, includeResponse bool) *LLMExtracted {
+	if entry == nil || !shouldExtractLLM(entry, hosts) {
 		return nil
 	}
 
 	reqPayload := parseJSONMap(entry.RequestBody)
-	provider := detectLLMProvider(entry, reqPayload)
+	provider := detectLLMProvider(entry, hosts, reqPayload)
 	if provider == "" {
 		return nil
 	}
@@ -81,6 +109,30 @@ func ExtractLLM(entry *handlers.TrafficEntry, includeRequest bool, includeRespon
 	return result
 }
 
+// shouldExtractLLM is a cheap pre-check run before any body is parsed: only
+// JSON or SSE traffic, or a host/path/auth header known to belong to an LLM API,
+// is worth the full detection. It keeps images, downloads and other binary entries from
+// being unmarshalled on every list refresh.
+func shouldExtractLLM(entry *handlers.TrafficEntry, hosts *proxy.LLMHosts) bool {
+	if entry.IsSSE {
+		return true
+	}
+	for _, contentType := range []string{
+		entry.RequestHeaders.Get("Content-Type"),
+		entry.ContentType,
+		entry.DetectedContentType,
+		entry.ResponseHeaders.Get("Content-Type"),
+	} {
+		contentType = strings.ToLower(contentType)
+		if strings.Contains(contentType, "json") || strings.Contains(contentType, "text/event-stream") {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(entry.URL), "openai") ||
+		hosts.Detect(entry.Host, entry.Path) != "" ||
+		detectLLMProviderFromHeaders(entry.RequestHeaders) != ""
+}
+
 func parseJSONMap(body []byte) map[string]interface{} {
 	if len(body) == 0 {
 		return nil
@@ -96,28 +148,15 @@ func parseJSONMap(body []byte) map[string]interface{} {
 	return m
 }
 
-func detectLLMProvider(entry *handlers.TrafficEntry, payload map[string]interface{}) string {
-	host := strings.ToLower(entry.Host)
-	path := strings.ToLower(entry.Path)
-	url := strings.ToLower(entry.URL)
-
-	if strings.Contains(host, "openai") || strings.Contains(url, "openai") {
+func detectLLMProvider(entry *handlers.TrafficEntry, hosts *proxy.LLMHosts, payload map[string]interface{}) string {
+	if strings.Contains(strings.ToLower(entry.URL), "openai") {
 		return "openai"
 	}
-	if strings.Contains(host, "anthropic") || strings.Contains(host, "claude") || strings.Contains(path, "/v1/messages") || strings.Contains(path, "/v1/complete") {
-		return "claude"
-	}
-	if strings.Contains(host, "generativelanguage") || strings.Contains(path, "generatecontent") || strings.Contains(path, "streamgeneratecontent") {
-		return "gemini"
-	}
-	if strings.Contains(host, "ollama") || strings.Contains(path, "/api/generate") || strings.Contains(path, "/api/chat") {
-		return "ollama"
-	}
-	if strings.Contains(path, "/responses") {
-		return "openai-compatible"
+	if provider := hosts.Detect(entry.Host, entry.Path); provider != "" {
+		return provider
 	}
-	if strings.Contains(path, "/v1/chat/completions") || strings.Contains(path, "/v1/completions") || strings.Contains(path, "/v1/responses") {
-		return "openai-compatible"
+	if provider := detectLLMProviderFromHeaders(entry.RequestHeaders); provider != "" {
+		return provider
 	}
 
 	if payload != nil {
@@ -138,6 +177,26 @@ func detectLLMProvider(entry *handlers.TrafficEntry, payload map[string]interfac
 	return ""
 }
 
+// detectLLMProviderFromHeaders classifies requests to gateways on generic hosts
+// (LiteLLM, OpenRouter, ...) by the authentication headers each API uses.
+func detectLLMProviderFromHeaders(header http.Header) string {
+	if header == nil {
+		return ""
+	}
+	if header.Get("x-api-key") != "" && header.Get("anthropic-version") != "" {
+		return "claude"
+	}
+	if header.Get("x-goog-api-key") != "" {
+		return "gemini"
+	}
+	auth := strings.TrimSpace(header.Get("Authorization"))
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") &&
+		strings.HasPrefix(strings.TrimSpace(auth[len("Bearer "):]), "sk-") {
+		return "openai-compatible"
+	}
+	return ""
+}
+
 func extractLLMRequest(payload map[string]interface{}, provider string) *LLMRequestInfo {
 	var prompt string
 	var toolCalls interface{}
@@ -169,15 +228,17 @@ func extractLLMRequest(payload map[string]interface{}, provider string) *LLMRequ
 	}
 
 	toolCalls = extractToolCallsFromRequest(payload)
+	toolResults := extractToolResultsFromRequest(payload)
 
-	if prompt == "" && tools == nil && toolCalls == nil {
+	if prompt == "" && tools == nil && toolCalls == nil && len(toolResults) == 0 {
 		return nil
 	}
 
 	return &LLMRequestInfo{
-		Prompt:    prompt,
-		ToolCalls: toolCalls,
-		Tools:     tools,
+		Prompt:      prompt,
+		ToolCalls:   toolCalls,
+		Tools:       tools,
+		ToolResults: toolResults,
 	}
 }
 
@@ -186,7 +247,7 @@ func extractLLMResponse(entry *handlers.TrafficEntry, provider string) (*LLMResp
 		return nil, ""
 	}
 
-	contentType := strings.ToLower(entry.ContentType)
+	contentType := strings.ToLower(entry.EffectiveContentType())
 	if entry.IsSSE || strings.Contains(contentType, "text/event-stream") {
 		content, reasoning, toolCalls, model := extractLLMResponseFromSSE(entry.ResponseBody, provider)
 		if content == "" && reasoning == "" && toolCalls == nil {
@@ -243,10 +304,8 @@ func extractLLMResponseFromJSON(payload map[string]interface{}, provider string)
 				if text := extractTextFromContent(itemMap["content"]); text != "" {
 					content.WriteString(text)
 				}
-			} else if itemType == "function_call" || itemType == "tool_call" || itemType == "tool_use" {
-				if call := buildToolCallFromOutputItem(itemMap); call != nil {
-					toolCalls = append(toolCalls, call)
-				}
+			} else if call := buildToolCallFromOutputItem(itemMap); call != nil {
+				toolCalls = append(toolCalls, call)
 			}
 		}
 	}
@@ -401,44 +460,18 @@ func extractLLMResponseFromSSE(body []byte, provider string) (string, string, in
 	if len(responseState.toolCalls) > 0 && len(toolCalls) == 0 {
 		toolCalls = append(toolCalls, responseState.toolCalls...)
 	}
+	finalizeToolCallArguments(toolCalls)
 
 	return strings.TrimSpace(content.String()), strings.TrimSpace(reasoning.String()), toolCalls, model
 }
 
 func parseSSEDataEvents(body []byte) []string {
-	scanner := bufio.NewScanner(bytes.NewReader(body))
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-	var dataLines []string
-	var events []string
-	var dataPerLine []string
-	hasEmptyLine := false
-
-	for scanner.Scan() {
-		line := strings.TrimRight(scanner.Text(), "\r")
-		if line == "" {
-			hasEmptyLine = true
-			if len(dataLines) > 0 {
-				events = append(events, strings.Join(dataLines, "\n"))
-				dataLines = nil
-			}
-			continue
-		}
-		if strings.HasPrefix(line, "data:") {
-			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-			dataLines = append(dataLines, data)
-			dataPerLine = append(dataPerLine, data)
-		}
-	}
-
-	if len(dataLines) > 0 {
-		events = append(events, strings.Join(dataLines, "\n"))
-	}
-
-	if !hasEmptyLine && len(dataPerLine) > 1 {
-		return dataPerLine
+	events := parseSSEEvents(body)
+	data := make([]string, 0, len(events))
+	for _, event := range events {
+		data = append(data, event.Data)
 	}
-
-	return events
+	return data
 }
 
 func parseOpenAISSEPayload(payload map[string]interface{}, content *strings.Builder, reasoning *strings.Builder, toolCalls *[]map[string]interface{}) {
@@ -581,6 +614,16 @@ func parseOpenAIResponsesSSEPayload(payload map[string]interface{}, content *str
 		}
 	}
 
+	// code_interpreter_call code streams through its own events; fold it into the matching call.
+	if strings.HasPrefix(payloadType, "response.code_interpreter_call_code.") && itemID != "" {
+		if code, ok := payload["code"].(string); ok {
+			upsertToolCall(&state.toolCalls, map[string]interface{}{"id": itemID, "type": "code_interpreter_call", "code": code})
+		} else if delta, ok := payload["delta"].(string); ok && delta != "" {
+			appendToolCallCode(state, itemID, delta)
+		}
+		return true
+	}
+
 	if delta, ok := payload["delta"].(string); ok && delta != "" {
 		if strings.Contains(payloadType, "output_text") {
 			content.WriteString(delta)
@@ -791,6 +834,17 @@ func upsertToolCall(toolCalls *[]interface{}, call interface{}) {
 	*toolCalls = append(*toolCalls, callMap)
 }
 
+// appendToolCallCode appends a code_interpreter_call code delta to the recorded call.
+func appendToolCallCode(state *openAIResponseStreamState, itemID, delta string) {
+	for _, existing := range state.toolCalls {
+		if call := asMap(existing); call != nil && extractToolCallID(call) == itemID {
+			call["code"] = asStringField(call, "code") + delta
+			return
+		}
+	}
+	upsertToolCall(&state.toolCalls, map[string]interface{}{"id": itemID, "type": "code_interpreter_call", "code": delta})
+}
+
 func extractToolCallID(call map[string]interface{}) string {
 	if call == nil {
 		return ""
@@ -874,6 +928,16 @@ func buildToolCallFromOutputItem(item map[string]interface{}) map[string]interfa
 		return nil
 	}
 
+	// Built-in tools (file_search_call, computer_call, code_interpreter_call, mcp_call, ...) carry
+	// type-specific action/results/outputs fields, so keep them intact instead of reshaping to a function.
+	if isBuiltinToolType(itemType) {
+		call := make(map[string]interface{}, len(item))
+		for key, value := range item {
+			call[key] = value
+		}
+		return call
+	}
+
 	if function := asMap(item["function"]); function != nil {
 		call := map[string]interface{}{
 			"type":     "function",
@@ -932,6 +996,15 @@ func isToolLikeType(itemType string) bool {
 	return strings.Contains(itemType, "tool") || strings.HasSuffix(itemType, "_call") || strings.Contains(itemType, "function_call")
 }
 
+// isBuiltinToolType reports whether a Responses output item is a non-function tool call.
+func isBuiltinToolType(itemType string) bool {
+	switch itemType {
+	case "function_call", "tool_call", "tool_use", "function":
+		return false
+	}
+	return isToolLikeType(itemType) && !strings.HasSuffix(itemType, "_output")
+}
+
 func hasToolCallIdentity(item map[string]interface{}) bool {
 	if item == nil {
 		return false
@@ -948,6 +1021,12 @@ func hasToolCallIdentity(item map[string]interface{}) bool {
 	if _, ok := item["tool"]; ok {
 		return true
 	}
+	// computer_call action, file_search_call queries, code_interpreter_call outputs
+	for _, key := range []string{"action", "queries", "outputs"} {
+		if _, ok := item[key]; ok {
+			return true
+		}
+	}
 	return false
 }
 
@@ -1048,10 +1127,108 @@ func extractToolCallsFromRequest(payload map[string]interface{}) interface{} {
 	return nil
 }
 
+// extractToolResultsFromRequest collects tool results fed back to the model:
+// OpenAI role "tool"/"function" messages and Responses API function_call_output items,
+// Claude tool_result content blocks and Gemini functionResponse parts.
+func extractToolResultsFromRequest(payload map[string]interface{}) []LLMToolResult {
+	var results []LLMToolResult
+	results = append(results, extractToolResultsFromMessages(asSlice(payload["messages"]))...)
+	results = append(results, extractToolResultsFromMessages(asSlice(payload["input"]))...)
+	results = append(results, extractToolResultsFromContents(asSlice(payload["contents"]))...)
+	return results
+}
+
+func extractToolResultsFromMessages(messages []interface{}) []LLMToolResult {
+	var results []LLMToolResult
+	for _, raw := range messages {
+		message := asMap(raw)
+		if message == nil {
+			continue
+		}
+		if isToolResultMessage(message) {
+			results = append(results, LLMToolResult{
+				ToolCallID: asStringField(message, "tool_call_id"),
+				Name:       asStringField(message, "name"),
+				Content:    message["content"],
+			})
+			continue
+		}
+		if asStringField(message, "type") == "function_call_output" {
+			results = append(results, LLMToolResult{
+				ToolCallID: asStringField(message, "call_id"),
+				Content:    message["output"],
+			})
+			continue
+		}
+		for _, block := range asSlice(message["content"]) {
+			blockMap := asMap(block)
+			if blockMap == nil || asStringField(blockMap, "type") != "tool_result" {
+				continue
+			}
+			isError, _ := asBool(blockMap, "is_error")
+			results = append(results, LLMToolResult{
+				ToolCallID: asStringField(blockMap, "tool_use_id"),
+				Content:    blockMap["content"],
+				IsError:    isError,
+			})
+		}
+	}
+	return results
+}
+
+func extractToolResultsFromContents(contents []interface{}) []LLMToolResult {
+	var results []LLMToolResult
+	for _, raw := range contents {
+		content := asMap(raw)
+		if content == nil {
+			continue
+		}
+		for _, part := range asSlice(content["parts"]) {
+			partMap := asMap(part)
+			if partMap == nil {
+				continue
+			}
+			if response := asMap(partMap["functionResponse"]); response != nil {
+				results = append(results, LLMToolResult{
+					ToolCallID: asStringField(response, "id"),
+					Name:       asStringField(response, "name"),
+					Content:    response["response"],
+				})
+			}
+		}
+	}
+	return results
+}
+
+// isToolResultMessage reports whether an OpenAI-style message carries a tool result instead of prompt text.
+func isToolResultMessage(message map[string]interface{}) bool {
+	role := asStringField(message, "role")
+	return role == "tool" || role == "function"
+}
+
+// withoutToolResults drops Claude tool_result blocks so they are reported as ToolResults rather than prompt text.
+func withoutToolResults(content interface{}) interface{} {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+	filtered := make([]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		if blockMap := asMap(block); blockMap != nil && asStringField(blockMap, "type") == "tool_result" {
+			continue
+		}
+		filtered = append(filtered, block)
+	}
+	return filtered
+}
+
 func buildPromptFromMessages(messages []interface{}) string {
 	return buildPromptFromRoleContent(messages, func(item map[string]interface{}) (string, string) {
 		role := asStringField(item, "role")
-		content := extractTextFromContent(item["content"])
+		if isToolResultMessage(item) {
+			return role, ""
+		}
+		content := extractTextFromContent(withoutToolResults(item["content"]))
 		if content == "" {
 			content = extractTextFromContent(item["parts"])
 		}
@@ -1408,6 +1585,48 @@ func appendToolCallInput(toolCalls *[]interface{}, chunk string) {
 	(*toolCalls)[len(*toolCalls)-1] = lastMap
 }
 
+// finalizeToolCallArguments 将流式拼接完成的参数字符串解析为JSON对象
+// 覆盖Claude的input、OpenAI的function.arguments以及Responses API的arguments，解析失败时保留原字符串
+func finalizeToolCallArguments(toolCalls []interface{}) {
+	for _, raw := range toolCalls {
+		call := asMap(raw)
+		if call == nil {
+			continue
+		}
+		for _, key := range []string{"input", "arguments"} {
+			if parsed, ok := parseStreamedArguments(call[key]); ok {
+				call[key] = parsed
+			}
+		}
+		if fn := asMap(call["function"]); fn != nil {
+			if parsed, ok := parseStreamedArguments(fn["arguments"]); ok {
+				fn["arguments"] = parsed
+			}
+		}
+	}
+}
+
+// parseStreamedArguments 尝试把参数字符串解析为对象或数组，其余情况返回false
+func parseStreamedArguments(value interface{}) (interface{}, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, false
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+		return nil, false
+	}
+	switch parsed.(type) {
+	case map[string]interface{}, []interface{}:
+		return parsed, true
+	}
+	return nil, false
+}
+
 func asSlice(value interface{}) []interface{} {
 	if value == nil {
 		return nil
@@ -1,9 +1,17 @@
 package api
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"testing"
 
+	"github.com/LubyRuffy/ProxyCraft/proxy"
 	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -260,6 +268,116 @@ func TestExtractLLMResponsesSSEToolCallUpsert(t *testing.T) {
 	assert.Equal(t, "hi", action["query"])
 }
 
+func responsesToolCallsByID(t *testing.T, body string) map[string]map[string]interface{} {
+	t.Helper()
+	entry := &handlers.TrafficEntry{
+		Host:            "api.openai.com",
+		Path:            "/v1/responses",
+		RequestHeaders:  http.Header{"Content-Type": []string{"application/json"}},
+		RequestBody:     []byte(`{"model":"gpt-4.1","input":"hi","stream":true}`),
+		ResponseHeaders: http.Header{"Content-Type": []string{"text/event-stream"}},
+		ResponseBody:    []byte(body),
+		IsSSE:           true,
+	}
+	info := ExtractLLM(entry, false, true)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Response)
+	calls, ok := info.Response.ToolCalls.([]interface{})
+	require.True(t, ok)
+	byID := map[string]map[string]interface{}{}
+	for _, raw := range calls {
+		call, ok := raw.(map[string]interface{})
+		require.True(t, ok)
+		byID[extractToolCallID(call)] = call
+	}
+	return byID
+}
+
+func TestExtractLLMResponsesSSEFileSearchCall(t *testing.T) {
+	calls := responsesToolCallsByID(t,
+		"data: {\"type\":\"response.output_item.added\",\"output_index\":0,\"item\":{\"id\":\"fs_1\",\"type\":\"file_search_call\",\"status\":\"in_progress\",\"queries\":[]}}\n\n"+
+			"data: {\"type\":\"response.file_search_call.in_progress\",\"output_index\":0,\"item_id\":\"fs_1\"}\n\n"+
+			"data: {\"type\":\"response.file_search_call.searching\",\"output_index\":0,\"item_id\":\"fs_1\"}\n\n"+
+			"data: {\"type\":\"response.file_search_call.completed\",\"output_index\":0,\"item_id\":\"fs_1\"}\n\n"+
+			"data: {\"type\":\"response.output_item.done\",\"output_index\":0,\"item\":{\"id\":\"fs_1\",\"type\":\"file_search_call\",\"status\":\"completed\",\"queries\":[\"deep research\"],\"results\":[{\"file_id\":\"file-1\",\"filename\":\"notes.pdf\",\"score\":0.9,\"text\":\"snippet\"}]}}\n\n"+
+			"data: {\"type\":\"response.output_item.done\",\"output_index\":1,\"item\":{\"id\":\"fc_1\",\"call_id\":\"call_1\",\"type\":\"function_call\",\"name\":\"lookup\",\"arguments\":\"{\\\"q\\\":1}\"}}\n\n")
+
+	require.Len(t, calls, 2)
+	fileSearch := calls["fs_1"]
+	require.NotNil(t, fileSearch)
+	assert.Equal(t, "file_search_call", fileSearch["type"])
+	assert.Equal(t, "completed", fileSearch["status"])
+	assert.Equal(t, []interface{}{"deep research"}, fileSearch["queries"])
+	results, ok := fileSearch["results"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, results, 1)
+	assert.Equal(t, "notes.pdf", results[0].(map[string]interface{})["filename"])
+
+	function, ok := calls["fc_1"]["function"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "lookup", function["name"])
+}
+
+func TestExtractLLMResponsesSSECodeInterpreterCall(t *testing.T) {
+	calls := responsesToolCallsByID(t,
+		"data: {\"type\":\"response.output_item.added\",\"output_index\":0,\"item\":{\"id\":\"ci_1\",\"type\":\"code_interpreter_call\",\"status\":\"in_progress\",\"container_id\":\"cntr_1\"}}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call.in_progress\",\"output_index\":0,\"item_id\":\"ci_1\"}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call_code.delta\",\"output_index\":0,\"item_id\":\"ci_1\",\"delta\":\"print(\"}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call_code.delta\",\"output_index\":0,\"item_id\":\"ci_1\",\"delta\":\"1+1)\"}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call.interpreting\",\"output_index\":0,\"item_id\":\"ci_1\"}\n\n")
+
+	// A truncated stream still records the code streamed so far
+	require.Len(t, calls, 1)
+	assert.Equal(t, "print(1+1)", calls["ci_1"]["code"])
+	assert.Equal(t, "cntr_1", calls["ci_1"]["container_id"])
+
+	calls = responsesToolCallsByID(t,
+		"data: {\"type\":\"response.output_item.added\",\"output_index\":0,\"item\":{\"id\":\"ci_1\",\"type\":\"code_interpreter_call\",\"status\":\"in_progress\",\"container_id\":\"cntr_1\"}}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call_code.delta\",\"output_index\":0,\"item_id\":\"ci_1\",\"delta\":\"print(\"}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call_code.done\",\"output_index\":0,\"item_id\":\"ci_1\",\"code\":\"print(1+1)\"}\n\n"+
+			"data: {\"type\":\"response.code_interpreter_call.completed\",\"output_index\":0,\"item_id\":\"ci_1\"}\n\n"+
+			"data: {\"type\":\"response.output_item.done\",\"output_index\":0,\"item\":{\"id\":\"ci_1\",\"type\":\"code_interpreter_call\",\"status\":\"completed\",\"container_id\":\"cntr_1\",\"code\":\"print(1+1)\",\"outputs\":[{\"type\":\"logs\",\"logs\":\"2\\n\"}]}}\n\n")
+
+	require.Len(t, calls, 1)
+	call := calls["ci_1"]
+	assert.Equal(t, "code_interpreter_call", call["type"])
+	assert.Equal(t, "completed", call["status"])
+	assert.Equal(t, "print(1+1)", call["code"])
+	outputs, ok := call["outputs"].([]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "2\n", outputs[0].(map[string]interface{})["logs"])
+}
+
+func TestExtractLLMResponsesJSONBuiltinToolCalls(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host:            "api.openai.com",
+		Path:            "/v1/responses",
+		RequestHeaders:  http.Header{"Content-Type": []string{"application/json"}},
+		RequestBody:     []byte(`{"model":"computer-use-preview","input":"open the page"}`),
+		ResponseHeaders: http.Header{"Content-Type": []string{"application/json"}},
+		ResponseBody: []byte(`{"object":"response","model":"computer-use-preview","output":[
+			{"id":"cu_1","type":"computer_call","call_id":"call_9","status":"completed","action":{"type":"click","button":"left","x":10,"y":20},"pending_safety_checks":[]},
+			{"id":"mcp_1","type":"mcp_call","name":"search","arguments":"{}","server_label":"docs","output":"found"}
+		]}`),
+	}
+	info := ExtractLLM(entry, false, true)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Response)
+	calls, ok := info.Response.ToolCalls.([]interface{})
+	require.True(t, ok)
+	require.Len(t, calls, 2)
+
+	computer := calls[0].(map[string]interface{})
+	assert.Equal(t, "call_9", computer["call_id"])
+	action, ok := computer["action"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "click", action["type"])
+
+	mcp := calls[1].(map[string]interface{})
+	assert.Equal(t, "docs", mcp["server_label"])
+	assert.Equal(t, "found", mcp["output"])
+}
+
 func TestExtractLLMClaude(t *testing.T) {
 	entry := &handlers.TrafficEntry{
 		Host: "api.anthropic.com",
@@ -298,3 +416,313 @@ func TestExtractLLMClaude(t *testing.T) {
 	assert.NotEmpty(t, info.Response.ToolCalls)
 	assert.Equal(t, "Reasoning chain", info.Response.Reasoning)
 }
+
+func TestExtractLLMClaudeSSEToolInputFinalized(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host: "api.anthropic.com",
+		Path: "/v1/messages",
+		ResponseHeaders: http.Header{
+			"Content-Type": []string{"text/event-stream"},
+		},
+		ResponseBody: []byte("event: content_block_start\n" +
+			"data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"get_weather\",\"input\":{}}}\n\n" +
+			"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\"}}\n\n" +
+			"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"city\\\": \\\"Par\"}}\n\n" +
+			"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"is\\\", \\\"days\\\": 3}\"}}\n\n" +
+			"data: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+			"data: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_2\",\"name\":\"broken\",\"input\":{}}}\n\n" +
+			"data: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"unterminated\\\":\"}}\n\n"),
+		IsSSE: true,
+	}
+
+	info := ExtractLLM(entry, false, true)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Response)
+
+	calls, ok := info.Response.ToolCalls.([]interface{})
+	require.True(t, ok)
+	require.Len(t, calls, 2)
+
+	first := calls[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"city": "Paris", "days": float64(3)}, first["input"])
+
+	// 参数不完整时保留原始字符串
+	second := calls[1].(map[string]interface{})
+	assert.Equal(t, `{"unterminated":`, second["input"])
+}
+
+func TestExtractLLMOpenAISSEToolArgumentsFinalized(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host: "api.openai.com",
+		Path: "/v1/chat/completions",
+		ResponseHeaders: http.Header{
+			"Content-Type": []string{"text/event-stream"},
+		},
+		ResponseBody: []byte("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"search\",\"arguments\":\"\"}}]}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"q\\\":\"}}]}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"type\":\"function\",\"function\":{\"name\":\"open\",\"arguments\":\"{\\\"ids\\\":[1,\"}}]}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"golang\\\"}\"}}]}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"function\":{\"arguments\":\"2]}\"}}]}}]}\n\n" +
+			"data: [DONE]\n\n"),
+		IsSSE: true,
+	}
+
+	info := ExtractLLM(entry, false, true)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Response)
+
+	calls, ok := info.Response.ToolCalls.([]interface{})
+	require.True(t, ok)
+	require.Len(t, calls, 2)
+
+	first := calls[0].(map[string]interface{})["function"].(map[string]interface{})
+	assert.Equal(t, "search", first["name"])
+	assert.Equal(t, map[string]interface{}{"q": "golang"}, first["arguments"])
+
+	second := calls[1].(map[string]interface{})["function"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"ids": []interface{}{float64(1), float64(2)}}, second["arguments"])
+}
+
+func TestExtractLLMGzippedRequestBody(t *testing.T) {
+	payload := `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"Hello gzip"}]}`
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(payload))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	// 上游收到的必须是原始的压缩字节
+	var received []byte
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"Hi"}}]}`))
+	}))
+	defer backend.Close()
+
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	proxyServer := proxy.NewServerWithConfig(proxy.Config{
+		EventHandler: webHandler,
+		LogWriter:    io.Discard,
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go proxyServer.Serve(listener)
+
+	proxyURL, err := url.Parse("http://" + listener.Addr().String())
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	req, err := http.NewRequest(http.MethodPost, backend.URL+"/v1/chat/completions", bytes.NewReader(compressed.Bytes()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, compressed.Bytes(), received)
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	entry := webHandler.GetEntry(entries[0].ID)
+	require.NotNil(t, entry)
+	assert.JSONEq(t, payload, string(entry.RequestBody))
+
+	info := ExtractLLM(entry, true, false)
+	require.NotNil(t, info)
+	assert.Equal(t, "gpt-4o-mini", info.Model)
+	require.NotNil(t, info.Request)
+	assert.Contains(t, info.Request.Prompt, "Hello gzip")
+}
+
+func TestExtractLLMProviderFromGatewayHeaders(t *testing.T) {
+	openRouter := &handlers.TrafficEntry{
+		Host: "llm-gateway.internal",
+		Path: "/api/v1/chat/completions",
+		RequestHeaders: http.Header{
+			"Content-Type":  []string{"application/json"},
+			"Authorization": []string{"Bearer sk-or-v1-abc123"},
+		},
+		RequestBody: []byte(`{"model":"meta-llama/llama-3-70b","messages":[{"role":"user","content":"Hello"}]}`),
+	}
+	info := ExtractLLM(openRouter, true, false)
+	require.NotNil(t, info)
+	assert.Equal(t, "openai-compatible", info.Provider)
+	assert.Equal(t, "meta-llama/llama-3-70b", info.Model)
+	require.NotNil(t, info.Request)
+	assert.Contains(t, info.Request.Prompt, "Hello")
+
+	// Claude的messages请求体与OpenAI相同，只能依靠请求头区分
+	claude := &handlers.TrafficEntry{
+		Host: "llm-gateway.internal",
+		Path: "/anthropic/v1/chat",
+		RequestHeaders: http.Header{
+			"X-Api-Key":         []string{"key"},
+			"Anthropic-Version": []string{"2023-06-01"},
+		},
+		RequestBody: []byte(`{"model":"claude-3-5-sonnet","system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}`),
+	}
+	info = ExtractLLM(claude, true, false)
+	require.NotNil(t, info)
+	assert.Equal(t, "claude", info.Provider)
+	assert.Contains(t, info.Request.Prompt, "Be brief.")
+
+	assert.Equal(t, "gemini", detectLLMProviderFromHeaders(http.Header{"X-Goog-Api-Key": []string{"key"}}))
+	assert.Equal(t, "openai-compatible", detectLLMProviderFromHeaders(http.Header{"Authorization": []string{"bearer sk-abc"}}))
+	assert.Empty(t, detectLLMProviderFromHeaders(http.Header{"Authorization": []string{"Bearer eyJhbGciOi"}}))
+	assert.Empty(t, detectLLMProviderFromHeaders(http.Header{"X-Api-Key": []string{"key"}}))
+}
+
+func TestExtractLLMToolResultsOpenAI(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host: "api.openai.com",
+		Path: "/v1/chat/completions",
+		RequestBody: []byte(`{
+			"model":"gpt-4o-mini",
+			"messages":[
+				{"role":"user","content":"Weather in Paris?"},
+				{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+				{"role":"tool","tool_call_id":"call_1","content":"{\"temp\":21}"}
+			]
+		}`),
+	}
+
+	info := ExtractLLM(entry, true, false)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Request)
+	assert.Contains(t, info.Request.Prompt, "Weather in Paris?")
+	assert.NotContains(t, info.Request.Prompt, "temp")
+	assert.NotEmpty(t, info.Request.ToolCalls)
+	assert.Equal(t, []LLMToolResult{{ToolCallID: "call_1", Content: `{"temp":21}`}}, info.Request.ToolResults)
+}
+
+func TestExtractLLMToolResultsOpenAIResponses(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host: "api.openai.com",
+		Path: "/v1/responses",
+		RequestBody: []byte(`{
+			"model":"gpt-4.1",
+			"input":[
+				{"role":"user","content":"Weather in Paris?"},
+				{"type":"function_call","call_id":"call_2","name":"get_weather","arguments":"{}"},
+				{"type":"function_call_output","call_id":"call_2","output":"sunny"}
+			]
+		}`),
+	}
+
+	info := ExtractLLM(entry, true, false)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Request)
+	assert.Equal(t, "**user**:\nWeather in Paris?", info.Request.Prompt)
+	assert.Equal(t, []LLMToolResult{{ToolCallID: "call_2", Content: "sunny"}}, info.Request.ToolResults)
+}
+
+func TestExtractLLMToolResultsClaude(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host: "api.anthropic.com",
+		Path: "/v1/messages",
+		RequestBody: []byte(`{
+			"model":"claude-3-5-sonnet-20240620",
+			"messages":[
+				{"role":"user","content":"Look up the docs."},
+				{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"lookup","input":{"q":"docs"}}]},
+				{"role":"user","content":[
+					{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"Docs body"}]},
+					{"type":"tool_result","tool_use_id":"toolu_2","content":"not found","is_error":true},
+					{"type":"text","text":"Now summarize."}
+				]}
+			]
+		}`),
+	}
+
+	info := ExtractLLM(entry, true, false)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Request)
+	assert.Contains(t, info.Request.Prompt, "Now summarize.")
+	assert.NotContains(t, info.Request.Prompt, "Docs body")
+	assert.NotContains(t, info.Request.Prompt, "not found")
+	require.Len(t, info.Request.ToolResults, 2)
+	assert.Equal(t, "toolu_1", info.Request.ToolResults[0].ToolCallID)
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "text", "text": "Docs body"}}, info.Request.ToolResults[0].Content)
+	assert.False(t, info.Request.ToolResults[0].IsError)
+	assert.Equal(t, LLMToolResult{ToolCallID: "toolu_2", Content: "not found", IsError: true}, info.Request.ToolResults[1])
+}
+
+func TestExtractLLMToolResultsGemini(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Host: "generativelanguage.googleapis.com",
+		Path: "/v1beta/models/gemini-1.5-pro:generateContent",
+		RequestBody: []byte(`{
+			"contents":[
+				{"role":"user","parts":[{"text":"Weather in Paris?"}]},
+				{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},
+				{"role":"user","parts":[{"functionResponse":{"name":"get_weather","response":{"temp":21}}}]}
+			]
+		}`),
+	}
+
+	info := ExtractLLM(entry, true, false)
+	require.NotNil(t, info)
+	assert.Equal(t, "gemini", info.Provider)
+	require.NotNil(t, info.Request)
+	assert.Equal(t, "**user**:\nWeather in Paris?", info.Request.Prompt)
+	assert.NotEmpty(t, info.Request.ToolCalls)
+	assert.Equal(t, []LLMToolResult{{Name: "get_weather", Content: map[string]interface{}{"temp": float64(21)}}}, info.Request.ToolResults)
+}
+
+func TestExtractLLMSkipsNonJSONEntries(t *testing.T) {
+	// 请求体看起来像LLM请求，但条目既不是JSON/SSE，也不属于已知的LLM主机
+	entry := &handlers.TrafficEntry{
+		Host:        "files.example.com",
+		Path:        "/upload",
+		ContentType: "image/png",
+		RequestHeaders: http.Header{
+			"Content-Type": []string{"application/octet-stream"},
+		},
+		RequestBody: []byte(`{"model":"llama3","messages":[{"role":"user","content":"Hello"}]}`),
+	}
+	assert.Nil(t, ExtractLLM(entry, true, true))
+
+	// 声明为LLM主机后，自建端点的条目会被提取
+	hosts, err := proxy.ParseLLMHosts("*.example.com=ollama")
+	require.NoError(t, err)
+	info := ExtractLLMWithHosts(entry, hosts, true, false)
+	require.NotNil(t, info)
+	assert.Equal(t, "ollama", info.Provider)
+	assert.Equal(t, "llama3", info.Model)
+}
+
+// BenchmarkExtractLLMNonJSON 衡量非JSON条目的开销：预检查直接返回，不解析消息体
+func BenchmarkExtractLLMNonJSON(b *testing.B) {
+	entry := &handlers.TrafficEntry{
+		Host:         "cdn.example.com",
+		Path:         "/video.mp4",
+		ContentType:  "video/mp4",
+		ResponseBody: bytes.Repeat([]byte{0x00, 0x01, 0x7b}, 1<<20),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if ExtractLLM(entry, true, true) != nil {
+			b.Fatal("unexpected extraction")
+		}
+	}
+}
+
+// BenchmarkExtractLLMJSON 是完整提取的开销，作为BenchmarkExtractLLMNonJSON的对照
+func BenchmarkExtractLLMJSON(b *testing.B) {
+	entry := &handlers.TrafficEntry{
+		Host:           "api.openai.com",
+		Path:           "/v1/chat/completions",
+		ContentType:    "application/json",
+		RequestHeaders: http.Header{"Content-Type": []string{"application/json"}},
+		RequestBody:    []byte(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"Hello"}]}`),
+		ResponseBody:   []byte(`{"model":"gpt-4o-mini","choices":[{"message":{"content":"Hi there!"}}]}`),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if ExtractLLM(entry, true, true) == nil {
+			b.Fatal("expected extraction")
+		}
+	}
+}
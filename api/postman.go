@@ -0,0 +1,226 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// PostmanSchemaV21 是Postman Collection v2.1的schema地址
+const PostmanSchemaV21 = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// PostmanCollection 是Postman Collection v2.1格式的集合，只包含导出请求需要的字段
+type PostmanCollection struct {
+	Info PostmanInfo   `json:"info"`
+	Item []PostmanItem `json:"item"`
+}
+
+type PostmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+// PostmanItem 是一个请求（Request非空）或一个文件夹（Item非空）
+type PostmanItem struct {
+	Name    string          `json:"name"`
+	Item    []PostmanItem   `json:"item,omitempty"`
+	Request *PostmanRequest `json:"request,omitempty"`
+}
+
+type PostmanRequest struct {
+	Method string          `json:"method"`
+	Header []PostmanKeyVal `json:"header"`
+	URL    PostmanURL      `json:"url"`
+	Body   *PostmanBody    `json:"body,omitempty"`
+}
+
+type PostmanKeyVal struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+type PostmanURL struct {
+	Raw      string          `json:"raw"`
+	Protocol string          `json:"protocol,omitempty"`
+	Host     []string        `json:"host,omitempty"`
+	Port     string          `json:"port,omitempty"`
+	Path     []string        `json:"path,omitempty"`
+	Query    []PostmanKeyVal `json:"query,omitempty"`
+}
+
+// PostmanBody 在raw模式下填充Raw和Options，urlencoded模式下填充URLEncoded
+type PostmanBody struct {
+	Mode       string              `json:"mode"`
+	Raw        string              `json:"raw,omitempty"`
+	URLEncoded []PostmanKeyVal     `json:"urlencoded,omitempty"`
+	Options    *PostmanBodyOptions `json:"options,omitempty"`
+}
+
+type PostmanBodyOptions struct {
+	Raw PostmanRawOptions `json:"raw"`
+}
+
+type PostmanRawOptions struct {
+	Language string `json:"language"`
+}
+
+// postmanSkippedHeaders 由Postman自动生成或与导出的请求体不再相符的请求头
+var postmanSkippedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true, // 保存的请求体已经解压
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Proxy-Connection":  true,
+}
+
+// exportPostman 将ids指定的条目导出为Postman Collection，按主机分文件夹
+func (s *Server) exportPostman(c *gin.Context) {
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one entry ID is required in ids",
+		})
+		return
+	}
+
+	entries := make([]*handlers.TrafficEntry, 0, len(ids))
+	for _, id := range ids {
+		entry := s.WebHandler.GetEntry(id)
+		if entry == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Entry %s not found", id),
+			})
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="proxycraft.postman_collection.json"`)
+	c.JSON(http.StatusOK, BuildPostmanCollection("ProxyCraft", entries))
+}
+
+// BuildPostmanCollection 把条目转换为Postman集合，每个主机一个文件夹，文件夹和请求保持条目的顺序
+func BuildPostmanCollection(name string, entries []*handlers.TrafficEntry) *PostmanCollection {
+	collection := &PostmanCollection{
+		Info: PostmanInfo{Name: name, Schema: PostmanSchemaV21},
+		Item: []PostmanItem{},
+	}
+	folders := make(map[string]int)
+	for _, entry := range entries {
+		item := postmanItem(entry)
+		index, ok := folders[entry.Host]
+		if !ok {
+			index = len(collection.Item)
+			folders[entry.Host] = index
+			collection.Item = append(collection.Item, PostmanItem{Name: entry.Host})
+		}
+		collection.Item[index].Item = append(collection.Item[index].Item, item)
+	}
+	return collection
+}
+
+func postmanItem(entry *handlers.TrafficEntry) PostmanItem {
+	request := &PostmanRequest{
+		Method: entry.Method,
+		Header: postmanHeaders(entry.RequestHeaders),
+		URL:    postmanURL(entry.URL),
+		Body:   postmanBody(entry.RequestBody, entry.RequestHeaders.Get("Content-Type")),
+	}
+	name := entry.Method + " " + entry.Path
+	if entry.Path == "" {
+		name = entry.Method + " " + entry.URL
+	}
+	return PostmanItem{Name: name, Request: request}
+}
+
+func postmanHeaders(header http.Header) []PostmanKeyVal {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if !postmanSkippedHeaders[http.CanonicalHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]PostmanKeyVal, 0, len(names))
+	for _, name := range names {
+		for _, value := range header[name] {
+			result = append(result, PostmanKeyVal{Key: name, Value: value})
+		}
+	}
+	return result
+}
+
+func postmanURL(raw string) PostmanURL {
+	result := PostmanURL{Raw: raw}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return result
+	}
+	result.Protocol = u.Scheme
+	result.Host = strings.Split(u.Hostname(), ".")
+	result.Port = u.Port()
+	if path := strings.Trim(u.EscapedPath(), "/"); path != "" {
+		result.Path = strings.Split(path, "/")
+	}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		result.Query = append(result.Query, PostmanKeyVal{Key: key, Value: value})
+	}
+	return result
+}
+
+// postmanBody JSON使用raw模式并标注json语言，表单使用urlencoded模式，二进制内容不导出
+func postmanBody(body []byte, contentType string) *PostmanBody {
+	if len(body) == 0 || isBinaryContent(body, contentType) {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			break
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]PostmanKeyVal, 0, len(values))
+		for _, key := range keys {
+			for _, value := range values[key] {
+				fields = append(fields, PostmanKeyVal{Key: key, Value: value, Type: "text"})
+			}
+		}
+		return &PostmanBody{Mode: "urlencoded", URLEncoded: fields}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return &PostmanBody{
+			Mode:    "raw",
+			Raw:     string(body),
+			Options: &PostmanBodyOptions{Raw: PostmanRawOptions{Language: "json"}},
+		}
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return &PostmanBody{
+			Mode:    "raw",
+			Raw:     string(body),
+			Options: &PostmanBodyOptions{Raw: PostmanRawOptions{Language: "xml"}},
+		}
+	}
+	return &PostmanBody{Mode: "raw", Raw: string(body)}
+}
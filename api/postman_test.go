@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordRequestEntry 通过WebHandler记录一条带请求体的请求，返回条目ID
+func recordRequestEntry(t *testing.T, handler *handlers.WebHandler, method, rawURL, contentType, body string) string {
+	req, err := http.NewRequest(method, rawURL, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		IsHTTPS:   req.URL.Scheme == "https",
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+	handler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(`{}`)),
+		},
+	})
+	return reqCtx.UserData["traffic_id"].(string)
+}
+
+func TestExportPostman(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	jsonID := recordRequestEntry(t, webHandler, http.MethodPost, "https://api.example.com:8443/v1/users?page=2",
+		"application/json", `{"name":"alice"}`)
+	formID := recordRequestEntry(t, webHandler, http.MethodPost, "https://api.example.com:8443/login",
+		"application/x-www-form-urlencoded", "user=alice&remember=1")
+	getID := recordRequestEntry(t, webHandler, http.MethodGet, "http://other.example.org/status", "", "")
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+		"/api/traffic/export.postman?ids="+jsonID+","+formID+","+getID, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "postman_collection.json")
+
+	var collection PostmanCollection
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &collection))
+	assert.Equal(t, PostmanSchemaV21, collection.Info.Schema)
+
+	// 按主机分文件夹，共3个请求
+	require.Len(t, collection.Item, 2)
+	assert.Equal(t, "api.example.com:8443", collection.Item[0].Name)
+	assert.Equal(t, "other.example.org", collection.Item[1].Name)
+	require.Len(t, collection.Item[0].Item, 2)
+	require.Len(t, collection.Item[1].Item, 1)
+
+	jsonReq := collection.Item[0].Item[0].Request
+	require.NotNil(t, jsonReq)
+	assert.Equal(t, http.MethodPost, jsonReq.Method)
+	assert.Equal(t, "https://api.example.com:8443/v1/users?page=2", jsonReq.URL.Raw)
+	assert.Equal(t, "8443", jsonReq.URL.Port)
+	assert.Equal(t, []string{"api", "example", "com"}, jsonReq.URL.Host)
+	assert.Equal(t, []string{"v1", "users"}, jsonReq.URL.Path)
+	assert.Equal(t, []PostmanKeyVal{{Key: "page", Value: "2"}}, jsonReq.URL.Query)
+	assert.Contains(t, jsonReq.Header, PostmanKeyVal{Key: "Authorization", Value: "Bearer token"})
+	require.NotNil(t, jsonReq.Body)
+	assert.Equal(t, "raw", jsonReq.Body.Mode)
+	assert.JSONEq(t, `{"name":"alice"}`, jsonReq.Body.Raw)
+	require.NotNil(t, jsonReq.Body.Options)
+	assert.Equal(t, "json", jsonReq.Body.Options.Raw.Language)
+
+	formReq := collection.Item[0].Item[1].Request
+	require.NotNil(t, formReq.Body)
+	assert.Equal(t, "urlencoded", formReq.Body.Mode)
+	assert.Equal(t, []PostmanKeyVal{
+		{Key: "remember", Value: "1", Type: "text"},
+		{Key: "user", Value: "alice", Type: "text"},
+	}, formReq.Body.URLEncoded)
+
+	getReq := collection.Item[1].Item[0].Request
+	assert.Equal(t, http.MethodGet, getReq.Method)
+	assert.Nil(t, getReq.Body)
+}
+
+func TestExportPostmanErrors(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/export.postman", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/export.postman?ids=missing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrettyJSONMiddleware 在请求带有 ?pretty=1 时把JSON响应缩进后返回，便于用curl等工具调试
+// 默认返回紧凑的JSON；非JSON响应（原始HTTP文本、SSE推送等）原样透传
+func PrettyJSONMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pretty, _ := strconv.ParseBool(c.Query("pretty")); !pretty {
+			c.Next()
+			return
+		}
+
+		writer := &prettyJSONWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// prettyJSONWriter 缓存JSON响应体，处理结束后一次性写出缩进后的内容
+type prettyJSONWriter struct {
+	gin.ResponseWriter
+	buf       bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+func (w *prettyJSONWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.buffering = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+	if w.buffering {
+		return w.buf.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *prettyJSONWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 缓存JSON时推迟到finish统一写出
+func (w *prettyJSONWriter) Flush() {
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *prettyJSONWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, w.buf.Bytes(), "", "  "); err != nil {
+		// 不是合法的JSON时按原样返回
+		out = w.buf
+	} else {
+		out.WriteByte('\n')
+	}
+	_, _ = w.ResponseWriter.Write(out.Bytes())
+}
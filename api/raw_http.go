@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// rawHTTPSkippedHeaders 与还原后的消息体不再相符的头，由buildRawHTTPBody重新计算
+var rawHTTPSkippedHeaders = map[string]bool{
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+}
+
+// rawHTTPProto 返回条目使用的协议版本，未记录时使用HTTP/1.1
+func rawHTTPProto(entry *handlers.TrafficEntry) string {
+	if strings.HasPrefix(entry.Protocol, "HTTP/") {
+		return entry.Protocol
+	}
+	return "HTTP/1.1"
+}
+
+// buildRawHTTPBody 还原消息体：按Content-Encoding解压，二进制内容替换为说明文字
+// 返回的头部去掉了Content-Encoding和Transfer-Encoding，Content-Length为解压后的大小
+func buildRawHTTPBody(header http.Header, body []byte, contentType string) (http.Header, []byte) {
+	out := make(http.Header, len(header))
+	for name, values := range header {
+		if !rawHTTPSkippedHeaders[http.CanonicalHeaderKey(name)] {
+			out[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+
+	// 保存的请求体已经解压，而-no-decompress时响应体仍是压缩的；解压失败说明内容已是原文
+	if encoding := header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		if decoded, err := proxy.DecompressData(body, encoding); err == nil {
+			body = decoded
+		}
+	}
+
+	if len(body) == 0 {
+		return out, body
+	}
+	out.Set("Content-Length", strconv.Itoa(len(body)))
+	if isBinaryContent(body, contentType) {
+		return out, []byte(fmt.Sprintf("<Binary data, %d bytes>", len(body)))
+	}
+	return out, body
+}
+
+// writeRawHTTPMessage 按“起始行、规范化的头部、空行、消息体”的格式写出完整的HTTP报文
+// leading中的行写在排序后的头部之前，用于起始行和Host
+func writeRawHTTPMessage(leading []string, header http.Header, body []byte) []byte {
+	var buf bytes.Buffer
+	for _, line := range leading {
+		buf.WriteString(line + "\r\n")
+	}
+	_ = header.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// buildRawHTTPRequest 从保存的条目还原原始HTTP请求
+func buildRawHTTPRequest(entry *handlers.TrafficEntry) []byte {
+	requestURI := entry.Path
+	if parsed, err := url.Parse(entry.URL); err == nil && parsed.Path != "" {
+		requestURI = parsed.RequestURI()
+	}
+	if requestURI == "" {
+		requestURI = "/"
+	}
+
+	header, body := buildRawHTTPBody(entry.RequestHeaders, entry.RequestBody, entry.RequestHeaders.Get("Content-Type"))
+	leading := []string{fmt.Sprintf("%s %s %s", entry.Method, requestURI, rawHTTPProto(entry))}
+	// 保存的请求头中没有Host，紧跟在请求行之后补上
+	if header.Get("Host") == "" && entry.Host != "" {
+		leading = append(leading, "Host: "+entry.Host)
+	}
+	return writeRawHTTPMessage(leading, header, body)
+}
+
+// buildRawHTTPResponse 从保存的条目还原原始HTTP响应
+func buildRawHTTPResponse(entry *handlers.TrafficEntry) []byte {
+	header, body := buildRawHTTPBody(entry.ResponseHeaders, entry.ResponseBody, entry.EffectiveContentType())
+	statusLine := strings.TrimSpace(fmt.Sprintf("%s %d %s", rawHTTPProto(entry), entry.StatusCode, http.StatusText(entry.StatusCode)))
+	return writeRawHTTPMessage([]string{statusLine}, header, body)
+}
+
+// getRawHTTPRequest 以纯文本返回还原的原始HTTP请求
+func (s *Server) getRawHTTPRequest(c *gin.Context) {
+	s.serveRawHTTP(c, "request", buildRawHTTPRequest)
+}
+
+// getRawHTTPResponse 以纯文本返回还原的原始HTTP响应
+func (s *Server) getRawHTTPResponse(c *gin.Context) {
+	s.serveRawHTTP(c, "response", buildRawHTTPResponse)
+}
+
+func (s *Server) serveRawHTTP(c *gin.Context, kind string, build func(*handlers.TrafficEntry) []byte) {
+	id := c.Param("id")
+	entry := s.WebHandler.GetEntry(id)
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Entry not found",
+		})
+		return
+	}
+	if kind == "response" && entry.StatusCode == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Entry has no response",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s-%s.http"`, kind, id))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", build(entry))
+}
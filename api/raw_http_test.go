@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRawHTTPRequestAndResponse(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte(`{"name":"alice"}`))
+	require.NoError(t, gz.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/api/users?page=2", bytes.NewReader(compressed.Bytes()))
+	require.NoError(t, err)
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("x-trace-id", "abc")
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	webHandler.OnRequest(reqCtx)
+	webHandler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{"Content-Type": []string{"application/json"}, "Set-Cookie": []string{"a=1", "b=2"}},
+			Body:       io.NopCloser(strings.NewReader(`{"id":1}`)),
+		},
+	})
+	id := reqCtx.UserData["traffic_id"].(string)
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/request/raw-http", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+	raw := recorder.Body.String()
+	assert.True(t, strings.HasPrefix(raw, "POST /api/users?page=2 HTTP/1.1\r\nHost: example.com\r\n"), raw)
+	assert.Contains(t, raw, "Content-Type: application/json\r\n")
+	assert.Contains(t, raw, "X-Trace-Id: abc\r\n")
+	assert.NotContains(t, raw, "Content-Encoding")
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\n"+`{"name":"alice"}`), raw)
+
+	// 还原的报文可以被标准库重新解析
+	parsed, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", parsed.Host)
+	body, err := io.ReadAll(parsed.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"alice"}`, string(body))
+
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/response/raw-http", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	raw = recorder.Body.String()
+	assert.True(t, strings.HasPrefix(raw, "HTTP/1.1 201 Created\r\n"), raw)
+	assert.Contains(t, raw, "Set-Cookie: a=1\r\nSet-Cookie: b=2\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":1}`, string(body))
+
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/missing/request/raw-http", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestBuildRawHTTPResponseLabelsBinaryAndDecompresses(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte("plain text"))
+	require.NoError(t, gz.Close())
+
+	// -no-decompress时保存的是压缩后的响应体
+	raw := string(buildRawHTTPResponse(&handlers.TrafficEntry{
+		Protocol:        "HTTP/1.1",
+		StatusCode:      http.StatusOK,
+		ResponseHeaders: http.Header{"Content-Type": []string{"text/plain"}, "Content-Encoding": []string{"gzip"}},
+		ResponseBody:    compressed.Bytes(),
+	}))
+	assert.NotContains(t, raw, "Content-Encoding")
+	assert.Contains(t, raw, "Content-Length: 10\r\n")
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\nplain text"), raw)
+
+	raw = string(buildRawHTTPResponse(&handlers.TrafficEntry{
+		StatusCode:      http.StatusOK,
+		ResponseHeaders: http.Header{"Content-Type": []string{"image/png"}},
+		ResponseBody:    []byte("\x89PNG\r\n\x1a\n\x00\x00"),
+	}))
+	assert.True(t, strings.HasPrefix(raw, "HTTP/1.1 200 OK\r\n"), raw)
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\n<Binary data, 10 bytes>"), raw)
+}
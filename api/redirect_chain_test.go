@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectChain(t *testing.T) {
+	var backendURL string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			// 相对地址
+			http.Redirect(w, r, "/moved?step=2", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, backendURL+"/final", http.StatusFound)
+		default:
+			_, _ = io.WriteString(w, "done")
+		}
+	}))
+	defer backend.Close()
+	backendURL = backend.URL
+
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, "", handlers.StorageMemory)
+	require.NoError(t, err)
+	proxyServer, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = proxyServer.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	for _, path := range []string{"/unrelated", "/old"} {
+		resp, err := client.Get(backend.URL + path)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 4)
+	server := NewServer(webHandler, 0)
+	chainOf := func(id string) []handlers.TrafficEntry {
+		rec := httptest.NewRecorder()
+		server.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/chain", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Chain []handlers.TrafficEntry `json:"chain"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Chain
+	}
+
+	// 从链中任一条目出发都得到完整的链
+	for _, entry := range entries[1:] {
+		chain := chainOf(entry.ID)
+		require.Len(t, chain, 3, entry.URL)
+		assert.Equal(t, []int{http.StatusMovedPermanently, http.StatusFound, http.StatusOK},
+			[]int{chain[0].StatusCode, chain[1].StatusCode, chain[2].StatusCode})
+		assert.Equal(t, "/final", chain[2].Path)
+		assert.Empty(t, chain[0].RedirectFrom)
+		assert.Equal(t, chain[1].ID, chain[0].RedirectTo)
+		assert.Equal(t, chain[0].ID, chain[1].RedirectFrom)
+		assert.Equal(t, chain[2].ID, chain[1].RedirectTo)
+		assert.Equal(t, chain[1].ID, chain[2].RedirectFrom)
+		assert.Empty(t, chain[2].RedirectTo)
+	}
+
+	// /unrelated 与 /final 都返回200，但不在链中
+	chain := chainOf(entries[0].ID)
+	require.Len(t, chain, 1)
+	assert.Empty(t, chain[0].RedirectFrom)
+	assert.Empty(t, chain[0].RedirectTo)
+
+	rec := httptest.NewRecorder()
+	server.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/traffic/999/chain", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
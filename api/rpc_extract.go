@@ -0,0 +1,304 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+)
+
+const (
+	RPCProtocolGraphQL = "graphql"
+	RPCProtocolJSONRPC = "jsonrpc"
+)
+
+type RPCExtracted struct {
+	Protocol   string         `json:"protocol"`
+	Batch      bool           `json:"batch,omitempty"`
+	Summary    string         `json:"summary"`
+	Operations []RPCOperation `json:"operations"`
+}
+
+// RPCOperation is a single GraphQL operation or JSON-RPC call.
+// For GraphQL, Type is query/mutation/subscription; for JSON-RPC it is request or notification.
+type RPCOperation struct {
+	Name string      `json:"name,omitempty"`
+	Type string      `json:"type,omitempty"`
+	ID   interface{} `json:"id,omitempty"`
+}
+
+// ExtractRPC detects GraphQL and JSON-RPC requests (including batches) and extracts
+// the operation names. Returns nil when the entry is neither.
+func ExtractRPC(entry *handlers.TrafficEntry) *RPCExtracted {
+	if entry == nil {
+		return nil
+	}
+
+	var payload interface{}
+	if body := bytes.TrimSpace(entry.RequestBody); len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			payload = nil
+		}
+	}
+
+	if result := extractJSONRPC(payload); result != nil {
+		return result
+	}
+	if result := extractGraphQL(entry, payload); result != nil {
+		return result
+	}
+	return nil
+}
+
+func extractJSONRPC(payload interface{}) *RPCExtracted {
+	items, batch := payloadItems(payload)
+	if len(items) == 0 {
+		return nil
+	}
+
+	result := &RPCExtracted{Protocol: RPCProtocolJSONRPC, Batch: batch}
+	for _, item := range items {
+		if asStringField(item, "jsonrpc") == "" {
+			return nil
+		}
+		method := asStringField(item, "method")
+		if method == "" {
+			return nil
+		}
+		op := RPCOperation{Name: method, Type: "notification"}
+		if id, ok := item["id"]; ok {
+			op.Type = "request"
+			op.ID = id
+		}
+		result.Operations = append(result.Operations, op)
+	}
+	result.Summary = summarizeRPC("JSON-RPC", result)
+	return result
+}
+
+func extractGraphQL(entry *handlers.TrafficEntry, payload interface{}) *RPCExtracted {
+	items, batch := payloadItems(payload)
+
+	// GET requests carry the operation in the query string
+	if len(items) == 0 && strings.EqualFold(entry.Method, "GET") {
+		if u, err := url.Parse(entry.URL); err == nil {
+			query := u.Query()
+			if query.Get("query") != "" || (query.Get("operationName") != "" && looksLikeGraphQLPath(entry.Path)) {
+				items = []map[string]interface{}{{
+					"query":         query.Get("query"),
+					"operationName": query.Get("operationName"),
+				}}
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	result := &RPCExtracted{Protocol: RPCProtocolGraphQL, Batch: batch}
+	for _, item := range items {
+		document := asStringField(item, "query")
+		operationName := asStringField(item, "operationName")
+		switch {
+		case document != "" && looksLikeGraphQLDocument(document):
+		case document == "" && operationName != "" && looksLikeGraphQLPath(entry.Path):
+			// Persisted queries only send the operation name and a hash
+		default:
+			return nil
+		}
+
+		op := RPCOperation{Name: operationName}
+		if document != "" {
+			opType, name := parseGraphQLOperation(document, operationName)
+			op.Type = opType
+			if op.Name == "" {
+				op.Name = name
+			}
+		}
+		result.Operations = append(result.Operations, op)
+	}
+	result.Summary = summarizeRPC("GraphQL", result)
+	return result
+}
+
+// payloadItems returns the JSON objects of a single or batched (array) payload.
+func payloadItems(payload interface{}) ([]map[string]interface{}, bool) {
+	switch value := payload.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, false
+	case []interface{}:
+		items := make([]map[string]interface{}, 0, len(value))
+		for _, element := range value {
+			item, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			items = append(items, item)
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func looksLikeGraphQLPath(path string) bool {
+	return strings.Contains(strings.ToLower(path), "graphql")
+}
+
+func looksLikeGraphQLDocument(document string) bool {
+	trimmed := strings.TrimSpace(document)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "#") {
+		return true
+	}
+	for _, keyword := range []string{"query", "mutation", "subscription", "fragment"} {
+		rest, ok := strings.CutPrefix(trimmed, keyword)
+		if !ok || rest == "" {
+			continue
+		}
+		// the keyword must end at whitespace, a selection set or variable definitions, so "queryString" is not a document
+		switch rest[0] {
+		case ' ', '\t', '\n', '\r', ',', '{', '(':
+			return true
+		}
+	}
+	return false
+}
+
+// parseGraphQLOperation returns the type and name of the operation to execute. When the
+// document holds several operations, operationName selects among them.
+func parseGraphQLOperation(document string, operationName string) (string, string) {
+	type definition struct {
+		opType string
+		name   string
+	}
+	var definitions []definition
+
+	// inHeader is set between a definition keyword and the selection set it opens
+	inHeader := false
+	tokens := graphQLTopLevelTokens(document)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "{":
+			if !inHeader {
+				// Shorthand anonymous query
+				definitions = append(definitions, definition{opType: "query"})
+			}
+			inHeader = false
+		case "fragment":
+			inHeader = true
+		case "query", "mutation", "subscription":
+			if inHeader {
+				continue
+			}
+			def := definition{opType: tokens[i]}
+			if i+1 < len(tokens) && isGraphQLName(tokens[i+1]) {
+				def.name = tokens[i+1]
+				i++
+			}
+			definitions = append(definitions, def)
+			inHeader = true
+		}
+	}
+
+	if len(definitions) == 0 {
+		return "", ""
+	}
+	for _, def := range definitions {
+		if operationName != "" && def.name == operationName {
+			return def.opType, def.name
+		}
+	}
+	return definitions[0].opType, definitions[0].name
+}
+
+// graphQLTopLevelTokens tokenizes the document, keeping only names and opening braces at
+// selection depth 0 and skipping strings, comments, variable definitions and nested selections.
+func graphQLTopLevelTokens(document string) []string {
+	var tokens []string
+	depth, parens := 0, 0
+	for i := 0; i < len(document); {
+		c := document[i]
+		switch {
+		case c == '#':
+			for i < len(document) && document[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(document[i:], `"""`):
+			end := strings.Index(document[i+3:], `"""`)
+			if end < 0 {
+				return tokens
+			}
+			i += end + 6
+		case c == '"':
+			i++
+			for i < len(document) && document[i] != '"' {
+				if document[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case c == '(':
+			parens++
+			i++
+		case c == ')':
+			parens--
+			i++
+		case c == '{':
+			if depth == 0 && parens == 0 {
+				tokens = append(tokens, "{")
+			}
+			depth++
+			i++
+		case c == '}':
+			depth--
+			i++
+		case isGraphQLNameStart(c):
+			start := i
+			for i < len(document) && (isGraphQLNameStart(document[i]) || (document[i] >= '0' && document[i] <= '9')) {
+				i++
+			}
+			if depth == 0 && parens == 0 {
+				tokens = append(tokens, document[start:i])
+			}
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLName(token string) bool {
+	return token != "" && isGraphQLNameStart(token[0])
+}
+
+// summarizeRPC builds a label such as "GraphQL query: GetUser" or "JSON-RPC batch (2): eth_call, eth_blockNumber".
+func summarizeRPC(label string, result *RPCExtracted) string {
+	if !result.Batch && len(result.Operations) == 1 {
+		op := result.Operations[0]
+		prefix := label
+		if result.Protocol == RPCProtocolGraphQL && op.Type != "" {
+			prefix += " " + op.Type
+		}
+		if op.Name == "" {
+			return prefix
+		}
+		return prefix + ": " + op.Name
+	}
+
+	names := make([]string, 0, len(result.Operations))
+	for _, op := range result.Operations {
+		name := op.Name
+		if name == "" {
+			name = "(anonymous)"
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("%s batch (%d): %s", label, len(result.Operations), strings.Join(names, ", "))
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractRPCGraphQLQuery(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Method: "POST",
+		Path:   "/graphql",
+		RequestBody: []byte(`{
+			"query":"# fetch a user\nfragment UserFields on User { id name }\nquery GetUser($id: ID!, $query: String) { user(id: $id) { ...UserFields } }\nmutation Rename { rename { id } }",
+			"variables":{"id":"1"}
+		}`),
+	}
+
+	info := ExtractRPC(entry)
+	require.NotNil(t, info)
+	assert.Equal(t, RPCProtocolGraphQL, info.Protocol)
+	assert.False(t, info.Batch)
+	require.Len(t, info.Operations, 1)
+	assert.Equal(t, "query", info.Operations[0].Type)
+	assert.Equal(t, "GetUser", info.Operations[0].Name)
+	assert.Equal(t, "GraphQL query: GetUser", info.Summary)
+
+	// operationName selects among several operations
+	entry.RequestBody = []byte(`{"query":"query GetUser { user { id } } mutation Rename { rename { id } }","operationName":"Rename"}`)
+	info = ExtractRPC(entry)
+	require.NotNil(t, info)
+	assert.Equal(t, "GraphQL mutation: Rename", info.Summary)
+}
+
+func TestExtractRPCGraphQLBatchAndGET(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Method:      "POST",
+		Path:        "/api",
+		RequestBody: []byte(`[{"query":"{ viewer { id } }"},{"query":"subscription OnMessage { message }"}]`),
+	}
+	info := ExtractRPC(entry)
+	require.NotNil(t, info)
+	assert.True(t, info.Batch)
+	require.Len(t, info.Operations, 2)
+	assert.Equal(t, RPCOperation{Type: "query"}, info.Operations[0])
+	assert.Equal(t, RPCOperation{Type: "subscription", Name: "OnMessage"}, info.Operations[1])
+	assert.Equal(t, "GraphQL batch (2): (anonymous), OnMessage", info.Summary)
+
+	entry = &handlers.TrafficEntry{
+		Method: "GET",
+		Path:   "/graphql",
+		URL:    "https://example.com/graphql?query=query%20Me%20%7B%20me%20%7B%20id%20%7D%20%7D",
+	}
+	info = ExtractRPC(entry)
+	require.NotNil(t, info)
+	assert.Equal(t, "GraphQL query: Me", info.Summary)
+}
+
+func TestExtractRPCJSONRPC(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Method:      "POST",
+		Path:        "/",
+		RequestBody: []byte(`{"jsonrpc":"2.0","method":"eth_getBalance","params":["0xabc","latest"],"id":7}`),
+	}
+	info := ExtractRPC(entry)
+	require.NotNil(t, info)
+	assert.Equal(t, RPCProtocolJSONRPC, info.Protocol)
+	require.Len(t, info.Operations, 1)
+	assert.Equal(t, "eth_getBalance", info.Operations[0].Name)
+	assert.Equal(t, "request", info.Operations[0].Type)
+	assert.Equal(t, float64(7), info.Operations[0].ID)
+	assert.Equal(t, "JSON-RPC: eth_getBalance", info.Summary)
+
+	entry.RequestBody = []byte(`[{"jsonrpc":"2.0","method":"eth_blockNumber","id":1},{"jsonrpc":"2.0","method":"notify_ready"}]`)
+	info = ExtractRPC(entry)
+	require.NotNil(t, info)
+	assert.True(t, info.Batch)
+	require.Len(t, info.Operations, 2)
+	assert.Equal(t, "notification", info.Operations[1].Type)
+	assert.Equal(t, "JSON-RPC batch (2): eth_blockNumber, notify_ready", info.Summary)
+}
+
+func TestExtractRPCIgnoresPlainJSON(t *testing.T) {
+	entry := &handlers.TrafficEntry{
+		Method:      "POST",
+		Path:        "/v1/chat/completions",
+		RequestBody: []byte(`{"model":"gpt-4o","query":"what is the weather"}`),
+	}
+	assert.Nil(t, ExtractRPC(entry))
+}
+
+func TestLooksLikeGraphQLDocumentRequiresKeywordBoundary(t *testing.T) {
+	for _, document := range []string{"query GetUser { id }", "query{ id }", "mutation($id: ID!) { x }", "  fragment F on User { id }"} {
+		assert.True(t, looksLikeGraphQLDocument(document), document)
+	}
+	for _, document := range []string{"queryString", "mutationTest", "subscriptions are open", "fragmented", "query"} {
+		assert.False(t, looksLikeGraphQLDocument(document), document)
+	}
+}
@@ -2,16 +2,22 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"embed"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
 	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
 	"github.com/gin-gonic/gin"
 )
@@ -24,10 +30,30 @@ type Server struct {
 	WebHandler      *handlers.WebHandler // Web处理器引用
 	Router          *gin.Engine          // Gin路由
 	UIPort          int                  // UI服务端口
+	UIHost          string               // UI服务监听的主机，为空时只监听127.0.0.1
+	UITLSCert       string               // UI服务的TLS证书文件，与UITLSKey同时设置时使用HTTPS
+	UITLSKey        string               // UI服务的TLS私钥文件
 	UIAddr          string               // UI服务地址
+	BasePath        string               // 界面和API的路径前缀，例如 "/proxycraft"，为空时挂在根路径下
 	StaticDir       string               // 静态文件目录
-	Dist            embed.FS             // 嵌入的静态文件
+	Dist            fs.FS                // 嵌入的静态文件
 	WebSocketServer *WebSocketServer     // WebSocket服务器
+	HostStats       HostStatsProvider    // 按主机统计的数据来源，为nil时/api/hosts返回空列表
+	Health          HealthProvider       // 代理的健康状态来源，为nil时/healthz只返回API服务自身的状态
+	Version         string               // /healthz中返回的版本号
+	CertManager     *certs.Manager       // 签发站点证书的CA，为nil时/api/ca返回404
+	AdminToken      string               // 管理接口（如 POST /api/ca/rotate）要求的Bearer令牌，为空时禁用这些接口
+	startedAt       time.Time            // API服务的创建时间
+}
+
+// HostStatsProvider 提供按主机的流量统计，由*proxy.Server实现
+type HostStatsProvider interface {
+	Stats() []proxy.HostStats
+}
+
+// HealthProvider 提供代理的健康状态，由*proxy.Server实现
+type HealthProvider interface {
+	Health() proxy.Health
 }
 
 // CORSMiddleware 实现CORS中间件
@@ -47,8 +73,14 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-// NewServer 创建一个新的API服务器
+// NewServer 创建一个新的API服务器，路由挂在根路径下
 func NewServer(webHandler *handlers.WebHandler, port int) *Server {
+	return NewServerWithBasePath(webHandler, port, "")
+}
+
+// NewServerWithBasePath 创建路由挂在basePath之下的API服务器，用于通过反向代理以子路径（如 /proxycraft/）访问界面
+// basePath 需要先经过NormalizeBasePath处理
+func NewServerWithBasePath(webHandler *handlers.WebHandler, port int, basePath string) *Server {
 	// 设置Gin为发布模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -57,10 +89,12 @@ func NewServer(webHandler *handlers.WebHandler, port int) *Server {
 		WebHandler: webHandler,
 		Router:     gin.Default(),
 		UIPort:     port,
-		UIAddr:     fmt.Sprintf("http://localhost:%d", port),
+		BasePath:   basePath,
 		// StaticDir:  "./api/dist", // 默认静态文件目录
-		Dist: dist,
+		Dist:      dist,
+		startedAt: time.Now(),
 	}
+	server.UIAddr = server.URL()
 
 	// 确保静态文件目录存在
 	if server.StaticDir != "" {
@@ -88,14 +122,22 @@ func NewServer(webHandler *handlers.WebHandler, port int) *Server {
 	return server
 }
 
-// setupRoutes 设置API路由
+// setupRoutes 设置API路由，所有路由都挂在BasePath之下
 func (s *Server) setupRoutes() {
+	root := s.Router.Group(s.BasePath)
+
 	// API路由组
-	api := s.Router.Group("/api")
+	api := root.Group("/api", PrettyJSONMiddleware())
 	{
 		// 获取所有流量条目
 		api.GET("/traffic", s.getTrafficEntries)
 
+		// 将选中的条目导出为Postman Collection v2.1
+		api.GET("/traffic/export.postman", s.exportPostman)
+
+		// 以JSON Lines格式流式导出流量条目，支持host、contentType过滤，bodies=1时附带消息体
+		api.GET("/traffic/export.jsonl", s.exportJSONL)
+
 		// 获取特定流量条目的详细信息
 		api.GET("/traffic/:id", s.getTrafficEntry)
 
@@ -107,12 +149,47 @@ func (s *Server) setupRoutes() {
 
 		// 获取响应头和响应体
 		api.GET("/traffic/:id/response", s.getResponseDetails)
+
+		// 以纯文本返回还原的原始HTTP请求和响应
+		api.GET("/traffic/:id/request/raw-http", s.getRawHTTPRequest)
+		api.GET("/traffic/:id/response/raw-http", s.getRawHTTPResponse)
+
+		// 将SSE响应还原为事件列表，stream=true时重新推送
+		api.GET("/traffic/:id/sse", s.getSSEEvents)
+
+		// 获取条目所在的重定向链
+		api.GET("/traffic/:id/chain", s.getRedirectChain)
+
+		// 获取GraphQL/JSON-RPC请求的操作信息
+		api.GET("/traffic/:id/rpc", s.getRPCDetails)
+
+		// 比较两个条目的状态码、响应头和响应体
+		api.GET("/diff", s.getDiff)
+
+		// 获取按主机统计的请求数、字节数和错误数
+		api.GET("/hosts", s.getHostStats)
+
+		// 获取每次运行的开始时间和关键配置
+		api.GET("/sessions", s.getSessions)
+
+		// 获取当前CA证书的主题、序列号、有效期和SHA-256指纹，format=pem时下载证书
+		api.GET("/ca", s.getCAInfo)
+
+		// 重新生成CA并返回新证书的指纹，需要AdminToken
+		api.POST("/ca/rotate", s.requireAdminToken, s.rotateCA)
+	}
+
+	// 健康检查，供容器编排的存活/就绪探针使用，不经过代理逻辑
+	// 设置了BasePath时根路径下的 /healthz 仍然可用，探针可以直接访问服务而不经过反向代理
+	s.Router.GET("/healthz", s.getHealth)
+	if s.BasePath != "" {
+		root.GET("/healthz", s.getHealth)
 	}
 
 	// WebSocket服务路由 - 添加额外的CORS处理
 	if s.WebSocketServer != nil {
 		// 为socket.io路由添加CORS预检请求处理
-		s.Router.OPTIONS("/socket.io/*any", func(c *gin.Context) {
+		root.OPTIONS("/socket.io/*any", func(c *gin.Context) {
 			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
@@ -120,8 +197,9 @@ func (s *Server) setupRoutes() {
 			c.Status(http.StatusOK)
 		})
 
-		s.Router.GET("/socket.io/*any", gin.WrapH(s.WebSocketServer.GetHandler()))
-		s.Router.POST("/socket.io/*any", gin.WrapH(s.WebSocketServer.GetHandler()))
+		socketHandler := gin.WrapH(http.StripPrefix(s.BasePath, s.WebSocketServer.GetHandler()))
+		root.GET("/socket.io/*any", socketHandler)
+		root.POST("/socket.io/*any", socketHandler)
 	}
 
 	if s.StaticDir != "" {
@@ -132,15 +210,15 @@ func (s *Server) setupRoutes() {
 		// 修改这里，使用精确路由而不是通配符路由，避免与API路由冲突
 
 		// 主页
-		s.Router.GET("/", func(c *gin.Context) {
+		root.GET("/", func(c *gin.Context) {
 			c.Header("Cache-Control", "no-cache")
-			data, _ := s.Dist.ReadFile("dist/index.html")
-			c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+			data, _ := fs.ReadFile(s.Dist, "dist/index.html")
+			c.Data(http.StatusOK, "text/html; charset=utf-8", s.rewriteIndexHTML(data))
 		})
 
 		// favicon.ico
-		s.Router.GET("/favicon.ico", func(c *gin.Context) {
-			data, err := s.Dist.ReadFile("dist/favicon.ico")
+		root.GET("/favicon.ico", func(c *gin.Context) {
+			data, err := fs.ReadFile(s.Dist, "dist/favicon.ico")
 			if err != nil {
 				c.Status(http.StatusNotFound)
 				return
@@ -149,11 +227,11 @@ func (s *Server) setupRoutes() {
 		})
 
 		// 静态资源文件
-		s.Router.GET("/assets/:filename", func(c *gin.Context) {
+		root.GET("/assets/:filename", func(c *gin.Context) {
 			filename := c.Param("filename")
 			filePath := "dist/assets/" + filename
 
-			data, err := s.Dist.ReadFile(filePath)
+			data, err := fs.ReadFile(s.Dist, filePath)
 			if err != nil {
 				c.Status(http.StatusNotFound)
 				return
@@ -178,13 +256,18 @@ func (s *Server) setupRoutes() {
 
 		// 处理前端路由和其他静态文件
 		s.Router.NoRoute(func(c *gin.Context) {
+			path, ok := s.trimBasePath(c.Request.URL.Path)
+			if !ok {
+				c.Status(http.StatusNotFound)
+				return
+			}
 			// 如果不是API请求，则返回index.html以支持前端路由
-			if !strings.HasPrefix(c.Request.URL.Path, "/api") {
+			if !strings.HasPrefix(path, "/api") {
 				// 防止循环重定向
 				c.Header("Cache-Control", "no-cache")
 				c.Status(http.StatusOK) // 确保不返回301/302等重定向状态码
-				data, _ := s.Dist.ReadFile("dist/index.html")
-				c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+				data, _ := fs.ReadFile(s.Dist, "dist/index.html")
+				c.Data(http.StatusOK, "text/html; charset=utf-8", s.rewriteIndexHTML(data))
 			} else {
 				// API路径但找不到路由，返回404
 				c.JSON(http.StatusNotFound, gin.H{"error": "API endpoint not found"})
@@ -193,8 +276,63 @@ func (s *Server) setupRoutes() {
 	}
 }
 
-// Start 启动API服务器
+// defaultUIHost 是UIHost为空时的监听地址，默认只允许本机访问
+const defaultUIHost = "127.0.0.1"
+
+// ListenAddr 返回UI服务监听的host:port
+func (s *Server) ListenAddr() string {
+	host := s.UIHost
+	if host == "" {
+		host = defaultUIHost
+	}
+	return net.JoinHostPort(host, strconv.Itoa(s.UIPort))
+}
+
+// useTLS 判断是否配置了UI服务的证书
+func (s *Server) useTLS() bool {
+	return s.UITLSCert != "" && s.UITLSKey != ""
+}
+
+// URL 返回访问UI服务的地址，监听所有接口时使用localhost
+func (s *Server) URL() string {
+	scheme := "http"
+	if s.useTLS() {
+		scheme = "https"
+	}
+	host := s.UIHost
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	url := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(s.UIPort)))
+	if s.BasePath != "" {
+		url += s.BasePath + "/"
+	}
+	return url
+}
+
+// Start 启动API服务器，监听ListenAddr，配置了证书时使用HTTPS
 func (s *Server) Start() error {
+	s.startWebSocket()
+	if s.useTLS() {
+		return s.Router.RunTLS(s.ListenAddr(), s.UITLSCert, s.UITLSKey)
+	}
+	return s.Router.Run(s.ListenAddr())
+}
+
+// Serve 在调用方提供的监听器上运行API服务器，便于嵌入和测试时使用随机端口
+func (s *Server) Serve(l net.Listener) error {
+	s.startWebSocket()
+	server := &http.Server{Handler: s.Router}
+	if s.useTLS() {
+		return server.ServeTLS(l, s.UITLSCert, s.UITLSKey)
+	}
+	return server.Serve(l)
+}
+
+// startWebSocket 启动WebSocket服务并订阅新条目通知
+func (s *Server) startWebSocket() {
+	s.UIAddr = s.URL()
+
 	// 启动WebSocket服务器
 	if s.WebSocketServer != nil {
 		s.WebSocketServer.Start()
@@ -210,13 +348,20 @@ func (s *Server) Start() error {
 
 	log.Printf("Web UI available at %s", s.UIAddr)
 	log.Printf("WebSocket服务可连接，URL: %s/socket.io", s.UIAddr)
-	return s.Router.Run(fmt.Sprintf(":%d", s.UIPort))
 }
 
-// getTrafficEntries 返回所有流量条目
+// getTrafficEntries 返回所有流量条目，支持 sort=host:asc,duration:desc 形式的多字段排序
 func (s *Server) getTrafficEntries(c *gin.Context) {
 	log.Printf("API: 开始处理获取流量条目HTTP请求...")
 
+	sortFields, err := handlers.ParseSortSpec(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// 创建一个带超时的上下文，增加超时时间到10秒
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
@@ -236,7 +381,7 @@ func (s *Server) getTrafficEntries(c *gin.Context) {
 		}()
 
 		log.Printf("API: 开始调用WebHandler.GetEntries...")
-		entries := s.WebHandler.GetEntries()
+		entries := s.WebHandler.GetEntriesSorted(sortFields)
 		elapsed := time.Since(startTime)
 		log.Printf("API: WebHandler.GetEntries调用完成，耗时: %v，获取到 %d 条流量记录", elapsed, len(entries))
 		entriesChan <- entries
@@ -280,14 +425,190 @@ func (s *Server) getTrafficEntry(c *gin.Context) {
 	c.JSON(http.StatusOK, entry)
 }
 
-// clearTrafficEntries 清空所有流量条目
+// getRedirectChain 返回条目所在的重定向链，按请求顺序排列
+func (s *Server) getRedirectChain(c *gin.Context) {
+	chain := s.WebHandler.RedirectChain(c.Param("id"))
+	if chain == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Entry not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chain": chain,
+	})
+}
+
+// getRPCDetails 返回GraphQL/JSON-RPC请求的协议和操作名称，非RPC请求时rpc为null
+func (s *Server) getRPCDetails(c *gin.Context) {
+	entry := s.WebHandler.GetEntry(c.Param("id"))
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Entry not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rpc": ExtractRPC(entry),
+	})
+}
+
+// clearTrafficEntries 清空所有流量条目；带 host、before、status 参数时只删除匹配的条目，并通过WebSocket通知客户端
 func (s *Server) clearTrafficEntries(c *gin.Context) {
-	s.WebHandler.ClearEntries()
+	filter, err := parseDeleteFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.IsEmpty() {
+		s.WebHandler.ClearEntries()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "All traffic entries cleared",
+		})
+		return
+	}
+
+	ids, err := s.WebHandler.DeleteEntries(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if s.WebSocketServer != nil && len(ids) > 0 {
+		s.WebSocketServer.BroadcastDeletedEntries(ids)
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "All traffic entries cleared",
+		"deleted": len(ids),
+		"ids":     ids,
 	})
 }
 
+// parseDeleteFilter 解析删除条目的过滤参数
+// host 为主机名；before 为RFC3339时间或Unix毫秒时间戳；status 为状态码（404）或状态类别（4xx）
+func parseDeleteFilter(c *gin.Context) (handlers.EntryFilter, error) {
+	filter := handlers.EntryFilter{Host: strings.TrimSpace(c.Query("host"))}
+
+	if before := strings.TrimSpace(c.Query("before")); before != "" {
+		if millis, err := strconv.ParseInt(before, 10, 64); err == nil {
+			filter.Before = time.UnixMilli(millis)
+		} else if t, err := time.Parse(time.RFC3339, before); err == nil {
+			filter.Before = t
+		} else {
+			return filter, fmt.Errorf("invalid before %q: want RFC3339 time or unix milliseconds", before)
+		}
+	}
+
+	if status := strings.ToLower(strings.TrimSpace(c.Query("status"))); status != "" {
+		if len(status) == 3 && status[0] >= '1' && status[0] <= '5' && status[1:] == "xx" {
+			filter.StatusMin = int(status[0]-'0') * 100
+			filter.StatusMax = filter.StatusMin + 99
+		} else if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 599 {
+			filter.StatusMin, filter.StatusMax = code, code
+		} else {
+			return filter, fmt.Errorf("invalid status %q: want a status code like 404 or a class like 4xx", status)
+		}
+	}
+	return filter, nil
+}
+
+// getHostStats 返回按主机统计的请求数、字节数、错误数和最近访问时间
+func (s *Server) getHostStats(c *gin.Context) {
+	hosts := []proxy.HostStats{}
+	if s.HostStats != nil {
+		hosts = s.HostStats.Stats()
+	}
+	c.JSON(http.StatusOK, gin.H{"hosts": hosts})
+}
+
+// getSessions 返回数据库中记录的所有运行，最新的在前
+func (s *Server) getSessions(c *gin.Context) {
+	sessions, err := s.WebHandler.Sessions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// getCAInfo 返回当前CA证书的详情，便于确认客户端信任的是哪个CA；format=pem时以附件形式返回PEM证书
+func (s *Server) getCAInfo(c *gin.Context) {
+	if s.CertManager == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CA certificate is not available"})
+		return
+	}
+	info, err := s.CertManager.Info()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	if c.Query("format") == "pem" {
+		c.Header("Content-Disposition", `attachment; filename="proxycraft-ca.pem"`)
+		c.Data(http.StatusOK, "application/x-pem-file", []byte(info.PEM))
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// caRotateWarning 提醒调用方轮换CA后需要让客户端重新信任
+const caRotateWarning = "The CA was regenerated: clients must trust the new CA certificate before new HTTPS connections are intercepted. Tunnels established earlier keep using certificates from the old CA until they reconnect."
+
+// rotateCA 重新生成CA，之后新的CONNECT使用新CA签发的证书，已建立的隧道不受影响
+func (s *Server) rotateCA(c *gin.Context) {
+	if s.CertManager == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CA certificate is not available"})
+		return
+	}
+	if err := s.CertManager.RegenerateCA(); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, certs.ErrCustomCARotation) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	info, err := s.CertManager.Info()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("CA certificate regenerated via API, new SHA-256 fingerprint: %s", info.SHA256)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"sha256": info.SHA256, "ca": info, "warning": caRotateWarning})
+}
+
+// requireAdminToken 校验Authorization中的Bearer令牌，未配置AdminToken时拒绝所有请求
+func (s *Server) requireAdminToken(c *gin.Context) {
+	if s.AdminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API is disabled: no admin token configured"})
+		return
+	}
+	auth := c.GetHeader("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.AdminToken)) != 1 {
+		c.Header("WWW-Authenticate", `Bearer realm="ProxyCraft"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing admin token"})
+		return
+	}
+	c.Next()
+}
+
+// getHealth 返回服务的健康状态，未关联代理时只报告API服务自身的运行时长
+func (s *Server) getHealth(c *gin.Context) {
+	health := proxy.Health{
+		Status:        "ok",
+		StartedAt:     s.startedAt,
+		UptimeSeconds: time.Since(s.startedAt).Seconds(),
+	}
+	if s.Health != nil {
+		health = s.Health.Health()
+	}
+	health.Version = s.Version
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, health)
+}
+
 // getRequestDetails 获取请求详情
 func (s *Server) getRequestDetails(c *gin.Context) {
 	id := c.Param("id")
@@ -332,28 +653,14 @@ func (s *Server) getRequestDetails(c *gin.Context) {
 	}
 
 	// 处理请求体
-	var body interface{}
-
-	contentType := entry.RequestHeaders.Get("Content-Type")
-	if len(entry.RequestBody) > 1024*1024 { // 如果请求体大于1MB
-		body = fmt.Sprintf("<Large request body, %d bytes>", len(entry.RequestBody))
-	} else if strings.Contains(contentType, "application/json") {
-		// 尝试解析JSON
-		if err := json.Unmarshal(entry.RequestBody, &body); err != nil {
-			body = string(entry.RequestBody)
-		}
-	} else if isBinaryContent(entry.RequestBody, contentType) {
-		body = fmt.Sprintf("<Binary data, %d bytes>", len(entry.RequestBody))
-	} else {
-		body = string(entry.RequestBody)
-	}
+	body := detailsBody(entry.RequestBody, entry.RequestHeaders.Get("Content-Type"), "request")
 
 	log.Printf("已获取请求详情，ID: %s，内容大小: %d bytes", id, len(entry.RequestBody))
 	response := gin.H{
 		"headers": headers,
 		"body":    body,
 	}
-	if llm := ExtractLLM(entry, true, false); llm != nil {
+	if llm := extractEntryLLM(s.WebHandler, entry, true, false); llm != nil {
 		response["llm"] = llm
 	}
 	c.JSON(http.StatusOK, response)
@@ -403,28 +710,17 @@ func (s *Server) getResponseDetails(c *gin.Context) {
 	}
 
 	// 处理响应体
-	var body interface{}
-
-	contentType := entry.ResponseHeaders.Get("Content-Type")
-	if len(entry.ResponseBody) > 1024*1024 { // 如果响应体大于1MB
-		body = fmt.Sprintf("<Large response body, %d bytes>", len(entry.ResponseBody))
-	} else if strings.Contains(contentType, "application/json") {
-		// 尝试解析JSON
-		if err := json.Unmarshal(entry.ResponseBody, &body); err != nil {
-			body = string(entry.ResponseBody)
-		}
-	} else if isBinaryContent(entry.ResponseBody, contentType) {
-		body = fmt.Sprintf("<Binary data, %d bytes>", len(entry.ResponseBody))
-	} else {
-		body = string(entry.ResponseBody)
-	}
+	body := detailsBody(entry.ResponseBody, entry.EffectiveContentType(), "response")
 
 	log.Printf("已获取响应详情，ID: %s，内容大小: %d bytes", id, len(entry.ResponseBody))
 	response := gin.H{
 		"headers": headers,
 		"body":    body,
 	}
-	if llm := ExtractLLM(entry, false, true); llm != nil {
+	if entry.DetectedContentType != "" {
+		response["detectedContentType"] = entry.DetectedContentType
+	}
+	if llm := extractEntryLLM(s.WebHandler, entry, false, true); llm != nil {
 		response["llm"] = llm
 	}
 	c.JSON(http.StatusOK, response)
@@ -432,14 +728,19 @@ func (s *Server) getResponseDetails(c *gin.Context) {
 
 // serveUI 提供前端静态文件
 func (s *Server) serveUI(c *gin.Context) {
+	path, ok := s.trimBasePath(c.Request.URL.Path)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
 	// 如果请求的路径是API路径，则跳过
-	if strings.HasPrefix(c.Request.URL.Path, "/api") {
+	if strings.HasPrefix(path, "/api") {
 		c.Next()
 		return
 	}
 
 	// 尝试从静态目录提供文件
-	filePath := filepath.Join(s.StaticDir, c.Request.URL.Path)
+	filePath := filepath.Join(s.StaticDir, filepath.FromSlash(path))
 
 	// 检查文件是否存在
 	stat, err := os.Stat(filePath)
@@ -451,10 +752,10 @@ func (s *Server) serveUI(c *gin.Context) {
 
 	// 如果文件不存在，则提供index.html
 	indexPath := filepath.Join(s.StaticDir, "index.html")
-	if _, err := os.Stat(indexPath); err == nil {
+	if data, err := os.ReadFile(indexPath); err == nil {
 		// index.html存在，提供之
 		c.Header("Cache-Control", "no-cache")
-		c.File(indexPath)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", s.rewriteIndexHTML(data))
 		return
 	}
 
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTrafficEntriesSortValidation(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/traffic?sort=host:asc,duration:desc", nil)
+	server.Router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var body struct {
+		Entries []*handlers.TrafficEntry `json:"entries"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.NotNil(t, body.Entries)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/traffic?sort=host%3BDROP%20TABLE%20traffic_entries", nil)
+	server.Router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "unsupported sort field")
+}
+
+type staticHostStats []proxy.HostStats
+
+func (s staticHostStats) Stats() []proxy.HostStats { return s }
+
+func TestGetHostStats(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	var body struct {
+		Hosts []proxy.HostStats `json:"hosts"`
+	}
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.NotNil(t, body.Hosts)
+	assert.Empty(t, body.Hosts)
+
+	server.HostStats = staticHostStats{{Host: "example.com", Requests: 3, Errors: 1, BytesReceived: 42}}
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Len(t, body.Hosts, 1)
+	assert.Equal(t, "example.com", body.Hosts[0].Host)
+	assert.Equal(t, int64(3), body.Hosts[0].Requests)
+	assert.Equal(t, int64(42), body.Hosts[0].BytesReceived)
+
+	// 清空流量时触发清空回调，用于重置统计
+	cleared := false
+	webHandler.SetClearCallback(func() { cleared = true })
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/traffic", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, cleared)
+}
+
+func TestGetResponseDetailsUsesDetectedContentType(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://gateway.internal/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer sk-test")
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	webHandler.OnRequest(reqCtx)
+	webHandler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/octet-stream"}},
+			Body:       io.NopCloser(bytes.NewBufferString(`{"choices":[{"message":{"content":"Hello!"}}]}`)),
+		},
+	})
+	id := reqCtx.UserData["traffic_id"].(string)
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/response", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var body struct {
+		Headers             map[string]string      `json:"headers"`
+		Body                map[string]interface{} `json:"body"`
+		DetectedContentType string                 `json:"detectedContentType"`
+		LLM                 *LLMExtracted          `json:"llm"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	// 响应头保持原样，响应体按探测到的JSON解析，而不是当作二进制数据
+	assert.Equal(t, "application/octet-stream", body.Headers["Content-Type"])
+	assert.Equal(t, "application/json", body.DetectedContentType)
+	require.NotNil(t, body.Body)
+	assert.NotNil(t, body.Body["choices"])
+	require.NotNil(t, body.LLM)
+	require.NotNil(t, body.LLM.Response)
+	assert.Equal(t, "Hello!", body.LLM.Response.Content)
+}
+
+func TestServerListenAddrAndURL(t *testing.T) {
+	server := &Server{UIPort: 8081}
+	assert.Equal(t, "127.0.0.1:8081", server.ListenAddr())
+	assert.Equal(t, "http://localhost:8081", server.URL())
+
+	server.UIHost = "0.0.0.0"
+	server.UITLSCert, server.UITLSKey = "ui.crt", "ui.key"
+	assert.Equal(t, "0.0.0.0:8081", server.ListenAddr())
+	assert.Equal(t, "https://localhost:8081", server.URL())
+
+	// 只设置证书或私钥之一时不启用TLS
+	server.UITLSKey = ""
+	assert.Equal(t, "http://localhost:8081", server.URL())
+}
+
+func TestServerServesOverTLS(t *testing.T) {
+	manager, err := certs.NewInMemoryManager()
+	require.NoError(t, err)
+	cert, key, err := manager.GenerateServerCert("localhost")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ui.crt"), filepath.Join(dir, "ui.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(dir, "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+	server.UITLSCert, server.UITLSKey = certFile, keyFile
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(manager.CACert)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}},
+		Timeout:   5 * time.Second,
+	}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/api/traffic")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, resp.TLS)
+
+	// 明文HTTP请求不会得到正常响应
+	plain := &http.Client{Timeout: 5 * time.Second}
+	if resp, err := plain.Get("http://" + listener.Addr().String() + "/api/traffic"); err == nil {
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp.Body.Close()
+	}
+}
+
+func TestGetResponseDetailsReadsBodyFromBodyStore(t *testing.T) {
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "traffic.db"), handlers.StorageSQLite)
+	require.NoError(t, err)
+	storeDir := t.TempDir()
+	require.NoError(t, webHandler.SetBodyStore(storeDir, 1024))
+	server := NewServer(webHandler, 0)
+
+	large := strings.Repeat("0123456789abcdef", 1024)
+	id := recordResponseEntry(t, webHandler, http.StatusOK, http.Header{"Content-Type": []string{"text/plain"}}, large)
+
+	// 响应体写入了以sha256命名的文件
+	sum := sha256.Sum256([]byte(large))
+	hash := hex.EncodeToString(sum[:])
+	stored, err := os.ReadFile(filepath.Join(storeDir, hash[:2], hash))
+	require.NoError(t, err)
+	assert.Equal(t, large, string(stored))
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/response", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var body struct {
+		Body string `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, large, body.Body)
+}
+
+func TestAPIPrettyJSON(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+	server.HostStats = staticHostStats{{Host: "example.com", Requests: 3}, {Host: "example.org", Requests: 1}}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		return recorder
+	}
+
+	compact := get("/api/hosts").Body.Bytes()
+	pretty := get("/api/hosts?pretty=1")
+
+	assert.NotContains(t, string(compact), "\n  ")
+	assert.Contains(t, pretty.Body.String(), "\n  \"hosts\": [")
+	assert.Contains(t, pretty.Header().Get("Content-Type"), "application/json")
+	assert.Greater(t, pretty.Body.Len(), len(compact))
+
+	var indented bytes.Buffer
+	require.NoError(t, json.Indent(&indented, compact, "", "  "))
+	assert.Equal(t, indented.String()+"\n", pretty.Body.String())
+
+	// pretty=0 时仍返回紧凑的JSON
+	assert.Equal(t, get("/api/hosts?pretty=0").Body.String(), string(compact))
+}
+
+func TestHealthz(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+	server.Version = "0.1.0"
+
+	get := func() map[string]any {
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		return body
+	}
+
+	body := get()
+	assert.Equal(t, "ok", body["status"])
+	assert.Equal(t, "0.1.0", body["version"])
+	assert.Contains(t, body, "uptimeSeconds")
+
+	proxyServer, err := proxy.New(proxy.Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+	server.Health = proxyServer
+	body = get()
+	assert.Equal(t, "0.1.0", body["version"])
+	assert.Equal(t, "forward", body["mode"])
+	assert.Equal(t, true, body["caInitialized"])
+	assert.Equal(t, float64(0), body["activeConnections"])
+}
+
+func TestDeleteTrafficByFilter(t *testing.T) {
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, "", handlers.StorageMemory)
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	keepID := recordRequestEntry(t, webHandler, http.MethodGet, "https://api.example.com/v1/users", "", "")
+	dropID := recordRequestEntry(t, webHandler, http.MethodGet, "https://ads.example.net/pixel", "", "")
+
+	del := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/traffic"+query, nil))
+		return recorder
+	}
+
+	recorder := del("?host=ads.example.net&status=2xx")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var body struct {
+		Deleted int      `json:"deleted"`
+		IDs     []string `json:"ids"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, 1, body.Deleted)
+	assert.Equal(t, []string{dropID}, body.IDs)
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, keepID, entries[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, del("?status=teapot").Code)
+	assert.Equal(t, http.StatusBadRequest, del("?before=yesterday").Code)
+
+	// 不带过滤参数时仍清空全部条目
+	assert.Equal(t, http.StatusOK, del("").Code)
+	assert.Empty(t, webHandler.GetEntries())
+}
+
+func TestGetCAInfo(t *testing.T) {
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, "", handlers.StorageMemory)
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+	assert.Equal(t, http.StatusNotFound, get("/api/ca").Code)
+
+	certManager, err := certs.NewInMemoryManager()
+	require.NoError(t, err)
+	server.CertManager = certManager
+
+	recorder := get("/api/ca")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var info certs.CAInfo
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &info))
+
+	// 指纹与独立计算的证书哈希一致
+	sum := sha256.Sum256(certManager.CACert.Raw)
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), strings.ReplaceAll(info.SHA256, ":", ""))
+	assert.Len(t, info.SHA256, 32*3-1)
+	assert.Equal(t, certManager.CACert.Subject.String(), info.Subject)
+	assert.True(t, certManager.CACert.NotAfter.Equal(info.NotAfter))
+	assert.True(t, certManager.CACert.NotBefore.Equal(info.NotBefore))
+	assert.NotEmpty(t, info.Serial)
+
+	block, _ := pem.Decode([]byte(info.PEM))
+	require.NotNil(t, block)
+	assert.Equal(t, certManager.CACert.Raw, block.Bytes)
+
+	recorder = get("/api/ca?format=pem")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/x-pem-file", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "proxycraft-ca.pem")
+	assert.Equal(t, info.PEM, recorder.Body.String())
+}
+
+func TestRotateCA(t *testing.T) {
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, "", handlers.StorageMemory)
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+	certManager, err := certs.NewInMemoryManager()
+	require.NoError(t, err)
+	server.CertManager = certManager
+	oldCA := certManager.CACert
+
+	rotate := func(token string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/ca/rotate", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		server.Router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// 未配置令牌时管理接口被禁用
+	assert.Equal(t, http.StatusForbidden, rotate("secret").Code)
+
+	server.AdminToken = "secret"
+	assert.Equal(t, http.StatusUnauthorized, rotate("").Code)
+	assert.Equal(t, http.StatusUnauthorized, rotate("wrong").Code)
+	assert.Equal(t, oldCA, certManager.CACert)
+
+	recorder := rotate("secret")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var result struct {
+		SHA256  string       `json:"sha256"`
+		CA      certs.CAInfo `json:"ca"`
+		Warning string       `json:"warning"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.NotEqual(t, oldCA.Raw, certManager.CACert.Raw)
+	assert.Equal(t, certs.Fingerprint(certManager.CACert.Raw), result.SHA256)
+	assert.Equal(t, result.SHA256, result.CA.SHA256)
+	assert.Contains(t, result.Warning, "trust the new CA")
+}
+
+func TestDetailsBody(t *testing.T) {
+	gbk := []byte{0xc4, 0xe3, 0xba, 0xc3} // GBK编码的"你好"
+	assert.Equal(t, "你好", detailsBody(gbk, "text/plain; charset=gbk", "response"))
+	assert.Equal(t, map[string]interface{}{"a": float64(1)}, detailsBody([]byte(`{"a":1}`), "application/json", "request"))
+
+	// 过大的消息体在转换字符集之前就返回说明
+	large := bytes.Repeat(gbk, maxDetailsBodySize/len(gbk)+1)
+	assert.Equal(t, fmt.Sprintf("<Large response body, %d bytes>", len(large)), detailsBody(large, "text/plain; charset=gbk", "response"))
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// maxSSEReplayInterval 限制回放时事件之间的间隔，避免一次回放长时间占用连接
+const maxSSEReplayInterval = 5 * time.Second
+
+// SSEEvent 是从记录的SSE响应体中解析出的一个事件
+type SSEEvent struct {
+	Event string `json:"event,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Data  string `json:"data"`
+	Done  bool   `json:"done,omitempty"` // data为 [DONE] 结束标记
+}
+
+// parseSSEEvents 将累积保存的SSE响应体还原为按顺序排列的事件
+// 只有包含data字段的事件会被返回；如果响应体中没有空行分隔，则每个data行视为一个事件
+func parseSSEEvents(body []byte) []SSEEvent {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		events       []SSEEvent
+		perLine      []SSEEvent
+		current      SSEEvent
+		dataLines    []string
+		lastID       string
+		hasEmptyLine bool
+	)
+	dispatch := func() {
+		if len(dataLines) > 0 {
+			current.Data = strings.Join(dataLines, "\n")
+			current.ID = lastID
+			current.Done = current.Data == "[DONE]"
+			events = append(events, current)
+		}
+		current = SSEEvent{}
+		dataLines = nil
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			hasEmptyLine = true
+			dispatch()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch field {
+		case "event":
+			current.Event = value
+		case "id":
+			lastID = value
+		case "data":
+			dataLines = append(dataLines, value)
+			perLine = append(perLine, SSEEvent{Event: current.Event, ID: lastID, Data: value, Done: value == "[DONE]"})
+		}
+	}
+	dispatch()
+
+	if !hasEmptyLine && len(perLine) > 1 {
+		return perLine
+	}
+	return events
+}
+
+// getSSEEvents 将SSE条目的响应体解析为事件数组，timings中是代理收到每个事件的时间和大小，可用于绘制LLM生成的延迟瀑布图
+// stream=true时通过新的SSE连接按顺序重新推送，默认按记录的到达时间还原事件间隔，
+// 也可以用interval参数（毫秒）指定固定的回放间隔
+func (s *Server) getSSEEvents(c *gin.Context) {
+	entry := s.WebHandler.GetEntry(c.Param("id"))
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Entry not found",
+		})
+		return
+	}
+	if !entry.IsSSE && !strings.Contains(entry.EffectiveContentType(), "text/event-stream") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Entry is not an SSE response",
+		})
+		return
+	}
+
+	events := parseSSEEvents(entry.ResponseBody)
+	if events == nil {
+		events = []SSEEvent{}
+	}
+
+	if c.Query("stream") != "true" {
+		timings := entry.SSEEvents
+		if timings == nil {
+			timings = []handlers.SSEEvent{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"events":    events,
+			"timings":   timings,
+			"completed": entry.IsSSECompleted,
+		})
+		return
+	}
+
+	var interval time.Duration
+	timings := entry.SSEEvents
+	if raw := c.Query("interval"); raw != "" {
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "interval must be a non-negative number of milliseconds",
+			})
+			return
+		}
+		interval = min(time.Duration(ms)*time.Millisecond, maxSSEReplayInterval)
+		timings = nil
+	}
+	delays := sseReplayDelays(len(events), timings, interval)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	for i, event := range events {
+		if delays[i] > 0 {
+			select {
+			case <-time.After(delays[i]):
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+		if _, err := c.Writer.WriteString(formatSSEEvent(event)); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// sseReplayDelays 返回回放每个事件前需要等待的时间
+// 记录的到达时间与解析出的事件一一对应时按相邻事件的OffsetMs差值还原原始节奏，否则使用固定的interval
+func sseReplayDelays(count int, timings []handlers.SSEEvent, interval time.Duration) []time.Duration {
+	delays := make([]time.Duration, count)
+	aligned := len(timings) == count
+	for i := 1; i < count; i++ {
+		if !aligned {
+			delays[i] = interval
+			continue
+		}
+		delta := time.Duration((timings[i].OffsetMs - timings[i-1].OffsetMs) * float64(time.Millisecond))
+		delays[i] = min(max(delta, 0), maxSSEReplayInterval)
+	}
+	return delays
+}
+
+// formatSSEEvent 按SSE线格式序列化事件，多行data拆分为多个data字段
+func formatSSEEvent(event SSEEvent) string {
+	var b strings.Builder
+	if event.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event.Event)
+	}
+	if event.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", event.ID)
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordSSEEntry 通过WebHandler记录一条包含多个事件的SSE响应，返回条目ID
+func recordSSEEntry(t *testing.T, handler *handlers.WebHandler, events []string) string {
+	req, err := http.NewRequest("GET", "http://example.com/v1/stream", nil)
+	require.NoError(t, err)
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		IsSSE:     true,
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+
+	respCtx := &proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		IsSSE:  true,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		},
+	}
+	handler.OnResponse(respCtx)
+	for _, event := range events {
+		handler.OnSSE(event, respCtx)
+	}
+	return reqCtx.UserData["traffic_id"].(string)
+}
+
+func TestGetSSEEventsRoundTrip(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+
+	id := recordSSEEntry(t, webHandler, []string{
+		"event: message_start\nid: 1\ndata: {\"type\":\"message_start\"}",
+		": keep-alive comment\ndata: first line\ndata: second line",
+		"event: message_stop\nid: 3\ndata: {\"type\":\"message_stop\"}",
+		"data: [DONE]",
+	})
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/sse", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var body struct {
+		Events    []SSEEvent          `json:"events"`
+		Timings   []handlers.SSEEvent `json:"timings"`
+		Completed bool                `json:"completed"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Len(t, body.Events, 4)
+	require.Len(t, body.Timings, 4)
+	assert.Equal(t, "message_start", body.Timings[0].Type)
+	assert.Equal(t, len("data: [DONE]"), body.Timings[3].Size)
+	assert.Equal(t, SSEEvent{Event: "message_start", ID: "1", Data: `{"type":"message_start"}`}, body.Events[0])
+	// id 在后续事件中沿用，直到被新的id字段覆盖
+	assert.Equal(t, SSEEvent{ID: "1", Data: "first line\nsecond line"}, body.Events[1])
+	assert.Equal(t, "message_stop", body.Events[2].Event)
+	assert.True(t, body.Events[3].Done)
+
+	// stream=true 按原始顺序重新推送，序列化后仍能解析出相同的事件
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/"+id+"/sse?stream=true", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, body.Events, parseSSEEvents(recorder.Body.Bytes()))
+}
+
+func TestGetSSEEventsRejectsNonSSEEntry(t *testing.T) {
+	webHandler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server := NewServer(webHandler, 0)
+	simulateTraffic(webHandler, 1)
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/1/sse", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/traffic/999/sse", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestSSEReplayDelays(t *testing.T) {
+	timings := []handlers.SSEEvent{{OffsetMs: 120}, {OffsetMs: 170.5}, {OffsetMs: 9000}, {OffsetMs: 8990}}
+
+	// 记录的时间与事件一一对应时按到达时间差回放，单个间隔不超过上限，乱序时不等待
+	assert.Equal(t, []time.Duration{0, 50500 * time.Microsecond, maxSSEReplayInterval, 0},
+		sseReplayDelays(4, timings, 10*time.Millisecond))
+
+	// 数量对不上（例如只有注释的事件或超过记录上限）时使用固定间隔
+	assert.Equal(t, []time.Duration{0, 10 * time.Millisecond, 10 * time.Millisecond},
+		sseReplayDelays(3, timings, 10*time.Millisecond))
+	assert.Equal(t, []time.Duration{0, 0}, sseReplayDelays(2, nil, 0))
+	assert.Empty(t, sseReplayDelays(0, timings, time.Second))
+}
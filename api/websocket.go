@@ -21,24 +21,36 @@ type TestWebSocketServer struct {
 
 // WebSocketServer 表示WebSocket服务器
 type WebSocketServer struct {
-	WebHandler *handlers.WebHandler // Web处理器引用
-	Server     *socket.Server       // Socket.io服务器
-	Clients    map[string]bool      // 连接的客户端
-	mu         sync.Mutex           // 互斥锁，用于保护clients
+	WebHandler *handlers.WebHandler     // Web处理器引用
+	Server     *socket.Server           // Socket.io服务器
+	Clients    map[string]bool          // 连接的客户端
+	mu         sync.Mutex               // 互斥锁，用于保护clients
+	streams    map[string]*clientStream // 每个客户端的推送状态
+	streamMu   sync.Mutex               // 串行化同步与广播，保护streams和flushTimer
+	flushTimer *time.Timer              // 等待中的批量推送，为nil时没有待推送的条目
+
+	BatchInterval time.Duration // 合并实时推送的时间窗口，为0时使用100ms
+	BatchSize     int           // 单个traffic_new_entries事件最多包含的条目数，为0时使用200
 }
 
 // 事件类型常量
 const (
-	EventConnect         = "connect"           // 连接事件
-	EventDisconnect      = "disconnect"        // 断开连接事件
-	EventError           = "error"             // 错误事件
-	EventTrafficEntries  = "traffic_entries"   // 获取所有流量条目
-	EventTrafficNewEntry = "traffic_new_entry" // 新的流量条目
-	EventTrafficClear    = "traffic_clear"     // 清空所有流量条目
-	EventRequestDetails  = "request_details"   // 请求详情
-	EventResponseDetails = "response_details"  // 响应详情
+	EventConnect           = "connect"             // 连接事件
+	EventDisconnect        = "disconnect"          // 断开连接事件
+	EventError             = "error"               // 错误事件
+	EventTrafficEntries    = "traffic_entries"     // 获取所有流量条目
+	EventTrafficNewEntry   = "traffic_new_entry"   // 新的流量条目
+	EventTrafficNewEntries = "traffic_new_entries" // 批量推送的新流量条目
+	EventTrafficClear      = "traffic_clear"       // 清空所有流量条目
+	EventTrafficDeleted    = "traffic_deleted"     // 按条件删除的流量条目ID
+	EventRequestDetails    = "request_details"     // 请求详情
+	EventResponseDetails   = "response_details"    // 响应详情
+	EventTrafficEntry      = "traffic_entry"       // 单个条目的完整信息，包括请求和响应详情
 )
 
+// maxDetailsBodySize 超过该大小的消息体在详情中只返回占位文本
+const maxDetailsBodySize = 1024 * 1024
+
 // getJsonValue 从interface{}中获取指定字段的值
 func getJsonValue(data interface{}, key string) interface{} {
 	if data == nil {
@@ -84,6 +96,7 @@ func NewWebSocketServerWithTestMode(webHandler *handlers.WebHandler, testMode bo
 		WebHandler: webHandler,
 		Server:     server,
 		Clients:    make(map[string]bool),
+		streams:    make(map[string]*clientStream),
 	}
 
 	// 设置事件处理器
@@ -139,6 +152,9 @@ func (ws *WebSocketServer) setupEventHandlers() {
 		ws.Clients[fmt.Sprintf("%v", client.Id())] = true
 		clientCount := len(ws.Clients)
 		ws.mu.Unlock()
+		ws.registerStream(fmt.Sprintf("%v", client.Id()), func(event string, args ...interface{}) {
+			client.Emit(event, args...)
+		})
 
 		log.Printf("WebSocket 客户端已连接: %s (当前连接数: %d)", fmt.Sprintf("%v", client.Id()), clientCount)
 
@@ -152,6 +168,7 @@ func (ws *WebSocketServer) setupEventHandlers() {
 			delete(ws.Clients, fmt.Sprintf("%v", client.Id()))
 			clientCount := len(ws.Clients)
 			ws.mu.Unlock()
+			ws.unregisterStream(fmt.Sprintf("%v", client.Id()))
 
 			log.Printf("WebSocket 客户端已断开连接: %s, 原因: %s (当前连接数: %d)", fmt.Sprintf("%v", client.Id()), reason, clientCount)
 		})
@@ -167,8 +184,6 @@ func (ws *WebSocketServer) setupEventHandlers() {
 		client.On(EventTrafficEntries, func(args ...interface{}) {
 			// log.Printf("接收到获取所有流量条目请求, 客户端: %s", fmt.Sprintf("%v", client.Id()))
 
-			// 立即返回一个空的条目列表，这样我们就能确认事件处理函数被调用了
-			entries := []*handlers.TrafficEntry{}
 			offsetID := ""
 			if len(args) > 0 {
 				if value, ok := args[0].(string); ok {
@@ -180,59 +195,24 @@ func (ws *WebSocketServer) setupEventHandlers() {
 				}
 			}
 
-			// 如果WebHandler不为空，尝试获取真实数据
-			if ws.WebHandler != nil {
-				if offsetID == "" {
-					entries = ws.WebHandler.GetEntries()
-				} else {
-					entries = ws.WebHandler.GetEntriesAfterID(offsetID)
-				}
-			}
-
-			// log.Printf("准备发送 %d 条流量条目到客户端", len(entries))
-			client.Emit(EventTrafficEntries, entries)
+			// 查询并发送条目，完成后该客户端才开始接收实时推送
+			count := ws.syncEntries(fmt.Sprintf("%v", client.Id()), offsetID)
 			if offsetID == "" {
-				log.Printf("已发送所有流量条目到客户端: %s, 条目数: %d", fmt.Sprintf("%v", client.Id()), len(entries))
+				log.Printf("已发送所有流量条目到客户端: %s, 条目数: %d", fmt.Sprintf("%v", client.Id()), count)
 			} else {
-				log.Printf("已发送增量流量条目到客户端: %s, offsetID: %s, 条目数: %d", fmt.Sprintf("%v", client.Id()), offsetID, len(entries))
+				log.Printf("已发送增量流量条目到客户端: %s, offsetID: %s, 条目数: %d", fmt.Sprintf("%v", client.Id()), offsetID, count)
 			}
 		})
 
-		// 获取请求详情 - 在客户端级别监听
-		client.On(EventRequestDetails, func(args ...interface{}) {
-			id := args[0].(string)
-			// log.Printf("接收到获取请求详情请求, 客户端: %s, 条目ID: %s", fmt.Sprintf("%v", client.Id()), id)
-
-			entry := ws.WebHandler.GetEntry(id)
-			if entry == nil {
-				log.Printf("未找到条目, ID: %s", id)
-				client.Emit("error", map[string]string{"message": "Entry not found"})
-				return
-			}
-
-			// 处理请求头和请求体
-			requestDetails := ws.formatRequestDetails(entry)
-			client.Emit(EventRequestDetails, requestDetails)
-			log.Printf("已发送请求详情到客户端: %s, 条目ID: %s", fmt.Sprintf("%v", client.Id()), id)
-		})
-
-		// 获取响应详情 - 在客户端级别监听
-		client.On(EventResponseDetails, func(args ...interface{}) {
-			id := args[0].(string)
-			log.Printf("接收到获取响应详情请求, 客户端: %s, 条目ID: %s", fmt.Sprintf("%v", client.Id()), id)
-
-			entry := ws.WebHandler.GetEntry(id)
-			if entry == nil {
-				log.Printf("未找到条目, ID: %s", id)
-				client.Emit("error", map[string]string{"message": "Entry not found"})
-				return
-			}
-
-			// 处理响应头和响应体
-			responseDetails := ws.formatResponseDetails(entry)
-			client.Emit(EventResponseDetails, responseDetails)
-			// log.Printf("已发送响应详情到客户端: %s, 条目ID: %s", fmt.Sprintf("%v", client.Id()), id)
-		})
+		// 获取请求详情、响应详情和完整条目 - 在客户端级别监听
+		emit := func(event string, args ...interface{}) {
+			client.Emit(event, args...)
+		}
+		for _, event := range []string{EventRequestDetails, EventResponseDetails, EventTrafficEntry} {
+			client.On(event, func(args ...interface{}) {
+				ws.handleDetailsEvent(event, args, emit)
+			})
+		}
 
 		// 清空所有流量条目 - 在客户端级别监听
 		client.On(EventTrafficClear, func(args ...interface{}) {
@@ -271,6 +251,47 @@ func (ws *WebSocketServer) setupEventHandlers() {
 	})
 }
 
+// detailsEntryID 从事件参数中取出条目ID，参数可以是ID字符串或 {"id": "..."}
+func detailsEntryID(args []interface{}) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if id, ok := args[0].(string); ok {
+		return id
+	}
+	id, _ := getJsonValue(args[0], "id").(string)
+	return id
+}
+
+// handleDetailsEvent 按条目ID返回请求详情、响应详情或完整条目，结果以同名事件发回客户端
+func (ws *WebSocketServer) handleDetailsEvent(event string, args []interface{}, emit func(event string, args ...interface{})) {
+	id := detailsEntryID(args)
+	entry := ws.WebHandler.GetEntry(id)
+	if entry == nil {
+		log.Printf("未找到条目, ID: %s", id)
+		emit(EventError, map[string]string{"message": "Entry not found", "id": id})
+		return
+	}
+
+	switch event {
+	case EventRequestDetails:
+		details := ws.formatRequestDetails(entry)
+		details["id"] = id
+		emit(event, details)
+	case EventResponseDetails:
+		details := ws.formatResponseDetails(entry)
+		details["id"] = id
+		emit(event, details)
+	case EventTrafficEntry:
+		emit(event, map[string]interface{}{
+			"id":       id,
+			"entry":    entry,
+			"request":  ws.formatRequestDetails(entry),
+			"response": ws.formatResponseDetails(entry),
+		})
+	}
+}
+
 // formatRequestDetails 格式化请求详情
 func (ws *WebSocketServer) formatRequestDetails(entry *handlers.TrafficEntry) map[string]interface{} {
 	log.Printf("[WebSocket] 准备请求详情: ID=%s, Method=%s, Path=%s, Content-Type=%s, RequestBody=%d bytes",
@@ -313,25 +334,13 @@ func (ws *WebSocketServer) formatRequestDetails(entry *handlers.TrafficEntry) ma
 	}
 
 	// 处理请求体
-	var body interface{}
-
-	contentType := entry.RequestHeaders.Get("Content-Type")
-	if strings.Contains(contentType, "application/json") {
-		// 尝试解析JSON
-		if err := json.Unmarshal(entry.RequestBody, &body); err != nil {
-			body = string(entry.RequestBody)
-		}
-	} else if isBinaryContent(entry.RequestBody, contentType) {
-		body = fmt.Sprintf("<Binary data, %d bytes>", len(entry.RequestBody))
-	} else {
-		body = string(entry.RequestBody)
-	}
+	body := detailsBody(entry.RequestBody, entry.RequestHeaders.Get("Content-Type"), "request")
 
 	details := map[string]interface{}{
 		"headers": headers,
 		"body":    body,
 	}
-	if llm := ExtractLLM(entry, true, false); llm != nil {
+	if llm := extractEntryLLM(ws.WebHandler, entry, true, false); llm != nil {
 		details["llm"] = llm
 	}
 
@@ -373,41 +382,26 @@ func (ws *WebSocketServer) formatResponseDetails(entry *handlers.TrafficEntry) m
 	}
 
 	// 处理响应体
-	var body interface{}
-
-	contentType := entry.ResponseHeaders.Get("Content-Type")
-	if strings.Contains(contentType, "application/json") {
-		// 尝试解析JSON
-		if err := json.Unmarshal(entry.ResponseBody, &body); err != nil {
-			body = string(entry.ResponseBody)
-		}
-	} else if isBinaryContent(entry.ResponseBody, contentType) {
-		body = fmt.Sprintf("<Binary data, %d bytes>", len(entry.ResponseBody))
-	} else {
-		body = string(entry.ResponseBody)
-	}
+	body := detailsBody(entry.ResponseBody, entry.EffectiveContentType(), "response")
 
 	details := map[string]interface{}{
 		"headers": headers,
 		"body":    body,
 	}
-	if llm := ExtractLLM(entry, false, true); llm != nil {
+	if entry.DetectedContentType != "" {
+		details["detectedContentType"] = entry.DetectedContentType
+	}
+	if llm := extractEntryLLM(ws.WebHandler, entry, false, true); llm != nil {
 		details["llm"] = llm
 	}
 
 	return details
 }
 
-// BroadcastNewEntry 广播新的流量条目给所有客户端
+// BroadcastNewEntry 广播新的流量条目给所有已完成同步的客户端，已发送过的相同或更旧版本会被跳过
 func (ws *WebSocketServer) BroadcastNewEntry(entry *handlers.TrafficEntry) {
-	ws.mu.Lock()
-	clientCount := len(ws.Clients)
-	ws.mu.Unlock()
-
-	log.Printf("广播新的流量条目, ID: %s, 广播客户端数: %d", entry.ID, clientCount)
-	if clientCount > 0 {
-		ws.Server.Emit(EventTrafficNewEntry, entry)
-	}
+	clientCount := ws.publishEntry(entry)
+	log.Printf("广播新的流量条目, ID: %s, Seq: %d, 广播客户端数: %d", entry.ID, entry.Seq, clientCount)
 }
 
 // BroadcastClearTraffic 广播清空所有流量条目
@@ -416,10 +410,14 @@ func (ws *WebSocketServer) BroadcastClearTraffic() {
 	clientCount := len(ws.Clients)
 	ws.mu.Unlock()
 
+	ws.resetStreams()
 	log.Printf("广播清空所有流量条目, 广播客户端数: %d", clientCount)
-	if clientCount > 0 {
-		ws.Server.Emit(EventTrafficClear, nil)
-	}
+}
+
+// BroadcastDeletedEntries 广播按条件删除的流量条目ID，客户端据此从列表中移除
+func (ws *WebSocketServer) BroadcastDeletedEntries(ids []string) {
+	ws.removeEntries(ids)
+	log.Printf("广播删除的流量条目, 条目数: %d", len(ids))
 }
 
 // Start 启动WebSocket服务器
@@ -0,0 +1,417 @@
+package api
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+)
+
+const (
+	defaultBatchInterval = 100 * time.Millisecond
+	defaultBatchSize     = 200
+
+	// 慢客户端最多积压的批次数，超出后丢弃最早的条目，避免内存无限增长
+	maxQueuedBatches = 10
+
+	// 没有WebHandler时每个客户端保留的发送记录数
+	defaultDeliveredLimit = 2000
+)
+
+// clientStream 记录单个客户端的推送状态
+// 客户端在完成一次traffic_entries同步之前不会收到实时推送，期间的新条目暂存在pending中，
+// 同步完成后与同步结果按Seq去重后再补发，保证同步结果与实时推送不重叠、不回退
+// 实时推送先进入queue，按BatchInterval合并后由独立的goroutine发送，慢客户端不会阻塞广播
+// 发送goroutine不持有streamMu，因此对该客户端的所有发送都经过emitMu串行化；
+// 全量同步和清空会递增generation，尚未发出的旧批次据此丢弃，不会出现在traffic_entries或traffic_clear之后；
+// 按条件删除时，已取出的批次中被删除的条目记录在removed中，发送时跳过，不会出现在traffic_deleted之后
+type clientStream struct {
+	emit       func(event string, args ...interface{}) // 向该客户端发送事件
+	emitMu     sync.Mutex                              // 串行化对该客户端的发送
+	generation atomic.Uint64                           // 全量同步或清空的次数，用于识别过期的批次
+	ready      bool                                    // 是否已完成同步，开始接收实时推送
+	pending    map[string]*handlers.TrafficEntry       // 同步完成前收到的更新，每个ID只保留最新一条
+	delivered  map[string]uint64                       // 已实际发送给客户端的每个条目的最大Seq
+	limit      int                                     // delivered保留的条目数，与存储的保留条数一致
+	inflight   map[string]uint64                       // 正在发送的批次中每个条目的Seq
+	queue      []*handlers.TrafficEntry                // 等待批量发送的实时推送，按到达顺序
+	queued     map[string]int                          // 条目ID在queue中的位置，同一条目的多次更新合并为最新一条
+	sending    bool                                    // 是否有批次正在发送
+	removed    map[string]bool                         // 正在发送的批次中已被删除的条目，受emitMu保护
+	dropped    int                                     // 因客户端过慢被丢弃的推送数
+}
+
+func newClientStream(emit func(event string, args ...interface{}), limit int) *clientStream {
+	return &clientStream{
+		emit:      emit,
+		limit:     limit,
+		pending:   make(map[string]*handlers.TrafficEntry),
+		delivered: make(map[string]uint64),
+		inflight:  make(map[string]uint64),
+		queued:    make(map[string]int),
+	}
+}
+
+// enqueue 将条目加入待发送队列，已在队列中的条目原地替换为新版本
+// 队列超过limit时丢弃最早的条目，并清除其发送记录，使下一次同步能重新发送
+func (cs *clientStream) enqueue(entry *handlers.TrafficEntry, limit int) {
+	if index, ok := cs.queued[entry.ID]; ok {
+		cs.queue[index] = entry
+		return
+	}
+	cs.queued[entry.ID] = len(cs.queue)
+	cs.queue = append(cs.queue, entry)
+
+	if overflow := len(cs.queue) - limit; overflow > 0 {
+		cs.dropped += overflow
+		for _, dropped := range cs.queue[:overflow] {
+			delete(cs.delivered, dropped.ID)
+		}
+		cs.queue = append([]*handlers.TrafficEntry(nil), cs.queue[overflow:]...)
+		cs.queued = make(map[string]int, len(cs.queue))
+		for i, queued := range cs.queue {
+			cs.queued[queued.ID] = i
+		}
+	}
+}
+
+// dropSyncedFromQueue 从队列中移除已随同步结果发送、且不比同步结果新的条目
+func (cs *clientStream) dropSyncedFromQueue(synced map[string]uint64) {
+	kept := cs.queue[:0]
+	for _, entry := range cs.queue {
+		if seq, ok := synced[entry.ID]; ok && entry.Seq <= seq {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	cs.queue = kept
+	cs.queued = make(map[string]int, len(kept))
+	for i, entry := range kept {
+		cs.queued[entry.ID] = i
+	}
+}
+
+// removeFromQueue 从队列中移除指定的条目
+func (cs *clientStream) removeFromQueue(ids map[string]bool) {
+	kept := cs.queue[:0]
+	for _, entry := range cs.queue {
+		if !ids[entry.ID] {
+			kept = append(kept, entry)
+		}
+	}
+	cs.queue = kept
+	cs.queued = make(map[string]int, len(kept))
+	for i, entry := range kept {
+		cs.queued[entry.ID] = i
+	}
+}
+
+// takeQueue 取出队列中的全部条目
+func (cs *clientStream) takeQueue() []*handlers.TrafficEntry {
+	batch := cs.queue
+	cs.queue = nil
+	cs.queued = make(map[string]int)
+	return batch
+}
+
+func (ws *WebSocketServer) batchInterval() time.Duration {
+	if ws.BatchInterval > 0 {
+		return ws.BatchInterval
+	}
+	return defaultBatchInterval
+}
+
+func (ws *WebSocketServer) batchSize() int {
+	if ws.BatchSize > 0 {
+		return ws.BatchSize
+	}
+	return defaultBatchSize
+}
+
+// isNewer 判断条目是否比已发送、正在发送或已排队的版本更新
+// Seq为0表示条目已不在内存中（只来自数据库），不会再有更新，只要未发送过就接受
+func (cs *clientStream) isNewer(entry *handlers.TrafficEntry) bool {
+	if last, sent := cs.delivered[entry.ID]; sent && entry.Seq <= last {
+		return false
+	}
+	if seq, ok := cs.inflight[entry.ID]; ok && entry.Seq <= seq {
+		return false
+	}
+	if index, ok := cs.queued[entry.ID]; ok && entry.Seq <= cs.queue[index].Seq {
+		return false
+	}
+	return true
+}
+
+// markDelivered 记录条目已发送给客户端
+func (cs *clientStream) markDelivered(entry *handlers.TrafficEntry) {
+	if last, sent := cs.delivered[entry.ID]; !sent || entry.Seq > last {
+		cs.delivered[entry.ID] = entry.Seq
+	}
+	if cs.limit > 0 && len(cs.delivered) > 2*cs.limit {
+		cs.pruneDelivered()
+	}
+}
+
+// pruneDelivered 只保留Seq最大的limit条发送记录
+// 更旧的条目已被存储清理，即使被遗忘，再次收到更新时也只是重新发送一次
+func (cs *clientStream) pruneDelivered() {
+	type record struct {
+		id  string
+		seq uint64
+	}
+	records := make([]record, 0, len(cs.delivered))
+	for id, seq := range cs.delivered {
+		records = append(records, record{id, seq})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].seq > records[j].seq })
+	for _, r := range records[cs.limit:] {
+		delete(cs.delivered, r.id)
+	}
+}
+
+// invalidate 使正在发送和排队的批次失效，并等待已开始的发送结束
+// 返回后该客户端不会再收到旧批次，调用方需持有streamMu
+func (cs *clientStream) invalidate() {
+	cs.generation.Add(1)
+	cs.emitMu.Lock()
+	defer cs.emitMu.Unlock()
+	cs.delivered = make(map[string]uint64)
+	cs.inflight = make(map[string]uint64)
+	cs.takeQueue()
+}
+
+// registerStream 登记客户端的推送状态
+func (ws *WebSocketServer) registerStream(clientID string, emit func(event string, args ...interface{})) {
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+	limit := defaultDeliveredLimit
+	if ws.WebHandler != nil {
+		limit = ws.WebHandler.MaxEntries()
+	}
+	ws.streams[clientID] = newClientStream(emit, limit)
+}
+
+// unregisterStream 移除客户端的推送状态
+func (ws *WebSocketServer) unregisterStream(clientID string) {
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+	delete(ws.streams, clientID)
+}
+
+// syncEntries 处理客户端的traffic_entries请求：查询offsetID之后的条目并发送，再切换为实时推送
+// 整个过程持有streamMu，期间的广播会进入pending，不会与同步结果交错
+func (ws *WebSocketServer) syncEntries(clientID string, offsetID string) int {
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+
+	entries := []*handlers.TrafficEntry{}
+	if ws.WebHandler != nil {
+		if offsetID == "" {
+			entries = ws.WebHandler.GetEntries()
+		} else {
+			entries = ws.WebHandler.GetEntriesAfterID(offsetID)
+		}
+	}
+
+	stream, ok := ws.streams[clientID]
+	if !ok {
+		return 0
+	}
+	if offsetID == "" {
+		// 全量同步会替换客户端的列表，之前的发送记录和尚未发送的推送不再有效
+		stream.invalidate()
+	}
+	// 等待正在发送的批次结束，保证同步结果在其之后到达
+	stream.emitMu.Lock()
+	defer stream.emitMu.Unlock()
+
+	synced := make(map[string]uint64, len(entries))
+	for _, entry := range entries {
+		stream.markDelivered(entry)
+		synced[entry.ID] = entry.Seq
+	}
+	stream.dropSyncedFromQueue(synced)
+	stream.emit(EventTrafficEntries, entries)
+
+	// 补发同步期间到达、且比同步结果更新的条目，按Seq顺序发送
+	pending := make([]*handlers.TrafficEntry, 0, len(stream.pending))
+	for _, entry := range stream.pending {
+		pending = append(pending, entry)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Seq < pending[j].Seq })
+	for _, entry := range pending {
+		if stream.isNewer(entry) {
+			stream.markDelivered(entry)
+			stream.emit(EventTrafficNewEntry, entry)
+		}
+	}
+	stream.pending = make(map[string]*handlers.TrafficEntry)
+	stream.ready = true
+
+	return len(entries)
+}
+
+// publishEntry 将条目推送给所有已同步的客户端，未同步的客户端先暂存
+// 返回实际推送的客户端数
+func (ws *WebSocketServer) publishEntry(entry *handlers.TrafficEntry) int {
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+
+	sent := 0
+	for _, stream := range ws.streams {
+		if !stream.ready {
+			if prev, ok := stream.pending[entry.ID]; !ok || entry.Seq > prev.Seq {
+				stream.pending[entry.ID] = entry
+			}
+			continue
+		}
+		if stream.isNewer(entry) {
+			stream.enqueue(entry, ws.batchSize()*maxQueuedBatches)
+			sent++
+		}
+	}
+	if sent > 0 {
+		ws.scheduleFlushLocked()
+	}
+	return sent
+}
+
+// scheduleFlushLocked 在BatchInterval后发送各客户端积攒的条目，已有等待中的发送时不重复安排
+// 调用方需持有streamMu
+func (ws *WebSocketServer) scheduleFlushLocked() {
+	if ws.flushTimer == nil {
+		ws.flushTimer = time.AfterFunc(ws.batchInterval(), ws.flush)
+	}
+}
+
+// flush 把每个空闲客户端的队列交给发送goroutine；上一批仍在发送的慢客户端继续在队列中合并
+func (ws *WebSocketServer) flush() {
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+	ws.flushTimer = nil
+
+	for clientID, stream := range ws.streams {
+		if stream.dropped > 0 {
+			log.Printf("WebSocket 客户端 %s 接收过慢，已丢弃 %d 条实时推送", clientID, stream.dropped)
+			stream.dropped = 0
+		}
+		if stream.sending || len(stream.queue) == 0 {
+			continue
+		}
+		stream.sending = true
+		batch := stream.takeQueue()
+		for _, entry := range batch {
+			stream.inflight[entry.ID] = entry.Seq
+		}
+		go ws.sendBatch(stream, batch, stream.generation.Load())
+	}
+}
+
+// sendBatch 发送一批条目：只有一条时仍使用traffic_new_entry事件，否则按BatchSize分组发送traffic_new_entries
+// 取出批次后客户端又经历了全量同步或清空时，整批丢弃
+func (ws *WebSocketServer) sendBatch(stream *clientStream, batch []*handlers.TrafficEntry, generation uint64) {
+	stream.emitMu.Lock()
+	current := stream.generation.Load() == generation
+	if current {
+		if len(stream.removed) > 0 {
+			kept := make([]*handlers.TrafficEntry, 0, len(batch))
+			for _, entry := range batch {
+				if !stream.removed[entry.ID] {
+					kept = append(kept, entry)
+				}
+			}
+			batch = kept
+		}
+		ws.emitBatch(stream, batch)
+	}
+	stream.removed = nil
+	stream.emitMu.Unlock()
+
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+	if current && stream.generation.Load() == generation {
+		for _, entry := range batch {
+			seq, ok := stream.inflight[entry.ID]
+			if !ok {
+				// 发送期间条目已被删除
+				continue
+			}
+			stream.markDelivered(entry)
+			if seq == entry.Seq {
+				delete(stream.inflight, entry.ID)
+			}
+		}
+	}
+	stream.sending = false
+	if len(stream.queue) > 0 {
+		ws.scheduleFlushLocked()
+	}
+}
+
+// emitBatch 发送一批条目，调用方需持有stream.emitMu
+func (ws *WebSocketServer) emitBatch(stream *clientStream, batch []*handlers.TrafficEntry) {
+	if len(batch) == 1 {
+		stream.emit(EventTrafficNewEntry, batch[0])
+		return
+	}
+	size := ws.batchSize()
+	for start := 0; start < len(batch); start += size {
+		end := start + size
+		if end > len(batch) {
+			end = len(batch)
+		}
+		stream.emit(EventTrafficNewEntries, batch[start:end])
+	}
+}
+
+// resetStreams 在清空流量后重置所有客户端的发送记录，并通知客户端清空
+// traffic_clear与实时推送经过同一个emitMu发送，清空前已取出的批次不会在其之后到达
+func (ws *WebSocketServer) resetStreams() {
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+
+	for _, stream := range ws.streams {
+		stream.pending = make(map[string]*handlers.TrafficEntry)
+		stream.invalidate()
+		stream.emitMu.Lock()
+		stream.emit(EventTrafficClear, nil)
+		stream.emitMu.Unlock()
+	}
+}
+
+// removeEntries 在按条件删除条目后从所有客户端的暂存、队列和发送记录中移除这些条目，并通知已同步的客户端
+// traffic_deleted与实时推送经过同一个emitMu发送，删除前已取出的批次会跳过被删除的条目
+func (ws *WebSocketServer) removeEntries(ids []string) {
+	removed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+	}
+
+	ws.streamMu.Lock()
+	defer ws.streamMu.Unlock()
+
+	for _, stream := range ws.streams {
+		stream.removeFromQueue(removed)
+		stream.emitMu.Lock()
+		for _, id := range ids {
+			delete(stream.pending, id)
+			delete(stream.delivered, id)
+			if _, ok := stream.inflight[id]; ok {
+				delete(stream.inflight, id)
+				if stream.removed == nil {
+					stream.removed = make(map[string]bool)
+				}
+				stream.removed[id] = true
+			}
+		}
+		// 未同步的客户端之后的同步结果中不会包含已删除的条目
+		if stream.ready {
+			stream.emit(EventTrafficDeleted, ids)
+		}
+		stream.emitMu.Unlock()
+	}
+}
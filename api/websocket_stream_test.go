@@ -0,0 +1,380 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingClient 记录发送给模拟客户端的条目，按到达顺序保存
+type recordingClient struct {
+	mu        sync.Mutex
+	delivered []*handlers.TrafficEntry
+	synced    []*handlers.TrafficEntry
+	emits     int // 实时推送事件的次数
+}
+
+func (c *recordingClient) emit(event string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch event {
+	case EventTrafficEntries:
+		entries := args[0].([]*handlers.TrafficEntry)
+		c.synced = append(c.synced, entries...)
+		c.delivered = append(c.delivered, entries...)
+	case EventTrafficNewEntry:
+		c.delivered = append(c.delivered, args[0].(*handlers.TrafficEntry))
+		c.emits++
+	case EventTrafficNewEntries:
+		c.delivered = append(c.delivered, args[0].([]*handlers.TrafficEntry)...)
+		c.emits++
+	}
+}
+
+func (c *recordingClient) snapshot() ([]*handlers.TrafficEntry, []*handlers.TrafficEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*handlers.TrafficEntry(nil), c.delivered...), append([]*handlers.TrafficEntry(nil), c.synced...)
+}
+
+// latest 返回客户端看到的每个条目的最终状态
+func (c *recordingClient) latest() map[string]*handlers.TrafficEntry {
+	delivered, _ := c.snapshot()
+	result := make(map[string]*handlers.TrafficEntry)
+	for _, entry := range delivered {
+		result[entry.ID] = entry
+	}
+	return result
+}
+
+func simulateTraffic(handler *handlers.WebHandler, count int) {
+	for i := 0; i < count; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/path", nil)
+		reqCtx := &proxy.RequestContext{
+			Request:   req,
+			StartTime: time.Now(),
+			TargetURL: "http://example.com/path",
+			UserData:  make(map[string]interface{}),
+		}
+		handler.OnRequest(reqCtx)
+
+		resp := &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewBufferString("ok")),
+		}
+		handler.OnResponse(&proxy.ResponseContext{Response: resp, ReqCtx: reqCtx})
+	}
+}
+
+func TestWebSocketReconnectDuringTraffic(t *testing.T) {
+	handler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	ws, err := NewWebSocketServer(handler)
+	require.NoError(t, err)
+	handler.SetNewEntryCallback(ws.BroadcastNewEntry)
+
+	const total = 200
+	trafficDone := make(chan struct{})
+	go func() {
+		defer close(trafficDone)
+		simulateTraffic(handler, total)
+	}()
+
+	// 第一个连接：全量同步后接收一段时间的实时推送，然后断开
+	first := &recordingClient{}
+	ws.registerStream("first", first.emit)
+	ws.syncEntries("first", "")
+	require.Eventually(t, func() bool {
+		return len(first.latest()) >= 20
+	}, 10*time.Second, time.Millisecond)
+	ws.unregisterStream("first")
+
+	lastSeen := int64(0)
+	for id := range first.latest() {
+		value, err := strconv.ParseInt(id, 10, 64)
+		require.NoError(t, err)
+		if value > lastSeen {
+			lastSeen = value
+		}
+	}
+
+	// 重连：流量仍在持续，注册后先有广播进入，再以最后看到的ID同步
+	second := &recordingClient{}
+	ws.registerStream("second", second.emit)
+	time.Sleep(5 * time.Millisecond)
+	ws.syncEntries("second", strconv.FormatInt(lastSeen, 10))
+
+	<-trafficDone
+	require.Eventually(t, func() bool {
+		latest := second.latest()
+		for i := lastSeen + 1; i <= int64(total); i++ {
+			entry, ok := latest[strconv.FormatInt(i, 10)]
+			if !ok || entry.StatusCode != http.StatusOK {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 5*time.Millisecond)
+
+	delivered, synced := second.snapshot()
+
+	// 同步结果只包含lastSeen之后的条目
+	for _, entry := range synced {
+		value, err := strconv.ParseInt(entry.ID, 10, 64)
+		require.NoError(t, err)
+		assert.Greater(t, value, lastSeen)
+	}
+
+	// 同一条目的每次推送Seq严格递增：同步与实时推送没有重叠，也不会用旧状态覆盖新状态
+	lastSeq := make(map[string]uint64)
+	for _, entry := range delivered {
+		if prev, ok := lastSeq[entry.ID]; ok {
+			assert.Greater(t, entry.Seq, prev, "entry %s delivered twice or out of order", entry.ID)
+		}
+		lastSeq[entry.ID] = entry.Seq
+	}
+}
+
+func TestWebSocketSyncHoldsBackBroadcastUntilSynced(t *testing.T) {
+	handler, err := handlers.NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	ws, err := NewWebSocketServer(handler)
+	require.NoError(t, err)
+
+	client := &recordingClient{}
+	ws.registerStream("client", client.emit)
+
+	pending := &handlers.TrafficEntry{ID: "1", Seq: 2, StatusCode: http.StatusOK}
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "1", Seq: 1})
+	ws.BroadcastNewEntry(pending)
+	delivered, _ := client.snapshot()
+	assert.Empty(t, delivered)
+
+	ws.syncEntries("client", "")
+	delivered, _ = client.snapshot()
+	require.Len(t, delivered, 1)
+	assert.Same(t, pending, delivered[0])
+
+	// 旧版本或重复的推送会被丢弃
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "1", Seq: 1})
+	ws.BroadcastNewEntry(pending)
+	delivered, _ = client.snapshot()
+	assert.Len(t, delivered, 1)
+}
+
+func TestWebSocketBatchesRapidEntries(t *testing.T) {
+	ws, err := NewWebSocketServer(nil)
+	require.NoError(t, err)
+	ws.BatchInterval = 20 * time.Millisecond
+	ws.BatchSize = 30
+
+	client := &recordingClient{}
+	ws.registerStream("client", client.emit)
+	ws.syncEntries("client", "")
+
+	const total = 100
+	for i := 1; i <= total; i++ {
+		ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: strconv.Itoa(i), Seq: uint64(i)})
+	}
+	// 同一条目在同一批次中的更新合并为最新版本
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "1", Seq: total + 1, StatusCode: http.StatusOK})
+
+	require.Eventually(t, func() bool {
+		return len(client.latest()) == total
+	}, 5*time.Second, 5*time.Millisecond)
+
+	client.mu.Lock()
+	emits, delivered := client.emits, len(client.delivered)
+	client.mu.Unlock()
+	assert.Less(t, emits, total)
+	assert.GreaterOrEqual(t, emits, total/ws.BatchSize)
+	assert.Equal(t, total, delivered)
+	assert.Equal(t, http.StatusOK, client.latest()["1"].StatusCode)
+}
+
+func TestWebSocketSingleEntryUsesPerEntryEvent(t *testing.T) {
+	ws, err := NewWebSocketServer(nil)
+	require.NoError(t, err)
+	ws.BatchInterval = time.Millisecond
+
+	var events []string
+	var mu sync.Mutex
+	ws.registerStream("client", func(event string, args ...interface{}) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	ws.syncEntries("client", "")
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "1", Seq: 1})
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{EventTrafficEntries, EventTrafficNewEntry}, events)
+}
+
+func TestWebSocketClearDiscardsStaleBatch(t *testing.T) {
+	ws, err := NewWebSocketServer(nil)
+	require.NoError(t, err)
+	ws.BatchInterval = time.Millisecond
+
+	var events []string
+	var mu sync.Mutex
+	ws.registerStream("client", func(event string, args ...interface{}) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	ws.syncEntries("client", "")
+	stream := ws.streams["client"]
+
+	// 阻塞发送，让批次在清空之前被取出但尚未发出
+	stream.emitMu.Lock()
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "1", Seq: 1})
+	require.Eventually(t, func() bool {
+		ws.streamMu.Lock()
+		defer ws.streamMu.Unlock()
+		return stream.sending
+	}, 5*time.Second, time.Millisecond)
+
+	generation := stream.generation.Load()
+	cleared := make(chan struct{})
+	go func() {
+		defer close(cleared)
+		ws.BroadcastClearTraffic()
+	}()
+	require.Eventually(t, func() bool {
+		return stream.generation.Load() != generation
+	}, 5*time.Second, time.Millisecond)
+	stream.emitMu.Unlock()
+	<-cleared
+
+	require.Eventually(t, func() bool {
+		ws.streamMu.Lock()
+		defer ws.streamMu.Unlock()
+		return !stream.sending
+	}, 5*time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{EventTrafficEntries, EventTrafficClear}, events)
+	mu.Unlock()
+	assert.Empty(t, stream.delivered)
+}
+
+func TestWebSocketDeleteSkipsRemovedEntriesInFlight(t *testing.T) {
+	ws, err := NewWebSocketServer(nil)
+	require.NoError(t, err)
+	ws.BatchInterval = time.Millisecond
+
+	// 按到达顺序记录事件名和涉及的条目ID
+	var log []string
+	var mu sync.Mutex
+	ws.registerStream("client", func(event string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch event {
+		case EventTrafficNewEntry:
+			log = append(log, event+":"+args[0].(*handlers.TrafficEntry).ID)
+		case EventTrafficNewEntries:
+			for _, entry := range args[0].([]*handlers.TrafficEntry) {
+				log = append(log, event+":"+entry.ID)
+			}
+		case EventTrafficDeleted:
+			for _, id := range args[0].([]string) {
+				log = append(log, event+":"+id)
+			}
+		}
+	})
+	ws.syncEntries("client", "")
+	stream := ws.streams["client"]
+
+	// 阻塞发送，让包含条目1、2的批次在删除之前被取出但尚未发出
+	stream.emitMu.Lock()
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "1", Seq: 1})
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "2", Seq: 2})
+	require.Eventually(t, func() bool {
+		ws.streamMu.Lock()
+		defer ws.streamMu.Unlock()
+		return stream.sending
+	}, 5*time.Second, time.Millisecond)
+	// 条目3仍在队列中等待下一批
+	ws.BroadcastNewEntry(&handlers.TrafficEntry{ID: "3", Seq: 3})
+
+	deleted := make(chan struct{})
+	go func() {
+		defer close(deleted)
+		ws.BroadcastDeletedEntries([]string{"1", "3"})
+	}()
+	require.Eventually(t, func() bool {
+		if ws.streamMu.TryLock() {
+			ws.streamMu.Unlock()
+			return false
+		}
+		return true
+	}, 5*time.Second, time.Millisecond)
+	stream.emitMu.Unlock()
+	<-deleted
+
+	require.Eventually(t, func() bool {
+		ws.streamMu.Lock()
+		defer ws.streamMu.Unlock()
+		return !stream.sending && len(stream.queue) == 0
+	}, 5*time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.True(t, len(log) > 0 && (log[0] == EventTrafficNewEntry+":2" || log[1] == EventTrafficNewEntries+":2"))
+	assert.NotContains(t, log, EventTrafficNewEntry+":3")
+	assert.NotContains(t, log, EventTrafficNewEntries+":3")
+	deletedAt := -1
+	for i, line := range log {
+		if line == EventTrafficDeleted+":1" {
+			deletedAt = i
+		}
+	}
+	require.NotEqual(t, -1, deletedAt)
+	for _, line := range log[deletedAt:] {
+		assert.NotEqual(t, EventTrafficNewEntries+":1", line, "deleted entry must not arrive after traffic_deleted")
+		assert.NotEqual(t, EventTrafficNewEntry+":1", line, "deleted entry must not arrive after traffic_deleted")
+	}
+	assert.NotContains(t, stream.delivered, "1")
+}
+
+func TestClientStreamDropsOldestWhenSlow(t *testing.T) {
+	stream := newClientStream(func(string, ...interface{}) {}, defaultDeliveredLimit)
+	stream.delivered["1"] = 0
+	for i := 1; i <= 5; i++ {
+		stream.enqueue(&handlers.TrafficEntry{ID: strconv.Itoa(i), Seq: uint64(i)}, 3)
+	}
+	stream.enqueue(&handlers.TrafficEntry{ID: "4", Seq: 6}, 3)
+
+	batch := stream.takeQueue()
+	require.Len(t, batch, 3)
+	assert.Equal(t, []string{"3", "4", "5"}, []string{batch[0].ID, batch[1].ID, batch[2].ID})
+	assert.Equal(t, uint64(6), batch[1].Seq)
+	assert.Equal(t, 2, stream.dropped)
+	// 被丢弃的条目不算已发送，下一次同步会重新发送
+	assert.NotContains(t, stream.delivered, "1")
+}
+
+func TestClientStreamPrunesDelivered(t *testing.T) {
+	stream := newClientStream(func(string, ...interface{}) {}, 10)
+	for i := 1; i <= 100; i++ {
+		stream.markDelivered(&handlers.TrafficEntry{ID: strconv.Itoa(i), Seq: uint64(i)})
+	}
+	assert.LessOrEqual(t, len(stream.delivered), 20)
+	assert.Contains(t, stream.delivered, "100")
+	assert.NotContains(t, stream.delivered, "1")
+}
@@ -1,12 +1,18 @@
 package api
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/LubyRuffy/ProxyCraft/proxy"
 	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWebSocketServerFormatRequestDetailsJSON(t *testing.T) {
@@ -57,3 +63,77 @@ func TestWebSocketServerFormatResponseDetailsText(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, "ok", bodyValue)
 }
+
+// emittedEvent 记录handleDetailsEvent发回客户端的一个事件
+type emittedEvent struct {
+	name    string
+	payload interface{}
+}
+
+func TestWebSocketTrafficEntryEvent(t *testing.T) {
+	webHandler, err := handlers.NewWebHandlerWithStorage(false, "", handlers.StorageMemory)
+	require.NoError(t, err)
+	ws := &WebSocketServer{WebHandler: webHandler}
+
+	reqBody := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	req, _ := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	reqCtx := &proxy.RequestContext{Request: req, StartTime: time.Now(), TargetURL: req.URL.String(), UserData: map[string]interface{}{}}
+	webHandler.OnRequest(reqCtx)
+	largeBody := bytes.Repeat([]byte("a"), maxDetailsBodySize+1)
+	webHandler.OnResponse(&proxy.ResponseContext{ReqCtx: reqCtx, Response: &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       io.NopCloser(bytes.NewReader(largeBody)),
+	}})
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	id := entries[0].ID
+
+	var events []emittedEvent
+	emit := func(event string, args ...interface{}) {
+		events = append(events, emittedEvent{name: event, payload: args[0]})
+	}
+
+	// 参数可以是ID字符串，也可以是 {"id": "..."}
+	ws.handleDetailsEvent(EventTrafficEntry, []interface{}{map[string]interface{}{"id": id}}, emit)
+	require.Len(t, events, 1)
+	assert.Equal(t, EventTrafficEntry, events[0].name)
+	payload := events[0].payload.(map[string]interface{})
+	assert.Equal(t, id, payload["id"])
+	assert.Equal(t, id, payload["entry"].(*handlers.TrafficEntry).ID)
+
+	request := payload["request"].(map[string]interface{})
+	assert.Equal(t, "gpt-4o", request["body"].(map[string]interface{})["model"])
+	llm, ok := request["llm"].(*LLMExtracted)
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4o", llm.Model)
+
+	// 超过阈值的消息体只返回占位文本
+	response := payload["response"].(map[string]interface{})
+	assert.Equal(t, fmt.Sprintf("<Large response body, %d bytes>", len(largeBody)), response["body"])
+
+	ws.handleDetailsEvent(EventRequestDetails, []interface{}{id}, emit)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventRequestDetails, events[1].name)
+	assert.Equal(t, id, events[1].payload.(map[string]interface{})["id"])
+
+	ws.handleDetailsEvent(EventResponseDetails, []interface{}{"missing"}, emit)
+	require.Len(t, events, 3)
+	assert.Equal(t, EventError, events[2].name)
+	assert.Equal(t, "missing", events[2].payload.(map[string]string)["id"])
+}
+
+func TestWebSocketServerFormatResponseDetailsDecodesCharset(t *testing.T) {
+	ws := &WebSocketServer{}
+	entry := &handlers.TrafficEntry{
+		ID:              "gbk-1",
+		StatusCode:      200,
+		ContentType:     "text/plain; charset=gbk",
+		ResponseHeaders: http.Header{"Content-Type": []string{"text/plain; charset=gbk"}},
+		ResponseBody:    []byte{0xc4, 0xe3, 0xba, 0xc3}, // GBK编码的"你好"
+	}
+
+	details := ws.formatResponseDetails(entry)
+	assert.Equal(t, "你好", details["body"])
+}
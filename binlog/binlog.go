@@ -0,0 +1,177 @@
+// Package binlog implements ProxyCraft's compact binary capture format.
+//
+// A capture file is a sequence of sessions. Each session starts with a short
+// magic header followed by a gob stream of Record values, so gob type
+// information is written once per session instead of once per record and
+// bodies are stored as raw bytes rather than base64 text. Appending to an
+// existing file simply starts a new session. HAR and JSONL remain the
+// interoperable formats; use ConvertToHAR to turn a capture into HAR.
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// magic starts every session. A gob message never starts with a zero byte,
+// so the header cannot be mistaken for a record.
+var magic = []byte("\x00PXCB\x01")
+
+// Record is one captured transaction.
+type Record struct {
+	StartTime time.Time
+	Duration  time.Duration
+
+	Method         string
+	URL            string
+	Proto          string
+	RemoteAddr     string // client address, used as the HAR connection id
+	RequestHeader  http.Header
+	RequestBody    []byte
+	RequestSize    int64 // body size on the wire; may exceed len(RequestBody) when bodies are not stored
+	StatusCode     int   // 0 when the transaction failed before a response
+	Status         string
+	ResponseProto  string
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	ResponseSize   int64
+
+	IsHTTPS     bool
+	IsSSE       bool
+	IsWebSocket bool
+
+	Error     string
+	ErrorKind string
+}
+
+// Writer appends records to an io.Writer. It is safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	encoder *gob.Encoder
+}
+
+// NewWriter starts a new session on w. Each record is written with a single
+// Write call, so w needs no buffering and nothing is lost on a crash.
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := w.Write(magic); err != nil {
+		return nil, fmt.Errorf("failed to write binlog header: %w", err)
+	}
+	return &Writer{w: w, encoder: gob.NewEncoder(w)}, nil
+}
+
+// Write appends one record.
+func (w *Writer) Write(record *Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.encoder.Encode(record)
+}
+
+// Reader reads records written by one or more Writer sessions.
+type Reader struct {
+	r       *bufio.Reader
+	decoder *gob.Decoder
+	current recordReader // bytes consumed by the record being decoded
+	skipped int
+}
+
+// recordReader keeps the bytes read by the gob decoder so that a corrupted
+// record can be scanned again for the start of the next session.
+type recordReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func (rr *recordReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+func (rr *recordReader) ReadByte() (byte, error) {
+	b, err := rr.r.ReadByte()
+	if err == nil {
+		rr.buf = append(rr.buf, b)
+	}
+	return b, err
+}
+
+// NewReader returns a Reader for r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ErrNotBinlog is returned when the input does not start with a binlog header.
+var ErrNotBinlog = errors.New("not a ProxyCraft binary capture")
+
+// Next returns the next record, or io.EOF after the last one. When a record
+// cannot be decoded, e.g. because a crash cut it short and a later run
+// appended a new session, the rest of its session is skipped and reading
+// resumes at the next session header; see Skipped. A damaged record with no
+// session after it is reported as io.ErrUnexpectedEOF when it was cut short.
+func (r *Reader) Next() (*Record, error) {
+	header, err := r.r.Peek(len(magic))
+	if len(header) == 0 && errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if bytes.Equal(header, magic) {
+		_, _ = r.r.Discard(len(magic))
+		// recordReader is an io.ByteReader, so the decoder never reads past a record
+		r.current = recordReader{r: r.r}
+		r.decoder = gob.NewDecoder(&r.current)
+		return r.Next()
+	}
+	if r.decoder == nil {
+		return nil, ErrNotBinlog
+	}
+
+	var record Record
+	r.current.buf = r.current.buf[:0]
+	if err := r.decoder.Decode(&record); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = fmt.Errorf("invalid binlog record: %w", err)
+		}
+		if !r.resync() {
+			return nil, err
+		}
+		r.skipped++
+		return r.Next()
+	}
+	return &record, nil
+}
+
+// Skipped returns the number of damaged sessions skipped by Next.
+func (r *Reader) Skipped() int {
+	return r.skipped
+}
+
+// resync scans the bytes after the start of the damaged record for the next
+// session header and leaves the reader positioned on it. It reports false
+// when the input ends first.
+func (r *Reader) resync() bool {
+	var rest []byte
+	if len(r.current.buf) > 1 {
+		rest = append(rest, r.current.buf[1:]...)
+	}
+	r.r = bufio.NewReader(io.MultiReader(bytes.NewReader(rest), r.r))
+	r.decoder = nil
+	for {
+		header, err := r.r.Peek(len(magic))
+		if bytes.Equal(header, magic) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+		_, _ = r.r.Discard(1)
+	}
+}
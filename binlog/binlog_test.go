@@ -0,0 +1,172 @@
+package binlog
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecords() []*Record {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []*Record{
+		{
+			StartTime:      start,
+			Duration:       120 * time.Millisecond,
+			Method:         http.MethodPost,
+			URL:            "https://api.example.com/v1/items?page=2",
+			Proto:          "HTTP/1.1",
+			RemoteAddr:     "127.0.0.1:50000",
+			RequestHeader:  http.Header{"Content-Type": {"application/json"}},
+			RequestBody:    []byte(`{"name":"item"}`),
+			RequestSize:    15,
+			StatusCode:     http.StatusCreated,
+			Status:         "201 Created",
+			ResponseProto:  "HTTP/2.0",
+			ResponseHeader: http.Header{"Content-Type": {"application/json"}},
+			ResponseBody:   []byte(`{"id":1}`),
+			ResponseSize:   8,
+			IsHTTPS:        true,
+		},
+		{
+			StartTime:      start.Add(time.Second),
+			Duration:       time.Millisecond,
+			Method:         http.MethodGet,
+			URL:            "http://example.com/video.mp4",
+			Proto:          "HTTP/1.1",
+			RequestSize:    2048,
+			StatusCode:     http.StatusOK,
+			Status:         "200 OK",
+			ResponseProto:  "HTTP/1.1",
+			ResponseHeader: http.Header{"Content-Type": {"video/mp4"}},
+			ResponseSize:   4 << 20,
+		},
+		{
+			StartTime: start.Add(2 * time.Second),
+			Method:    http.MethodGet,
+			URL:       "http://unreachable.test/",
+			Proto:     "HTTP/1.1",
+			Error:     "dial tcp: lookup unreachable.test: no such host; retried",
+			ErrorKind: "dns",
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	records := testRecords()
+	var buf bytes.Buffer
+	// Two sessions appended to the same file, as after a restart
+	for _, session := range [][]*Record{records[:2], records[2:]} {
+		writer, err := NewWriter(&buf)
+		require.NoError(t, err)
+		for _, record := range session {
+			require.NoError(t, writer.Write(record))
+		}
+	}
+
+	reader := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, want := range records {
+		got, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	t.Run("truncated", func(t *testing.T) {
+		reader := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-5]))
+		var err error
+		for i := 0; i < len(records) && err == nil; i++ {
+			_, err = reader.Next()
+		}
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("damaged session followed by a new one", func(t *testing.T) {
+		var damaged bytes.Buffer
+		writer, err := NewWriter(&damaged)
+		require.NoError(t, err)
+		for _, record := range records[:2] {
+			require.NoError(t, writer.Write(record))
+		}
+		damaged.Truncate(damaged.Len() - 5)
+		writer, err = NewWriter(&damaged)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(records[2]))
+
+		reader := NewReader(bytes.NewReader(damaged.Bytes()))
+		for _, want := range []*Record{records[0], records[2]} {
+			got, err := reader.Next()
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+		_, err = reader.Next()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, 1, reader.Skipped())
+	})
+
+	t.Run("not a binlog", func(t *testing.T) {
+		_, err := NewReader(bytes.NewReader([]byte(`{"log":{}}`))).Next()
+		assert.ErrorIs(t, err, ErrNotBinlog)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := NewReader(bytes.NewReader(nil)).Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestConvertToHAR(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf)
+	require.NoError(t, err)
+	for _, record := range testRecords() {
+		require.NoError(t, writer.Write(record))
+	}
+
+	path := filepath.Join(t.TempDir(), "capture.har")
+	logger := harlogger.NewLogger(path, "test", "1.0")
+	count, err := ConvertToHAR(bytes.NewReader(buf.Bytes()), logger)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	require.NoError(t, logger.Close())
+
+	har, err := harlogger.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, har.Log.Entries, 3)
+
+	entry := har.Log.Entries[0]
+	assert.Equal(t, "https://api.example.com/v1/items?page=2", entry.Request.URL)
+	assert.Equal(t, http.MethodPost, entry.Request.Method)
+	require.NotNil(t, entry.Request.PostData)
+	assert.Equal(t, `{"name":"item"}`, entry.Request.PostData.Text)
+	assert.Equal(t, http.StatusCreated, entry.Response.Status)
+	assert.Equal(t, "HTTP/2.0", entry.Response.HTTPVersion)
+	assert.Equal(t, `{"id":1}`, entry.Response.Content.Text)
+	assert.Equal(t, "127.0.0.1:50000", entry.Connection)
+	assert.Contains(t, entry.Comment, "_mode: mitm")
+
+	// Bodies that were not stored keep their size
+	entry = har.Log.Entries[1]
+	assert.Equal(t, int64(4<<20), entry.Response.BodySize)
+	assert.Equal(t, int64(2048), entry.Request.BodySize)
+	assert.Empty(t, entry.Response.Content.Text)
+
+	entry = har.Log.Entries[2]
+	assert.Equal(t, 0, entry.Response.Status)
+	assert.Contains(t, entry.Comment, "error: dial tcp: lookup unreachable.test: no such host, retried")
+	assert.Contains(t, entry.Comment, "error_kind: dns")
+
+	t.Run("truncated keeps complete entries", func(t *testing.T) {
+		logger := harlogger.NewLogger(filepath.Join(t.TempDir(), "partial.har"), "test", "1.0")
+		count, err := ConvertToHAR(bytes.NewReader(buf.Bytes()[:buf.Len()-5]), logger)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Equal(t, 2, count)
+	})
+}
@@ -0,0 +1,103 @@
+package binlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+)
+
+// ConvertToHAR reads every record from r and adds it to logger, returning the
+// number of records converted. Records read before an error are kept in logger.
+// Damaged sessions are skipped with a log message, see Reader.Next.
+func ConvertToHAR(r io.Reader, logger *harlogger.Logger) (int, error) {
+	reader := NewReader(r)
+	count := 0
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			if skipped := reader.Skipped(); skipped > 0 {
+				log.Printf("[Binlog] Skipped the damaged remainder of %d session(s)", skipped)
+			}
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := record.addToHAR(logger); err != nil {
+			return count, fmt.Errorf("record %d: %w", count+1, err)
+		}
+		count++
+	}
+}
+
+// addToHAR rebuilds the request and response of the record and adds them to logger.
+func (rec *Record) addToHAR(logger *harlogger.Logger) error {
+	req, err := http.NewRequest(rec.Method, rec.URL, bytes.NewReader(rec.RequestBody))
+	if err != nil {
+		return err
+	}
+	setProto(req, rec.Proto)
+	req.Header = rec.RequestHeader
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.ContentLength = int64(len(rec.RequestBody))
+	req.RemoteAddr = rec.RemoteAddr
+
+	var resp *http.Response
+	if rec.StatusCode != 0 {
+		resp = &http.Response{
+			StatusCode:    rec.StatusCode,
+			Status:        rec.Status,
+			Header:        rec.ResponseHeader,
+			Body:          io.NopCloser(bytes.NewReader(rec.ResponseBody)),
+			ContentLength: int64(len(rec.ResponseBody)),
+			Request:       req,
+		}
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+		if resp.Status == "" {
+			resp.Status = fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode))
+		}
+		resp.Proto = rec.ResponseProto
+		resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(rec.ResponseProto)
+	}
+
+	mode := "http"
+	if rec.IsHTTPS {
+		mode = "mitm"
+	}
+	opts := []harlogger.EntryOption{harlogger.WithAnnotations(
+		harlogger.Annotation{Key: "_mode", Value: mode},
+		harlogger.Annotation{Key: "error", Value: strings.ReplaceAll(rec.Error, ";", ",")},
+		harlogger.Annotation{Key: "error_kind", Value: rec.ErrorKind},
+	)}
+	if rec.RequestBody == nil && rec.RequestSize > 0 {
+		opts = append(opts, func(entry *harlogger.Entry) {
+			entry.Request.BodySize = rec.RequestSize
+		})
+	}
+
+	// Bodies that were not stored keep only their sizes, as with -no-bodies
+	if resp != nil && rec.ResponseBody == nil && rec.ResponseSize > 0 {
+		resp.ContentLength = rec.ResponseSize
+		logger.AddEntryWithoutBody(req, resp, rec.StartTime, rec.Duration, req.URL.Host, rec.RemoteAddr, opts...)
+		return nil
+	}
+	logger.AddEntry(req, resp, rec.StartTime, rec.Duration, req.URL.Host, rec.RemoteAddr, opts...)
+	return nil
+}
+
+// setProto sets the request protocol version, defaulting to HTTP/1.1.
+func setProto(req *http.Request, proto string) {
+	if major, minor, ok := http.ParseHTTPVersion(proto); ok {
+		req.Proto, req.ProtoMajor, req.ProtoMinor = proto, major, minor
+	}
+}
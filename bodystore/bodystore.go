@@ -0,0 +1,139 @@
+// Package bodystore keeps message bodies as content-addressed files.
+//
+// Each body is saved once under its sha256, sharded into subdirectories by
+// the first two hex digits, so identical bodies recorded by different
+// transactions share one file. Files are written to a temporary name and
+// renamed into place, so readers never see a partially written body.
+package bodystore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Store saves bodies under a directory, named by their sha256.
+type Store struct {
+	dir string
+}
+
+// New returns a Store rooted at dir, creating the directory if needed.
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// IsHash reports whether hash is a hex-encoded sha256, the only names Store
+// accepts, so that a hash read from a database or index file cannot point
+// outside the directory.
+func IsHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Path returns the file that holds the body with the given hash.
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Put saves body and returns its sha256. A body that is already stored is
+// not written again; its modification time is refreshed so that Prune does
+// not treat it as an old orphan.
+func (s *Store) Put(body []byte) (string, error) {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	path := s.Path(hash)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return hash, nil
+	}
+	if err := WriteFile(path, body); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Get reads the body with the given hash.
+func (s *Store) Get(hash string) ([]byte, error) {
+	if !IsHash(hash) {
+		return nil, fmt.Errorf("invalid body hash %q", hash)
+	}
+	return os.ReadFile(s.Path(hash))
+}
+
+// Open opens the body with the given hash for streaming.
+func (s *Store) Open(hash string) (*os.File, error) {
+	if !IsHash(hash) {
+		return nil, fmt.Errorf("invalid body hash %q", hash)
+	}
+	return os.Open(s.Path(hash))
+}
+
+// Has reports whether the body with the given hash is stored.
+func (s *Store) Has(hash string) bool {
+	if !IsHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.Path(hash))
+	return err == nil
+}
+
+// Prune removes stored bodies that are not in referenced and were last
+// written more than grace ago, leaving bodies whose references may not have
+// been recorded yet.
+func (s *Store) Prune(referenced map[string]bool, grace time.Duration) {
+	cutoff := time.Now().Add(-grace)
+	_ = filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if referenced[d.Name()] {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("[BodyStore] Failed to remove %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// WriteFile writes data to a temporary file next to path and renames it into
+// place, creating the parent directory if needed.
+func WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
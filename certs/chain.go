@@ -0,0 +1,108 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// LoadCAChain loads the issuers of an intermediate signing CA from a PEM file
+// (intermediate(s), optionally followed by the root) so that generated leaf
+// certificates are served with the full chain. Must be called after the CA is loaded.
+func (m *Manager) LoadCAChain(chainPath string) error {
+	chainPEM, err := os.ReadFile(chainPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA chain file %s: %w", chainPath, err)
+	}
+	return m.loadCAChainPEM(chainPEM, chainPath)
+}
+
+// LoadCAChainPEM is like LoadCAChain but reads the chain from PEM-encoded bytes.
+func (m *Manager) LoadCAChainPEM(chainPEM []byte) error {
+	return m.loadCAChainPEM(chainPEM, "PEM data")
+}
+
+func (m *Manager) loadCAChainPEM(chainPEM []byte, source string) error {
+	caCert, _, _ := m.CA()
+	if caCert == nil {
+		return fmt.Errorf("CA certificate must be loaded before its chain")
+	}
+	if isSelfSigned(caCert) {
+		return fmt.Errorf("CA certificate %q is self-signed; a chain is only needed when signing with an intermediate", caCert.Subject.CommonName)
+	}
+
+	var parsed []*x509.Certificate
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate in CA chain %s: %w", source, err)
+		}
+		parsed = append(parsed, cert)
+	}
+	if len(parsed) == 0 {
+		return fmt.Errorf("no certificates found in CA chain %s", source)
+	}
+
+	// The signing CA comes first, followed by the remaining intermediates in file order.
+	// Self-signed roots are left out: clients must already trust them.
+	chain := []*x509.Certificate{caCert}
+	issuerFound := false
+	for _, cert := range parsed {
+		if bytes.Equal(cert.Raw, caCert.Raw) {
+			continue
+		}
+		if caCert.CheckSignatureFrom(cert) == nil {
+			issuerFound = true
+		}
+		if !isSelfSigned(cert) {
+			chain = append(chain, cert)
+		}
+	}
+	if !issuerFound {
+		return fmt.Errorf("CA chain %s does not contain the issuer of %q", source, caCert.Subject.CommonName)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.CACert != caCert {
+		return fmt.Errorf("CA certificate was replaced while loading its chain")
+	}
+	m.CAChain = chain
+	return nil
+}
+
+// GenerateServerTLSCert generates a certificate for host and returns it ready to
+// serve, i.e. followed by CAChain when the signing CA is an intermediate.
+func (m *Manager) GenerateServerTLSCert(host string) (*tls.Certificate, error) {
+	caCert, caKey, chain := m.CA()
+
+	cert, key, err := m.signServerCert(host, caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCert := &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+	for _, issuer := range chain {
+		tlsCert.Certificate = append(tlsCert.Certificate, issuer.Raw)
+	}
+	return tlsCert, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
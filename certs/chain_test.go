@@ -0,0 +1,103 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCA creates a CA certificate signed by parent, or a self-signed root when parent is nil.
+func newTestCA(t *testing.T, name string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func writePEM(t *testing.T, path string, blocks ...*pem.Block) {
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0600))
+}
+
+func TestLoadCustomCAWithChain(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "Test Intermediate", root, rootKey)
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "intermediate.pem")
+	keyPath := filepath.Join(dir, "intermediate.key")
+	chainPath := filepath.Join(dir, "chain.pem")
+	writePEM(t, certPath, &pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw})
+	writePEM(t, keyPath, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(intermediateKey)})
+	writePEM(t, chainPath,
+		&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw},
+		&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+
+	mgr := &Manager{}
+	require.NoError(t, mgr.LoadCustomCA(certPath, keyPath, chainPath))
+	require.Len(t, mgr.CAChain, 1)
+	assert.Equal(t, intermediate.Raw, mgr.CAChain[0].Raw)
+
+	tlsCert, err := mgr.GenerateServerTLSCert("example.com:443")
+	require.NoError(t, err)
+	require.Len(t, tlsCert.Certificate, 2)
+	assert.Equal(t, tlsCert.Leaf.Raw, tlsCert.Certificate[0])
+	assert.Equal(t, intermediate.Raw, tlsCert.Certificate[1])
+
+	// 只信任根证书时，叶子证书可以通过下发的中间证书验证
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(mgr.CAChain[0])
+	_, err = tlsCert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots, Intermediates: intermediates})
+	assert.NoError(t, err)
+}
+
+func TestLoadCAChainErrors(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "Test Intermediate", root, rootKey)
+	otherRoot, _ := newTestCA(t, "Other Root", nil, nil)
+
+	mgr := &Manager{}
+	assert.Error(t, mgr.LoadCAChainPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})))
+
+	mgr = &Manager{CACert: intermediate, CAKey: intermediateKey}
+	assert.Error(t, mgr.LoadCAChainPEM(nil))
+	assert.Error(t, mgr.LoadCAChainPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherRoot.Raw})))
+	assert.Empty(t, mgr.CAChain)
+
+	selfSigned := &Manager{CACert: root, CAKey: rootKey}
+	assert.Error(t, selfSigned.LoadCAChainPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})))
+
+	tlsCert, err := selfSigned.GenerateServerTLSCert("example.com")
+	require.NoError(t, err)
+	assert.Len(t, tlsCert.Certificate, 1)
+}
@@ -0,0 +1,56 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CAInfo describes the active CA certificate so users can confirm which CA
+// their clients trust.
+type CAInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	SHA256      string    `json:"sha256"`
+	PEM         string    `json:"pem"`
+	ChainLength int       `json:"chainLength"` // intermediate certificates served after each leaf
+}
+
+// Info returns the details of the loaded CA certificate.
+func (m *Manager) Info() (*CAInfo, error) {
+	caCert, _, chain := m.CA()
+	if caCert == nil {
+		return nil, fmt.Errorf("CA certificate not loaded or generated yet")
+	}
+	return &CAInfo{
+		Subject:     caCert.Subject.String(),
+		Issuer:      caCert.Issuer.String(),
+		Serial:      colonHex(caCert.SerialNumber.Bytes()),
+		NotBefore:   caCert.NotBefore,
+		NotAfter:    caCert.NotAfter,
+		SHA256:      Fingerprint(caCert.Raw),
+		PEM:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})),
+		ChainLength: len(chain),
+	}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER certificate as
+// colon-separated upper-case hex, the form shown by browsers and OS
+// certificate viewers.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return colonHex(sum[:])
+}
+
+func colonHex(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -27,6 +27,28 @@ const (
 	rsaBits    = 2048                    // RSA bits
 )
 
+// certDirPath returns the directory where certificates are stored without creating it.
+func certDirPath() (string, error) {
+	if override := strings.TrimSpace(os.Getenv("PROXYCRAFT_CERT_DIR")); override != "" {
+		return filepath.Clean(override), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".proxycraft"), nil
+}
+
+// defaultCACertPath returns the default CA certificate path without creating
+// its directory, or "" when it cannot be determined.
+func defaultCACertPath() string {
+	dir, err := certDirPath()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, caCertFile)
+}
+
 // mustGetCertDir returns the directory where certificates are stored (~/.proxycraft).
 // It creates the directory if it doesn't exist.
 func mustGetCertDir() string {
@@ -88,7 +110,11 @@ func generateToFile(certPath, keyPath string, issuerName string, orgName string,
 	if err != nil {
 		return fmt.Errorf("failed to generate CA: %w", err)
 	}
+	return writeCAFiles(certPath, keyPath, cert, key)
+}
 
+// writeCAFiles saves the CA certificate and its PKCS#8 private key as PEM files.
+func writeCAFiles(certPath, keyPath string, cert *x509.Certificate, key *rsa.PrivateKey) error {
 	// Save CA certificate to file
 	certOut, err := os.Create(certPath)
 	if err != nil {
@@ -117,7 +143,7 @@ func generateToFile(certPath, keyPath string, issuerName string, orgName string,
 }
 
 func IsInstalled() bool {
-	installed, err := isInstalled()
+	installed, err := isInstalled(MustGetCACertPath())
 	if err != nil {
 		log.Fatalf("failed to check if certificate is installed: %v", err)
 	}
@@ -144,7 +170,7 @@ func InstallForce() error {
 	}
 
 	// Install certificate
-	if err := installForce(); err != nil {
+	if err := installForce(certPath); err != nil {
 		return fmt.Errorf("failed to force install certificate: %w", err)
 	}
 
@@ -179,7 +205,7 @@ func Install() error {
 	}
 
 	// 安装证书
-	err := install()
+	err := install(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to install certificate: %w", err)
 	}
@@ -191,7 +217,7 @@ func Install() error {
 // Uninstall uninstalls the CA certificate from the system keychain.
 func Uninstall() error {
 	// 先检查证书是否已经安装
-	installed, err := isInstalled()
+	installed, err := isInstalled(MustGetCACertPath())
 	if err != nil {
 		return fmt.Errorf("failed to check if certificate is installed: %w", err)
 	}
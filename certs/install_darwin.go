@@ -51,10 +51,9 @@ func runWithAdminShell(shellCmd string) (string, error) {
 
 const systemKeychain = "/Library/Keychains/System.keychain"
 
-// isInstalled checks if the exact CA certificate from ~/.proxycraft is already installed and trusted in the system trust store.
-func isInstalled() (bool, error) {
-	// Get the current CA certificate from ~/.proxycraft
-	certPath := MustGetCACertPath()
+// isInstalled checks if the exact CA certificate at certPath is already installed and trusted in the system trust store.
+func isInstalled(certPath string) (bool, error) {
+	// Get the current CA certificate
 	currentCertPEM, err := os.ReadFile(certPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to read current CA certificate: %w", err)
@@ -101,9 +100,9 @@ func isInstalled() (bool, error) {
 // InstallCerts installs the CA certificate to the system trust store on macOS.
 // It requires sudo privileges. If a certificate with the same name but different content exists,
 // it will be removed first to prevent conflicts.
-func install() error {
+func install(certPath string) error {
 	// Check if the exact certificate is already installed
-	installed, err := isInstalled()
+	installed, err := isInstalled(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to check if certificate is installed: %w", err)
 	}
@@ -113,12 +112,10 @@ func install() error {
 		return nil
 	}
 
-	return installForce()
+	return installForce(certPath)
 }
 
-func installForce() error {
-	certPath := MustGetCACertPath()
-
+func installForce(certPath string) error {
 	// On macOS, we need to use the `security` command to manage certificates.
 	// First, remove any existing certificate with the same name to prevent conflicts
 	fmt.Println("Attempting to install CA certificate into system keychain...")
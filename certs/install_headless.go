@@ -7,16 +7,21 @@ import (
 )
 
 // isInstalled checks if the CA certificate is already installed in the system trust store.
-func isInstalled() (bool, error) {
+func isInstalled(certPath string) (bool, error) {
 	return false, nil // Not implemented for this platform
 }
 
 // InstallCerts installs the CA certificate to the system trust store.
 // It requires sudo privileges. If the certificate is already installed, it will skip the installation.
-func install() error {
+func install(certPath string) error {
 	return fmt.Errorf("automatic certificate installation is not supported on this platform")
 }
 
+// installForce installs the CA certificate even if it's already installed.
+func installForce(certPath string) error {
+	return install(certPath)
+}
+
 // uninstall uninstalls the CA certificate from the system trust store.
 // It requires sudo privileges.
 func uninstall() error {
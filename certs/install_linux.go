@@ -22,7 +22,9 @@ var linuxTrustTargets = []linuxTrustTarget{
 	{path: filepath.Join("/etc/pki/ca-trust/source/anchors", "proxycraft-root-ca.pem"), refresh: []string{"update-ca-trust", "extract"}},
 }
 
-func isInstalled() (bool, error) {
+// isInstalled reports whether a ProxyCraft CA has been copied into a system CA directory.
+// The content is compared separately by linuxSystemTrusted.
+func isInstalled(certPath string) (bool, error) {
 	for _, target := range linuxTrustTargets {
 		if fileExists(target.path) {
 			return true, nil
@@ -31,12 +33,11 @@ func isInstalled() (bool, error) {
 	return false, nil
 }
 
-func install() error {
+func install(certPath string) error {
 	if os.Geteuid() != 0 {
 		return fmt.Errorf("installing the root CA requires root privileges; please rerun with sudo")
 	}
 
-	certPath := MustGetCACertPath()
 	var attempted bool
 	var errs []error
 
@@ -66,8 +67,8 @@ func install() error {
 	return errors.Join(errs...)
 }
 
-func installForce() error {
-	return install()
+func installForce(certPath string) error {
+	return install(certPath)
 }
 
 func uninstall() error {
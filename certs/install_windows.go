@@ -3,6 +3,8 @@
 package certs
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -11,8 +13,24 @@ import (
 	"syscall"
 )
 
-func isInstalled() (bool, error) {
-	output, err := runCertutil("-store", "root", IssuerName)
+// isInstalled reports whether the exact certificate at certPath is in the LocalMachine Root store.
+func isInstalled(certPath string) (bool, error) {
+	return storeHasCert(certPath)
+}
+
+// storeHasCert looks the certificate at certPath up in a Root store by its SHA-1 thumbprint,
+// so a stale CA with the same issuer name does not count as installed.
+// Extra arguments such as "-user" select the store.
+func storeHasCert(certPath string, storeArgs ...string) (bool, error) {
+	raw, err := readCACertRaw(certPath)
+	if err != nil {
+		return false, err
+	}
+	sum := sha1.Sum(raw)
+	thumbprint := hex.EncodeToString(sum[:])
+
+	args := append(append([]string(nil), storeArgs...), "-store", "root", thumbprint)
+	output, err := runCertutil(args...)
 	if err != nil {
 		lower := strings.ToLower(output)
 		if strings.Contains(lower, "no certificate matches") || strings.Contains(lower, "cannot find object") {
@@ -20,11 +38,12 @@ func isInstalled() (bool, error) {
 		}
 		return false, err
 	}
-	return strings.Contains(output, IssuerName), nil
+	normalized := strings.ToLower(strings.ReplaceAll(output, " ", ""))
+	return strings.Contains(normalized, thumbprint), nil
 }
 
-func install() error {
-	certPath := filepath.Clean(MustGetCACertPath())
+func install(certPath string) error {
+	certPath = filepath.Clean(certPath)
 	output, err := runCertutil("-addstore", "-f", "root", certPath)
 	if err != nil {
 		lower := strings.ToLower(output)
@@ -36,8 +55,8 @@ func install() error {
 	return nil
 }
 
-func installForce() error {
-	return install()
+func installForce(certPath string) error {
+	return install(certPath)
 }
 
 func uninstall() error {
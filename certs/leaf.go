@@ -0,0 +1,78 @@
+package certs
+
+import (
+	"net"
+	"strings"
+)
+
+// defaultLeafOrganization is the subject Organization of generated leaf
+// certificates when LeafOptions.Organization is empty.
+const defaultLeafOrganization = "ProxyCraft MITM Proxy"
+
+// LeafOptions customizes the certificates produced by GenerateServerCert.
+// The zero value keeps the default subject and SAN set.
+type LeafOptions struct {
+	Organization       []string // Subject O; defaults to "ProxyCraft MITM Proxy"
+	OrganizationalUnit []string // Subject OU; empty by default
+
+	// Added to the SAN set of every leaf, after the names derived from the host.
+	ExtraDNSNames []string
+	ExtraIPs      []net.IP
+}
+
+// AddSANs adds extra subject alternative names, sorting IP addresses into
+// ExtraIPs and everything else into ExtraDNSNames. Empty names are ignored.
+func (o *LeafOptions) AddSANs(names ...string) {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if ip := net.ParseIP(name); ip != nil {
+			o.ExtraIPs = append(o.ExtraIPs, ip)
+		} else {
+			o.ExtraDNSNames = append(o.ExtraDNSNames, name)
+		}
+	}
+}
+
+func (o LeafOptions) organization() []string {
+	if len(o.Organization) > 0 {
+		return o.Organization
+	}
+	return []string{defaultLeafOrganization}
+}
+
+// appendUniqueDNSNames appends the names not already in dnsNames (case-insensitively).
+func appendUniqueDNSNames(dnsNames []string, extra []string) []string {
+	for _, name := range extra {
+		duplicate := false
+		for _, existing := range dnsNames {
+			if strings.EqualFold(existing, name) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	return dnsNames
+}
+
+// appendUniqueIPs appends the addresses not already in ips.
+func appendUniqueIPs(ips []net.IP, extra []net.IP) []net.IP {
+	for _, ip := range extra {
+		duplicate := false
+		for _, existing := range ips {
+			if existing.Equal(ip) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
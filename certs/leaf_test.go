@@ -0,0 +1,58 @@
+package certs
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateServerCertWithLeafOptions(t *testing.T) {
+	mgr, err := NewInMemoryManager()
+	require.NoError(t, err)
+	mgr.Leaf = LeafOptions{
+		Organization:       []string{"Example Corp"},
+		OrganizationalUnit: []string{"Security"},
+	}
+	mgr.Leaf.AddSANs("alt.example.com", " 10.0.0.1 ", "", "example.com")
+
+	cert, _, err := mgr.GenerateServerCert("example.com:443")
+	require.NoError(t, err)
+
+	assert.Equal(t, "example.com", cert.Subject.CommonName)
+	assert.Equal(t, []string{"Example Corp"}, cert.Subject.Organization)
+	assert.Equal(t, []string{"Security"}, cert.Subject.OrganizationalUnit)
+	assert.Contains(t, cert.DNSNames, "example.com")
+	assert.Contains(t, cert.DNSNames, "alt.example.com")
+	// 与主机名重复的附加SAN不会重复写入
+	count := 0
+	for _, name := range cert.DNSNames {
+		if name == "example.com" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+	require.Len(t, cert.IPAddresses, 1)
+	assert.True(t, cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(mgr.CACert)
+	for _, name := range []string{"example.com", "alt.example.com", "10.0.0.1"} {
+		_, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestGenerateServerCertDefaultSubject(t *testing.T) {
+	mgr, err := NewInMemoryManager()
+	require.NoError(t, err)
+
+	cert, _, err := mgr.GenerateServerCert("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{defaultLeafOrganization}, cert.Subject.Organization)
+	assert.Empty(t, cert.Subject.OrganizationalUnit)
+	assert.NotContains(t, cert.DNSNames, "alt.example.com")
+	assert.Empty(t, cert.IPAddresses)
+}
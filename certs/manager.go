@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,12 +20,32 @@ import (
 type Manager struct {
 	CACert *x509.Certificate
 	CAKey  *rsa.PrivateKey
+
+	// CAChain is served after each generated leaf: the signing CA followed by its
+	// issuers, excluding the root. Empty when the CA is a self-signed root.
+	CAChain []*x509.Certificate
+
+	// Leaf customizes the subject and extra SANs of generated leaf certificates.
+	Leaf LeafOptions
+
+	// mu guards the CA fields while RegenerateCA swaps them.
+	mu sync.RWMutex
+
+	// caCertPath and caKeyPath are where RegenerateCA persists a new CA; empty
+	// for in-memory CAs. customCA is set once a user-supplied CA is loaded.
+	caCertPath string
+	caKeyPath  string
+	customCA   bool
+
+	// generation is bumped by RegenerateCA so callers caching leaf
+	// certificates can tell they were signed by a replaced CA.
+	generation uint64
 }
 
 // NewManager creates a new certificate manager.
 // It will try to load existing CA cert/key from ~/.proxycraft, or generate new ones if not found.
 func NewManager() (*Manager, error) {
-	m := &Manager{}
+	m := &Manager{caCertPath: MustGetCACertPath(), caKeyPath: MustGetCAKeyPath()}
 	err := m.loadCA()
 	if err != nil {
 		fmt.Println("CA certificate or key not found, generating new ones...")
@@ -44,6 +65,29 @@ func NewManager() (*Manager, error) {
 	return m, nil
 }
 
+// NewInMemoryManager creates a certificate manager with a freshly generated CA.
+// The CA is kept only in memory; nothing is read from or written to disk.
+func NewInMemoryManager() (*Manager, error) {
+	cert, key, err := generateCA(IssuerName, OrgName, NotAfter)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{CACert: cert, CAKey: key}, nil
+}
+
+// NewManagerFromCA creates a certificate manager from an already loaded CA certificate and key.
+// The CA belongs to the caller, so RegenerateCA refuses to replace it.
+func NewManagerFromCA(cert *x509.Certificate, key *rsa.PrivateKey) (*Manager, error) {
+	if cert == nil || key == nil {
+		return nil, fmt.Errorf("CA certificate and key are required")
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || !pub.Equal(key.Public()) {
+		return nil, fmt.Errorf("CA certificate and key do not match")
+	}
+	return &Manager{CACert: cert, CAKey: key, customCA: true}, nil
+}
+
 // MustGetCACertPath returns the default CA certificate file path.
 func MustGetCACertPath() string {
 	return filepath.Join(mustGetCertDir(), caCertFile)
@@ -97,9 +141,19 @@ func (m *Manager) loadCA() error {
 	return nil
 }
 
+// CA returns a consistent snapshot of the CA certificate, key and chain.
+// Use it instead of reading the fields directly: RegenerateCA may replace
+// them while the proxy is serving.
+func (m *Manager) CA() (*x509.Certificate, *rsa.PrivateKey, []*x509.Certificate) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.CACert, m.CAKey, m.CAChain
+}
+
 // ExportCACert exports the CA certificate to the specified path.
 func (m *Manager) ExportCACert(filePath string) error {
-	if m.CACert == nil {
+	caCert, _, _ := m.CA()
+	if caCert == nil {
 		return fmt.Errorf("CA certificate not loaded or generated yet")
 	}
 	certOut, err := os.Create(filePath)
@@ -108,7 +162,7 @@ func (m *Manager) ExportCACert(filePath string) error {
 	}
 	defer certOut.Close()
 
-	derBytes := m.CACert.Raw
+	derBytes := caCert.Raw
 	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes}); err != nil {
 		return fmt.Errorf("failed to write CA certificate to %s: %w", filePath, err)
 	}
@@ -117,8 +171,16 @@ func (m *Manager) ExportCACert(filePath string) error {
 }
 
 // GenerateServerCert generates a certificate for the given host, signed by the CA.
+// The subject and extra SANs can be customized through m.Leaf.
 func (m *Manager) GenerateServerCert(host string) (*x509.Certificate, *rsa.PrivateKey, error) {
-	if m.CACert == nil || m.CAKey == nil {
+	caCert, caKey, _ := m.CA()
+	return m.signServerCert(host, caCert, caKey)
+}
+
+// signServerCert issues the leaf for host with the given CA, so that callers
+// holding a snapshot of the CA are not affected by a concurrent RegenerateCA.
+func (m *Manager) signServerCert(host string, caCert *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+	if caCert == nil || caKey == nil {
 		return nil, nil, fmt.Errorf("CA certificate or key not loaded")
 	}
 
@@ -161,12 +223,14 @@ func (m *Manager) GenerateServerCert(host string) (*x509.Certificate, *rsa.Priva
 		wildcardHost := "*." + hostname
 		dnsNames = append(dnsNames, wildcardHost)
 	}
+	dnsNames = appendUniqueDNSNames(dnsNames, m.Leaf.ExtraDNSNames)
 
 	template := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
-			CommonName:   hostname, // Important: CN should be the host being impersonated
-			Organization: []string{"ProxyCraft MITM Proxy"},
+			CommonName:         hostname, // Important: CN should be the host being impersonated
+			Organization:       m.Leaf.organization(),
+			OrganizationalUnit: m.Leaf.OrganizationalUnit,
 		},
 		NotBefore:   time.Now().Add(-1 * time.Hour), // Start 1 hour ago for clock skew
 		NotAfter:    time.Now().AddDate(1, 0, 0),    // Valid for 1 year
@@ -179,8 +243,9 @@ func (m *Manager) GenerateServerCert(host string) (*x509.Certificate, *rsa.Priva
 	if ip := net.ParseIP(hostname); ip != nil {
 		template.IPAddresses = []net.IP{ip}
 	}
+	template.IPAddresses = appendUniqueIPs(template.IPAddresses, m.Leaf.ExtraIPs)
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, m.CACert, &privKey.PublicKey, m.CAKey)
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, caCert, &privKey.PublicKey, caKey)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create server certificate for %s: %w", host, err)
 	}
@@ -194,74 +259,132 @@ func (m *Manager) GenerateServerCert(host string) (*x509.Certificate, *rsa.Priva
 }
 
 // LoadCustomCA loads a custom CA certificate and private key from the specified files.
-func (m *Manager) LoadCustomCA(certPath, keyPath string) error {
+// When the CA is an intermediate, chainPath may name a PEM file with its issuers (see LoadCAChain).
+func (m *Manager) LoadCustomCA(certPath, keyPath string, chainPath ...string) error {
 	certPEM, err := os.ReadFile(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to read custom CA cert file %s: %w", certPath, err)
 	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read custom CA key file %s: %w", keyPath, err)
+	}
+
+	if err := m.loadCAFromPEM(certPEM, keyPEM, certPath, keyPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Loaded custom CA certificate from %s and key from %s\n", certPath, keyPath)
+
+	m.CAChain = nil
+	for _, path := range chainPath {
+		if path == "" {
+			continue
+		}
+		if err := m.LoadCAChain(path); err != nil {
+			return err
+		}
+		fmt.Printf("Loaded CA chain from %s (%d certificate(s) served after the leaf)\n", path, len(m.CAChain))
+	}
+	return nil
+}
+
+// LoadCAFromPEM loads a CA certificate and private key from PEM-encoded bytes,
+// e.g. read from environment variables or a secret store. Nothing is read from or written to disk.
+// The key may be PKCS#8 ("PRIVATE KEY") or PKCS#1 ("RSA PRIVATE KEY").
+func (m *Manager) LoadCAFromPEM(certPEM, keyPEM []byte) error {
+	return m.loadCAFromPEM(certPEM, keyPEM, "PEM data", "PEM data")
+}
+
+// loadCAFromPEM parses and validates the CA; certSource and keySource are only used in error messages.
+func (m *Manager) loadCAFromPEM(certPEM, keyPEM []byte, certSource, keySource string) error {
 	block, _ := pem.Decode(certPEM)
 	if block == nil || block.Type != "CERTIFICATE" {
-		return fmt.Errorf("failed to decode PEM block containing certificate from %s", certPath)
+		return fmt.Errorf("failed to decode PEM block containing certificate from %s", certSource)
 	}
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return fmt.Errorf("failed to parse custom CA certificate from %s: %w", certPath, err)
+		return fmt.Errorf("failed to parse custom CA certificate from %s: %w", certSource, err)
 	}
 
-	keyPEM, err := os.ReadFile(keyPath)
-	if err != nil {
-		return fmt.Errorf("failed to read custom CA key file %s: %w", keyPath, err)
-	}
 	block, _ = pem.Decode(keyPEM)
 	if block == nil {
-		return fmt.Errorf("failed to decode PEM block containing private key from %s", keyPath)
+		return fmt.Errorf("failed to decode PEM block containing private key from %s", keySource)
 	}
 
 	// Try to parse the key based on the PEM block type
 	var key interface{}
-	var rsaKey *rsa.PrivateKey
-	var ok bool
-
 	switch block.Type {
 	case "PRIVATE KEY":
 		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
 		if err != nil {
-			return fmt.Errorf("failed to parse PKCS8 private key from %s: %w", keyPath, err)
+			return fmt.Errorf("failed to parse PKCS8 private key from %s: %w", keySource, err)
 		}
 	case "RSA PRIVATE KEY":
 		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
 		if err != nil {
-			return fmt.Errorf("failed to parse PKCS1 private key from %s: %w", keyPath, err)
+			return fmt.Errorf("failed to parse PKCS1 private key from %s: %w", keySource, err)
 		}
 	default:
-		return fmt.Errorf("unsupported key type %s in %s", block.Type, keyPath)
+		return fmt.Errorf("unsupported key type %s in %s", block.Type, keySource)
 	}
 
 	// Convert the key to RSA private key
-	rsaKey, ok = key.(*rsa.PrivateKey)
+	rsaKey, ok := key.(*rsa.PrivateKey)
 	if !ok {
-		return fmt.Errorf("custom CA key is not an RSA private key in %s", keyPath)
+		return fmt.Errorf("custom CA key is not an RSA private key in %s", keySource)
 	}
 
 	// Verify that the key matches the certificate
-	if !cert.PublicKey.(*rsa.PublicKey).Equal(rsaKey.Public()) {
+	certKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || !certKey.Equal(rsaKey.Public()) {
 		return fmt.Errorf("custom CA certificate and key do not match")
 	}
 
 	// Set the certificate and key
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.CACert = cert
 	m.CAKey = rsaKey
-
-	fmt.Printf("Loaded custom CA certificate from %s and key from %s\n", certPath, keyPath)
+	m.customCA = true
+	m.caCertPath, m.caKeyPath = "", ""
 	return nil
 }
 
-// InstallCerts installs the CA certificate to the system trust store.
+// InstallCerts installs the manager's CA certificate to the system trust store.
 func (m *Manager) InstallCerts() error {
-	return Install()
+	return m.installCA(false)
 }
 
-// InstallCertsForce installs the CA certificate even if it's already installed.
+// InstallCertsForce installs the manager's CA certificate even if it's already installed.
 func (m *Manager) InstallCertsForce() error {
-	return InstallForce()
+	return m.installCA(true)
+}
+
+// installCA installs the default CA through Install/InstallForce, which also
+// generate it when missing. Any other CA, such as an in-memory one, is installed
+// from a temporary copy so the OS trusts the CA that actually signs leaf certificates.
+func (m *Manager) installCA(force bool) error {
+	certPath, cleanup, err := m.caCertFile()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if certPath == defaultCACertPath() {
+		if force {
+			return InstallForce()
+		}
+		return Install()
+	}
+	if force {
+		err = installForce(certPath)
+	} else {
+		err = install(certPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to install certificate: %w", err)
+	}
+	fmt.Println("Certificate installed successfully.")
+	return nil
 }
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewManager(t *testing.T) {
@@ -470,3 +471,65 @@ func TestGenerateServerCert_Errors(t *testing.T) {
 	// _, _, err = mgr.GenerateServerCert("invalid@hostname")
 	// assert.Error(t, err) // 期望错误，具体错误信息依赖库实现
 }
+
+func TestNewInMemoryManager_NoFiles(t *testing.T) {
+	certDir := t.TempDir()
+	t.Setenv("PROXYCRAFT_CERT_DIR", filepath.Join(certDir, "certs"))
+	t.Setenv("HOME", certDir)
+
+	mgr, err := NewInMemoryManager()
+	require.NoError(t, err)
+	require.NotNil(t, mgr.CACert)
+	require.NotNil(t, mgr.CAKey)
+	assert.True(t, mgr.CACert.IsCA)
+	assert.Equal(t, IssuerName, mgr.CACert.Subject.CommonName)
+
+	serverCert, _, err := mgr.GenerateServerCert("example.com:443")
+	require.NoError(t, err)
+	assert.NoError(t, serverCert.CheckSignatureFrom(mgr.CACert))
+
+	entries, err := os.ReadDir(certDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "in-memory mode must not create any files")
+}
+
+func TestLoadCAFromPEM(t *testing.T) {
+	source, err := NewInMemoryManager()
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: source.CACert.Raw})
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(source.CAKey)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(source.CAKey)})
+
+	t.Run("pkcs8", func(t *testing.T) {
+		mgr := &Manager{}
+		require.NoError(t, mgr.LoadCAFromPEM(certPEM, keyPEM))
+		assert.True(t, mgr.CACert.Equal(source.CACert))
+		assert.True(t, mgr.CAKey.Equal(source.CAKey))
+	})
+
+	t.Run("pkcs1", func(t *testing.T) {
+		mgr := &Manager{}
+		require.NoError(t, mgr.LoadCAFromPEM(certPEM, pkcs1PEM))
+		assert.True(t, mgr.CAKey.Equal(source.CAKey))
+	})
+
+	t.Run("mismatched key", func(t *testing.T) {
+		other, err := NewInMemoryManager()
+		require.NoError(t, err)
+		otherKey, err := x509.MarshalPKCS8PrivateKey(other.CAKey)
+		require.NoError(t, err)
+
+		mgr := &Manager{}
+		err = mgr.LoadCAFromPEM(certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: otherKey}))
+		assert.ErrorContains(t, err, "do not match")
+		assert.Nil(t, mgr.CACert)
+	})
+
+	t.Run("invalid pem", func(t *testing.T) {
+		mgr := &Manager{}
+		assert.Error(t, mgr.LoadCAFromPEM([]byte("not pem"), keyPEM))
+		assert.Error(t, mgr.LoadCAFromPEM(certPEM, []byte("not pem")))
+	})
+}
@@ -0,0 +1,193 @@
+package certs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"unicode/utf16"
+)
+
+// PKCS#12 (RFC 7292) object identifiers used by the certificate-only export.
+var (
+	oidPKCS7Data           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidJavaTrustStore      = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+	oidSHA1                = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// pkcs12MacIterations is the MAC key derivation iteration count, matching OpenSSL's default.
+const pkcs12MacIterations = 2048
+
+type pkcs12PFX struct {
+	Version  int
+	AuthSafe pkcs12ContentInfo
+	MacData  pkcs12MacData `asn1:"optional"`
+}
+
+type pkcs12ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// CACertPKCS12 returns the CA certificate, without its private key, as a
+// PKCS#12 trust store protected by an empty password. The certificate carries
+// a friendly name and the attribute Java's keytool uses to mark trusted entries.
+func (m *Manager) CACertPKCS12() ([]byte, error) {
+	caCert, _, _ := m.CA()
+	if caCert == nil {
+		return nil, fmt.Errorf("CA certificate not loaded or generated yet")
+	}
+
+	certBag, err := asn1.Marshal(pkcs12CertBag{ID: oidX509Certificate, Data: caCert.Raw})
+	if err != nil {
+		return nil, err
+	}
+	friendlyName, err := pkcs12AttributeValue(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(caCert.Subject.CommonName)})
+	if err != nil {
+		return nil, err
+	}
+	trustedUsage, err := pkcs12AttributeValue(oidAnyExtendedKeyUsage)
+	if err != nil {
+		return nil, err
+	}
+	safeContents, err := asn1.Marshal([]pkcs12SafeBag{{
+		ID:    oidCertBag,
+		Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certBag},
+		Attributes: []pkcs12Attribute{
+			{ID: oidFriendlyName, Values: friendlyName},
+			{ID: oidJavaTrustStore, Values: trustedUsage},
+		},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	safeContentsInfo, err := pkcs12DataContentInfo(safeContents)
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := asn1.Marshal([]pkcs12ContentInfo{safeContentsInfo})
+	if err != nil {
+		return nil, err
+	}
+	authSafeInfo, err := pkcs12DataContentInfo(authSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	// An empty password is encoded as a lone BMPString null terminator.
+	key := pkcs12MacKey(salt, []byte{0, 0}, pkcs12MacIterations)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(authSafe)
+
+	return asn1.Marshal(pkcs12PFX{
+		Version:  3,
+		AuthSafe: authSafeInfo,
+		MacData: pkcs12MacData{
+			Mac: pkcs12DigestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    salt,
+			Iterations: pkcs12MacIterations,
+		},
+	})
+}
+
+// pkcs12DataContentInfo wraps content in a ContentInfo of type data.
+func pkcs12DataContentInfo(content []byte) (pkcs12ContentInfo, error) {
+	octets, err := asn1.Marshal(content)
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	return pkcs12ContentInfo{
+		ContentType: oidPKCS7Data,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets},
+	}, nil
+}
+
+// pkcs12AttributeValue encodes value as the single member of an attribute's value set.
+func pkcs12AttributeValue(value interface{}) (asn1.RawValue, error) {
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: encoded}, nil
+}
+
+// bmpString encodes s as big-endian UTF-16, the BMPString used for friendly names.
+func bmpString(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// pkcs12MacKey derives the 20-byte HMAC-SHA1 key with the PKCS#12 KDF
+// (RFC 7292 appendix B.2, ID 3). A single SHA-1 output is long enough, so
+// the block update step of the KDF is never needed.
+func pkcs12MacKey(salt, password []byte, iterations int) []byte {
+	const v = 64 // SHA-1 block size
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(data)+v-1)/v))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+
+	input := make([]byte, v, v+len(salt)+len(password)+2*v)
+	for i := range input {
+		input[i] = 3
+	}
+	input = append(input, fill(salt)...)
+	input = append(input, fill(password)...)
+
+	sum := sha1.Sum(input)
+	for i := 1; i < iterations; i++ {
+		sum = sha1.Sum(sum[:])
+	}
+	return sum[:]
+}
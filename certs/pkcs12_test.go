@@ -0,0 +1,53 @@
+package certs
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCACertPKCS12(t *testing.T) {
+	m, err := NewInMemoryManager()
+	require.NoError(t, err)
+	data, err := m.CACertPKCS12()
+	require.NoError(t, err)
+
+	var pfx pkcs12PFX
+	_, err = asn1.Unmarshal(data, &pfx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, pfx.Version)
+	assert.Equal(t, pkcs12MacIterations, pfx.MacData.Iterations)
+
+	// MAC使用空密码校验
+	var authSafe []byte
+	_, err = asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe)
+	require.NoError(t, err)
+	mac := hmac.New(sha1.New, pkcs12MacKey(pfx.MacData.MacSalt, []byte{0, 0}, pfx.MacData.Iterations))
+	mac.Write(authSafe)
+	assert.Equal(t, mac.Sum(nil), pfx.MacData.Mac.Digest)
+
+	var contents []pkcs12ContentInfo
+	_, err = asn1.Unmarshal(authSafe, &contents)
+	require.NoError(t, err)
+	require.Len(t, contents, 1)
+	var safeContents []byte
+	_, err = asn1.Unmarshal(contents[0].Content.Bytes, &safeContents)
+	require.NoError(t, err)
+	var bags []pkcs12SafeBag
+	_, err = asn1.Unmarshal(safeContents, &bags)
+	require.NoError(t, err)
+	require.Len(t, bags, 1)
+	assert.True(t, bags[0].ID.Equal(oidCertBag))
+
+	var certBag pkcs12CertBag
+	_, err = asn1.Unmarshal(bags[0].Value.Bytes, &certBag)
+	require.NoError(t, err)
+	assert.Equal(t, m.CACert.Raw, certBag.Data)
+
+	_, err = (&Manager{}).CACertPKCS12()
+	assert.Error(t, err)
+}
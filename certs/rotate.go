@@ -0,0 +1,114 @@
+package certs
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCustomCARotation is returned by RegenerateCA when the CA was supplied by
+// the user, whose certificate and key files are not ProxyCraft's to replace.
+var ErrCustomCARotation = errors.New("cannot regenerate a custom CA: replace its certificate and key files and restart instead")
+
+// RegenerateCA replaces the CA with a freshly generated one, e.g. after the
+// key leaked or the certificate expired. The new CA is written to the default
+// CA files when it was loaded from there and kept only in memory otherwise.
+// Leaves generated afterwards are signed by the new CA; connections that
+// already completed their handshake keep the certificate they were served.
+// Clients must trust the new CA certificate before new MITM connections work.
+func (m *Manager) RegenerateCA() error {
+	m.mu.RLock()
+	custom, certPath, keyPath := m.customCA, m.caCertPath, m.caKeyPath
+	m.mu.RUnlock()
+	if custom {
+		return ErrCustomCARotation
+	}
+
+	cert, key, err := generateCA(IssuerName, OrgName, NotAfter)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA: %w", err)
+	}
+	// Persist first so a failed write leaves both the files and the running CA unchanged.
+	if certPath != "" {
+		if err := replaceCAFiles(certPath, keyPath, cert, key); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.CACert = cert
+	m.CAKey = key
+	m.CAChain = nil
+	m.generation++
+	return nil
+}
+
+// Generation counts the CA replacements done by RegenerateCA. Callers caching
+// leaf certificates should drop the ones issued under an older generation.
+func (m *Manager) Generation() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generation
+}
+
+// replaceCAFiles writes the new CA next to the current files and renames it
+// into place, key first. If the certificate cannot be renamed the previous key
+// is restored, so the files never hold a certificate and key that don't match.
+func replaceCAFiles(certPath, keyPath string, cert *x509.Certificate, key *rsa.PrivateKey) error {
+	privBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	certTmp, err := writeTempFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write CA certificate to %s: %w", certPath, err)
+	}
+	defer os.Remove(certTmp)
+	keyTmp, err := writeTempFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}), 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write CA key to %s: %w", keyPath, err)
+	}
+	defer os.Remove(keyTmp)
+
+	oldKey, readErr := os.ReadFile(keyPath)
+	if err := os.Rename(keyTmp, keyPath); err != nil {
+		return fmt.Errorf("failed to replace CA key %s: %w", keyPath, err)
+	}
+	if err := os.Rename(certTmp, certPath); err != nil {
+		if readErr == nil {
+			if restoreTmp, restoreErr := writeTempFile(keyPath, oldKey, 0o600); restoreErr == nil {
+				if os.Rename(restoreTmp, keyPath) != nil {
+					_ = os.Remove(restoreTmp)
+				}
+			}
+		}
+		return fmt.Errorf("failed to replace CA certificate %s: %w", certPath, err)
+	}
+	return nil
+}
+
+// writeTempFile writes data to a new temporary file in the directory of path
+// and returns its name.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
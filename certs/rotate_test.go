@@ -0,0 +1,162 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyLeaf checks that leaf chains up to ca as a server certificate for host.
+func verifyLeaf(leaf, ca *x509.Certificate, host string) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+	return err
+}
+
+func TestRegenerateCA(t *testing.T) {
+	certDir := t.TempDir()
+	t.Setenv("PROXYCRAFT_CERT_DIR", certDir)
+
+	mgr, err := NewManager()
+	require.NoError(t, err)
+	oldCA := mgr.CACert
+	oldLeaf, _, err := mgr.GenerateServerCert("example.com")
+	require.NoError(t, err)
+	assert.Zero(t, mgr.Generation())
+
+	require.NoError(t, mgr.RegenerateCA())
+	assert.Equal(t, uint64(1), mgr.Generation())
+	assert.NotEqual(t, oldCA.Raw, mgr.CACert.Raw)
+	assert.False(t, mgr.CAKey.PublicKey.Equal(&oldCA.PublicKey), "the new CA must use a new key")
+
+	// 新签发的证书只能用新CA验证
+	leaf, _, err := mgr.GenerateServerCert("example.com:443")
+	require.NoError(t, err)
+	assert.NoError(t, verifyLeaf(leaf, mgr.CACert, "example.com"))
+	assert.Error(t, verifyLeaf(leaf, oldCA, "example.com"))
+	assert.NoError(t, verifyLeaf(oldLeaf, oldCA, "example.com"))
+
+	tlsCert, err := mgr.GenerateServerTLSCert("example.com")
+	require.NoError(t, err)
+	assert.Len(t, tlsCert.Certificate, 1)
+	assert.NoError(t, verifyLeaf(tlsCert.Leaf, mgr.CACert, "example.com"))
+
+	// 新CA写回默认的CA文件，重启后继续使用
+	certPEM, err := os.ReadFile(filepath.Join(certDir, caCertFile))
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	assert.Equal(t, mgr.CACert.Raw, block.Bytes)
+	reloaded, err := NewManager()
+	require.NoError(t, err)
+	assert.Equal(t, mgr.CACert.Raw, reloaded.CACert.Raw)
+	assert.True(t, reloaded.CAKey.Equal(mgr.CAKey))
+
+	info, err := mgr.Info()
+	require.NoError(t, err)
+	assert.Equal(t, Fingerprint(mgr.CACert.Raw), info.SHA256)
+}
+
+func TestRegenerateCA_WriteFailureKeepsFiles(t *testing.T) {
+	certDir := t.TempDir()
+	t.Setenv("PROXYCRAFT_CERT_DIR", certDir)
+
+	mgr, err := NewManager()
+	require.NoError(t, err)
+	oldCA := mgr.CACert
+	keyPath := filepath.Join(certDir, caKeyFile)
+	oldKey, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+
+	// A non-empty directory in place of the certificate makes its rename fail
+	certPath := filepath.Join(certDir, caCertFile)
+	require.NoError(t, os.Remove(certPath))
+	require.NoError(t, os.MkdirAll(filepath.Join(certPath, "blocker"), 0o755))
+
+	assert.Error(t, mgr.RegenerateCA())
+	key, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, oldKey, key, "the key must be rolled back when the certificate cannot be replaced")
+	assert.Equal(t, oldCA.Raw, mgr.CACert.Raw)
+	assert.Zero(t, mgr.Generation())
+
+	entries, err := os.ReadDir(certDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".tmp-", "temporary files must be removed")
+	}
+}
+
+func TestRegenerateCA_InMemory(t *testing.T) {
+	certDir := t.TempDir()
+	t.Setenv("PROXYCRAFT_CERT_DIR", filepath.Join(certDir, "certs"))
+
+	mgr, err := NewInMemoryManager()
+	require.NoError(t, err)
+	oldCA := mgr.CACert
+	require.NoError(t, mgr.RegenerateCA())
+	assert.NotEqual(t, oldCA.Raw, mgr.CACert.Raw)
+
+	entries, err := os.ReadDir(certDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "in-memory mode must not create any files")
+}
+
+func TestRegenerateCA_ConcurrentReaders(t *testing.T) {
+	mgr, err := NewInMemoryManager()
+	require.NoError(t, err)
+
+	// Readers go through CA() and must never see a certificate paired with another CA's key
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				cert, key, _ := mgr.CA()
+				assert.True(t, key.PublicKey.Equal(cert.PublicKey))
+				_, err := mgr.Info()
+				assert.NoError(t, err)
+				_, err = mgr.CACertPKCS12()
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, mgr.RegenerateCA())
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestRegenerateCA_CustomCA(t *testing.T) {
+	source, err := NewInMemoryManager()
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: source.CACert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(source.CAKey)})
+
+	mgr := &Manager{}
+	require.NoError(t, mgr.LoadCAFromPEM(certPEM, keyPEM))
+	assert.ErrorIs(t, mgr.RegenerateCA(), ErrCustomCARotation)
+	assert.Equal(t, source.CACert.Raw, mgr.CACert.Raw)
+	assert.Zero(t, mgr.Generation())
+
+	// A CA handed over by an embedding program is custom as well
+	fromCA, err := NewManagerFromCA(source.CACert, source.CAKey)
+	require.NoError(t, err)
+	assert.ErrorIs(t, fromCA.RegenerateCA(), ErrCustomCARotation)
+	assert.Equal(t, source.CACert.Raw, fromCA.CACert.Raw)
+}
@@ -0,0 +1,181 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// TrustStoreResult 描述一次信任/取消信任操作在单个信任存储上的结果
+type TrustStoreResult struct {
+	Store         string // 信任存储名称，例如 "system keychain"、"NSS (~/.pki/nssdb)"
+	Changed       bool   // 是否实际修改了该存储，已处于目标状态时为false
+	Err           error  // 自动操作失败时的错误
+	ManualCommand string // 自动操作失败时可以手动执行的命令
+}
+
+// String 返回适合直接打印给用户的结果描述
+func (r TrustStoreResult) String() string {
+	switch {
+	case r.Err != nil && r.ManualCommand != "":
+		return fmt.Sprintf("[FAIL] %s: %v\n       run manually: %s", r.Store, r.Err, r.ManualCommand)
+	case r.Err != nil:
+		return fmt.Sprintf("[FAIL] %s: %v", r.Store, r.Err)
+	case r.Changed:
+		return fmt.Sprintf("[ OK ] %s: updated", r.Store)
+	default:
+		return fmt.Sprintf("[ OK ] %s: already up to date", r.Store)
+	}
+}
+
+// trustStore 描述一个可以写入CA证书的信任存储
+type trustStore struct {
+	name          string
+	isTrusted     func() (bool, error)
+	trust         func() error
+	untrust       func() error
+	manualTrust   string
+	manualUntrust string
+}
+
+// TrustCA 将m正在使用的CA证书安装到当前平台所有可用的信任存储中（系统存储与用户级存储）
+// 已经信任的存储会被跳过，因此可以重复执行
+func TrustCA(m *Manager) []TrustStoreResult {
+	return applyManagerTrust(m, false)
+}
+
+// UntrustCA 从当前平台所有可用的信任存储中移除m正在使用的CA证书
+// 未安装该证书的存储会被跳过，因此可以重复执行
+func UntrustCA(m *Manager) []TrustStoreResult {
+	return applyManagerTrust(m, true)
+}
+
+func applyManagerTrust(m *Manager, remove bool) []TrustStoreResult {
+	certPath, cleanup, err := m.caCertFile()
+	if err != nil {
+		return []TrustStoreResult{{Store: "system", Err: err}}
+	}
+	defer cleanup()
+	return applyTrust(platformTrustStores(certPath), remove)
+}
+
+// caCertFile 返回内容为m的CA证书的PEM文件，供系统工具读取
+// m的CA与默认目录中的证书一致时直接使用该文件；否则（-use-ca、内存CA等）写入临时文件，由cleanup删除
+func (m *Manager) caCertFile() (string, func(), error) {
+	if m == nil {
+		return "", nil, fmt.Errorf("CA certificate is not loaded")
+	}
+	caCert, _, _ := m.CA()
+	if caCert == nil {
+		return "", nil, fmt.Errorf("CA certificate is not loaded")
+	}
+	if certPath := defaultCACertPath(); certPath != "" {
+		if raw, err := readCACertRaw(certPath); err == nil && bytes.Equal(raw, caCert.Raw) {
+			return certPath, func() {}, nil
+		}
+	}
+
+	file, err := os.CreateTemp("", "proxycraft-ca-*.pem")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to write CA certificate for the trust store: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(file.Name()) }
+	err = pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write CA certificate for the trust store: %w", err)
+	}
+	return file.Name(), cleanup, nil
+}
+
+// TrustResultsFailed 判断结果中是否存在失败的信任存储
+func TrustResultsFailed(results []TrustStoreResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func applyTrust(stores []trustStore, remove bool) []TrustStoreResult {
+	results := make([]TrustStoreResult, 0, len(stores))
+	for _, store := range stores {
+		result := TrustStoreResult{Store: store.name}
+
+		// 已处于目标状态时跳过，保证幂等
+		if store.isTrusted != nil {
+			if trusted, err := store.isTrusted(); err == nil && trusted != remove {
+				results = append(results, result)
+				continue
+			}
+		}
+
+		op, manual := store.trust, store.manualTrust
+		if remove {
+			op, manual = store.untrust, store.manualUntrust
+		}
+
+		if op == nil {
+			result.Err = fmt.Errorf("operation not supported for this store")
+		} else {
+			result.Err = op()
+		}
+
+		if result.Err != nil {
+			result.ManualCommand = manual
+		} else {
+			result.Changed = true
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		results = append(results, TrustStoreResult{
+			Store: "system",
+			Err:   fmt.Errorf("no supported trust store found on this platform"),
+		})
+	}
+	return results
+}
+
+// certsMatchPEM 判断PEM数据中是否包含与raw完全相同的证书
+func certsMatchPEM(pemData []byte, raw []byte) bool {
+	remaining := pemData
+	for len(remaining) > 0 {
+		var block *pem.Block
+		block, remaining = pem.Decode(remaining)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(cert.Raw, raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// readCACertRaw 读取CA证书文件并返回DER编码
+func readCACertRaw(certPath string) ([]byte, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate %s: %w", certPath, err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to decode PEM block containing certificate from %s", certPath)
+	}
+	return block.Bytes, nil
+}
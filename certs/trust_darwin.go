@@ -0,0 +1,85 @@
+//go:build darwin
+
+package certs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// platformTrustStores 返回macOS上的信任存储：系统钥匙串以及当前用户的登录钥匙串
+func platformTrustStores(certPath string) []trustStore {
+	stores := []trustStore{
+		{
+			name:      "system keychain",
+			isTrusted: func() (bool, error) { return isInstalled(certPath) },
+			trust:     func() error { return installForce(certPath) },
+			untrust:   uninstall,
+			manualTrust: fmt.Sprintf("sudo security add-trusted-cert -d -r trustRoot -k %s %s",
+				strconv.Quote(systemKeychain), strconv.Quote(certPath)),
+			manualUntrust: fmt.Sprintf("sudo security delete-certificate -c %s %s",
+				strconv.Quote(IssuerName), strconv.Quote(systemKeychain)),
+		},
+	}
+
+	if keychain := loginKeychainPath(); keychain != "" {
+		stores = append(stores, loginKeychainStore(keychain, certPath))
+	}
+	return stores
+}
+
+// loginKeychainPath 返回当前用户的登录钥匙串路径，不存在时返回空字符串
+func loginKeychainPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"login.keychain-db", "login.keychain"} {
+		path := filepath.Join(home, "Library", "Keychains", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func loginKeychainStore(keychain, certPath string) trustStore {
+	return trustStore{
+		name: "login keychain",
+		isTrusted: func() (bool, error) {
+			raw, err := readCACertRaw(certPath)
+			if err != nil {
+				return false, err
+			}
+			output, err := exec.Command("security", "find-certificate", "-a", "-c", IssuerName, "-p", keychain).Output()
+			if err != nil {
+				return false, nil
+			}
+			return certsMatchPEM(output, raw), nil
+		},
+		trust: func() error {
+			// 先移除同名旧证书，避免重新生成CA后残留
+			_ = exec.Command("security", "delete-certificate", "-c", IssuerName, keychain).Run()
+			output, err := exec.Command("security", "add-trusted-cert", "-r", "trustRoot", "-k", keychain, certPath).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("security add-trusted-cert failed: %w (output: %s)", err, strings.TrimSpace(string(output)))
+			}
+			return nil
+		},
+		untrust: func() error {
+			output, err := exec.Command("security", "delete-certificate", "-c", IssuerName, keychain).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("security delete-certificate failed: %w (output: %s)", err, strings.TrimSpace(string(output)))
+			}
+			return nil
+		},
+		manualTrust: fmt.Sprintf("security add-trusted-cert -r trustRoot -k %s %s",
+			strconv.Quote(keychain), strconv.Quote(certPath)),
+		manualUntrust: fmt.Sprintf("security delete-certificate -c %s %s",
+			strconv.Quote(IssuerName), strconv.Quote(keychain)),
+	}
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package certs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// platformTrustStores 返回Linux上的信任存储：系统CA目录以及用户的NSS数据库（Chrome/Firefox）
+func platformTrustStores(certPath string) []trustStore {
+	stores := []trustStore{
+		{
+			name:      "system CA store",
+			isTrusted: func() (bool, error) { return linuxSystemTrusted(certPath) },
+			trust:     func() error { return install(certPath) },
+			untrust:   uninstall,
+			manualTrust: fmt.Sprintf("sudo cp %s %s && sudo update-ca-certificates",
+				strconv.Quote(certPath), linuxTrustTargets[0].path),
+			manualUntrust: fmt.Sprintf("sudo rm -f %s && sudo update-ca-certificates --fresh",
+				linuxTrustTargets[0].path),
+		},
+	}
+
+	for _, dir := range nssDatabaseDirs() {
+		stores = append(stores, nssTrustStore(dir, certPath))
+	}
+
+	return stores
+}
+
+// linuxSystemTrusted 检查系统CA目录中是否存在内容一致的证书
+func linuxSystemTrusted(certPath string) (bool, error) {
+	current, err := os.ReadFile(certPath)
+	if err != nil {
+		return false, err
+	}
+	for _, target := range linuxTrustTargets {
+		installed, err := os.ReadFile(target.path)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(bytes.TrimSpace(installed), bytes.TrimSpace(current)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nssDatabaseDirs 返回当前用户的NSS数据库目录
+// ~/.pki/nssdb 被Chrome/Chromium使用，总是包含在内；Firefox配置目录仅在存在时加入
+func nssDatabaseDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	dirs := []string{filepath.Join(home, ".pki", "nssdb")}
+	for _, pattern := range []string{
+		filepath.Join(home, ".mozilla", "firefox", "*"),
+		filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*"),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		for _, profile := range matches {
+			if fileExists(filepath.Join(profile, "cert9.db")) {
+				dirs = append(dirs, profile)
+			}
+		}
+	}
+	return dirs
+}
+
+func nssTrustStore(dir, certPath string) trustStore {
+	db := "sql:" + dir
+	return trustStore{
+		name: fmt.Sprintf("NSS database (%s)", dir),
+		isTrusted: func() (bool, error) {
+			if !commandExists("certutil") {
+				return false, nil
+			}
+			raw, err := readCACertRaw(certPath)
+			if err != nil {
+				return false, err
+			}
+			output, err := exec.Command("certutil", "-d", db, "-L", "-n", IssuerName, "-a").Output()
+			if err != nil {
+				return false, nil
+			}
+			return certsMatchPEM(output, raw), nil
+		},
+		trust: func() error {
+			if !commandExists("certutil") {
+				return fmt.Errorf("certutil not found (install libnss3-tools or nss-tools)")
+			}
+			if !fileExists(filepath.Join(dir, "cert9.db")) {
+				if err := os.MkdirAll(dir, 0700); err != nil {
+					return err
+				}
+				if err := runCommand("certutil", "-d", db, "-N", "--empty-password"); err != nil {
+					return err
+				}
+			}
+			// 先移除同名旧证书，避免重新生成CA后残留
+			_ = exec.Command("certutil", "-d", db, "-D", "-n", IssuerName).Run()
+			return runCommand("certutil", "-d", db, "-A", "-t", "C,,", "-n", IssuerName, "-i", certPath)
+		},
+		untrust: func() error {
+			if !commandExists("certutil") {
+				return fmt.Errorf("certutil not found (install libnss3-tools or nss-tools)")
+			}
+			return runCommand("certutil", "-d", db, "-D", "-n", IssuerName)
+		},
+		manualTrust: fmt.Sprintf("certutil -d %s -A -t \"C,,\" -n %s -i %s",
+			strconv.Quote(db), strconv.Quote(IssuerName), strconv.Quote(certPath)),
+		manualUntrust: fmt.Sprintf("certutil -d %s -D -n %s",
+			strconv.Quote(db), strconv.Quote(IssuerName)),
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !darwin && !windows && !linux
+
+package certs
+
+import "fmt"
+
+// platformTrustStores 在不支持自动安装的平台上只返回一个提示手动导入的存储
+func platformTrustStores(certPath string) []trustStore {
+	unsupported := func() error {
+		return fmt.Errorf("automatic trust management is not supported on this platform")
+	}
+	return []trustStore{
+		{
+			name:          "system",
+			trust:         unsupported,
+			untrust:       unsupported,
+			manualTrust:   fmt.Sprintf("import %s into your system or browser trust store manually", certPath),
+			manualUntrust: fmt.Sprintf("remove %q from your system or browser trust store manually", IssuerName),
+		},
+	}
+}
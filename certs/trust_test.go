@@ -0,0 +1,106 @@
+package certs
+
+import (
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTrust(t *testing.T) {
+	var trustCalls, untrustCalls int
+	trusted := false
+	store := trustStore{
+		name:      "fake",
+		isTrusted: func() (bool, error) { return trusted, nil },
+		trust: func() error {
+			trustCalls++
+			trusted = true
+			return nil
+		},
+		untrust: func() error {
+			untrustCalls++
+			trusted = false
+			return nil
+		},
+	}
+
+	// 首次信任会修改存储，再次执行应跳过
+	results := applyTrust([]trustStore{store}, false)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Changed)
+	assert.NoError(t, results[0].Err)
+
+	results = applyTrust([]trustStore{store}, false)
+	assert.False(t, results[0].Changed)
+	assert.Equal(t, 1, trustCalls)
+
+	// 取消信任同样幂等
+	results = applyTrust([]trustStore{store}, true)
+	assert.True(t, results[0].Changed)
+	results = applyTrust([]trustStore{store}, true)
+	assert.False(t, results[0].Changed)
+	assert.Equal(t, 1, untrustCalls)
+	assert.False(t, TrustResultsFailed(results))
+}
+
+func TestApplyTrustFailure(t *testing.T) {
+	store := trustStore{
+		name:        "broken",
+		isTrusted:   func() (bool, error) { return false, nil },
+		trust:       func() error { return errors.New("permission denied") },
+		manualTrust: "sudo do-something",
+	}
+
+	results := applyTrust([]trustStore{store}, false)
+	require.Len(t, results, 1)
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, "sudo do-something", results[0].ManualCommand)
+	assert.Contains(t, results[0].String(), "sudo do-something")
+	assert.True(t, TrustResultsFailed(results))
+
+	// 没有untrust实现时应报告失败而不是panic
+	store.isTrusted = func() (bool, error) { return true, nil }
+	results = applyTrust([]trustStore{store}, true)
+	assert.Error(t, results[0].Err)
+
+	results = applyTrust(nil, false)
+	require.Len(t, results, 1)
+	assert.True(t, TrustResultsFailed(results))
+}
+
+func TestCertsMatchPEM(t *testing.T) {
+	mgr, err := NewManager()
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mgr.CACert.Raw})
+	assert.True(t, certsMatchPEM(certPEM, mgr.CACert.Raw))
+	assert.False(t, certsMatchPEM(certPEM, []byte("other")))
+	assert.False(t, certsMatchPEM([]byte("garbage"), mgr.CACert.Raw))
+}
+
+func TestCACertFileUsesActiveCA(t *testing.T) {
+	onDisk, err := NewManager()
+	require.NoError(t, err)
+	certPath, cleanup, err := onDisk.caCertFile()
+	require.NoError(t, err)
+	cleanup()
+	assert.Equal(t, MustGetCACertPath(), certPath)
+
+	// 内存CA与磁盘上的默认CA不同，信任存储必须拿到内存CA本身
+	inMemory, err := NewInMemoryManager()
+	require.NoError(t, err)
+	certPath, cleanup, err = inMemory.caCertFile()
+	require.NoError(t, err)
+	assert.NotEqual(t, MustGetCACertPath(), certPath)
+	raw, err := readCACertRaw(certPath)
+	require.NoError(t, err)
+	assert.Equal(t, inMemory.CACert.Raw, raw)
+
+	cleanup()
+	_, err = os.Stat(certPath)
+	assert.True(t, os.IsNotExist(err))
+}
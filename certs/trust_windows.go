@@ -0,0 +1,38 @@
+//go:build windows
+
+package certs
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// platformTrustStores 返回Windows上的信任存储：本机根证书存储以及当前用户根证书存储
+func platformTrustStores(certPath string) []trustStore {
+	return []trustStore{
+		{
+			name:          "LocalMachine Root store",
+			isTrusted:     func() (bool, error) { return isInstalled(certPath) },
+			trust:         func() error { return installForce(certPath) },
+			untrust:       uninstall,
+			manualTrust:   fmt.Sprintf("certutil -addstore -f root %s", strconv.Quote(certPath)),
+			manualUntrust: fmt.Sprintf("certutil -delstore root %s", strconv.Quote(IssuerName)),
+		},
+		{
+			name: "CurrentUser Root store",
+			isTrusted: func() (bool, error) {
+				return storeHasCert(certPath, "-user")
+			},
+			trust: func() error {
+				_, err := runCertutil("-user", "-addstore", "-f", "root", certPath)
+				return err
+			},
+			untrust: func() error {
+				_, err := runCertutil("-user", "-delstore", "root", IssuerName)
+				return err
+			},
+			manualTrust:   fmt.Sprintf("certutil -user -addstore -f root %s", strconv.Quote(certPath)),
+			manualUntrust: fmt.Sprintf("certutil -user -delstore root %s", strconv.Quote(IssuerName)),
+		},
+	}
+}
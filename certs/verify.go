@@ -13,16 +13,17 @@ func VerifySystemTrust(m *Manager) error {
 	if m == nil {
 		return fmt.Errorf("certificate manager is nil")
 	}
-	if m.CACert == nil {
+	caCert, _, _ := m.CA()
+	if caCert == nil {
 		return fmt.Errorf("CA certificate is not loaded")
 	}
 
 	if runtime.GOOS == "darwin" {
-		certPEM, err := encodeCertPEM(m.CACert)
+		certPEM, err := encodeCertPEM(caCert)
 		if err != nil {
 			return fmt.Errorf("failed to encode CA certificate: %w", err)
 		}
-		if err := verifySystemTrustWithCert(certPEM, nil, m.CACert); err != nil {
+		if err := verifySystemTrustWithCert(certPEM, nil, caCert); err != nil {
 			return fmt.Errorf("system trust verification failed: %w", err)
 		}
 		return nil
@@ -3,7 +3,6 @@
 package certs
 
 import (
-	"bytes"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -66,28 +65,6 @@ func verifySystemTrustWithCert(certPEM []byte, _ *rsa.PrivateKey, _ *x509.Certif
 	return fmt.Errorf("certificate not found in system or login keychain")
 }
 
-func certsMatchPEM(pemData []byte, raw []byte) bool {
-	remaining := pemData
-	for len(remaining) > 0 {
-		var block *pem.Block
-		block, remaining = pem.Decode(remaining)
-		if block == nil {
-			break
-		}
-		if block.Type != "CERTIFICATE" {
-			continue
-		}
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			continue
-		}
-		if bytes.Equal(cert.Raw, raw) {
-			return true
-		}
-	}
-	return false
-}
-
 func countCerts(pemData []byte) int {
 	count := 0
 	remaining := pemData
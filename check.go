@@ -0,0 +1,409 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/api"
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/LubyRuffy/ProxyCraft/cli"
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/LubyRuffy/ProxyCraft/proxy/handlers"
+)
+
+// upstreamCheckTimeout 检查上层代理是否可达时的连接超时
+const upstreamCheckTimeout = 5 * time.Second
+
+// checkResult 是 -check 报告中的一项
+type checkResult struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// checkConfig 按启动时的顺序校验所有配置项，但不启动代理、不生成或安装CA证书
+func checkConfig(cfg *cli.Config) []checkResult {
+	var results []checkResult
+	// add 返回记录名为name的检查结果的函数，便于直接传入各检查函数的返回值
+	add := func(name string) func(detail string, err error) {
+		return func(detail string, err error) {
+			results = append(results, checkResult{Name: name, Detail: detail, Err: err})
+		}
+	}
+
+	add("listen address")(checkListenAddr(cfg))
+	add("CA certificate")(checkCA(cfg))
+
+	_, err := proxy.ParseLogLevel(cfg.LogLevel)
+	add("log level")(cfg.LogLevel, err)
+
+	if cfg.HarOutputFile != "" {
+		add("HAR output")(checkHarOutput(cfg))
+	}
+
+	if cfg.JSONLOutput != "" && cfg.JSONLOutput != "-" {
+		add("JSONL output")(cfg.JSONLOutput, checkWritableFile(cfg.JSONLOutput, false))
+	}
+	if cfg.BinlogOutput != "" {
+		add("binary capture")(cfg.BinlogOutput, checkWritableFile(cfg.BinlogOutput, false))
+	}
+
+	if cfg.UpstreamProxy != "" {
+		add("upstream proxy")(checkUpstreamProxy(cfg.UpstreamProxy))
+	}
+	noProxyEnv := os.Getenv("NO_PROXY")
+	if noProxyEnv == "" {
+		noProxyEnv = os.Getenv("no_proxy")
+	}
+	if cfg.NoUpstreamFor != "" || noProxyEnv != "" {
+		_, err := proxy.ParseBypassList(cfg.NoUpstreamFor, noProxyEnv)
+		add("upstream bypass")("", err)
+	}
+
+	if cfg.DoH != "" {
+		_, err := proxy.NewDoHResolver(cfg.DoH, cfg.DoHFallback)
+		add("DNS-over-HTTPS")(cfg.DoH, err)
+	}
+	if len(cfg.CertPins) > 0 {
+		_, err := proxy.ParseCertPins(cfg.CertPins)
+		add("certificate pins")(strings.Join(cfg.CertPins, ", "), err)
+	}
+
+	_, _, err = proxy.ParseTLSVersionRange(cfg.TLSMinVersion, cfg.TLSMaxVersion)
+	if err == nil {
+		_, err = proxy.ParseCipherSuites(cfg.TLSCiphers)
+	}
+	add("client TLS")("", err)
+
+	if cfg.SampleRate < 1 {
+		_, err := proxy.NewSampler(cfg.SampleRate)
+		add("sampling")(strconv.FormatFloat(cfg.SampleRate, 'f', -1, 64), err)
+	}
+	if cfg.Chaos != "" {
+		_, err := proxy.ParseChaos(cfg.Chaos)
+		add("chaos")(cfg.Chaos, err)
+	}
+	if len(cfg.RateLimits) > 0 {
+		mode, err := proxy.ParseRateLimitMode(cfg.RateLimitMode)
+		if err == nil {
+			_, err = proxy.ParseRateLimits(cfg.RateLimits, mode)
+		}
+		add("rate limit")(strings.Join(cfg.RateLimits, ", "), err)
+	}
+	if cfg.CacheDir != "" || cfg.CacheOffline {
+		add("response cache")(checkCache(cfg))
+	}
+	for _, spec := range cfg.Replacements {
+		_, err := proxy.ParseBodyReplacement(spec)
+		add("replacement")(spec, err)
+	}
+	for _, spec := range cfg.Extracts {
+		_, err := proxy.ParseExtractRule(spec)
+		add("extract")(spec, err)
+	}
+	for _, spec := range cfg.Injects {
+		_, err := proxy.ParseInjectRule(spec)
+		add("inject")(spec, err)
+	}
+	_, err = proxy.ParseSkipBodyRules(cfg.SkipBodyTypes)
+	add("skip body types")(cfg.SkipBodyTypes, err)
+	_, err = harlogger.ParseSize(cfg.MaxHeaderSize)
+	add("max header size")(cfg.MaxHeaderSize, err)
+	add("anomaly thresholds")(checkAnomalyThresholds(cfg))
+
+	add("connection limit")(checkConnLimit(cfg))
+
+	if cfg.HealthAddr != "" {
+		_, err := net.ResolveTCPAddr("tcp", cfg.HealthAddr)
+		add("health address")(cfg.HealthAddr, err)
+	}
+
+	if cfg.ReverseTarget != "" {
+		add("reverse proxy")(checkReverseProxy(cfg))
+	}
+
+	if cfg.Mode == "web" {
+		add("storage")(checkStorage(cfg))
+		if cfg.BodyStore != "" {
+			add("body store")(checkBodyStore(cfg))
+		}
+		if cfg.Retention < 0 {
+			add("retention")(cfg.Retention.String(), errors.New("must not be negative"))
+		}
+		if cfg.ListLimit < 0 {
+			add("list limit")(strconv.Itoa(cfg.ListLimit), errors.New("must not be negative"))
+		}
+		if cfg.LLMHosts != "" {
+			_, err := proxy.ParseLLMHosts(cfg.LLMHosts)
+			add("LLM hosts")(cfg.LLMHosts, err)
+		}
+		add("web UI")(checkUI(cfg))
+	}
+
+	return results
+}
+
+// printCheckReport 输出检查报告，返回是否所有检查都通过
+func printCheckReport(w io.Writer, results []checkResult) bool {
+	failed := 0
+	for _, result := range results {
+		status, detail := "ok", result.Detail
+		if result.Err != nil {
+			status, detail = "FAIL", result.Err.Error()
+			failed++
+		}
+		if detail != "" {
+			fmt.Fprintf(w, "%-4s  %s: %s\n", status, result.Name, detail)
+		} else {
+			fmt.Fprintf(w, "%-4s  %s\n", status, result.Name)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "Configuration check failed: %d problem(s) found.\n", failed)
+		return false
+	}
+	fmt.Fprintln(w, "Configuration OK.")
+	return true
+}
+
+func checkListenAddr(cfg *cli.Config) (string, error) {
+	listenAddr := net.JoinHostPort(cfg.ListenHost, strconv.Itoa(cfg.ListenPort))
+	if cfg.ListenPort < 0 || cfg.ListenPort > 65535 {
+		return listenAddr, fmt.Errorf("invalid port %d", cfg.ListenPort)
+	}
+	if _, err := net.ResolveTCPAddr("tcp", listenAddr); err != nil {
+		return listenAddr, err
+	}
+	return listenAddr, nil
+}
+
+// checkCA 按 newCertManager 的优先级加载CA，默认CA文件不存在时只提示启动时会生成
+func checkCA(cfg *cli.Config) (string, error) {
+	if cfg.UseCAChainPath != "" && (cfg.UseCACertPath == "" || cfg.UseCAKeyPath == "") {
+		return "", errors.New("-use-ca-chain requires -use-ca and -use-key")
+	}
+	if cfg.UseCACertPath != "" || cfg.UseCAKeyPath != "" {
+		if cfg.UseCACertPath == "" || cfg.UseCAKeyPath == "" {
+			return "", errors.New("-use-ca and -use-key must be set together")
+		}
+		return loadCAFiles(cfg.UseCACertPath, cfg.UseCAKeyPath, cfg.UseCAChainPath)
+	}
+
+	if cfg.InMemoryCA {
+		if cfg.InstallCerts {
+			return "", errInstallInMemoryCA
+		}
+		return "temporary CA generated in memory at startup", nil
+	}
+
+	certPath := certs.MustGetCACertPath()
+	keyPath := certs.MustGetCAKeyPath()
+	if _, err := os.Stat(certPath); errors.Is(err, os.ErrNotExist) {
+		return fmt.Sprintf("%s not found, a new CA will be generated at startup", certPath), nil
+	}
+	return loadCAFiles(certPath, keyPath, "")
+}
+
+func loadCAFiles(certPath, keyPath, chainPath string) (string, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CA cert file %s: %w", certPath, err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CA key file %s: %w", keyPath, err)
+	}
+	certManager := &certs.Manager{}
+	if err := certManager.LoadCAFromPEM(certPEM, keyPEM); err != nil {
+		return "", fmt.Errorf("%s: %w", certPath, err)
+	}
+	if chainPath != "" {
+		if err := certManager.LoadCAChain(chainPath); err != nil {
+			return "", err
+		}
+	}
+	return describeCA(certManager, "from "+certPath)
+}
+
+// describeCA 描述已加载的CA，已过期的CA视为错误
+func describeCA(certManager *certs.Manager, source string) (string, error) {
+	caCert, _, _ := certManager.CA()
+	detail := fmt.Sprintf("%q %s, valid until %s", caCert.Subject.CommonName, source, caCert.NotAfter.Format("2006-01-02"))
+	if time.Now().After(caCert.NotAfter) {
+		return detail, fmt.Errorf("CA certificate %q expired on %s", caCert.Subject.CommonName, caCert.NotAfter.Format("2006-01-02"))
+	}
+	return detail, nil
+}
+
+func checkHarOutput(cfg *cli.Config) (string, error) {
+	if _, err := harlogger.ParseSize(cfg.HarMaxSize); err != nil {
+		return cfg.HarOutputFile, fmt.Errorf("-har-max-size: %w", err)
+	}
+	return cfg.HarOutputFile, checkWritableFile(cfg.HarOutputFile, false)
+}
+
+// checkUpstreamProxy 解析上层代理链，并确认第一跳可以连接；后续各跳只能经由前一跳访问，不做检查
+func checkUpstreamProxy(raw string) (string, error) {
+	chain, err := proxy.ParseUpstreamProxyChain(raw)
+	if err != nil {
+		return "", err
+	}
+	if len(chain) == 0 {
+		return "", nil
+	}
+	if err := proxy.CheckUpstreamProxy(chain[0], upstreamCheckTimeout); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s reachable", chain[0].Redacted()), nil
+}
+
+func checkConnLimit(cfg *cli.Config) (string, error) {
+	mode, err := proxy.ParseConnLimitMode(cfg.MaxConnsMode)
+	if err != nil {
+		return "", err
+	}
+	if cfg.MaxConns < 0 {
+		return "", errors.New("-max-conns must not be negative")
+	}
+	if cfg.MaxConns == 0 {
+		return "unlimited", nil
+	}
+	return fmt.Sprintf("%d (%s)", cfg.MaxConns, mode), nil
+}
+
+func checkReverseProxy(cfg *cli.Config) (string, error) {
+	target, err := proxy.ParseReverseTarget(cfg.ReverseTarget)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ReverseCertPath != "" || cfg.ReverseKeyPath != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.ReverseCertPath, cfg.ReverseKeyPath); err != nil {
+			return target.String(), fmt.Errorf("loading reverse proxy certificate: %w", err)
+		}
+	}
+	return target.String(), nil
+}
+
+func checkStorage(cfg *cli.Config) (string, error) {
+	mode, err := handlers.ParseStorageMode(cfg.Storage)
+	if err != nil {
+		return "", err
+	}
+	if mode == handlers.StorageMemory {
+		if cfg.BodyStore != "" {
+			return string(mode), errors.New("-body-store cannot be used with -storage memory")
+		}
+		return string(mode), nil
+	}
+	return fmt.Sprintf("%s, %s", mode, cfg.SQLitePath), checkWritableFile(cfg.SQLitePath, true)
+}
+
+func checkBodyStore(cfg *cli.Config) (string, error) {
+	if _, err := harlogger.ParseSize(cfg.BodyStoreMinSize); err != nil {
+		return cfg.BodyStore, fmt.Errorf("-body-store-min-size: %w", err)
+	}
+	return cfg.BodyStore, checkWritableDir(cfg.BodyStore)
+}
+
+func checkUI(cfg *cli.Config) (string, error) {
+	if (cfg.UITLSCert == "") != (cfg.UITLSKey == "") {
+		return "", errors.New("-ui-tls-cert and -ui-tls-key must be set together")
+	}
+	if _, err := api.NormalizeBasePath(cfg.UIBasePath); err != nil {
+		return cfg.UIHost, fmt.Errorf("-ui-base-path: %w", err)
+	}
+	if cfg.UITLSCert == "" {
+		return cfg.UIHost, nil
+	}
+	if _, err := tls.LoadX509KeyPair(cfg.UITLSCert, cfg.UITLSKey); err != nil {
+		return cfg.UIHost, fmt.Errorf("loading UI certificate: %w", err)
+	}
+	return cfg.UIHost + " (HTTPS)", nil
+}
+
+// checkWritableFile 确认可以写入path：已存在的文件以追加方式打开，不存在时在所在目录创建临时文件
+// createsDir 表示启动时会自动创建所在目录；检查过程不会修改或留下文件
+func checkWritableFile(path string, createsDir bool) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if !createsDir {
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+	}
+	return checkWritableDir(dir)
+}
+
+// checkCache 检查 -cache 目录是否可写，-cache-offline 必须与 -cache 一起使用
+func checkCache(cfg *cli.Config) (string, error) {
+	if cfg.CacheDir == "" {
+		return "-cache-offline", errors.New("-cache-offline requires -cache")
+	}
+	return cfg.CacheDir, checkWritableDir(cfg.CacheDir)
+}
+
+// checkWritableDir 确认可以在dir中创建文件，dir不存在时检查最近的已存在的上级目录（启动时会自动创建）
+func checkWritableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".proxycraft-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+func checkAnomalyThresholds(cfg *cli.Config) (string, error) {
+	thresholds, err := anomalyThresholds(cfg)
+	if err != nil || !thresholds.Enabled() {
+		return "", err
+	}
+	var parts []string
+	if thresholds.Slow > 0 {
+		parts = append(parts, "slow > "+thresholds.Slow.String())
+	}
+	if thresholds.Large > 0 {
+		parts = append(parts, "large > "+cfg.LargeThreshold)
+	}
+	return strings.Join(parts, ", "), nil
+}
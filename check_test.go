@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseCheckFlags 使用给定的命令行参数解析配置，测试结束后恢复flag和os.Args
+func parseCheckFlags(t *testing.T, args ...string) *cli.Config {
+	t.Helper()
+	origArgs := os.Args
+	origFlagCommandLine := flag.CommandLine
+	t.Cleanup(func() {
+		os.Args = origArgs
+		flag.CommandLine = origFlagCommandLine
+	})
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	for _, name := range []string{"PROXYCRAFT_LISTEN", "PROXYCRAFT_UPSTREAM_PROXY", "PROXYCRAFT_CA_CERT", "PROXYCRAFT_CA_KEY", "HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		t.Setenv(name, "")
+	}
+
+	flag.CommandLine = flag.NewFlagSet("cmd", flag.ExitOnError)
+	os.Args = append([]string{"cmd"}, args...)
+	return cli.ParseFlags()
+}
+
+func failedChecks(results []checkResult) []string {
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.Name)
+		}
+	}
+	return failed
+}
+
+func TestCheckConfigValid(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	harPath := filepath.Join(dir, "capture.har")
+	cfg := parseCheckFlags(t,
+		"-check",
+		"-in-memory-ca",
+		"-upstream-proxy", "http://"+upstream.Addr().String(),
+		"-o", harPath,
+		"-replace", "/foo/bar/g",
+		"-mode", "web",
+		"-sqlite-file", filepath.Join(dir, "db", "traffic.db"),
+		"-body-store", filepath.Join(dir, "bodies"),
+	)
+	assert.True(t, cfg.Check)
+
+	results := checkConfig(cfg)
+	assert.Empty(t, failedChecks(results))
+
+	var report bytes.Buffer
+	assert.True(t, printCheckReport(&report, results))
+	assert.Contains(t, report.String(), "upstream proxy: http://"+upstream.Addr().String()+" reachable")
+	assert.Contains(t, report.String(), "Configuration OK.")
+
+	// 检查过程不应创建任何文件
+	_, err = os.Stat(harPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "bodies"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCheckConfigBadUpstreamURL(t *testing.T) {
+	cfg := parseCheckFlags(t, "-check", "-in-memory-ca", "-upstream-proxy", "http://%zz:8080")
+
+	results := checkConfig(cfg)
+	assert.Equal(t, []string{"upstream proxy"}, failedChecks(results))
+
+	var report bytes.Buffer
+	assert.False(t, printCheckReport(&report, results))
+	assert.Contains(t, report.String(), "FAIL  upstream proxy: invalid upstream proxy")
+	assert.Contains(t, report.String(), "1 problem(s) found")
+}
+
+func TestCheckConfigReportsEachProblem(t *testing.T) {
+	dir := t.TempDir()
+	cfg := parseCheckFlags(t,
+		"-in-memory-ca",
+		"-o", filepath.Join(dir, "missing", "capture.har"),
+		"-use-ca-chain", filepath.Join(dir, "chain.pem"),
+		"-max-conns-mode", "drop",
+		"-cache-offline",
+	)
+
+	assert.ElementsMatch(t, []string{"CA certificate", "HAR output", "connection limit", "response cache"}, failedChecks(checkConfig(cfg)))
+}
+
+func TestCheckConfigRejectsInstallingInMemoryCA(t *testing.T) {
+	cfg := parseCheckFlags(t, "-check", "-in-memory-ca", "-install-ca")
+
+	results := checkConfig(cfg)
+	assert.Equal(t, []string{"CA certificate"}, failedChecks(results))
+}
@@ -3,30 +3,120 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configurable options for ProxyCraft.
 // These will be populated from command-line arguments.
 type Config struct {
-	ListenHost       string // Proxy server host
-	ListenPort       int    // Proxy server port
-	WebPort          int    // Web UI port
-	Verbose          bool   // More verbose
-	HarOutputFile    string // Save traffic to FILE (HAR format recommended)
-	AutoSaveInterval int    // Auto-save HAR file every N seconds (0 to disable)
-	Filter           string // Filter displayed traffic (e.g., "host=example.com")
-	ExportCAPath     string // Export the root CA certificate to FILEPATH and exit
-	UseCACertPath    string // Use custom root CA certificate from CERT_PATH
-	UseCAKeyPath     string // Use custom root CA private key from KEY_PATH
-	InstallCerts     bool   // Install CA certificate to system trust store
-	ForceReinstallCA bool   // Force reinstall CA certificate to system trust store
-	VerifyCATrust    bool   // Verify system trust for the CA certificate and exit
-	ShowHelp         bool   // Show this help message and exit
-	UpstreamProxy    string // Upstream proxy URL (e.g., "http://proxy.example.com:8080")
-	DumpTraffic      bool   // Enable dumping traffic content to console
-	Mode             string // 运行模式: "" (CLI模式) 或 "web" (Web界面模式)
-	SQLitePath       string // SQLite数据库路径
+	ListenHost       string        // Proxy server host
+	ListenPort       int           // Proxy server port
+	WebPort          int           // Web UI port
+	Verbose          bool          // More verbose, shortcut for -log-level debug
+	LogLevel         string        // Proxy log level: error, warn, info or debug
+	HarOutputFile    string        // Save traffic to FILE (HAR format recommended)
+	AutoSaveInterval int           // Auto-save HAR file every N seconds (0 to disable)
+	HarNoPages       bool          // Do not group HAR entries into pages by navigation
+	HarCompact       bool          // Write minified HAR JSON instead of indented
+	HarDecode        bool          // Store compressed text responses in the HAR as decoded text
+	HarMaxSize       string        // Start a new HAR file once the current one exceeds this size (e.g., "100MB")
+	HarRotate        time.Duration // Start a new HAR file every interval (0 to disable)
+	JSONLOutput      string        // Append one JSON line per transaction to FILE ("-" for stdout)
+	BinlogOutput     string        // Append compact binary capture records to FILE
+	ConvertInput     string        // Convert the binary capture FILE to HAR and exit
+	ConvertOutput    string        // HAR file written by -convert (positional argument or -o)
+	Filter           string        // Filter displayed traffic (e.g., "host=example.com")
+	ExportCAPath     string        // Export the root CA certificate to FILEPATH and exit
+	UseCACertPath    string        // Use custom root CA certificate from CERT_PATH
+	UseCAKeyPath     string        // Use custom root CA private key from KEY_PATH
+	UseCAChainPath   string        // PEM chain (intermediates, optionally the root) served after leaves signed by -use-ca
+	LeafOrg          string        // Organization (O) of generated leaf certificates
+	LeafOU           string        // Organizational unit (OU) of generated leaf certificates
+	ExtraSAN         string        // Comma-separated DNS names or IPs added to every generated leaf certificate
+	InMemoryCA       bool          // Generate a temporary CA in memory instead of using ~/.proxycraft
+	InstallCerts     bool          // Install CA certificate to system trust store
+	ForceReinstallCA bool          // Force reinstall CA certificate to system trust store
+	VerifyCATrust    bool          // Verify system trust for the CA certificate and exit
+	ShowCA           bool          // Print the CA subject, serial, validity and SHA-256 fingerprint and exit
+	TrustCA          bool          // Trust the CA certificate in system and user trust stores and exit
+	UntrustCA        bool          // Remove the CA certificate from system and user trust stores and exit
+	ShowHelp         bool          // Show this help message and exit
+	Check            bool          // Validate the configuration, print a report and exit without starting the proxy
+	UpstreamProxy    string        // Upstream proxy URL, comma-separated for a chain (e.g., "http://a:8080,http://b:3128")
+	NoUpstreamFor    string        // Comma-separated hosts, domain suffixes or CIDRs that bypass the upstream proxy
+	DoH              string        // DNS-over-HTTPS endpoint used to resolve upstream hostnames (empty uses the system resolver)
+	DoHFallback      bool          // Fall back to the system resolver when a DoH lookup fails
+	CertPins         []string      // Trust upstream certificates by SHA-256 fingerprint as host=sha256hex
+	DumpTraffic      bool          // Enable dumping traffic content to console
+	ReverseTarget    string        // Run as a reverse proxy in front of this backend (e.g., "https://backend:443")
+	ReverseCertPath  string        // TLS certificate for the reverse proxy listener (optional)
+	ReverseKeyPath   string        // TLS private key for the reverse proxy listener (optional)
+	ReverseHosts     string        // Comma-separated SNI hostnames, besides the backend's, that the reverse proxy issues certificates for
+	TLSMinVersion    string        // Minimum TLS version offered to clients (1.0-1.3)
+	TLSMaxVersion    string        // Maximum TLS version offered to clients (1.0-1.3)
+	TLSCiphers       string        // Comma-separated cipher suites offered to TLS <=1.2 clients
+	AutoPassthrough  bool          // Tunnel hosts whose clients reject the MITM certificate instead of intercepting them
+	MITMProcess      string        // Comma-separated process names whose CONNECTs are intercepted; other processes are tunneled
+	PassthroughTTL   time.Duration // How long a host stays tunneled after its client rejected the MITM certificate
+	RewriteCookies   bool          // Rewrite Set-Cookie Domain/Secure attributes when the client would reject them
+	NoDecompress     bool          // Forward and log compressed response bodies as-is
+	Recompress       bool          // Gzip text response bodies sent to clients that accept it
+	PassthroughBody  bool          // Stream bodies without buffering or decompressing when nothing records them
+	NoBodies         bool          // Privacy mode: record metadata and headers only, never read or store bodies
+	NoH2             bool          // Disable HTTP/2 to both the client and the upstream
+	NoH2Client       bool          // Only offer HTTP/1.1 to clients (ALPN and h2c)
+	NoH2Upstream     bool          // Only use HTTP/1.1 to upstream servers
+	SampleRate       float64       // Fraction of transactions to capture (errors and 5xx are always captured)
+	Replacements     []string      // Regex substitutions on text response bodies: [host]/pattern/replacement/[flags] (repeatable)
+	StripHeaders     []string      // Response headers to remove before forwarding (repeatable)
+	SetHeaders       []string      // Response headers to set as "Name: value" before forwarding (repeatable)
+	DisableCSP       bool          // Remove Content-Security-Policy response headers
+	DisableHSTS      bool          // Remove Strict-Transport-Security response headers
+	SkipBodyTypes    string        // Comma-separated content-type prefixes, optionally ">size", whose response bodies are not captured
+	RequestTimeout   time.Duration // Time to wait for upstream response headers (0 disables)
+	MaxHeaderSize    string        // Maximum size of client request headers and upstream response headers (e.g., "64KB")
+	ResponseTimeout  time.Duration // Total time for non-streaming responses (0 disables)
+	SSEKeepAlive     time.Duration // Inject an SSE comment heartbeat when the upstream stream is idle this long (0 disables)
+	SlowThreshold    time.Duration // Flag and log transactions that take longer than this (0 disables)
+	LargeThreshold   string        // Flag and log transactions whose request or response body exceeds this size (empty disables)
+	AddVia           bool          // Append "Via: 1.1 ProxyCraft" to forwarded messages and reject looped requests
+	OverrideUA       string        // Replace the User-Agent of forwarded requests (empty keeps the client's)
+	FollowRedirects  int           // Follow upstream redirects in the proxy up to this many hops (0 passes them to the client)
+	Chaos            string        // Inject errors or connection resets into matching requests: rate[,faults[,hosts]]
+	RateLimits       []string      // Per-host outbound rate limits as hosts=rate[/burst]
+	RateLimitMode    string        // What to do with requests beyond -rate-limit: delay or reject
+	CacheDir         string        // Cache GET/HEAD responses in this directory and serve repeats from it
+	CacheOffline     bool          // Serve only from -cache, answering misses with 504
+	Extracts         []string      // Capture JSON response values into variables: name=host:path:jsonpath (repeatable)
+	Injects          []string      // Set captured variables as request headers: name->Header[@hosts][: template] (repeatable)
+	ReplayLoad       string        // Replay every request of this HAR file as a load test, print a summary and exit
+	ReplayBase       string        // Send -replay-load requests to this base URL instead of their recorded targets
+	ReplayVars       []string      // Initial variables for {name} placeholders in replayed requests: name=value (repeatable)
+	ReplayWorkers    int           // Number of concurrent requests in -replay-load mode (-replay-concurrency)
+	ReplayRate       float64       // Maximum requests per second in -replay-load mode (0 for unlimited)
+	MaxConns         int           // Maximum concurrent client connections (0 for unlimited)
+	MaxConnsMode     string        // What to do with connections beyond -max-conns: queue or reject
+	HealthAddr       string        // Address of a standalone /healthz listener (empty disables)
+	Mode             string        // 运行模式: "" (CLI模式) 或 "web" (Web界面模式)
+	SQLitePath       string        // SQLite数据库路径
+	Storage          string        // Web模式的存储方式: memory、sqlite 或 both
+	BodyStore        string        // Web模式把较大的消息体按sha256保存到该目录，而不是写入SQLite
+	BodyStoreMinSize string        // 写入-body-store目录的消息体的最小大小
+	Retention        time.Duration // Web模式条目的保留时长，超过后由清理任务删除，为0时只按条数清理
+	UIHost           string        // Web模式界面监听的主机
+	UITLSCert        string        // Web模式界面的TLS证书文件
+	UITLSKey         string        // Web模式界面的TLS私钥文件
+	UIAdminToken     string        // Web模式管理接口（如 POST /api/ca/rotate）要求的Bearer令牌，为空时禁用
+	UIBasePath       string        // Web模式界面和API的路径前缀，用于反向代理到子路径
+	WSBatchInterval  time.Duration // Web模式合并实时推送的时间窗口
+	WSBatchSize      int           // Web模式单次批量推送的最大条目数
+	ListLimit        int           // Web模式列表接口返回的最近条目数，为0时返回保存的全部条目
+	LLMHosts         string        // 额外识别为LLM服务的主机，逗号分隔的 pattern[=provider]，用于Web模式的LLM解析和流式接口识别
 }
 
 // ParseFlags parses the command-line arguments and returns a Config struct.
@@ -37,22 +127,106 @@ func ParseFlags() *Config {
 	flag.StringVar(&cfg.ListenHost, "listen-host", "127.0.0.1", "IP address to listen on")
 	flag.IntVar(&cfg.ListenPort, "p", 38080, "Port to listen on")
 	flag.IntVar(&cfg.ListenPort, "listen-port", 38080, "Port to listen on")
-	flag.BoolVar(&cfg.Verbose, "v", false, "Enable verbose output")
-	flag.BoolVar(&cfg.Verbose, "verbose", false, "Enable verbose output")
+	flag.BoolVar(&cfg.Verbose, "v", false, "Enable verbose output (same as -log-level debug)")
+	flag.BoolVar(&cfg.Verbose, "verbose", false, "Enable verbose output (same as -log-level debug)")
+	flag.StringVar(&cfg.LogLevel, "log-level", "info", "Proxy log level: error, warn, info (one line per request) or debug (headers, SSE events)")
 	flag.StringVar(&cfg.HarOutputFile, "o", "", "Save traffic to FILE (HAR format recommended)")
 	flag.StringVar(&cfg.HarOutputFile, "output-file", "", "Save traffic to FILE (HAR format recommended)")
 	flag.IntVar(&cfg.AutoSaveInterval, "auto-save", 10, "Auto-save HAR file every N seconds (0 to disable)")
+	flag.BoolVar(&cfg.HarNoPages, "har-no-pages", false, "Do not group HAR entries into pages by top-level navigation")
+	flag.BoolVar(&cfg.HarCompact, "har-compact", false, "Write the HAR file as minified JSON instead of indented (smaller and faster to parse)")
+	flag.BoolVar(&cfg.HarDecode, "har-decode", false, "Store compressed text responses in the HAR as readable text, noting the original encoding and compressed size")
+	flag.StringVar(&cfg.HarMaxSize, "har-max-size", "", "Start a new HAR file once the current one exceeds this size (e.g., \"100MB\")")
+	flag.DurationVar(&cfg.HarRotate, "har-rotate", 0, "Start a new HAR file every interval (e.g., \"1h\"); 0 disables")
+	flag.StringVar(&cfg.JSONLOutput, "jsonl", "", "Append one JSON line (metadata and headers) per transaction to FILE, or \"-\" for stdout; works together with -o and web mode")
+	flag.StringVar(&cfg.BinlogOutput, "binlog", "", "Append compact binary records (headers and bodies) per transaction to FILE; convert to HAR later with -convert")
+	flag.StringVar(&cfg.ConvertInput, "convert", "", "Convert the binary capture FILE written by -binlog to HAR and exit (usage: -convert in.bin out.har)")
 	flag.StringVar(&cfg.Filter, "filter", "", "Filter displayed traffic (e.g., \"host=example.com\")")
 	flag.StringVar(&cfg.ExportCAPath, "export-ca", "", "Export the root CA certificate to FILEPATH and exit")
 	flag.StringVar(&cfg.UseCACertPath, "use-ca", "", "Use custom root CA certificate from CERT_PATH")
 	flag.StringVar(&cfg.UseCAKeyPath, "use-key", "", "Use custom root CA private key from KEY_PATH")
+	flag.StringVar(&cfg.UseCAChainPath, "use-ca-chain", "", "PEM file with the issuers of an intermediate -use-ca (intermediates, optionally the root), served after each leaf")
+	flag.StringVar(&cfg.LeafOrg, "leaf-org", "", "Organization (O) of generated leaf certificates (default \"ProxyCraft MITM Proxy\")")
+	flag.StringVar(&cfg.LeafOU, "leaf-ou", "", "Organizational unit (OU) of generated leaf certificates")
+	flag.StringVar(&cfg.ExtraSAN, "extra-san", "", "Comma-separated DNS names or IP addresses added to the SAN of every generated leaf certificate")
+	flag.BoolVar(&cfg.InMemoryCA, "in-memory-ca", false, "Generate a temporary CA in memory instead of reading/writing ~/.proxycraft")
 	flag.BoolVar(&cfg.InstallCerts, "install-ca", false, "Install the CA certificate to system trust store and exit")
 	flag.BoolVar(&cfg.ForceReinstallCA, "force-reinstall-ca", false, "Force reinstall the CA certificate to system trust store")
 	flag.BoolVar(&cfg.VerifyCATrust, "verify-ca", false, "Verify system trust for the CA certificate and exit")
-	flag.StringVar(&cfg.UpstreamProxy, "upstream-proxy", "", "Upstream proxy URL (e.g., \"http://proxy.example.com:8080\")")
+	flag.BoolVar(&cfg.ShowCA, "show-ca", false, "Print the CA certificate subject, serial, validity and SHA-256 fingerprint and exit")
+	flag.BoolVar(&cfg.TrustCA, "trust-ca", false, "Trust the CA certificate in system and user trust stores (browsers, keychains) and exit")
+	flag.BoolVar(&cfg.UntrustCA, "untrust-ca", false, "Remove the CA certificate from system and user trust stores and exit")
+	flag.BoolVar(&cfg.Check, "check", false, "Validate the configuration (CA files, upstream proxy reachability, output paths, rules), print a report and exit with status 1 on problems")
+	flag.StringVar(&cfg.UpstreamProxy, "upstream-proxy", "", "Upstream proxy URL, comma-separated for a proxy chain (e.g., \"http://proxy.example.com:8080\")")
+	flag.StringVar(&cfg.NoUpstreamFor, "no-upstream-for", "", "Comma-separated hosts, domain suffixes (.local) or CIDRs that connect directly instead of via -upstream-proxy (NO_PROXY is also honored)")
+	flag.StringVar(&cfg.DoH, "doh", "", "Resolve upstream hostnames via this DNS-over-HTTPS endpoint instead of the system resolver (e.g., \"https://dns.google/dns-query\")")
+	flag.BoolVar(&cfg.DoHFallback, "doh-fallback", false, "Fall back to the system resolver when a -doh lookup fails instead of failing the connection")
+	flag.Var((*stringList)(&cfg.CertPins), "pin", "Only accept an upstream certificate for this host if its SHA-256 fingerprint matches, as host=sha256hex (repeatable; trusts self-signed upstreams)")
+	flag.StringVar(&cfg.ReverseTarget, "reverse-target", "", "Run as an HTTPS reverse proxy forwarding all requests to this backend (e.g., \"https://backend:443\")")
+	flag.StringVar(&cfg.ReverseCertPath, "reverse-cert", "", "TLS certificate for the reverse proxy listener (default: issue one from the CA)")
+	flag.StringVar(&cfg.ReverseKeyPath, "reverse-key", "", "TLS private key for the reverse proxy listener")
+	flag.StringVar(&cfg.ReverseHosts, "reverse-hosts", "", "Comma-separated hostnames, besides the backend's, the reverse proxy issues certificates for; other SNI values get the backend's certificate")
+	flag.StringVar(&cfg.TLSMinVersion, "tls-min-version", "", "Minimum TLS version offered to clients: 1.0, 1.1, 1.2 or 1.3 (default 1.2)")
+	flag.StringVar(&cfg.TLSMaxVersion, "tls-max-version", "", "Maximum TLS version offered to clients: 1.0, 1.1, 1.2 or 1.3 (default 1.3)")
+	flag.StringVar(&cfg.TLSCiphers, "tls-ciphers", "", "Comma-separated cipher suites offered to TLS 1.2 and older clients (e.g., \"TLS_RSA_WITH_AES_128_CBC_SHA\")")
+	flag.BoolVar(&cfg.AutoPassthrough, "auto-passthrough", false, "When a client rejects the MITM certificate with a TLS alert (e.g., certificate pinning), tunnel later CONNECTs to that host without interception")
+	flag.DurationVar(&cfg.PassthroughTTL, "auto-passthrough-ttl", time.Hour, "How long a host stays tunneled after its client rejected the MITM certificate (with -auto-passthrough)")
+	flag.StringVar(&cfg.MITMProcess, "mitm-process", "", "Comma-separated names of local processes (e.g., \"curl,MyApp\") whose HTTPS traffic is intercepted; CONNECTs from other or unidentified processes are tunneled without interception")
+	flag.BoolVar(&cfg.RewriteCookies, "rewrite-cookies", false, "Rewrite Set-Cookie Domain/Secure attributes only when the client would otherwise reject them")
+	flag.BoolVar(&cfg.NoDecompress, "no-decompress", false, "Forward and log compressed response bodies as-is, keeping Content-Encoding")
+	flag.BoolVar(&cfg.Recompress, "recompress", false, "Gzip uncompressed text response bodies sent to clients whose Accept-Encoding allows it; logged bodies stay uncompressed and SSE streams are never compressed")
+	flag.BoolVar(&cfg.PassthroughBody, "passthrough-bodies", false, "Stream request/response bodies without buffering or decompressing them when no HAR file, -dump or web UI needs them (high-throughput forwarding)")
+	flag.BoolVar(&cfg.NoBodies, "no-bodies", false, "Privacy mode: record only metadata and headers in the web UI, HAR file and -dump output; request and response bodies are never read or stored (sizes come from Content-Length)")
+	flag.BoolVar(&cfg.NoH2, "no-h2", false, "Disable HTTP/2 to both clients and upstream servers (same as -no-h2-client -no-h2-upstream)")
+	flag.BoolVar(&cfg.NoH2Client, "no-h2-client", false, "Only offer HTTP/1.1 to clients, removing h2 from ALPN and disabling h2c")
+	flag.BoolVar(&cfg.NoH2Upstream, "no-h2-upstream", false, "Only use HTTP/1.1 when connecting to upstream servers")
+	flag.Float64Var(&cfg.SampleRate, "sample-rate", 1, "Capture only this fraction (0-1) of transactions; errors and 5xx responses are always captured")
+	flag.Var((*stringList)(&cfg.StripHeaders), "strip-header", "Remove this response header before forwarding and logging (repeatable, e.g. 'X-Frame-Options')")
+	flag.Var((*stringList)(&cfg.SetHeaders), "set-response-header", "Set a response header as \"Name: value\" before forwarding and logging, replacing existing values (repeatable, e.g. 'Access-Control-Allow-Origin: *')")
+	flag.BoolVar(&cfg.DisableCSP, "disable-csp", false, "Remove Content-Security-Policy and Content-Security-Policy-Report-Only response headers")
+	flag.BoolVar(&cfg.DisableHSTS, "disable-hsts", false, "Remove Strict-Transport-Security response headers so browsers do not force HTTPS while testing")
+	flag.Var((*stringList)(&cfg.Replacements), "replace", "Regex substitution on text response bodies as [host]/pattern/replacement/[flags], flags g,i,m,s (repeatable, e.g. '/foo/bar/g')")
+	flag.StringVar(&cfg.SkipBodyTypes, "skip-body-types", "video/,audio/,application/octet-stream>1MB", "Comma-separated binary content-type prefixes, optionally with \">size\", whose response bodies are passed through without being captured; empty captures everything")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", 20*time.Second, "Time to wait for upstream response headers, streaming responses included; 0 disables")
+	flag.StringVar(&cfg.MaxHeaderSize, "max-header-size", "1MB", "Maximum size of client request headers and upstream response headers (e.g., \"64KB\"); larger request headers are rejected with 431")
+	flag.DurationVar(&cfg.ResponseTimeout, "response-timeout", 30*time.Second, "Total time allowed for non-streaming responses, body included; SSE streams are exempt; 0 disables")
+	flag.DurationVar(&cfg.SSEKeepAlive, "sse-keepalive", 0, "Send a \": keep-alive\" SSE comment to the client whenever an event stream is idle upstream for this long (e.g., \"15s\"); 0 disables")
+	flag.DurationVar(&cfg.SlowThreshold, "slow-threshold", 0, "Log an [ANOMALY] line and mark web UI entries whose duration exceeds this (e.g., \"5s\"); 0 disables")
+	flag.StringVar(&cfg.LargeThreshold, "large-threshold", "", "Log an [ANOMALY] line and mark web UI entries whose request or response body exceeds this size (e.g., \"10MB\"); empty disables")
+	flag.BoolVar(&cfg.AddVia, "add-via", false, "Append \"Via: 1.1 ProxyCraft\" to forwarded requests and responses, and reject requests that already carry it with 508 Loop Detected")
+	flag.StringVar(&cfg.OverrideUA, "override-ua", "", "Replace the User-Agent header of forwarded requests with this value")
+	flag.Var((*redirectLimit)(&cfg.FollowRedirects), "follow-redirects", "Follow upstream 3xx redirects in the proxy and return the final response; -follow-redirects=N allows up to N hops (default 10 when given without a value)")
+	flag.StringVar(&cfg.Chaos, "chaos", "", "Chaos testing: fail this fraction of requests as rate[,faults[,hosts]], faults and hosts separated by | (e.g., \"0.1,500|503|reset,api.example.com\"); off by default")
+	flag.Var((*stringList)(&cfg.RateLimits), "rate-limit", "Limit requests forwarded to matching hosts as hosts=rate[/burst] in requests per second, hosts separated by | and counted per target host (repeatable, e.g. 'api.example.com=5/10')")
+	flag.StringVar(&cfg.RateLimitMode, "rate-limit-mode", "delay", "What to do with requests beyond -rate-limit: delay (queue them until allowed) or reject (reply 429)")
+	flag.StringVar(&cfg.CacheDir, "cache", "", "Cache GET/HEAD responses by method, URL and Vary headers in this directory and serve repeated requests from it without contacting the upstream")
+	flag.BoolVar(&cfg.CacheOffline, "cache-offline", false, "With -cache, serve only from the cache and answer requests that are not cached with 504")
+	flag.Var((*stringList)(&cfg.Extracts), "extract", "Capture a value from matching JSON responses into a variable as name=host:path:jsonpath, empty host/path match all (repeatable, e.g. 'token=api.example.com:/login:$.data.token')")
+	flag.Var((*stringList)(&cfg.Injects), "inject", "Set a captured variable as a header on later forwarded requests as name->Header[@hosts][: template] (repeatable, e.g. 'token->Authorization: Bearer {token}')")
+	flag.StringVar(&cfg.ReplayLoad, "replay-load", "", "Load test: replay every request recorded in this HAR file against its original target, print status codes and latencies, and exit")
+	flag.StringVar(&cfg.ReplayBase, "replay-base", "", "Send -replay-load requests to this base URL (e.g., \"http://staging:8080\") instead of their recorded scheme and host")
+	flag.Var((*stringList)(&cfg.ReplayVars), "replay-var", "Value for {name} placeholders in the URL, headers and body of replayed requests as name=value (repeatable, e.g. 'token=abc'); -extract and -inject also apply")
+	flag.IntVar(&cfg.ReplayWorkers, "replay-concurrency", 1, "Number of requests -replay-load sends concurrently; 1 replays them in recorded order")
+	flag.Float64Var(&cfg.ReplayRate, "replay-rate", 0, "Maximum requests per second sent by -replay-load; 0 means unlimited")
+	flag.IntVar(&cfg.MaxConns, "max-conns", 0, "Maximum number of concurrent client connections, CONNECT tunnels included; 0 means unlimited")
+	flag.StringVar(&cfg.MaxConnsMode, "max-conns-mode", "queue", "What to do with new connections beyond -max-conns: queue (wait for a free slot) or reject (reply 503)")
+	flag.StringVar(&cfg.HealthAddr, "health-addr", "", "Serve GET /healthz on this address (e.g., \"127.0.0.1:38081\") for liveness/readiness probes; web mode also serves it on the UI port")
 	flag.BoolVar(&cfg.DumpTraffic, "dump", false, "Dump traffic content to console with headers (binary content will not be displayed)")
 	flag.StringVar(&cfg.Mode, "mode", "", "Running mode: empty for CLI mode, 'web' for Web UI mode")
 	flag.StringVar(&cfg.SQLitePath, "sqlite-file", "proxycraft.db", "SQLite database file for persisting traffic entries")
+	flag.StringVar(&cfg.Storage, "storage", "both", "Where web mode keeps traffic entries: memory (no database file), sqlite, or both")
+	flag.StringVar(&cfg.BodyStore, "body-store", "", "Web mode: save request/response bodies larger than -body-store-min-size as sha256-named files in this directory instead of SQLite")
+	flag.StringVar(&cfg.BodyStoreMinSize, "body-store-min-size", "64KB", "Web mode: minimum body size written to -body-store")
+	flag.DurationVar(&cfg.Retention, "retention", 0, "Web mode: delete finished traffic entries older than this (e.g., \"24h\") and periodically reclaim the freed database space; 0 keeps entries until the entry limit is reached")
+	flag.StringVar(&cfg.UIHost, "ui-host", "127.0.0.1", "Web mode: host the UI/API listens on (use 0.0.0.0 for remote access)")
+	flag.StringVar(&cfg.UITLSCert, "ui-tls-cert", "", "Web mode: TLS certificate file; serves the UI over HTTPS together with -ui-tls-key")
+	flag.StringVar(&cfg.UITLSKey, "ui-tls-key", "", "Web mode: TLS private key file for -ui-tls-cert")
+	flag.StringVar(&cfg.UIAdminToken, "ui-admin-token", "", "Web mode: bearer token required by admin endpoints such as POST /api/ca/rotate, which are disabled without it (also PROXYCRAFT_ADMIN_TOKEN)")
+	flag.StringVar(&cfg.UIBasePath, "ui-base-path", "", "Web mode: serve the UI, API and socket.io under this path prefix (e.g., \"/proxycraft\") when reverse-proxied at a sub-path")
+	flag.DurationVar(&cfg.WSBatchInterval, "ws-batch-interval", 100*time.Millisecond, "Web mode: coalesce live traffic updates pushed to the UI over this window")
+	flag.IntVar(&cfg.WSBatchSize, "ws-batch-size", 200, "Web mode: maximum number of entries in one batched live update")
+	flag.IntVar(&cfg.ListLimit, "list-limit", 0, "Web mode: maximum number of most recent entries the UI and API list return; 0 returns every retained entry (2000)")
+	flag.StringVar(&cfg.LLMHosts, "llm-hosts", "", "Comma-separated hosts of self-hosted LLM endpoints, as pattern[=provider]; web mode parses their traffic as LLM traffic and Ollama-style streaming paths on them are forwarded as streams (e.g., \"llm.corp:8000,*.gpu.corp=ollama\"); provider defaults to openai-compatible")
 
 	// Custom help flag
 	flag.BoolVar(&cfg.ShowHelp, "h", false, "Show this help message and exit")
@@ -60,16 +234,184 @@ func ParseFlags() *Config {
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "ProxyCraft CLI - A command-line HTTPS/HTTP2/SSE proxy tool.\n")
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s trust-ca|untrust-ca\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
+	if err := applyEnv(cfg, setFlags()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if cfg.NoH2 {
+		cfg.NoH2Client = true
+		cfg.NoH2Upstream = true
+	}
+
+	// 支持子命令形式: proxycraft trust-ca / proxycraft untrust-ca
+	switch flag.Arg(0) {
+	case "trust-ca":
+		cfg.TrustCA = true
+	case "untrust-ca":
+		cfg.UntrustCA = true
+	}
+
+	// -convert in.bin out.har，未给出输出文件时使用-o
+	if cfg.ConvertInput != "" {
+		cfg.ConvertOutput = flag.Arg(0)
+		if cfg.ConvertOutput == "" {
+			cfg.ConvertOutput = cfg.HarOutputFile
+		}
+	}
+
 	return cfg
 }
 
+// setFlags returns the names of the flags given on the command line.
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// applyEnv fills options from environment variables when none of the
+// corresponding flags were given, so flags always take precedence:
+//
+//	-l/-listen-host, -p/-listen-port  PROXYCRAFT_LISTEN ("host:port", ":port" or "port")
+//	-upstream-proxy                   PROXYCRAFT_UPSTREAM_PROXY, then HTTPS_PROXY, then HTTP_PROXY
+//	-use-ca                           PROXYCRAFT_CA_CERT (certificate file path)
+//	-use-key                          PROXYCRAFT_CA_KEY (private key file path)
+//	-ui-admin-token                   PROXYCRAFT_ADMIN_TOKEN
+//
+// HTTPS_PROXY and HTTP_PROXY (or their lowercase forms) are ignored when they
+// point at ProxyCraft's own listen address, which is common in a shell that
+// routes its clients through the proxy.
+func applyEnv(cfg *Config, set map[string]bool) error {
+	if listen := envValue("PROXYCRAFT_LISTEN"); listen != "" {
+		host, port, err := parseListenEnv(listen)
+		if err != nil {
+			return err
+		}
+		if !set["l"] && !set["listen-host"] && host != "" {
+			cfg.ListenHost = host
+		}
+		if !set["p"] && !set["listen-port"] {
+			cfg.ListenPort = port
+		}
+	}
+
+	if !set["upstream-proxy"] {
+		if upstream := envValue("PROXYCRAFT_UPSTREAM_PROXY"); upstream != "" {
+			cfg.UpstreamProxy = upstream
+		} else {
+			for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+				if upstream := envValue(name); upstream != "" {
+					if !pointsAtListener(upstream, cfg) {
+						cfg.UpstreamProxy = upstream
+					}
+					break
+				}
+			}
+		}
+	}
+
+	if !set["use-ca"] {
+		cfg.UseCACertPath = envValue("PROXYCRAFT_CA_CERT")
+	}
+	if !set["use-key"] {
+		cfg.UseCAKeyPath = envValue("PROXYCRAFT_CA_KEY")
+	}
+	if !set["ui-admin-token"] {
+		cfg.UIAdminToken = envValue("PROXYCRAFT_ADMIN_TOKEN")
+	}
+	return nil
+}
+
+func envValue(name string) string {
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+// parseListenEnv parses PROXYCRAFT_LISTEN; an empty host in ":port" means all interfaces.
+func parseListenEnv(value string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(value)
+	if err != nil {
+		host, portStr = "", value
+	} else if host == "" {
+		host = "0.0.0.0"
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid PROXYCRAFT_LISTEN %q: want host:port, :port or port", value)
+	}
+	return host, port, nil
+}
+
+// pointsAtListener reports whether the proxy URL targets ProxyCraft's own listen address.
+func pointsAtListener(rawURL string, cfg *Config) bool {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Port() != strconv.Itoa(cfg.ListenPort) {
+		return false
+	}
+	host := u.Hostname()
+	if host == cfg.ListenHost || host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// stringList collects the values of a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// defaultFollowRedirects is the hop limit of -follow-redirects given without a value.
+const defaultFollowRedirects = 10
+
+// redirectLimit is the value of -follow-redirects: a hop count, or
+// defaultFollowRedirects when the flag is given without "=N".
+type redirectLimit int
+
+func (l *redirectLimit) String() string {
+	return strconv.Itoa(int(*l))
+}
+
+func (l *redirectLimit) Set(value string) error {
+	switch value {
+	case "true":
+		*l = defaultFollowRedirects
+		return nil
+	case "false":
+		*l = 0
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid redirect limit %q: want a non-negative number", value)
+	}
+	*l = redirectLimit(n)
+	return nil
+}
+
+// IsBoolFlag lets -follow-redirects be given without a value.
+func (l *redirectLimit) IsBoolFlag() bool { return true }
+
 // PrintHelp prints the help message.
 func PrintHelp() {
 	flag.Usage()
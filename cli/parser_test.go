@@ -25,6 +25,127 @@ func TestParseFlags(t *testing.T) {
 	assert.Equal(t, "192.168.1.1", cfg.ListenHost) // 修正之前的错误断言
 }
 
+func TestParseFlagsNoH2(t *testing.T) {
+	os.Args = []string{"cmd", "-no-h2-client"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := ParseFlags()
+	assert.True(t, cfg.NoH2Client)
+	assert.False(t, cfg.NoH2Upstream)
+
+	os.Args = []string{"cmd", "-no-h2"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg = ParseFlags()
+	assert.True(t, cfg.NoH2Client)
+	assert.True(t, cfg.NoH2Upstream)
+}
+
+func TestParseFlagsSkipBodyTypes(t *testing.T) {
+	os.Args = []string{"cmd"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := ParseFlags()
+	assert.Equal(t, "video/,audio/,application/octet-stream>1MB", cfg.SkipBodyTypes)
+
+	os.Args = []string{"cmd", "-skip-body-types", ""}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg = ParseFlags()
+	assert.Empty(t, cfg.SkipBodyTypes)
+}
+
+func TestParseFlagsMaxConns(t *testing.T) {
+	os.Args = []string{"cmd"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := ParseFlags()
+	assert.Equal(t, 0, cfg.MaxConns)
+	assert.Equal(t, "queue", cfg.MaxConnsMode)
+
+	os.Args = []string{"cmd", "-max-conns", "100", "-max-conns-mode", "reject"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg = ParseFlags()
+	assert.Equal(t, 100, cfg.MaxConns)
+	assert.Equal(t, "reject", cfg.MaxConnsMode)
+}
+
+func TestParseFlagsFollowRedirects(t *testing.T) {
+	for args, want := range map[string]int{"": 0, "-follow-redirects": 10, "-follow-redirects=3": 3, "-follow-redirects=false": 0} {
+		os.Args = []string{"cmd"}
+		if args != "" {
+			os.Args = append(os.Args, args)
+		}
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		cfg := ParseFlags()
+		assert.Equal(t, want, cfg.FollowRedirects, args)
+	}
+}
+
+// clearProxyEnv 清空ParseFlags会读取的环境变量，避免受运行环境影响
+func clearProxyEnv(t *testing.T) {
+	for _, name := range []string{"PROXYCRAFT_LISTEN", "PROXYCRAFT_UPSTREAM_PROXY", "PROXYCRAFT_CA_CERT", "PROXYCRAFT_CA_KEY", "HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestParseFlagsFromEnv(t *testing.T) {
+	clearProxyEnv(t)
+	t.Setenv("PROXYCRAFT_LISTEN", ":9000")
+	t.Setenv("PROXYCRAFT_UPSTREAM_PROXY", "http://corp:3128")
+	t.Setenv("HTTPS_PROXY", "http://other:8080")
+	t.Setenv("PROXYCRAFT_CA_CERT", "/etc/proxycraft/ca.crt")
+	t.Setenv("PROXYCRAFT_CA_KEY", "/etc/proxycraft/ca.key")
+
+	os.Args = []string{"cmd"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := ParseFlags()
+	assert.Equal(t, "0.0.0.0", cfg.ListenHost)
+	assert.Equal(t, 9000, cfg.ListenPort)
+	assert.Equal(t, "http://corp:3128", cfg.UpstreamProxy)
+	assert.Equal(t, "/etc/proxycraft/ca.crt", cfg.UseCACertPath)
+	assert.Equal(t, "/etc/proxycraft/ca.key", cfg.UseCAKeyPath)
+
+	// 命令行参数优先于环境变量
+	os.Args = []string{"cmd", "-p", "8000", "-upstream-proxy", "http://flag:1", "-use-ca", "flag.crt"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg = ParseFlags()
+	assert.Equal(t, "0.0.0.0", cfg.ListenHost)
+	assert.Equal(t, 8000, cfg.ListenPort)
+	assert.Equal(t, "http://flag:1", cfg.UpstreamProxy)
+	assert.Equal(t, "flag.crt", cfg.UseCACertPath)
+	assert.Equal(t, "/etc/proxycraft/ca.key", cfg.UseCAKeyPath)
+}
+
+func TestParseFlagsStandardProxyEnv(t *testing.T) {
+	clearProxyEnv(t)
+	t.Setenv("HTTP_PROXY", "http://plain:3128")
+	os.Args = []string{"cmd"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	assert.Equal(t, "http://plain:3128", ParseFlags().UpstreamProxy)
+
+	t.Setenv("https_proxy", "http://secure:3128")
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	assert.Equal(t, "http://secure:3128", ParseFlags().UpstreamProxy)
+
+	// 指向ProxyCraft自身监听地址的代理变量会被忽略，避免转发环路
+	t.Setenv("https_proxy", "http://127.0.0.1:38080")
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	assert.Empty(t, ParseFlags().UpstreamProxy)
+}
+
+func TestParseListenEnv(t *testing.T) {
+	host, port, err := parseListenEnv("10.0.0.1:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", host)
+	assert.Equal(t, 8080, port)
+
+	host, port, err = parseListenEnv("8081")
+	assert.NoError(t, err)
+	assert.Empty(t, host)
+	assert.Equal(t, 8081, port)
+
+	for _, value := range []string{"host", "host:http", ":70000"} {
+		_, _, err := parseListenEnv(value)
+		assert.Error(t, err, value)
+	}
+}
+
 // TestPrintHelp tests the PrintHelp function.
 func TestPrintHelp(t *testing.T) {
 	// 保存原始的os.Stderr并在测试后恢复
@@ -52,3 +173,20 @@ func TestPrintHelp(t *testing.T) {
 		t.Errorf("Help output should contain 'Usage', but got:\n%s", output)
 	}
 }
+
+func TestParseFlagsTrustSubcommand(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "trust-ca"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := ParseFlags()
+	assert.True(t, cfg.TrustCA)
+	assert.False(t, cfg.UntrustCA)
+
+	os.Args = []string{"cmd", "-untrust-ca"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg = ParseFlags()
+	assert.False(t, cfg.TrustCA)
+	assert.True(t, cfg.UntrustCA)
+}
@@ -0,0 +1,55 @@
+package harlogger
+
+import "strings"
+
+// EntryOption customizes a HAR entry before it is appended to the log.
+type EntryOption func(*Entry)
+
+// Annotation is a single piece of proxy context, e.g. {Key: "_mode", Value: "mitm"}.
+type Annotation struct {
+	Key   string
+	Value string
+}
+
+// WithConnection sets Entry.Connection to the upstream connection id and records whether
+// the connection was reused in the custom "_connectionReused" field. An empty id leaves
+// the connection passed to AddEntry untouched.
+func WithConnection(id string, reused bool) EntryOption {
+	return func(entry *Entry) {
+		if id == "" {
+			return
+		}
+		entry.Connection = id
+		entry.ConnectionReused = &reused
+	}
+}
+
+// WithAnnotations writes the annotations into Entry.Comment as "key: value" pairs joined by "; ",
+// for example "_mode: mitm; llm: openai". Annotations with an empty value are skipped and no
+// comment is written when none remain, so plain HAR consumers see nothing unusual.
+func WithAnnotations(annotations ...Annotation) EntryOption {
+	return func(entry *Entry) {
+		parts := make([]string, 0, len(annotations))
+		for _, annotation := range annotations {
+			if annotation.Value == "" {
+				continue
+			}
+			parts = append(parts, annotation.Key+": "+annotation.Value)
+		}
+		if len(parts) == 0 {
+			return
+		}
+		if entry.Comment != "" {
+			parts = append([]string{entry.Comment}, parts...)
+		}
+		entry.Comment = strings.Join(parts, "; ")
+	}
+}
+
+// WithWebSocketMessages stores the frames relayed over an upgraded WebSocket connection
+// in the custom "_webSocketMessages" field.
+func WithWebSocketMessages(messages []WebSocketMessage) EntryOption {
+	return func(entry *Entry) {
+		entry.WebSocketMessages = messages
+	}
+}
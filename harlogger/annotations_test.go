@@ -0,0 +1,51 @@
+package harlogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAnnotations(t *testing.T) {
+	entry := &Entry{}
+	WithAnnotations(Annotation{Key: "_mode", Value: "mitm"}, Annotation{Key: "retry", Value: ""}, Annotation{Key: "llm", Value: "openai"})(entry)
+	assert.Equal(t, "_mode: mitm; llm: openai", entry.Comment)
+
+	// 没有有效注解时不写comment
+	entry = &Entry{}
+	WithAnnotations(Annotation{Key: "llm", Value: ""})(entry)
+	assert.Empty(t, entry.Comment)
+
+	// 已有comment时追加
+	entry = &Entry{Comment: "replayed"}
+	WithAnnotations(Annotation{Key: "_mode", Value: "http"})(entry)
+	assert.Equal(t, "replayed; _mode: http", entry.Comment)
+}
+
+func TestLogger_AddEntryWithAnnotations(t *testing.T) {
+	logger := NewLogger(filepath.Join(t.TempDir(), "comment.har"), testProxyName, testProxyVersion)
+	req, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(`{}`)),
+	}
+
+	logger.AddEntry(req, resp, time.Now(), time.Millisecond, "", "", WithAnnotations(Annotation{Key: "_mode", Value: "mitm"}))
+	logger.AddEntry(req, resp, time.Now(), time.Millisecond, "", "")
+
+	require.Len(t, logger.h.Log.Entries, 2)
+	assert.Equal(t, "_mode: mitm", logger.h.Log.Entries[0].Comment)
+
+	// 未设置注解时JSON中不出现comment字段
+	data, err := json.Marshal(logger.h.Log.Entries[1])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"comment"`)
+}
@@ -0,0 +1,75 @@
+package harlogger
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SetDecodeCompressed controls how compressed response bodies (those still
+// carrying a Content-Encoding, e.g. with -no-decompress) are stored.
+//
+// By default the on-the-wire bytes are stored base64-encoded so they can be
+// reproduced exactly. When enabled, text responses are decompressed and stored
+// as readable text instead; the original encoding is kept in content.comment
+// and the compressed size in content._compressedSize, and content.compression
+// holds the bytes saved. Bodies that cannot be decoded (unknown encodings such
+// as br, corrupt data) and non-text bodies keep the default behavior.
+func (l *Logger) SetDecodeCompressed(decode bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.decodeCompressed = decode
+}
+
+// isCompressedEncoding reports whether a Content-Encoding value means the body
+// is not readable as is.
+func isCompressedEncoding(contentEncoding string) bool {
+	encoding := strings.ToLower(contentEncoding)
+	return strings.Contains(encoding, "gzip") ||
+		strings.Contains(encoding, "deflate") ||
+		strings.Contains(encoding, "br")
+}
+
+// decodeContentEncoding undoes the codings listed in a Content-Encoding value,
+// last applied first. Only gzip and deflate are supported.
+func decodeContentEncoding(data []byte, contentEncoding string) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		var (
+			decoded []byte
+			err     error
+		)
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			decoded, err = readAllFrom(gzip.NewReader(bytes.NewReader(data)))
+		case "deflate":
+			// deflate should carry a zlib header (RFC 1950) but some servers send raw deflate data
+			decoded, err = readAllFrom(zlib.NewReader(bytes.NewReader(data)))
+			if err != nil {
+				decoded, err = io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", coding, err)
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+func readAllFrom(r io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
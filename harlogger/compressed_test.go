@@ -0,0 +1,105 @@
+package harlogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func compressedResponse(body []byte, contentType, contentEncoding string) *http.Response {
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	resp.Header.Set("Content-Type", contentType)
+	resp.Header.Set("Content-Encoding", contentEncoding)
+	return resp
+}
+
+func TestBuildHARResponse_DecodeCompressed(t *testing.T) {
+	html := "<html><body>" + strings.Repeat("<p>hello compressed world</p>", 50) + "</body></html>"
+	compressed := gzipBytes(t, html)
+
+	t.Run("default keeps original bytes", func(t *testing.T) {
+		logger := NewLogger("", testProxyName, testProxyVersion)
+		harResp := logger.buildHARResponse(compressedResponse(compressed, "text/html; charset=utf-8", "gzip"))
+
+		assert.Equal(t, "base64", harResp.Content.Encoding)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(compressed), harResp.Content.Text)
+		assert.Equal(t, "content-encoding: gzip", harResp.Content.Comment)
+		assert.Zero(t, harResp.Content.CompressedSize)
+	})
+
+	t.Run("decoded text with original size", func(t *testing.T) {
+		logger := NewLogger("", testProxyName, testProxyVersion)
+		logger.SetDecodeCompressed(true)
+		harResp := logger.buildHARResponse(compressedResponse(compressed, "text/html; charset=utf-8", "gzip"))
+
+		assert.Empty(t, harResp.Content.Encoding)
+		assert.Equal(t, html, harResp.Content.Text)
+		assert.Equal(t, int64(len(html)), harResp.Content.Size)
+		assert.Equal(t, int64(len(compressed)), harResp.Content.CompressedSize)
+		assert.Equal(t, int64(len(html)-len(compressed)), harResp.Content.Compression)
+		assert.Equal(t, "content-encoding: gzip", harResp.Content.Comment)
+		assert.Equal(t, int64(len(compressed)), harResp.BodySize)
+
+		encoded, err := json.Marshal(harResp.Content)
+		require.NoError(t, err)
+		assert.Contains(t, string(encoded), `"_compressedSize":`)
+	})
+
+	t.Run("stacked encodings", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, _ = zw.Write(gzipBytes(t, "stacked"))
+		require.NoError(t, zw.Close())
+
+		logger := NewLogger("", testProxyName, testProxyVersion)
+		logger.SetDecodeCompressed(true)
+		harResp := logger.buildHARResponse(compressedResponse(buf.Bytes(), "text/plain", "gzip, deflate"))
+		assert.Equal(t, "stacked", harResp.Content.Text)
+	})
+
+	t.Run("undecodable falls back to base64", func(t *testing.T) {
+		logger := NewLogger("", testProxyName, testProxyVersion)
+		logger.SetDecodeCompressed(true)
+		raw := []byte("not really brotli")
+		harResp := logger.buildHARResponse(compressedResponse(raw, "text/plain", "br"))
+
+		assert.Equal(t, "base64", harResp.Content.Encoding)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(raw), harResp.Content.Text)
+		assert.Zero(t, harResp.Content.CompressedSize)
+	})
+
+	t.Run("binary keeps original bytes", func(t *testing.T) {
+		logger := NewLogger("", testProxyName, testProxyVersion)
+		logger.SetDecodeCompressed(true)
+		harResp := logger.buildHARResponse(compressedResponse(compressed, "application/octet-stream", "gzip"))
+
+		assert.Equal(t, "base64", harResp.Content.Encoding)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(compressed), harResp.Content.Text)
+	})
+}
@@ -65,7 +65,20 @@ type Entry struct {
 	Timings         Timings   `json:"timings"`
 	ServerIPAddress string    `json:"serverIPAddress,omitempty"` // Optional
 	Connection      string    `json:"connection,omitempty"`      // Optional
-	Comment         string    `json:"comment,omitempty"`         // Optional
+	// ConnectionReused is a custom field telling whether Connection was reused from the pool.
+	ConnectionReused *bool  `json:"_connectionReused,omitempty"`
+	Comment          string `json:"comment,omitempty"` // Optional
+	// WebSocketMessages is a custom field holding the frames relayed after a WebSocket upgrade.
+	WebSocketMessages []WebSocketMessage `json:"_webSocketMessages,omitempty"`
+}
+
+// WebSocketMessage is a single WebSocket frame in the "_webSocketMessages" format used by
+// Chrome DevTools HAR exports. Binary payloads are base64 encoded.
+type WebSocketMessage struct {
+	Type   string  `json:"type"` // "send" or "receive"
+	Time   float64 `json:"time"` // Unix time in seconds
+	Opcode int     `json:"opcode"`
+	Data   string  `json:"data"`
 }
 
 // Request contains detailed information about the HTTP request.
@@ -148,6 +161,9 @@ type Content struct {
 	Text        string `json:"text,omitempty"`     // Optional, decoded if possible
 	Encoding    string `json:"encoding,omitempty"` // Optional (e.g., "base64")
 	Comment     string `json:"comment,omitempty"`  // Optional
+	// CompressedSize is the size of the body as transferred when Text holds the
+	// decompressed body (custom field, see Logger.SetDecodeCompressed).
+	CompressedSize int64 `json:"_compressedSize,omitempty"`
 }
 
 // Cache contains information about the cache entry.
@@ -34,16 +34,32 @@ type Logger struct {
 	autoSaveEnabled  bool
 	autoSaveInterval time.Duration
 	cancelAutoSave   context.CancelFunc
+	pages            *pageTracker // nil when page grouping is disabled
+	compact          bool         // write minified JSON instead of two-space indentation
+	noBodies         bool         // never read or store request and response bodies, see SetNoBodies
+	decodeCompressed bool         // store compressed text responses as decoded text, see SetDecodeCompressed
+
+	// Rotation state, see rotate.go
+	template       string // outputFile before token expansion
+	fileIndex      int    // value of {n} for the current file, starting at 1
+	maxSize        int64  // rotate once the buffered entries exceed this many bytes (0 disables)
+	bufferedSize   int64  // size of the last save of the current file plus estimates for entries added since
+	rotateInterval time.Duration
+	cancelRotate   context.CancelFunc
 }
 
 // NewLogger creates a new HAR logger.
-// If outputFile is empty, logging will be disabled.
+// If outputFile is empty, logging will be disabled. outputFile may contain the
+// tokens {date}, {time}, {n} and {pid}, which are expanded for every file written.
 func NewLogger(outputFile string, proxyName string, proxyVersion string) *Logger {
 	l := &Logger{
-		outputFile:       outputFile,
+		outputFile:       expandOutputTemplate(outputFile, 1, time.Now()),
 		enabled:          outputFile != "",
 		autoSaveEnabled:  false,
 		autoSaveInterval: 30 * time.Second, // Default to 30 seconds
+		pages:            newPageTracker(),
+		template:         outputFile,
+		fileIndex:        1,
 	}
 	if l.enabled {
 		l.h = &HAR{
@@ -60,13 +76,40 @@ func NewLogger(outputFile string, proxyName string, proxyVersion string) *Logger
 	return l
 }
 
+// SetCompact makes Save write minified JSON instead of the default two-space
+// indentation, which roughly halves the size of large captures.
+func (l *Logger) SetCompact(compact bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.compact = compact
+}
+
+// SetNoBodies makes the logger record only metadata and headers: request and
+// response bodies are never read, and their sizes come from Content-Length.
+func (l *Logger) SetNoBodies(noBodies bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.noBodies = noBodies
+}
+
 // IsEnabled checks if HAR logging is active.
 func (l *Logger) IsEnabled() bool {
 	return l.enabled
 }
 
 // AddEntry records a new HTTP transaction (request and response) to the HAR log.
-func (l *Logger) AddEntry(req *http.Request, resp *http.Response, startedDateTime time.Time, timeTaken time.Duration, serverIP string, connectionID string) {
+// Options such as WithAnnotations can attach extra information to the entry.
+func (l *Logger) AddEntry(req *http.Request, resp *http.Response, startedDateTime time.Time, timeTaken time.Duration, serverIP string, connectionID string, opts ...EntryOption) {
+	l.addEntry(req, resp, startedDateTime, timeTaken, serverIP, connectionID, true, opts)
+}
+
+// AddEntryWithoutBody records a transaction without reading the response body.
+// Only response metadata is stored; the body size is taken from Content-Length.
+func (l *Logger) AddEntryWithoutBody(req *http.Request, resp *http.Response, startedDateTime time.Time, timeTaken time.Duration, serverIP string, connectionID string, opts ...EntryOption) {
+	l.addEntry(req, resp, startedDateTime, timeTaken, serverIP, connectionID, false, opts)
+}
+
+func (l *Logger) addEntry(req *http.Request, resp *http.Response, startedDateTime time.Time, timeTaken time.Duration, serverIP string, connectionID string, captureBody bool, opts []EntryOption) {
 	if !l.IsEnabled() {
 		return
 	}
@@ -75,7 +118,15 @@ func (l *Logger) AddEntry(req *http.Request, resp *http.Response, startedDateTim
 	defer l.mu.Unlock()
 
 	harReq := l.buildHARRequest(req)
-	harResp := l.buildHARResponse(resp)
+	var harResp Response
+	switch {
+	case ResponseHasNoBody(resp):
+		harResp = l.buildHARResponseWithoutContent(resp)
+	case (captureBody && !l.noBodies) || resp == nil:
+		harResp = l.buildHARResponse(resp)
+	default:
+		harResp = l.buildHARResponseMetadata(resp)
+	}
 
 	entry := Entry{
 		StartedDateTime: startedDateTime.UTC(), // HAR spec recommends UTC
@@ -87,8 +138,13 @@ func (l *Logger) AddEntry(req *http.Request, resp *http.Response, startedDateTim
 		ServerIPAddress: serverIP,
 		Connection:      connectionID, // Optional, can be a unique ID for the TCP/IP connection
 	}
+	for _, opt := range opts {
+		opt(&entry)
+	}
+	l.assignPage(&entry, req, resp)
 
 	l.h.Log.Entries = append(l.h.Log.Entries, entry)
+	l.rotateIfOversized(&entry)
 }
 
 // calculateHeadersSize calculates the approximate size of HTTP headers.
@@ -132,6 +188,21 @@ func (l *Logger) buildHARRequest(req *http.Request) Request {
 	if req.ContentLength > 0 {
 		bodySize = req.ContentLength
 	}
+	if l.noBodies {
+		if req.ContentLength == 0 {
+			bodySize = 0
+		}
+		return Request{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     l.buildHARCookies(req.Cookies()),
+			Headers:     l.buildHARHeaders(req.Header),
+			QueryString: l.buildHARQueryString(req.URL.Query()),
+			HeadersSize: calculateHeadersSize(req.Header),
+			BodySize:    bodySize,
+		}
+	}
 
 	var postData *PostData
 	bodyBytes, err := readAndRestoreBody(&req.Body, req.ContentLength) // Capture and restore body
@@ -235,20 +306,37 @@ func (l *Logger) buildHARResponse(resp *http.Response) Response {
 
 	if len(bodyBytes) > 0 {
 		contentEncodingHeader := resp.Header.Get("Content-Encoding")
-		// Check if common compression encodings are used.
-		// HAR spec doesn't explicitly state how to handle Content-Encoding for text field,
-		// but if it's compressed, string(bodyBytes) is not useful as "text".
-		isCompressed := strings.Contains(strings.ToLower(contentEncodingHeader), "gzip") ||
-			strings.Contains(strings.ToLower(contentEncodingHeader), "deflate") ||
-			strings.Contains(strings.ToLower(contentEncodingHeader), "br")
-
-		if isTextMimeType(mimeType) && !isCompressed {
+		// HAR spec doesn't explicitly state how to handle Content-Encoding for the text field,
+		// but if it's compressed, string(bodyBytes) is not useful as "text". Compressed bodies
+		// are stored as base64 of the original bytes unless decodeCompressed is set.
+		isCompressed := isCompressedEncoding(contentEncodingHeader)
+
+		var decoded []byte
+		if isCompressed && l.decodeCompressed && isTextMimeType(mimeType) {
+			var err error
+			if decoded, err = decodeContentEncoding(bodyBytes, contentEncodingHeader); err != nil {
+				log.Printf("Error decoding compressed response body for HAR, storing it as base64: %v", err)
+				decoded = nil
+			}
+		}
+
+		switch {
+		case decoded != nil:
+			content.Text = string(decoded)
+			content.Size = int64(len(decoded))
+			content.CompressedSize = actualBodySize
+			content.Compression = content.Size - actualBodySize
+		case isTextMimeType(mimeType) && !isCompressed:
 			content.Text = string(bodyBytes)
-		} else {
+		default:
 			// For non-text types, or for compressed text types, use base64
 			content.Text = base64.StdEncoding.EncodeToString(bodyBytes)
 			content.Encoding = "base64"
 		}
+		if isCompressed {
+			// Tell readers how the body was encoded on the wire (and how to decode it if stored as is)
+			content.Comment = "content-encoding: " + contentEncodingHeader
+		}
 	}
 
 	// Update bodySize if it was initially -1 (chunked) or different from ContentLength
@@ -269,6 +357,58 @@ func (l *Logger) buildHARResponse(resp *http.Response) Response {
 	}
 }
 
+// buildHARResponseMetadata builds a HAR response without touching the body.
+func (l *Logger) buildHARResponseMetadata(resp *http.Response) Response {
+	bodySize := int64(-1)
+	contentSize := int64(0)
+	if resp.ContentLength >= 0 {
+		bodySize = resp.ContentLength
+		contentSize = resp.ContentLength
+	}
+
+	return Response{
+		Status:      resp.StatusCode,
+		StatusText:  resp.Status,
+		HTTPVersion: resp.Proto,
+		Cookies:     l.buildHARCookies(resp.Cookies()),
+		Headers:     l.buildHARHeaders(resp.Header),
+		Content: Content{
+			Size:     contentSize,
+			MimeType: resp.Header.Get("Content-Type"),
+			Comment:  "body not captured",
+		},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: calculateHeadersSize(resp.Header),
+		BodySize:    bodySize,
+	}
+}
+
+// buildHARResponseWithoutContent builds a HAR response for a status or method that
+// never carries a body. The body is not read, so a Content-Length echoed by a HEAD
+// response does not show up as a phantom body size.
+func (l *Logger) buildHARResponseWithoutContent(resp *http.Response) Response {
+	harResp := l.buildHARResponseMetadata(resp)
+	harResp.BodySize = 0
+	harResp.Content.Size = 0
+	harResp.Content.Comment = ""
+	return harResp
+}
+
+// ResponseHasNoBody reports whether resp must not have a body: responses to HEAD
+// requests and 1xx, 204 and 304 responses (RFC 9110). The Content-Length of such a
+// response describes the corresponding GET response, not a body.
+func ResponseHasNoBody(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return true
+	}
+	return (resp.StatusCode >= 100 && resp.StatusCode < 200) ||
+		resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified
+}
+
 func (l *Logger) buildHARCookies(cookies []*http.Cookie) []Cookie {
 	harCookies := make([]Cookie, 0, len(cookies))
 	for _, c := range cookies {
@@ -350,14 +490,22 @@ func (l *Logger) Save() error {
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.saveLocked()
+}
 
+// saveLocked writes the buffered log to the current output file.
+// Must be called with l.mu held.
+func (l *Logger) saveLocked() error {
 	file, err := os.Create(l.outputFile)
 	if err != nil {
 		return fmt.Errorf("failed to create HAR output file %s: %w", l.outputFile, err)
 	}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
+	written := &countingWriter{w: file}
+	encoder := json.NewEncoder(written)
+	if !l.compact {
+		encoder.SetIndent("", "  ")
+	}
 	encodeErr := encoder.Encode(l.h)
 
 	closeErr := file.Close() // Close the file and check for error
@@ -371,6 +519,7 @@ func (l *Logger) Save() error {
 		return fmt.Errorf("failed to close HAR output file %s: %w", l.outputFile, closeErr)
 	}
 
+	l.bufferedSize = written.n
 	log.Printf("HAR log successfully saved to %s with %d entries.", l.outputFile, len(l.h.Log.Entries))
 	return nil // Both succeeded
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -617,6 +618,37 @@ func TestLogger_Save(t *testing.T) {
 		assert.Empty(t, harData.Log.Entries, "HAR data should have no entries")
 	})
 
+	t.Run("save_compact_smaller_than_indented", func(t *testing.T) {
+		dir := t.TempDir()
+		save := func(name string, compact bool) []byte {
+			outputFile := filepath.Join(dir, name)
+			logger := NewLogger(outputFile, testProxyName, testProxyVersion)
+			logger.SetCompact(compact)
+			req, _ := http.NewRequest("GET", "http://example.com/api?q=1", nil)
+			req.Header.Set("Accept", "application/json")
+			resp := &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"ok":true}`)), Header: make(http.Header)}
+			resp.Header.Set("Content-Type", "application/json")
+			logger.AddEntry(req, resp, time.Unix(1700000000, 0), 100*time.Millisecond, "127.0.0.1", "1")
+			require.NoError(t, logger.Save())
+			data, err := os.ReadFile(outputFile)
+			require.NoError(t, err)
+			return data
+		}
+
+		indented := save("indented.har", false)
+		compact := save("compact.har", true)
+
+		assert.Contains(t, string(indented), "\n  \"log\": {")
+		assert.Equal(t, 1, bytes.Count(compact, []byte("\n")), "compact output should be a single line")
+		assert.Less(t, len(compact), len(indented))
+
+		// 两种格式的内容相同
+		var indentedHAR, compactHAR HAR
+		require.NoError(t, json.Unmarshal(indented, &indentedHAR))
+		require.NoError(t, json.Unmarshal(compact, &compactHAR))
+		assert.Equal(t, indentedHAR, compactHAR)
+	})
+
 	t.Run("save_disabled_logger", func(t *testing.T) {
 		logger := NewLogger("", testProxyName, testProxyVersion)
 		err := logger.Save()
@@ -829,3 +861,79 @@ func TestHARLogger(t *testing.T) {
 }
 
 // 添加更多测试用例...
+
+// TestLogger_AddEntryWithoutBody tests that metadata-only entries leave the body unread.
+func TestLogger_AddEntryWithoutBody(t *testing.T) {
+	logger := NewLogger("test_add_entry_without_body.har", testProxyName, testProxyVersion)
+	defer os.Remove("test_add_entry_without_body.har")
+
+	req, err := http.NewRequest("GET", "http://example.com/video.mp4", nil)
+	require.NoError(t, err)
+
+	respBody := "binary video payload"
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+	}
+	resp.Header.Set("Content-Type", "video/mp4")
+
+	logger.AddEntryWithoutBody(req, resp, time.Now(), 10*time.Millisecond, "127.0.0.1", "conn-1")
+
+	require.Len(t, logger.h.Log.Entries, 1)
+	content := logger.h.Log.Entries[0].Response.Content
+	assert.Equal(t, int64(len(respBody)), content.Size)
+	assert.Equal(t, "video/mp4", content.MimeType)
+	assert.Empty(t, content.Text)
+	assert.Equal(t, int64(len(respBody)), logger.h.Log.Entries[0].Response.BodySize)
+
+	// 响应体未被读取，仍可完整转发给客户端
+	remaining, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, respBody, string(remaining))
+}
+
+func TestLogger_AddEntryBodylessResponses(t *testing.T) {
+	logger := NewLogger("test_add_entry_bodyless.har", testProxyName, testProxyVersion)
+	defer os.Remove("test_add_entry_bodyless.har")
+
+	// HEAD 响应的 Content-Length 描述的是 GET 响应体，不能记为响应体大小
+	headReq, err := http.NewRequest(http.MethodHead, "http://example.com/index.html", nil)
+	require.NoError(t, err)
+	headResp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		Header:        http.Header{"Content-Type": {"text/html"}, "Content-Length": {"1234"}},
+		Body:          http.NoBody,
+		ContentLength: 1234,
+		Request:       headReq,
+	}
+	logger.AddEntry(headReq, headResp, time.Now(), time.Millisecond, "", "")
+	logger.AddEntryWithoutBody(headReq, headResp, time.Now(), time.Millisecond, "", "")
+
+	getReq, err := http.NewRequest(http.MethodGet, "http://example.com/index.html", nil)
+	require.NoError(t, err)
+	notModified := &http.Response{
+		StatusCode:    http.StatusNotModified,
+		Status:        "304 Not Modified",
+		Proto:         "HTTP/1.1",
+		Header:        http.Header{"Etag": {`"v1"`}, "Content-Length": {"1234"}},
+		Body:          http.NoBody,
+		ContentLength: -1,
+	}
+	logger.AddEntry(getReq, notModified, time.Now(), time.Millisecond, "", "")
+
+	require.Len(t, logger.h.Log.Entries, 3)
+	for _, entry := range logger.h.Log.Entries {
+		assert.Equal(t, int64(0), entry.Response.BodySize, entry.Request.Method)
+		assert.Equal(t, int64(0), entry.Response.Content.Size)
+		assert.Empty(t, entry.Response.Content.Text)
+		assert.Empty(t, entry.Response.Content.Comment)
+	}
+	assert.Equal(t, "text/html", logger.h.Log.Entries[0].Response.Content.MimeType)
+	assert.Equal(t, http.StatusNotModified, logger.h.Log.Entries[2].Response.Status)
+}
@@ -0,0 +1,141 @@
+package harlogger
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// maxTrackedPages bounds how many recent pages can still be matched by Referer.
+const maxTrackedPages = 100
+
+// pageTracker groups entries into HAR pages by detecting top-level document navigations.
+// It is not thread-safe; the Logger calls it while holding its mutex.
+type pageTracker struct {
+	current    string            // ID of the page new entries are attributed to
+	currentURL string            // normalized document URL of the current page
+	byURL      map[string]string // document URL -> page ID, used to attribute entries by Referer
+	order      []string          // document URLs in byURL, oldest first
+	count      int
+}
+
+func newPageTracker() *pageTracker {
+	return &pageTracker{byURL: make(map[string]string)}
+}
+
+// SetPageGrouping enables or disables grouping entries into HAR pages.
+// Grouping is enabled by default; disabling it only affects entries added afterwards.
+func (l *Logger) SetPageGrouping(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if enabled && l.pages == nil {
+		l.pages = newPageTracker()
+	} else if !enabled {
+		l.pages = nil
+	}
+}
+
+// assignPage sets entry.Pageref, appending a new Page to the log when the entry is a navigation.
+// Must be called with l.mu held.
+func (l *Logger) assignPage(entry *Entry, req *http.Request, resp *http.Response) {
+	if l.pages == nil || req == nil || req.URL == nil {
+		return
+	}
+
+	if isNavigation(req, resp) {
+		entry.Pageref = l.startPage(entry, req.URL.String())
+		return
+	}
+
+	// Subresources still loading after a navigation carry the Referer of the page that requested them
+	if referer := req.Header.Get("Referer"); referer != "" {
+		normalized := normalizePageURL(referer)
+		if pageID, ok := l.pages.byURL[normalized]; ok {
+			entry.Pageref = pageID
+			return
+		}
+		// A Referer from a document we have not seen means the client moved to another page
+		// without a detectable navigation (history.pushState, cached document, ...)
+		if l.pages.current == "" || !isOriginOf(normalized, l.pages.currentURL) {
+			entry.Pageref = l.startPage(entry, referer)
+			return
+		}
+	}
+	entry.Pageref = l.pages.current
+}
+
+// startPage appends a new Page for documentURL, makes it current and returns its ID.
+// Must be called with l.mu held.
+func (l *Logger) startPage(entry *Entry, documentURL string) string {
+	l.pages.count++
+	page := Page{
+		StartedDateTime: entry.StartedDateTime,
+		ID:              fmt.Sprintf("page_%d", l.pages.count),
+		Title:           documentURL,
+	}
+	l.h.Log.Pages = append(l.h.Log.Pages, page)
+	l.pages.current = page.ID
+	l.pages.currentURL = normalizePageURL(documentURL)
+	l.pages.remember(l.pages.currentURL, page.ID)
+	return page.ID
+}
+
+// remember maps a document URL to its page, forgetting the oldest URL beyond maxTrackedPages.
+func (p *pageTracker) remember(documentURL, pageID string) {
+	if _, ok := p.byURL[documentURL]; !ok {
+		p.order = append(p.order, documentURL)
+	}
+	p.byURL[documentURL] = pageID
+	for len(p.order) > maxTrackedPages {
+		delete(p.byURL, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+// isOriginOf reports whether referer is the bare origin of documentURL, as sent by
+// the default strict-origin-when-cross-origin Referrer-Policy on cross-origin requests.
+func isOriginOf(referer, documentURL string) bool {
+	r, err := url.Parse(referer)
+	if err != nil || (r.Path != "" && r.Path != "/") || r.RawQuery != "" {
+		return false
+	}
+	d, err := url.Parse(documentURL)
+	if err != nil {
+		return false
+	}
+	return r.Scheme == d.Scheme && r.Host == d.Host
+}
+
+// isNavigation reports whether the transaction looks like a top-level document load:
+// a GET answered with HTML, and, when the client sends Fetch Metadata, Sec-Fetch-Mode: navigate
+// to a document (not an iframe).
+func isNavigation(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet || resp == nil {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return false
+	}
+
+	if mode := req.Header.Get("Sec-Fetch-Mode"); mode != "" {
+		if mode != "navigate" {
+			return false
+		}
+		if dest := req.Header.Get("Sec-Fetch-Dest"); dest != "" && dest != "document" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizePageURL drops the fragment so that Referer values match the document URL.
+func normalizePageURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Fragment = ""
+	return u.String()
+}
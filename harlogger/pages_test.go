@@ -0,0 +1,107 @@
+package harlogger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func addTestEntry(logger *Logger, rawURL string, headers map[string]string, contentType string) {
+	req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       io.NopCloser(bytes.NewBufferString("body")),
+	}
+	logger.AddEntry(req, resp, time.Now(), 10*time.Millisecond, "", "")
+}
+
+// TestLogger_PagesGroupedByNavigation tests that two navigations produce two pages.
+func TestLogger_PagesGroupedByNavigation(t *testing.T) {
+	logger := NewLogger(filepath.Join(t.TempDir(), "pages.har"), testProxyName, testProxyVersion)
+	navigate := map[string]string{"Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"}
+
+	addTestEntry(logger, "https://example.com/", navigate, "text/html; charset=utf-8")
+	addTestEntry(logger, "https://example.com/app.js", map[string]string{"Sec-Fetch-Mode": "no-cors", "Referer": "https://example.com/"}, "application/javascript")
+	addTestEntry(logger, "https://example.com/about", navigate, "text/html")
+	addTestEntry(logger, "https://example.com/api", map[string]string{"Sec-Fetch-Mode": "cors", "Referer": "https://example.com/about"}, "application/json")
+	// A late subresource of the first page is still attributed to it through its Referer
+	addTestEntry(logger, "https://example.com/late.css", map[string]string{"Sec-Fetch-Mode": "no-cors", "Referer": "https://example.com/"}, "text/css")
+	// An iframe document is not a top-level navigation
+	addTestEntry(logger, "https://ads.example.net/frame", map[string]string{"Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "iframe", "Referer": "https://example.com/about"}, "text/html")
+
+	pages := logger.h.Log.Pages
+	require.Len(t, pages, 2)
+	assert.Equal(t, "page_1", pages[0].ID)
+	assert.Equal(t, "https://example.com/", pages[0].Title)
+	assert.Equal(t, "page_2", pages[1].ID)
+	assert.Equal(t, "https://example.com/about", pages[1].Title)
+	assert.False(t, pages[0].StartedDateTime.IsZero())
+
+	var refs []string
+	for _, entry := range logger.h.Log.Entries {
+		refs = append(refs, entry.Pageref)
+	}
+	assert.Equal(t, []string{"page_1", "page_1", "page_2", "page_2", "page_1", "page_2"}, refs)
+}
+
+// TestLogger_PageGroupingDisabled tests that no pages are written when grouping is disabled.
+func TestLogger_PageGroupingDisabled(t *testing.T) {
+	logger := NewLogger(filepath.Join(t.TempDir(), "pages.har"), testProxyName, testProxyVersion)
+	logger.SetPageGrouping(false)
+
+	addTestEntry(logger, "https://example.com/", map[string]string{"Sec-Fetch-Mode": "navigate"}, "text/html")
+	addTestEntry(logger, "https://example.com/about", nil, "text/html")
+
+	assert.Empty(t, logger.h.Log.Pages)
+	for _, entry := range logger.h.Log.Entries {
+		assert.Empty(t, entry.Pageref)
+	}
+}
+
+// TestLogger_PageStartedOnRefererChange tests that subresources referred by an unseen document start a new page.
+func TestLogger_PageStartedOnRefererChange(t *testing.T) {
+	logger := NewLogger(filepath.Join(t.TempDir(), "pages.har"), testProxyName, testProxyVersion)
+
+	addTestEntry(logger, "https://example.com/", map[string]string{"Sec-Fetch-Mode": "navigate"}, "text/html")
+	// A cross-origin request only carries the origin of the current page
+	addTestEntry(logger, "https://cdn.example.net/lib.js", map[string]string{"Referer": "https://example.com/"}, "application/javascript")
+	addTestEntry(logger, "https://api.example.net/user", map[string]string{"Referer": "https://example.com/"}, "application/json")
+	// A client-side route change is only visible through the Referer
+	addTestEntry(logger, "https://example.com/api/items", map[string]string{"Referer": "https://example.com/items"}, "application/json")
+	addTestEntry(logger, "https://example.com/api/more", map[string]string{"Referer": "https://example.com/items"}, "application/json")
+
+	pages := logger.h.Log.Pages
+	require.Len(t, pages, 2)
+	assert.Equal(t, "https://example.com/items", pages[1].Title)
+
+	var refs []string
+	for _, entry := range logger.h.Log.Entries {
+		refs = append(refs, entry.Pageref)
+	}
+	assert.Equal(t, []string{"page_1", "page_1", "page_1", "page_2", "page_2"}, refs)
+}
+
+// TestPageTracker_BoundsTrackedURLs tests that only the most recent pages are kept for Referer matching.
+func TestPageTracker_BoundsTrackedURLs(t *testing.T) {
+	tracker := newPageTracker()
+	for i := 0; i < maxTrackedPages+10; i++ {
+		tracker.remember(fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("page_%d", i+1))
+	}
+
+	assert.Len(t, tracker.byURL, maxTrackedPages)
+	assert.Len(t, tracker.order, maxTrackedPages)
+	assert.NotContains(t, tracker.byURL, "https://example.com/0")
+	assert.Contains(t, tracker.byURL, fmt.Sprintf("https://example.com/%d", maxTrackedPages+9))
+}
@@ -0,0 +1,53 @@
+package harlogger
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+)
+
+// ReadFile reads a HAR file, either one written by Logger or one exported by a browser.
+func ReadFile(path string) (*HAR, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	har, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return har, nil
+}
+
+// Decode reads a HAR document from r.
+func Decode(r io.Reader) (*HAR, error) {
+	var har HAR
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+	return &har, nil
+}
+
+// Body returns the raw request body: Text decoded according to Encoding, or the
+// url-encoded Params when Text is empty (as some browsers export form posts).
+func (p *PostData) Body() ([]byte, error) {
+	if p == nil {
+		return nil, nil
+	}
+	if p.Text == "" && len(p.Params) > 0 {
+		values := url.Values{}
+		for _, param := range p.Params {
+			values.Add(param.Name, param.Value)
+		}
+		return []byte(values.Encode()), nil
+	}
+	if p.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(p.Text)
+	}
+	return []byte(p.Text), nil
+}
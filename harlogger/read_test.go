@@ -0,0 +1,53 @@
+package harlogger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.har")
+	data := `{"log":{"version":"1.2","creator":{"name":"Browser","version":"1"},"entries":[
+		{"startedDateTime":"2024-05-01T10:00:00.000Z","time":12.5,
+		 "request":{"method":"POST","url":"https://example.com/login","httpVersion":"HTTP/2",
+		  "headers":[{"name":":authority","value":"example.com"}],"cookies":[],"queryString":[],
+		  "postData":{"mimeType":"application/x-www-form-urlencoded","params":[{"name":"user","value":"a b"}]},
+		  "headersSize":-1,"bodySize":10},
+		 "response":{"status":200,"statusText":"OK","httpVersion":"HTTP/2","cookies":[],"headers":[],
+		  "content":{"size":0,"mimeType":"text/plain"},"redirectURL":"","headersSize":-1,"bodySize":0},
+		 "cache":{},"timings":{"send":1,"wait":10,"receive":1.5}}]}}`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	har, err := ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, har.Log.Entries, 1)
+	entry := har.Log.Entries[0]
+	assert.Equal(t, "https://example.com/login", entry.Request.URL)
+	body, err := entry.Request.PostData.Body()
+	require.NoError(t, err)
+	assert.Equal(t, "user=a+b", string(body))
+
+	_, err = ReadFile(filepath.Join(t.TempDir(), "missing.har"))
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o644))
+	_, err = ReadFile(path)
+	assert.ErrorContains(t, err, "invalid HAR")
+}
+
+func TestPostDataBody(t *testing.T) {
+	body, err := (&PostData{Text: "aGVsbG8=", Encoding: "base64"}).Body()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	body, err = (&PostData{Text: `{"a":1}`}).Body()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(body))
+
+	body, err = (*PostData)(nil).Body()
+	require.NoError(t, err)
+	assert.Nil(t, body)
+}
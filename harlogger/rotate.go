@@ -0,0 +1,201 @@
+package harlogger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expandOutputTemplate replaces the filename tokens {date} (2006-01-02),
+// {time} (150405), {n} (file sequence number) and {pid} in template.
+func expandOutputTemplate(template string, n int, now time.Time) string {
+	return strings.NewReplacer(
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{n}", strconv.Itoa(n),
+		"{pid}", strconv.Itoa(os.Getpid()),
+	).Replace(template)
+}
+
+// rotatedFileName returns the name of the n-th output file. When the template has
+// no {n} token, later files get a "-n" suffix before the extension so a rotation
+// never overwrites the previous file.
+func (l *Logger) rotatedFileName(n int, now time.Time) string {
+	name := expandOutputTemplate(l.template, n, now)
+	if n == 1 || strings.Contains(l.template, "{n}") {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + strconv.Itoa(n) + ext
+}
+
+// OutputFile returns the file the current log is written to.
+func (l *Logger) OutputFile() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.outputFile
+}
+
+// SetRotation saves the log and starts a new file whenever the buffered entries
+// exceed maxSize bytes or every interval. Zero disables the respective trigger.
+func (l *Logger) SetRotation(maxSize int64, interval time.Duration) {
+	if !l.IsEnabled() {
+		return
+	}
+
+	l.mu.Lock()
+	l.maxSize = maxSize
+	l.rotateInterval = interval
+	if l.cancelRotate != nil {
+		l.cancelRotate()
+		l.cancelRotate = nil
+	}
+	if interval <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancelRotate = cancel
+	l.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.mu.Lock()
+				if err := l.rotateLocked(); err != nil {
+					log.Printf("Error rotating HAR log: %v", err)
+				}
+				l.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// Close stops auto-save and rotation and writes the remaining entries to the
+// current file. A file started by a rotation is only written if it has entries.
+func (l *Logger) Close() error {
+	if !l.IsEnabled() {
+		return nil
+	}
+	l.DisableAutoSave()
+
+	l.mu.Lock()
+	if l.cancelRotate != nil {
+		l.cancelRotate()
+		l.cancelRotate = nil
+	}
+	skip := l.fileIndex > 1 && len(l.h.Log.Entries) == 0
+	l.mu.Unlock()
+
+	if skip {
+		return nil
+	}
+	return l.Save()
+}
+
+// entryOverhead approximates the encoded size of an entry apart from its URL,
+// headers, bodies and comment: field names, timings, indentation and so on.
+const entryOverhead = 512
+
+// estimateEntrySize approximates the encoded size of entry without marshaling it.
+func estimateEntrySize(entry *Entry) int64 {
+	size := int64(entryOverhead + len(entry.Request.URL) + len(entry.Response.Content.Text) + len(entry.Comment))
+	size += max(entry.Request.HeadersSize, 0) + max(entry.Response.HeadersSize, 0)
+	if entry.Request.PostData != nil {
+		size += int64(len(entry.Request.PostData.Text))
+	}
+	return size
+}
+
+// rotateIfOversized adds an estimate for entry to the buffered size and rotates once it
+// exceeds maxSize. Every save replaces the estimate with the number of bytes written.
+// Must be called with l.mu held.
+func (l *Logger) rotateIfOversized(entry *Entry) {
+	if l.maxSize <= 0 {
+		return
+	}
+	l.bufferedSize += estimateEntrySize(entry)
+	if l.bufferedSize <= l.maxSize {
+		return
+	}
+	if err := l.rotateLocked(); err != nil {
+		log.Printf("Error rotating HAR log: %v", err)
+	}
+}
+
+// rotateLocked saves the buffered entries and starts a new, empty log in the next file.
+// Nothing happens when there are no entries. On a save error the entries are kept.
+// Must be called with l.mu held.
+func (l *Logger) rotateLocked() error {
+	if l.h == nil || len(l.h.Log.Entries) == 0 {
+		return nil
+	}
+	if err := l.saveLocked(); err != nil {
+		return fmt.Errorf("failed to save HAR log before rotating: %w", err)
+	}
+
+	l.fileIndex++
+	l.outputFile = l.rotatedFileName(l.fileIndex, time.Now())
+	l.h.Log.Entries = []Entry{}
+	l.h.Log.Pages = nil
+	if l.pages != nil {
+		l.pages = newPageTracker()
+	}
+	l.bufferedSize = 0
+	log.Printf("HAR log rotated, continuing in %s", l.outputFile)
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ParseSize parses a byte size such as "500", "64KB", "10M" or "1.5GB"
+// (binary multiples, case-insensitive). An empty string returns 0.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{
+		{"GB", 1 << 30}, {"G", 1 << 30},
+		{"MB", 1 << 20}, {"M", 1 << 20},
+		{"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.factor
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
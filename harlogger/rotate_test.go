@@ -0,0 +1,129 @@
+package harlogger
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readHARFile(t *testing.T, path string) HAR {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var h HAR
+	require.NoError(t, json.Unmarshal(data, &h))
+	return h
+}
+
+func addTextEntry(logger *Logger, path, body string) {
+	req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	logger.AddEntry(req, resp, time.Now(), 10*time.Millisecond, "127.0.0.1", "1")
+}
+
+func TestExpandOutputTemplate(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	assert.Equal(t, "capture-2024-05-06-070809-3.har", expandOutputTemplate("capture-{date}-{time}-{n}.har", 3, now))
+	assert.Equal(t, "p"+strconv.Itoa(os.Getpid())+".har", expandOutputTemplate("p{pid}.har", 1, now))
+	assert.Equal(t, "plain.har", expandOutputTemplate("plain.har", 2, now))
+}
+
+func TestLogger_RotatesWhenMaxSizeExceeded(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewLogger(filepath.Join(dir, "capture-{n}.har"), testProxyName, testProxyVersion)
+	assert.Equal(t, filepath.Join(dir, "capture-1.har"), logger.OutputFile())
+	logger.SetRotation(4096, 0)
+
+	body := strings.Repeat("x", 3000)
+	addTextEntry(logger, "/first", body)
+	_, err := os.Stat(filepath.Join(dir, "capture-1.har"))
+	assert.True(t, os.IsNotExist(err), "no rotation before the threshold is exceeded")
+
+	addTextEntry(logger, "/second", body)
+	assert.Equal(t, filepath.Join(dir, "capture-2.har"), logger.OutputFile())
+	first := readHARFile(t, filepath.Join(dir, "capture-1.har"))
+	require.Len(t, first.Log.Entries, 2)
+
+	addTextEntry(logger, "/third", "small")
+	require.NoError(t, logger.Close())
+	second := readHARFile(t, filepath.Join(dir, "capture-2.har"))
+	require.Len(t, second.Log.Entries, 1)
+	assert.Equal(t, "http://example.com/third", second.Log.Entries[0].Request.URL)
+}
+
+func TestLogger_RotationTracksSavedSize(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewLogger(filepath.Join(dir, "capture-{n}.har"), testProxyName, testProxyVersion)
+	logger.SetRotation(1<<20, 0)
+
+	addTextEntry(logger, "/first", strings.Repeat("x", 3000))
+	require.NoError(t, logger.Save())
+	info, err := os.Stat(filepath.Join(dir, "capture-1.har"))
+	require.NoError(t, err)
+
+	// After a save the buffered size is the size of the written file
+	logger.mu.Lock()
+	assert.Equal(t, info.Size(), logger.bufferedSize)
+	logger.mu.Unlock()
+	require.NoError(t, logger.Close())
+}
+
+func TestLogger_RotationWithoutIndexToken(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewLogger(filepath.Join(dir, "capture.har"), testProxyName, testProxyVersion)
+	logger.SetRotation(1, 0)
+
+	addTextEntry(logger, "/a", "a")
+	addTextEntry(logger, "/b", "b")
+	require.NoError(t, logger.Close())
+
+	assert.Len(t, readHARFile(t, filepath.Join(dir, "capture.har")).Log.Entries, 1)
+	assert.Len(t, readHARFile(t, filepath.Join(dir, "capture-2.har")).Log.Entries, 1)
+	// The file opened by the last rotation stays empty and is not written on Close
+	_, err := os.Stat(filepath.Join(dir, "capture-3.har"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLogger_RotatesOnInterval(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewLogger(filepath.Join(dir, "capture-{n}.har"), testProxyName, testProxyVersion)
+	logger.SetRotation(0, 20*time.Millisecond)
+	defer logger.Close()
+
+	addTextEntry(logger, "/a", "a")
+	require.Eventually(t, func() bool {
+		return logger.OutputFile() == filepath.Join(dir, "capture-2.har")
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Len(t, readHARFile(t, filepath.Join(dir, "capture-1.har")).Log.Entries, 1)
+}
+
+func TestParseSize(t *testing.T) {
+	for input, want := range map[string]int64{
+		"":      0,
+		"500":   500,
+		"64KB":  64 << 10,
+		"10m":   10 << 20,
+		"1.5GB": 3 << 29,
+		"2 MB":  2 << 20,
+	} {
+		got, err := ParseSize(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	for _, input := range []string{"abc", "-1MB", "MB"} {
+		_, err := ParseSize(input)
+		assert.Error(t, err, input)
+	}
+}
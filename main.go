@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/LubyRuffy/ProxyCraft/api"
+	"github.com/LubyRuffy/ProxyCraft/binlog"
 	"github.com/LubyRuffy/ProxyCraft/certs"
 	"github.com/LubyRuffy/ProxyCraft/cli"
 	"github.com/LubyRuffy/ProxyCraft/harlogger" // Added for HAR logging
@@ -28,9 +36,27 @@ func main() {
 		return
 	}
 
+	// 只校验配置并输出报告，不启动代理，适合在CI或脚本中提前发现配置错误
+	if cfg.Check {
+		if !printCheckReport(os.Stdout, checkConfig(cfg)) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 把 -binlog 写出的二进制抓包转换为HAR后退出，不需要证书和代理
+	if cfg.ConvertInput != "" {
+		count, err := runConvert(cfg)
+		if err != nil {
+			log.Fatalf("Error converting %s: %v", cfg.ConvertInput, err)
+		}
+		fmt.Printf("Converted %d entries from %s to %s.\n", count, cfg.ConvertInput, cfg.ConvertOutput)
+		return
+	}
+
 	fmt.Println("ProxyCraft CLI starting...")
 
-	certManager, err := certs.NewManager()
+	certManager, inMemoryCA, err := newCertManager(cfg)
 	if err != nil {
 		log.Fatalf("Error initializing certificate manager: %v", err)
 	}
@@ -45,6 +71,9 @@ func main() {
 	}
 
 	if cfg.InstallCerts {
+		if inMemoryCA {
+			log.Fatalf("Error installing CA certificate: %v", errInstallInMemoryCA)
+		}
 		if cfg.ForceReinstallCA {
 			err = certManager.InstallCertsForce()
 		} else {
@@ -57,31 +86,71 @@ func main() {
 		return
 	}
 
+	// 生成的站点证书的主题和附加SAN
+	if cfg.LeafOrg != "" {
+		certManager.Leaf.Organization = []string{cfg.LeafOrg}
+	}
+	if cfg.LeafOU != "" {
+		certManager.Leaf.OrganizationalUnit = []string{cfg.LeafOU}
+	}
+	if cfg.ExtraSAN != "" {
+		certManager.Leaf.AddSANs(strings.Split(cfg.ExtraSAN, ",")...)
+	}
+
+	if cfg.UseCAChainPath != "" && (cfg.UseCACertPath == "" || cfg.UseCAKeyPath == "") {
+		log.Fatalf("-use-ca-chain requires -use-ca and -use-key")
+	}
+
 	// Use custom CA certificate and key if provided
-	if cfg.UseCACertPath != "" && cfg.UseCAKeyPath != "" {
-		err = certManager.LoadCustomCA(cfg.UseCACertPath, cfg.UseCAKeyPath)
+	customCA := cfg.UseCACertPath != "" && cfg.UseCAKeyPath != ""
+	if customCA {
+		err = certManager.LoadCustomCA(cfg.UseCACertPath, cfg.UseCAKeyPath, cfg.UseCAChainPath)
 		if err != nil {
 			log.Fatalf("Error loading custom CA certificate and key: %v", err)
 		}
 		log.Printf("Successfully loaded custom CA certificate and key")
+	}
 
-		if cfg.VerifyCATrust {
-			if err := certs.VerifySystemTrust(certManager); err != nil {
-				log.Fatalf("System trust verification failed: %v", err)
-			}
-			fmt.Println("System trust verification succeeded.")
-			return
+	// 信任存储操作放在CA加载完成之后，保证写入的是实际签发站点证书的CA
+	if cfg.TrustCA || cfg.UntrustCA {
+		var results []certs.TrustStoreResult
+		if cfg.TrustCA {
+			results = certs.TrustCA(certManager)
+		} else {
+			results = certs.UntrustCA(certManager)
 		}
-	} else {
-		if cfg.VerifyCATrust {
-			if err := certs.VerifySystemTrust(certManager); err != nil {
-				log.Fatalf("System trust verification failed: %v", err)
-			}
-			fmt.Println("System trust verification succeeded.")
-			return
+		for _, result := range results {
+			fmt.Println(result)
 		}
+		if certs.TrustResultsFailed(results) {
+			os.Exit(1)
+		}
+		fmt.Println("Trust stores updated. Exiting.")
+		return
+	}
 
-		if cfg.ForceReinstallCA {
+	if cfg.VerifyCATrust {
+		if err := certs.VerifySystemTrust(certManager); err != nil {
+			log.Fatalf("System trust verification failed: %v", err)
+		}
+		fmt.Println("System trust verification succeeded.")
+		return
+	}
+
+	if cfg.ShowCA {
+		info, err := certManager.Info()
+		if err != nil {
+			log.Fatalf("Error reading CA certificate: %v", err)
+		}
+		printCAInfo(os.Stdout, info)
+		return
+	}
+
+	if !customCA {
+		if inMemoryCA {
+			log.Printf("Using in-memory CA certificate, skipping system trust store installation")
+			log.Printf("Export the certificate with -export-ca and trust it manually if needed")
+		} else if cfg.ForceReinstallCA {
 			log.Printf("Force reinstalling CA certificate in system trust store...")
 			err = certManager.InstallCertsForce()
 			if err != nil {
@@ -113,14 +182,35 @@ func main() {
 
 	listenAddr := fmt.Sprintf("%s:%d", cfg.ListenHost, cfg.ListenPort)
 	fmt.Printf("Proxy server attempting to listen on %s\n", listenAddr)
+	logLevel, err := proxy.ParseLogLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Error parsing -log-level: %v", err)
+	}
+	// -v 是 -log-level debug 的简写
 	if cfg.Verbose {
+		logLevel = proxy.LogLevelDebug
+	}
+	verbose := logLevel == proxy.LogLevelDebug
+	if verbose {
 		fmt.Println("Verbose mode enabled.")
 	}
 
 	// Initialize HAR Logger
 	harLogger := harlogger.NewLogger(cfg.HarOutputFile, appName, appVersion)
 	if harLogger.IsEnabled() {
-		log.Printf("HAR logging enabled, will save to: %s", cfg.HarOutputFile)
+		log.Printf("HAR logging enabled, will save to: %s", harLogger.OutputFile())
+		harLogger.SetPageGrouping(!cfg.HarNoPages)
+		harLogger.SetCompact(cfg.HarCompact)
+		harLogger.SetDecodeCompressed(cfg.HarDecode)
+		harLogger.SetNoBodies(cfg.NoBodies)
+
+		harMaxSize, err := harlogger.ParseSize(cfg.HarMaxSize)
+		if err != nil {
+			log.Fatalf("Error parsing -har-max-size: %v", err)
+		}
+		if harMaxSize > 0 || cfg.HarRotate > 0 {
+			harLogger.SetRotation(harMaxSize, cfg.HarRotate)
+		}
 
 		// Enable auto-save if interval > 0
 		if cfg.AutoSaveInterval > 0 {
@@ -130,47 +220,321 @@ func main() {
 			log.Printf("Auto-save disabled, HAR log will only be saved on exit")
 		}
 
-		// Also save on exit
+		// Also save on exit; Close stops auto-save and rotation before the final save
 		defer func() {
-			if cfg.AutoSaveInterval > 0 {
-				harLogger.DisableAutoSave() // Stop auto-save before final save
-			}
-			if err := harLogger.Save(); err != nil {
+			if err := harLogger.Close(); err != nil {
 				log.Printf("Error saving HAR log on exit: %v", err)
 			}
 		}()
 	}
 
-	// 解析上层代理URL
+	// 与主事件处理器（Web或CLI）同时挂载的其他输出目标
+	var extraHandlers []proxy.EventHandler
+	if cfg.JSONLOutput != "" {
+		jsonlOut := os.Stdout
+		if cfg.JSONLOutput != "-" {
+			f, err := os.OpenFile(cfg.JSONLOutput, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+			if err != nil {
+				log.Fatalf("Error opening -jsonl output: %v", err)
+			}
+			defer f.Close()
+			jsonlOut = f
+		}
+		extraHandlers = append(extraHandlers, handlers.NewJSONLHandler(jsonlOut))
+		log.Printf("JSONL logging enabled, will append to: %s", cfg.JSONLOutput)
+	}
+	if cfg.BinlogOutput != "" {
+		f, err := os.OpenFile(cfg.BinlogOutput, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatalf("Error opening -binlog output: %v", err)
+		}
+		defer f.Close()
+		binlogHandler, err := handlers.NewBinlogHandler(f)
+		if err != nil {
+			log.Fatalf("Error starting -binlog output: %v", err)
+		}
+		extraHandlers = append(extraHandlers, binlogHandler)
+		log.Printf("Binary capture enabled, will append to: %s", cfg.BinlogOutput)
+	}
+
+	// 解析上层代理URL，多个代理以逗号分隔时按顺序组成代理链
 	var upstreamProxyURL *url.URL
+	var upstreamProxyChain []*url.URL
 	if cfg.UpstreamProxy != "" {
-		var err error
-		upstreamProxyURL, err = url.Parse(cfg.UpstreamProxy)
+		chain, err := proxy.ParseUpstreamProxyChain(cfg.UpstreamProxy)
 		if err != nil {
 			log.Fatalf("Error parsing upstream proxy URL: %v", err)
 		}
-		log.Printf("Using upstream proxy: %s", upstreamProxyURL.String())
+		if len(chain) == 1 {
+			upstreamProxyURL = chain[0]
+			log.Printf("Using upstream proxy: %s", upstreamProxyURL.String())
+		} else if len(chain) > 1 {
+			upstreamProxyChain = chain
+			for i, hop := range chain {
+				log.Printf("Using upstream proxy chain hop %d: %s", i+1, hop.String())
+			}
+		}
+	}
+
+	// 绕过上层代理的主机：-no-upstream-for 与 NO_PROXY 环境变量合并生效
+	noProxyEnv := os.Getenv("NO_PROXY")
+	if noProxyEnv == "" {
+		noProxyEnv = os.Getenv("no_proxy")
+	}
+	upstreamBypass, err := proxy.ParseBypassList(cfg.NoUpstreamFor, noProxyEnv)
+	if err != nil {
+		log.Fatalf("Error parsing upstream bypass list: %v", err)
+	}
+	if upstreamBypass != nil && (upstreamProxyURL != nil || len(upstreamProxyChain) > 0) {
+		log.Printf("Hosts matching %q connect directly, bypassing the upstream proxy", strings.Trim(cfg.NoUpstreamFor+","+noProxyEnv, ","))
+	}
+
+	// 通过DNS-over-HTTPS解析上游主机名
+	var dohResolver *proxy.DoHResolver
+	if cfg.DoH != "" {
+		dohResolver, err = proxy.NewDoHResolver(cfg.DoH, cfg.DoHFallback)
+		if err != nil {
+			log.Fatalf("Error configuring -doh: %v", err)
+		}
+		log.Printf("Resolving upstream hostnames via DNS-over-HTTPS: %s", cfg.DoH)
+	}
+
+	// 按指纹信任上游的自签名证书
+	certPins, err := proxy.ParseCertPins(cfg.CertPins)
+	if err != nil {
+		log.Fatalf("Error parsing -pin: %v", err)
+	}
+	if certPins != nil {
+		log.Printf("Pinning upstream certificates for: %s", certPins)
+	}
+
+	// 面向客户端的TLS版本和密码套件
+	tlsMinVersion, tlsMaxVersion, err := proxy.ParseTLSVersionRange(cfg.TLSMinVersion, cfg.TLSMaxVersion)
+	if err != nil {
+		log.Fatalf("Error parsing TLS version flags: %v", err)
+	}
+	tlsCipherSuites, err := proxy.ParseCipherSuites(cfg.TLSCiphers)
+	if err != nil {
+		log.Fatalf("Error parsing -tls-ciphers: %v", err)
+	}
+
+	// 流量抽样：只保存部分请求，出错和5xx响应总是保存
+	var sampler *proxy.Sampler
+	if cfg.SampleRate < 1 {
+		sampler, err = proxy.NewSampler(cfg.SampleRate)
+		if err != nil {
+			log.Fatalf("Error configuring sampling: %v", err)
+		}
+		log.Printf("Sampling enabled: capturing ~%.0f%% of transactions (errors and 5xx are always captured)", cfg.SampleRate*100)
+	}
+
+	// 混沌测试：按比例注入错误响应或断开连接
+	var chaos *proxy.Chaos
+	if cfg.Chaos != "" {
+		chaos, err = proxy.ParseChaos(cfg.Chaos)
+		if err != nil {
+			log.Fatalf("Error parsing -chaos: %v", err)
+		}
+		log.Printf("WARNING: chaos testing enabled: %s", chaos)
+	}
+
+	// 按目标主机限制转发速率，避免压垮共享的测试环境
+	rateLimitMode, err := proxy.ParseRateLimitMode(cfg.RateLimitMode)
+	if err != nil {
+		log.Fatalf("Error parsing -rate-limit-mode: %v", err)
+	}
+	rateLimiter, err := proxy.ParseRateLimits(cfg.RateLimits, rateLimitMode)
+	if err != nil {
+		log.Fatalf("Error parsing -rate-limit: %v", err)
+	}
+	if rateLimiter != nil {
+		log.Printf("Rate limiting outbound requests: %s", rateLimiter)
+	}
+
+	// 缓存响应，离线演示时只从缓存返回
+	var responseCache *proxy.ResponseCache
+	if cfg.CacheOffline && cfg.CacheDir == "" {
+		log.Fatalf("Error: -cache-offline requires -cache")
+	}
+	if cfg.CacheDir != "" {
+		responseCache, err = proxy.NewResponseCache(cfg.CacheDir, cfg.CacheOffline)
+		if err != nil {
+			log.Fatalf("Error opening -cache directory: %v", err)
+		}
+		log.Printf("Response cache enabled: %s", responseCache)
+	}
+
+	// 从响应中提取变量并注入后续请求
+	extractRules, injectRules, err := variableRules(cfg)
+	if err != nil {
+		log.Fatalf("Error parsing -extract/-inject: %v", err)
+	}
+	if len(extractRules) > 0 || len(injectRules) > 0 {
+		log.Printf("Variables enabled: %d extract rule(s), %d inject rule(s)", len(extractRules), len(injectRules))
+	}
+
+	// 响应体正则替换
+	var bodyReplacements []*proxy.BodyReplacement
+	for _, spec := range cfg.Replacements {
+		rule, err := proxy.ParseBodyReplacement(spec)
+		if err != nil {
+			log.Fatalf("Error parsing -replace: %v", err)
+		}
+		bodyReplacements = append(bodyReplacements, rule)
+	}
+	if len(bodyReplacements) > 0 {
+		log.Printf("Body replacement enabled: %d rule(s)", len(bodyReplacements))
+	}
+
+	// 响应头删除和设置
+	headerRules, err := responseHeaderRules(cfg)
+	if err != nil {
+		log.Fatalf("Error parsing response header options: %v", err)
+	}
+	if len(headerRules) > 0 {
+		log.Printf("Response header rewriting enabled: %d rule(s)", len(headerRules))
+	}
+
+	maxHeaderSize, err := harlogger.ParseSize(cfg.MaxHeaderSize)
+	if err != nil {
+		log.Fatalf("Error parsing -max-header-size: %v", err)
+	}
+
+	// 慢请求和大消息体的异常标记
+	anomaly, err := anomalyThresholds(cfg)
+	if err != nil {
+		log.Fatalf("Error parsing anomaly thresholds: %v", err)
+	}
+
+	// 视频、音频等大响应只记录元数据，不缓存响应体
+	skipBodyRules, err := proxy.ParseSkipBodyRules(cfg.SkipBodyTypes)
+	if err != nil {
+		log.Fatalf("Error parsing -skip-body-types: %v", err)
+	}
+	var shouldCaptureBody proxy.ShouldCaptureBodyFunc
+	if len(skipBodyRules) > 0 {
+		shouldCaptureBody = proxy.SkipBodyContentTypes(skipBodyRules)
+	}
+
+	// 限制同时活动的客户端连接数，避免压测或共享部署时耗尽文件描述符和内存
+	connLimitMode, err := proxy.ParseConnLimitMode(cfg.MaxConnsMode)
+	if err != nil {
+		log.Fatalf("Error parsing -max-conns-mode: %v", err)
+	}
+	if cfg.MaxConns < 0 {
+		log.Fatalf("Error parsing -max-conns: must not be negative")
+	}
+	if cfg.MaxConns > 0 {
+		log.Printf("Limiting concurrent client connections to %d (%s beyond the limit)", cfg.MaxConns, connLimitMode)
+	}
+
+	// 反向代理模式：直接接收请求并转发到指定后端
+	var reverseTarget *url.URL
+	var reverseCertificate *tls.Certificate
+	var reverseHosts []string
+	if cfg.ReverseTarget != "" {
+		reverseTarget, err = proxy.ParseReverseTarget(cfg.ReverseTarget)
+		if err != nil {
+			log.Fatalf("Error parsing reverse target: %v", err)
+		}
+		if cfg.ReverseCertPath != "" || cfg.ReverseKeyPath != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.ReverseCertPath, cfg.ReverseKeyPath)
+			if err != nil {
+				log.Fatalf("Error loading reverse proxy certificate: %v", err)
+			}
+			reverseCertificate = &cert
+		}
+		if cfg.ReverseHosts != "" {
+			reverseHosts = strings.Split(cfg.ReverseHosts, ",")
+		}
+		log.Printf("Reverse proxy mode enabled, forwarding to: %s", reverseTarget.String())
+	}
+
+	// 只拦截指定进程发起的HTTPS连接
+	var mitmProcesses []string
+	for _, name := range strings.Split(cfg.MITMProcess, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			mitmProcesses = append(mitmProcesses, name)
+		}
+	}
+	if len(mitmProcesses) > 0 {
+		log.Printf("Intercepting HTTPS only from processes: %s", strings.Join(mitmProcesses, ", "))
+	}
+
+	// 自建的LLM服务：Web界面据此解析LLM流量，代理据此识别Ollama风格的流式接口
+	llmHosts, err := proxy.ParseLLMHosts(cfg.LLMHosts)
+	if err != nil {
+		log.Fatalf("Error parsing -llm-hosts: %v", err)
 	}
 
 	// 根据模式选择事件处理器
 	var eventHandler proxy.EventHandler
+	var apiServer *api.Server
 
 	// Web模式使用WebHandler
 	if cfg.Mode == "web" {
 		log.Printf("启动Web模式...")
 
 		// 创建Web事件处理器
-		webHandler, err := handlers.NewWebHandler(cfg.Verbose, cfg.SQLitePath)
+		storageMode, err := handlers.ParseStorageMode(cfg.Storage)
+		if err != nil {
+			log.Fatalf("Error parsing -storage: %v", err)
+		}
+		webHandler, err := handlers.NewWebHandlerWithStorage(verbose, cfg.SQLitePath, storageMode)
 		if err != nil {
 			log.Fatalf("初始化SQLite数据库失败: %v", err)
 		}
 
+		// 较大的消息体按内容哈希保存为文件，数据库只记录哈希
+		if cfg.BodyStore != "" {
+			minSize, err := harlogger.ParseSize(cfg.BodyStoreMinSize)
+			if err != nil {
+				log.Fatalf("Error parsing -body-store-min-size: %v", err)
+			}
+			if err := webHandler.SetBodyStore(cfg.BodyStore, int(minSize)); err != nil {
+				log.Fatalf("Error configuring -body-store: %v", err)
+			}
+			log.Printf("Bodies larger than %s are stored as files in %s", cfg.BodyStoreMinSize, cfg.BodyStore)
+		}
+
+		// 按时间清理旧条目，避免长时间运行时数据库持续增长
+		if cfg.Retention < 0 {
+			log.Fatalf("-retention must not be negative")
+		}
+		if cfg.Retention > 0 {
+			webHandler.SetRetention(cfg.Retention)
+			log.Printf("Traffic entries older than %s are deleted", cfg.Retention)
+		}
+
+		webHandler.SetNoBodies(cfg.NoBodies)
+		webHandler.SetAnomalyThresholds(anomaly)
+		if cfg.ListLimit < 0 {
+			log.Fatalf("-list-limit must not be negative")
+		}
+		webHandler.SetListLimit(cfg.ListLimit)
+		webHandler.SetLLMHosts(llmHosts)
+
 		// 创建API服务器，默认使用8081端口
-		apiServer := api.NewServer(webHandler, 8081)
+		if (cfg.UITLSCert == "") != (cfg.UITLSKey == "") {
+			log.Fatalf("-ui-tls-cert and -ui-tls-key must be set together")
+		}
+		basePath, err := api.NormalizeBasePath(cfg.UIBasePath)
+		if err != nil {
+			log.Fatalf("Error parsing -ui-base-path: %v", err)
+		}
+		apiServer = api.NewServerWithBasePath(webHandler, 8081, basePath)
+		apiServer.UIHost = cfg.UIHost
+		apiServer.UITLSCert = cfg.UITLSCert
+		apiServer.UITLSKey = cfg.UITLSKey
+		apiServer.AdminToken = cfg.UIAdminToken
+		if apiServer.WebSocketServer != nil {
+			apiServer.WebSocketServer.BatchInterval = cfg.WSBatchInterval
+			apiServer.WebSocketServer.BatchSize = cfg.WSBatchSize
+		}
 
 		// 启动API服务器
 		go func() {
-			log.Printf("启动API服务器在端口8081...")
+			log.Printf("启动API服务器在 %s...", apiServer.ListenAddr())
 			if err := apiServer.Start(); err != nil {
 				log.Fatalf("启动API服务器失败: %v", err)
 			}
@@ -179,13 +543,14 @@ func main() {
 		// 设置Web处理器为事件处理器
 		eventHandler = webHandler
 
-		log.Printf("Web模式已启用，界面地址: %s", apiServer.UIAddr)
+		log.Printf("Web模式已启用，界面地址: %s", apiServer.URL())
 		log.Printf("如果Web界面无法显示，请先运行: ./build_web.sh")
 	} else {
 		// CLI模式使用CLIHandler
 		log.Printf("启动CLI模式...")
 
-		cliHandler := handlers.NewCLIHandler(cfg.Verbose, cfg.DumpTraffic)
+		cliHandler := handlers.NewCLIHandler(verbose, cfg.DumpTraffic)
+		cliHandler.Anomaly = anomaly
 		statsReporter := handlers.NewStatsReporter(cliHandler, 10*time.Second)
 
 		// 启动统计报告
@@ -199,19 +564,112 @@ func main() {
 	}
 
 	// 创建服务器配置
-	serverConfig := proxy.ServerConfig{
+	serverConfig := proxy.Config{
 		Addr:          listenAddr,
 		CertManager:   certManager,
-		Verbose:       cfg.Verbose,
+		Verbose:       verbose,
+		LogLevel:      logLevel,
 		HarLogger:     harLogger,
 		UpstreamProxy: upstreamProxyURL,
 		DumpTraffic:   cfg.DumpTraffic,
 		EventHandler:  eventHandler,
+		EventHandlers: extraHandlers,
+
+		UpstreamProxyChain: upstreamProxyChain,
+		UpstreamBypass:     upstreamBypass,
+		DoHResolver:        dohResolver,
+		CertPins:           certPins,
+
+		RewriteCookies:    cfg.RewriteCookies,
+		NoDecompress:      cfg.NoDecompress,
+		Recompress:        cfg.Recompress,
+		PassthroughBodies: cfg.PassthroughBody,
+		NoBodies:          cfg.NoBodies,
+		NoClientHTTP2:     cfg.NoH2Client,
+		NoUpstreamHTTP2:   cfg.NoH2Upstream,
+		ShouldCaptureBody: shouldCaptureBody,
+		Sampler:           sampler,
+
+		BodyReplacements:    bodyReplacements,
+		ResponseHeaderRules: headerRules,
+
+		RequestTimeout:    disabledIfZero(cfg.RequestTimeout),
+		MaxHeaderBytes:    int(maxHeaderSize),
+		ResponseTimeout:   disabledIfZero(cfg.ResponseTimeout),
+		SSEKeepAlive:      cfg.SSEKeepAlive,
+		LLMHosts:          llmHosts,
+		AddVia:            cfg.AddVia,
+		OverrideUserAgent: cfg.OverrideUA,
+		FollowRedirects:   cfg.FollowRedirects,
+
+		ReverseTarget:      reverseTarget,
+		ReverseCertificate: reverseCertificate,
+		ReverseHosts:       reverseHosts,
+
+		Chaos:        chaos,
+		RateLimiter:  rateLimiter,
+		Cache:        responseCache,
+		ExtractRules: extractRules,
+		InjectRules:  injectRules,
+
+		AutoPassthrough:    cfg.AutoPassthrough,
+		AutoPassthroughTTL: cfg.PassthroughTTL,
+		TLSMinVersion:      tlsMinVersion,
+		TLSMaxVersion:      tlsMaxVersion,
+		TLSCipherSuites:    tlsCipherSuites,
+		MaxConns:           cfg.MaxConns,
+		ConnLimitMode:      connLimitMode,
+		MITMProcesses:      mitmProcesses,
 	}
 
 	// 初始化并启动代理服务器
 	proxyServer := proxy.NewServerWithConfig(serverConfig)
 
+	// 压测模式：回放HAR中的请求，输出统计后退出，不启动代理监听
+	if cfg.ReplayLoad != "" {
+		if err := runReplayLoad(cfg, proxyServer); err != nil {
+			log.Fatalf("Error replaying %s: %v", cfg.ReplayLoad, err)
+		}
+		return
+	}
+
+	// Web模式下由界面展示按主机的统计，清空流量时一并重置
+	if apiServer != nil {
+		apiServer.HostStats = proxyServer
+		apiServer.Health = proxyServer
+		apiServer.Version = appVersion
+		apiServer.CertManager = certManager
+		apiServer.WebHandler.SetClearCallback(proxyServer.ResetStats)
+
+		// 记录本次运行，重启后仍可以区分各次运行保存的条目
+		session, err := apiServer.WebHandler.StartSession(sessionConfig(cfg, proxyServer.Addr))
+		if err != nil {
+			log.Printf("Failed to record session: %v", err)
+		} else if session.LastEntryID > 0 {
+			log.Printf("Continuing existing traffic database after entry %d (session %d)", session.LastEntryID, session.ID)
+		}
+	}
+
+	// 独立的健康检查监听地址，CLI模式下没有API服务时也可以用于存活/就绪探针
+	// 先在这里监听以便地址不可用时直接报错；之后服务出错时通过healthErr交给主流程退出
+	healthErr := make(chan error, 1)
+	if cfg.HealthAddr != "" {
+		healthListener, err := net.Listen("tcp", cfg.HealthAddr)
+		if err != nil {
+			log.Fatalf("Failed to start health check listener: %v", err)
+		}
+		healthMux := http.NewServeMux()
+		healthMux.Handle("/healthz", proxyServer.HealthHandler(appVersion))
+		log.Printf("Serving health checks on http://%s/healthz", healthListener.Addr())
+		go func() {
+			healthErr <- http.Serve(healthListener, healthMux)
+		}()
+	}
+
+	if cfg.NoBodies {
+		log.Printf("Privacy mode enabled - request and response bodies are forwarded but never recorded")
+	}
+
 	// 如果启用了流量输出
 	if cfg.DumpTraffic {
 		fmt.Println("Traffic dump enabled - HTTP request and response content will be displayed in console")
@@ -221,9 +679,21 @@ func main() {
 	log.Printf("MITM mode enabled - HTTPS traffic will be decrypted and inspected")
 	log.Printf("Make sure to add the CA certificate to your browser/system trust store")
 	log.Printf("You can export the CA certificate using the -export-ca flag")
-	caCertPath := certs.MustGetCACertPath()
-	log.Printf("CA certificate is located at: %s", caCertPath)
-	log.Printf("For curl, you can use: curl --cacert %s --proxy http://%s https://example.com", caCertPath, listenAddr)
+	if info, err := certManager.Info(); err == nil {
+		log.Printf("CA certificate: %s, SHA-256 fingerprint %s, valid until %s", info.Subject, info.SHA256, info.NotAfter.Format("2006-01-02"))
+	}
+	caCertPath := "<exported-ca.pem>"
+	if inMemoryCA {
+		log.Printf("CA certificate is kept in memory only")
+	} else {
+		caCertPath = certs.MustGetCACertPath()
+		log.Printf("CA certificate is located at: %s", caCertPath)
+	}
+	if reverseTarget != nil {
+		log.Printf("For curl, you can use: curl --cacert %s https://%s/", caCertPath, listenAddr)
+	} else {
+		log.Printf("For curl, you can use: curl --cacert %s --proxy http://%s https://example.com", caCertPath, listenAddr)
+	}
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -238,8 +708,207 @@ func main() {
 	}()
 
 	// Wait for termination signal
-	sig := <-sigChan
-	log.Printf("Received signal %v, shutting down...", sig)
+	select {
+	case sig := <-sigChan:
+		log.Printf("Received signal %v, shutting down...", sig)
+	case err := <-healthErr:
+		log.Printf("Health check listener stopped: %v, shutting down...", err)
+	}
 
 	// The deferred harLogger.Save() will be called when main() exits
 }
+
+// printCAInfo 输出 -show-ca 的CA详情
+func printCAInfo(w io.Writer, info *certs.CAInfo) {
+	fmt.Fprintf(w, "Subject:     %s\n", info.Subject)
+	fmt.Fprintf(w, "Issuer:      %s\n", info.Issuer)
+	fmt.Fprintf(w, "Serial:      %s\n", info.Serial)
+	fmt.Fprintf(w, "Not before:  %s\n", info.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "Not after:   %s\n", info.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "SHA-256:     %s\n", info.SHA256)
+}
+
+// errInstallInMemoryCA 内存CA每次启动都会重新生成，安装后立即退出没有意义
+var errInstallInMemoryCA = errors.New("-install-ca cannot be used with -in-memory-ca: the in-memory CA is regenerated on every start")
+
+// newCertManager 创建证书管理器，第二个返回值表示CA是否只保存在内存中
+// 指定 -in-memory-ca 时在内存中生成临时CA；否则使用 ~/.proxycraft 下的CA文件
+func newCertManager(cfg *cli.Config) (*certs.Manager, bool, error) {
+	if cfg.InMemoryCA {
+		certManager, err := certs.NewInMemoryManager()
+		if err != nil {
+			return nil, false, err
+		}
+		log.Printf("Generated in-memory CA certificate")
+		return certManager, true, nil
+	}
+
+	certManager, err := certs.NewManager()
+	return certManager, false, err
+}
+
+// disabledIfZero 将命令行中表示“不限制”的0转换为proxy.Config使用的负数，proxy.Config中的0表示使用默认值
+func disabledIfZero(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return -1
+	}
+	return timeout
+}
+
+// responseHeaderRules 把 -disable-csp、-disable-hsts、-strip-header 和 -set-response-header 按此顺序转换为响应头规则
+// 设置排在最后，因此可以先删除再用 -set-response-header 写入新的值
+func responseHeaderRules(cfg *cli.Config) ([]*proxy.ResponseHeaderRule, error) {
+	strip := append([]string(nil), cfg.StripHeaders...)
+	if cfg.DisableCSP {
+		strip = append(append([]string(nil), proxy.CSPHeaders...), strip...)
+	}
+	if cfg.DisableHSTS {
+		strip = append(append([]string(nil), proxy.HSTSHeaders...), strip...)
+	}
+
+	var rules []*proxy.ResponseHeaderRule
+	for _, name := range strip {
+		rule, err := proxy.StripResponseHeader(name)
+		if err != nil {
+			return nil, fmt.Errorf("-strip-header: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range cfg.SetHeaders {
+		rule, err := proxy.ParseSetResponseHeader(spec)
+		if err != nil {
+			return nil, fmt.Errorf("-set-response-header: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// sessionConfig 返回记录到sessions表中的关键配置，未设置的选项不记录，上层代理地址中的密码会被隐藏
+func sessionConfig(cfg *cli.Config, addr string) map[string]string {
+	config := map[string]string{
+		"version": appVersion,
+		"listen":  addr,
+	}
+	set := func(key, value string) {
+		if value != "" {
+			config[key] = value
+		}
+	}
+	set("storage", cfg.Storage)
+	set("reverse", cfg.ReverseTarget)
+	set("har", cfg.HarOutputFile)
+	set("filter", cfg.Filter)
+	if cfg.SampleRate > 0 && cfg.SampleRate < 1 {
+		set("sampleRate", fmt.Sprint(cfg.SampleRate))
+	}
+	if cfg.NoBodies {
+		set("noBodies", "true")
+	}
+	if cfg.UpstreamProxy != "" {
+		var proxies []string
+		for _, raw := range strings.Split(cfg.UpstreamProxy, ",") {
+			if u, err := url.Parse(strings.TrimSpace(raw)); err == nil {
+				proxies = append(proxies, u.Redacted())
+			}
+		}
+		set("upstreamProxy", strings.Join(proxies, ","))
+	}
+	return config
+}
+
+// anomalyThresholds 解析 -slow-threshold 和 -large-threshold
+func anomalyThresholds(cfg *cli.Config) (handlers.AnomalyThresholds, error) {
+	if cfg.SlowThreshold < 0 {
+		return handlers.AnomalyThresholds{}, errors.New("-slow-threshold must not be negative")
+	}
+	large, err := harlogger.ParseSize(cfg.LargeThreshold)
+	if err != nil {
+		return handlers.AnomalyThresholds{}, fmt.Errorf("-large-threshold: %w", err)
+	}
+	return handlers.AnomalyThresholds{Slow: cfg.SlowThreshold, Large: large}, nil
+}
+
+// runReplayLoad 按 -replay-load 等参数回放HAR文件中的请求并输出统计，Ctrl-C时输出已完成部分的统计
+func runReplayLoad(cfg *cli.Config, server *proxy.Server) error {
+	if cfg.ReplayWorkers < 1 {
+		return fmt.Errorf("-replay-concurrency must be at least 1, got %d", cfg.ReplayWorkers)
+	}
+	if cfg.ReplayRate < 0 {
+		return fmt.Errorf("-replay-rate must not be negative, got %g", cfg.ReplayRate)
+	}
+	for _, spec := range cfg.ReplayVars {
+		name, value, ok := strings.Cut(spec, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return fmt.Errorf("invalid -replay-var %q: want name=value", spec)
+		}
+		server.Variables.Set(name, value)
+	}
+	har, err := harlogger.ReadFile(cfg.ReplayLoad)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Replaying %d requests from %s with concurrency %d", len(har.Log.Entries), cfg.ReplayLoad, cfg.ReplayWorkers)
+	result, err := server.ReplayLoad(ctx, har.Log.Entries, proxy.LoadTestConfig{
+		Concurrency: cfg.ReplayWorkers,
+		Rate:        cfg.ReplayRate,
+		BaseURL:     cfg.ReplayBase,
+	})
+	if result != nil {
+		result.WriteSummary(os.Stdout)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Printf("Replay interrupted")
+		return nil
+	}
+	return err
+}
+
+// runConvert 把 -convert 指定的二进制抓包转换为HAR，HAR的格式选项与抓包时的 -o 相同，返回转换的条目数
+func runConvert(cfg *cli.Config) (int, error) {
+	if cfg.ConvertOutput == "" {
+		return 0, errors.New("no output file: use -convert in.bin out.har or -o out.har")
+	}
+	in, err := os.Open(cfg.ConvertInput)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	harLogger := harlogger.NewLogger(cfg.ConvertOutput, appName, appVersion)
+	harLogger.SetPageGrouping(!cfg.HarNoPages)
+	harLogger.SetCompact(cfg.HarCompact)
+	harLogger.SetDecodeCompressed(cfg.HarDecode)
+	harLogger.SetNoBodies(cfg.NoBodies)
+
+	count, convertErr := binlog.ConvertToHAR(in, harLogger)
+	// 抓包末尾被截断时仍然保存已转换的条目
+	if err := harLogger.Close(); err != nil {
+		return count, err
+	}
+	return count, convertErr
+}
+
+// variableRules 解析 -extract 和 -inject 规则
+func variableRules(cfg *cli.Config) ([]*proxy.ExtractRule, []*proxy.InjectRule, error) {
+	var extracts []*proxy.ExtractRule
+	for _, spec := range cfg.Extracts {
+		rule, err := proxy.ParseExtractRule(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("-extract: %w", err)
+		}
+		extracts = append(extracts, rule)
+	}
+	var injects []*proxy.InjectRule
+	for _, spec := range cfg.Injects {
+		rule, err := proxy.ParseInjectRule(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("-inject: %w", err)
+		}
+		injects = append(injects, rule)
+	}
+	return extracts, injects, nil
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultAutoPassthroughTTL 是AutoPassthroughTTL为0时，拒绝MITM证书的主机保持直接隧道的时长
+const DefaultAutoPassthroughTTL = time.Hour
+
+// errClientRejectedCert 表示客户端收到MITM证书后中止了握手，通常说明客户端做了证书固定
+var errClientRejectedCert = errors.New("client rejected the MITM certificate")
+
+// certRejectionAlerts 是客户端拒绝证书时发送的TLS告警，crypto/tls将其报告为 "remote error: tls: <告警>"
+var certRejectionAlerts = []string{
+	"tls: bad certificate",
+	"tls: unsupported certificate",
+	"tls: certificate unknown",
+	"tls: unknown certificate authority",
+}
+
+// isClientCertRejection 判断握手错误是否是客户端因证书发送的TLS告警
+// 直接断开（EOF、ECONNRESET）也可能是客户端取消或超时，不视为拒绝证书
+func isClientCertRejection(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "remote error" || opErr.Err == nil {
+		return false
+	}
+	return slices.Contains(certRejectionAlerts, opErr.Err.Error())
+}
+
+func (s *Server) autoPassthroughTTL() time.Duration {
+	if s.AutoPassthroughTTL > 0 {
+		return s.AutoPassthroughTTL
+	}
+	return DefaultAutoPassthroughTTL
+}
+
+// rememberPassthrough 记录拒绝MITM证书的主机，TTL内到该主机的CONNECT直接建立隧道
+func (s *Server) rememberPassthrough(hostPort string) {
+	ttl := s.autoPassthroughTTL()
+	now := time.Now()
+	s.sweepPassthroughHosts(now)
+	s.passthroughHosts.Store(hostPort, now.Add(ttl))
+	s.warnf("[MITM for %s] Client aborted the handshake after receiving our certificate (likely certificate pinning); tunneling without interception for %s", hostPort, ttl)
+}
+
+// sweepPassthroughHosts 删除已过期的自动直通记录，避免不再访问的主机一直留在映射中
+func (s *Server) sweepPassthroughHosts(now time.Time) {
+	s.passthroughHosts.Range(func(key, value any) bool {
+		if now.After(value.(time.Time)) {
+			s.passthroughHosts.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
+
+// shouldPassthrough 返回到hostPort的CONNECT是否应直接建立隧道而不做MITM
+func (s *Server) shouldPassthrough(hostPort string) bool {
+	if !s.AutoPassthrough {
+		return false
+	}
+	value, ok := s.passthroughHosts.Load(hostPort)
+	if !ok {
+		return false
+	}
+	if time.Now().After(value.(time.Time)) {
+		s.passthroughHosts.CompareAndDelete(hostPort, value)
+		return false
+	}
+	return true
+}
+
+// dialTunnelTarget 连接隧道目标，配置了上层代理时经由代理链的CONNECT隧道到达
+// 离线缓存模式下不访问网络，返回errCacheOffline
+func (s *Server) dialTunnelTarget(ctx context.Context, hostPort string) (net.Conn, error) {
+	if s.Cache != nil && s.Cache.Offline() {
+		return nil, errCacheOffline
+	}
+	dialer := s.upstreamDialer()
+	if proxies := s.upstreamProxies(); len(proxies) > 0 && !s.bypassUpstream(hostPort) {
+		chain := &chainDialer{hops: proxies, base: dialer}
+		return chain.DialContext(ctx, "tcp", hostPort)
+	}
+	return dialer.DialContext(ctx, "tcp", hostPort)
+}
+
+// tunnelCONNECT 不做MITM，在客户端和目标之间原样转发字节，流量不会被记录
+func (s *Server) tunnelCONNECT(w http.ResponseWriter, r *http.Request, hostPort string) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	upstream, err := s.dialTunnelTarget(ctx, hostPort)
+	cancel()
+	if errors.Is(err, errCacheOffline) {
+		w.Header().Set(CacheHeader, "MISS")
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return err
+	}
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return err
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return errHijackingNotSupported
+	}
+	clientConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return err
+	}
+	defer clientConn.Close()
+
+	if err := sendConnectionEstablished(r, rw); err != nil {
+		return err
+	}
+	s.notifyTunnelEstablished(hostPort, false)
+
+	// 读取rw.Reader以带上CONNECT之后已被缓冲的客户端数据
+	relayTunnel(clientConn, rw.Reader, upstream)
+	return nil
+}
+
+// relayTunnel 在客户端和上游之间双向复制字节，clientReader包含客户端连接上已被缓冲的数据
+// 任一方向结束后关闭两端，使另一方向的复制也随之结束
+func relayTunnel(clientConn net.Conn, clientReader io.Reader, upstream net.Conn) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			_ = clientConn.Close()
+			_ = upstream.Close()
+		})
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(upstream, clientReader)
+		closeBoth()
+	}()
+	_, _ = io.Copy(clientConn, upstream)
+	closeBoth()
+	<-done
+}
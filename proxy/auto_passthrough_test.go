@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectAndRejectCert 通过代理CONNECT到target，并像做了证书固定的客户端一样拒绝代理返回的证书
+func connectAndRejectCert(t *testing.T, proxyAddr, target string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "CONNECT "+target+" HTTP/1.1\r\nHost: "+target+"\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         "127.0.0.1",
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+			return errors.New("pinned certificate mismatch")
+		},
+	})
+	require.Error(t, tlsConn.Handshake())
+}
+
+func newAutoPassthroughProxy(t *testing.T, enabled bool) (*Server, string) {
+	t.Helper()
+	server, err := New(Config{AutoPassthrough: enabled, AutoPassthroughTTL: time.Minute, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = server.Serve(listener) }()
+	return server, listener.Addr().String()
+}
+
+func TestAutoPassthroughAfterClientRejectsCertificate(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello from the real backend")
+	}))
+	defer backend.Close()
+	target := backend.Listener.Addr().String()
+
+	server, proxyAddr := newAutoPassthroughProxy(t, true)
+	assert.False(t, server.shouldPassthrough(target))
+
+	connectAndRejectCert(t, proxyAddr, target)
+	assert.Eventually(t, func() bool { return server.shouldPassthrough(target) }, 5*time.Second, 10*time.Millisecond)
+
+	// 下一次CONNECT直接建立隧道：只信任后端真实证书的客户端可以完成握手
+	proxyURL, _ := url.Parse("http://" + proxyAddr)
+	transport := backend.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	resp, err := client.Get(backend.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello from the real backend", string(body))
+}
+
+func TestAutoPassthroughDisabledKeepsIntercepting(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	target := backend.Listener.Addr().String()
+
+	server, proxyAddr := newAutoPassthroughProxy(t, false)
+	connectAndRejectCert(t, proxyAddr, target)
+
+	time.Sleep(100 * time.Millisecond)
+	_, remembered := server.passthroughHosts.Load(target)
+	assert.False(t, remembered)
+}
+
+func TestAutoPassthroughExpires(t *testing.T) {
+	server := &Server{AutoPassthrough: true, AutoPassthroughTTL: time.Minute}
+	server.passthroughHosts.Store("example.com:443", time.Now().Add(-time.Second))
+	assert.False(t, server.shouldPassthrough("example.com:443"))
+	_, ok := server.passthroughHosts.Load("example.com:443")
+	assert.False(t, ok)
+}
+
+func TestIsClientCertRejection(t *testing.T) {
+	alert := func(msg string) error {
+		return &net.OpError{Op: "remote error", Err: errors.New(msg)}
+	}
+	assert.True(t, isClientCertRejection(alert("tls: bad certificate")))
+	assert.True(t, isClientCertRejection(fmt.Errorf("handshake: %w", alert("tls: unknown certificate authority"))))
+
+	// 客户端断开、取消或超时不能说明做了证书固定
+	assert.False(t, isClientCertRejection(io.EOF))
+	assert.False(t, isClientCertRejection(&net.OpError{Op: "read", Err: syscall.ECONNRESET}))
+	assert.False(t, isClientCertRejection(alert("tls: protocol version not supported")))
+}
+
+func TestRememberPassthroughSweepsExpiredHosts(t *testing.T) {
+	server, err := New(Config{AutoPassthrough: true, AutoPassthroughTTL: time.Minute, LogWriter: io.Discard})
+	require.NoError(t, err)
+	server.passthroughHosts.Store("stale.example.com:443", time.Now().Add(-time.Second))
+	server.passthroughHosts.Store("fresh.example.com:443", time.Now().Add(time.Minute))
+
+	server.rememberPassthrough("pinned.example.com:443")
+
+	_, stale := server.passthroughHosts.Load("stale.example.com:443")
+	assert.False(t, stale)
+	assert.True(t, server.shouldPassthrough("fresh.example.com:443"))
+	assert.True(t, server.shouldPassthrough("pinned.example.com:443"))
+}
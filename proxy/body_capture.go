@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+)
+
+// SkipBodyRule 描述一类不保存响应体的响应：Content-Type以Prefix开头，且大小超过MinSize
+type SkipBodyRule struct {
+	Prefix  string
+	MinSize int64 // 为0时不限大小；响应没有Content-Length时视为超过
+}
+
+// ParseSkipBodyRules 解析逗号分隔的Content-Type前缀列表，每项可以用 ">大小" 指定阈值，
+// 例如 "video/,audio/,application/octet-stream>1MB"；空字符串表示不跳过任何响应体
+func ParseSkipBodyRules(spec string) ([]SkipBodyRule, error) {
+	var rules []SkipBodyRule
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, size, hasSize := strings.Cut(item, ">")
+		rule := SkipBodyRule{Prefix: strings.ToLower(strings.TrimSpace(prefix))}
+		if rule.Prefix == "" {
+			return nil, fmt.Errorf("invalid skip-body rule %q: empty content type", item)
+		}
+		if hasSize {
+			minSize, err := harlogger.ParseSize(size)
+			if err != nil {
+				return nil, fmt.Errorf("invalid skip-body rule %q: %w", item, err)
+			}
+			rule.MinSize = minSize
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// SkipBodyContentTypes 返回按Content-Type跳过响应体的捕获策略，命中规则的响应只记录大小和类型，响应体直接转发给客户端
+// 只有isBinaryContent认定为二进制的类型才会被跳过，避免过宽的前缀误伤JSON、HTML等需要查看的内容
+func SkipBodyContentTypes(rules []SkipBodyRule) ShouldCaptureBodyFunc {
+	return func(reqCtx *RequestContext, resp *http.Response) bool {
+		contentType := resp.Header.Get("Content-Type")
+		if !isBinaryContent(nil, contentType) {
+			return true
+		}
+		mediaType := strings.ToLower(strings.TrimSpace(contentType))
+		for _, rule := range rules {
+			if !strings.HasPrefix(mediaType, rule.Prefix) {
+				continue
+			}
+			if rule.MinSize <= 0 || resp.ContentLength < 0 || resp.ContentLength > rule.MinSize {
+				return false
+			}
+		}
+		return true
+	}
+}
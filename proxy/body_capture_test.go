@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// skipBodyRecorder 记录每个响应的SkipBody标记
+type skipBodyRecorder struct {
+	NoOpEventHandler
+	mu       sync.Mutex
+	skipBody map[string]bool
+}
+
+func (h *skipBodyRecorder) OnResponse(ctx *ResponseContext) *http.Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.skipBody[ctx.ReqCtx.Request.URL.Path] = ctx.SkipBody
+	return ctx.Response
+}
+
+func TestShouldCaptureBodySkipsContentType(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".mp4") {
+			w.Header().Set("Content-Type", "video/mp4")
+			_, _ = w.Write([]byte("fake video bytes"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer backend.Close()
+
+	recorder := &skipBodyRecorder{skipBody: make(map[string]bool)}
+	harPath := filepath.Join(t.TempDir(), "capture.har")
+	harLog := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	server := NewServerWithConfig(ServerConfig{
+		HarLogger:    harLog,
+		EventHandler: recorder,
+		ShouldCaptureBody: func(reqCtx *RequestContext, resp *http.Response) bool {
+			return !strings.HasPrefix(resp.Header.Get("Content-Type"), "video/")
+		},
+	})
+
+	for _, path := range []string{"/data.json", "/clip.mp4"} {
+		req := httptest.NewRequest(http.MethodGet, backend.URL+path, nil)
+		w := httptest.NewRecorder()
+		server.handleHTTP(w, req)
+
+		// 不论是否保存响应体，客户端都应收到完整内容
+		body, err := io.ReadAll(w.Result().Body)
+		require.NoError(t, err)
+		if path == "/clip.mp4" {
+			assert.Equal(t, "fake video bytes", string(body))
+		} else {
+			assert.Equal(t, `{"ok":true}`, string(body))
+		}
+	}
+
+	recorder.mu.Lock()
+	assert.False(t, recorder.skipBody["/data.json"])
+	assert.True(t, recorder.skipBody["/clip.mp4"])
+	recorder.mu.Unlock()
+
+	// HAR中视频响应只保留元数据
+	require.NoError(t, harLog.Save())
+	data, err := os.ReadFile(harPath)
+	require.NoError(t, err)
+	var har harlogger.HAR
+	require.NoError(t, json.Unmarshal(data, &har))
+	require.Len(t, har.Log.Entries, 2)
+	assert.Equal(t, `{"ok":true}`, har.Log.Entries[0].Response.Content.Text)
+	assert.Empty(t, har.Log.Entries[1].Response.Content.Text)
+	assert.Equal(t, int64(len("fake video bytes")), har.Log.Entries[1].Response.Content.Size)
+}
+
+func TestDefaultShouldCaptureBody(t *testing.T) {
+	server := NewServerWithConfig(ServerConfig{})
+	require.NotNil(t, server.ShouldCaptureBody)
+	assert.True(t, server.shouldCaptureBody(&RequestContext{}, &http.Response{Header: make(http.Header)}))
+
+	// 直接构造的Server未设置回调时同样保存所有响应体
+	assert.True(t, (&Server{}).shouldCaptureBody(&RequestContext{}, &http.Response{Header: make(http.Header)}))
+}
+
+func TestParseSkipBodyRules(t *testing.T) {
+	rules, err := ParseSkipBodyRules("video/, Audio/ ,application/octet-stream>1MB")
+	require.NoError(t, err)
+	assert.Equal(t, []SkipBodyRule{
+		{Prefix: "video/"},
+		{Prefix: "audio/"},
+		{Prefix: "application/octet-stream", MinSize: 1 << 20},
+	}, rules)
+
+	rules, err = ParseSkipBodyRules("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, spec := range []string{">1MB", "video/>big"} {
+		_, err := ParseSkipBodyRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSkipBodyContentTypes(t *testing.T) {
+	rules, err := ParseSkipBodyRules("video/,audio/,application/octet-stream>1KB,text/")
+	require.NoError(t, err)
+	capture := SkipBodyContentTypes(rules)
+
+	response := func(contentType string, size int64) *http.Response {
+		return &http.Response{Header: http.Header{"Content-Type": []string{contentType}}, ContentLength: size}
+	}
+	tests := []struct {
+		name string
+		resp *http.Response
+		want bool
+	}{
+		{"video", response("video/mp4", 100), false},
+		{"audio_with_params", response("Audio/MPEG; bitrate=128", 100), false},
+		{"small_download", response("application/octet-stream", 512), true},
+		{"large_download", response("application/octet-stream", 4096), false},
+		{"unknown_length_download", response("application/octet-stream", -1), false},
+		// 文本类型即使命中前缀也会保存
+		{"json", response("application/json", 1<<20), true},
+		{"html", response("text/html", 100), true},
+		{"no_content_type", response("", 100), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, capture(&RequestContext{}, tt.resp))
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BodyReplacement 是一条对文本响应体执行的正则替换规则
+type BodyReplacement struct {
+	Hosts       *BypassList // 生效的主机范围，语法与 -no-upstream-for 相同，为nil时对所有主机生效
+	Pattern     *regexp.Regexp
+	Replacement []byte // 支持 $1、${name} 引用分组
+	Global      bool   // 为false时只替换第一处匹配
+}
+
+// ParseBodyReplacement 解析 sed 风格的替换规则：[host]/pattern/replacement/[flags]
+//   - "/foo/bar/g" 在所有主机的响应中把 foo 全部替换为 bar
+//   - "api.example.com/v1/v2/" 只替换 api.example.com 及其子域名响应中的第一处 v1
+//
+// flags 支持 g（全部替换）、i（忽略大小写）、m（多行）和 s（. 匹配换行），"\/" 表示字面的斜杠
+func ParseBodyReplacement(spec string) (*BodyReplacement, error) {
+	start := strings.Index(spec, "/")
+	if start < 0 {
+		return nil, fmt.Errorf("invalid replacement %q: want [host]/pattern/replacement/[flags]", spec)
+	}
+	parts := splitReplacementSpec(spec[start+1:])
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid replacement %q: want [host]/pattern/replacement/[flags]", spec)
+	}
+	pattern, replacement, flags := parts[0], parts[1], parts[2]
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid replacement %q: empty pattern", spec)
+	}
+
+	rule := &BodyReplacement{Replacement: []byte(replacement)}
+	var modifiers string
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			rule.Global = true
+		case 'i', 'm', 's':
+			if !strings.ContainsRune(modifiers, flag) {
+				modifiers += string(flag)
+			}
+		default:
+			return nil, fmt.Errorf("invalid replacement %q: unknown flag %q", spec, flag)
+		}
+	}
+	if modifiers != "" {
+		pattern = "(?" + modifiers + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replacement %q: %w", spec, err)
+	}
+	rule.Pattern = re
+
+	if host := strings.TrimSpace(spec[:start]); host != "" {
+		hosts, err := ParseBypassList(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replacement host %q: %w", host, err)
+		}
+		rule.Hosts = hosts
+	}
+	return rule, nil
+}
+
+// splitReplacementSpec 按未转义的斜杠切分 pattern/replacement/flags，"\/" 还原为 "/"，其余转义原样保留给正则
+func splitReplacementSpec(s string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '/':
+			current.WriteByte('/')
+			i++
+		case s[i] == '/':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+// Matches 判断规则是否对目标主机（可带端口）生效
+func (r *BodyReplacement) Matches(hostPort string) bool {
+	return r.Hosts == nil || r.Hosts.Match(hostPort)
+}
+
+// Apply 对响应体执行替换，返回替换后的内容
+func (r *BodyReplacement) Apply(body []byte) []byte {
+	if r.Global {
+		return r.Pattern.ReplaceAll(body, r.Replacement)
+	}
+	loc := r.Pattern.FindSubmatchIndex(body)
+	if loc == nil {
+		return body
+	}
+	result := make([]byte, 0, len(body))
+	result = append(result, body[:loc[0]]...)
+	result = r.Pattern.Expand(result, r.Replacement, body, loc)
+	return append(result, body[loc[1]:]...)
+}
+
+// replaceResponseBody 对文本响应体执行 BodyReplacements 中匹配目标主机的规则，并更新Content-Length
+// SSE、没有响应体（HEAD、304等）和仍保持压缩的响应不做替换；在事件通知和HAR记录之前执行，因此记录的是替换后的内容
+func (s *Server) replaceResponseBody(resp *http.Response, reqCtx *RequestContext) {
+	if len(s.BodyReplacements) == 0 || resp == nil || resp.Body == nil || reqCtx == nil {
+		return
+	}
+	if ResponseHasNoBody(resp) || s.isStreamingResponse(resp) || !isTextContentType(resp.Header.Get("Content-Type")) {
+		return
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return
+	}
+
+	host := replacementTargetHost(reqCtx)
+	var rules []*BodyReplacement
+	for _, rule := range s.BodyReplacements {
+		if rule.Matches(host) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		s.warnf("[Replace] 读取响应体失败: %v", err)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return
+	}
+
+	replaced := body
+	for _, rule := range rules {
+		replaced = rule.Apply(replaced)
+	}
+	if !bytes.Equal(replaced, body) {
+		s.debugf("[Replace] 已替换 %s 的响应体: %d -> %d 字节", host, len(body), len(replaced))
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(replaced))
+	resp.ContentLength = int64(len(replaced))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(replaced)))
+	resp.TransferEncoding = nil
+}
+
+// replacementTargetHost 返回用于匹配替换规则的目标主机
+func replacementTargetHost(reqCtx *RequestContext) string {
+	if u, err := url.Parse(reqCtx.TargetURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	if reqCtx.Request != nil {
+		return reqCtx.Request.Host
+	}
+	return ""
+}
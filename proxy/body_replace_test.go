@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceResponseBodyJSON(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"beta":false,"api":"https://api.example.com/v1","legacy":false}`))
+	}))
+	defer backend.Close()
+
+	var rules []*BodyReplacement
+	for _, spec := range []string{`/"beta":false/"beta":true/`, `/api\.example\.com\/v1/staging.example.com\/v2/g`} {
+		rule, err := ParseBodyReplacement(spec)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+
+	harPath := filepath.Join(t.TempDir(), "replace.har")
+	harLog := harlogger.NewLogger(harPath, "TestProxy", "1.0")
+	server := &Server{
+		HarLogger:        harLog,
+		EventHandler:     &mockEventHandler{},
+		BodyReplacements: rules,
+	}
+	proxyServer := httptest.NewServer(http.HandlerFunc(server.handleHTTP))
+	defer proxyServer.Close()
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(backend.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	expected := `{"beta":true,"api":"https://staging.example.com/v2","legacy":false}`
+	assert.Equal(t, expected, string(body))
+	assert.Equal(t, int64(len(expected)), resp.ContentLength)
+	assert.Equal(t, strconv.Itoa(len(expected)), resp.Header.Get("Content-Length"))
+
+	require.NoError(t, harLog.Save())
+	data, err := os.ReadFile(harPath)
+	require.NoError(t, err)
+	var har harlogger.HAR
+	require.NoError(t, json.Unmarshal(data, &har))
+	require.Len(t, har.Log.Entries, 1)
+	assert.Equal(t, expected, har.Log.Entries[0].Response.Content.Text)
+}
+
+func TestReplaceResponseBodySkipsOtherHostsAndBinary(t *testing.T) {
+	rule, err := ParseBodyReplacement("other.example.com/foo/bar/g")
+	require.NoError(t, err)
+	assert.True(t, rule.Matches("api.other.example.com:443"))
+	assert.False(t, rule.Matches("127.0.0.1:8080"))
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image" {
+			w.Header().Set("Content-Type", "image/png")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		_, _ = w.Write([]byte("foo foo"))
+	}))
+	defer backend.Close()
+
+	global, err := ParseBodyReplacement("/foo/bar/g")
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		path  string
+		rules []*BodyReplacement
+		want  string
+	}{
+		{"/text", []*BodyReplacement{rule}, "foo foo"},
+		{"/image", []*BodyReplacement{global}, "foo foo"},
+		{"/text", []*BodyReplacement{global}, "bar bar"},
+	} {
+		server := &Server{EventHandler: &mockEventHandler{}, BodyReplacements: tc.rules}
+		req, err := http.NewRequest("GET", backend.URL+tc.path, nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.handleHTTP(recorder, req)
+		assert.Equal(t, tc.want, recorder.Body.String(), tc.path)
+	}
+}
+
+func TestParseBodyReplacement(t *testing.T) {
+	rule, err := ParseBodyReplacement(`/(\w+)@example\.com/$1@test.local/`)
+	require.NoError(t, err)
+	assert.Nil(t, rule.Hosts)
+	assert.False(t, rule.Global)
+	assert.Equal(t, "a@test.local b@example.com", string(rule.Apply([]byte("a@example.com b@example.com"))))
+
+	rule, err = ParseBodyReplacement(`/FLAG/on/gi`)
+	require.NoError(t, err)
+	assert.Equal(t, "on on", string(rule.Apply([]byte("flag Flag"))))
+
+	rule, err = ParseBodyReplacement(`/a\/b/c\/d/g`)
+	require.NoError(t, err)
+	assert.Equal(t, "x c/d", string(rule.Apply([]byte("x a/b"))))
+
+	for _, spec := range []string{"foo", "/foo/bar", "//bar/g", "/foo/bar/x", "/(/bar/"} {
+		_, err := ParseBodyReplacement(spec)
+		assert.Error(t, err, spec)
+	}
+}
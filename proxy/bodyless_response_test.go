@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodylessResponsesRecordNoBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Length", "11")
+		if r.Method != http.MethodHead {
+			w.Write([]byte("hello world"))
+		}
+	}))
+	defer backend.Close()
+
+	rule, err := ParseBodyReplacement("/hello/bye/")
+	require.NoError(t, err)
+	harPath := filepath.Join(t.TempDir(), "bodyless.har")
+	harLogger := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	server := NewServerWithConfig(Config{
+		HarLogger:        harLogger,
+		BodyReplacements: []*BodyReplacement{rule},
+	})
+	proxyServer := httptest.NewServer(http.HandlerFunc(server.handleHTTP))
+	defer proxyServer.Close()
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Head(backend.URL + "/page")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// 替换规则不能把HEAD响应的Content-Length改成0
+	assert.Equal(t, int64(11), resp.ContentLength)
+
+	req, err := http.NewRequest(http.MethodGet, backend.URL+"/page", nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", `"v1"`)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	require.NoError(t, harLogger.Save())
+	data, err := os.ReadFile(harPath)
+	require.NoError(t, err)
+	var har harlogger.HAR
+	require.NoError(t, json.Unmarshal(data, &har))
+	entries := har.Log.Entries
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, int64(0), entry.Response.BodySize)
+		assert.Equal(t, int64(0), entry.Response.Content.Size)
+		assert.Empty(t, entry.Response.Content.Text)
+	}
+	assert.Equal(t, http.MethodHead, entries[0].Request.Method)
+	assert.Equal(t, http.StatusNotModified, entries[1].Response.Status)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newChainTestCA(t *testing.T, name string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestMITMServesIntermediateChain(t *testing.T) {
+	root, rootKey := newChainTestCA(t, "Corp Root", nil, nil)
+	intermediate, intermediateKey := newChainTestCA(t, "Corp MITM Intermediate", root, rootKey)
+
+	certManager, err := certs.NewManagerFromCA(intermediate, intermediateKey)
+	require.NoError(t, err)
+	require.NoError(t, certManager.LoadCAChainPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})))
+
+	server := &Server{CertManager: certManager}
+	tlsConfig, err := server.tlsConfigForHost("secure.example.com")
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		conn := tls.Server(serverConn, tlsConfig)
+		_ = conn.Handshake()
+		_ = conn.Close()
+	}()
+
+	// 客户端只信任根证书，必须依赖服务端下发的中间证书才能完成验证
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	client := tls.Client(clientConn, &tls.Config{ServerName: "secure.example.com", RootCAs: roots})
+	require.NoError(t, client.Handshake())
+
+	state := client.ConnectionState()
+	require.Len(t, state.PeerCertificates, 2)
+	assert.Equal(t, "secure.example.com", state.PeerCertificates[0].Subject.CommonName)
+	assert.Equal(t, intermediate.Raw, state.PeerCertificates[1].Raw)
+	require.NotEmpty(t, state.VerifiedChains)
+	assert.Equal(t, root.Raw, state.VerifiedChains[0][len(state.VerifiedChains[0])-1].Raw)
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/LubyRuffy/ProxyCraft/certs"
+)
+
+// CAPageHost 是经由代理访问CA下载页面时使用的主机名，例如 http://ca.proxycraft/ ，该名称不会被真正解析
+const CAPageHost = "ca.proxycraft"
+
+// caPagePath 是直接访问代理监听地址时CA下载页面的路径，例如 http://127.0.0.1:38080/ca
+const caPagePath = "/ca"
+
+// caDownload 描述CA证书的一种下载格式
+type caDownload struct {
+	File        string
+	ContentType string
+	Label       string
+}
+
+var caDownloads = []caDownload{
+	{File: "proxycraft-ca.pem", ContentType: "application/x-pem-file", Label: "PEM (.pem) - macOS, Linux, Firefox, most tools"},
+	{File: "proxycraft-ca.cer", ContentType: "application/x-x509-ca-cert", Label: "DER (.cer) - Windows, iOS, Android"},
+	{File: "proxycraft-ca.p12", ContentType: "application/x-pkcs12", Label: "PKCS#12 (.p12, empty password) - Java keystores, some MDM tools"},
+}
+
+var caPageTemplate = template.Must(template.New("ca").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>ProxyCraft CA certificate</title>
+<style>body{font-family:sans-serif;max-width:46em;margin:2em auto;padding:0 1em;line-height:1.5}code{background:#eee;padding:0 .3em}</style>
+</head>
+<body>
+<h1>ProxyCraft CA certificate</h1>
+<p>Install and trust this certificate to let ProxyCraft inspect HTTPS traffic from this device.
+Only install it on devices you control, and remove it when you are done.</p>
+<p>Certificate: <b>{{.Subject}}</b><br>SHA-256 fingerprint: <code>{{.Fingerprint}}</code></p>
+<h2>Download</h2>
+<ul>{{range .Downloads}}
+<li><a href="{{$.Base}}/{{.File}}">{{.Label}}</a></li>{{end}}
+</ul>
+<h2>Install</h2>
+<h3>Windows</h3>
+<p>Open the .cer file, choose <i>Install Certificate</i>, select <i>Local Machine</i> and place it in <i>Trusted Root Certification Authorities</i>.
+Or run <code>certutil -addstore -f Root proxycraft-ca.cer</code> as administrator.</p>
+<h3>macOS</h3>
+<p>Run <code>sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain proxycraft-ca.pem</code>,
+or open the file in Keychain Access and set <i>When using this certificate</i> to <i>Always Trust</i>.</p>
+<h3>iOS / iPadOS</h3>
+<p>Download the .cer file in Safari and allow the profile, install it in <i>Settings &gt; General &gt; VPN &amp; Device Management</i>,
+then enable full trust in <i>Settings &gt; General &gt; About &gt; Certificate Trust Settings</i>.</p>
+<h3>Android</h3>
+<p>Download the .cer file and install it in <i>Settings &gt; Security &gt; Encryption &amp; credentials &gt; Install a certificate &gt; CA certificate</i>.
+Apps targeting Android 7 or later only trust user CAs when their network security config allows it.</p>
+<h3>Linux</h3>
+<p>Debian/Ubuntu: <code>sudo cp proxycraft-ca.pem /usr/local/share/ca-certificates/proxycraft-ca.crt &amp;&amp; sudo update-ca-certificates</code><br>
+Fedora/RHEL: <code>sudo cp proxycraft-ca.pem /etc/pki/ca-trust/source/anchors/ &amp;&amp; sudo update-ca-trust</code></p>
+<h3>Firefox</h3>
+<p>Firefox uses its own store: <i>Settings &gt; Privacy &amp; Security &gt; Certificates &gt; View Certificates &gt; Authorities &gt; Import</i>, then trust it for websites.</p>
+<h3>Java</h3>
+<p><code>keytool -importcert -cacerts -alias proxycraft -file proxycraft-ca.pem</code></p>
+</body>
+</html>
+`))
+
+// serveCAPage 响应CA下载页面及证书文件的请求，返回false表示请求与页面无关，应继续代理
+// 页面可以通过代理访问 http://ca.proxycraft/ ，也可以直接访问代理监听地址的 /ca
+func (s *Server) serveCAPage(w http.ResponseWriter, r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	var base, path string
+	switch {
+	case strings.EqualFold(host, CAPageHost):
+		base, path = "", r.URL.Path
+	case !r.URL.IsAbs() && isRequestToListener(r) && (r.URL.Path == caPagePath || strings.HasPrefix(r.URL.Path, caPagePath+"/")):
+		base, path = caPagePath, strings.TrimPrefix(r.URL.Path, caPagePath)
+	default:
+		return false
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return true
+	}
+	var caCert *x509.Certificate
+	if s.CertManager != nil {
+		caCert, _, _ = s.CertManager.CA()
+	}
+	if caCert == nil {
+		http.Error(w, "CA certificate is not loaded", http.StatusServiceUnavailable)
+		return true
+	}
+	s.infof("[CA] Serving %s%s to %s", base, path, r.RemoteAddr)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if path == "" || path == "/" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = caPageTemplate.Execute(w, map[string]interface{}{
+			"Subject":     caCert.Subject.CommonName,
+			"Fingerprint": certs.Fingerprint(caCert.Raw),
+			"Downloads":   caDownloads,
+			"Base":        base,
+		})
+		return true
+	}
+
+	for _, download := range caDownloads {
+		if path != "/"+download.File {
+			continue
+		}
+		var body []byte
+		switch {
+		case strings.HasSuffix(download.File, ".pem"):
+			body = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})
+		case strings.HasSuffix(download.File, ".cer"):
+			body = caCert.Raw
+		default:
+			p12, err := s.CertManager.CACertPKCS12()
+			if err != nil {
+				s.errorf("[CA] Failed to encode the CA certificate as PKCS#12: %v", err)
+				http.Error(w, "Failed to encode the CA certificate", http.StatusInternalServerError)
+				return true
+			}
+			body = p12
+		}
+		w.Header().Set("Content-Type", download.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+download.File+`"`)
+		_, _ = w.Write(body)
+		return true
+	}
+
+	http.NotFound(w, r)
+	return true
+}
+
+// isRequestToListener 判断origin-form请求的Host是否就是代理自己的监听地址，而不是h2c等方式代理的目标主机
+func isRequestToListener(r *http.Request) bool {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	localHost, localPort, err := net.SplitHostPort(local.String())
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil || port != localPort {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.Equal(net.ParseIP(localHost)))
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCAPageViaProxyHost(t *testing.T) {
+	certManager, err := certs.NewInMemoryManager()
+	require.NoError(t, err)
+	client := newViaTestClient(t, Config{CertManager: certManager})
+
+	resp, err := client.Get("http://" + CAPageHost + "/")
+	require.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(page), `href="/proxycraft-ca.pem"`)
+	assert.Contains(t, string(page), certs.Fingerprint(certManager.CACert.Raw))
+
+	resp, err = client.Get("http://" + CAPageHost + "/proxycraft-ca.pem")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "application/x-pem-file", resp.Header.Get("Content-Type"))
+	block, _ := pem.Decode(body)
+	require.NotNil(t, block)
+	assert.Equal(t, certManager.CACert.Raw, block.Bytes)
+}
+
+func TestCAPageOnListenerAddress(t *testing.T) {
+	certManager, err := certs.NewInMemoryManager()
+	require.NoError(t, err)
+	server, err := New(Config{CertManager: certManager, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+	base := "http://" + listener.Addr().String()
+
+	resp, err := http.Get(base + "/ca")
+	require.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(page), `href="/ca/proxycraft-ca.cer"`)
+
+	resp, err = http.Get(base + "/ca/proxycraft-ca.cer")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "application/x-x509-ca-cert", resp.Header.Get("Content-Type"))
+	assert.Equal(t, certManager.CACert.Raw, body)
+
+	resp, err = http.Get(base + "/ca/proxycraft-ca.p12")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "application/x-pkcs12", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, body)
+
+	resp, err = http.Get(base + "/ca/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CertPins 按主机名保存上游服务器证书的SHA-256指纹，用于信任自签名的上游证书
+// 命中的主机只接受叶子证书指纹与固定值一致的连接，不再校验CA链；未固定的主机保持原有行为
+type CertPins map[string][][sha256.Size]byte
+
+// CertPinError 表示上游服务器证书与固定的指纹不一致
+type CertPinError struct {
+	Host string
+	Got  [sha256.Size]byte
+	Want [][sha256.Size]byte
+}
+
+func (e *CertPinError) Error() string {
+	want := make([]string, 0, len(e.Want))
+	for _, pin := range e.Want {
+		want = append(want, hex.EncodeToString(pin[:]))
+	}
+	return fmt.Sprintf("certificate pin mismatch for %s: got sha256 %s, want %s",
+		e.Host, hex.EncodeToString(e.Got[:]), strings.Join(want, " or "))
+}
+
+// ParseCertPins 解析 -pin 规则，每条格式为 "host=sha256hex"，指纹是叶子证书DER编码的SHA-256，
+// 可以带冒号分隔（如 openssl x509 -fingerprint -sha256 的输出）；同一主机可固定多个指纹以便轮换证书
+// 没有规则时返回nil
+func ParseCertPins(specs []string) (CertPins, error) {
+	pins := CertPins{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		hostPart, pinPart, ok := strings.Cut(spec, "=")
+		host := normalizePinHost(hostPart)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid pin %q: want host=sha256hex", spec)
+		}
+		digest, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(pinPart), ":", ""))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid pin %q: fingerprint must be %d hex-encoded SHA-256 bytes", spec, sha256.Size)
+		}
+		var pin [sha256.Size]byte
+		copy(pin[:], digest)
+		pins[host] = append(pins[host], pin)
+	}
+	if len(pins) == 0 {
+		return nil, nil
+	}
+	return pins, nil
+}
+
+// String 返回便于日志输出的描述
+func (p CertPins) String() string {
+	hosts := make([]string, 0, len(p))
+	for host := range p {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return strings.Join(hosts, ", ")
+}
+
+// verifier 返回用于tls.Config.VerifyPeerCertificate的校验函数，host没有固定指纹时返回nil
+// 配合InsecureSkipVerify使用：跳过CA链校验，只比较叶子证书的指纹
+func (p CertPins) verifier(host string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	host = normalizePinHost(host)
+	want := p[host]
+	if len(want) == 0 {
+		return nil
+	}
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return &CertPinError{Host: host, Want: want}
+		}
+		got := sha256.Sum256(rawCerts[0])
+		for _, pin := range want {
+			if got == pin {
+				return nil
+			}
+		}
+		return &CertPinError{Host: host, Got: got, Want: want}
+	}
+}
+
+// normalizePinHost 去掉端口和IPv6方括号，统一小写
+func normalizePinHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(extractHostname(strings.TrimSpace(host))), ".")
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCertPins(t *testing.T) {
+	digest := sha256.Sum256([]byte("cert"))
+	plain := hex.EncodeToString(digest[:])
+	colons := strings.ToUpper(plain[:2])
+	for i := 2; i < len(plain); i += 2 {
+		colons += ":" + strings.ToUpper(plain[i:i+2])
+	}
+
+	pins, err := ParseCertPins([]string{"API.example.com:443=" + plain, "api.example.com=" + colons, "[::1]=" + plain})
+	require.NoError(t, err)
+	assert.Len(t, pins["api.example.com"], 2)
+	assert.Equal(t, digest, pins["api.example.com"][1])
+	assert.Len(t, pins["::1"], 1)
+	assert.Equal(t, "::1, api.example.com", pins.String())
+
+	pins, err = ParseCertPins(nil)
+	require.NoError(t, err)
+	assert.Nil(t, pins)
+
+	for _, spec := range []string{"api.example.com", "=" + plain, "a.test=abcd", "a.test=" + plain + "00", "a.test=zz" + plain[2:]} {
+		_, err := ParseCertPins([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCertPinning(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "pinned")
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	fingerprint := sha256.Sum256(backend.Certificate().Raw)
+	wrong := sha256.Sum256([]byte("another certificate"))
+
+	pinned := func(t *testing.T, digest [sha256.Size]byte) CertPins {
+		pins, err := ParseCertPins([]string{backendURL.Host + "=" + hex.EncodeToString(digest[:])})
+		require.NoError(t, err)
+		return pins
+	}
+
+	t.Run("matching pin", func(t *testing.T) {
+		client := newViaTestClient(t, Config{CertPins: pinned(t, fingerprint)})
+		resp, err := client.Get(backend.URL + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "pinned", string(body))
+	})
+
+	t.Run("mismatched pin", func(t *testing.T) {
+		client := newViaTestClient(t, Config{CertPins: pinned(t, wrong)})
+		resp, err := client.Get(backend.URL + "/")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+		server := &Server{CertPins: pinned(t, wrong)}
+		transport := server.newTransport(backendURL.Host, true)
+		defer transport.CloseIdleConnections()
+		_, err = transport.RoundTrip(httptest.NewRequest(http.MethodGet, backend.URL+"/", nil).WithContext(t.Context()))
+		require.Error(t, err)
+		var pinErr *CertPinError
+		require.ErrorAs(t, err, &pinErr)
+		assert.Equal(t, fingerprint, pinErr.Got)
+		assert.Contains(t, err.Error(), "certificate pin mismatch for 127.0.0.1: got sha256 "+hex.EncodeToString(fingerprint[:]))
+		assert.Equal(t, ErrorKindTLS, ClassifyError(err))
+	})
+
+	t.Run("other hosts unaffected", func(t *testing.T) {
+		pins, err := ParseCertPins([]string{"elsewhere.test=" + hex.EncodeToString(wrong[:])})
+		require.NoError(t, err)
+		client := newViaTestClient(t, Config{CertPins: pins})
+		resp, err := client.Get(backend.URL + "/")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
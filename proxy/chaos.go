@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ChaosReset 是RequestContext.ChaosFault的取值之一，表示直接断开客户端连接而不是返回错误响应
+const ChaosReset = "reset"
+
+// ChaosHeader 标记注入的错误响应，便于在客户端和记录中区分真实的上游错误
+const ChaosHeader = "X-ProxyCraft-Chaos"
+
+// errChaosReset 是注入连接断开时交给OnError的错误
+var errChaosReset = errors.New("chaos: injected connection reset")
+
+// defaultChaosStatuses 是未指定故障时随机注入的状态码
+var defaultChaosStatuses = []string{"500", "502", "503"}
+
+// Chaos 按比例对匹配的请求注入错误响应或断开连接，用于测试客户端的容错能力
+type Chaos struct {
+	rate   float64
+	faults []string    // 状态码或ChaosReset
+	hosts  *BypassList // 为nil时匹配所有主机
+	random func() float64
+}
+
+// ParseChaos 解析 "rate[,faults[,hosts]]"，例如 "0.1,500|503|reset,api.example.com|.test"
+// faults 是以 | 分隔的状态码（400-599）或 reset，缺省为 500|502|503；hosts 是以 | 分隔的主机、域名后缀或CIDR，语法同 -no-upstream-for，缺省匹配所有主机
+func ParseChaos(spec string) (*Chaos, error) {
+	parts := strings.SplitN(spec, ",", 3)
+	rate, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("invalid chaos rate %q: must be in (0, 1]", parts[0])
+	}
+
+	chaos := &Chaos{rate: rate, faults: defaultChaosStatuses, random: rand.Float64}
+	if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+		chaos.faults = nil
+		for _, fault := range strings.Split(parts[1], "|") {
+			fault = strings.ToLower(strings.TrimSpace(fault))
+			if fault == "drop" {
+				fault = ChaosReset
+			}
+			if fault != ChaosReset {
+				status, err := strconv.Atoi(fault)
+				if err != nil || status < 400 || status > 599 {
+					return nil, fmt.Errorf("invalid chaos fault %q: want a 4xx/5xx status code or %q", fault, ChaosReset)
+				}
+			}
+			chaos.faults = append(chaos.faults, fault)
+		}
+	}
+	if len(parts) > 2 {
+		hosts, err := ParseBypassList(strings.ReplaceAll(parts[2], "|", ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos hosts: %w", err)
+		}
+		chaos.hosts = hosts
+	}
+	return chaos, nil
+}
+
+// String 返回便于日志输出的描述
+func (c *Chaos) String() string {
+	hosts := "all hosts"
+	if c.hosts != nil {
+		hosts = "matching hosts"
+	}
+	return fmt.Sprintf("%.0f%% of requests to %s fail with %s", c.rate*100, hosts, strings.Join(c.faults, "|"))
+}
+
+// pick 决定是否对发往host的请求注入故障，返回状态码、ChaosReset或空字符串
+func (c *Chaos) pick(host string) string {
+	if c == nil || (c.hosts != nil && !c.hosts.Match(host)) {
+		return ""
+	}
+	if c.rate < 1 && c.random() >= c.rate {
+		return ""
+	}
+	return c.faults[rand.IntN(len(c.faults))]
+}
+
+// chaosFaultKey 是转发请求context中保存注入故障的键
+type chaosFaultKey struct{}
+
+// withChaosFault 把注入的故障附加到转发请求上，由sendProxyRequest代替真正的上游请求
+func withChaosFault(req *http.Request, fault string) *http.Request {
+	if fault == "" {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), chaosFaultKey{}, fault))
+}
+
+// injectChaos 按转发请求上附加的故障生成错误响应或errChaosReset，未注入故障时返回false
+func injectChaos(req *http.Request) (*http.Response, bool, error) {
+	fault, ok := req.Context().Value(chaosFaultKey{}).(string)
+	if !ok {
+		return nil, false, nil
+	}
+	if fault == ChaosReset {
+		return nil, true, errChaosReset
+	}
+
+	status, _ := strconv.Atoi(fault)
+	body := fmt.Sprintf("ProxyCraft chaos: injected %d %s\n", status, http.StatusText(status))
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set(ChaosHeader, fault)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, true, nil
+}
+
+// resetConn 关闭连接并让TCP发送RST而不是FIN，模拟连接被强制中断
+// 逐层经由NetConn找到底层的TCP连接（TLS、监听器的计数包装等），但关闭最外层，使包装的清理逻辑照常执行
+func resetConn(conn net.Conn) {
+	for inner := conn; inner != nil; {
+		if tcpConn, ok := inner.(*net.TCPConn); ok {
+			_ = tcpConn.SetLinger(0)
+			break
+		}
+		wrapper, ok := inner.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		inner = wrapper.NetConn()
+	}
+	_ = conn.Close()
+}
+
+// abortHTTPHandler 在http.Handler中模拟连接断开：HTTP/1.x劫持连接后发送RST，HTTP/2只重置当前流
+func abortHTTPHandler(w http.ResponseWriter) {
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			resetConn(conn)
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chaosRecorder 记录OnRequest看到的注入故障和OnResponse收到的状态码
+type chaosRecorder struct {
+	NoOpEventHandler
+	mu       sync.Mutex
+	faults   []string
+	statuses []int
+	errors   []error
+}
+
+func (r *chaosRecorder) OnRequest(ctx *RequestContext) *http.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults = append(r.faults, ctx.ChaosFault)
+	return nil
+}
+
+func (r *chaosRecorder) OnResponse(ctx *ResponseContext) *http.Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, ctx.Response.StatusCode)
+	return nil
+}
+
+func (r *chaosRecorder) OnError(err error, _ *RequestContext) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+func TestChaosInjectsStatusForEveryMatchingRequest(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	chaos, err := ParseChaos("1.0,503,127.0.0.1")
+	require.NoError(t, err)
+	recorder := &chaosRecorder{}
+	client := newViaTestClient(t, Config{Chaos: chaos, EventHandler: recorder})
+
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(backend.URL + "/api")
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "503", resp.Header.Get(ChaosHeader))
+	}
+	assert.Zero(t, hits.Load(), "injected failures must not reach the upstream")
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []string{"503", "503", "503", "503", "503"}, recorder.faults)
+	assert.Equal(t, []int{503, 503, 503, 503, 503}, recorder.statuses)
+}
+
+func TestChaosSkipsOtherHosts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	chaos, err := ParseChaos("1,500,api.example.com")
+	require.NoError(t, err)
+	client := newViaTestClient(t, Config{Chaos: chaos})
+
+	resp, err := client.Get(backend.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestChaosResetsConnection(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	chaos, err := ParseChaos("1,reset")
+	require.NoError(t, err)
+	recorder := &chaosRecorder{}
+	client := newViaTestClient(t, Config{Chaos: chaos, EventHandler: recorder})
+
+	_, err = client.Get(backend.URL)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, syscall.ECONNRESET, "the client must see a reset, not a normal close")
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []string{ChaosReset}, recorder.faults)
+	require.Len(t, recorder.errors, 1)
+	assert.ErrorIs(t, recorder.errors[0], errChaosReset)
+}
+
+func TestParseChaos(t *testing.T) {
+	chaos, err := ParseChaos("0.25")
+	require.NoError(t, err)
+	assert.Equal(t, defaultChaosStatuses, chaos.faults)
+	assert.Nil(t, chaos.hosts)
+
+	chaos, err = ParseChaos("0.5, 429|drop ,.example.com|10.0.0.0/8")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"429", ChaosReset}, chaos.faults)
+	assert.True(t, chaos.hosts.Match("api.example.com:443"))
+	assert.True(t, chaos.hosts.Match("10.1.2.3"))
+	assert.False(t, chaos.hosts.Match("example.org"))
+
+	// 抽样函数返回值不小于rate时不注入
+	chaos.random = func() float64 { return 0.5 }
+	assert.Empty(t, chaos.pick("api.example.com"))
+	chaos.random = func() float64 { return 0.49 }
+	assert.NotEmpty(t, chaos.pick("api.example.com"))
+
+	for _, spec := range []string{"", "0", "1.5", "abc", "0.1,200", "0.1,teapot", "0.1,500,10.0.0.0/99"} {
+		_, err := ParseChaos(spec)
+		assert.Error(t, err, spec)
+	}
+}
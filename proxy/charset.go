@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// DecodeText 把GBK、Shift_JIS、Latin-1等非UTF-8编码的文本消息体转换为UTF-8，只用于显示和记录，转发时仍使用原始字节
+// 字符集依次取自BOM、Content-Type的charset参数和HTML的<meta>声明；都没有时只对文本类型按windows-1252解码
+// 返回转换后的内容和字符集名称，内容已是UTF-8或无法判断时返回false
+func DecodeText(data []byte, contentType string) ([]byte, string, bool) {
+	if len(data) == 0 {
+		return nil, "", false
+	}
+
+	enc, name, certain := charset.DetermineEncoding(data, contentType)
+	if enc == nil || name == "utf-8" {
+		return nil, "", false
+	}
+	// 没有明确声明字符集时，有效的UTF-8（包括纯ASCII）原样显示，非文本类型不猜测字符集
+	if !certain && (utf8.Valid(data) || !isTextContentType(contentType)) {
+		return nil, "", false
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, "", false
+	}
+	return decoded, name, true
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestDecodeText(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(`<meta charset="gbk"><p>你好</p>`))
+	require.NoError(t, err)
+	sjis, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("こんにちは"))
+	require.NoError(t, err)
+	latin1, err := charmap.ISO8859_1.NewEncoder().Bytes([]byte("café"))
+	require.NoError(t, err)
+
+	// Content-Type中的charset参数
+	decoded, name, ok := DecodeText(sjis, "text/plain; charset=Shift_JIS")
+	require.True(t, ok)
+	assert.Equal(t, "こんにちは", string(decoded))
+	assert.Equal(t, "shift_jis", name)
+
+	// 没有charset参数时从HTML的<meta>声明探测
+	decoded, _, ok = DecodeText(gbk, "text/html")
+	require.True(t, ok)
+	assert.Equal(t, `<meta charset="gbk"><p>你好</p>`, string(decoded))
+
+	// 文本类型没有任何声明时按windows-1252解码
+	decoded, _, ok = DecodeText(latin1, "text/plain")
+	require.True(t, ok)
+	assert.Equal(t, "café", string(decoded))
+
+	// UTF-8文本和非文本类型保持不变
+	_, _, ok = DecodeText([]byte("你好"), "text/plain")
+	assert.False(t, ok)
+	_, _, ok = DecodeText([]byte("hello"), "text/html; charset=utf-8")
+	assert.False(t, ok)
+	_, _, ok = DecodeText([]byte{0x89, 'P', 'N', 'G', 0xff, 0xfe}, "image/png")
+	assert.False(t, ok)
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnLimitMode 决定活动连接数达到MaxConns后如何处理新连接
+type ConnLimitMode string
+
+const (
+	// ConnLimitQueue 暂停接受新连接，新连接在内核的监听队列中等待，直到有连接关闭
+	ConnLimitQueue ConnLimitMode = "queue"
+	// ConnLimitReject 接受新连接后立即回复503并关闭
+	ConnLimitReject ConnLimitMode = "reject"
+)
+
+// ParseConnLimitMode 解析连接数超限时的处理方式，空字符串等同于ConnLimitQueue
+func ParseConnLimitMode(value string) (ConnLimitMode, error) {
+	switch mode := ConnLimitMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ConnLimitQueue, nil
+	case ConnLimitQueue, ConnLimitReject:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported connection limit mode %q (want queue or reject)", value)
+	}
+}
+
+// overloadedBody 是连接数超限时回复给明文客户端的503响应体
+const overloadedBody = "proxy is at its maximum connection limit\n"
+
+var overloadedResponse = fmt.Sprintf("HTTP/1.1 503 Service Unavailable\r\n"+
+	"Content-Type: text/plain; charset=utf-8\r\n"+
+	"Content-Length: %d\r\n"+
+	"Connection: close\r\n\r\n%s", len(overloadedBody), overloadedBody)
+
+// connLimitListener 限制同时活动的连接数，连接关闭（包括被劫持的CONNECT连接）后释放名额
+type connLimitListener struct {
+	net.Listener
+	server *Server
+	slots  chan struct{}
+	reject bool
+	// plain 表示监听器上是明文HTTP，超限拒绝时可以回复503；TLS监听器上直接关闭连接
+	plain bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// limitListener 按MaxConns包装监听器，MaxConns<=0时原样返回
+func (s *Server) limitListener(l net.Listener, plain bool) net.Listener {
+	if s.MaxConns <= 0 {
+		return l
+	}
+	return &connLimitListener{
+		Listener: l,
+		server:   s,
+		slots:    make(chan struct{}, s.MaxConns),
+		reject:   s.ConnLimitMode == ConnLimitReject,
+		plain:    plain,
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept 在拿到名额后返回连接；拒绝模式下超限的连接回复503后关闭，继续等待下一个连接
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	for {
+		if !l.reject {
+			select {
+			case l.slots <- struct{}{}:
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if !l.reject {
+				<-l.slots
+			}
+			return nil, err
+		}
+
+		if l.reject {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				l.server.warnf("Rejecting connection from %s: %d active connections reached the -max-conns limit", conn.RemoteAddr(), l.server.MaxConns)
+				go l.rejectConn(conn)
+				continue
+			}
+		}
+		return &releaseConn{Conn: conn, release: func() { <-l.slots }}, nil
+	}
+}
+
+func (l *connLimitListener) rejectConn(conn net.Conn) {
+	defer conn.Close()
+	if !l.plain {
+		return
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, _ = conn.Write([]byte(overloadedResponse))
+}
+
+// Close 关闭监听器并唤醒等待名额的Accept
+func (l *connLimitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// releaseConn 在第一次Close时调用release，用于归还-max-conns的名额和减少活动连接数
+type releaseConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// NetConn 返回被包装的连接
+func (c *releaseConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *releaseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
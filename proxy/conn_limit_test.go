@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConnLimitMode(t *testing.T) {
+	for input, want := range map[string]ConnLimitMode{
+		"":        ConnLimitQueue,
+		"queue":   ConnLimitQueue,
+		" REJECT": ConnLimitReject,
+	} {
+		got, err := ParseConnLimitMode(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	_, err := ParseConnLimitMode("drop")
+	assert.Error(t, err)
+}
+
+// startLimitedProxy 启动限制为一个活动连接的代理，返回监听地址
+func startLimitedProxy(t *testing.T, mode ConnLimitMode) string {
+	t.Helper()
+	server, err := New(Config{LogWriter: io.Discard, MaxConns: 1, ConnLimitMode: mode})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = server.Serve(listener) }()
+	return listener.Addr().String()
+}
+
+// readStatus 在连接上发送一个请求并返回响应状态码
+func readStatus(t *testing.T, conn net.Conn) int {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write([]byte("GET http://127.0.0.1:1/ HTTP/1.1\r\nHost: 127.0.0.1:1\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestMaxConnsRejectsBeyondLimit(t *testing.T) {
+	addr := startLimitedProxy(t, ConnLimitReject)
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	// 第一个连接发出请求后才能确认它已被代理接受并占用名额
+	assert.Equal(t, http.StatusBadGateway, readStatus(t, first))
+
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+	_ = second.SetDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(second), nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, overloadedBody, string(body))
+
+	// 第一个连接关闭后名额被归还
+	require.NoError(t, first.Close())
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		return readStatus(t, conn) == http.StatusBadGateway
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestMaxConnsQueuesBeyondLimit(t *testing.T) {
+	addr := startLimitedProxy(t, ConnLimitQueue)
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, readStatus(t, first))
+
+	// 第二个连接在第一个关闭前得不到处理
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = second.Write([]byte("GET http://127.0.0.1:1/ HTTP/1.1\r\nHost: 127.0.0.1:1\r\n\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(second)
+	_ = second.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	_, err = reader.Peek(1)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout(), "queued connection must not be served while the limit is reached")
+
+	require.NoError(t, first.Close())
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
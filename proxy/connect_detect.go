@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// tlsPeekTimeout 是CONNECT建立后等待客户端发送第一个字节的时间
+// 超时说明是服务器先发送数据的协议（SMTP、MySQL等），按非TLS连接直接转发
+const tlsPeekTimeout = 2 * time.Second
+
+// recordTypeHandshake 是TLS握手记录的类型，ClientHello所在的记录总是以它开头
+const recordTypeHandshake = 0x16
+
+// peekClientHello 判断客户端在CONNECT之后发送的数据是否以TLS握手记录开头，不会消耗reader中的数据
+func peekClientHello(conn net.Conn, reader *bufio.Reader, timeout time.Duration) (bool, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+
+	first, err := reader.Peek(1)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return false, nil
+		}
+		return false, err
+	}
+	return first[0] == recordTypeHandshake, nil
+}
+
+// tunnelPlain 把非TLS的CONNECT连接原样转发到CONNECT目标，流量不会被解析和记录
+func (s *httpsConnectSession) tunnelPlain() {
+	s.server.infof("Tunneling non-TLS CONNECT to %s without interception", s.hostPort)
+
+	ctx, cancel := context.WithTimeout(s.connectReq.Context(), 30*time.Second)
+	upstream, err := s.server.dialTunnelTarget(ctx, s.hostPort)
+	cancel()
+	if err != nil {
+		s.server.errorf("Failed to tunnel CONNECT to %s: %v", s.hostPort, err)
+		return
+	}
+	defer upstream.Close()
+
+	relayTunnel(s.rawConn, s.rawConn, upstream)
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tunnelRecorder 额外记录隧道是否被拦截
+type tunnelRecorder struct {
+	recordingEventHandler
+	tunnelMu sync.Mutex
+	tunnels  map[string]bool
+}
+
+func (h *tunnelRecorder) OnTunnelEstablished(host string, isIntercepted bool) {
+	h.tunnelMu.Lock()
+	defer h.tunnelMu.Unlock()
+	if h.tunnels == nil {
+		h.tunnels = make(map[string]bool)
+	}
+	h.tunnels[host] = isIntercepted
+}
+
+func (h *tunnelRecorder) intercepted(host string) (bool, bool) {
+	h.tunnelMu.Lock()
+	defer h.tunnelMu.Unlock()
+	intercepted, ok := h.tunnels[host]
+	return intercepted, ok
+}
+
+func TestConnectToNonStandardTLSPortIsIntercepted(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secure "+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	recorder := &tunnelRecorder{}
+	client := newViaTestClient(t, Config{EventHandler: recorder})
+	resp, err := client.Get(backend.URL + "/status?x=1")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "secure /status", string(body))
+
+	hostPort := strings.TrimPrefix(backend.URL, "https://")
+	intercepted, ok := recorder.intercepted(hostPort)
+	require.True(t, ok)
+	assert.True(t, intercepted)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []string{"https://" + hostPort + "/status?x=1"}, recorder.requests)
+}
+
+func TestConnectWithPlainTCPIsTunneled(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	recorder := &tunnelRecorder{}
+	server, err := New(Config{EventHandler: recorder, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	target := echo.Addr().String()
+	_, err = io.WriteString(conn, "CONNECT "+target+" HTTP/1.1\r\nHost: "+target+"\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 非TLS的数据原样到达目标，并原样返回
+	for _, line := range []string{"PING 1\n", "PING 2\n"} {
+		_, err = io.WriteString(conn, line)
+		require.NoError(t, err)
+		got, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, line, got)
+	}
+
+	intercepted, ok := recorder.intercepted(target)
+	require.True(t, ok)
+	assert.False(t, intercepted)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Empty(t, recorder.requests)
+}
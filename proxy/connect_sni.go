@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// connectInfoKey 是请求context中保存MITM隧道信息的键
+type connectInfoKey struct{}
+
+// connectInfo 记录MITM隧道的CONNECT目标主机和客户端ClientHello中的SNI
+type connectInfo struct {
+	host string
+	sni  string
+}
+
+// withConnectInfo 把隧道的CONNECT主机和SNI附加到隧道内的请求上，供createRequestContext填充RequestContext
+func withConnectInfo(req *http.Request, connectHost, sni string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), connectInfoKey{}, connectInfo{host: connectHost, sni: sni}))
+}
+
+// connectInfoFrom 读取withConnectInfo附加的隧道信息
+func connectInfoFrom(req *http.Request) (connectInfo, bool) {
+	info, ok := req.Context().Value(connectInfoKey{}).(connectInfo)
+	return info, ok
+}
+
+// sniMismatch 判断客户端发送的SNI是否与CONNECT主机不一致
+// 客户端未发送SNI（例如按IP地址连接）时无从比较，不视为不一致
+func sniMismatch(connectHost, sni string) bool {
+	if sni == "" {
+		return false
+	}
+	host := strings.TrimSuffix(extractHostname(connectHost), ".")
+	return !strings.EqualFold(host, strings.TrimSuffix(sni, "."))
+}
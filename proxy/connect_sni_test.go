@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sniRecorder 记录事件处理器看到的CONNECT主机和SNI
+type sniRecorder struct {
+	NoOpEventHandler
+	mu     sync.Mutex
+	reqCtx RequestContext
+}
+
+func (h *sniRecorder) OnRequest(ctx *RequestContext) *http.Request {
+	h.mu.Lock()
+	h.reqCtx = *ctx
+	h.mu.Unlock()
+	return ctx.Request
+}
+
+func TestSNIMismatch(t *testing.T) {
+	assert.False(t, sniMismatch("example.com:443", "example.com"))
+	assert.False(t, sniMismatch("Example.COM:443", "example.com."))
+	assert.False(t, sniMismatch("10.0.0.1:443", ""), "clients connecting by IP send no SNI")
+	assert.True(t, sniMismatch("example.com:443", "front.example.net"))
+}
+
+func TestMITMRecordsSNIMismatch(t *testing.T) {
+	for _, h2 := range []bool{false, true} {
+		name := "http1"
+		if h2 {
+			name = "http2"
+		}
+		t.Run(name, func(t *testing.T) {
+			backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer backend.Close()
+
+			recorder := &sniRecorder{}
+			server, err := New(Config{EventHandler: recorder, LogWriter: io.Discard})
+			require.NoError(t, err)
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			go func() { _ = server.Serve(listener) }()
+
+			proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+			// CONNECT到后端地址，但在ClientHello中发送另一个域名作为SNI
+			client := &http.Client{Transport: &http.Transport{
+				Proxy:             http.ProxyURL(proxyURL),
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ServerName: "front.example.com"},
+				ForceAttemptHTTP2: h2,
+			}}
+
+			resp, err := client.Get(backend.URL + "/")
+			require.NoError(t, err)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if h2 {
+				assert.Equal(t, 2, resp.ProtoMajor)
+			}
+
+			backendURL, _ := url.Parse(backend.URL)
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			assert.Equal(t, backendURL.Host, recorder.reqCtx.ConnectHost)
+			assert.Equal(t, "front.example.com", recorder.reqCtx.ClientSNI)
+			assert.True(t, recorder.reqCtx.SNIMismatch)
+		})
+	}
+}
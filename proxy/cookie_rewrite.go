@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// rewriteSetCookies 在客户端看到的主机或协议与上游不一致时调整Set-Cookie的Domain/Secure属性
+// 只修改确实会被客户端拒绝的Cookie，其余Set-Cookie保持原样；每个Set-Cookie单独处理，不会被合并
+func (s *Server) rewriteSetCookies(resp *http.Response, reqCtx *RequestContext) {
+	if !s.RewriteCookies || resp == nil || reqCtx == nil || reqCtx.Request == nil {
+		return
+	}
+
+	values := resp.Header.Values("Set-Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	clientHost, clientSecure := s.clientOrigin(reqCtx)
+	rewritten := make([]string, 0, len(values))
+	changed := false
+	for _, value := range values {
+		newValue := rewriteSetCookie(value, clientHost, clientSecure)
+		if newValue != value {
+			changed = true
+			s.debugf("[Cookie] Rewrote Set-Cookie for %s: %q -> %q", clientHost, value, newValue)
+		}
+		rewritten = append(rewritten, newValue)
+	}
+
+	if changed {
+		resp.Header["Set-Cookie"] = rewritten
+	}
+}
+
+// clientOrigin 返回客户端实际访问的主机名以及客户端连接是否为HTTPS
+func (s *Server) clientOrigin(reqCtx *RequestContext) (string, bool) {
+	host := reqCtx.Request.Host
+	secure := reqCtx.IsHTTPS
+	if s.ReverseTarget != nil {
+		// 反向代理模式下客户端总是通过HTTPS访问，原始Host保存在X-Forwarded-Host中
+		if forwarded := reqCtx.Request.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host = forwarded
+		}
+		secure = true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(host), secure
+}
+
+// rewriteSetCookie 调整单个Set-Cookie，无需修改时原样返回
+func rewriteSetCookie(value, clientHost string, clientSecure bool) string {
+	cookie, err := http.ParseSetCookie(value)
+	if err != nil {
+		return value
+	}
+
+	changed := false
+
+	// Domain与客户端主机不匹配时去掉Domain，使其成为当前主机的host-only Cookie
+	if cookie.Domain != "" && clientHost != "" && !domainMatches(clientHost, cookie.Domain) {
+		cookie.Domain = ""
+		changed = true
+	}
+
+	// 客户端使用明文HTTP时Secure Cookie会被丢弃；SameSite=None必须同时带Secure，降级为Lax
+	if cookie.Secure && !clientSecure {
+		cookie.Secure = false
+		if cookie.SameSite == http.SameSiteNoneMode {
+			cookie.SameSite = http.SameSiteLaxMode
+		}
+		changed = true
+	}
+
+	if !changed {
+		return value
+	}
+	if rewritten := cookie.String(); rewritten != "" {
+		return rewritten
+	}
+	return value
+}
+
+// domainMatches 按RFC 6265判断host是否属于domain
+func domainMatches(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMITMForwardsMultipleSetCookies(t *testing.T) {
+	cookies := []string{
+		"session=abc123; Path=/; Secure; HttpOnly; SameSite=None",
+		"theme=dark; Path=/; Max-Age=3600",
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, cookie := range cookies {
+			w.Header().Add("Set-Cookie", cookie)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	certMgr, err := certs.NewManager()
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := NewServerWithConfig(ServerConfig{CertManager: certMgr})
+	httpServer := server.buildHTTPServer()
+	go func() { _ = httpServer.Serve(listener) }()
+	defer httpServer.Close()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+
+	testCases := []struct {
+		name       string
+		forceHTTP2 bool
+		alpn       string
+	}{
+		{name: "HTTP/1.1 tunnel", forceHTTP2: false, alpn: ""},
+		{name: "HTTP/2 MITM", forceHTTP2: true, alpn: "h2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transport := &http.Transport{
+				Proxy:             http.ProxyURL(proxyURL),
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				ForceAttemptHTTP2: tc.forceHTTP2,
+			}
+			if !tc.forceHTTP2 {
+				transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+			}
+			client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+			resp, err := client.Get(backend.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			_, _ = io.ReadAll(resp.Body)
+
+			require.NotNil(t, resp.TLS)
+			assert.Equal(t, tc.alpn, resp.TLS.NegotiatedProtocol)
+			assert.Equal(t, cookies, resp.Header.Values("Set-Cookie"))
+			assert.Len(t, resp.Cookies(), 2)
+		})
+	}
+}
+
+func TestRewriteSetCookie(t *testing.T) {
+	testCases := []struct {
+		name         string
+		value        string
+		clientHost   string
+		clientSecure bool
+		expected     string
+	}{
+		{
+			name:         "matching domain over https is untouched",
+			value:        "sid=1; Domain=.example.com; Secure; SameSite=None",
+			clientHost:   "www.example.com",
+			clientSecure: true,
+			expected:     "sid=1; Domain=.example.com; Secure; SameSite=None",
+		},
+		{
+			name:         "mismatched domain is dropped",
+			value:        "sid=1; Path=/; Domain=backend.internal; Secure",
+			clientHost:   "public.example.com",
+			clientSecure: true,
+			expected:     "sid=1; Path=/; Secure",
+		},
+		{
+			name:         "secure cookie to plain http client",
+			value:        "sid=1; Path=/; Secure; SameSite=None",
+			clientHost:   "example.com",
+			clientSecure: false,
+			expected:     "sid=1; Path=/; SameSite=Lax",
+		},
+		{
+			name:         "unparsable value is kept",
+			value:        "not a cookie",
+			clientHost:   "example.com",
+			clientSecure: false,
+			expected:     "not a cookie",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, rewriteSetCookie(tc.value, tc.clientHost, tc.clientSecure))
+		})
+	}
+}
+
+func TestRewriteSetCookiesDisabledByDefault(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://public.example.com/", nil)
+	reqCtx := &RequestContext{Request: req}
+	newResp := func() *http.Response {
+		resp := &http.Response{Header: make(http.Header)}
+		resp.Header.Add("Set-Cookie", "a=1; Domain=backend.internal; Secure")
+		resp.Header.Add("Set-Cookie", "b=2")
+		return resp
+	}
+
+	resp := newResp()
+	(&Server{}).rewriteSetCookies(resp, reqCtx)
+	assert.Equal(t, []string{"a=1; Domain=backend.internal; Secure", "b=2"}, resp.Header.Values("Set-Cookie"))
+
+	resp = newResp()
+	(&Server{RewriteCookies: true}).rewriteSetCookies(resp, reqCtx)
+	assert.Equal(t, []string{"a=1", "b=2"}, resp.Header.Values("Set-Cookie"))
+}
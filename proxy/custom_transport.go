@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// customTransport 返回Transports中与targetHost（可带端口）最匹配的RoundTripper，没有匹配时返回nil
+// 优先级从高到低：host:port 完全匹配、host 完全匹配、*.suffix 通配（后缀越长越优先）、"*"
+func (s *Server) customTransport(targetHost string, secure bool) http.RoundTripper {
+	if len(s.Transports) == 0 {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(targetHost)
+	if err != nil {
+		host = targetHost
+		port = "80"
+		if secure {
+			port = "443"
+		}
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	hostPort := net.JoinHostPort(host, port)
+
+	var best http.RoundTripper
+	bestRank := -1
+	for pattern, transport := range s.Transports {
+		if transport == nil {
+			continue
+		}
+		if rank := transportPatternRank(strings.ToLower(strings.TrimSpace(pattern)), host, hostPort); rank > bestRank {
+			best, bestRank = transport, rank
+		}
+	}
+	return best
+}
+
+// transportPatternRank 返回pattern匹配目标时的优先级，不匹配时返回-1
+// 通配后缀的优先级为其长度，完全匹配的优先级高于任何通配
+func transportPatternRank(pattern, host, hostPort string) int {
+	const exactRank = 1 << 20
+	switch {
+	case pattern == "*":
+		return 0
+	case strings.HasPrefix(pattern, "*."):
+		if strings.HasSuffix(host, pattern[1:]) {
+			return len(pattern)
+		}
+	case pattern == hostPort:
+		return exactRank + 1
+	case pattern == host:
+		return exactRank
+	}
+	return -1
+}
+
+// roundTripperFor 返回转发到targetHost使用的RoundTripper：Transports中有匹配项时使用自定义的，否则使用缓存的默认Transport
+func (s *Server) roundTripperFor(targetHost string, secure, potentialSSE bool) http.RoundTripper {
+	if custom := s.customTransport(targetHost, secure); custom != nil {
+		s.debugf("[Proxy] Using custom transport for %s", targetHost)
+		return custom
+	}
+	return s.transportFor(targetHost, secure, potentialSSE)
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRoundTripper 不访问网络，记录收到的请求并返回固定的响应
+type stubRoundTripper struct {
+	name        string
+	contentType string
+	mu          sync.Mutex
+	urls        []string
+}
+
+func (s *stubRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.urls = append(s.urls, req.URL.String())
+	s.mu.Unlock()
+	body := "from " + s.name
+	contentType := s.contentType
+	if contentType == "" {
+		contentType = "text/plain"
+	} else {
+		body = "data: " + body + "\n\n"
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+func (s *stubRoundTripper) requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.urls...)
+}
+
+func TestCustomTransportPerHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "from backend")
+	}))
+	defer backend.Close()
+
+	exact := &stubRoundTripper{name: "exact", contentType: "text/event-stream"}
+	wildcard := &stubRoundTripper{name: "wildcard"}
+	recorder := &sseEventRecorder{}
+	client := newViaTestClient(t, Config{
+		EventHandler: recorder,
+		Transports: map[string]http.RoundTripper{
+			"api.stub.test": exact,
+			"*.stub.test":   wildcard,
+		},
+	})
+
+	get := func(target string) string {
+		resp, err := client.Get(target)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// 自定义RoundTripper的响应同样经过SSE识别和事件处理
+	assert.Equal(t, "data: from exact\n\n", get("http://api.stub.test/events"))
+	assert.Equal(t, []string{"http://api.stub.test/events"}, exact.requested())
+	require.Eventually(t, func() bool {
+		events := recorder.recorded()
+		return len(events) > 0 && events[0] == "data: from exact"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// MITM的请求同样使用匹配的RoundTripper
+	assert.Equal(t, "from wildcard", get("https://www.stub.test/index.html"))
+	assert.Equal(t, []string{"https://www.stub.test/index.html"}, wildcard.requested())
+
+	// 没有匹配的主机使用默认Transport
+	assert.Equal(t, "from backend", get(backend.URL))
+	assert.Len(t, exact.requested(), 1)
+}
+
+func TestCustomTransportPrecedence(t *testing.T) {
+	stubs := map[string]http.RoundTripper{}
+	for _, pattern := range []string{"*", "*.example.com", "*.api.example.com", "api.example.com", "api.example.com:8443"} {
+		stubs[pattern] = &stubRoundTripper{name: pattern}
+	}
+	server := &Server{Transports: stubs}
+
+	cases := []struct {
+		host   string
+		secure bool
+		want   string
+	}{
+		{"api.example.com:8443", true, "api.example.com:8443"},
+		{"api.example.com:443", true, "api.example.com"},
+		{"API.example.com", false, "api.example.com"},
+		{"v2.api.example.com", false, "*.api.example.com"},
+		{"www.example.com:443", true, "*.example.com"},
+		{"example.com", false, "*"},
+		{"other.org", false, "*"},
+	}
+	for _, tc := range cases {
+		got := server.customTransport(tc.host, tc.secure)
+		require.NotNil(t, got, tc.host)
+		assert.Equal(t, tc.want, got.(*stubRoundTripper).name, tc.host)
+	}
+
+	server.Transports = map[string]http.RoundTripper{"api.example.com:8443": stubs["api.example.com:8443"]}
+	assert.Nil(t, server.customTransport("api.example.com", true), "the default port does not match a pattern with another port")
+}
+
+func TestTransportForEvictsIdleTransports(t *testing.T) {
+	server := &Server{}
+	idle := server.transportFor("idle.example.com:443", true, false)
+	assert.Same(t, idle, server.transportFor("idle.example.com:443", true, false))
+
+	// 清理时只移除超过transportIdleTTL未使用的Transport
+	server.sweepTransports(time.Now().Add(transportIdleTTL / 2))
+	assert.Same(t, idle, server.transportFor("idle.example.com:443", true, false))
+
+	server.sweepTransports(time.Now().Add(transportIdleTTL + time.Minute))
+	_, ok := server.transports.Load(transportKey{host: "idle.example.com:443", secure: true})
+	assert.False(t, ok)
+	assert.NotSame(t, idle, server.transportFor("idle.example.com:443", true, false))
+}
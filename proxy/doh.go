@@ -0,0 +1,274 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// dohTimeout 是单次DoH查询的超时时间
+	dohTimeout = 5 * time.Second
+	// maxDoHCacheTTL 限制缓存时间，避免TTL很长的记录在地址变更后长期生效
+	maxDoHCacheTTL = time.Hour
+	// maxDoHCacheEntries 超过后清理已过期的缓存，仍然超过则清空
+	maxDoHCacheEntries = 10000
+	// dohMessageType 是RFC 8484规定的DNS报文媒体类型
+	dohMessageType = "application/dns-message"
+)
+
+// DoHResolver 通过DNS-over-HTTPS（RFC 8484）解析上游主机名，结果按应答中的TTL缓存
+type DoHResolver struct {
+	endpoint string
+	fallback bool
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]dohCacheEntry
+}
+
+type dohCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// NewDoHResolver 创建使用endpoint（如 https://dns.google/dns-query）的解析器
+// fallback为true时DoH查询失败会改用系统DNS，否则连接直接失败
+func NewDoHResolver(endpoint string, fallback bool) (*DoHResolver, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DoH endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid DoH endpoint %q: must be an https:// URL", endpoint)
+	}
+
+	// DoH服务器本身通过系统DNS解析，并且不使用环境变量中的代理
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return &DoHResolver{
+		endpoint: u.String(),
+		fallback: fallback,
+		client:   &http.Client{Transport: transport, Timeout: dohTimeout},
+		cache:    make(map[string]dohCacheEntry),
+	}, nil
+}
+
+// LookupIP 返回host的IPv4和IPv6地址，IPv4在前
+// 失败时返回*net.DNSError，与系统DNS一样设置IsNotFound和IsTimeout，ClassifyError据此分类
+func (r *DoHResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.ips, nil
+	}
+
+	var (
+		ips    []net.IP
+		ttl    = maxDoHCacheTTL
+		errs   []error
+		answer bool
+	)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, recordTTL, err := r.query(ctx, host, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		answer = true
+		if len(found) > 0 {
+			ips = append(ips, found...)
+			if recordTTL < ttl {
+				ttl = recordTTL
+			}
+		}
+	}
+	if !answer {
+		return nil, r.lookupError(host, errors.Join(errs...))
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: r.endpoint, IsNotFound: true}
+	}
+
+	r.mu.Lock()
+	if len(r.cache) >= maxDoHCacheEntries {
+		for key, entry := range r.cache {
+			if !now.Before(entry.expires) {
+				delete(r.cache, key)
+			}
+		}
+		if len(r.cache) >= maxDoHCacheEntries {
+			clear(r.cache)
+		}
+	}
+	r.cache[host] = dohCacheEntry{ips: ips, expires: now.Add(ttl)}
+	r.mu.Unlock()
+	return ips, nil
+}
+
+// query 向DoH服务器发送一个查询，返回应答中的地址和最小的TTL
+func (r *DoHResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(dnsFQDN(host))
+	if err != nil {
+		return nil, 0, err
+	}
+	// RFC 8484建议ID使用0，便于HTTP缓存
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", dohMessageType)
+	req.Header.Set("Accept", dohMessageType)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, &dohServerError{
+			msg:       "DoH server returned " + resp.Status,
+			temporary: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, &dohServerError{
+			msg:       "DoH server returned " + reply.RCode.String(),
+			notFound:  reply.RCode == dnsmessage.RCodeNameError,
+			temporary: reply.RCode == dnsmessage.RCodeServerFailure,
+		}
+	}
+
+	var (
+		ips []net.IP
+		ttl = maxDoHCacheTTL
+	)
+	for _, answer := range reply.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		default:
+			continue
+		}
+		if recordTTL := time.Duration(answer.Header.TTL) * time.Second; recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+	return ips, ttl, nil
+}
+
+// dohServerError 是DoH服务器返回的失败：HTTP状态码不是200，或者DNS应答的RCODE不是成功
+type dohServerError struct {
+	msg       string
+	notFound  bool // NXDOMAIN
+	temporary bool // 5xx、429或SERVFAIL
+}
+
+func (e *dohServerError) Error() string {
+	return e.msg
+}
+
+// lookupError 把A和AAAA查询的错误合并为一个*net.DNSError，原始错误仍可通过errors.Is/As取得
+func (r *DoHResolver) lookupError(host string, err error) *net.DNSError {
+	dnsErr := &net.DNSError{Err: err.Error(), Name: host, Server: r.endpoint, UnwrapErr: err}
+	var serverErr *dohServerError
+	if errors.As(err, &serverErr) {
+		dnsErr.IsNotFound = serverErr.notFound
+		dnsErr.IsTemporary = serverErr.temporary
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		dnsErr.IsTimeout = true
+	}
+	return dnsErr
+}
+
+func dnsFQDN(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host
+	}
+	return host + "."
+}
+
+// contextDialer 是net.Dialer和dohDialer共同实现的拨号接口
+type contextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// dohDialer 先通过DoHResolver解析主机名，再依次连接解析出的地址；IP地址直接连接
+type dohDialer struct {
+	resolver *DoHResolver
+	base     *net.Dialer
+	logf     func(format string, args ...interface{})
+}
+
+func (d *dohDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.base.DialContext(ctx, network, addr)
+	}
+
+	ips, err := d.resolver.LookupIP(ctx, host)
+	if err != nil {
+		if d.resolver.fallback {
+			d.logf("[DoH] %v; falling back to system DNS", err)
+			return d.base.DialContext(ctx, network, addr)
+		}
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := d.base.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// upstreamDialer 返回连接上游（目标服务器或第一跳上层代理）使用的拨号器，配置了DoHResolver时经由DoH解析主机名
+func (s *Server) upstreamDialer() contextDialer {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if s.DoHResolver == nil {
+		return dialer
+	}
+	return &dohDialer{resolver: s.DoHResolver, base: dialer, logf: s.warnf}
+}
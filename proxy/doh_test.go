@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newStubDoHServer 启动一个DoH服务器，对每个A查询都返回ip，AAAA查询返回空应答
+func newStubDoHServer(t *testing.T, ip net.IP, queries *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "application/dns-message", r.Header.Get("Content-Type"))
+
+		var query dnsmessage.Message
+		require.NoError(t, query.Unpack(body))
+		queries.Add(1)
+
+		reply := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+		question := query.Questions[0]
+		if question.Type == dnsmessage.TypeA {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip.To4())
+			reply.Answers = append(reply.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &a,
+			})
+		}
+		packed, err := reply.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestDoHResolver(t *testing.T, server *httptest.Server, fallback bool) *DoHResolver {
+	t.Helper()
+	resolver, err := NewDoHResolver(server.URL+"/dns-query", fallback)
+	require.NoError(t, err)
+	resolver.client = server.Client()
+	return resolver
+}
+
+func TestDoHResolverDialsResolvedAddress(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "resolved via DoH")
+	}))
+	defer backend.Close()
+	_, port, err := net.SplitHostPort(backend.Listener.Addr().String())
+	require.NoError(t, err)
+
+	var queries atomic.Int32
+	resolver := newTestDoHResolver(t, newStubDoHServer(t, net.ParseIP("127.0.0.1"), &queries), false)
+
+	// 该主机名在系统DNS中不存在，只能通过DoH解析到本地的后端
+	client := newViaTestClient(t, Config{DoHResolver: resolver})
+	resp, err := client.Get("http://backend.proxycraft.invalid:" + port + "/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "resolved via DoH", string(body))
+
+	// 结果按TTL缓存，再次解析不会查询DoH服务器
+	sent := queries.Load()
+	ips, err := resolver.LookupIP(context.Background(), "backend.proxycraft.invalid")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ips[0].String())
+	assert.Equal(t, sent, queries.Load())
+}
+
+func TestDoHResolverFallback(t *testing.T) {
+	failing := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	_, port, err := net.SplitHostPort(backend.Addr().String())
+	require.NoError(t, err)
+
+	strict := &dohDialer{resolver: newTestDoHResolver(t, failing, false), base: &net.Dialer{}, logf: t.Logf}
+	_, err = strict.DialContext(context.Background(), "tcp", "localhost:"+port)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsTemporary)
+	assert.Equal(t, ErrorKindDNS, ClassifyError(err))
+
+	// 回退到系统DNS后仍能连接
+	lenient := &dohDialer{resolver: newTestDoHResolver(t, failing, true), base: &net.Dialer{}, logf: t.Logf}
+	conn, err := lenient.DialContext(context.Background(), "tcp", "localhost:"+port)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestDoHResolverErrors(t *testing.T) {
+	nxdomain := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var query dnsmessage.Message
+		require.NoError(t, query.Unpack(body))
+		reply := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+			Questions: query.Questions,
+		}
+		packed, err := reply.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer nxdomain.Close()
+
+	_, err := newTestDoHResolver(t, nxdomain, false).LookupIP(context.Background(), "missing.example")
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsNotFound)
+	assert.Equal(t, "missing.example", dnsErr.Name)
+	assert.Equal(t, ErrorKindDNS, ClassifyError(err))
+
+	release := make(chan struct{})
+	slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	resolver := newTestDoHResolver(t, slow, false)
+	resolver.client.Timeout = 50 * time.Millisecond
+	_, err = resolver.LookupIP(context.Background(), "slow.example")
+	require.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsTimeout)
+	assert.Equal(t, ErrorKindTimeout, ClassifyError(err))
+}
+
+func TestNewDoHResolverRequiresHTTPS(t *testing.T) {
+	_, err := NewDoHResolver("http://dns.google/dns-query", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "https://")
+}
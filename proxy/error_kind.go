@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrorKind 是转发错误的分类，用于按类型筛选和统计失败的请求
+type ErrorKind string
+
+const (
+	ErrorKindDNS           ErrorKind = "dns"            // 域名解析失败
+	ErrorKindConnect       ErrorKind = "connect"        // 无法建立TCP连接（拒绝连接、网络不可达等）
+	ErrorKindTLS           ErrorKind = "tls"            // TLS握手或证书校验失败
+	ErrorKindTimeout       ErrorKind = "timeout"        // 连接、读写或整体超时
+	ErrorKindUpstreamProxy ErrorKind = "upstream-proxy" // 上层代理不可达或拒绝了CONNECT
+	ErrorKindCanceled      ErrorKind = "canceled"       // 客户端断开或请求被取消
+	ErrorKindOther         ErrorKind = "other"          // 其他错误
+)
+
+// upstreamProxyError 标记经过上层代理链时发生的错误，供ClassifyError识别
+type upstreamProxyError struct {
+	err error
+}
+
+func (e *upstreamProxyError) Error() string { return e.err.Error() }
+
+func (e *upstreamProxyError) Unwrap() error { return e.err }
+
+// ClassifyError 根据错误链判断错误类型，err为nil时返回空字符串
+// 上层代理的错误优先归为upstream-proxy（即使底层是超时或DNS失败），便于区分问题出在代理还是目标
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorKindCanceled
+	}
+
+	var proxyErr *upstreamProxyError
+	if errors.As(err, &proxyErr) {
+		return ErrorKindUpstreamProxy
+	}
+	var opErr *net.OpError
+	// http.Transport 连接代理（包括CONNECT）失败时返回Op为proxyconnect的错误
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return ErrorKindUpstreamProxy
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ErrorKindTimeout
+		}
+		return ErrorKindDNS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+
+	if isTLSError(err) {
+		return ErrorKindTLS
+	}
+
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrorKindConnect
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return ErrorKindConnect
+	}
+
+	return ErrorKindOther
+}
+
+// isTLSError 判断错误是否来自TLS握手或证书校验
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		unknownAuth  x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		systemRoots  x509.SystemRootsError
+		echRejection *tls.ECHRejectionError
+		pinErr       *CertPinError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownAuth) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &systemRoots) || errors.As(err, &echRejection) ||
+		errors.As(err, &pinErr) {
+		return true
+	}
+	// crypto/tls 的多数握手错误（如协议版本不匹配）只是带 "tls: " 前缀的普通错误；
+	// 目标端口不是TLS服务时http.Transport返回的也是普通错误
+	msg := err.Error()
+	return strings.Contains(msg, "tls: ") || strings.Contains(msg, "server gave HTTP response to HTTPS client")
+}
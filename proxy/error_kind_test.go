@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"nil", nil, ""},
+		{"canceled", &url.Error{Op: "Get", URL: "http://a.test/", Err: context.Canceled}, ErrorKindCanceled},
+		{"dns", &url.Error{Op: "Get", URL: "http://a.test/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "a.test", IsNotFound: true}}}, ErrorKindDNS},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "a.test", IsTimeout: true}, ErrorKindTimeout},
+		{"deadline", fmt.Errorf("send proxy request: %w", context.DeadlineExceeded), ErrorKindTimeout},
+		{"read timeout", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, ErrorKindTimeout},
+		{"dial", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: network is unreachable")}, ErrorKindConnect},
+		{"proxyconnect", &net.OpError{Op: "proxyconnect", Net: "tcp", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, ErrorKindUpstreamProxy},
+		{"tls message", errors.New("remote error: tls: handshake failure"), ErrorKindTLS},
+		{"other", errors.New("boom"), ErrorKindOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ClassifyError(tt.err))
+		})
+	}
+}
+
+func TestClassifyErrorFromRealFailures(t *testing.T) {
+	client := func(transport *http.Transport) *http.Client {
+		return &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	}
+
+	t.Run("connection refused", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		_, err = client(&http.Transport{}).Get("http://" + addr + "/")
+		require.Error(t, err)
+		assert.Equal(t, ErrorKindConnect, ClassifyError(err))
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer target.Close()
+
+		_, err := client(&http.Transport{}).Get(target.URL)
+		require.Error(t, err)
+		assert.Equal(t, ErrorKindTLS, ClassifyError(err))
+	})
+
+	t.Run("plain http on tls port", func(t *testing.T) {
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer target.Close()
+
+		targetURL, _ := url.Parse(target.URL)
+		_, err := client(&http.Transport{}).Get("https://" + targetURL.Host + "/")
+		require.Error(t, err)
+		assert.Equal(t, ErrorKindTLS, ClassifyError(err))
+	})
+
+	t.Run("upstream proxy refuses connect", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer upstream.Close()
+		upstreamURL, _ := url.Parse(upstream.URL)
+
+		server := &Server{UpstreamProxy: upstreamURL}
+		_, err := client(server.newTransport("a.test:443", true)).Get("https://a.test/")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "403")
+		assert.Equal(t, ErrorKindUpstreamProxy, ClassifyError(err))
+	})
+
+	t.Run("upstream proxy chain auth failure", func(t *testing.T) {
+		var hits int32
+		proxyA := newConnectProxy(t, "alice", "secret-a", &hits)
+		proxyB := newConnectProxy(t, "", "", &hits)
+		urlA, _ := url.Parse(proxyA.URL)
+		urlB, _ := url.Parse(proxyB.URL)
+
+		server := &Server{UpstreamProxyChain: []*url.URL{urlA, urlB}}
+		_, err := client(server.newTransport("a.test:443", true)).Get("https://a.test/")
+		require.Error(t, err)
+		assert.Equal(t, ErrorKindUpstreamProxy, ClassifyError(err))
+	})
+}
@@ -21,10 +21,39 @@ type EventHandler interface {
 	// OnTunnelEstablished 在HTTPS隧道建立时调用
 	OnTunnelEstablished(host string, isIntercepted bool)
 
-	// OnSSE 在处理服务器发送事件流时调用
-	OnSSE(event string, ctx *ResponseContext)
+	// OnSSE 在转发服务器发送事件前调用，event不含结尾的空行
+	// 返回空字符串表示原样转发，返回DropSSEEvent表示丢弃该事件，其他返回值会替换原事件转发给客户端
+	// 流结束时会以"__SSE_COMPLETED__"调用一次，此时返回值被忽略
+	OnSSE(event string, ctx *ResponseContext) string
 }
 
+// WebSocketEventHandler 是EventHandler可选实现的接口，用于观察升级后的WebSocket连接上转发的帧
+// 帧在转发之后才通知，处理器不能修改帧内容；同一连接两个方向的帧按读完的顺序依次通知
+type WebSocketEventHandler interface {
+	OnWebSocketMessage(msg *WebSocketMessage, ctx *ResponseContext)
+}
+
+// BodyConsumer 是EventHandler可选实现的接口，声明处理器是否读取请求体和响应体
+// 未实现该接口的处理器（NoOpEventHandler除外）视为需要消息体，见Server.PassthroughBodies
+type BodyConsumer interface {
+	ConsumesBodies() bool
+}
+
+// consumesBodies 返回handler是否需要读取消息体
+func consumesBodies(handler EventHandler) bool {
+	switch h := handler.(type) {
+	case nil, *NoOpEventHandler:
+		return false
+	case BodyConsumer:
+		return h.ConsumesBodies()
+	default:
+		return true
+	}
+}
+
+// DropSSEEvent 是OnSSE的特殊返回值，表示不把该事件转发给客户端
+const DropSSEEvent = "\x00__SSE_DROP__\x00"
+
 // RequestContext 包含请求的上下文信息
 type RequestContext struct {
 	// 原始请求
@@ -42,13 +71,67 @@ type RequestContext struct {
 	// TargetURL 表示请求的目标URL
 	TargetURL string
 
+	// SampledOut 表示请求未被Server.Sampler抽中，处理器应暂缓保存，直到响应确认需要记录
+	SampledOut bool
+
+	// ChaosFault 是Server.Chaos对该请求注入的故障：状态码或ChaosReset，为空表示正常转发
+	// 在OnRequest之前决定，处理器可以据此标记记录
+	ChaosFault string
+
+	// RateLimit 是Server.RateLimiter对该请求的处理：排队等待的时间（如 "250ms"）或RateLimitRejected，为空表示未受限
+	// 与ChaosFault一样在OnRequest之前决定
+	RateLimit     string
+	rateLimitWait time.Duration
+
+	// Cache 是Server.Cache对该请求的处理：CacheHit、CacheRevalidate或CacheMiss，为空表示未使用缓存
+	// 与ChaosFault一样在OnRequest之前决定；重新验证的最终结果见响应的CacheHeader
+	Cache       string
+	cacheLookup *cacheLookup
+
+	// recordDecided 表示已经根据响应决定过未抽中的请求是否保存，结果在record中
+	recordDecided bool
+	record        bool
+
+	// SentTime 是请求完整写入上游连接的时间，收到响应或出错时填充；StartTime到SentTime之间包含事件处理、建连和TLS握手
+	SentTime time.Time
+
+	// UpstreamConnID 标识转发本请求使用的上游连接（本地地址->远端地址），UpstreamConnReused 表示该连接是否复用自连接池
+	// 与SentTime同时填充，请求未拿到连接时为空
+	UpstreamConnID     string
+	UpstreamConnReused bool
+
+	// InformationalResponses 是上游在最终响应之前发送的1xx响应（例如103 Early Hints），与SentTime同时填充
+	InformationalResponses []InformationalResponse
+
+	// ConnectHost 是MITM隧道CONNECT请求的目标主机，ClientSNI 是客户端在TLS ClientHello中发送的SNI
+	// SNIMismatch 表示两者不一致（例如域前置或客户端配置错误）；非MITM请求时均为空
+	ConnectHost string
+	ClientSNI   string
+	SNIMismatch bool
+
 	// 用于保存上下文的自定义数据
 	UserData map[string]interface{}
+
+	timing *requestTiming
+
+	// continueBody 非nil时请求带有Expect: 100-continue，请求体要等转发时才读取，见deferContinueBody
+	continueBody *continueBody
+
+	// SkipBody 表示开启了Server.NoBodies，GetRequestBody不读取请求体，处理器只应记录元数据
+	SkipBody bool
+
+	// recordedBody 是转发前缓存的请求体副本，见keepRequestBody
+	recordedBody []byte
 }
 
 // GetRequestBody 获取请求体的内容，同时保持请求体可以再次被读取
+// 带Content-Encoding（gzip、deflate、br等）的请求体返回解压后的内容，Request.Body仍保留原始字节用于转发
 func (ctx *RequestContext) GetRequestBody() ([]byte, error) {
-	if ctx.Request == nil || ctx.Request.Body == nil {
+	if ctx.Request == nil || ctx.Request.Body == nil || ctx.SkipBody {
+		return nil, nil
+	}
+	if ctx.continueBody != nil {
+		// Expect: 100-continue的请求体在上游同意后才读取，转发前不能提前缓存
 		return nil, nil
 	}
 
@@ -60,6 +143,9 @@ func (ctx *RequestContext) GetRequestBody() ([]byte, error) {
 	// 重置请求体，使其可以再次被读取
 	ctx.Request.Body = io.NopCloser(bytes.NewBuffer(body))
 
+	if decoded, ok := decodeRequestBody(ctx.Request.Header, body); ok {
+		return decoded, nil
+	}
 	return body, nil
 }
 
@@ -74,13 +160,33 @@ type ResponseContext struct {
 	// 响应耗时
 	TimeTaken time.Duration
 
+	// FirstByteTime 是收到上游响应第一个字节的时间
+	FirstByteTime time.Time
+
 	// IsSSE 表示这是否是一个SSE响应
 	IsSSE bool
 
+	// IsWebSocket 表示这是把连接升级为WebSocket的101响应，之后的帧通过WebSocketEventHandler通知
+	IsWebSocket bool
+
+	// SkipBody 表示Server.ShouldCaptureBody决定不保存响应体或开启了Server.NoBodies，处理器只应记录元数据
+	SkipBody bool
+
+	// SkipRecord 表示请求未被抽中且响应不是5xx，处理器不应保存该事务
+	SkipRecord bool
+
 	// 用于保存上下文的自定义数据
 	UserData map[string]interface{}
 }
 
+// ShouldCaptureBodyFunc 决定是否缓存并保存某个响应的响应体
+type ShouldCaptureBodyFunc func(reqCtx *RequestContext, resp *http.Response) bool
+
+// CaptureAllBodies 是默认的响应体捕获策略，总是保存响应体
+func CaptureAllBodies(reqCtx *RequestContext, resp *http.Response) bool {
+	return true
+}
+
 // GetResponseBody 获取响应体的内容，同时保持响应体可以再次被读取
 func (ctx *ResponseContext) GetResponseBody() ([]byte, error) {
 	if ctx.Response == nil || ctx.Response.Body == nil {
@@ -118,7 +224,9 @@ func (h *NoOpEventHandler) OnError(err error, reqCtx *RequestContext) {}
 func (h *NoOpEventHandler) OnTunnelEstablished(host string, isIntercepted bool) {}
 
 // OnSSE 实现 EventHandler 接口
-func (h *NoOpEventHandler) OnSSE(event string, ctx *ResponseContext) {}
+func (h *NoOpEventHandler) OnSSE(event string, ctx *ResponseContext) string {
+	return ""
+}
 
 // MultiEventHandler 允许注册多个事件处理器
 type MultiEventHandler struct {
@@ -132,6 +240,24 @@ func NewMultiEventHandler(handlers ...EventHandler) *MultiEventHandler {
 	}
 }
 
+// combineEventHandlers 把多个事件处理器组合为一个，忽略nil；只剩一个时直接返回它，没有时返回nil
+func combineEventHandlers(handlers ...EventHandler) EventHandler {
+	var active []EventHandler
+	for _, handler := range handlers {
+		if handler != nil {
+			active = append(active, handler)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	default:
+		return NewMultiEventHandler(active...)
+	}
+}
+
 // AddHandler 添加一个事件处理器
 func (m *MultiEventHandler) AddHandler(handler EventHandler) {
 	m.handlers = append(m.handlers, handler)
@@ -175,9 +301,38 @@ func (m *MultiEventHandler) OnTunnelEstablished(host string, isIntercepted bool)
 	}
 }
 
-// OnSSE 实现 EventHandler 接口，调用所有处理器
-func (m *MultiEventHandler) OnSSE(event string, ctx *ResponseContext) {
+// OnSSE 实现 EventHandler 接口，按顺序调用所有处理器
+// 后面的处理器看到的是前面处理器修改后的事件，任一处理器丢弃事件时不再调用后续处理器
+func (m *MultiEventHandler) OnSSE(event string, ctx *ResponseContext) string {
+	result := ""
 	for _, handler := range m.handlers {
-		handler.OnSSE(event, ctx)
+		modified := handler.OnSSE(event, ctx)
+		if modified == DropSSEEvent {
+			return DropSSEEvent
+		}
+		if modified != "" {
+			event = modified
+			result = modified
+		}
+	}
+	return result
+}
+
+// OnWebSocketMessage 实现 WebSocketEventHandler 接口，调用所有实现了该接口的处理器
+func (m *MultiEventHandler) OnWebSocketMessage(msg *WebSocketMessage, ctx *ResponseContext) {
+	for _, handler := range m.handlers {
+		if wsHandler, ok := handler.(WebSocketEventHandler); ok {
+			wsHandler.OnWebSocketMessage(msg, ctx)
+		}
+	}
+}
+
+// ConsumesBodies 实现 BodyConsumer 接口，任一处理器需要消息体时返回true
+func (m *MultiEventHandler) ConsumesBodies() bool {
+	for _, handler := range m.handlers {
+		if consumesBodies(handler) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,100 @@
+package proxy_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+)
+
+// statusPrinter 打印每个经过代理的响应
+type statusPrinter struct {
+	proxy.NoOpEventHandler
+}
+
+func (p *statusPrinter) OnResponse(ctx *proxy.ResponseContext) *http.Response {
+	fmt.Printf("%s %s -> %d\n", ctx.ReqCtx.Request.Method, ctx.ReqCtx.Request.URL.Path, ctx.Response.StatusCode)
+	return ctx.Response
+}
+
+// ExampleNew 演示在自己的程序中嵌入代理：使用内存CA、自定义事件处理器和日志输出
+func ExampleNew() {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from backend")
+	}))
+	defer backend.Close()
+
+	server, err := proxy.New(proxy.Config{
+		EventHandler: &statusPrinter{},
+		LogWriter:    io.Discard,
+	})
+	if err != nil {
+		fmt.Println("create proxy:", err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println("listen:", err)
+		return
+	}
+	defer listener.Close()
+	go server.Serve(listener)
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(backend.URL + "/hello")
+	if err != nil {
+		fmt.Println("request:", err)
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	fmt.Println(resp.StatusCode, string(body))
+	// Output:
+	// GET /hello -> 200
+	// 200 hello from backend
+}
+
+// ExampleConfig_onComplete 演示只用OnComplete接收完整事务，无需实现EventHandler
+func ExampleConfig_onComplete() {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from backend")
+	}))
+	defer backend.Close()
+
+	server, err := proxy.New(proxy.Config{
+		OnComplete: func(tx *proxy.Transaction) {
+			fmt.Printf("%s %s -> %d %q\n", tx.Request.Method, tx.Request.URL.Path, tx.Response.StatusCode, tx.ResponseBody)
+		},
+		LogWriter: io.Discard,
+	})
+	if err != nil {
+		fmt.Println("create proxy:", err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println("listen:", err)
+		return
+	}
+	defer listener.Close()
+	go server.Serve(listener)
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(backend.URL + "/hello")
+	if err != nil {
+		fmt.Println("request:", err)
+		return
+	}
+	resp.Body.Close()
+	// Output:
+	// GET /hello -> 200 "hello from backend"
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxContinueBodyCapture 是Expect: 100-continue请求转发时为记录保留的请求体上限，与WebHandler保存请求体的上限一致
+const maxContinueBodyCapture = 10 * 1024 * 1024
+
+// expectsContinue 判断请求是否带有Expect: 100-continue且有请求体
+func expectsContinue(req *http.Request) bool {
+	if req == nil || req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(req.Header.Get("Expect")), "100-continue")
+}
+
+// continueBody 包装Expect: 100-continue请求的请求体
+// 请求体只在Transport收到上游的100 Continue（或等待超时）后开始发送时才从客户端读取，
+// 读取的同时保留一份副本，转发完成后供WebHandler和HAR记录
+type continueBody struct {
+	io.ReadCloser
+
+	mu       sync.Mutex
+	captured bytes.Buffer
+}
+
+func (b *continueBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.mu.Lock()
+		if remaining := maxContinueBodyCapture - b.captured.Len(); remaining > 0 {
+			b.captured.Write(p[:min(n, remaining)])
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+// snapshot 返回目前已转发的请求体副本
+func (b *continueBody) snapshot() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.captured.Bytes())
+}
+
+// deferContinueBody 让Expect: 100-continue请求的请求体在转发时才读取，避免事件处理器提前缓存整个请求体
+// 提前读取会让客户端在上游同意之前就收到100 Continue并开始上传
+func (ctx *RequestContext) deferContinueBody() {
+	if !expectsContinue(ctx.Request) {
+		return
+	}
+	ctx.continueBody = &continueBody{ReadCloser: ctx.Request.Body}
+	ctx.Request.Body = ctx.continueBody
+}
+
+// restoreRequestBody 在收到上游响应或出错后，把已转发的请求体副本放回Request.Body，使记录流程可以照常读取
+func (ctx *RequestContext) restoreRequestBody() {
+	if ctx == nil {
+		return
+	}
+	switch {
+	case ctx.continueBody != nil:
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(ctx.continueBody.snapshot()))
+		ctx.continueBody = nil
+	case ctx.recordedBody != nil:
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(ctx.recordedBody))
+	}
+}
+
+// continueSender 为手动解析的MITM请求补上net/http服务端的行为：
+// 首次读取请求体时向客户端写出100 Continue，通知其开始上传
+type continueSender struct {
+	io.ReadCloser
+
+	conn  io.Writer
+	proto string
+	sent  atomic.Bool
+	err   error
+}
+
+func (c *continueSender) Read(p []byte) (int, error) {
+	if c.sent.CompareAndSwap(false, true) {
+		_, c.err = io.WriteString(c.conn, c.proto+" 100 Continue\r\n\r\n")
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.ReadCloser.Read(p)
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// continueRecorder 记录事件处理器在请求和响应阶段看到的请求体
+type continueRecorder struct {
+	NoOpEventHandler
+	mu           sync.Mutex
+	requestBody  []byte
+	recordedBody []byte
+}
+
+func (h *continueRecorder) OnRequest(ctx *RequestContext) *http.Request {
+	body, _ := ctx.GetRequestBody()
+	h.mu.Lock()
+	h.requestBody = body
+	h.mu.Unlock()
+	return ctx.Request
+}
+
+func (h *continueRecorder) OnResponse(ctx *ResponseContext) *http.Response {
+	body, _ := ctx.ReqCtx.GetRequestBody()
+	h.mu.Lock()
+	h.recordedBody = body
+	h.mu.Unlock()
+	return ctx.Response
+}
+
+func TestProxyRelaysExpectContinue(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		name := "http"
+		if secure {
+			name = "mitm"
+		}
+		t.Run(name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/reject" {
+					// 不读取请求体直接拒绝，net/http不会发送100 Continue
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				// 读取请求体时net/http向代理发送100 Continue
+				body, _ := io.ReadAll(r.Body)
+				_, _ = w.Write([]byte("got " + r.Header.Get("Expect") + ": " + string(body)))
+			})
+			var backend *httptest.Server
+			if secure {
+				backend = httptest.NewTLSServer(handler)
+			} else {
+				backend = httptest.NewServer(handler)
+			}
+			defer backend.Close()
+
+			recorder := &continueRecorder{}
+			server, err := New(Config{EventHandler: recorder, LogWriter: io.Discard})
+			require.NoError(t, err)
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			go func() { _ = server.Serve(listener) }()
+
+			proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+			// 客户端在收到100 Continue之前最多等待10秒，代理没有转发100时请求会明显变慢
+			client := &http.Client{Transport: &http.Transport{
+				Proxy:                 http.ProxyURL(proxyURL),
+				TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+				ExpectContinueTimeout: 10 * time.Second,
+			}}
+
+			req, err := http.NewRequest(http.MethodPost, backend.URL+"/upload", strings.NewReader("large payload"))
+			require.NoError(t, err)
+			req.Header.Set("Expect", "100-continue")
+			start := time.Now()
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Equal(t, "got 100-continue: large payload", string(body))
+
+			recorder.mu.Lock()
+			assert.Empty(t, recorder.requestBody, "body must not be buffered before forwarding")
+			assert.Equal(t, "large payload", string(recorder.recordedBody))
+			recorder.mu.Unlock()
+
+			req, err = http.NewRequest(http.MethodPost, backend.URL+"/reject", strings.NewReader("never sent"))
+			require.NoError(t, err)
+			req.Header.Set("Expect", "100-continue")
+			start = time.Now()
+			resp, err = client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+			recorder.mu.Lock()
+			assert.Empty(t, recorder.recordedBody)
+			recorder.mu.Unlock()
+		})
+	}
+}
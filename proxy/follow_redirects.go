@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// followRedirects 在设置了FollowRedirects时由代理跟随上游返回的重定向，返回最终响应的上下文
+// 每一跳都重新经过与客户端请求相同的流程（OnRequest/OnResponse事件、HAR记录），被跟随的响应体会被关闭；
+// 下一跳无法构造或发送失败时记录该跳的错误，并把最后一个重定向响应交给客户端
+func (s *Server) followRedirects(respCtx *ResponseContext, isSSE bool, logPrefix string) (*ResponseContext, bool) {
+	for hops := 0; hops < s.FollowRedirects && !isSSE; hops++ {
+		next := redirectRequest(respCtx)
+		if next == nil {
+			break
+		}
+		targetURL := normalizeTargetURL(next.URL.Scheme, next.URL.Host, next.URL)
+		secure := next.URL.Scheme == "https"
+		s.debugf("%s Following %d redirect to %s", logPrefix, respCtx.Response.StatusCode, targetURL)
+
+		proxyReq, reqCtx, potentialSSE, startTime, err := s.prepareProxyRequest(next, targetURL, secure)
+		if err != nil {
+			s.errorf("%s Error creating redirect request for %s: %v", logPrefix, targetURL, err)
+			break
+		}
+		transport := s.wrapTransportForSSE(s.roundTripperFor(next.URL.Host, secure, potentialSSE))
+		resp, timeTaken, err := s.sendProxyRequest(proxyReq, transport, potentialSSE, startTime)
+		if err != nil {
+			s.errorf("%s Error following redirect to %s: %v", logPrefix, targetURL, err)
+			s.recordProxyError(err, reqCtx, startTime, timeTaken)
+			break
+		}
+
+		_ = respCtx.Response.Body.Close()
+		respCtx, isSSE = s.processProxyResponse(reqCtx, resp, startTime, timeTaken, logPrefix, targetURL)
+	}
+	return respCtx, isSSE
+}
+
+// redirectRequest 根据重定向响应构造下一跳的客户端请求，不是可跟随的重定向时返回nil
+// 与浏览器和net/http一致：301/302把POST等方法改为GET，303除HEAD外都改为GET，这三种都丢弃请求体；
+// 307/308保留方法和请求体，请求体没有被完整缓存时不跟随。跳到其他主机时不转发Authorization和Cookie
+func redirectRequest(respCtx *ResponseContext) *http.Request {
+	if respCtx == nil || respCtx.Response == nil || respCtx.ReqCtx == nil || respCtx.ReqCtx.Request == nil {
+		return nil
+	}
+	resp := respCtx.Response
+	prev := respCtx.ReqCtx.Request
+	if isUpgradeRequest(prev) {
+		return nil
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil
+	}
+	base, err := url.Parse(respCtx.ReqCtx.TargetURL)
+	if err != nil {
+		return nil
+	}
+	target, err := base.Parse(location)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil
+	}
+	target.Fragment = ""
+
+	method := prev.Method
+	var body []byte
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			method = http.MethodGet
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if prev.ContentLength != 0 || len(prev.TransferEncoding) > 0 {
+			body = respCtx.ReqCtx.recordedBody
+			if body == nil || (prev.ContentLength > 0 && int64(len(body)) != prev.ContentLength) {
+				return nil
+			}
+		}
+	default:
+		return nil
+	}
+
+	next := prev.Clone(prev.Context())
+	next.Method = method
+	next.URL = target
+	next.Host = target.Host
+	next.RequestURI = ""
+	next.TransferEncoding = nil
+	next.Body = http.NoBody
+	next.ContentLength = 0
+	next.GetBody = nil
+	if body != nil {
+		next.Body = io.NopCloser(bytes.NewReader(body))
+		next.ContentLength = int64(len(body))
+	} else {
+		for _, name := range []string{"Content-Length", "Content-Type", "Content-Encoding", "Transfer-Encoding"} {
+			next.Header.Del(name)
+		}
+	}
+	if !strings.EqualFold(base.Hostname(), target.Hostname()) {
+		for _, name := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"} {
+			next.Header.Del(name)
+		}
+	}
+	return next
+}
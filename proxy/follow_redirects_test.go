@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedirectBackend() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/middle", http.StatusFound)
+	})
+	mux.HandleFunc("/middle", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final?from=middle", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Method+" final "+r.URL.RawQuery)
+	})
+	mux.HandleFunc("/temporary", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.Method+" "+string(body))
+	})
+	return mux
+}
+
+// doWithoutFollowing 发出请求，客户端自身不跟随重定向
+func doWithoutFollowing(t *testing.T, client *http.Client, method, target, body string) (int, string) {
+	t.Helper()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestFollowRedirects(t *testing.T) {
+	backend := httptest.NewServer(newRedirectBackend())
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(newRedirectBackend())
+	defer tlsBackend.Close()
+
+	t.Run("final response with each hop recorded", func(t *testing.T) {
+		recorder := &recordingEventHandler{}
+		client := newViaTestClient(t, Config{FollowRedirects: 5, EventHandler: recorder})
+
+		status, body := doWithoutFollowing(t, client, http.MethodPost, backend.URL+"/start", "form=1")
+		assert.Equal(t, http.StatusOK, status)
+		// 303 把POST改为GET
+		assert.Equal(t, "GET final from=middle", body)
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		assert.Equal(t, []string{backend.URL + "/start", backend.URL + "/middle", backend.URL + "/final?from=middle"}, recorder.requests)
+		assert.Equal(t, []int{http.StatusFound, http.StatusSeeOther, http.StatusOK}, recorder.responses)
+	})
+
+	t.Run("mitm", func(t *testing.T) {
+		client := newViaTestClient(t, Config{FollowRedirects: 5})
+		status, body := doWithoutFollowing(t, client, http.MethodGet, tlsBackend.URL+"/start", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "GET final from=middle", body)
+	})
+
+	t.Run("307 keeps method and body", func(t *testing.T) {
+		client := newViaTestClient(t, Config{FollowRedirects: 5})
+		status, body := doWithoutFollowing(t, client, http.MethodPost, backend.URL+"/temporary", "payload")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "POST payload", body)
+	})
+
+	t.Run("hop limit", func(t *testing.T) {
+		client := newViaTestClient(t, Config{FollowRedirects: 1})
+		status, _ := doWithoutFollowing(t, client, http.MethodGet, backend.URL+"/start", "")
+		assert.Equal(t, http.StatusSeeOther, status)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client := newViaTestClient(t, Config{})
+		status, _ := doWithoutFollowing(t, client, http.MethodGet, backend.URL+"/start", "")
+		assert.Equal(t, http.StatusFound, status)
+	})
+}
+
+func TestRedirectRequestDropsCredentialsAcrossHosts(t *testing.T) {
+	prev, _ := http.NewRequest(http.MethodGet, "http://a.test/start", nil)
+	prev.Header.Set("Authorization", "Bearer secret")
+	prev.Header.Set("Cookie", "session=1")
+	prev.Header.Set("Accept", "text/html")
+
+	redirect := func(location string) *http.Request {
+		resp := &http.Response{StatusCode: http.StatusFound, Header: http.Header{"Location": {location}}}
+		return redirectRequest(&ResponseContext{Response: resp, ReqCtx: &RequestContext{Request: prev, TargetURL: "http://a.test/start"}})
+	}
+
+	same := redirect("/next")
+	require.NotNil(t, same)
+	assert.Equal(t, "http://a.test/next", same.URL.String())
+	assert.Equal(t, "Bearer secret", same.Header.Get("Authorization"))
+
+	other := redirect("https://b.test/next")
+	require.NotNil(t, other)
+	assert.Equal(t, "b.test", other.Host)
+	assert.Empty(t, other.Header.Get("Authorization"))
+	assert.Empty(t, other.Header.Get("Cookie"))
+	assert.Equal(t, "text/html", other.Header.Get("Accept"))
+
+	assert.Nil(t, redirect("ftp://b.test/file"))
+}
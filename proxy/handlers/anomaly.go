@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 条目Anomaly字段中的异常标记，多个标记以逗号分隔
+const (
+	AnomalySlow          = "slow"           // 耗时超过慢请求阈值
+	AnomalyLargeRequest  = "large-request"  // 请求体超过大小阈值
+	AnomalyLargeResponse = "large-response" // 响应体超过大小阈值
+)
+
+// AnomalyThresholds 是标记异常条目的阈值，为0的项不检查
+type AnomalyThresholds struct {
+	Slow  time.Duration // 耗时阈值
+	Large int64         // 请求体或响应体的大小阈值（字节）
+}
+
+// Enabled 返回是否设置了任一阈值
+func (t AnomalyThresholds) Enabled() bool {
+	return t.Slow > 0 || t.Large > 0
+}
+
+// Detect 返回超过阈值的异常标记，没有异常时返回空字符串；大小未知时传入-1
+func (t AnomalyThresholds) Detect(duration time.Duration, requestSize, responseSize int64) string {
+	var markers []string
+	if t.Slow > 0 && duration > t.Slow {
+		markers = append(markers, AnomalySlow)
+	}
+	if t.Large > 0 && requestSize > t.Large {
+		markers = append(markers, AnomalyLargeRequest)
+	}
+	if t.Large > 0 && responseSize > t.Large {
+		markers = append(markers, AnomalyLargeResponse)
+	}
+	return strings.Join(markers, ",")
+}
+
+// SetAnomalyThresholds 设置异常阈值：响应完成时耗时或请求体/响应体大小超过阈值的条目会设置Anomaly并输出一行[ANOMALY]日志
+// 需要在处理流量之前调用
+func (h *WebHandler) SetAnomalyThresholds(thresholds AnomalyThresholds) {
+	h.anomaly = thresholds
+}
+
+// markAnomalyLocked 根据条目已记录的耗时和大小更新Anomaly，标记变化时输出日志，调用方需持有entryMutex
+func (h *WebHandler) markAnomalyLocked(entry *TrafficEntry) {
+	if !h.anomaly.Enabled() {
+		return
+	}
+	anomaly := h.anomaly.Detect(time.Duration(entry.Duration)*time.Millisecond, entryRequestSize(entry), int64(entry.ContentSize))
+	if anomaly == entry.Anomaly {
+		return
+	}
+	entry.Anomaly = anomaly
+	if anomaly != "" {
+		log.Printf("[ANOMALY] %s %s: %s (duration %dms, request %d bytes, response %d bytes)",
+			entry.Method, entry.URL, anomaly, entry.Duration, entryRequestSize(entry), entry.ContentSize)
+	}
+}
+
+// entryRequestSize 返回请求体大小，优先使用Content-Length（保存的请求体可能被截断或在隐私模式下不保存）
+func entryRequestSize(entry *TrafficEntry) int64 {
+	if value := entry.RequestHeaders.Get("Content-Length"); value != "" {
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return size
+		}
+	}
+	return int64(len(entry.RequestBody))
+}
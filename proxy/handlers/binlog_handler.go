@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"sync"
+
+	"github.com/LubyRuffy/ProxyCraft/binlog"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+)
+
+// BinlogHandler 把每个完成的事务写成一条紧凑的二进制记录（见binlog包），包含请求/响应头和消息体
+// 适合长时间大量抓包，之后再用binlog.ConvertToHAR转换为HAR；未被抽中的事务不写入
+type BinlogHandler struct {
+	proxy.EventHandler
+
+	writer *binlog.Writer
+	mu     sync.Mutex
+	failed bool // 写入出错后只记录一次日志
+}
+
+// NewBinlogHandler 在w上开始一个新的二进制记录会话，w的并发写入由处理器串行化
+func NewBinlogHandler(w io.Writer) (*BinlogHandler, error) {
+	writer, err := binlog.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	h := &BinlogHandler{writer: writer}
+	h.EventHandler = proxy.NewTransactionHandler(h.write)
+	return h, nil
+}
+
+// write 把一个事务写成一条二进制记录
+func (h *BinlogHandler) write(tx *proxy.Transaction) {
+	if tx.Err == nil && tx.RespCtx != nil && tx.RespCtx.SkipRecord {
+		return
+	}
+
+	record := &binlog.Record{
+		StartTime:   tx.StartTime,
+		Duration:    tx.Duration,
+		URL:         tx.ReqCtx.TargetURL,
+		IsHTTPS:     tx.IsHTTPS,
+		IsSSE:       tx.IsSSE,
+		IsWebSocket: tx.IsWebSocket,
+		RequestBody: tx.RequestBody,
+	}
+	if req := tx.Request; req != nil {
+		record.Method = req.Method
+		record.Proto = req.Proto
+		record.RemoteAddr = req.RemoteAddr
+		record.RequestHeader = req.Header
+		record.RequestSize = max(req.ContentLength, 0)
+		if record.URL == "" && req.URL != nil {
+			record.URL = req.URL.String()
+		}
+	}
+	if tx.RequestBody != nil {
+		record.RequestSize = int64(len(tx.RequestBody))
+	}
+	if resp := tx.Response; resp != nil {
+		record.StatusCode = resp.StatusCode
+		record.Status = resp.Status
+		record.ResponseProto = resp.Proto
+		record.ResponseHeader = resp.Header
+		record.ResponseSize = max(resp.ContentLength, 0)
+		record.ResponseBody = tx.ResponseBody
+	}
+	if tx.ResponseBody != nil {
+		record.ResponseSize = int64(len(tx.ResponseBody))
+	}
+	if tx.Err != nil {
+		record.Error = tx.Err.Error()
+		record.ErrorKind = string(proxy.ClassifyError(tx.Err))
+	}
+
+	if err := h.writer.Write(record); err != nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if !h.failed {
+			h.failed = true
+			log.Printf("[Binlog] 写入失败，之后的错误不再输出: %v", err)
+		}
+	}
+}
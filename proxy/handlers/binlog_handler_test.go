@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/binlog"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinlogHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(append([]byte("echo "), body...))
+	}))
+	defer backend.Close()
+
+	var out syncBuffer
+	binlogHandler, err := NewBinlogHandler(&out)
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{
+		EventHandler: binlogHandler,
+		LogWriter:    io.Discard,
+	})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Post(backend.URL+"/sink", "text/plain", strings.NewReader("ping"))
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// 二进制记录包含完整的请求和响应消息体
+	var records []*binlog.Record
+	require.Eventually(t, func() bool {
+		records = nil
+		reader := binlog.NewReader(bytes.NewReader([]byte(out.String())))
+		for {
+			record, err := reader.Next()
+			if err != nil {
+				return len(records) == 1
+			}
+			records = append(records, record)
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	record := records[0]
+	assert.Equal(t, http.MethodPost, record.Method)
+	assert.Equal(t, backend.URL+"/sink", record.URL)
+	assert.Equal(t, "ping", string(record.RequestBody))
+	assert.Equal(t, http.StatusOK, record.StatusCode)
+	assert.Equal(t, "echo ping", string(record.ResponseBody))
+	assert.Equal(t, int64(9), record.ResponseSize)
+	assert.Equal(t, "text/plain", record.ResponseHeader.Get("Content-Type"))
+	assert.Empty(t, record.Error)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/bodystore"
+)
+
+// DefaultBodyStoreMinSize 是启用文件存储时写入文件的消息体的默认最小大小
+const DefaultBodyStoreMinSize = 64 * 1024
+
+// bodyStorePruneGrace 内的文件即使未被引用也不会被清理，避免删除刚写入、数据库尚未更新的文件
+const bodyStorePruneGrace = time.Minute
+
+// bodyStore 把较大的请求体和响应体按sha256内容寻址保存在目录中，数据库只记录哈希，相同内容只保存一份
+type bodyStore struct {
+	*bodystore.Store
+	minSize int
+}
+
+// SetBodyStore 让超过minSize字节的消息体保存到dir下的文件中，而不是作为BLOB写入SQLite
+// minSize<=0时使用DefaultBodyStoreMinSize；StorageMemory模式没有数据库，不支持文件存储
+func (h *WebHandler) SetBodyStore(dir string, minSize int) error {
+	if !h.storage.usesSQLite() {
+		return fmt.Errorf("body store requires sqlite storage, current storage mode is %q", h.storage)
+	}
+	store, err := bodystore.New(dir)
+	if err != nil {
+		return err
+	}
+	if minSize <= 0 {
+		minSize = DefaultBodyStoreMinSize
+	}
+	h.bodyStore = &bodyStore{Store: store, minSize: minSize}
+	return nil
+}
+
+// storeBody 返回写入数据库的消息体列和哈希列：未启用文件存储、消息体不超过阈值或写文件失败时保存BLOB
+func (h *WebHandler) storeBody(body []byte) (interface{}, interface{}) {
+	if h.bodyStore == nil || len(body) <= h.bodyStore.minSize {
+		return emptyBytesToNil(body), nil
+	}
+	hash, err := h.bodyStore.Put(body)
+	if err != nil {
+		log.Printf("[WebHandler] 保存消息体文件失败，改为写入数据库: %v", err)
+		return emptyBytesToNil(body), nil
+	}
+	return nil, hash
+}
+
+// loadBody 返回条目的消息体，哈希不为空时从文件中读取
+func (h *WebHandler) loadBody(blob []byte, hash string) []byte {
+	if hash == "" || h.bodyStore == nil {
+		return blob
+	}
+	body, err := h.bodyStore.Get(hash)
+	if err != nil {
+		log.Printf("[WebHandler] 读取消息体文件失败: %v", err)
+		return nil
+	}
+	return body
+}
+
+// pruneBodyStore 删除数据库中已不再引用的消息体文件
+func (h *WebHandler) pruneBodyStore() {
+	if h.bodyStore == nil || h.db == nil {
+		return
+	}
+	rows, err := h.db.Query(
+		`SELECT request_body_hash, response_body_hash FROM traffic_entries
+		WHERE request_body_hash IS NOT NULL OR response_body_hash IS NOT NULL`,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	referenced := make(map[string]bool)
+	for rows.Next() {
+		var requestHash, responseHash sql.NullString
+		if err := rows.Scan(&requestHash, &responseHash); err != nil {
+			return
+		}
+		referenced[requestHash.String] = true
+		referenced[responseHash.String] = true
+	}
+	if rows.Err() != nil {
+		return
+	}
+	h.bodyStore.Prune(referenced, bodyStorePruneGrace)
+}
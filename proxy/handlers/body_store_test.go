@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordBodyEntry 记录一个带请求体和响应体的事务，返回条目ID
+func recordBodyEntry(t *testing.T, handler *WebHandler, requestBody, responseBody string) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/upload", strings.NewReader(requestBody))
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+	handler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       io.NopCloser(bytes.NewBufferString(responseBody)),
+		},
+	})
+	return reqCtx.UserData["traffic_id"].(string)
+}
+
+func countStoredFiles(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			count++
+		}
+		return err
+	}))
+	return count
+}
+
+func TestWebHandler_BodyStore(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "traffic.db"), StorageSQLite)
+	require.NoError(t, err)
+	storeDir := filepath.Join(t.TempDir(), "bodies")
+	require.NoError(t, handler.SetBodyStore(storeDir, 16))
+
+	large := strings.Repeat("large body ", 100)
+	idA := recordBodyEntry(t, handler, "small", large)
+	idB := recordBodyEntry(t, handler, large, large)
+
+	// 相同内容只保存一份，小于阈值的消息体仍写入数据库
+	assert.Equal(t, 1, countStoredFiles(t, storeDir))
+	var requestBlob, responseBlob []byte
+	var responseHash sql.NullString
+	require.NoError(t, handler.db.QueryRow(
+		"SELECT request_body, response_body, response_body_hash FROM traffic_entries WHERE id = ?", idA,
+	).Scan(&requestBlob, &responseBlob, &responseHash))
+	assert.Equal(t, "small", string(requestBlob))
+	assert.Nil(t, responseBlob)
+	assert.Len(t, responseHash.String, 64)
+
+	for _, id := range []string{idA, idB} {
+		entry, err := handler.loadEntry(id)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.Equal(t, large, string(entry.ResponseBody))
+	}
+	entry, err := handler.loadEntry(idB)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(entry.RequestBody))
+
+	// 条目清空后，过了宽限期的孤立文件被删除
+	handler.ClearEntries()
+	old := time.Now().Add(-2 * bodyStorePruneGrace)
+	require.NoError(t, os.Chtimes(handler.bodyStore.Path(responseHash.String), old, old))
+	handler.pruneBodyStore()
+	assert.Equal(t, 0, countStoredFiles(t, storeDir))
+}
+
+func TestWebHandler_BodyStoreRequiresSQLite(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	assert.Error(t, handler.SetBodyStore(t.TempDir(), 0))
+}
@@ -17,6 +17,9 @@ type CLIHandler struct {
 	// DumpBody 是否输出请求和响应的主体
 	DumpBody bool
 
+	// Anomaly 耗时或消息体大小超过阈值的响应额外输出一行[ANOMALY]日志，大小取自Content-Length
+	Anomaly AnomalyThresholds
+
 	// 计数器
 	RequestCount  int
 	ResponseCount int
@@ -33,6 +36,11 @@ func NewCLIHandler(verbose, dumpBody bool) *CLIHandler {
 	}
 }
 
+// ConsumesBodies 实现 proxy.BodyConsumer 接口，只有输出消息体时才需要读取
+func (h *CLIHandler) ConsumesBodies() bool {
+	return h.DumpBody
+}
+
 // OnRequest 实现 EventHandler 接口
 func (h *CLIHandler) OnRequest(ctx *proxy.RequestContext) *http.Request {
 	h.RequestCount++
@@ -89,8 +97,8 @@ func (h *CLIHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 			}
 		}
 
-		// 如果需要输出主体，且不是SSE
-		if h.DumpBody && !ctx.IsSSE {
+		// 如果需要输出主体，且不是SSE，也没有跳过响应体（-skip-body-types或-no-bodies）
+		if h.DumpBody && !ctx.IsSSE && !ctx.SkipBody {
 			body, err := ctx.GetResponseBody()
 			if err != nil {
 				fmt.Printf("[RES] Error reading body: %v\n", err)
@@ -112,6 +120,15 @@ func (h *CLIHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 			ctx.TimeTaken.Milliseconds())
 	}
 
+	if h.Anomaly.Enabled() {
+		requestSize := ctx.ReqCtx.Request.ContentLength
+		if anomaly := h.Anomaly.Detect(ctx.TimeTaken, requestSize, ctx.Response.ContentLength); anomaly != "" {
+			log.Printf("[ANOMALY] #%d %s %s: %s (took %dms, request %d bytes, response %d bytes)",
+				h.ResponseCount, ctx.ReqCtx.Request.Method, ctx.ReqCtx.TargetURL, anomaly,
+				ctx.TimeTaken.Milliseconds(), requestSize, ctx.Response.ContentLength)
+		}
+	}
+
 	return ctx.Response
 }
 
@@ -133,12 +150,29 @@ func (h *CLIHandler) OnTunnelEstablished(host string, isIntercepted bool) {
 }
 
 // OnSSE 实现 EventHandler 接口
-func (h *CLIHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
+func (h *CLIHandler) OnSSE(event string, ctx *proxy.ResponseContext) string {
 	h.SSECount++
 
 	if h.Verbose {
 		fmt.Printf("[SSE] #%d %s\n", h.SSECount, event)
 	}
+	return ""
+}
+
+// OnWebSocketMessage 实现 proxy.WebSocketEventHandler 接口
+func (h *CLIHandler) OnWebSocketMessage(msg *proxy.WebSocketMessage, ctx *proxy.ResponseContext) {
+	if !h.Verbose {
+		return
+	}
+	direction := "<-"
+	if msg.FromClient {
+		direction = "->"
+	}
+	if msg.Opcode == proxy.WebSocketText {
+		fmt.Printf("[WS] %s %s\n", direction, msg.Data)
+	} else {
+		fmt.Printf("[WS] %s opcode=%d (%d bytes)\n", direction, msg.Opcode, msg.Length)
+	}
 }
 
 // GetStats 获取处理器的统计信息
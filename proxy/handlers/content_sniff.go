@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLength 是探测内容类型时检查的前缀长度，与http.DetectContentType一致
+const sniffLength = 512
+
+// genericContentTypes 是不能说明实际内容的Content-Type，遇到时需要根据内容探测
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+	"application/unknown":      true,
+	"text/plain":               true,
+}
+
+// SniffContentType 在Content-Type缺失或过于笼统时根据内容前缀探测实际类型
+// 优先识别JSON、SSE和XML，其余交给http.DetectContentType；无法得到更具体的类型时返回空字符串
+func SniffContentType(contentType string, body []byte) string {
+	mediaType := strings.ToLower(strings.TrimSpace(contentType))
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = parsed
+	}
+	if !genericContentTypes[mediaType] || len(body) == 0 {
+		return ""
+	}
+
+	prefix := body
+	if len(prefix) > sniffLength {
+		prefix = prefix[:sniffLength]
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(prefix, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	var detected string
+	switch {
+	case looksLikeJSON(trimmed):
+		detected = "application/json"
+	case looksLikeSSE(trimmed):
+		detected = "text/event-stream"
+	case bytes.HasPrefix(trimmed, []byte("<?xml")):
+		detected = "application/xml"
+	default:
+		detected = http.DetectContentType(prefix)
+	}
+
+	if parsed, _, err := mime.ParseMediaType(detected); err == nil && parsed == mediaType {
+		return ""
+	}
+	if mediaType != "" && detected == "application/octet-stream" {
+		return ""
+	}
+	return detected
+}
+
+// looksLikeJSON 判断数据是否为JSON对象或数组的开头，允许数据在任意位置被截断
+func looksLikeJSON(data []byte) bool {
+	if len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := decoder.Token()
+		if err == nil {
+			continue
+		}
+		return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+}
+
+// looksLikeSSE 判断数据是否以SSE字段行开头
+func looksLikeSSE(data []byte) bool {
+	for _, field := range []string{"data:", "event:", "id:", "retry:"} {
+		if bytes.HasPrefix(data, []byte(field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveContentType 返回条目响应体的实际类型：探测结果优先，否则使用记录的Content-Type
+func (e *TrafficEntry) EffectiveContentType() string {
+	if e.DetectedContentType != "" {
+		return e.DetectedContentType
+	}
+	return e.ContentType
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"json_as_octet_stream", "application/octet-stream", `{"model":"gpt-4o","choices":[]}`, "application/json"},
+		{"json_without_header", "", "\n  [1, 2, 3]", "application/json"},
+		{"truncated_json", "", `{"text":"` + strings.Repeat("a", 600), "application/json"},
+		{"json_as_text_plain", "text/plain; charset=utf-8", `{"ok":true}`, "application/json"},
+		{"sse_without_header", "", "data: {\"delta\":\"hi\"}\n\n", "text/event-stream"},
+		{"xml_without_header", "", `<?xml version="1.0"?><root/>`, "application/xml"},
+		{"html_without_header", "", "<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+		{"png_as_octet_stream", "application/octet-stream", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"binary_stays_octet_stream", "application/octet-stream", "\x00\x01\x02\x03", ""},
+		{"plain_text_stays_text", "text/plain", "hello world", ""},
+		{"not_json", "", "{not json", "text/plain; charset=utf-8"},
+		{"specific_header_kept", "application/json", "<html></html>", ""},
+		{"empty_body", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SniffContentType(tt.contentType, []byte(tt.body)))
+		})
+	}
+}
+
+func TestWebHandler_RecordsDetectedContentType(t *testing.T) {
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/data", nil)
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	webHandler.OnRequest(reqCtx)
+	webHandler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/octet-stream"}},
+			Body:       io.NopCloser(bytes.NewBufferString(`{"ok":true}`)),
+		},
+	})
+
+	id := reqCtx.UserData["traffic_id"].(string)
+	stored, err := webHandler.loadEntry(id)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(id), stored} {
+		require.NotNil(t, entry)
+		// 真实的响应头保持不变
+		assert.Equal(t, "application/octet-stream", entry.ContentType)
+		assert.Equal(t, "application/json", entry.DetectedContentType)
+		assert.Equal(t, "application/json", entry.EffectiveContentType())
+	}
+}
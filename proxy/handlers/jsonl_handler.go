@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+)
+
+// JSONLHandler 把每个完成的事务作为一行JSON写入Writer，可以和WebHandler、HAR同时使用
+// 每行只包含元数据和请求/响应头，不含消息体；大小取自Content-Length，未知时在转发时计数，不会缓存消息体
+// 未被抽中的事务不写入
+type JSONLHandler struct {
+	proxy.NoOpEventHandler
+
+	mu       sync.Mutex
+	encoder  *json.Encoder
+	failed   bool   // 写入出错后只记录一次日志
+	stateKey string // 在RequestContext.UserData中保存jsonlState的键，同时注册多个处理器时互不影响
+}
+
+// jsonlState 是一个事务写出之前的状态
+type jsonlState struct {
+	requestBody *countingBody          // Content-Length未知的请求体，为nil时使用Content-Length
+	respCtx     *proxy.ResponseContext // 已收到的响应
+	sseBytes    int64                  // 已转发的SSE事件字节数
+	once        sync.Once              // 每个事务只写一行
+}
+
+// countingBody 统计读过的字节数，读到EOF或关闭时调用onDone
+type countingBody struct {
+	io.ReadCloser
+	n      int64
+	onDone func(n int64)
+	once   sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err == io.EOF && b.onDone != nil {
+		b.once.Do(func() { b.onDone(b.n) })
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if b.onDone != nil {
+		b.once.Do(func() { b.onDone(b.n) })
+	}
+	return b.ReadCloser.Close()
+}
+
+// jsonlRecord 是JSONLHandler输出的一行，字段名与Web界面的流量条目一致
+type jsonlRecord struct {
+	StartTime       time.Time   `json:"startTime"`
+	Duration        int64       `json:"duration"` // 毫秒
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Host            string      `json:"host"`
+	StatusCode      int         `json:"statusCode,omitempty"`
+	ContentType     string      `json:"contentType,omitempty"`
+	RequestSize     int64       `json:"requestSize"`
+	ResponseSize    int64       `json:"responseSize"`
+	IsHTTPS         bool        `json:"isHTTPS"`
+	IsSSE           bool        `json:"isSSE,omitempty"`
+	IsWebSocket     bool        `json:"isWebSocket,omitempty"`
+	Error           string      `json:"error,omitempty"`
+	ErrorKind       string      `json:"errorKind,omitempty"`
+	RequestHeaders  http.Header `json:"requestHeaders,omitempty"`
+	ResponseHeaders http.Header `json:"responseHeaders,omitempty"`
+}
+
+// NewJSONLHandler 创建写入w的JSONL事件处理器，w的并发写入由处理器串行化
+func NewJSONLHandler(w io.Writer) *JSONLHandler {
+	h := &JSONLHandler{encoder: json.NewEncoder(w)}
+	h.encoder.SetEscapeHTML(false)
+	h.stateKey = fmt.Sprintf("handlers.jsonl.%p", h)
+	return h
+}
+
+// ConsumesBodies 实现 proxy.BodyConsumer 接口，JSONL只记录元数据
+func (h *JSONLHandler) ConsumesBodies() bool {
+	return false
+}
+
+// state 返回事务的状态，不存在时创建
+func (h *JSONLHandler) state(reqCtx *proxy.RequestContext) *jsonlState {
+	if state, ok := reqCtx.UserData[h.stateKey].(*jsonlState); ok {
+		return state
+	}
+	state := &jsonlState{}
+	reqCtx.UserData[h.stateKey] = state
+	return state
+}
+
+// OnRequest 实现 EventHandler 接口，Content-Length未知的请求体在转发时计数
+func (h *JSONLHandler) OnRequest(ctx *proxy.RequestContext) *http.Request {
+	state := h.state(ctx)
+	if req := ctx.Request; req.ContentLength < 0 && req.Body != nil && req.Body != http.NoBody {
+		state.requestBody = &countingBody{ReadCloser: req.Body}
+		req.Body = state.requestBody
+	}
+	return ctx.Request
+}
+
+// OnResponse 实现 EventHandler 接口；Content-Length未知的响应在响应体转发完后写出，SSE在流结束后写出
+func (h *JSONLHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
+	if ctx.ReqCtx == nil {
+		return ctx.Response
+	}
+	state := h.state(ctx.ReqCtx)
+	state.respCtx = ctx
+	resp := ctx.Response
+	switch {
+	case ctx.IsSSE:
+	case ctx.IsWebSocket || resp.ContentLength >= 0 || proxy.ResponseHasNoBody(resp) || resp.Body == nil:
+		h.write(ctx.ReqCtx, state, max(resp.ContentLength, 0), nil)
+	default:
+		resp.Body = &countingBody{ReadCloser: resp.Body, onDone: func(n int64) {
+			h.write(ctx.ReqCtx, state, n, nil)
+		}}
+	}
+	return resp
+}
+
+// OnSSE 实现 EventHandler 接口，统计转发的事件字节数，流结束时写出
+func (h *JSONLHandler) OnSSE(event string, ctx *proxy.ResponseContext) string {
+	if ctx.ReqCtx == nil {
+		return ""
+	}
+	state := h.state(ctx.ReqCtx)
+	if event == "__SSE_COMPLETED__" {
+		h.write(ctx.ReqCtx, state, state.sseBytes, nil)
+	} else {
+		state.sseBytes += int64(len(event)) + 2
+	}
+	return ""
+}
+
+// OnError 实现 EventHandler 接口，写出失败的事务；已经写出的事务之后的错误被忽略
+func (h *JSONLHandler) OnError(err error, reqCtx *proxy.RequestContext) {
+	if reqCtx == nil {
+		return
+	}
+	state := h.state(reqCtx)
+	h.write(reqCtx, state, state.sseBytes, err)
+}
+
+// write 把一个事务写成一行JSON，每个事务只写一次
+func (h *JSONLHandler) write(reqCtx *proxy.RequestContext, state *jsonlState, responseSize int64, err error) {
+	state.once.Do(func() {
+		h.writeRecord(reqCtx, state, responseSize, err)
+	})
+}
+
+func (h *JSONLHandler) writeRecord(reqCtx *proxy.RequestContext, state *jsonlState, responseSize int64, err error) {
+	respCtx := state.respCtx
+	if err == nil && respCtx != nil && respCtx.SkipRecord {
+		return
+	}
+
+	record := &jsonlRecord{
+		StartTime: reqCtx.StartTime,
+		Duration:  time.Since(reqCtx.StartTime).Milliseconds(),
+		URL:       reqCtx.TargetURL,
+		IsHTTPS:   reqCtx.IsHTTPS,
+	}
+	if req := reqCtx.Request; req != nil {
+		record.Method = req.Method
+		record.Host = req.Host
+		record.RequestHeaders = req.Header
+		record.RequestSize = max(req.ContentLength, 0)
+		if record.URL == "" && req.URL != nil {
+			record.URL = req.URL.String()
+		}
+	}
+	if state.requestBody != nil {
+		record.RequestSize = state.requestBody.n
+	}
+	if respCtx != nil && respCtx.Response != nil {
+		resp := respCtx.Response
+		record.IsSSE = respCtx.IsSSE
+		record.IsWebSocket = respCtx.IsWebSocket
+		record.StatusCode = resp.StatusCode
+		record.ContentType = resp.Header.Get("Content-Type")
+		record.ResponseHeaders = resp.Header
+		record.ResponseSize = responseSize
+	}
+	if err != nil {
+		record.Error = err.Error()
+		record.ErrorKind = string(proxy.ClassifyError(err))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.encoder.Encode(record); err != nil && !h.failed {
+		h.failed = true
+		log.Printf("[JSONL] 写入失败，之后的错误不再输出: %v", err)
+	}
+}
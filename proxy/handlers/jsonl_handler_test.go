@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer 是可以并发写入的bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestJSONLHandler_AlongsideWebHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(append([]byte("echo "), body...))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	var out syncBuffer
+	server, err := proxy.New(proxy.Config{
+		EventHandler:  webHandler,
+		EventHandlers: []proxy.EventHandler{NewJSONLHandler(&out)},
+		LogWriter:     io.Discard,
+	})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Post(backend.URL+"/sink", "text/plain", strings.NewReader("ping"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "echo ping", string(body))
+
+	// 同一个请求同时出现在Web界面的存储和JSONL输出中
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, backend.URL+"/sink", entries[0].URL)
+
+	var lines []jsonlRecord
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var record jsonlRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		lines = append(lines, record)
+	}
+	require.Len(t, lines, 1)
+	assert.Equal(t, http.MethodPost, lines[0].Method)
+	assert.Equal(t, backend.URL+"/sink", lines[0].URL)
+	assert.Equal(t, http.StatusOK, lines[0].StatusCode)
+	assert.Equal(t, int64(4), lines[0].RequestSize)
+	assert.Equal(t, int64(9), lines[0].ResponseSize)
+	assert.Equal(t, "text/plain", lines[0].ContentType)
+	assert.Empty(t, lines[0].Error)
+}
+
+func TestJSONLHandler_SizesWithoutBuffering(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, "data: one\n\ndata: two\n\n")
+			return
+		}
+		// 分块发送，响应没有Content-Length
+		_, _ = w.Write(body)
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+
+	var out syncBuffer
+	handler := NewJSONLHandler(&out)
+	server, err := proxy.New(proxy.Config{EventHandler: handler, PassthroughBodies: true, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	// 包一层io.MultiReader使请求以分块编码发送，没有Content-Length
+	resp, err := client.Post(backend.URL+"/chunked", "text/plain", io.MultiReader(strings.NewReader("hello")))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hellohello", string(body))
+
+	resp, err = client.Get(backend.URL + "/events")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var lines []jsonlRecord
+	require.Eventually(t, func() bool {
+		lines = lines[:0]
+		scanner := bufio.NewScanner(strings.NewReader(out.String()))
+		for scanner.Scan() {
+			var record jsonlRecord
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			lines = append(lines, record)
+		}
+		return len(lines) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, handler.ConsumesBodies())
+	assert.Equal(t, int64(5), lines[0].RequestSize)
+	assert.Equal(t, int64(10), lines[0].ResponseSize)
+	assert.True(t, lines[1].IsSSE)
+	assert.Equal(t, int64(len("data: one\n\ndata: two\n\n")), lines[1].ResponseSize)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRedirectHops 是重定向链最多包含的跳数，与浏览器的上限相当，也避免循环重定向无限展开
+const maxRedirectHops = 20
+
+// RedirectChain 返回包含id的重定向链，按请求顺序排列，每个条目的RedirectFrom和RedirectTo指向链中的相邻条目
+// 重定向通过3xx响应的Location与之后请求的URL匹配识别，只在最近的条目（与GetEntries相同）中查找
+// 条目不存在时返回nil，不属于任何重定向的条目返回只含自身的链
+func (h *WebHandler) RedirectChain(id string) []*TrafficEntry {
+	summaries := h.GetEntries()
+	sort.Slice(summaries, func(i, j int) bool {
+		return entryIDNumber(summaries[i].ID) < entryIDNumber(summaries[j].ID)
+	})
+	index := -1
+	for i, entry := range summaries {
+		if entry.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	chain := []int{index}
+	seen := map[int]bool{index: true}
+	for len(chain) < maxRedirectHops {
+		prev := h.redirectSource(summaries, chain[0])
+		if prev < 0 || seen[prev] {
+			break
+		}
+		seen[prev] = true
+		chain = append([]int{prev}, chain...)
+	}
+	for len(chain) < maxRedirectHops {
+		next := h.redirectTarget(summaries, chain[len(chain)-1])
+		if next < 0 || seen[next] {
+			break
+		}
+		seen[next] = true
+		chain = append(chain, next)
+	}
+
+	result := make([]*TrafficEntry, len(chain))
+	for i, position := range chain {
+		result[i] = summaries[position]
+	}
+	for i := range result {
+		if i > 0 {
+			result[i].RedirectFrom = result[i-1].ID
+		}
+		if i < len(result)-1 {
+			result[i].RedirectTo = result[i+1].ID
+		}
+	}
+	return result
+}
+
+// redirectTarget 返回summaries[index]的重定向在之后第一个匹配的请求，没有时返回-1
+func (h *WebHandler) redirectTarget(summaries []*TrafficEntry, index int) int {
+	location := h.redirectLocation(summaries[index])
+	if location == "" {
+		return -1
+	}
+	for i := index + 1; i < len(summaries); i++ {
+		if sameRedirectURL(summaries[i].URL, location) {
+			return i
+		}
+	}
+	return -1
+}
+
+// redirectSource 返回之前最近一个重定向到summaries[index]的条目，没有时返回-1
+func (h *WebHandler) redirectSource(summaries []*TrafficEntry, index int) int {
+	for i := index - 1; i >= 0; i-- {
+		if !isRedirectStatus(summaries[i].StatusCode) {
+			continue
+		}
+		if location := h.redirectLocation(summaries[i]); location != "" && sameRedirectURL(summaries[index].URL, location) {
+			return i
+		}
+	}
+	return -1
+}
+
+// redirectLocation 返回重定向响应的Location相对请求URL解析后的绝对地址，不是重定向时返回空字符串
+func (h *WebHandler) redirectLocation(summary *TrafficEntry) string {
+	if !isRedirectStatus(summary.StatusCode) {
+		return ""
+	}
+	entry := h.GetEntry(summary.ID)
+	if entry == nil || entry.ResponseHeaders == nil {
+		return ""
+	}
+	location := entry.ResponseHeaders.Get("Location")
+	if location == "" {
+		return ""
+	}
+	base, err := url.Parse(summary.URL)
+	if err != nil {
+		return ""
+	}
+	target, err := base.Parse(location)
+	if err != nil {
+		return ""
+	}
+	return target.String()
+}
+
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// sameRedirectURL 比较两个绝对URL，忽略片段、协议和主机名的大小写以及默认端口
+func sameRedirectURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(hostWithoutDefaultPort(ua), hostWithoutDefaultPort(ub)) &&
+		ua.EscapedPath() == ub.EscapedPath() && ua.RawQuery == ub.RawQuery
+}
+
+func hostWithoutDefaultPort(u *url.URL) string {
+	port := u.Port()
+	if (port == "80" && strings.EqualFold(u.Scheme, "http")) || (port == "443" && strings.EqualFold(u.Scheme, "https")) {
+		return u.Hostname()
+	}
+	return u.Host
+}
+
+func entryIDNumber(id string) int64 {
+	n, _ := strconv.ParseInt(id, 10, 64)
+	return n
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// maxSSEEventTimings 是每个条目最多记录的SSE事件时间数，超过后不再记录，聚合的响应体不受影响
+const maxSSEEventTimings = 10000
+
+// SSEEvent 记录一个SSE事件到达代理的时间、大小和类型，用于分析LLM流式输出的逐token延迟
+type SSEEvent struct {
+	OffsetMs float64 `json:"offsetMs"` // 相对请求开始时间的偏移（毫秒）
+	Size     int     `json:"size"`     // 事件的字节数，不含结尾的空行
+	Type     string  `json:"type"`     // event字段的值，未设置时为 "message"
+}
+
+// newSSEEvent 按事件文本和到达时间生成SSEEvent
+func newSSEEvent(eventText string, start, at time.Time) SSEEvent {
+	return SSEEvent{
+		OffsetMs: float64(at.Sub(start).Microseconds()) / 1000,
+		Size:     len(eventText),
+		Type:     sseEventType(eventText),
+	}
+}
+
+// sseEventType 返回事件的event字段，按SSE规范缺省为 "message"
+func sseEventType(eventText string) string {
+	for _, line := range strings.Split(eventText, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "event:"); ok {
+			if name = strings.TrimSpace(name); name != "" {
+				return name
+			}
+		}
+	}
+	return "message"
+}
+
+func marshalSSEEvents(events []SSEEvent) ([]byte, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(events)
+}
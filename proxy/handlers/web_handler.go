@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"encoding/base64"
 	"errors"
@@ -10,47 +11,77 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/LubyRuffy/ProxyCraft/proxy"
-	gopsnet "github.com/shirou/gopsutil/v3/net"
-	"github.com/shirou/gopsutil/v3/process"
 )
 
 // TrafficEntry 表示一条流量记录
 type TrafficEntry struct {
-	ID              string      `json:"id"`               // 唯一标识
-	StartTime       time.Time   `json:"startTime"`        // 请求开始时间
-	EndTime         time.Time   `json:"endTime"`          // 响应结束时间
-	Duration        int64       `json:"duration"`         // 耗时（毫秒）
-	Host            string      `json:"host"`             // 主机名
-	HostWithSchema  string      `json:"host_with_schema"` // 主机名（包含协议）
-	Method          string      `json:"method"`           // 请求方法
-	Schema          string      `json:"schema"`           // http/https
-	Protocol        string      `json:"protocol"`         // 协议
-	URL             string      `json:"url"`              // URL
-	Path            string      `json:"path"`             // 路径
-	StatusCode      int         `json:"statusCode"`       // 状态码
-	ContentType     string      `json:"contentType"`      // 内容类型
-	ContentSize     int         `json:"contentSize"`      // 内容大小
-	IsSSE           bool        `json:"isSSE"`            // 是否为SSE请求
-	IsSSECompleted  bool        `json:"isSSECompleted"`   // SSE请求是否已完成
-	IsHTTPS         bool        `json:"isHTTPS"`          // 是否为HTTPS请求
-	IsTimeout       bool        `json:"isTimeout"`        // 是否为超时错误
-	ProcessName     string      `json:"processName"`      // 请求进程名称
-	ProcessIcon     string      `json:"processIcon"`      // 请求进程图标
-	RequestBody     []byte      `json:"-"`                // 请求体
-	ResponseBody    []byte      `json:"-"`                // 响应体
-	RequestHeaders  http.Header `json:"-"`                // 请求头
-	ResponseHeaders http.Header `json:"-"`                // 响应头
-	Error           string      `json:"error,omitempty"`  // 错误信息
+	ID              string      `json:"id"`                  // 唯一标识
+	StartTime       time.Time   `json:"startTime"`           // 请求开始时间
+	EndTime         time.Time   `json:"endTime"`             // 响应结束时间
+	Duration        int64       `json:"duration"`            // 耗时（毫秒）
+	TimeToFirstByte int64       `json:"timeToFirstByte"`     // 请求发送完成到收到响应首字节的耗时（毫秒）
+	TotalDuration   int64       `json:"totalDuration"`       // 请求发送完成到响应体接收完毕的耗时（毫秒）
+	SentTime        time.Time   `json:"-"`                   // 请求发送完成的时间，用于计算TotalDuration
+	Host            string      `json:"host"`                // 主机名
+	HostWithSchema  string      `json:"host_with_schema"`    // 主机名（包含协议）
+	Method          string      `json:"method"`              // 请求方法
+	Schema          string      `json:"schema"`              // http/https
+	Protocol        string      `json:"protocol"`            // 协议
+	URL             string      `json:"url"`                 // URL
+	Path            string      `json:"path"`                // 路径
+	StatusCode      int         `json:"statusCode"`          // 状态码
+	ContentType     string      `json:"contentType"`         // 内容类型
+	ContentSize     int         `json:"contentSize"`         // 内容大小
+	IsSSE           bool        `json:"isSSE"`               // 是否为SSE请求
+	IsSSECompleted  bool        `json:"isSSECompleted"`      // SSE请求是否已完成
+	IsHTTPS         bool        `json:"isHTTPS"`             // 是否为HTTPS请求
+	IsTimeout       bool        `json:"isTimeout"`           // 是否为超时错误
+	ProcessName     string      `json:"processName"`         // 请求进程名称
+	ProcessIcon     string      `json:"processIcon"`         // 请求进程图标
+	RequestBody     []byte      `json:"-"`                   // 请求体
+	ResponseBody    []byte      `json:"-"`                   // 响应体
+	RequestHeaders  http.Header `json:"-"`                   // 请求头
+	ResponseHeaders http.Header `json:"-"`                   // 响应头
+	Error           string      `json:"error,omitempty"`     // 错误信息
+	ErrorKind       string      `json:"errorKind,omitempty"` // 错误分类：dns、connect、tls、timeout、upstream-proxy、canceled、other
+
+	TLSVersion          string `json:"tlsVersion,omitempty"`          // 与客户端协商的TLS版本
+	CipherSuite         string `json:"cipherSuite,omitempty"`         // 与客户端协商的密码套件
+	ALPN                string `json:"alpn,omitempty"`                // 与客户端协商的ALPN协议
+	UpstreamTLSVersion  string `json:"upstreamTLSVersion,omitempty"`  // 与上游服务器协商的TLS版本
+	UpstreamCipherSuite string `json:"upstreamCipherSuite,omitempty"` // 与上游服务器协商的密码套件
+	UpstreamALPN        string `json:"upstreamALPN,omitempty"`        // 与上游服务器协商的ALPN协议
+	ConnectionID        string `json:"connectionId,omitempty"`        // 转发使用的上游连接（本地地址->远端地址）
+	ConnectionReused    bool   `json:"connectionReused"`              // 上游连接是否复用自连接池
+	DetectedContentType string `json:"detectedContentType,omitempty"` // 响应头缺少或只有笼统的Content-Type时根据响应体探测到的类型
+	ConnectHost         string `json:"connectHost,omitempty"`         // MITM隧道CONNECT请求的目标主机
+	SNI                 string `json:"sni,omitempty"`                 // 客户端TLS ClientHello中的SNI
+	SNIMismatch         bool   `json:"sniMismatch,omitempty"`         // SNI与CONNECT主机不一致
+	Chaos               string `json:"chaos,omitempty"`               // -chaos注入的故障：状态码或reset，为空表示正常转发
+	RateLimit           string `json:"rateLimit,omitempty"`           // -rate-limit的处理：排队等待的时间（如"250ms"）或rejected，为空表示未受限
+	Cache               string `json:"cache,omitempty"`               // -cache的处理：hit（由缓存返回）、revalidate或miss（离线模式下未命中），为空表示未使用缓存
+	RedirectFrom        string `json:"redirectFrom,omitempty"`        // 重定向到本条目的上一跳，只在RedirectChain返回的条目中填充
+	RedirectTo          string `json:"redirectTo,omitempty"`          // 本条目重定向到的下一跳，只在RedirectChain返回的条目中填充
+	Anomaly             string `json:"anomaly,omitempty"`             // 超过异常阈值的标记，如"slow,large-response"，见SetAnomalyThresholds
+
+	InformationalResponses []proxy.InformationalResponse `json:"informationalResponses,omitempty"` // 最终响应之前收到的1xx响应，例如103 Early Hints
+
+	SSEEvents []SSEEvent `json:"-"` // 每个SSE事件的到达时间和大小，ResponseBody仍保存聚合的事件内容
+
+	Seq uint64 `json:"seq"` // 变更序号，条目每次更新时单调递增
 }
 
 // NewEntryCallback 定义新条目回调函数类型
@@ -63,24 +94,51 @@ type WebHandler struct {
 	entryMutex       sync.RWMutex             // 保护entries和entriesMap的互斥锁
 	verbose          bool                     // 是否输出详细日志
 	newEntryCallback NewEntryCallback         // 新条目回调函数
+	clearCallback    func()                   // 清空条目后的回调函数
 	callbackMutex    sync.RWMutex             // 保护回调函数的互斥锁
 	maxEntries       int                      // 最大条目数
+	listLimit        int                      // 列表接口返回的最近条目数，为0时与maxEntries相同，见SetListLimit
 	db               *sql.DB                  // SQLite数据库连接
 	dbPath           string                   // SQLite数据库路径
+	seq              uint64                   // 条目变更序号计数器，受entryMutex保护
+	storage          StorageMode              // 条目的存储位置
+	memoryID         int64                    // 内存模式下的ID计数器，受entryMutex保护
+	session          *Session                 // 本次运行的记录，见StartSession，受entryMutex保护
+	bodyStore        *bodyStore               // 较大消息体的文件存储，为nil时消息体保存在SQLite中
+	retention        time.Duration            // 条目的保留时长，为0时只按maxEntries清理
+	deletedRows      atomic.Int64             // 上次回收空间以来从SQLite删除的记录数
+	reclaimMutex     sync.Mutex               // 保护lastReclaim，避免并发执行VACUUM
+	lastReclaim      time.Time                // 上次回收数据库空间的时间
+	noBodies         bool                     // 隐私模式，只保存元数据和头部，见SetNoBodies
+	llmHosts         *proxy.LLMHosts          // 额外声明为LLM服务的主机，见SetLLMHosts
+	anomaly          AnomalyThresholds        // 标记慢请求和大消息体的阈值，见SetAnomalyThresholds
 }
 
-// NewWebHandler 创建一个新的WebHandler
+// NewWebHandler 创建一个新的WebHandler，条目同时保存在SQLite和内存中
 func NewWebHandler(verbose bool, dbPath string) (*WebHandler, error) {
+	return NewWebHandlerWithStorage(verbose, dbPath, StorageBoth)
+}
+
+// NewWebHandlerWithStorage 创建使用指定存储模式的WebHandler，StorageMemory模式下不会创建数据库文件
+func NewWebHandlerWithStorage(verbose bool, dbPath string, storage StorageMode) (*WebHandler, error) {
+	storage, err := ParseStorageMode(string(storage))
+	if err != nil {
+		return nil, err
+	}
+
 	handler := &WebHandler{
 		entries:    make([]*TrafficEntry, 0),
 		entriesMap: make(map[string]*TrafficEntry),
 		verbose:    verbose,
 		maxEntries: 2000, // 默认最多保存2000条记录
 		dbPath:     dbPath,
+		storage:    storage,
 	}
 
-	if err := handler.initSQLite(dbPath); err != nil {
-		return nil, err
+	if storage.usesSQLite() {
+		if err := handler.initSQLite(dbPath); err != nil {
+			return nil, err
+		}
 	}
 
 	// 启动自动清理任务
@@ -95,7 +153,7 @@ func (h *WebHandler) startCleanupTask() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		h.cleanupOldEntries()
+		h.cleanup()
 	}
 }
 
@@ -115,6 +173,55 @@ func (h *WebHandler) SetNewEntryCallback(callback NewEntryCallback) {
 	}
 }
 
+// SetClearCallback 设置清空条目后调用的回调函数，可用于同步重置其他统计
+func (h *WebHandler) SetClearCallback(callback func()) {
+	h.callbackMutex.Lock()
+	h.clearCallback = callback
+	h.callbackMutex.Unlock()
+}
+
+// MaxEntries 返回保留的最大条目数，超出的旧条目会被清理
+func (h *WebHandler) MaxEntries() int {
+	return h.maxEntries
+}
+
+// SetListLimit 设置GetEntries、GetEntriesAfterID和GetEntriesSorted最多返回的最近条目数，内存和SQLite存储都遵守该限制
+// limit不大于0时恢复默认值，即与MaxEntries相同，保存的条目都会返回；超过MaxEntries没有意义，因为更早的条目已被清理
+// 需要在处理流量之前调用
+func (h *WebHandler) SetListLimit(limit int) {
+	h.listLimit = max(limit, 0)
+}
+
+// ListLimit 返回列表接口最多返回的最近条目数
+func (h *WebHandler) ListLimit() int {
+	if h.listLimit > 0 {
+		return h.listLimit
+	}
+	return h.maxEntries
+}
+
+// SetNoBodies 开启隐私模式：不读取、不保存任何请求体和响应体（包括SSE事件内容），大小取自Content-Length
+// 需要在处理流量之前调用；代理侧应同时开启proxy.Server.NoBodies，避免转发前缓存消息体
+func (h *WebHandler) SetNoBodies(noBodies bool) {
+	h.noBodies = noBodies
+}
+
+// NoBodies 返回是否开启了隐私模式，开启时没有可供解析的消息体，LLM提取等功能不可用
+func (h *WebHandler) NoBodies() bool {
+	return h.noBodies
+}
+
+// SetLLMHosts 设置额外声明为LLM服务的主机，匹配的条目即使不是JSON或SSE也会尝试LLM提取
+// 需要在启动API服务之前调用
+func (h *WebHandler) SetLLMHosts(hosts *proxy.LLMHosts) {
+	h.llmHosts = hosts
+}
+
+// LLMHosts 返回SetLLMHosts设置的主机列表，未设置时为nil
+func (h *WebHandler) LLMHosts() *proxy.LLMHosts {
+	return h.llmHosts
+}
+
 // notifyNewEntry 通知有新的流量条目
 func (h *WebHandler) notifyNewEntry(entry *TrafficEntry) {
 	h.callbackMutex.RLock()
@@ -125,42 +232,20 @@ func (h *WebHandler) notifyNewEntry(entry *TrafficEntry) {
 	}
 }
 
-func resolveProcessInfo(remoteAddr string) (string, string) {
-	_, portStr, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
-		return "", ""
-	}
-	port, err := strconv.Atoi(portStr)
-	if err != nil || port == 0 {
-		return "", ""
-	}
+// touchEntryLocked 在持有写锁时为条目分配新的变更序号，并返回用于通知的快照
+// 通知在goroutine中异步发送，到达顺序不确定，订阅方通过Seq丢弃过期的更新
+func (h *WebHandler) touchEntryLocked(entry *TrafficEntry) *TrafficEntry {
+	h.seq++
+	entry.Seq = h.seq
+	return summarizeEntry(entry)
+}
 
-	connections, err := gopsnet.Connections("inet")
-	if err != nil {
+func resolveProcessInfo(remoteAddr string) (string, string) {
+	name, exe := proxy.LookupProcess(remoteAddr)
+	if name == "" {
 		return "", ""
 	}
-
-	for _, conn := range connections {
-		if conn.Laddr.Port != uint32(port) {
-			continue
-		}
-		if conn.Pid == 0 {
-			continue
-		}
-		proc, err := process.NewProcess(conn.Pid)
-		if err != nil {
-			continue
-		}
-		name, err := proc.Name()
-		if err != nil {
-			continue
-		}
-		exe, _ := proc.Exe()
-		icon := resolveProcessIcon(exe)
-		return name, icon
-	}
-
-	return "", ""
+	return name, resolveProcessIcon(exe)
 }
 
 func resolveProcessIcon(exePath string) string {
@@ -365,16 +450,21 @@ func findIconFile(iconName string) string {
 	return ""
 }
 
-// GetEntries 返回所有流量条目
+// GetEntries 返回最近的ListLimit条流量条目
 func (h *WebHandler) GetEntries() []*TrafficEntry {
+	if h.storage == StorageMemory {
+		return h.memoryEntries(h.ListLimit())
+	}
+
 	startTime := time.Now()
-	entries, err := h.loadEntries(1000)
+	entries, err := h.loadEntries(h.ListLimit())
 	if err != nil {
 		if h.verbose {
 			log.Printf("[WebHandler] GetEntries: 查询数据库失败: %v", err)
 		}
 		return []*TrafficEntry{}
 	}
+	h.overlayLiveEntries(entries)
 
 	elapsed := time.Since(startTime)
 	if elapsed > 100*time.Millisecond {
@@ -386,6 +476,10 @@ func (h *WebHandler) GetEntries() []*TrafficEntry {
 
 // GetEntriesAfterID 返回指定ID之后的流量条目，offsetID为空时等同于GetEntries
 func (h *WebHandler) GetEntriesAfterID(offsetID string) []*TrafficEntry {
+	if h.storage == StorageMemory {
+		return h.memoryEntriesAfterID(offsetID, h.ListLimit())
+	}
+
 	startTime := time.Now()
 	entries, err := h.loadEntriesAfterID(offsetID)
 	if err != nil {
@@ -394,6 +488,7 @@ func (h *WebHandler) GetEntriesAfterID(offsetID string) []*TrafficEntry {
 		}
 		return []*TrafficEntry{}
 	}
+	h.overlayLiveEntries(entries)
 
 	elapsed := time.Since(startTime)
 	if elapsed > 100*time.Millisecond {
@@ -419,35 +514,56 @@ func (h *WebHandler) snapshotEntriesLocked(startIndex int, endIndex int) []*Traf
 	result := make([]*TrafficEntry, resultLen)
 
 	for i := 0; i < resultLen; i++ {
-		srcEntry := h.entries[startIndex+i]
-		result[i] = &TrafficEntry{
-			ID:             srcEntry.ID,
-			StartTime:      srcEntry.StartTime,
-			EndTime:        srcEntry.EndTime,
-			Duration:       srcEntry.Duration,
-			Host:           srcEntry.Host,
-			Method:         srcEntry.Method,
-			Schema:         srcEntry.Schema,
-			HostWithSchema: srcEntry.HostWithSchema,
-			URL:            srcEntry.URL,
-			Path:           srcEntry.Path,
-			StatusCode:     srcEntry.StatusCode,
-			ContentType:    srcEntry.ContentType,
-			ContentSize:    srcEntry.ContentSize,
-			Protocol:       srcEntry.Protocol,
-			IsSSE:          srcEntry.IsSSE,
-			IsSSECompleted: srcEntry.IsSSECompleted,
-			IsHTTPS:        srcEntry.IsHTTPS,
-			IsTimeout:      srcEntry.IsTimeout,
-			ProcessName:    srcEntry.ProcessName,
-			ProcessIcon:    srcEntry.ProcessIcon,
-			Error:          srcEntry.Error,
-		}
+		result[i] = summarizeEntry(h.entries[startIndex+i])
 	}
 
 	return result
 }
 
+// overlayLiveEntries 用内存中的最新状态替换数据库查询结果，使返回的条目带有准确的Seq
+func (h *WebHandler) overlayLiveEntries(entries []*TrafficEntry) {
+	h.entryMutex.RLock()
+	defer h.entryMutex.RUnlock()
+
+	for i, entry := range entries {
+		if live, ok := h.entriesMap[entry.ID]; ok {
+			entries[i] = summarizeEntry(live)
+		}
+	}
+}
+
+// summarizeEntry 复制条目的列表字段（不含请求/响应体和头），调用方需持有entryMutex
+func summarizeEntry(srcEntry *TrafficEntry) *TrafficEntry {
+	return &TrafficEntry{
+		ID:              srcEntry.ID,
+		StartTime:       srcEntry.StartTime,
+		EndTime:         srcEntry.EndTime,
+		Duration:        srcEntry.Duration,
+		TimeToFirstByte: srcEntry.TimeToFirstByte,
+		TotalDuration:   srcEntry.TotalDuration,
+		Host:            srcEntry.Host,
+		Method:          srcEntry.Method,
+		Schema:          srcEntry.Schema,
+		HostWithSchema:  srcEntry.HostWithSchema,
+		URL:             srcEntry.URL,
+		Path:            srcEntry.Path,
+		StatusCode:      srcEntry.StatusCode,
+		ContentType:     srcEntry.ContentType,
+		ContentSize:     srcEntry.ContentSize,
+		Protocol:        srcEntry.Protocol,
+		IsSSE:           srcEntry.IsSSE,
+		IsSSECompleted:  srcEntry.IsSSECompleted,
+		IsHTTPS:         srcEntry.IsHTTPS,
+		IsTimeout:       srcEntry.IsTimeout,
+		ProcessName:     srcEntry.ProcessName,
+		ProcessIcon:     srcEntry.ProcessIcon,
+		Error:           srcEntry.Error,
+		ErrorKind:       srcEntry.ErrorKind,
+		Anomaly:         srcEntry.Anomaly,
+		Seq:             srcEntry.Seq,
+	}
+}
+
 // GetEntry 根据ID获取一个特定的流量条目
 func (h *WebHandler) GetEntry(id string) *TrafficEntry {
 	h.entryMutex.RLock()
@@ -471,11 +587,72 @@ func (h *WebHandler) GetEntry(id string) *TrafficEntry {
 // ClearEntries 清空所有流量条目
 func (h *WebHandler) ClearEntries() {
 	h.entryMutex.Lock()
-	defer h.entryMutex.Unlock()
-
 	h.entries = make([]*TrafficEntry, 0)
 	h.entriesMap = make(map[string]*TrafficEntry)
 	_ = h.clearEntriesInDB()
+	h.entryMutex.Unlock()
+
+	h.callbackMutex.RLock()
+	callback := h.clearCallback
+	h.callbackMutex.RUnlock()
+	if callback != nil {
+		callback()
+	}
+}
+
+// DeleteEntries 删除满足filter的条目，SQLite与内存中的副本在同一次操作中删除，返回被删除条目的ID
+// filter不能为空，清空全部条目请使用ClearEntries
+func (h *WebHandler) DeleteEntries(filter EntryFilter) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, errors.New("empty filter: use ClearEntries to delete all entries")
+	}
+
+	h.entryMutex.Lock()
+	deleted := make(map[string]bool)
+	if h.storage.usesSQLite() {
+		ids, err := h.deleteEntriesInDB(filter)
+		if err != nil {
+			h.entryMutex.Unlock()
+			return nil, err
+		}
+		for _, id := range ids {
+			deleted[id] = true
+		}
+	}
+	kept := h.entries[:0]
+	for _, entry := range h.entries {
+		if deleted[entry.ID] || filter.Matches(entry) {
+			deleted[entry.ID] = true
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	for i := len(kept); i < len(h.entries); i++ {
+		h.entries[i] = nil
+	}
+	h.entries = kept
+	for id, entry := range h.entriesMap {
+		if deleted[id] || filter.Matches(entry) {
+			deleted[id] = true
+			delete(h.entriesMap, id)
+		}
+	}
+	h.entryMutex.Unlock()
+
+	if h.storage.usesSQLite() && len(deleted) > 0 {
+		h.pruneBodyStore()
+	}
+
+	ids := make([]string, 0, len(deleted))
+	for id := range deleted {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseInt(ids[i], 10, 64)
+		b, _ := strconv.ParseInt(ids[j], 10, 64)
+		return a < b
+	})
+	return ids, nil
 }
 
 // OnRequest 实现 EventHandler 接口
@@ -483,7 +660,13 @@ func (h *WebHandler) OnRequest(ctx *proxy.RequestContext) *http.Request {
 	// 检查是否需要清理
 	entriesLen := len(h.entries)
 	if entriesLen > h.maxEntries {
-		go h.cleanupOldEntries()
+		go h.cleanup()
+	}
+
+	// Schema、HostWithSchema和Path取自规范化后的TargetURL，MITM隧道中origin-form请求的URL没有scheme和主机
+	schema, hostWithSchema, path := ctx.Request.URL.Scheme, ctx.Request.URL.Scheme+"://"+ctx.Request.Host, ctx.Request.URL.Path
+	if target, err := url.Parse(ctx.TargetURL); err == nil && target.Host != "" {
+		schema, hostWithSchema, path = target.Scheme, target.Scheme+"://"+target.Host, target.Path
 	}
 
 	// 准备新的流量条目，尽可能在锁外完成
@@ -491,11 +674,11 @@ func (h *WebHandler) OnRequest(ctx *proxy.RequestContext) *http.Request {
 		StartTime:      ctx.StartTime,
 		Host:           ctx.Request.Host,
 		Method:         ctx.Request.Method,
-		Schema:         ctx.Request.URL.Scheme,
-		HostWithSchema: ctx.Request.URL.Scheme + "://" + ctx.Request.Host,
+		Schema:         schema,
+		HostWithSchema: hostWithSchema,
 		Protocol:       ctx.Request.Proto,
 		URL:            ctx.TargetURL,
-		Path:           ctx.Request.URL.Path,
+		Path:           path,
 		IsHTTPS:        ctx.IsHTTPS,
 		IsSSE:          ctx.IsSSE,
 		IsSSECompleted: false, // 初始化为false，当SSE流结束时会设置为true
@@ -503,38 +686,78 @@ func (h *WebHandler) OnRequest(ctx *proxy.RequestContext) *http.Request {
 	}
 
 	entry.ProcessName, entry.ProcessIcon = resolveProcessInfo(ctx.Request.RemoteAddr)
-
-	// 保存请求体
-	if body, err := ctx.GetRequestBody(); err == nil {
-		// 如果请求体过大，只保存部分
-		if len(body) > 10*1024*1024 { // 超过10MB
-			if h.verbose {
-				log.Printf("[WebHandler] 请求体过大 (%d bytes)，只保存前10MB", len(body))
-			}
-			entry.RequestBody = append(body[:10*1024*1024], []byte("... [截断过大的请求体] ...")...)
-		} else {
-			entry.RequestBody = bytes.Clone(body)
+	entry.TLSVersion, entry.CipherSuite, entry.ALPN = describeTLS(ctx.Request.TLS)
+	entry.ConnectHost, entry.SNI, entry.SNIMismatch = ctx.ConnectHost, ctx.ClientSNI, ctx.SNIMismatch
+	entry.Chaos = ctx.ChaosFault
+	entry.RateLimit = ctx.RateLimit
+	entry.Cache = ctx.Cache
+
+	// 保存请求体，隐私模式下不读取，请求体大小可以从请求头的Content-Length得知
+	if !h.noBodies {
+		if body, err := ctx.GetRequestBody(); err == nil {
+			entry.RequestBody = h.limitRequestBody(body)
 		}
 	}
 
-	id, err := h.insertEntry(entry)
-	if err != nil {
-		if h.verbose {
-			log.Printf("[WebHandler] 保存请求到数据库失败: %v", err)
-		}
+	if ctx.UserData == nil {
+		ctx.UserData = make(map[string]interface{})
+	}
+
+	// 未被抽中的请求先暂存，等响应确认是否需要保存
+	if ctx.SampledOut {
+		ctx.UserData["traffic_pending"] = entry
 		return ctx.Request
 	}
-	entry.ID = id
+
+	h.storeEntry(ctx, entry)
+	return ctx.Request
+}
+
+// admitPending 处理未被抽中而暂存的条目：skip为true时丢弃，否则保存并返回true
+// 没有暂存条目时返回true
+func (h *WebHandler) admitPending(ctx *proxy.RequestContext, skip bool) bool {
+	if ctx == nil || ctx.UserData == nil {
+		return true
+	}
+	pending, ok := ctx.UserData["traffic_pending"].(*TrafficEntry)
+	if !ok {
+		return true
+	}
+	delete(ctx.UserData, "traffic_pending")
+	if skip {
+		return false
+	}
+	h.storeEntry(ctx, pending)
+	return true
+}
+
+// storeEntry 保存新的请求条目并通知订阅方
+func (h *WebHandler) storeEntry(ctx *proxy.RequestContext, entry *TrafficEntry) {
+	if h.storage.usesSQLite() {
+		id, err := h.insertEntry(entry)
+		if err != nil {
+			if h.verbose {
+				log.Printf("[WebHandler] 保存请求到数据库失败: %v", err)
+			}
+			return
+		}
+		entry.ID = id
+	}
 
 	h.entryMutex.Lock()
-	h.entries = append(h.entries, entry)
+	if h.storage == StorageMemory {
+		entry.ID = h.nextMemoryIDLocked()
+	}
+	id := entry.ID
+	// StorageSQLite模式下只在map中跟踪进行中的条目，完成后由releaseEntry释放
+	if h.storage.keepsCompleted() {
+		h.entries = append(h.entries, entry)
+	}
 	h.entriesMap[id] = entry
+	snapshot := h.touchEntryLocked(entry)
 	h.entryMutex.Unlock()
 
 	// 存储ID到上下文中，以便在OnResponse中使用
-	if ctx.UserData == nil {
-		ctx.UserData = make(map[string]interface{})
-	}
 	ctx.UserData["traffic_id"] = id
 
 	if h.verbose {
@@ -542,13 +765,26 @@ func (h *WebHandler) OnRequest(ctx *proxy.RequestContext) *http.Request {
 	}
 
 	// 通知有新的流量条目(请求开始)
-	go h.notifyNewEntry(entry)
+	go h.notifyNewEntry(snapshot)
+}
 
-	return ctx.Request
+// limitRequestBody 复制要保存的请求体，过大时只保存前10MB
+func (h *WebHandler) limitRequestBody(body []byte) []byte {
+	if len(body) > 10*1024*1024 { // 超过10MB
+		if h.verbose {
+			log.Printf("[WebHandler] 请求体过大 (%d bytes)，只保存前10MB", len(body))
+		}
+		return append(bytes.Clone(body[:10*1024*1024]), []byte("... [截断过大的请求体] ...")...)
+	}
+	return bytes.Clone(body)
 }
 
 // OnResponse 实现 EventHandler 接口
 func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
+	if !h.admitPending(ctx.ReqCtx, ctx.SkipRecord) {
+		return ctx.Response
+	}
+
 	// 从上下文中获取ID
 	var id string
 	if ctx.ReqCtx != nil && ctx.ReqCtx.UserData != nil {
@@ -577,8 +813,6 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 	}
 
 	// 准备更新的数据
-	endTime := time.Now()
-	duration := endTime.Sub(entry.StartTime).Milliseconds()
 	isHTTPS := ctx.ReqCtx.IsHTTPS
 
 	var statusCode int
@@ -586,10 +820,12 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 	var contentSize int
 	var responseHeaders http.Header
 	var responseBody []byte
+	var upstreamTLSVersion, upstreamCipherSuite, upstreamALPN string
 
 	// 处理响应数据
 	if ctx.Response != nil {
 		statusCode = ctx.Response.StatusCode
+		upstreamTLSVersion, upstreamCipherSuite, upstreamALPN = describeTLS(ctx.Response.TLS)
 		responseHeaders = ctx.Response.Header.Clone()
 
 		// 检查是否是SSE响应，对SSE响应做特殊处理
@@ -600,6 +836,24 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 			if h.verbose {
 				log.Printf("[WebHandler] Skipping body read for SSE response: %s", entry.URL)
 			}
+		} else if proxy.ResponseHasNoBody(ctx.Response) {
+			// HEAD、204、304等响应没有响应体，不能用Content-Length推断大小
+			contentType = ctx.Response.Header.Get("Content-Type")
+			contentSize = 0
+		} else if ctx.SkipBody || h.noBodies {
+			// ShouldCaptureBody决定不保存响应体或处于隐私模式，只记录元数据，大小取自Content-Length
+			contentType = ctx.Response.Header.Get("Content-Type")
+			contentSize = -1
+			if ctx.Response.ContentLength >= 0 {
+				contentSize = int(ctx.Response.ContentLength)
+			} else if contentLenStr := ctx.Response.Header.Get("Content-Length"); contentLenStr != "" {
+				if contentLen, err := strconv.Atoi(contentLenStr); err == nil {
+					contentSize = contentLen
+				}
+			}
+			if h.verbose {
+				log.Printf("[WebHandler] Skipping body capture by predicate: %s", entry.URL)
+			}
 		} else {
 			// 非SSE响应，读取响应体
 			if ctx.Response.Body != nil {
@@ -668,6 +922,28 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 		}
 	}
 
+	detectedContentType := ""
+	if !ctx.IsSSE {
+		detectedContentType = SniffContentType(contentType, responseBody)
+	}
+
+	// 响应体已读取完毕（SSE为收到响应头），以此作为结束时间
+	endTime := time.Now()
+	duration := endTime.Sub(entry.StartTime).Milliseconds()
+	sentTime := requestSentTime(ctx.ReqCtx, entry)
+	timeToFirstByte := int64(0)
+	if !ctx.FirstByteTime.IsZero() {
+		timeToFirstByte = max(ctx.FirstByteTime.Sub(sentTime).Milliseconds(), 0)
+	}
+
+	// Expect: 100-continue的请求体在转发时才读取，OnRequest中拿不到，此时补充保存
+	var requestBody []byte
+	if req := ctx.ReqCtx.Request; req != nil && !h.noBodies && strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+		if body, err := ctx.ReqCtx.GetRequestBody(); err == nil && len(body) > 0 {
+			requestBody = h.limitRequestBody(body)
+		}
+	}
+
 	// 所有数据准备好后，再获取写锁更新条目
 	h.entryMutex.Lock()
 
@@ -684,9 +960,13 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 	// 更新条目信息
 	entry.EndTime = endTime
 	entry.Duration = duration
+	entry.SentTime = sentTime
+	entry.TimeToFirstByte = timeToFirstByte
+	entry.TotalDuration = totalDuration(sentTime, endTime)
 	entry.IsHTTPS = isHTTPS
 	entry.StatusCode = statusCode
 	entry.ContentType = contentType
+	entry.DetectedContentType = detectedContentType
 	entry.ContentSize = contentSize
 	if responseHeaders != nil {
 		entry.ResponseHeaders = responseHeaders
@@ -694,6 +974,22 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 	if responseBody != nil {
 		entry.ResponseBody = responseBody
 	}
+	if requestBody != nil {
+		entry.RequestBody = requestBody
+	}
+	entry.UpstreamTLSVersion = upstreamTLSVersion
+	entry.UpstreamCipherSuite = upstreamCipherSuite
+	entry.UpstreamALPN = upstreamALPN
+	if ctx.ReqCtx != nil {
+		entry.ConnectionID = ctx.ReqCtx.UpstreamConnID
+		entry.ConnectionReused = ctx.ReqCtx.UpstreamConnReused
+		entry.InformationalResponses = ctx.ReqCtx.InformationalResponses
+	}
+	// SSE在流结束时再按最终的耗时和大小检查
+	if !ctx.IsSSE {
+		h.markAnomalyLocked(entry)
+	}
+	snapshot := h.touchEntryLocked(entry)
 
 	// 释放锁
 	h.entryMutex.Unlock()
@@ -701,15 +997,22 @@ func (h *WebHandler) OnResponse(ctx *proxy.ResponseContext) *http.Response {
 	if err := h.updateResponse(entry); err != nil && h.verbose {
 		log.Printf("[WebHandler] 保存响应到数据库失败: %v", err)
 	}
+	// SSE响应后续还会通过OnSSE更新
+	if !ctx.IsSSE {
+		h.releaseEntry(id)
+	}
 
 	// 通知有新的完整流量条目(请求+响应)
-	go h.notifyNewEntry(entry)
+	go h.notifyNewEntry(snapshot)
 
 	return ctx.Response
 }
 
 // OnError 实现 EventHandler 接口
 func (h *WebHandler) OnError(err error, reqCtx *proxy.RequestContext) {
+	// 出错的请求即使未被抽中也会保存
+	h.admitPending(reqCtx, false)
+
 	// 从上下文中获取ID
 	var id string
 	if reqCtx != nil && reqCtx.UserData != nil {
@@ -740,6 +1043,7 @@ func (h *WebHandler) OnError(err error, reqCtx *proxy.RequestContext) {
 	// 准备更新的数据
 	errorMsg := err.Error()
 	isTimeout := isTimeoutError(err)
+	errorKind := string(proxy.ClassifyError(err))
 	endTime := time.Now()
 	duration := endTime.Sub(entry.StartTime).Milliseconds()
 
@@ -758,11 +1062,15 @@ func (h *WebHandler) OnError(err error, reqCtx *proxy.RequestContext) {
 
 	// 更新错误信息
 	entry.Error = errorMsg
+	entry.ErrorKind = errorKind
 	if isTimeout {
 		entry.IsTimeout = true
 	}
 	entry.EndTime = endTime
 	entry.Duration = duration
+	entry.SentTime = requestSentTime(reqCtx, entry)
+	entry.TotalDuration = totalDuration(entry.SentTime, endTime)
+	snapshot := h.touchEntryLocked(entry)
 
 	h.entryMutex.Unlock()
 
@@ -773,9 +1081,34 @@ func (h *WebHandler) OnError(err error, reqCtx *proxy.RequestContext) {
 	if err := h.updateError(entry); err != nil && h.verbose {
 		log.Printf("[WebHandler] 保存错误到数据库失败: %v", err)
 	}
+	h.releaseEntry(id)
 
 	// 通知有新的条目更新
-	go h.notifyNewEntry(entry)
+	go h.notifyNewEntry(snapshot)
+}
+
+// describeTLS 返回TLS连接的版本、密码套件和ALPN协议，非TLS连接返回空字符串
+func describeTLS(state *tls.ConnectionState) (string, string, string) {
+	if state == nil {
+		return "", "", ""
+	}
+	return tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.NegotiatedProtocol
+}
+
+// requestSentTime 返回请求发送完成的时间，代理未提供时退回到条目的开始时间
+func requestSentTime(ctx *proxy.RequestContext, entry *TrafficEntry) time.Time {
+	if ctx != nil && !ctx.SentTime.IsZero() {
+		return ctx.SentTime
+	}
+	return entry.StartTime
+}
+
+// totalDuration 返回从请求发送完成到endTime的毫秒数
+func totalDuration(sentTime, endTime time.Time) int64 {
+	if sentTime.IsZero() {
+		return 0
+	}
+	return max(endTime.Sub(sentTime).Milliseconds(), 0)
 }
 
 func isTimeoutError(err error) bool {
@@ -801,7 +1134,11 @@ func (h *WebHandler) OnTunnelEstablished(host string, isIntercepted bool) {
 }
 
 // OnSSE 实现 EventHandler 接口
-func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
+func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) string {
+	if ctx != nil && ctx.SkipRecord {
+		return ""
+	}
+
 	// 从上下文中获取ID
 	var id string
 	if ctx != nil && ctx.ReqCtx != nil && ctx.ReqCtx.UserData != nil {
@@ -814,7 +1151,7 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 		if h.verbose {
 			log.Println("[WebHandler] Warning: SSE event without request ID")
 		}
-		return
+		return ""
 	}
 
 	// 首先获取对应的entry引用，但不修改数据
@@ -826,7 +1163,7 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 		if h.verbose {
 			log.Printf("[WebHandler] Warning: No entry found for SSE event, ID %s", id)
 		}
-		return
+		return ""
 	}
 
 	// 检查是否是特殊的SSE完成事件
@@ -841,7 +1178,7 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 			if h.verbose {
 				log.Printf("[WebHandler] Entry disappeared during SSE completion, ID %s", id)
 			}
-			return
+			return ""
 		}
 
 		// 标记SSE已完成
@@ -849,24 +1186,33 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 		endTime := time.Now()
 		entry.EndTime = endTime
 		entry.Duration = endTime.Sub(entry.StartTime).Milliseconds()
+		entry.TotalDuration = totalDuration(entry.SentTime, endTime)
+		h.markAnomalyLocked(entry)
 
 		// 始终输出日志，不受verbose控制
 		log.Printf("[WebHandler] 标记SSE流已完成，ID: %s, IsSSECompleted: %v", id, entry.IsSSECompleted)
+		snapshot := h.touchEntryLocked(entry)
 
 		h.entryMutex.Unlock()
 
 		if err := h.updateSSE(entry); err != nil && h.verbose {
 			log.Printf("[WebHandler] 保存SSE完成到数据库失败: %v", err)
 		}
+		h.releaseEntry(id)
 
 		// 通知有新的完整流量条目(请求+响应)
 		log.Printf("[WebHandler] 广播更新的SSE条目，ID: %s, IsSSECompleted: %v", id, true)
-		go h.notifyNewEntry(entry)
+		go h.notifyNewEntry(snapshot)
 
 		if h.verbose {
 			log.Printf("[WebHandler] SSE stream completed for entry ID %s", id)
 		}
-		return
+		return ""
+	}
+
+	// 不保存响应体时SSE事件内容也不记录，只在流结束时标记完成
+	if h.noBodies || ctx.SkipBody {
+		return ""
 	}
 
 	completionEvent := isSSECompletionEvent(event)
@@ -888,7 +1234,7 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 		if h.verbose {
 			log.Printf("[WebHandler] Entry disappeared during SSE processing, ID %s", id)
 		}
-		return
+		return ""
 	}
 
 	// 动态更新ResponseBody，累积记录SSE事件内容
@@ -908,17 +1254,24 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 		entry.ResponseBody = append(entry.ResponseBody, eventBytes...)
 	}
 
+	if len(entry.SSEEvents) < maxSSEEventTimings {
+		entry.SSEEvents = append(entry.SSEEvents, newSSEEvent(eventText, entry.StartTime, endTime))
+	}
+
 	// 更新其他字段
 	entry.ContentSize = len(entry.ResponseBody)
 	entry.ContentType = "text/event-stream"
 	entry.EndTime = endTime
 	entry.Duration = duration
+	entry.TotalDuration = totalDuration(entry.SentTime, endTime)
 	if completionEvent {
 		entry.IsSSECompleted = true
+		h.markAnomalyLocked(entry)
 		if h.verbose {
 			log.Printf("[WebHandler] 识别SSE完成事件，ID: %s, IsSSECompleted: %v", id, entry.IsSSECompleted)
 		}
 	}
+	snapshot := h.touchEntryLocked(entry)
 
 	h.entryMutex.Unlock()
 
@@ -927,12 +1280,13 @@ func (h *WebHandler) OnSSE(event string, ctx *proxy.ResponseContext) {
 	}
 
 	// 通知有新的完整流量条目(请求+响应)
-	go h.notifyNewEntry(entry)
+	go h.notifyNewEntry(snapshot)
 
 	if h.verbose {
 		log.Printf("[WebHandler] SSE event: %s, updated entry ID %s, total size %d bytes",
 			event, id, entry.ContentSize)
 	}
+	return ""
 }
 
 func isSSECompletionEvent(event string) bool {
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_MarksAnomalies(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	webHandler.SetAnomalyThresholds(AnomalyThresholds{Slow: 100 * time.Millisecond, Large: 1024})
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	for _, path := range []string{"/fast", "/slow", "/upload"} {
+		var body io.Reader
+		method := http.MethodGet
+		if path == "/upload" {
+			method, body = http.MethodPost, strings.NewReader(strings.Repeat("x", 4096))
+		}
+		req, err := http.NewRequest(method, backend.URL+path, body)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 3)
+	anomalies := map[string]string{}
+	for _, entry := range entries {
+		anomalies[entry.Path] = entry.Anomaly
+	}
+	assert.Equal(t, map[string]string{"/fast": "", "/slow": AnomalySlow, "/upload": AnomalyLargeRequest}, anomalies)
+
+	// 列表接口返回的摘要中包含异常标记
+	data, err := json.Marshal(entries[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"anomaly":"slow"`)
+	data, err = json.Marshal(entries[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"anomaly"`)
+}
+
+func TestAnomalyThresholdsDetect(t *testing.T) {
+	thresholds := AnomalyThresholds{Slow: time.Second, Large: 100}
+	assert.Equal(t, "", thresholds.Detect(time.Second, 100, -1))
+	assert.Equal(t, "slow,large-request,large-response", thresholds.Detect(2*time.Second, 101, 101))
+	assert.Equal(t, "", AnomalyThresholds{}.Detect(time.Hour, 1<<30, 1<<30))
+	assert.False(t, AnomalyThresholds{}.Enabled())
+}
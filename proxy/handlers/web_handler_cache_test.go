@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_RecordsCache(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("cached"))
+	}))
+	defer backend.Close()
+
+	cache, err := proxy.NewResponseCache(t.TempDir(), false)
+	require.NoError(t, err)
+	webHandler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, Cache: cache, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	for range 2 {
+		resp, err := client.Get(backend.URL + "/asset")
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, "cached", string(body))
+	}
+
+	// 第二个请求由缓存返回
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 2)
+	first, second := webHandler.GetEntry(entries[0].ID), webHandler.GetEntry(entries[1].ID)
+	require.NotNil(t, first)
+	require.NotNil(t, second)
+	assert.Empty(t, first.Cache)
+	assert.Equal(t, proxy.CacheHit, second.Cache)
+	assert.Equal(t, http.StatusOK, second.StatusCode)
+	assert.Equal(t, "HIT", second.ResponseHeaders.Get(proxy.CacheHeader))
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_OnResponseSkipBody(t *testing.T) {
+	handler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "http://example.com/clip.mp4", nil)
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: "http://example.com/clip.mp4",
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+
+	videoBody := []byte("fake video bytes")
+	resp := &http.Response{
+		StatusCode:    200,
+		Header:        http.Header{"Content-Type": []string{"video/mp4"}},
+		Body:          io.NopCloser(bytes.NewReader(videoBody)),
+		ContentLength: int64(len(videoBody)),
+	}
+	handler.OnResponse(&proxy.ResponseContext{
+		Response: resp,
+		ReqCtx:   reqCtx,
+		SkipBody: true,
+	})
+
+	id := reqCtx.UserData["traffic_id"].(string)
+	entry := handler.GetEntry(id)
+	require.NotNil(t, entry)
+	assert.Empty(t, entry.ResponseBody)
+	assert.Equal(t, len(videoBody), entry.ContentSize)
+	assert.Equal(t, "video/mp4", entry.ContentType)
+
+	// 响应体未被消费，仍可转发给客户端
+	remaining, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, videoBody, remaining)
+}
+
+func TestWebHandler_RecordsExpectContinueRequestBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("stored"))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyURL(proxyURL),
+		ExpectContinueTimeout: 10 * time.Second,
+	}}
+	req, err := http.NewRequest(http.MethodPut, backend.URL+"/upload", bytes.NewBufferString("uploaded content"))
+	require.NoError(t, err)
+	req.Header.Set("Expect", "100-continue")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(entries[0].ID), stored} {
+		require.NotNil(t, entry)
+		assert.Equal(t, "uploaded content", string(entry.RequestBody))
+	}
+}
+
+func TestWebHandler_SkipsVideoBodyByContentType(t *testing.T) {
+	video := bytes.Repeat([]byte{0x00, 0x00, 0x00, 0x18, 'f', 't', 'y', 'p'}, 512)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Length", strconv.Itoa(len(video)))
+		_, _ = w.Write(video)
+	}))
+	defer backend.Close()
+
+	rules, err := proxy.ParseSkipBodyRules("video/,audio/,application/octet-stream>1MB")
+	require.NoError(t, err)
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{
+		EventHandler:      webHandler,
+		ShouldCaptureBody: proxy.SkipBodyContentTypes(rules),
+		LogWriter:         io.Discard,
+	})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(backend.URL + "/clip.mp4")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	// 客户端仍收到完整的响应体
+	assert.Equal(t, video, body)
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(entries[0].ID), stored} {
+		require.NotNil(t, entry)
+		assert.Equal(t, "video/mp4", entry.ContentType)
+		assert.Equal(t, len(video), entry.ContentSize)
+		assert.Empty(t, entry.ResponseBody)
+	}
+}
+
+func TestWebHandler_RecordsEarlyHints(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", "</style.css>; rel=preload; as=style")
+		w.Header().Add("Link", "</app.js>; rel=preload; as=script")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		_, _ = w.Write([]byte("page"))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Get(backend.URL + "/page")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(entries[0].ID), stored} {
+		require.NotNil(t, entry)
+		require.Len(t, entry.InformationalResponses, 1)
+		hint := entry.InformationalResponses[0]
+		assert.Equal(t, http.StatusEarlyHints, hint.StatusCode)
+		assert.Equal(t, []string{"</style.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script"}, hint.Header.Values("Link"))
+		assert.False(t, hint.Time.IsZero())
+		assert.Equal(t, http.StatusOK, entry.StatusCode)
+		assert.Empty(t, entry.ResponseHeaders.Values("Link"))
+	}
+}
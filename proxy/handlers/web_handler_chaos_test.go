@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_RecordsChaosFault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	chaos, err := proxy.ParseChaos("1,502")
+	require.NoError(t, err)
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, Chaos: chaos, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Get(backend.URL + "/flaky")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(entries[0].ID), stored} {
+		require.NotNil(t, entry)
+		assert.Equal(t, "502", entry.Chaos)
+		assert.Equal(t, http.StatusBadGateway, entry.StatusCode)
+	}
+}
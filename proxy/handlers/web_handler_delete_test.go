@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordStatusEntry 记录一个指定URL和状态码的完整请求/响应，返回条目ID
+func recordStatusEntry(t *testing.T, handler *WebHandler, rawURL string, status int, start time.Time) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", rawURL, nil)
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: start,
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+	handler.OnResponse(&proxy.ResponseContext{
+		ReqCtx: reqCtx,
+		Response: &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       io.NopCloser(bytes.NewBufferString("payload")),
+		},
+	})
+	id, ok := reqCtx.UserData["traffic_id"].(string)
+	require.True(t, ok)
+	return id
+}
+
+func testDeleteEntriesByHost(t *testing.T, handler *WebHandler) {
+	now := time.Now()
+	keep1 := recordStatusEntry(t, handler, "http://keep.example.com/a", http.StatusOK, now)
+	drop1 := recordStatusEntry(t, handler, "http://noise.example.com/a", http.StatusOK, now)
+	keep2 := recordStatusEntry(t, handler, "http://keep.example.com/b", http.StatusNotFound, now)
+	drop2 := recordStatusEntry(t, handler, "http://NOISE.example.com/b", http.StatusInternalServerError, now)
+
+	ids, err := handler.DeleteEntries(EntryFilter{Host: "noise.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{drop1, drop2}, ids)
+
+	assert.Equal(t, []string{keep1, keep2}, entryIDs(handler.GetEntries()))
+	assert.Nil(t, handler.GetEntry(drop1))
+	assert.NotNil(t, handler.GetEntry(keep2))
+
+	// 主机与状态码条件同时满足才删除
+	ids, err = handler.DeleteEntries(EntryFilter{Host: "keep.example.com", StatusMin: 400, StatusMax: 499})
+	require.NoError(t, err)
+	assert.Equal(t, []string{keep2}, ids)
+
+	ids, err = handler.DeleteEntries(EntryFilter{Before: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.Equal(t, []string{keep1}, entryIDs(handler.GetEntries()))
+
+	_, err = handler.DeleteEntries(EntryFilter{})
+	assert.Error(t, err)
+}
+
+func TestWebHandler_DeleteEntriesByHostMemory(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	testDeleteEntriesByHost(t, handler)
+}
+
+func TestWebHandler_DeleteEntriesByHostSQLite(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "traffic.db"), StorageBoth)
+	require.NoError(t, err)
+	testDeleteEntriesByHost(t, handler)
+}
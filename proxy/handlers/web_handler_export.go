@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportPageSize 是流式导出时每次从SQLite读取的条目数
+const exportPageSize = 200
+
+// EntryFilter 是导出或删除条目时的过滤条件，字段为空表示不过滤
+type EntryFilter struct {
+	Host        string    // 主机名，不区分大小写完全匹配
+	ContentType string    // 响应Content-Type前缀，不区分大小写，例如 "application/json"
+	Before      time.Time // 只匹配开始时间早于该时间的条目
+	StatusMin   int       // 状态码范围下限，与StatusMax同时为0时不过滤，尚未收到响应的条目不匹配
+	StatusMax   int       // 状态码范围上限（含）
+	ErrorKind   string    // 错误分类，例如 "timeout"，只匹配该类错误的条目
+}
+
+// IsEmpty 判断过滤条件是否为空，即匹配所有条目
+func (f EntryFilter) IsEmpty() bool {
+	return f == EntryFilter{}
+}
+
+// Matches 判断条目是否满足过滤条件，与SQLite查询中的条件语义一致
+func (f EntryFilter) Matches(entry *TrafficEntry) bool {
+	if f.Host != "" && !strings.EqualFold(entry.Host, f.Host) {
+		return false
+	}
+	if f.ContentType != "" && !strings.HasPrefix(strings.ToLower(entry.ContentType), strings.ToLower(f.ContentType)) {
+		return false
+	}
+	if !f.Before.IsZero() && !entry.StartTime.Before(f.Before) {
+		return false
+	}
+	if f.ErrorKind != "" && entry.ErrorKind != f.ErrorKind {
+		return false
+	}
+	if f.StatusMin != 0 || f.StatusMax != 0 {
+		if entry.StatusCode == 0 || entry.StatusCode < f.StatusMin || entry.StatusCode > f.StatusMax {
+			return false
+		}
+	}
+	return true
+}
+
+// whereClause 返回SQLite查询的附加条件和参数，以 " AND ..." 形式拼接在已有条件之后
+func (f EntryFilter) whereClause() (string, []interface{}) {
+	var clause strings.Builder
+	var args []interface{}
+	if f.Host != "" {
+		clause.WriteString(" AND host = ? COLLATE NOCASE")
+		args = append(args, f.Host)
+	}
+	if f.ContentType != "" {
+		clause.WriteString(" AND lower(content_type) LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLike(strings.ToLower(f.ContentType))+"%")
+	}
+	if !f.Before.IsZero() {
+		clause.WriteString(" AND start_time < ?")
+		args = append(args, toMillis(f.Before))
+	}
+	if f.StatusMin != 0 || f.StatusMax != 0 {
+		clause.WriteString(" AND status_code BETWEEN ? AND ?")
+		args = append(args, f.StatusMin, f.StatusMax)
+	}
+	if f.ErrorKind != "" {
+		clause.WriteString(" AND error_kind = ?")
+		args = append(args, f.ErrorKind)
+	}
+	return clause.String(), args
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// EachEntry 按ID升序依次把满足filter的条目摘要（不含请求/响应体和头）交给fn，fn返回错误时停止并返回该错误
+// SQLite模式下分页读取，不会把全部记录一次性加载到内存，也不会在fn执行期间占用数据库游标
+func (h *WebHandler) EachEntry(filter EntryFilter, fn func(*TrafficEntry) error) error {
+	if h.storage == StorageMemory {
+		for _, entry := range h.memoryEntries(h.maxEntries) {
+			if filter.Matches(entry) {
+				if err := fn(entry); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	var afterID int64
+	for {
+		entries, err := h.loadEntriesPage(afterID, exportPageSize, filter)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		h.overlayLiveEntries(entries)
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		afterID, _ = strconv.ParseInt(entries[len(entries)-1].ID, 10, 64)
+	}
+}
+
+// loadEntriesPage 读取ID大于afterID且满足filter的最多limit条记录，按ID升序
+func (h *WebHandler) loadEntriesPage(afterID int64, limit int, filter EntryFilter) ([]*TrafficEntry, error) {
+	if h.db == nil {
+		return []*TrafficEntry{}, nil
+	}
+
+	where, args := filter.whereClause()
+	rows, err := h.db.Query(
+		`SELECT id, start_time, end_time, duration, host, host_with_schema, method, schema, protocol, url, path,
+			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, error,
+			time_to_first_byte, total_duration, anomaly, error_kind
+		FROM traffic_entries WHERE id > ?`+where+` ORDER BY id ASC LIMIT ?`,
+		append(append([]interface{}{afterID}, args...), limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*TrafficEntry, 0)
+	for rows.Next() {
+		entry, err := scanEntryRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
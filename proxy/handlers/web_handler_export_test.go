@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_EachEntryPages(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "traffic.db"), StorageSQLite)
+	require.NoError(t, err)
+
+	ids := recordTransactions(t, handler, exportPageSize+5)
+
+	var seen []string
+	require.NoError(t, handler.EachEntry(EntryFilter{}, func(entry *TrafficEntry) error {
+		seen = append(seen, entry.ID)
+		return nil
+	}))
+	assert.Equal(t, ids, seen)
+
+	stop := errors.New("stop")
+	count := 0
+	err = handler.EachEntry(EntryFilter{ContentType: "TEXT/"}, func(entry *TrafficEntry) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 3, count)
+
+	require.NoError(t, handler.EachEntry(EntryFilter{Host: "other.example.com"}, func(*TrafficEntry) error {
+		t.Fatal("unexpected entry")
+		return nil
+	}))
+}
+
+func TestEntryFilterMatches(t *testing.T) {
+	entry := &TrafficEntry{Host: "api.example.com", ContentType: "application/json; charset=utf-8"}
+	assert.True(t, EntryFilter{}.Matches(entry))
+	assert.True(t, EntryFilter{Host: "API.example.com", ContentType: "application/json"}.Matches(entry))
+	assert.False(t, EntryFilter{Host: "example.com"}.Matches(entry))
+	assert.False(t, EntryFilter{ContentType: "text/"}.Matches(entry))
+
+	entry.StartTime = time.Now()
+	entry.StatusCode = http.StatusNotFound
+	assert.True(t, EntryFilter{Before: entry.StartTime.Add(time.Second), StatusMin: 400, StatusMax: 499}.Matches(entry))
+	assert.False(t, EntryFilter{Before: entry.StartTime}.Matches(entry))
+	assert.False(t, EntryFilter{StatusMin: 500, StatusMax: 599}.Matches(entry))
+	// 尚未收到响应的条目不匹配状态码条件
+	assert.False(t, EntryFilter{StatusMin: 400, StatusMax: 499}.Matches(&TrafficEntry{}))
+}
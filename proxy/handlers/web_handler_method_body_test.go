@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 部分API（如Elasticsearch）在GET/DELETE上携带请求体，需要与POST一样转发并记录
+func TestWebHandler_CapturesBodyOnGetAndDelete(t *testing.T) {
+	const query = `{"query":{"match":{"title":"proxy"}}}`
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	backend := httptest.NewServer(echo)
+	defer backend.Close()
+	tlsBackend := httptest.NewUnstartedServer(echo)
+	tlsBackend.EnableHTTP2 = true
+	tlsBackend.StartTLS()
+	defer tlsBackend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	harPath := filepath.Join(t.TempDir(), "capture.har")
+	harLog := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, HarLogger: harLog, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	newClient := func(h2 bool) *http.Client {
+		return &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: h2,
+		}}
+	}
+
+	cases := []struct {
+		name   string
+		client *http.Client
+		url    string
+	}{
+		{"http", newClient(false), backend.URL},
+		{"https", newClient(false), tlsBackend.URL},
+		{"https-h2", newClient(true), tlsBackend.URL},
+	}
+	for _, tc := range cases {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			t.Run(tc.name+"/"+method, func(t *testing.T) {
+				req, err := http.NewRequest(method, tc.url+"/index/_search", bytes.NewBufferString(query))
+				require.NoError(t, err)
+				req.Header.Set("Content-Type", "application/json")
+				resp, err := tc.client.Do(req)
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				require.NoError(t, err)
+				// 请求体被原样转发到上游
+				assert.Equal(t, query, string(body))
+
+				entries := webHandler.GetEntries()
+				require.NotEmpty(t, entries)
+				latest := entries[len(entries)-1]
+				assert.Equal(t, method, latest.Method)
+				stored, err := webHandler.loadEntry(latest.ID)
+				require.NoError(t, err)
+				for _, entry := range []*TrafficEntry{webHandler.GetEntry(latest.ID), stored} {
+					require.NotNil(t, entry)
+					assert.Equal(t, query, string(entry.RequestBody))
+				}
+
+				require.NoError(t, harLog.Save())
+				data, err := os.ReadFile(harPath)
+				require.NoError(t, err)
+				var har harlogger.HAR
+				require.NoError(t, json.Unmarshal(data, &har))
+				harEntries := har.Log.Entries
+				require.NotEmpty(t, harEntries)
+				harReq := harEntries[len(harEntries)-1].Request
+				assert.Equal(t, method, harReq.Method)
+				require.NotNil(t, harReq.PostData)
+				assert.Equal(t, query, harReq.PostData.Text)
+				assert.Equal(t, int64(len(query)), harReq.BodySize)
+			})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_NoBodiesStoresNoBodyBytes(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(`{"secret":"compressed"}`))
+	require.NoError(t, gz.Close())
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "26")
+			_, _ = w.Write([]byte(`{"token":"secret-response"`))
+		case "/gzip":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Length", strconv.Itoa(gzipped.Len()))
+			_, _ = w.Write(gzipped.Bytes())
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range []string{"data: secret-1\n\n", "data: secret-2\n\n"} {
+				_, _ = w.Write([]byte(event))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			_, _ = w.Write(received)
+		}
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	webHandler.SetNoBodies(true)
+	harPath := filepath.Join(t.TempDir(), "traffic.har")
+	harLogger := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	harLogger.SetNoBodies(true)
+	server, err := proxy.New(proxy.Config{
+		EventHandler: webHandler,
+		HarLogger:    harLogger,
+		NoBodies:     true,
+		LogWriter:    io.Discard,
+	})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), DisableCompression: true}, Timeout: 10 * time.Second}
+
+	// 流量照常转发，客户端收到完整的消息体
+	resp, err := client.Post(backend.URL+"/login", "application/json", bytes.NewBufferString(`{"password":"secret-request"}`))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, `{"token":"secret-response"`, string(body))
+
+	resp, err = client.Post(backend.URL+"/echo", "text/plain", bytes.NewBufferString("secret-echo"))
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "secret-echo", string(body))
+
+	resp, err = client.Get(backend.URL + "/gzip")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"), "bodies are not decompressed in this mode")
+	assert.Equal(t, gzipped.Bytes(), body)
+
+	resp, err = client.Get(backend.URL + "/events")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), "data: secret-2")
+
+	require.Eventually(t, func() bool {
+		entries := webHandler.GetEntries()
+		return len(entries) == 4 && entries[3].IsSSECompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, summary := range webHandler.GetEntries() {
+		entry := webHandler.GetEntry(summary.ID)
+		require.NotNil(t, entry)
+		assert.Empty(t, entry.RequestBody, entry.URL)
+		assert.Empty(t, entry.ResponseBody, entry.URL)
+		assert.NotEmpty(t, entry.RequestHeaders, entry.URL)
+		assert.NotEmpty(t, entry.ResponseHeaders, entry.URL)
+	}
+	entries := webHandler.GetEntries()
+	assert.Equal(t, 26, entries[0].ContentSize, "size comes from Content-Length")
+	assert.Equal(t, gzipped.Len(), entries[2].ContentSize)
+
+	// SSE的HAR条目在流结束后写入
+	var data []byte
+	var har harlogger.HAR
+	require.Eventually(t, func() bool {
+		require.NoError(t, harLogger.Save())
+		data, err = os.ReadFile(harPath)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &har))
+		return len(har.Log.Entries) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotContains(t, string(data), "secret-")
+	for _, entry := range har.Log.Entries {
+		assert.Nil(t, entry.Request.PostData, entry.Request.URL)
+		assert.Empty(t, entry.Response.Content.Text, entry.Request.URL)
+	}
+	assert.Equal(t, int64(len(`{"password":"secret-request"}`)), har.Log.Entries[0].Request.BodySize)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_RecordsRateLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	limiter, err := proxy.ParseRateLimits([]string{"127.0.0.1=0.1/1"}, proxy.RateLimitReject)
+	require.NoError(t, err)
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, RateLimiter: limiter, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	for _, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := client.Get(backend.URL + "/limited")
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode)
+	}
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 2)
+	assert.Empty(t, entries[0].RateLimit)
+	stored, err := webHandler.loadEntry(entries[1].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(entries[1].ID), stored} {
+		require.NotNil(t, entry)
+		assert.Equal(t, proxy.RateLimitRejected, entry.RateLimit)
+		assert.Equal(t, http.StatusTooManyRequests, entry.StatusCode)
+	}
+}
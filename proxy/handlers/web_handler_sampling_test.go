@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runSampledTraffic 通过代理发送一个200、一个503和一个连接失败的请求，返回WebHandler和HAR中保存的路径
+func runSampledTraffic(t *testing.T, rate float64) ([]string, []string, *proxy.Sampler) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddr := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	harPath := filepath.Join(t.TempDir(), "sampled.har")
+	harLog := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	sampler, err := proxy.NewSampler(rate)
+	require.NoError(t, err)
+
+	server, err := proxy.New(proxy.Config{
+		EventHandler: webHandler,
+		HarLogger:    harLog,
+		Sampler:      sampler,
+		LogWriter:    io.Discard,
+	})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	for _, target := range []string{backend.URL + "/ok", backend.URL + "/unavailable", "http://" + deadAddr + "/down"} {
+		resp, err := client.Get(target)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	var webPaths []string
+	for _, entry := range webHandler.GetEntries() {
+		webPaths = append(webPaths, entry.Path)
+	}
+	sort.Strings(webPaths)
+
+	require.NoError(t, harLog.Save())
+	data, err := os.ReadFile(harPath)
+	require.NoError(t, err)
+	var har harlogger.HAR
+	require.NoError(t, json.Unmarshal(data, &har))
+	var harPaths []string
+	for _, entry := range har.Log.Entries {
+		parsed, err := url.Parse(entry.Request.URL)
+		require.NoError(t, err)
+		harPaths = append(harPaths, parsed.Path)
+	}
+	sort.Strings(harPaths)
+
+	return webPaths, harPaths, sampler
+}
+
+func TestSamplingRateZeroKeepsOnlyErrors(t *testing.T) {
+	webPaths, harPaths, sampler := runSampledTraffic(t, 0)
+
+	assert.Equal(t, []string{"/down", "/unavailable"}, webPaths)
+	assert.Equal(t, []string{"/down", "/unavailable"}, harPaths)
+	assert.Equal(t, uint64(1), sampler.Skipped())
+}
+
+func TestSamplingRateOneKeepsEverything(t *testing.T) {
+	webPaths, harPaths, sampler := runSampledTraffic(t, 1)
+
+	assert.Equal(t, []string{"/down", "/ok", "/unavailable"}, webPaths)
+	assert.Equal(t, []string{"/down", "/ok", "/unavailable"}, harPaths)
+	assert.Zero(t, sampler.Skipped())
+}
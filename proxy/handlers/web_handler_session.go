@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const sessionsSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	start_time INTEGER NOT NULL,
+	last_entry_id INTEGER NOT NULL,
+	config BLOB
+);
+`
+
+// Session 是一次代理运行的记录，SQLite存储模式下保存在sessions表中，重启后仍可查询
+type Session struct {
+	ID        int64     `json:"id"`
+	StartTime time.Time `json:"startTime"`
+	// LastEntryID 是本次运行开始前已保存的最大条目ID，ID更大的条目属于本次及之后的运行
+	LastEntryID int64             `json:"lastEntryId"`
+	Config      map[string]string `json:"config,omitempty"`
+}
+
+// StartSession 记录本次运行的开始时间和关键配置，应在处理流量之前调用一次
+// 内存存储模式下只保留在内存中，Sessions只返回本次运行
+func (h *WebHandler) StartSession(config map[string]string) (*Session, error) {
+	session := &Session{StartTime: time.Now(), Config: config}
+	if h.db != nil {
+		if err := h.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM traffic_entries").Scan(&session.LastEntryID); err != nil {
+			return nil, err
+		}
+		configJSON, err := json.Marshal(config)
+		if err != nil {
+			return nil, err
+		}
+		result, err := h.db.Exec("INSERT INTO sessions (start_time, last_entry_id, config) VALUES (?, ?, ?)",
+			toMillis(session.StartTime), session.LastEntryID, configJSON)
+		if err != nil {
+			return nil, err
+		}
+		if session.ID, err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	} else {
+		session.ID = 1
+	}
+
+	h.entryMutex.Lock()
+	h.session = session
+	h.entryMutex.Unlock()
+	return session, nil
+}
+
+// Sessions 返回所有运行记录，按开始时间从新到旧排列
+func (h *WebHandler) Sessions() ([]*Session, error) {
+	if h.db == nil {
+		h.entryMutex.RLock()
+		defer h.entryMutex.RUnlock()
+		if h.session == nil {
+			return []*Session{}, nil
+		}
+		return []*Session{h.session}, nil
+	}
+
+	rows, err := h.db.Query("SELECT id, start_time, last_entry_id, config FROM sessions ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var (
+			session    Session
+			startTime  int64
+			configJSON []byte
+		)
+		if err := rows.Scan(&session.ID, &startTime, &session.LastEntryID, &configJSON); err != nil {
+			return nil, err
+		}
+		session.StartTime = time.Unix(0, startTime*int64(time.Millisecond))
+		if len(configJSON) > 0 {
+			_ = json.Unmarshal(configJSON, &session.Config)
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
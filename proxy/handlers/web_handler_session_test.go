@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_ReopenContinuesIDs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "traffic.db")
+	first, err := NewWebHandlerWithStorage(false, dbPath, StorageBoth)
+	require.NoError(t, err)
+	_, err = first.StartSession(map[string]string{"listen": "127.0.0.1:38080"})
+	require.NoError(t, err)
+	oldIDs := recordTransactions(t, first, 3)
+	// 删除最新的条目后，它的ID也不能被下一次运行重新使用
+	_, err = first.db.Exec("DELETE FROM traffic_entries WHERE id = ?", oldIDs[2])
+	require.NoError(t, err)
+	require.NoError(t, first.db.Close())
+
+	second, err := NewWebHandlerWithStorage(false, dbPath, StorageBoth)
+	require.NoError(t, err)
+	defer second.db.Close()
+	session, err := second.StartSession(map[string]string{"listen": "127.0.0.1:38081"})
+	require.NoError(t, err)
+	assert.Equal(t, oldIDs[1], strconv.FormatInt(session.LastEntryID, 10))
+
+	newIDs := recordTransactions(t, second, 2)
+	maxOld, _ := strconv.ParseInt(oldIDs[2], 10, 64)
+	for _, id := range newIDs {
+		value, err := strconv.ParseInt(id, 10, 64)
+		require.NoError(t, err)
+		assert.Greater(t, value, maxOld)
+	}
+	assert.Equal(t, append(oldIDs[:2:2], newIDs...), entryIDs(second.GetEntriesSorted([]SortField{{Field: "id"}})))
+
+	sessions, err := second.Sessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, session.ID, sessions[0].ID)
+	assert.Equal(t, "127.0.0.1:38081", sessions[0].Config["listen"])
+	assert.Equal(t, int64(0), sessions[1].LastEntryID)
+	assert.Equal(t, "127.0.0.1:38080", sessions[1].Config["listen"])
+	assert.False(t, sessions[1].StartTime.After(sessions[0].StartTime))
+}
+
+func TestWebHandler_SessionMemory(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+
+	sessions, err := handler.Sessions()
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	session, err := handler.StartSession(map[string]string{"storage": "memory"})
+	require.NoError(t, err)
+	sessions, err = handler.Sessions()
+	require.NoError(t, err)
+	assert.Equal(t, []*Session{session}, sessions)
+}
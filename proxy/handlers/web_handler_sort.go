@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SortField 描述一个排序字段及方向
+type SortField struct {
+	Field string // 排序字段（JSON字段名，例如 host、duration）
+	Desc  bool   // 是否降序
+}
+
+// sortableColumns 允许排序的字段白名单，键为API字段名，值为数据库列名
+// ORDER BY 只能拼接此处列出的列名，避免SQL注入
+var sortableColumns = map[string]string{
+	"id":          "id",
+	"startTime":   "start_time",
+	"endTime":     "end_time",
+	"duration":    "duration",
+	"host":        "host",
+	"method":      "method",
+	"schema":      "schema",
+	"protocol":    "protocol",
+	"url":         "url",
+	"path":        "path",
+	"statusCode":  "status_code",
+	"contentType": "content_type",
+	"contentSize": "content_size",
+	"processName": "process_name",
+}
+
+// ParseSortSpec 解析形如 "host:asc,duration:desc" 的排序参数
+// 方向缺省为asc；字段不在白名单内或方向非法时返回错误
+func ParseSortSpec(raw string) ([]SortField, error) {
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, direction, _ := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		if _, ok := sortableColumns[name]; !ok {
+			return nil, fmt.Errorf("unsupported sort field %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate sort field %q", name)
+		}
+		seen[name] = true
+
+		field := SortField{Field: name}
+		switch strings.ToLower(strings.TrimSpace(direction)) {
+		case "", "asc":
+		case "desc":
+			field.Desc = true
+		default:
+			return nil, fmt.Errorf("invalid sort direction %q for field %q", direction, name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// buildOrderByClause 根据排序字段生成ORDER BY子句，始终以id作为最终排序键保证结果稳定
+func buildOrderByClause(fields []SortField) (string, error) {
+	clauses := make([]string, 0, len(fields)+1)
+	hasID := false
+	for _, field := range fields {
+		column, ok := sortableColumns[field.Field]
+		if !ok {
+			return "", fmt.Errorf("unsupported sort field %q", field.Field)
+		}
+		if column == "id" {
+			hasID = true
+		}
+		direction := "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		clauses = append(clauses, column+" "+direction)
+	}
+	if !hasID {
+		clauses = append(clauses, "id ASC")
+	}
+	return "ORDER BY " + strings.Join(clauses, ", "), nil
+}
+
+// GetEntriesSorted 返回最近的流量条目，并按指定字段组合排序；sort为空时等同于GetEntries
+func (h *WebHandler) GetEntriesSorted(sort []SortField) []*TrafficEntry {
+	if len(sort) == 0 {
+		return h.GetEntries()
+	}
+
+	if h.storage == StorageMemory {
+		entries, err := h.memoryEntriesSorted(h.ListLimit(), sort)
+		if err != nil {
+			if h.verbose {
+				log.Printf("[WebHandler] GetEntriesSorted: 内存排序失败: %v", err)
+			}
+			return []*TrafficEntry{}
+		}
+		return entries
+	}
+
+	startTime := time.Now()
+	entries, err := h.loadEntriesSorted(h.ListLimit(), sort)
+	if err != nil {
+		if h.verbose {
+			log.Printf("[WebHandler] GetEntriesSorted: 查询数据库失败: %v", err)
+		}
+		return []*TrafficEntry{}
+	}
+	// 与GetEntries一致使用内存中进行中条目（如SSE）的最新状态，并按最新状态重新排序
+	h.overlayLiveEntries(entries)
+	sortEntries(entries, sort)
+
+	elapsed := time.Since(startTime)
+	if elapsed > 100*time.Millisecond {
+		log.Printf("[WebHandler] GetEntriesSorted: 返回 %d 条记录耗时 %v", len(entries), elapsed)
+	}
+
+	return entries
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedSortEntries 直接写入带有指定host和耗时的记录
+func seedSortEntries(t *testing.T, handler *WebHandler, rows []struct {
+	host     string
+	duration int64
+}) {
+	t.Helper()
+	for _, row := range rows {
+		entry := &TrafficEntry{
+			StartTime: time.Now(),
+			Host:      row.host,
+			Method:    "GET",
+			URL:       "http://" + row.host + "/",
+		}
+		id, err := handler.insertEntry(entry)
+		require.NoError(t, err)
+		entry.ID = id
+		entry.EndTime = entry.StartTime.Add(time.Duration(row.duration) * time.Millisecond)
+		entry.Duration = row.duration
+		entry.StatusCode = 200
+		require.NoError(t, handler.updateResponse(entry))
+	}
+}
+
+func TestParseSortSpec(t *testing.T) {
+	fields, err := ParseSortSpec("host:asc, duration:DESC,statusCode")
+	require.NoError(t, err)
+	assert.Equal(t, []SortField{
+		{Field: "host"},
+		{Field: "duration", Desc: true},
+		{Field: "statusCode"},
+	}, fields)
+
+	fields, err = ParseSortSpec("")
+	require.NoError(t, err)
+	assert.Empty(t, fields)
+
+	for _, raw := range []string{
+		"host;DROP TABLE traffic_entries",
+		"request_body:asc",
+		"host:sideways",
+		"host:asc,host:desc",
+	} {
+		_, err := ParseSortSpec(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestWebHandler_GetEntriesSortedMultiField(t *testing.T) {
+	handler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+
+	seedSortEntries(t, handler, []struct {
+		host     string
+		duration int64
+	}{
+		{"b.example.com", 10},
+		{"a.example.com", 5},
+		{"b.example.com", 30},
+		{"a.example.com", 50},
+		{"a.example.com", 50},
+	})
+
+	sort, err := ParseSortSpec("host:asc,duration:desc")
+	require.NoError(t, err)
+	entries := handler.GetEntriesSorted(sort)
+	require.Len(t, entries, 5)
+
+	got := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		got = append(got, fmt.Sprintf("%s/%d", entry.Host, entry.Duration))
+	}
+	assert.Equal(t, []string{
+		"a.example.com/50",
+		"a.example.com/50",
+		"a.example.com/5",
+		"b.example.com/30",
+		"b.example.com/10",
+	}, got)
+
+	// 相同排序键按id升序保证稳定
+	assert.Equal(t, "4", entries[0].ID)
+	assert.Equal(t, "5", entries[1].ID)
+
+	// 未指定排序时保持默认的id顺序
+	defaultEntries := handler.GetEntriesSorted(nil)
+	require.Len(t, defaultEntries, 5)
+	assert.Equal(t, "1", defaultEntries[0].ID)
+	assert.Equal(t, "5", defaultEntries[4].ID)
+}
+
+func TestWebHandler_GetEntriesSortedUsesLiveEntries(t *testing.T) {
+	handler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+
+	seedSortEntries(t, handler, []struct {
+		host     string
+		duration int64
+	}{
+		{"a.example.com", 10},
+		{"b.example.com", 20},
+	})
+
+	// 进行中的SSE条目只在内存中更新，数据库里仍是旧状态
+	handler.entryMutex.Lock()
+	handler.entriesMap["1"] = &TrafficEntry{
+		ID:           "1",
+		Host:         "a.example.com",
+		Method:       "GET",
+		Duration:     500,
+		IsSSE:        true,
+		ResponseBody: []byte("data: live\n\n"),
+	}
+	handler.entryMutex.Unlock()
+
+	sort, err := ParseSortSpec("duration:desc")
+	require.NoError(t, err)
+	entries := handler.GetEntriesSorted(sort)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "1", entries[0].ID)
+	assert.Equal(t, int64(500), entries[0].Duration)
+	assert.True(t, entries[0].IsSSE)
+	assert.Equal(t, "2", entries[1].ID)
+}
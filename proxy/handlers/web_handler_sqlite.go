@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/LubyRuffy/ProxyCraft/proxy"
 	_ "modernc.org/sqlite"
 )
 
@@ -39,10 +40,64 @@ CREATE TABLE IF NOT EXISTS traffic_entries (
 	response_body BLOB,
 	request_headers BLOB,
 	response_headers BLOB,
-	error TEXT
+	error TEXT,
+	tls_version TEXT,
+	cipher_suite TEXT,
+	alpn TEXT,
+	upstream_tls_version TEXT,
+	upstream_cipher_suite TEXT,
+	upstream_alpn TEXT,
+	time_to_first_byte INTEGER,
+	total_duration INTEGER,
+	connection_id TEXT,
+	connection_reused INTEGER,
+	detected_content_type TEXT,
+	connect_host TEXT,
+	sni TEXT,
+	sni_mismatch INTEGER,
+	informational_responses BLOB,
+	request_body_hash TEXT,
+	response_body_hash TEXT,
+	sse_events BLOB,
+	chaos TEXT,
+	anomaly TEXT,
+	error_kind TEXT,
+	rate_limit TEXT,
+	cache TEXT
 );
 `
 
+// addedColumns 是建表后新增的列，打开旧数据库时按需补齐
+var addedColumns = []struct {
+	name       string
+	definition string
+}{
+	{"is_timeout", "INTEGER"},
+	{"tls_version", "TEXT"},
+	{"cipher_suite", "TEXT"},
+	{"alpn", "TEXT"},
+	{"upstream_tls_version", "TEXT"},
+	{"upstream_cipher_suite", "TEXT"},
+	{"upstream_alpn", "TEXT"},
+	{"time_to_first_byte", "INTEGER"},
+	{"total_duration", "INTEGER"},
+	{"connection_id", "TEXT"},
+	{"connection_reused", "INTEGER"},
+	{"detected_content_type", "TEXT"},
+	{"connect_host", "TEXT"},
+	{"sni", "TEXT"},
+	{"sni_mismatch", "INTEGER"},
+	{"informational_responses", "BLOB"},
+	{"request_body_hash", "TEXT"},
+	{"response_body_hash", "TEXT"},
+	{"sse_events", "BLOB"},
+	{"chaos", "TEXT"},
+	{"anomaly", "TEXT"},
+	{"error_kind", "TEXT"},
+	{"rate_limit", "TEXT"},
+	{"cache", "TEXT"},
+}
+
 func (h *WebHandler) initSQLite(dbPath string) error {
 	if dbPath == "" {
 		dbPath = "proxycraft.db"
@@ -71,12 +126,16 @@ func (h *WebHandler) initSQLite(dbPath string) error {
 		_ = db.Close()
 		return err
 	}
+	if _, err := db.Exec(sessionsSchema); err != nil {
+		_ = db.Close()
+		return err
+	}
 	rows, err := db.Query("PRAGMA table_info(traffic_entries);")
 	if err != nil {
 		_ = db.Close()
 		return err
 	}
-	hasTimeoutColumn := false
+	existingColumns := make(map[string]bool)
 	for rows.Next() {
 		var (
 			cid        int
@@ -91,10 +150,7 @@ func (h *WebHandler) initSQLite(dbPath string) error {
 			_ = db.Close()
 			return err
 		}
-		if name == "is_timeout" {
-			hasTimeoutColumn = true
-			break
-		}
+		existingColumns[name] = true
 	}
 	if err := rows.Err(); err != nil {
 		_ = rows.Close()
@@ -102,8 +158,11 @@ func (h *WebHandler) initSQLite(dbPath string) error {
 		return err
 	}
 	_ = rows.Close()
-	if !hasTimeoutColumn {
-		if _, err := db.Exec("ALTER TABLE traffic_entries ADD COLUMN is_timeout INTEGER;"); err != nil {
+	for _, column := range addedColumns {
+		if existingColumns[column.name] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE traffic_entries ADD COLUMN " + column.name + " " + column.definition + ";"); err != nil {
 			_ = db.Close()
 			return err
 		}
@@ -127,12 +186,14 @@ func (h *WebHandler) insertEntry(entry *TrafficEntry) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	requestBody, requestBodyHash := h.storeBody(entry.RequestBody)
 
 	result, err := h.db.Exec(
 		`INSERT INTO traffic_entries (
 			start_time, host, host_with_schema, method, schema, protocol, url, path,
-			is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, request_body, request_headers
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, request_body, request_headers,
+			tls_version, cipher_suite, alpn, connect_host, sni, sni_mismatch, request_body_hash, chaos, rate_limit, cache
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		toMillis(entry.StartTime),
 		emptyToNil(entry.Host),
 		emptyToNil(entry.HostWithSchema),
@@ -147,8 +208,18 @@ func (h *WebHandler) insertEntry(entry *TrafficEntry) (string, error) {
 		boolToInt(entry.IsTimeout),
 		emptyToNil(entry.ProcessName),
 		emptyToNil(entry.ProcessIcon),
-		emptyBytesToNil(entry.RequestBody),
+		requestBody,
 		emptyBytesToNil(requestHeaders),
+		emptyToNil(entry.TLSVersion),
+		emptyToNil(entry.CipherSuite),
+		emptyToNil(entry.ALPN),
+		emptyToNil(entry.ConnectHost),
+		emptyToNil(entry.SNI),
+		boolToInt(entry.SNIMismatch),
+		requestBodyHash,
+		emptyToNil(entry.Chaos),
+		emptyToNil(entry.RateLimit),
+		emptyToNil(entry.Cache),
 	)
 	if err != nil {
 		return "", err
@@ -171,6 +242,12 @@ func (h *WebHandler) updateResponse(entry *TrafficEntry) error {
 	if err != nil {
 		return err
 	}
+	informational, err := marshalInformationalResponses(entry.InformationalResponses)
+	if err != nil {
+		return err
+	}
+	requestBody, requestBodyHash := h.storeBody(entry.RequestBody)
+	responseBody, responseBodyHash := h.storeBody(entry.ResponseBody)
 
 	_, err = h.db.Exec(
 		`UPDATE traffic_entries SET
@@ -183,8 +260,21 @@ func (h *WebHandler) updateResponse(entry *TrafficEntry) error {
 			is_sse_completed = ?,
 			is_https = ?,
 			is_timeout = ?,
+			request_body = ?,
 			response_headers = ?,
-			response_body = ?
+			response_body = ?,
+			upstream_tls_version = ?,
+			upstream_cipher_suite = ?,
+			upstream_alpn = ?,
+			time_to_first_byte = ?,
+			total_duration = ?,
+			connection_id = ?,
+			connection_reused = ?,
+			detected_content_type = ?,
+			informational_responses = ?,
+			request_body_hash = ?,
+			response_body_hash = ?,
+			anomaly = ?
 		WHERE id = ?`,
 		toNullableMillis(entry.EndTime),
 		entry.Duration,
@@ -195,8 +285,21 @@ func (h *WebHandler) updateResponse(entry *TrafficEntry) error {
 		boolToInt(entry.IsSSECompleted),
 		boolToInt(entry.IsHTTPS),
 		boolToInt(entry.IsTimeout),
+		requestBody,
 		emptyBytesToNil(responseHeaders),
-		emptyBytesToNil(entry.ResponseBody),
+		responseBody,
+		emptyToNil(entry.UpstreamTLSVersion),
+		emptyToNil(entry.UpstreamCipherSuite),
+		emptyToNil(entry.UpstreamALPN),
+		entry.TimeToFirstByte,
+		entry.TotalDuration,
+		emptyToNil(entry.ConnectionID),
+		boolToInt(entry.ConnectionReused),
+		emptyToNil(entry.DetectedContentType),
+		emptyBytesToNil(informational),
+		requestBodyHash,
+		responseBodyHash,
+		emptyToNil(entry.Anomaly),
 		entry.ID,
 	)
 	return err
@@ -208,11 +311,13 @@ func (h *WebHandler) updateError(entry *TrafficEntry) error {
 	}
 
 	_, err := h.db.Exec(
-		`UPDATE traffic_entries SET end_time = ?, duration = ?, error = ?, is_timeout = ? WHERE id = ?`,
+		`UPDATE traffic_entries SET end_time = ?, duration = ?, total_duration = ?, error = ?, is_timeout = ?, error_kind = ? WHERE id = ?`,
 		toNullableMillis(entry.EndTime),
 		entry.Duration,
+		entry.TotalDuration,
 		emptyToNil(entry.Error),
 		boolToInt(entry.IsTimeout),
+		emptyToNil(entry.ErrorKind),
 		entry.ID,
 	)
 	return err
@@ -223,23 +328,43 @@ func (h *WebHandler) updateSSE(entry *TrafficEntry) error {
 		return nil
 	}
 
+	// 流结束前响应体每个事件都会变化，只在完成后写入文件存储，避免产生大量中间文件
+	// 事件时间同样只在完成后写入，进行中的条目从内存读取
+	responseBody, responseBodyHash := emptyBytesToNil(entry.ResponseBody), interface{}(nil)
+	var sseEvents []byte
+	if entry.IsSSECompleted {
+		responseBody, responseBodyHash = h.storeBody(entry.ResponseBody)
+		var err error
+		if sseEvents, err = marshalSSEEvents(entry.SSEEvents); err != nil {
+			return err
+		}
+	}
+
 	_, err := h.db.Exec(
 		`UPDATE traffic_entries SET
 			end_time = ?,
 			duration = ?,
+			total_duration = ?,
 			content_type = ?,
 			content_size = ?,
 			response_body = ?,
+			response_body_hash = ?,
 			is_sse_completed = ?,
-			is_timeout = ?
+			is_timeout = ?,
+			sse_events = ?,
+			anomaly = ?
 		WHERE id = ?`,
 		toNullableMillis(entry.EndTime),
 		entry.Duration,
+		entry.TotalDuration,
 		emptyToNil(entry.ContentType),
 		entry.ContentSize,
-		emptyBytesToNil(entry.ResponseBody),
+		responseBody,
+		responseBodyHash,
 		boolToInt(entry.IsSSECompleted),
 		boolToInt(entry.IsTimeout),
+		emptyBytesToNil(sseEvents),
+		emptyToNil(entry.Anomaly),
 		entry.ID,
 	)
 	return err
@@ -252,7 +377,8 @@ func (h *WebHandler) loadEntries(limit int) ([]*TrafficEntry, error) {
 
 	rows, err := h.db.Query(
 		`SELECT id, start_time, end_time, duration, host, host_with_schema, method, schema, protocol, url, path,
-			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, error
+			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, error,
+			time_to_first_byte, total_duration, anomaly, error_kind
 		FROM traffic_entries ORDER BY id DESC LIMIT ?`,
 		limit,
 	)
@@ -277,27 +403,66 @@ func (h *WebHandler) loadEntries(limit int) ([]*TrafficEntry, error) {
 	return entries, nil
 }
 
+// loadEntriesSorted 取最近limit条记录，并按指定字段组合排序
+func (h *WebHandler) loadEntriesSorted(limit int, sort []SortField) ([]*TrafficEntry, error) {
+	if h.db == nil {
+		return []*TrafficEntry{}, nil
+	}
+
+	orderBy, err := buildOrderByClause(sort)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.db.Query(
+		`SELECT id, start_time, end_time, duration, host, host_with_schema, method, schema, protocol, url, path,
+			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, error,
+			time_to_first_byte, total_duration, anomaly, error_kind
+		FROM (SELECT * FROM traffic_entries ORDER BY id DESC LIMIT ?) `+orderBy,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*TrafficEntry, 0)
+	for rows.Next() {
+		entry, err := scanEntryRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
 func (h *WebHandler) loadEntriesAfterID(offsetID string) ([]*TrafficEntry, error) {
 	if offsetID == "" {
-		return h.loadEntries(1000)
+		return h.loadEntries(h.ListLimit())
 	}
 
 	offsetValue, err := strconv.ParseInt(offsetID, 10, 64)
 	if err != nil {
-		return h.loadEntries(1000)
+		return h.loadEntries(h.ListLimit())
 	}
 
 	var exists int
 	if err := h.db.QueryRow("SELECT 1 FROM traffic_entries WHERE id = ? LIMIT 1", offsetValue).Scan(&exists); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return h.loadEntries(1000)
+			return h.loadEntries(h.ListLimit())
 		}
 		return nil, err
 	}
 
 	rows, err := h.db.Query(
 		`SELECT id, start_time, end_time, duration, host, host_with_schema, method, schema, protocol, url, path,
-			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, error
+			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon, error,
+			time_to_first_byte, total_duration, anomaly, error_kind
 		FROM traffic_entries WHERE id > ? ORDER BY id ASC`,
 		offsetValue,
 	)
@@ -329,7 +494,10 @@ func (h *WebHandler) loadEntry(id string) (*TrafficEntry, error) {
 	row := h.db.QueryRow(
 		`SELECT id, start_time, end_time, duration, host, host_with_schema, method, schema, protocol, url, path,
 			status_code, content_type, content_size, is_sse, is_sse_completed, is_https, is_timeout, process_name, process_icon,
-			request_body, response_body, request_headers, response_headers, error
+			request_body, response_body, request_headers, response_headers, error,
+			tls_version, cipher_suite, alpn, upstream_tls_version, upstream_cipher_suite, upstream_alpn,
+			time_to_first_byte, total_duration, connection_id, connection_reused, detected_content_type,
+			connect_host, sni, sni_mismatch, informational_responses, request_body_hash, response_body_hash, sse_events, chaos, anomaly, error_kind, rate_limit, cache
 		FROM traffic_entries WHERE id = ?`,
 		id,
 	)
@@ -360,6 +528,29 @@ func (h *WebHandler) loadEntry(id string) (*TrafficEntry, error) {
 		requestHeadersRaw  []byte
 		responseHeadersRaw []byte
 		errorMsg           sql.NullString
+		tlsVersion         sql.NullString
+		cipherSuite        sql.NullString
+		alpn               sql.NullString
+		upstreamTLSVersion sql.NullString
+		upstreamCipher     sql.NullString
+		upstreamALPN       sql.NullString
+		timeToFirstByte    sql.NullInt64
+		totalDuration      sql.NullInt64
+		connectionID       sql.NullString
+		connectionReused   sql.NullInt64
+		detectedType       sql.NullString
+		connectHost        sql.NullString
+		sni                sql.NullString
+		sniMismatch        sql.NullInt64
+		chaos              sql.NullString
+		anomaly            sql.NullString
+		errorKind          sql.NullString
+		rateLimit          sql.NullString
+		cache              sql.NullString
+		informationalRaw   []byte
+		requestBodyHash    sql.NullString
+		responseBodyHash   sql.NullString
+		sseEventsRaw       []byte
 	)
 
 	if err := row.Scan(
@@ -388,6 +579,29 @@ func (h *WebHandler) loadEntry(id string) (*TrafficEntry, error) {
 		&requestHeadersRaw,
 		&responseHeadersRaw,
 		&errorMsg,
+		&tlsVersion,
+		&cipherSuite,
+		&alpn,
+		&upstreamTLSVersion,
+		&upstreamCipher,
+		&upstreamALPN,
+		&timeToFirstByte,
+		&totalDuration,
+		&connectionID,
+		&connectionReused,
+		&detectedType,
+		&connectHost,
+		&sni,
+		&sniMismatch,
+		&informationalRaw,
+		&requestBodyHash,
+		&responseBodyHash,
+		&sseEventsRaw,
+		&chaos,
+		&anomaly,
+		&errorKind,
+		&rateLimit,
+		&cache,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -419,8 +633,33 @@ func (h *WebHandler) loadEntry(id string) (*TrafficEntry, error) {
 		errorMsg,
 	)
 
-	entry.RequestBody = requestBody
-	entry.ResponseBody = responseBody
+	entry.RequestBody = h.loadBody(requestBody, requestBodyHash.String)
+	entry.ResponseBody = h.loadBody(responseBody, responseBodyHash.String)
+	entry.TLSVersion = tlsVersion.String
+	entry.CipherSuite = cipherSuite.String
+	entry.ALPN = alpn.String
+	entry.UpstreamTLSVersion = upstreamTLSVersion.String
+	entry.UpstreamCipherSuite = upstreamCipher.String
+	entry.UpstreamALPN = upstreamALPN.String
+	entry.TimeToFirstByte = timeToFirstByte.Int64
+	entry.TotalDuration = totalDuration.Int64
+	entry.ConnectionID = connectionID.String
+	entry.ConnectionReused = connectionReused.Int64 != 0
+	entry.DetectedContentType = detectedType.String
+	entry.ConnectHost = connectHost.String
+	entry.SNI = sni.String
+	entry.SNIMismatch = sniMismatch.Int64 != 0
+	entry.Chaos = chaos.String
+	entry.Anomaly = anomaly.String
+	entry.ErrorKind = errorKind.String
+	entry.RateLimit = rateLimit.String
+	entry.Cache = cache.String
+	if len(informationalRaw) > 0 {
+		_ = json.Unmarshal(informationalRaw, &entry.InformationalResponses)
+	}
+	if len(sseEventsRaw) > 0 {
+		_ = json.Unmarshal(sseEventsRaw, &entry.SSEEvents)
+	}
 	if headers, err := unmarshalHeaders(requestHeadersRaw); err == nil {
 		entry.RequestHeaders = headers
 	}
@@ -435,10 +674,35 @@ func (h *WebHandler) clearEntriesInDB() error {
 	if h.db == nil {
 		return nil
 	}
-	_, err := h.db.Exec("DELETE FROM traffic_entries")
+	result, err := h.db.Exec("DELETE FROM traffic_entries")
+	h.countDeleted(result, err)
 	return err
 }
 
+// deleteEntriesInDB 在一条DELETE语句中删除满足filter的记录，返回被删除记录的ID
+func (h *WebHandler) deleteEntriesInDB(filter EntryFilter) ([]string, error) {
+	if h.db == nil {
+		return nil, nil
+	}
+	where, args := filter.whereClause()
+	rows, err := h.db.Query("DELETE FROM traffic_entries WHERE 1 = 1"+where+" RETURNING id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	h.deletedRows.Add(int64(len(ids)))
+	return ids, rows.Err()
+}
+
 func (h *WebHandler) cleanupOldEntries() {
 	if h.db == nil {
 		return
@@ -457,10 +721,10 @@ func (h *WebHandler) cleanupOldEntries() {
 		log.Printf("[WebHandler] 清理 %d 条旧流量记录，当前总数: %d", deleteCount, total)
 	}
 
-	_, _ = h.db.Exec(
+	h.countDeleted(h.db.Exec(
 		"DELETE FROM traffic_entries WHERE id IN (SELECT id FROM traffic_entries WHERE end_time IS NOT NULL ORDER BY id ASC LIMIT ?)",
 		deleteCount,
-	)
+	))
 
 	if err := h.db.QueryRow("SELECT COUNT(*) FROM traffic_entries").Scan(&total); err != nil {
 		return
@@ -469,10 +733,73 @@ func (h *WebHandler) cleanupOldEntries() {
 		return
 	}
 	deleteCount = total - h.maxEntries
-	_, _ = h.db.Exec(
+	h.countDeleted(h.db.Exec(
 		"DELETE FROM traffic_entries WHERE id IN (SELECT id FROM traffic_entries ORDER BY id ASC LIMIT ?)",
 		deleteCount,
+	))
+}
+
+// cleanupExpiredEntries 删除开始时间早于保留时长的已完成记录，进行中的请求（例如长时间的SSE流）不受影响
+func (h *WebHandler) cleanupExpiredEntries() {
+	if h.db == nil || h.retention <= 0 {
+		return
+	}
+	result, err := h.db.Exec(
+		"DELETE FROM traffic_entries WHERE start_time < ? AND end_time IS NOT NULL",
+		toMillis(time.Now().Add(-h.retention)),
 	)
+	if err != nil {
+		if h.verbose {
+			log.Printf("[WebHandler] 清理过期流量记录失败: %v", err)
+		}
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		h.deletedRows.Add(n)
+		if h.verbose {
+			log.Printf("[WebHandler] 清理 %d 条超过 %s 的流量记录", n, h.retention)
+		}
+	}
+}
+
+// countDeleted 累计DELETE语句删除的记录数，供reclaimSpace判断是否需要回收空间
+func (h *WebHandler) countDeleted(result sql.Result, err error) {
+	if err != nil {
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		h.deletedRows.Add(n)
+	}
+}
+
+// reclaimInterval 是两次回收数据库空间之间的最小间隔
+const reclaimInterval = time.Hour
+
+// reclaimSpace 在删除过记录后执行VACUUM并截断WAL文件，把已删除记录占用的空间还给文件系统
+// VACUUM会重写整个数据库，因此最多每reclaimInterval执行一次
+func (h *WebHandler) reclaimSpace() {
+	if h.db == nil || h.deletedRows.Load() == 0 || !h.reclaimMutex.TryLock() {
+		return
+	}
+	defer h.reclaimMutex.Unlock()
+	if !h.lastReclaim.IsZero() && time.Since(h.lastReclaim) < reclaimInterval {
+		return
+	}
+	h.lastReclaim = time.Now()
+
+	deleted := h.deletedRows.Swap(0)
+	if _, err := h.db.Exec("VACUUM"); err != nil {
+		if h.verbose {
+			log.Printf("[WebHandler] 回收数据库空间失败: %v", err)
+		}
+		return
+	}
+	if _, err := h.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil && h.verbose {
+		log.Printf("[WebHandler] WAL检查点失败: %v", err)
+	}
+	if h.verbose {
+		log.Printf("[WebHandler] 已回收 %d 条删除记录占用的数据库空间", deleted)
+	}
 }
 
 func scanEntryRow(rows *sql.Rows) (*TrafficEntry, error) {
@@ -498,6 +825,10 @@ func scanEntryRow(rows *sql.Rows) (*TrafficEntry, error) {
 		processName    sql.NullString
 		processIcon    sql.NullString
 		errorMsg       sql.NullString
+		ttfb           sql.NullInt64
+		total          sql.NullInt64
+		anomaly        sql.NullString
+		errorKind      sql.NullString
 	)
 
 	if err := rows.Scan(
@@ -522,11 +853,15 @@ func scanEntryRow(rows *sql.Rows) (*TrafficEntry, error) {
 		&processName,
 		&processIcon,
 		&errorMsg,
+		&ttfb,
+		&total,
+		&anomaly,
+		&errorKind,
 	); err != nil {
 		return nil, err
 	}
 
-	return buildEntryFromRow(
+	entry := buildEntryFromRow(
 		entryID,
 		startTime,
 		endTime,
@@ -548,7 +883,12 @@ func scanEntryRow(rows *sql.Rows) (*TrafficEntry, error) {
 		processName,
 		processIcon,
 		errorMsg,
-	), nil
+	)
+	entry.TimeToFirstByte = ttfb.Int64
+	entry.TotalDuration = total.Int64
+	entry.Anomaly = anomaly.String
+	entry.ErrorKind = errorKind.String
+	return entry, nil
 }
 
 func buildEntryFromRow(
@@ -613,6 +953,13 @@ func marshalHeaders(headers map[string][]string) ([]byte, error) {
 	return json.Marshal(headers)
 }
 
+func marshalInformationalResponses(responses []proxy.InformationalResponse) ([]byte, error) {
+	if len(responses) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(responses)
+}
+
 func unmarshalHeaders(data []byte) (map[string][]string, error) {
 	if len(data) == 0 {
 		return map[string][]string{}, nil
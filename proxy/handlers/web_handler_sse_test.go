@@ -40,3 +40,52 @@ func TestWebHandler_OnSSE_AppendsBlankLine(t *testing.T) {
 	require.NotNil(t, entry)
 	assert.Equal(t, event+"\n\n", string(entry.ResponseBody))
 }
+
+func TestWebHandler_OnSSE_RecordsEventTimings(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "traffic.db"), StorageSQLite)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", nil)
+	require.NoError(t, err)
+	reqCtx := &proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: req.URL.String(),
+		UserData:  make(map[string]interface{}),
+	}
+	handler.OnRequest(reqCtx)
+	id := reqCtx.UserData["traffic_id"].(string)
+	respCtx := &proxy.ResponseContext{ReqCtx: reqCtx}
+
+	events := []string{
+		"event: message_start\ndata: {}",
+		"data: {\"delta\":\"Hel\"}",
+		"data: {\"delta\":\"lo\"}",
+	}
+	for _, event := range events {
+		time.Sleep(5 * time.Millisecond)
+		handler.OnSSE(event, respCtx)
+	}
+
+	assertTimings := func(entry *TrafficEntry) {
+		require.NotNil(t, entry)
+		require.Len(t, entry.SSEEvents, len(events))
+		previous := 0.0
+		for i, timing := range entry.SSEEvents {
+			assert.Greater(t, timing.OffsetMs, previous, "event %d", i)
+			assert.Equal(t, len(events[i]), timing.Size)
+			previous = timing.OffsetMs
+		}
+		assert.Equal(t, "message_start", entry.SSEEvents[0].Type)
+		assert.Equal(t, "message", entry.SSEEvents[1].Type)
+		// 聚合的响应体保持不变
+		assert.Contains(t, string(entry.ResponseBody), "data: {\"delta\":\"lo\"}\n\n")
+	}
+	assertTimings(handler.GetEntry(id))
+
+	// 流结束后从内存释放，事件时间从SQLite读取
+	handler.OnSSE("__SSE_COMPLETED__", respCtx)
+	stored, err := handler.loadEntry(id)
+	require.NoError(t, err)
+	assertTimings(stored)
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StorageMode 决定WebHandler把流量条目保存在哪里
+type StorageMode string
+
+const (
+	// StorageBoth 同时写入SQLite和内存，内存副本用于快速读取进行中的条目
+	StorageBoth StorageMode = "both"
+	// StorageMemory 只保存在内存中，不创建数据库文件，最多保留maxEntries条
+	StorageMemory StorageMode = "memory"
+	// StorageSQLite 只保存在SQLite中，内存里仅保留尚未完成的条目
+	StorageSQLite StorageMode = "sqlite"
+)
+
+// ParseStorageMode 解析存储模式，空字符串等同于StorageBoth
+func ParseStorageMode(value string) (StorageMode, error) {
+	switch mode := StorageMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return StorageBoth, nil
+	case StorageBoth, StorageMemory, StorageSQLite:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported storage mode %q (want memory, sqlite or both)", value)
+	}
+}
+
+func (m StorageMode) usesSQLite() bool {
+	return m != StorageMemory
+}
+
+// keepsCompleted 返回已完成的条目是否继续保留在内存中
+func (m StorageMode) keepsCompleted() bool {
+	return m != StorageSQLite
+}
+
+// nextMemoryIDLocked 为内存模式的条目分配递增ID，调用方需持有entryMutex写锁
+func (h *WebHandler) nextMemoryIDLocked() string {
+	h.memoryID++
+	return strconv.FormatInt(h.memoryID, 10)
+}
+
+// SetRetention 设置条目的保留时长，清理任务会删除开始时间早于该时长的已完成条目，为0时只按条数清理
+func (h *WebHandler) SetRetention(retention time.Duration) {
+	h.retention = retention
+}
+
+// cleanup 按存储模式清理超出maxEntries或超过保留时长的旧条目，并定期回收SQLite中已删除记录的空间
+func (h *WebHandler) cleanup() {
+	if h.storage.usesSQLite() {
+		h.cleanupOldEntries()
+		h.cleanupExpiredEntries()
+		h.pruneBodyStore()
+		h.reclaimSpace()
+	}
+	if h.storage.keepsCompleted() {
+		h.trimMemoryEntries()
+		h.trimExpiredMemoryEntries()
+	}
+}
+
+// releaseEntry 在条目完成后释放内存副本，仅在StorageSQLite模式下生效
+func (h *WebHandler) releaseEntry(id string) {
+	if h.storage.keepsCompleted() {
+		return
+	}
+	h.entryMutex.Lock()
+	delete(h.entriesMap, id)
+	h.entryMutex.Unlock()
+}
+
+// trimMemoryEntries 将内存中的条目限制在maxEntries以内，优先丢弃最旧的已完成条目
+func (h *WebHandler) trimMemoryEntries() {
+	h.entryMutex.Lock()
+	defer h.entryMutex.Unlock()
+
+	excess := len(h.entries) - h.maxEntries
+	if excess <= 0 {
+		return
+	}
+
+	kept := make([]*TrafficEntry, 0, h.maxEntries)
+	for _, entry := range h.entries {
+		if excess > 0 && isEntryFinished(entry) {
+			delete(h.entriesMap, entry.ID)
+			excess--
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	h.entries = kept
+}
+
+// trimExpiredMemoryEntries 从内存中删除开始时间早于保留时长的已完成条目
+func (h *WebHandler) trimExpiredMemoryEntries() {
+	if h.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-h.retention)
+
+	h.entryMutex.Lock()
+	defer h.entryMutex.Unlock()
+
+	kept := make([]*TrafficEntry, 0, len(h.entries))
+	for _, entry := range h.entries {
+		if entry.StartTime.Before(cutoff) && isEntryFinished(entry) {
+			delete(h.entriesMap, entry.ID)
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	h.entries = kept
+}
+
+// isEntryFinished 判断条目是否不会再被更新
+func isEntryFinished(entry *TrafficEntry) bool {
+	if entry.Error != "" {
+		return true
+	}
+	if entry.EndTime.IsZero() {
+		return false
+	}
+	return !entry.IsSSE || entry.IsSSECompleted
+}
+
+// memoryEntries 返回内存中最近limit条条目的快照，按ID升序
+func (h *WebHandler) memoryEntries(limit int) []*TrafficEntry {
+	h.entryMutex.RLock()
+	defer h.entryMutex.RUnlock()
+	return h.snapshotEntriesLocked(len(h.entries)-limit, len(h.entries))
+}
+
+// memoryEntriesAfterID 返回内存中ID大于offsetID的条目，offsetID不存在时返回最近的条目
+func (h *WebHandler) memoryEntriesAfterID(offsetID string, limit int) []*TrafficEntry {
+	h.entryMutex.RLock()
+	_, exists := h.entriesMap[offsetID]
+	h.entryMutex.RUnlock()
+
+	offsetValue, err := strconv.ParseInt(offsetID, 10, 64)
+	if offsetID == "" || err != nil || !exists {
+		return h.memoryEntries(limit)
+	}
+
+	h.entryMutex.RLock()
+	defer h.entryMutex.RUnlock()
+	start := sort.Search(len(h.entries), func(i int) bool {
+		value, _ := strconv.ParseInt(h.entries[i].ID, 10, 64)
+		return value > offsetValue
+	})
+	return h.snapshotEntriesLocked(start, len(h.entries))
+}
+
+// memoryEntriesSorted 在内存中按排序字段组合排序，语义与buildOrderByClause一致
+func (h *WebHandler) memoryEntriesSorted(limit int, fields []SortField) ([]*TrafficEntry, error) {
+	for _, field := range fields {
+		if _, ok := sortableColumns[field.Field]; !ok {
+			return nil, fmt.Errorf("unsupported sort field %q", field.Field)
+		}
+	}
+
+	entries := h.memoryEntries(limit)
+	sortEntries(entries, fields)
+	return entries, nil
+}
+
+// sortEntries 按字段组合稳定排序，相同排序键保持原有顺序
+func sortEntries(entries []*TrafficEntry, fields []SortField) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		for _, field := range fields {
+			cmp := compareEntryField(entries[i], entries[j], field.Field)
+			if cmp == 0 {
+				continue
+			}
+			if field.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+func compareEntryField(a, b *TrafficEntry, field string) int {
+	switch field {
+	case "id":
+		idA, _ := strconv.ParseInt(a.ID, 10, 64)
+		idB, _ := strconv.ParseInt(b.ID, 10, 64)
+		return compareInt64(idA, idB)
+	case "startTime":
+		return a.StartTime.Compare(b.StartTime)
+	case "endTime":
+		return a.EndTime.Compare(b.EndTime)
+	case "duration":
+		return compareInt64(a.Duration, b.Duration)
+	case "host":
+		return strings.Compare(a.Host, b.Host)
+	case "method":
+		return strings.Compare(a.Method, b.Method)
+	case "schema":
+		return strings.Compare(a.Schema, b.Schema)
+	case "protocol":
+		return strings.Compare(a.Protocol, b.Protocol)
+	case "url":
+		return strings.Compare(a.URL, b.URL)
+	case "path":
+		return strings.Compare(a.Path, b.Path)
+	case "statusCode":
+		return compareInt64(int64(a.StatusCode), int64(b.StatusCode))
+	case "contentType":
+		return strings.Compare(a.ContentType, b.ContentType)
+	case "contentSize":
+		return compareInt64(int64(a.ContentSize), int64(b.ContentSize))
+	case "processName":
+		return strings.Compare(a.ProcessName, b.ProcessName)
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordTransactions 依次记录count个完整的请求/响应，返回条目ID
+func recordTransactions(t *testing.T, handler *WebHandler, count int) []string {
+	t.Helper()
+	ids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/item", nil)
+		reqCtx := &proxy.RequestContext{
+			Request:   req,
+			StartTime: time.Now(),
+			TargetURL: req.URL.String(),
+			UserData:  make(map[string]interface{}),
+		}
+		handler.OnRequest(reqCtx)
+		handler.OnResponse(&proxy.ResponseContext{
+			ReqCtx: reqCtx,
+			Response: &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/plain"}},
+				Body:       io.NopCloser(bytes.NewBufferString("payload")),
+			},
+		})
+		id, ok := reqCtx.UserData["traffic_id"].(string)
+		require.True(t, ok)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func entryIDs(entries []*TrafficEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestWebHandler_StorageMemory(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "memory.db")
+	handler, err := NewWebHandlerWithStorage(false, dbPath, StorageMemory)
+	require.NoError(t, err)
+
+	ids := recordTransactions(t, handler, 3)
+
+	_, statErr := os.Stat(dbPath)
+	assert.True(t, os.IsNotExist(statErr), "memory mode must not create a database file")
+	assert.Nil(t, handler.db)
+
+	assert.Equal(t, ids, entryIDs(handler.GetEntries()))
+	assert.Equal(t, ids[1:], entryIDs(handler.GetEntriesAfterID(ids[0])))
+	sorted := handler.GetEntriesSorted([]SortField{{Field: "id", Desc: true}})
+	assert.Equal(t, []string{ids[2], ids[1], ids[0]}, entryIDs(sorted))
+
+	entry := handler.GetEntry(ids[0])
+	require.NotNil(t, entry)
+	assert.Equal(t, "payload", string(entry.ResponseBody))
+
+	// 超出maxEntries时丢弃最旧的条目
+	handler.maxEntries = 2
+	handler.cleanup()
+	assert.Equal(t, ids[1:], entryIDs(handler.GetEntries()))
+	assert.Nil(t, handler.GetEntry(ids[0]))
+}
+
+func TestWebHandler_StorageSQLite(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "sqlite.db"), StorageSQLite)
+	require.NoError(t, err)
+
+	ids := recordTransactions(t, handler, 3)
+
+	// 完成的条目不在内存中保留
+	handler.entryMutex.RLock()
+	assert.Empty(t, handler.entries)
+	assert.Empty(t, handler.entriesMap)
+	handler.entryMutex.RUnlock()
+
+	assert.Equal(t, ids, entryIDs(handler.GetEntries()))
+	entry := handler.GetEntry(ids[1])
+	require.NotNil(t, entry)
+	assert.Equal(t, http.StatusOK, entry.StatusCode)
+	assert.Equal(t, "payload", string(entry.ResponseBody))
+}
+
+func TestWebHandler_StorageBoth(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "both.db"), StorageBoth)
+	require.NoError(t, err)
+
+	ids := recordTransactions(t, handler, 3)
+
+	handler.entryMutex.RLock()
+	assert.Len(t, handler.entriesMap, 3)
+	handler.entryMutex.RUnlock()
+	for _, id := range ids {
+		stored, err := handler.loadEntry(id)
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, "payload", string(stored.ResponseBody))
+	}
+
+	// 内存和数据库中的同一条目在读取时只出现一次
+	assert.Equal(t, ids, entryIDs(handler.GetEntries()))
+	assert.Equal(t, ids[1:], entryIDs(handler.GetEntriesAfterID(ids[0])))
+}
+
+func TestParseStorageMode(t *testing.T) {
+	mode, err := ParseStorageMode("")
+	require.NoError(t, err)
+	assert.Equal(t, StorageBoth, mode)
+
+	mode, err = ParseStorageMode(" Memory ")
+	require.NoError(t, err)
+	assert.Equal(t, StorageMemory, mode)
+
+	_, err = ParseStorageMode("disk")
+	assert.Error(t, err)
+}
+
+func TestWebHandler_RetentionPrunesOldEntriesMemory(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+
+	oldID := recordStatusEntry(t, handler, "http://example.com/old", http.StatusOK, time.Now().Add(-48*time.Hour))
+	newID := recordStatusEntry(t, handler, "http://example.com/new", http.StatusOK, time.Now())
+
+	handler.cleanup()
+	assert.Equal(t, []string{oldID, newID}, entryIDs(handler.GetEntries()), "entries are kept without a retention")
+
+	handler.SetRetention(24 * time.Hour)
+	handler.cleanup()
+	assert.Equal(t, []string{newID}, entryIDs(handler.GetEntries()))
+	assert.Nil(t, handler.GetEntry(oldID))
+}
+
+func TestWebHandler_RetentionPrunesOldEntriesSQLite(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "sqlite.db"), StorageSQLite)
+	require.NoError(t, err)
+	handler.SetRetention(24 * time.Hour)
+
+	oldID := recordStatusEntry(t, handler, "http://example.com/old", http.StatusOK, time.Now().Add(-48*time.Hour))
+	newID := recordStatusEntry(t, handler, "http://example.com/new", http.StatusOK, time.Now())
+
+	handler.cleanup()
+	assert.Equal(t, []string{newID}, entryIDs(handler.GetEntries()))
+	assert.Nil(t, handler.GetEntry(oldID))
+
+	// 删除记录后执行过一次空间回收
+	assert.Zero(t, handler.deletedRows.Load())
+	assert.False(t, handler.lastReclaim.IsZero())
+}
+
+// assertListLimit 记录1500个条目，确认默认返回全部保存的条目，设置ListLimit后列表接口只返回最近的条目
+func assertListLimit(t *testing.T, handler *WebHandler) {
+	ids := recordTransactions(t, handler, 1500)
+
+	assert.Equal(t, handler.MaxEntries(), handler.ListLimit())
+	assert.Equal(t, ids, entryIDs(handler.GetEntries()), "entries past 1000 are listed by default")
+
+	handler.SetListLimit(1200)
+	assert.Equal(t, ids[300:], entryIDs(handler.GetEntries()))
+	assert.Equal(t, ids[300:], entryIDs(handler.GetEntriesAfterID("")))
+	assert.Len(t, handler.GetEntriesSorted([]SortField{{Field: "id", Desc: true}}), 1200)
+	assert.Equal(t, ids[1490:], entryIDs(handler.GetEntriesAfterID(ids[1489])))
+
+	handler.SetListLimit(0)
+	assert.Len(t, handler.GetEntries(), 1500)
+}
+
+func TestWebHandler_ListLimitMemory(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+	assertListLimit(t, handler)
+}
+
+func TestWebHandler_ListLimitSQLite(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, filepath.Join(t.TempDir(), "sqlite.db"), StorageSQLite)
+	require.NoError(t, err)
+	assertListLimit(t, handler)
+}
@@ -167,3 +167,30 @@ func TestWebHandler_GetEntriesAfterID(t *testing.T) {
 		assert.Equal(t, ids[0], entries[0].ID)
 	})
 }
+
+// TestWebHandler_SchemaFromTargetURL 测试MITM隧道中origin-form请求的Schema和HostWithSchema取自TargetURL
+func TestWebHandler_SchemaFromTargetURL(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/search%2Fv2?q=go", nil)
+	req.URL.Scheme, req.URL.Host = "", ""
+	req.Host = "example.com"
+	handler.OnRequest(&proxy.RequestContext{
+		Request:   req,
+		StartTime: time.Now(),
+		TargetURL: "https://example.com/search%2Fv2?q=go",
+		IsHTTPS:   true,
+		UserData:  make(map[string]interface{}),
+	})
+
+	entries := handler.GetEntries()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "https", entries[0].Schema)
+		assert.Equal(t, "https://example.com", entries[0].HostWithSchema)
+		assert.Equal(t, "https://example.com/search%2Fv2?q=go", entries[0].URL)
+		assert.Equal(t, "/search/v2", entries[0].Path)
+	}
+}
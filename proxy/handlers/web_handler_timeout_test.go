@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"net"
 	"net/http"
 	"path/filepath"
 	"testing"
@@ -68,6 +69,7 @@ func TestWebHandler_OnErrorMarksTimeout(t *testing.T) {
 	require.NotNil(t, entry)
 	assert.True(t, entry.IsTimeout)
 	assert.NotEmpty(t, entry.Error)
+	assert.Equal(t, string(proxy.ErrorKindTimeout), entry.ErrorKind)
 
 	handlerReloaded, err := NewWebHandler(false, dbPath)
 	require.NoError(t, err)
@@ -75,6 +77,7 @@ func TestWebHandler_OnErrorMarksTimeout(t *testing.T) {
 	entryReloaded := handlerReloaded.GetEntry(idValue)
 	require.NotNil(t, entryReloaded)
 	assert.True(t, entryReloaded.IsTimeout)
+	assert.Equal(t, string(proxy.ErrorKindTimeout), entryReloaded.ErrorKind)
 }
 
 func TestWebHandler_InitSQLite_AddsTimeoutColumn(t *testing.T) {
@@ -129,3 +132,33 @@ CREATE TABLE IF NOT EXISTS traffic_entries (
 	_, ok := reqCtx.UserData["traffic_id"]
 	assert.True(t, ok)
 }
+
+func TestWebHandler_OnErrorRecordsErrorKind(t *testing.T) {
+	handler, err := NewWebHandlerWithStorage(false, "", StorageMemory)
+	require.NoError(t, err)
+
+	record := func(err error) string {
+		req, _ := http.NewRequest("GET", "http://example.com/path", nil)
+		reqCtx := &proxy.RequestContext{
+			Request:   req,
+			StartTime: time.Now(),
+			TargetURL: req.URL.String(),
+			UserData:  make(map[string]interface{}),
+		}
+		handler.OnRequest(reqCtx)
+		handler.OnError(err, reqCtx)
+		return reqCtx.UserData["traffic_id"].(string)
+	}
+	dnsID := record(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com"}})
+	canceledID := record(context.Canceled)
+
+	assert.Equal(t, "dns", handler.GetEntry(dnsID).ErrorKind)
+	assert.Equal(t, "canceled", handler.GetEntry(canceledID).ErrorKind)
+
+	var matched []string
+	require.NoError(t, handler.EachEntry(EntryFilter{ErrorKind: "dns"}, func(entry *TrafficEntry) error {
+		matched = append(matched, entry.ID)
+		return nil
+	}))
+	assert.Equal(t, []string{dnsID}, matched)
+}
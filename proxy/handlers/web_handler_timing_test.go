@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_RecordsTimeToFirstByteAndTotalDuration(t *testing.T) {
+	const headerDelay, bodyDelay = 50 * time.Millisecond, 200 * time.Millisecond
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(headerDelay)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		time.Sleep(bodyDelay)
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Get(backend.URL + "/slow-body")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.Equal(t, "first second", string(body))
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+	assert.Greater(t, entries[0].TotalDuration, entries[0].TimeToFirstByte)
+
+	inMemory := webHandler.GetEntry(entries[0].ID)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{inMemory, stored} {
+		require.NotNil(t, entry)
+		assert.GreaterOrEqual(t, entry.TimeToFirstByte, headerDelay.Milliseconds())
+		assert.Less(t, entry.TimeToFirstByte, entry.TotalDuration)
+		assert.GreaterOrEqual(t, entry.TotalDuration, (headerDelay + bodyDelay).Milliseconds())
+		assert.LessOrEqual(t, entry.TotalDuration, entry.Duration)
+	}
+}
+
+func TestWebHandler_RecordsUpstreamConnectionReuse(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(backend.URL + "/keep-alive")
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 2)
+	first, second := entries[0], entries[1]
+	if first.StartTime.After(second.StartTime) {
+		first, second = second, first
+	}
+
+	for i, want := range []bool{false, true} {
+		id := []string{first.ID, second.ID}[i]
+		inMemory := webHandler.GetEntry(id)
+		stored, err := webHandler.loadEntry(id)
+		require.NoError(t, err)
+		for _, entry := range []*TrafficEntry{inMemory, stored} {
+			require.NotNil(t, entry)
+			assert.NotEmpty(t, entry.ConnectionID)
+			assert.Equal(t, want, entry.ConnectionReused)
+		}
+	}
+	assert.Equal(t, webHandler.GetEntry(first.ID).ConnectionID, webHandler.GetEntry(second.ID).ConnectionID)
+}
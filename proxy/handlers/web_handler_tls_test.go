@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler_RecordsNegotiatedTLSForMITMRequest(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secure"))
+	}))
+	backend.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	backend.StartTLS()
+	defer backend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13, NextProtos: []string{"http/1.1"}},
+		},
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Get(backend.URL + "/tls")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+
+	// 列表只返回摘要，TLS详情通过单条查询获取，并且需要能从SQLite中读回
+	inMemory := webHandler.GetEntry(entries[0].ID)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{inMemory, stored} {
+		require.NotNil(t, entry)
+		assert.Equal(t, "TLS 1.3", entry.TLSVersion)
+		assert.NotEmpty(t, entry.CipherSuite)
+		assert.Equal(t, "http/1.1", entry.ALPN)
+		assert.Equal(t, "TLS 1.2", entry.UpstreamTLSVersion)
+		assert.NotEmpty(t, entry.UpstreamCipherSuite)
+	}
+}
+
+func TestWebHandler_RecordsSNIMismatch(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secure"))
+	}))
+	defer backend.Close()
+
+	webHandler, err := NewWebHandler(false, filepath.Join(t.TempDir(), "traffic.db"))
+	require.NoError(t, err)
+	server, err := proxy.New(proxy.Config{EventHandler: webHandler, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: "front.example.com"},
+		},
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Get(backend.URL + "/fronted")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	entries := webHandler.GetEntries()
+	require.Len(t, entries, 1)
+
+	backendURL, _ := url.Parse(backend.URL)
+	stored, err := webHandler.loadEntry(entries[0].ID)
+	require.NoError(t, err)
+	for _, entry := range []*TrafficEntry{webHandler.GetEntry(entries[0].ID), stored} {
+		require.NotNil(t, entry)
+		assert.Equal(t, backendURL.Host, entry.ConnectHost)
+		assert.Equal(t, "front.example.com", entry.SNI)
+		assert.True(t, entry.SNIMismatch)
+	}
+}
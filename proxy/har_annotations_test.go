@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHARCommentForMITMLLMRequest(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"hi"}}]}`))
+	}))
+	defer backend.Close()
+	plainBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("plain"))
+	}))
+	defer plainBackend.Close()
+
+	harPath := filepath.Join(t.TempDir(), "annotations.har")
+	harLog := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	server, err := New(Config{HarLogger: harLog, LogWriter: io.Discard})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer := server.buildHTTPServer()
+	go func() { _ = httpServer.Serve(listener) }()
+	defer httpServer.Close()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	resp, err := client.Post(backend.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"messages":[]}`))
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	resp, err = client.Get(plainBackend.URL + "/index.html")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	require.NoError(t, harLog.Save())
+	data, err := os.ReadFile(harPath)
+	require.NoError(t, err)
+	var har harlogger.HAR
+	require.NoError(t, json.Unmarshal(data, &har))
+
+	comments := make(map[string]string)
+	for _, entry := range har.Log.Entries {
+		parsed, err := url.Parse(entry.Request.URL)
+		require.NoError(t, err)
+		comments[parsed.Path] = entry.Comment
+	}
+	assert.Equal(t, "_mode: mitm; llm: openai-compatible", comments["/v1/chat/completions"])
+	assert.Equal(t, "_mode: http", comments["/index.html"])
+}
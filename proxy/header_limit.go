@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// headerReadSlop 是读取请求头时bufio可能预读的额外字节，与net/http服务器的处理相同
+const headerReadSlop = 4096
+
+// maxHeaderBytes 返回客户端请求头和上游响应头的大小上限，为0时使用http.DefaultMaxHeaderBytes（1MB）
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes > 0 {
+		return s.MaxHeaderBytes
+	}
+	return http.DefaultMaxHeaderBytes
+}
+
+// headerLimitReader 限制读取请求头时从连接上读取的字节数，超出时返回io.EOF并记录exceeded
+// 读完请求头后调用unlimit，请求体和升级后的连接不受限制
+type headerLimitReader struct {
+	r         io.Reader
+	remaining int64
+	limited   bool
+	exceeded  bool
+}
+
+func (l *headerLimitReader) limit(n int64) {
+	l.remaining = n
+	l.limited = true
+	l.exceeded = false
+}
+
+func (l *headerLimitReader) unlimit() {
+	l.limited = false
+}
+
+func (l *headerLimitReader) Read(p []byte) (int, error) {
+	if !l.limited {
+		return l.r.Read(p)
+	}
+	if l.remaining <= 0 {
+		l.exceeded = true
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// writeRequestError 在MITM连接上回复400或431等错误，随后由调用方关闭连接
+func writeRequestError(conn net.Conn, status int) {
+	if conn == nil {
+		return
+	}
+	text := http.StatusText(status)
+	_, _ = fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		status, text, len(text), text)
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOversizedAndMalformedRequestsAreRejected(t *testing.T) {
+	server, err := New(Config{MaxHeaderBytes: 8 * 1024, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	oversized := "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\nX-Big: " + strings.Repeat("a", 64*1024) + "\r\n\r\n"
+	malformed := "GET / HTTP/1.1\r\nHost: example.com\r\nBad Header Line\r\n\r\n"
+
+	cases := []struct {
+		name   string
+		mitm   bool
+		raw    string
+		status int
+	}{
+		{"http oversized", false, oversized, http.StatusRequestHeaderFieldsTooLarge},
+		{"http malformed", false, malformed, http.StatusBadRequest},
+		{"mitm oversized", true, oversized, http.StatusRequestHeaderFieldsTooLarge},
+		{"mitm malformed", true, malformed, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rawConn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+			require.NoError(t, err)
+			defer rawConn.Close()
+			_ = rawConn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			var conn net.Conn = rawConn
+			if tc.mitm {
+				_, err = io.WriteString(rawConn, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+				require.NoError(t, err)
+				resp, err := http.ReadResponse(bufio.NewReader(rawConn), nil)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				tlsConn := tls.Client(rawConn, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+				require.NoError(t, tlsConn.Handshake())
+				conn = tlsConn
+			}
+
+			// 写入可能因服务器提前回复并关闭连接而失败，以读取到的响应为准
+			_, _ = io.WriteString(conn, tc.raw)
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			require.NoError(t, err)
+			_, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+
+			// 回复之后连接被关闭
+			_, err = reader.ReadByte()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOversizedUpstreamResponseHeaderIsGatewayError(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Big", strings.Repeat("b", 64*1024))
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	client := newViaTestClient(t, Config{MaxHeaderBytes: 8 * 1024})
+	resp, err := client.Get(backend.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// ResponseHeaderRule 是对转发给客户端的响应头执行的一项修改
+type ResponseHeaderRule struct {
+	Name   string // 规范化后的响应头名称
+	Value  string
+	Remove bool // 为true时删除该响应头的所有值，否则用Value覆盖已有的值
+}
+
+// ParseSetResponseHeader 解析 "Name: value" 形式的规则，例如 "Access-Control-Allow-Origin: *"
+func ParseSetResponseHeader(spec string) (*ResponseHeaderRule, error) {
+	name, value, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid response header %q: want \"Name: value\"", spec)
+	}
+	rule, err := StripResponseHeader(name)
+	if err != nil {
+		return nil, err
+	}
+	rule.Remove = false
+	rule.Value = strings.TrimSpace(value)
+	if !httpguts.ValidHeaderFieldValue(rule.Value) {
+		return nil, fmt.Errorf("invalid response header %q: bad value", spec)
+	}
+	return rule, nil
+}
+
+// StripResponseHeader 返回删除指定响应头的规则
+func StripResponseHeader(name string) (*ResponseHeaderRule, error) {
+	name = strings.TrimSpace(name)
+	if !httpguts.ValidHeaderFieldName(name) {
+		return nil, fmt.Errorf("invalid response header name %q", name)
+	}
+	return &ResponseHeaderRule{Name: http.CanonicalHeaderKey(name), Remove: true}, nil
+}
+
+// CSPHeaders 是 -disable-csp 删除的响应头
+var CSPHeaders = []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"}
+
+// HSTSHeaders 是 -disable-hsts 删除的响应头，避免浏览器在测试期间把该主机强制升级为HTTPS
+var HSTSHeaders = []string{"Strict-Transport-Security"}
+
+// rewriteResponseHeaders 按顺序执行ResponseHeaderRules，在记录HAR和通知EventHandler之前调用，记录的是修改后的响应头
+func (s *Server) rewriteResponseHeaders(resp *http.Response) {
+	if len(s.ResponseHeaderRules) == 0 || resp == nil {
+		return
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	for _, rule := range s.ResponseHeaderRules {
+		if rule.Remove {
+			resp.Header.Del(rule.Name)
+		} else {
+			resp.Header.Set(rule.Name, rule.Value)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responseHeaderRecorder 记录EventHandler看到的最后一个响应头
+type responseHeaderRecorder struct {
+	NoOpEventHandler
+	mu     sync.Mutex
+	header http.Header
+}
+
+func (h *responseHeaderRecorder) OnResponse(ctx *ResponseContext) *http.Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header = ctx.Response.Header.Clone()
+	return ctx.Response
+}
+
+func TestDisableCSPRemovesResponseHeader(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		w.Header().Set("Content-Security-Policy-Report-Only", "script-src 'none'")
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		_, _ = io.WriteString(w, "ok")
+	})
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(handler)
+	defer tlsBackend.Close()
+
+	var rules []*ResponseHeaderRule
+	for _, name := range CSPHeaders {
+		rule, err := StripResponseHeader(name)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	setRule, err := ParseSetResponseHeader("access-control-allow-origin: *")
+	require.NoError(t, err)
+	rules = append(rules, setRule)
+
+	recorder := &responseHeaderRecorder{}
+	client := newViaTestClient(t, Config{ResponseHeaderRules: rules, EventHandler: recorder})
+
+	for _, target := range []string{backend.URL, tlsBackend.URL} {
+		resp, err := client.Get(target)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Empty(t, resp.Header.Values("Content-Security-Policy"), target)
+		assert.Empty(t, resp.Header.Values("Content-Security-Policy-Report-Only"), target)
+		assert.Equal(t, "max-age=31536000", resp.Header.Get("Strict-Transport-Security"), target)
+		assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"), target)
+
+		recorder.mu.Lock()
+		assert.Empty(t, recorder.header.Values("Content-Security-Policy"), target)
+		assert.Equal(t, "*", recorder.header.Get("Access-Control-Allow-Origin"), target)
+		recorder.mu.Unlock()
+	}
+}
+
+func TestParseSetResponseHeader(t *testing.T) {
+	rule, err := ParseSetResponseHeader("x-frame-options:  ALLOWALL ")
+	require.NoError(t, err)
+	assert.Equal(t, &ResponseHeaderRule{Name: "X-Frame-Options", Value: "ALLOWALL"}, rule)
+
+	_, err = ParseSetResponseHeader("missing-colon")
+	assert.Error(t, err)
+	_, err = ParseSetResponseHeader("bad name: v")
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Health 是健康检查返回的代理状态，供容器编排的存活/就绪探针使用
+type Health struct {
+	Status            string    `json:"status"`
+	Version           string    `json:"version,omitempty"`
+	StartedAt         time.Time `json:"startedAt"`
+	UptimeSeconds     float64   `json:"uptimeSeconds"`
+	ActiveConnections int64     `json:"activeConnections"`
+	Mode              string    `json:"mode"`          // forward 或 reverse
+	CAInitialized     bool      `json:"caInitialized"` // MITM使用的CA是否已加载
+}
+
+// Health 返回当前的健康状态，只读取内存中的计数，开销很小
+func (s *Server) Health() Health {
+	mode := "forward"
+	if s.ReverseTarget != nil {
+		mode = "reverse"
+	}
+	return Health{
+		Status:            "ok",
+		StartedAt:         s.startedAt,
+		UptimeSeconds:     time.Since(s.startedAt).Seconds(),
+		ActiveConnections: s.activeConns.Load(),
+		Mode:              mode,
+		CAInitialized:     s.caInitialized(),
+	}
+}
+
+// caInitialized 返回是否已加载CA证书和私钥
+func (s *Server) caInitialized() bool {
+	if s.CertManager == nil {
+		return false
+	}
+	caCert, caKey, _ := s.CertManager.CA()
+	return caCert != nil && caKey != nil
+}
+
+// HealthHandler 返回以JSON输出 Health 的处理器，不经过代理逻辑，可以挂在独立的监听地址上
+func (s *Server) HealthHandler(version string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := s.Health()
+		health.Version = version
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(health)
+	})
+}
+
+// trackConns 包装监听器以统计活动的客户端连接数，被劫持的CONNECT连接在关闭前一直计入
+func (s *Server) trackConns(l net.Listener) net.Listener {
+	return &trackedListener{Listener: l, server: s}
+}
+
+type trackedListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.server.activeConns.Add(1)
+	return &releaseConn{Conn: conn, release: func() { l.server.activeConns.Add(-1) }}, nil
+}
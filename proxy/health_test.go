@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCountsActiveConnections(t *testing.T) {
+	server, err := New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	health := server.Health()
+	assert.Equal(t, "ok", health.Status)
+	assert.Equal(t, "forward", health.Mode)
+	assert.True(t, health.CAInitialized)
+	assert.Equal(t, int64(0), health.ActiveConnections)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return server.Health().ActiveConnections == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return server.Health().ActiveConnections == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHealthHandler(t *testing.T) {
+	server, err := New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	server.HealthHandler("1.2.3").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	var health Health
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &health))
+	assert.Equal(t, "ok", health.Status)
+	assert.Equal(t, "1.2.3", health.Version)
+	assert.False(t, health.StartedAt.IsZero())
+	assert.GreaterOrEqual(t, health.UptimeSeconds, 0.0)
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HostStats 是单个主机的流量统计快照
+type HostStats struct {
+	Host          string    `json:"host"`
+	Requests      int64     `json:"requests"`      // 请求数
+	Errors        int64     `json:"errors"`        // 出错次数
+	BytesSent     int64     `json:"bytesSent"`     // 发往上游的请求体字节数
+	BytesReceived int64     `json:"bytesReceived"` // 转发给客户端的响应体字节数
+	LastSeen      time.Time `json:"lastSeen"`      // 最近一次请求或响应的时间
+}
+
+// hostCounter 保存单个主机的计数器，所有字段都通过原子操作更新
+type hostCounter struct {
+	requests      atomic.Int64
+	errors        atomic.Int64
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	lastSeen      atomic.Int64 // UnixNano
+}
+
+func (c *hostCounter) touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// statsHost 规范化统计使用的主机名：转为小写并去掉默认端口，使CONNECT目标与请求Host对应同一条统计
+func statsHost(host string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil && (port == "80" || port == "443") {
+		return h
+	}
+	return host
+}
+
+// hostCounterFor 返回主机对应的计数器，不存在时创建
+func (s *Server) hostCounterFor(host string) *hostCounter {
+	key := statsHost(host)
+	if c, ok := s.hostStats.Load(key); ok {
+		return c.(*hostCounter)
+	}
+	c, _ := s.hostStats.LoadOrStore(key, &hostCounter{})
+	return c.(*hostCounter)
+}
+
+// recordHostRequest 统计一次请求及其请求体大小
+func (s *Server) recordHostRequest(req *http.Request) {
+	if req == nil {
+		return
+	}
+	c := s.hostCounterFor(req.Host)
+	c.requests.Add(1)
+	if req.ContentLength > 0 {
+		c.bytesSent.Add(req.ContentLength)
+	}
+	c.touch()
+}
+
+// recordHostError 统计一次请求错误
+func (s *Server) recordHostError(req *http.Request) {
+	if req == nil {
+		return
+	}
+	c := s.hostCounterFor(req.Host)
+	c.errors.Add(1)
+	c.touch()
+}
+
+// countResponseBody 包装响应体，在客户端读取时累计响应字节数，SSE等流式响应同样适用
+func (s *Server) countResponseBody(req *http.Request, resp *http.Response) {
+	if req == nil || resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	c := s.hostCounterFor(req.Host)
+	c.touch()
+	resp.Body = &countingBody{ReadCloser: resp.Body, counter: c}
+}
+
+// countingBody 在读取时把字节数累加到主机计数器
+type countingBody struct {
+	io.ReadCloser
+	counter *hostCounter
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.counter.bytesReceived.Add(int64(n))
+		b.counter.touch()
+	}
+	return n, err
+}
+
+// Stats 返回按主机名排序的流量统计快照
+func (s *Server) Stats() []HostStats {
+	stats := []HostStats{}
+	s.hostStats.Range(func(key, value any) bool {
+		c := value.(*hostCounter)
+		stats = append(stats, HostStats{
+			Host:          key.(string),
+			Requests:      c.requests.Load(),
+			Errors:        c.errors.Load(),
+			BytesSent:     c.bytesSent.Load(),
+			BytesReceived: c.bytesReceived.Load(),
+			LastSeen:      time.Unix(0, c.lastSeen.Load()),
+		})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return stats
+}
+
+// ResetStats 清空所有主机的统计
+func (s *Server) ResetStats() {
+	s.hostStats.Range(func(key, _ any) bool {
+		s.hostStats.Delete(key)
+		return true
+	})
+}
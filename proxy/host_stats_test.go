@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStatsPerHost(t *testing.T) {
+	server, err := New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	defer listener.Close()
+
+	backendA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer backendA.Close()
+	backendB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer backendB.Close()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	do := func(method, target, body string) {
+		req, err := http.NewRequest(method, target, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	start := time.Now()
+	do(http.MethodPost, backendA.URL+"/a", "abc")
+	do(http.MethodGet, backendA.URL+"/b", "")
+	do(http.MethodGet, backendB.URL+"/c", "")
+
+	// 连接被拒绝的主机只记录错误
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddr := closed.Addr().String()
+	closed.Close()
+	resp, err := client.Get("http://" + deadAddr + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	byHost := map[string]HostStats{}
+	for _, s := range server.Stats() {
+		byHost[s.Host] = s
+	}
+	require.Len(t, byHost, 3)
+
+	a := byHost[strings.TrimPrefix(backendA.URL, "http://")]
+	assert.Equal(t, int64(2), a.Requests)
+	assert.Equal(t, int64(0), a.Errors)
+	assert.Equal(t, int64(3), a.BytesSent)
+	assert.Equal(t, int64(10), a.BytesReceived)
+	assert.False(t, a.LastSeen.Before(start))
+
+	b := byHost[strings.TrimPrefix(backendB.URL, "http://")]
+	assert.Equal(t, int64(1), b.Requests)
+	assert.Equal(t, int64(10), b.BytesReceived)
+
+	dead := byHost[deadAddr]
+	assert.Equal(t, int64(1), dead.Requests)
+	assert.Equal(t, int64(1), dead.Errors)
+
+	server.ResetStats()
+	assert.Empty(t, server.Stats())
+}
+
+func TestStatsHostStripsDefaultPorts(t *testing.T) {
+	assert.Equal(t, "example.com", statsHost("Example.com:443"))
+	assert.Equal(t, "example.com", statsHost("example.com:80"))
+	assert.Equal(t, "example.com:8443", statsHost("example.com:8443"))
+	assert.Equal(t, "example.com", statsHost("example.com"))
+}
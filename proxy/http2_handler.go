@@ -2,10 +2,9 @@ package proxy
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"net/url"
 
 	"golang.org/x/net/http2"
 )
@@ -15,20 +14,16 @@ func (s *Server) handleHTTP2(transport *http.Transport) {
 	// Configure HTTP/2 support for the transport
 	err := http2.ConfigureTransport(transport)
 	if err != nil {
-		log.Printf("Error configuring HTTP/2 transport: %v", err)
+		s.errorf("Error configuring HTTP/2 transport: %v", err)
 		return
 	}
 
-	if s.Verbose {
-		log.Printf("HTTP/2 support enabled for transport")
-	}
+	s.debugf("HTTP/2 support enabled for transport")
 }
 
 // handleHTTP2MITM handles HTTP/2 connections
-func (s *Server) handleHTTP2MITM(tlsConn *tls.Conn, connectReq *http.Request) {
-	if s.Verbose {
-		log.Printf("[HTTP/2] Handling HTTP/2 connection for %s", connectReq.Host)
-	}
+func (s *Server) handleHTTP2MITM(tlsConn *tls.Conn, connectReq *http.Request, sni string) {
+	s.debugf("[HTTP/2] Handling HTTP/2 connection for %s", connectReq.Host)
 
 	// 通知隧道已建立
 	s.notifyTunnelEstablished(connectReq.Host, true)
@@ -41,12 +36,14 @@ func (s *Server) handleHTTP2MITM(tlsConn *tls.Conn, connectReq *http.Request) {
 		server:      server,
 		conn:        tlsConn,
 		originalReq: connectReq,
+		sni:         sni,
 		proxy:       s,
 	}
 
 	// Serve the connection
 	server.ServeConn(tlsConn, &http2.ServeConnOpts{
-		Handler: conn,
+		Handler:    conn,
+		BaseConfig: &http.Server{MaxHeaderBytes: s.maxHeaderBytes()},
 	})
 }
 
@@ -55,15 +52,16 @@ type http2MITMConn struct {
 	server      *http2.Server
 	conn        *tls.Conn
 	originalReq *http.Request
+	sni         string // 客户端ClientHello中的SNI
 	proxy       *Server
 }
 
 // ServeHTTP implements http.Handler for the HTTP/2 connection
 func (h *http2MITMConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.proxy.Verbose {
-		log.Printf("[HTTP/2] Received request: %s %s", r.Method, r.URL.String())
+	if h.proxy.logEnabled(LogLevelDebug) {
+		h.proxy.debugf("[HTTP/2] Received request: %s %s%s %s", r.Method, r.Host, r.URL.RequestURI(), r.Proto)
 	} else {
-		log.Printf("[HTTP/2] %s %s%s", r.Method, r.Host, r.URL.RequestURI())
+		h.proxy.infof("[HTTP/2] %s %s%s", r.Method, r.Host, r.URL.RequestURI())
 	}
 
 	// 检查conn是否为nil，这在测试中可能会发生
@@ -73,44 +71,52 @@ func (h *http2MITMConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a new request to the target server
-	targetURL := &url.URL{
-		Scheme:   "https",
-		Host:     h.originalReq.Host,
-		Path:     r.URL.Path,
-		RawQuery: r.URL.RawQuery,
-	}
+	targetURL := normalizeTargetURL("https", h.originalReq.Host, r.URL)
 
-	baseTransport := h.proxy.newTransport(h.originalReq.Host, true)
-	transport := h.proxy.wrapTransportForSSE(baseTransport)
+	if h.proxy.isProxyLoop(r) {
+		h.proxy.warnf("[HTTP/2] Rejecting looped request to %s (Via: %s)", targetURL, r.Header.Get("Via"))
+		http.Error(w, "Loop Detected", http.StatusLoopDetected)
+		return
+	}
 
-	proxyReq, reqCtx, potentialSSE, startTime, err := h.proxy.prepareProxyRequest(r, targetURL.String(), true)
+	r = withConnectInfo(r, h.originalReq.Host, h.sni)
+	proxyReq, reqCtx, potentialSSE, startTime, err := h.proxy.prepareProxyRequest(r, targetURL, true)
 	if err != nil {
-		log.Printf("[HTTP/2] Error creating proxy request: %v", err)
+		h.proxy.errorf("[HTTP/2] Error creating proxy request: %v", err)
 		http.Error(w, "Error creating proxy request", http.StatusInternalServerError)
 		return
 	}
 
-	logPotentialSSE(h.proxy.Verbose, "[HTTP/2]", potentialSSE)
+	h.proxy.logPotentialSSE("[HTTP/2]", potentialSSE)
+	transport := h.proxy.wrapTransportForSSE(h.proxy.roundTripperFor(h.originalReq.Host, true, potentialSSE))
 
 	resp, timeTaken, err := h.proxy.sendProxyRequest(proxyReq, transport, potentialSSE, startTime)
 	if err != nil {
-		log.Printf("[HTTP/2] Error sending request to target server %s: %v", targetURL.String(), err)
+		h.proxy.errorf("[HTTP/2] Error sending request to target server %s: %v", targetURL, err)
 		h.proxy.recordProxyError(err, reqCtx, startTime, timeTaken)
-		http.Error(w, fmt.Sprintf("Error proxying to %s: %v", targetURL.String(), err), http.StatusBadGateway)
+		if errors.Is(err, errChaosReset) {
+			abortHTTPHandler(w)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error proxying to %s: %v", targetURL, err), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	respCtx, isSSE := h.proxy.processProxyResponse(reqCtx, resp, startTime, timeTaken, "[HTTP/2]", targetURL.String())
+	respCtx, isSSE := h.proxy.processProxyResponse(reqCtx, resp, startTime, timeTaken, "[HTTP/2]", targetURL)
+	if followed, followedSSE := h.proxy.followRedirects(respCtx, isSSE, "[HTTP/2]"); followed != respCtx {
+		defer followed.Response.Body.Close()
+		respCtx, isSSE = followed, followedSSE
+	}
 
 	if isSSE {
 		if err := h.proxy.handleSSE(w, respCtx); err != nil {
-			log.Printf("[SSE] Error handling SSE response: %v", err)
+			h.proxy.errorf("[SSE] Error handling SSE response: %v", err)
 		}
 		return
 	}
 
 	if err := h.proxy.writeHTTPResponse(w, respCtx, "HTTP/2"); err != nil {
-		log.Printf("[HTTP/2] Error streaming response: %v", err)
+		h.proxy.errorf("[HTTP/2] Error streaming response: %v", err)
 	}
 }
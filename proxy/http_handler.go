@@ -1,69 +1,114 @@
 package proxy
 
 import (
-	"log"
+	"errors"
+	"io"
 	"net/http"
 	"strings"
 )
 
 // handleHTTP is the handler for all incoming HTTP requests
 func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[HTTP] Received request: %s %s %s %s", r.Method, r.Host, r.URL.String(), r.Proto)
+	s.infof("[HTTP] Received request: %s %s %s %s", r.Method, r.Host, r.URL.String(), r.Proto)
 
 	if r.Method == http.MethodConnect {
 		s.handleHTTPS(w, r)
 		return
 	}
 
+	if s.serveCAPage(w, r) {
+		return
+	}
+
 	targetURL := s.resolveTargetURL(r)
+	s.forwardRequest(w, r, targetURL, false, "[Proxy]")
+}
 
-	baseTransport := s.newTransport(r.Host, false)
-	transport := s.wrapTransportForSSE(baseTransport)
+// forwardRequest sends the request to targetURL and writes the response back,
+// running it through the same event, HAR and SSE pipeline for every entry point.
+func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, targetURL string, secure bool, logPrefix string) {
+	if s.isProxyLoop(r) {
+		s.warnf("%s Rejecting looped request to %s (Via: %s)", logPrefix, targetURL, r.Header.Get("Via"))
+		http.Error(w, "Loop Detected", http.StatusLoopDetected)
+		return
+	}
 
-	proxyReq, reqCtx, potentialSSE, startTime, err := s.prepareProxyRequest(r, targetURL, false)
+	proxyReq, reqCtx, potentialSSE, startTime, err := s.prepareProxyRequest(r, targetURL, secure)
 	if err != nil {
-		log.Printf("[Proxy] Error creating proxy request for %s: %v", targetURL, err)
+		s.errorf("%s Error creating proxy request for %s: %v", logPrefix, targetURL, err)
 		http.Error(w, "Error creating proxy request", http.StatusInternalServerError)
 		return
 	}
 
-	logPotentialSSE(s.Verbose, "[Proxy]", potentialSSE)
+	s.logPotentialSSE(logPrefix, potentialSSE)
+	transport := s.wrapTransportForSSE(s.roundTripperFor(r.Host, secure, potentialSSE))
 
 	resp, timeTaken, err := s.sendProxyRequest(proxyReq, transport, potentialSSE, startTime)
 	if err != nil {
-		log.Printf("[Proxy] Error sending request to target server %s: %v", targetURL, err)
+		s.errorf("%s Error sending request to target server %s: %v", logPrefix, targetURL, err)
 		s.recordProxyError(err, reqCtx, startTime, timeTaken)
+		if errors.Is(err, errChaosReset) {
+			abortHTTPHandler(w)
+			return
+		}
 		http.Error(w, "Error proxying to "+targetURL+": "+err.Error(), http.StatusBadGateway)
 		return
 	}
+	upgraded := takeUpgradedConn(resp)
 	defer resp.Body.Close()
 
-	respCtx, isSSE := s.processProxyResponse(reqCtx, resp, startTime, timeTaken, "[Proxy]", targetURL)
+	respCtx, isSSE := s.processProxyResponse(reqCtx, resp, startTime, timeTaken, logPrefix, targetURL)
+	if followed, followedSSE := s.followRedirects(respCtx, isSSE, logPrefix); followed != respCtx {
+		defer followed.Response.Body.Close()
+		respCtx, isSSE, reqCtx = followed, followedSSE, followed.ReqCtx
+	}
+
+	if upgraded != nil {
+		s.serveUpgrade(w, respCtx, upgraded, logPrefix)
+		return
+	}
 
 	if isSSE {
 		if err := s.handleSSE(w, respCtx); err != nil {
-			log.Printf("[SSE] Error handling SSE response: %v", err)
+			s.errorf("[SSE] Error handling SSE response: %v", err)
 			s.notifyError(err, reqCtx)
 		}
 		return
 	}
 
 	if err := s.writeHTTPResponse(w, respCtx, r.Proto); err != nil {
-		log.Printf("[Proxy] Error streaming response: %v", err)
+		s.errorf("%s Error streaming response: %v", logPrefix, err)
 	}
 }
 
-// resolveTargetURL builds the absolute target URL for the incoming request.
-func (s *Server) resolveTargetURL(r *http.Request) string {
-	if r.URL.IsAbs() {
-		return r.URL.String()
+// serveUpgrade 接管客户端连接，把101响应写回后在客户端和升级后的上游连接之间转发
+func (s *Server) serveUpgrade(w http.ResponseWriter, respCtx *ResponseContext, upgraded io.ReadWriteCloser, logPrefix string) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upgraded.Close()
+		s.errorf("%s Cannot relay protocol upgrade: %v", logPrefix, errHijackingNotSupported)
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		upgraded.Close()
+		s.errorf("%s Error hijacking connection for protocol upgrade: %v", logPrefix, err)
+		return
+	}
+	if err := s.relayUpgradedConn(clientConn, clientBuf.Reader, upgraded, respCtx); err != nil {
+		s.errorf("%s Error relaying upgraded connection: %v", logPrefix, err)
+		s.notifyError(err, respCtx.ReqCtx)
 	}
+}
 
-	targetURL := "http://" + r.Host + r.URL.Path
-	if r.URL.RawQuery != "" {
-		targetURL += "?" + r.URL.RawQuery
+// resolveTargetURL builds the absolute target URL for the incoming request,
+// accepting both absolute-form (proxy) and origin-form (Host header) request targets.
+func (s *Server) resolveTargetURL(r *http.Request) string {
+	if r.URL.IsAbs() {
+		return normalizeTargetURL(r.URL.Scheme, r.URL.Host, r.URL)
 	}
-	return targetURL
+	return normalizeTargetURL("http", r.Host, r.URL)
 }
 
 // isTextContentType 判断Content-Type是否为文本类型
@@ -3,12 +3,16 @@ package proxy
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -34,7 +38,7 @@ func (h *mockEventHandler) OnError(err error, ctx *RequestContext) {}
 
 func (h *mockEventHandler) OnTunnelEstablished(host string, isIntercepted bool) {}
 
-func (h *mockEventHandler) OnSSE(event string, ctx *ResponseContext) {}
+func (h *mockEventHandler) OnSSE(event string, ctx *ResponseContext) string { return "" }
 
 func TestServerHTTPHandlers(t *testing.T) {
 	// 创建必要的依赖项
@@ -559,3 +563,83 @@ func TestHTTPHandlerWithCompression(t *testing.T) {
 	expectedData := `{"message":"这是一个测试JSON响应","success":true,"code":200}`
 	assert.Equal(t, expectedData, string(body))
 }
+
+// TestHTTPHandlerNoDecompress 测试关闭解压后压缩响应原样转发并记录到HAR
+func TestHTTPHandlerNoDecompress(t *testing.T) {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, _ = gw.Write([]byte(`{"message":"still compressed"}`))
+	_ = gw.Close()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compressed.Bytes())
+	}))
+	defer testServer.Close()
+
+	harPath := filepath.Join(t.TempDir(), "raw.har")
+	harLog := harlogger.NewLogger(harPath, "TestProxy", "1.0")
+	server := &Server{
+		HarLogger:    harLog,
+		EventHandler: &mockEventHandler{},
+		NoDecompress: true,
+	}
+
+	req, err := http.NewRequest("GET", testServer.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	server.handleHTTP(recorder, req)
+
+	resp := recorder.Result()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, compressed.Bytes(), body)
+
+	require.NoError(t, harLog.Save())
+	data, err := os.ReadFile(harPath)
+	require.NoError(t, err)
+	var har harlogger.HAR
+	require.NoError(t, json.Unmarshal(data, &har))
+	entries := har.Log.Entries
+	require.Len(t, entries, 1)
+	content := entries[0].Response.Content
+	assert.Equal(t, "base64", content.Encoding)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(compressed.Bytes()), content.Text)
+	assert.Equal(t, "content-encoding: gzip", content.Comment)
+
+	var encoding string
+	for _, header := range entries[0].Response.Headers {
+		if strings.EqualFold(header.Name, "Content-Encoding") {
+			encoding = header.Value
+		}
+	}
+	assert.Equal(t, "gzip", encoding)
+}
+
+func TestRedirectsArePassedToClient(t *testing.T) {
+	var finalRequests int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		finalRequests++
+		_, _ = io.WriteString(w, "new")
+	}))
+	defer backend.Close()
+
+	client := newViaTestClient(t, Config{})
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(backend.URL + "/old")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// 代理不自行跟随重定向，由客户端决定是否请求Location
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/new", resp.Header.Get("Location"))
+	assert.Zero(t, finalRequests)
+}
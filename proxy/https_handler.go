@@ -6,34 +6,66 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
-	"net/url"
+	"net/http/httputil"
+	"strconv"
 	"strings"
-
-	"github.com/LubyRuffy/ProxyCraft/certs"
 )
 
 var (
 	errSSEStreamHandled      = errors.New("sse stream handled")
 	errHijackingNotSupported = errors.New("hijacking not supported")
+	errCloseAfterResponse    = errors.New("connection closed after response")
 )
 
 // handleHTTPS handles CONNECT requests for MITM or direct tunneling
 func (s *Server) handleHTTPS(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received CONNECT request for: %s", r.Host)
+	s.infof("Received CONNECT request for: %s", r.Host)
+
+	if s.isProxyLoop(r) {
+		s.warnf("Rejecting looped CONNECT to %s (Via: %s)", r.Host, r.Header.Get("Via"))
+		http.Error(w, "Loop Detected", http.StatusLoopDetected)
+		return
+	}
+
+	// 之前拒绝过MITM证书的主机直接建立隧道
+	if hostPort := ensurePort(r.Host); s.shouldPassthrough(hostPort) {
+		s.infof("Tunneling CONNECT to %s without interception", hostPort)
+		if err := s.tunnelCONNECT(w, r, hostPort); err != nil {
+			s.errorf("Failed to tunnel CONNECT to %s: %v", hostPort, err)
+		}
+		return
+	}
+
+	// 设置了MITMProcesses时，其他进程发起的连接直接建立隧道
+	if intercept, process := s.interceptsProcess(r.RemoteAddr); !intercept {
+		hostPort := ensurePort(r.Host)
+		s.infof("Tunneling CONNECT to %s from process %q without interception", hostPort, process)
+		if err := s.tunnelCONNECT(w, r, hostPort); err != nil {
+			s.errorf("Failed to tunnel CONNECT to %s: %v", hostPort, err)
+		}
+		return
+	}
 
 	session, err := newHTTPSConnectSession(s, w, r)
 	if err != nil {
 		if errors.Is(err, errHijackingNotSupported) {
 			http.Error(w, "hijacking not supported", http.StatusInternalServerError)
 		}
-		log.Printf("Failed to establish CONNECT session for %s: %v", r.Host, err)
+		if s.AutoPassthrough && errors.Is(err, errClientRejectedCert) {
+			s.rememberPassthrough(ensurePort(r.Host))
+		}
+		s.errorf("Failed to establish CONNECT session for %s: %v", r.Host, err)
 		return
 	}
 	defer session.Close()
 
+	if session.plain {
+		session.tunnelPlain()
+		return
+	}
+
 	session.logNegotiatedProtocol()
 
 	if session.usesHTTP2() {
@@ -42,7 +74,7 @@ func (s *Server) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := session.proxyHTTP1(); err != nil {
-		log.Printf("[MITM for %s] Error handling tunneled requests: %v", r.Host, err)
+		s.errorf("[MITM for %s] Error handling tunneled requests: %v", r.Host, err)
 	}
 }
 
@@ -54,11 +86,17 @@ type httpsConnectSession struct {
 	rawConn         net.Conn
 	tlsConn         *tls.Conn
 	negotiatedProto string
+	sni             string
+
+	// plain 表示客户端发送的不是TLS ClientHello，会话只在客户端和CONNECT目标之间原样转发，rawConn带有已读取的数据
+	plain bool
+
+	// clientReader 读取隧道内的请求，协议升级后其中缓冲的数据继续转发给上游
+	clientReader *bufio.Reader
 }
 
 func newHTTPSConnectSession(server *Server, w http.ResponseWriter, r *http.Request) (*httpsConnectSession, error) {
 	hostPort := ensurePort(r.Host)
-	server.notifyTunnelEstablished(hostPort, true)
 
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
@@ -77,7 +115,27 @@ func newHTTPSConnectSession(server *Server, w http.ResponseWriter, r *http.Reque
 
 	hostname := extractHostname(r.Host)
 
-	tlsConn, negotiatedProto, err := server.startMITMTLS(rawConn, hostname, r.RemoteAddr)
+	// 只对以TLS ClientHello开头的连接做MITM，其他TCP协议直接转发到CONNECT的目标端口
+	clientConn := &bufferedConn{Conn: rawConn, reader: rw.Reader}
+	isTLS, err := peekClientHello(rawConn, rw.Reader, tlsPeekTimeout)
+	if err != nil {
+		_ = rawConn.Close()
+		return nil, fmt.Errorf("read first bytes from client: %w", err)
+	}
+	if !isTLS {
+		server.notifyTunnelEstablished(hostPort, false)
+		return &httpsConnectSession{
+			server:     server,
+			connectReq: r,
+			hostPort:   hostPort,
+			hostname:   hostname,
+			rawConn:    clientConn,
+			plain:      true,
+		}, nil
+	}
+	server.notifyTunnelEstablished(hostPort, true)
+
+	tlsConn, negotiatedProto, sni, err := server.startMITMTLS(clientConn, hostname, r.RemoteAddr)
 	if err != nil {
 		_ = rawConn.Close()
 		return nil, err
@@ -91,6 +149,7 @@ func newHTTPSConnectSession(server *Server, w http.ResponseWriter, r *http.Reque
 		rawConn:         rawConn,
 		tlsConn:         tlsConn,
 		negotiatedProto: negotiatedProto,
+		sni:             sni,
 	}, nil
 }
 
@@ -105,14 +164,14 @@ func (s *httpsConnectSession) Close() {
 }
 
 func (s *httpsConnectSession) logNegotiatedProtocol() {
-	if !s.server.Verbose {
+	if !s.server.logEnabled(LogLevelDebug) {
 		return
 	}
 	proto := s.negotiatedProto
 	if proto == "" {
 		proto = "http/1.1"
 	}
-	log.Printf("[MITM for %s] Negotiated protocol: %s", s.connectReq.Host, proto)
+	s.server.debugf("[MITM for %s] Negotiated protocol: %s", s.connectReq.Host, proto)
 }
 
 func (s *httpsConnectSession) usesHTTP2() bool {
@@ -120,77 +179,123 @@ func (s *httpsConnectSession) usesHTTP2() bool {
 }
 
 func (s *httpsConnectSession) proxyHTTP2() {
-	s.server.handleHTTP2MITM(s.tlsConn, s.connectReq)
+	s.server.handleHTTP2MITM(s.tlsConn, s.connectReq, s.sni)
 }
 
 func (s *httpsConnectSession) proxyHTTP1() error {
-	defer func() {
-		if s.server.Verbose {
-			log.Printf("[MITM for %s] Exiting MITM processing loop.", s.connectReq.Host)
-		}
-	}()
+	defer s.server.debugf("[MITM for %s] Exiting MITM processing loop.", s.connectReq.Host)
 
-	clientReader := bufio.NewReader(s.tlsConn)
+	headerLimit := &headerLimitReader{r: s.tlsConn}
+	s.clientReader = bufio.NewReader(headerLimit)
 	for {
-		tunneledReq, err := http.ReadRequest(clientReader)
+		headerLimit.limit(int64(s.server.maxHeaderBytes()) + headerReadSlop)
+		tunneledReq, err := http.ReadRequest(s.clientReader)
+		headerLimit.unlimit()
 		if err != nil {
+			if headerLimit.exceeded {
+				s.server.warnf("[MITM for %s] Request headers exceed %d bytes, closing connection", s.connectReq.Host, s.server.maxHeaderBytes())
+				writeRequestError(s.tlsConn, http.StatusRequestHeaderFieldsTooLarge)
+				return nil
+			}
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				log.Printf("[MITM for %s] Client closed connection or EOF: %v", s.connectReq.Host, err)
+				s.server.debugf("[MITM for %s] Client closed connection or EOF: %v", s.connectReq.Host, err)
 				return nil
 			}
 			if opError, ok := err.(*net.OpError); ok && opError.Err != nil && opError.Err.Error() == "tls: use of closed connection" {
-				log.Printf("[MITM for %s] TLS connection closed by client: %v", s.connectReq.Host, err)
+				s.server.debugf("[MITM for %s] TLS connection closed by client: %v", s.connectReq.Host, err)
 				return nil
 			}
-			log.Printf("[MITM for %s] Error reading request from client: %v", s.connectReq.Host, err)
+			var netErr net.Error
+			if !errors.As(err, &netErr) {
+				// 请求行或请求头格式错误，回复400后关闭连接
+				s.server.warnf("[MITM for %s] Malformed request from client, closing connection: %v", s.connectReq.Host, err)
+				writeRequestError(s.tlsConn, http.StatusBadRequest)
+				return nil
+			}
+			s.server.warnf("[MITM for %s] Error reading request from client: %v", s.connectReq.Host, err)
 			return fmt.Errorf("read tunneled request: %w", err)
 		}
 
-		log.Printf("[MITM for %s] Received tunneled request: %s %s%s %s",
+		s.server.infof("[MITM for %s] Received tunneled request: %s %s%s %s",
 			s.connectReq.Host,
 			tunneledReq.Method,
 			tunneledReq.Host,
-			tunneledReq.URL.String(),
+			tunneledReq.URL.RequestURI(),
 			tunneledReq.Proto,
 		)
 
 		if err := s.handleTunneledRequest(tunneledReq); err != nil {
-			if errors.Is(err, errSSEStreamHandled) {
+			if errors.Is(err, errSSEStreamHandled) || errors.Is(err, errCloseAfterResponse) {
 				return nil
 			}
 			return err
 		}
+
+		// 客户端发送了 Connection: close，或是没有 keep-alive 的HTTP/1.0请求，回复后关闭连接而不是等待下一个请求
+		if tunneledReq.Close {
+			s.server.debugf("[MITM for %s] Client requested connection close after %s %s", s.connectReq.Host, tunneledReq.Method, tunneledReq.URL.RequestURI())
+			return nil
+		}
 	}
 }
 
 func (s *httpsConnectSession) handleTunneledRequest(tunneledReq *http.Request) error {
-	targetURL := &url.URL{
-		Scheme:   "https",
-		Host:     s.connectReq.Host,
-		Path:     tunneledReq.URL.Path,
-		RawQuery: tunneledReq.URL.RawQuery,
+	// 请求行可能是origin-form或absolute-form，目标主机总是CONNECT的主机
+	targetURL := normalizeTargetURL("https", s.connectReq.Host, tunneledReq.URL)
+
+	// http.ReadRequest不会填充TLS，补上与客户端协商的连接状态供处理器读取
+	state := s.tlsConn.ConnectionState()
+	tunneledReq.TLS = &state
+	tunneledReq = withConnectInfo(tunneledReq, s.connectReq.Host, s.sni)
+
+	// http.ReadRequest不会处理Expect: 100-continue，在转发请求体时才向客户端发送100 Continue
+	var sender *continueSender
+	if expectsContinue(tunneledReq) {
+		sender = &continueSender{ReadCloser: tunneledReq.Body, conn: s.tlsConn, proto: tunneledReq.Proto}
+		tunneledReq.Body = sender
 	}
 
-	baseTransport := s.server.newTransport(s.connectReq.Host, true)
-	transport := s.server.wrapTransportForSSE(baseTransport)
+	if s.server.isProxyLoop(tunneledReq) {
+		s.server.warnf("[MITM for %s] Rejecting looped request (Via: %s)", s.connectReq.Host, tunneledReq.Header.Get("Via"))
+		writeLoopDetected(s.tlsConn, tunneledReq.Proto)
+		return errCloseAfterResponse
+	}
 
-	proxyReq, reqCtx, potentialSSE, startTime, err := s.server.prepareProxyRequest(tunneledReq, targetURL.String(), true)
+	proxyReq, reqCtx, potentialSSE, startTime, err := s.server.prepareProxyRequest(tunneledReq, targetURL, true)
 	if err != nil {
 		writeGatewayError(s.tlsConn, s.connectReq.Proto)
 		return fmt.Errorf("create proxy request: %w", err)
 	}
 
-	logPotentialSSE(s.server.Verbose, "[Proxy]", potentialSSE)
+	s.server.logPotentialSSE("[Proxy]", potentialSSE)
+	transport := s.server.wrapTransportForSSE(s.server.roundTripperFor(s.connectReq.Host, true, potentialSSE))
 
 	resp, timeTaken, err := s.server.sendProxyRequest(proxyReq, transport, potentialSSE, startTime)
 	if err != nil {
 		s.server.recordProxyError(err, reqCtx, startTime, timeTaken)
+		if errors.Is(err, errChaosReset) {
+			resetConn(s.tlsConn)
+			return errCloseAfterResponse
+		}
 		writeGatewayError(s.tlsConn, s.connectReq.Proto)
 		return fmt.Errorf("send proxy request: %w", err)
 	}
+	upgraded := takeUpgradedConn(resp)
 	defer resp.Body.Close()
 
-	respCtx, isSSE := s.server.processProxyResponse(reqCtx, resp, startTime, timeTaken, "[Proxy]", targetURL.String())
+	respCtx, isSSE := s.server.processProxyResponse(reqCtx, resp, startTime, timeTaken, "[Proxy]", targetURL)
+	if followed, followedSSE := s.server.followRedirects(respCtx, isSSE, "[Proxy]"); followed != respCtx {
+		defer followed.Response.Body.Close()
+		respCtx, isSSE, reqCtx = followed, followedSSE, followed.ReqCtx
+	}
+
+	if upgraded != nil {
+		if err := s.server.relayUpgradedConn(s.tlsConn, s.clientReader, upgraded, respCtx); err != nil {
+			s.server.notifyError(err, reqCtx)
+			return fmt.Errorf("relay upgraded connection: %w", err)
+		}
+		return errCloseAfterResponse
+	}
 
 	if isSSE {
 		if err := s.server.streamSSEOverTLS(s.tlsConn, respCtx, s.connectReq.Proto); err != nil {
@@ -200,10 +305,19 @@ func (s *httpsConnectSession) handleTunneledRequest(tunneledReq *http.Request) e
 		return errSSEStreamHandled
 	}
 
+	// 上游未接受请求体时客户端不会上传，连接上的剩余数据无法确定，回复后关闭连接
+	declined := sender != nil && !sender.sent.Load()
+	if declined || tunneledReq.Close {
+		respCtx.Response.Header.Set("Connection", "close")
+	}
+
 	if err := s.server.tunnelHTTPSResponse(s.tlsConn, respCtx.Response, reqCtx); err != nil {
 		return fmt.Errorf("tunnel HTTPS response: %w", err)
 	}
 
+	if declined {
+		return errCloseAfterResponse
+	}
 	return nil
 }
 
@@ -220,87 +334,104 @@ func sendConnectionEstablished(r *http.Request, rw *bufio.ReadWriter) error {
 	return nil
 }
 
-func (s *Server) startMITMTLS(conn net.Conn, hostname, clientAddr string) (*tls.Conn, string, error) {
+// startMITMTLS 与客户端完成TLS握手，返回协商的ALPN协议和客户端ClientHello中的SNI
+func (s *Server) startMITMTLS(conn net.Conn, hostname, clientAddr string) (*tls.Conn, string, string, error) {
 	tlsConfig, err := s.tlsConfigForHost(hostname)
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
+	}
+
+	// 记录ClientHello中的SNI，用于发现与CONNECT主机不一致的连接（域前置、客户端配置错误等）
+	var sni string
+	var helloReceived bool
+	tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni = hello.ServerName
+		helloReceived = true
+		return nil, nil
 	}
 
 	tlsConn := tls.Server(conn, tlsConfig)
 	if err := tlsConn.Handshake(); err != nil {
-		log.Printf("TLS handshake error with client %s for host %s: %v", clientAddr, hostname, err)
+		s.warnf("TLS handshake error with client %s for host %s: %v", clientAddr, hostname, err)
 		if strings.Contains(err.Error(), "bad certificate") {
-			log.Printf("TLS MITM hint: ensure the ProxyCraft Root CA in system trust store matches %s", certs.MustGetCACertPath())
-			log.Printf("TLS MITM hint: restart the client after updating trust; some apps (e.g. Firefox) use their own trust store")
+			if caCert, _, _ := s.CertManager.CA(); caCert != nil {
+				s.warnf("TLS MITM hint: ensure the system trust store contains the CA %q used by this proxy", caCert.Subject.CommonName)
+			}
+			s.warnf("TLS MITM hint: restart the client after updating trust; some apps (e.g. Firefox) use their own trust store")
 		}
-		return nil, "", err
+		// 收到ClientHello并发出证书后客户端才中止握手，说明证书被拒绝
+		if helloReceived && isClientCertRejection(err) {
+			return nil, "", "", fmt.Errorf("%w: %v", errClientRejectedCert, err)
+		}
+		return nil, "", "", err
 	}
 
-	log.Printf("Successfully completed TLS handshake with client for %s", hostname)
+	s.debugf("Successfully completed TLS handshake with client for %s", hostname)
+	if sniMismatch(hostname, sni) {
+		s.warnf("[MITM for %s] Client %s sent SNI %q that does not match the CONNECT host", hostname, clientAddr, sni)
+	}
 
 	state := tlsConn.ConnectionState()
-	return tlsConn, state.NegotiatedProtocol, nil
+	return tlsConn, state.NegotiatedProtocol, sni, nil
 }
 
 func (s *Server) tlsConfigForHost(hostname string) (*tls.Config, error) {
-	log.Printf("Generating certificate for hostname: %s", hostname)
-	serverCert, serverKey, err := s.CertManager.GenerateServerCert(hostname)
+	s.debugf("Generating certificate for hostname: %s", hostname)
+	serverCert, err := s.CertManager.GenerateServerTLSCert(hostname)
 	if err != nil {
-		log.Printf("Error generating server certificate for %s: %v", hostname, err)
+		s.errorf("Error generating server certificate for %s: %v", hostname, err)
 		return nil, err
 	}
 
-	return &tls.Config{
-		Certificates: []tls.Certificate{
-			{
-				Certificate: [][]byte{serverCert.Raw},
-				PrivateKey:  serverKey,
-			},
-		},
-		MinVersion: tls.VersionTLS12,
-		MaxVersion: tls.VersionTLS13,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-		},
-		NextProtos: []string{"h2", "http/1.1"},
-	}, nil
+	// 使用中间CA签发时，证书链为 [叶子证书, 中间证书...]
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{*serverCert},
+	}
+	s.applyClientTLSSettings(tlsConfig)
+	return tlsConfig, nil
 }
 
+// ensurePort 为CONNECT目标补上默认的443端口，支持 [::1] 和 ::1 这类不带端口的IPv6地址
 func ensurePort(host string) string {
-	if strings.Contains(host, ":") {
+	if _, _, err := net.SplitHostPort(host); err == nil {
 		return host
 	}
-	return host + ":443"
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), "443")
 }
 
+// extractHostname 去掉端口和IPv6地址的方括号，返回用于签发证书的主机名或IP
 func extractHostname(host string) string {
 	if name, _, err := net.SplitHostPort(host); err == nil {
 		return name
 	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// urlHost 返回可以放入URL的主机部分，不带方括号的IPv6地址会被加上方括号
+func urlHost(host string) string {
+	if ip := net.ParseIP(host); ip != nil && strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
 	return host
 }
 
 func (s *Server) tunnelHTTPSResponse(clientConn *tls.Conn, resp *http.Response, reqCtx *RequestContext) error {
-	// 创建一个用于存储响应头的映射
-	respHeader := make(http.Header)
+	// 先处理压缩的响应体，响应头和消息边界都以处理后的响应体为准
+	s.processCompressedResponse(resp, reqCtx, s.logEnabled(LogLevelDebug))
+	if reqCtx != nil {
+		s.recompressResponse(resp, reqCtx.Request)
+	}
 
 	// 复制响应头
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			respHeader.Add(k, v)
-		}
+	respHeader := resp.Header.Clone()
+	if respHeader == nil {
+		respHeader = make(http.Header)
 	}
 
 	// 添加协议版本头以便前端识别
 	respHeader.Add("X-Protocol", resp.Request.Proto)
 
-	// 处理压缩的响应体
-	s.processCompressedResponse(resp, reqCtx, s.Verbose)
+	chunked, closeAfter := applyResponseFraming(respHeader, resp, reqCtx)
 
 	// 写入响应状态行
 	statusLine := fmt.Sprintf("%s %s\r\n", resp.Proto, resp.Status)
@@ -324,29 +455,73 @@ func (s *Server) tunnelHTTPSResponse(clientConn *tls.Conn, resp *http.Response,
 	}
 
 	// 写入响应体
-	if resp.Body != nil {
+	if resp.Body != nil && !ResponseHasNoBody(resp) {
+		var writer io.Writer = clientConn
+		var chunkedWriter io.WriteCloser
+		if chunked {
+			chunkedWriter = httputil.NewChunkedWriter(clientConn)
+			writer = chunkedWriter
+		}
+
 		// 使用通用的流式传输函数处理响应
 		contentType := resp.Header.Get("Content-Type")
-		_, err := s.streamResponse(resp.Body, clientConn, contentType, s.Verbose)
+		_, err := s.streamResponse(resp.Body, writer, contentType, s.logEnabled(LogLevelDebug))
 		if err != nil {
 			return fmt.Errorf("流式传输响应出错: %w", err)
 		}
+
+		// 写入最后一个空块和结束的空行
+		if chunkedWriter != nil {
+			if err := chunkedWriter.Close(); err != nil {
+				return fmt.Errorf("写入chunked结束块出错: %w", err)
+			}
+			if _, err := clientConn.Write([]byte("\r\n")); err != nil {
+				return fmt.Errorf("写入chunked结束块出错: %w", err)
+			}
+		}
 	}
 
+	if closeAfter {
+		return errCloseAfterResponse
+	}
 	return nil
 }
 
+// applyResponseFraming 根据处理后的响应体设置发给客户端的消息边界，Content-Length和chunked编码只会出现一个
+// 长度确定时只发送Content-Length；长度未知时HTTP/1.1客户端使用chunked编码，HTTP/1.0客户端在响应结束后关闭连接
+// 返回是否需要按chunked编码写入响应体，以及写完响应后是否需要关闭连接
+func applyResponseFraming(header http.Header, resp *http.Response, reqCtx *RequestContext) (chunked bool, closeAfter bool) {
+	header.Del("Transfer-Encoding")
+
+	switch {
+	case ResponseHasNoBody(resp):
+		// 没有响应体，HEAD响应保留上游的Content-Length
+		return false, false
+	case resp.ContentLength >= 0:
+		header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		return false, false
+	}
+
+	header.Del("Content-Length")
+	if reqCtx != nil && reqCtx.Request != nil && !reqCtx.Request.ProtoAtLeast(1, 1) {
+		header.Set("Connection", "close")
+		return false, true
+	}
+	header.Set("Transfer-Encoding", "chunked")
+	return true, false
+}
+
 func (s *Server) streamSSEOverTLS(conn *tls.Conn, respCtx *ResponseContext, clientProto string) error {
 	if conn == nil || respCtx == nil || respCtx.Response == nil {
 		return fmt.Errorf("invalid SSE context")
 	}
 
-	if s.Verbose {
+	if s.logEnabled(LogLevelDebug) {
 		target := ""
 		if respCtx.Response.Request != nil && respCtx.Response.Request.URL != nil {
 			target = respCtx.Response.Request.URL.String()
 		}
-		log.Printf("[Proxy] Detected Server-Sent Events response from %s", target)
+		s.debugf("[Proxy] Detected Server-Sent Events response from %s", target)
 	}
 
 	writer := newTLSResponseWriter(conn, clientProto)
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"crypto/rand"
@@ -89,6 +90,228 @@ func TestHTTPSHandler(t *testing.T) {
 	assert.Contains(t, string(body), "Hello from HTTPS server")
 }
 
+// newMITMTestClient 启动开启MITM的代理并返回通过它访问HTTPS的客户端
+func newMITMTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	server, err := New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	transport := &http.Transport{
+		Proxy:              http.ProxyURL(proxyURL),
+		TLSClientConfig:    &tls.Config{InsecureSkipVerify: true},
+		DisableCompression: true,
+		MaxConnsPerHost:    1,
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+func TestHTTPSMITMGzipResponseContentLength(t *testing.T) {
+	const payload = `{"message":"gzip body with upstream content-length","status":"success"}`
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err := gzipWriter.Write([]byte(payload))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", fmt.Sprint(compressed.Len()))
+		w.Write(compressed.Bytes())
+	}))
+	defer backend.Close()
+
+	client := newMITMTestClient(t)
+
+	// 同一个keep-alive连接上连续发送两次请求，Content-Length不正确时第二次请求会读取错位或超时
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(backend.URL)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, payload, string(body))
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, int64(len(payload)), resp.ContentLength)
+	}
+}
+
+func TestHTTPSMITMChunkedResponseFraming(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "part-%d;", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer backend.Close()
+
+	client := newMITMTestClient(t)
+
+	// 上游未给出长度时应以chunked编码转发，连接可以继续复用
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(backend.URL)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, "part-0;part-1;part-2;", string(body))
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	}
+}
+
+func TestHTTPSMITMClosesConnectionWhenRequested(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	backendHost := backend.Listener.Addr().String()
+
+	server, err := New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	cases := []struct {
+		name      string
+		request   string
+		wantClose bool
+	}{
+		{"http1.0", "GET / HTTP/1.0\r\nHost: " + backendHost + "\r\n\r\n", true},
+		{"connection close", "GET / HTTP/1.1\r\nHost: " + backendHost + "\r\nConnection: close\r\n\r\n", true},
+		{"keep-alive", "GET / HTTP/1.1\r\nHost: " + backendHost + "\r\n\r\n", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			_, err = io.WriteString(conn, "CONNECT "+backendHost+" HTTP/1.1\r\nHost: "+backendHost+"\r\n\r\n")
+			require.NoError(t, err)
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+			require.NoError(t, tlsConn.Handshake())
+			_, err = io.WriteString(tlsConn, tc.request)
+			require.NoError(t, err)
+
+			tlsReader := bufio.NewReader(tlsConn)
+			resp, err = http.ReadResponse(tlsReader, nil)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, "ok", string(body))
+
+			if !tc.wantClose {
+				// 保持连接时代理等待下一个请求，读取只会超时
+				assert.False(t, resp.Close)
+				_ = tlsConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+				_, err = tlsReader.ReadByte()
+				var netErr net.Error
+				require.ErrorAs(t, err, &netErr)
+				assert.True(t, netErr.Timeout())
+				return
+			}
+			assert.True(t, resp.Close, "the response must announce Connection: close")
+			_, err = tlsReader.ReadByte()
+			assert.ErrorIs(t, err, io.EOF, "the proxy must close the connection after one response")
+		})
+	}
+}
+
+func TestApplyResponseFraming(t *testing.T) {
+	newCtx := func(major, minor int) *RequestContext {
+		return &RequestContext{Request: &http.Request{Method: http.MethodGet, ProtoMajor: major, ProtoMinor: minor}}
+	}
+
+	t.Run("definite length", func(t *testing.T) {
+		header := http.Header{"Transfer-Encoding": {"chunked"}, "Content-Length": {"999"}}
+		resp := &http.Response{StatusCode: 200, ContentLength: 12, Request: &http.Request{Method: http.MethodGet}}
+		chunked, closeAfter := applyResponseFraming(header, resp, newCtx(1, 1))
+		assert.False(t, chunked)
+		assert.False(t, closeAfter)
+		assert.Equal(t, "12", header.Get("Content-Length"))
+		assert.Empty(t, header.Get("Transfer-Encoding"))
+	})
+
+	t.Run("unknown length http/1.1", func(t *testing.T) {
+		header := http.Header{"Content-Length": {"999"}}
+		resp := &http.Response{StatusCode: 200, ContentLength: -1, Request: &http.Request{Method: http.MethodGet}}
+		chunked, closeAfter := applyResponseFraming(header, resp, newCtx(1, 1))
+		assert.True(t, chunked)
+		assert.False(t, closeAfter)
+		assert.Empty(t, header.Get("Content-Length"))
+		assert.Equal(t, "chunked", header.Get("Transfer-Encoding"))
+	})
+
+	t.Run("unknown length http/1.0", func(t *testing.T) {
+		header := make(http.Header)
+		resp := &http.Response{StatusCode: 200, ContentLength: -1, Request: &http.Request{Method: http.MethodGet}}
+		chunked, closeAfter := applyResponseFraming(header, resp, newCtx(1, 0))
+		assert.False(t, chunked)
+		assert.True(t, closeAfter)
+		assert.Equal(t, "close", header.Get("Connection"))
+		assert.Empty(t, header.Get("Transfer-Encoding"))
+	})
+
+	t.Run("head keeps content-length", func(t *testing.T) {
+		header := http.Header{"Content-Length": {"42"}}
+		resp := &http.Response{StatusCode: 200, ContentLength: 42, Request: &http.Request{Method: http.MethodHead}}
+		chunked, closeAfter := applyResponseFraming(header, resp, newCtx(1, 1))
+		assert.False(t, chunked)
+		assert.False(t, closeAfter)
+		assert.Equal(t, "42", header.Get("Content-Length"))
+	})
+}
+
+func TestConnectTargetHostParsing(t *testing.T) {
+	tests := []struct {
+		connectHost string
+		hostPort    string
+		hostname    string
+		targetURL   string
+	}{
+		{connectHost: "[2606:2800::1]:443", hostPort: "[2606:2800::1]:443", hostname: "2606:2800::1", targetURL: "https://[2606:2800::1]:443/"},
+		{connectHost: "[::1]", hostPort: "[::1]:443", hostname: "::1", targetURL: "https://[::1]/"},
+		{connectHost: "::1", hostPort: "[::1]:443", hostname: "::1", targetURL: "https://[::1]/"},
+		{connectHost: "127.0.0.1", hostPort: "127.0.0.1:443", hostname: "127.0.0.1", targetURL: "https://127.0.0.1/"},
+		{connectHost: "example.com", hostPort: "example.com:443", hostname: "example.com", targetURL: "https://example.com/"},
+		{connectHost: "example.com:8443", hostPort: "example.com:8443", hostname: "example.com", targetURL: "https://example.com:8443/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.connectHost, func(t *testing.T) {
+			assert.Equal(t, tt.hostPort, ensurePort(tt.connectHost))
+			assert.Equal(t, tt.hostname, extractHostname(tt.connectHost))
+
+			targetURL := &url.URL{Scheme: "https", Host: urlHost(tt.connectHost), Path: "/"}
+			assert.Equal(t, tt.targetURL, targetURL.String())
+			parsed, err := url.Parse(targetURL.String())
+			require.NoError(t, err)
+			assert.Equal(t, tt.hostname, parsed.Hostname())
+
+			transport := (&Server{}).newTransport(tt.connectHost, true)
+			assert.Equal(t, tt.hostname, transport.TLSClientConfig.ServerName)
+		})
+	}
+}
+
 func TestHTTPSMITMSystemTrust(t *testing.T) {
 	if runtime.GOOS != "darwin" {
 		t.Skip("system trust verification requires macOS")
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// DetectLLMProvider 根据主机名和路径识别常见的LLM服务提供方，无法识别时返回空字符串
+// 返回值为 openai、claude、gemini、ollama 或 openai-compatible
+func DetectLLMProvider(host, path string) string {
+	host = strings.ToLower(host)
+	path = strings.ToLower(path)
+
+	if strings.Contains(host, "openai") {
+		return "openai"
+	}
+	if strings.Contains(host, "anthropic") || strings.Contains(host, "claude") || strings.Contains(path, "/v1/messages") || strings.Contains(path, "/v1/complete") {
+		return "claude"
+	}
+	if strings.Contains(host, "generativelanguage") || strings.Contains(path, "generatecontent") || strings.Contains(path, "streamgeneratecontent") {
+		return "gemini"
+	}
+	if strings.Contains(host, "ollama") || strings.Contains(path, "/api/generate") || strings.Contains(path, "/api/chat") {
+		return "ollama"
+	}
+	if strings.Contains(path, "/responses") {
+		return "openai-compatible"
+	}
+	if strings.Contains(path, "/v1/chat/completions") || strings.Contains(path, "/v1/completions") || strings.Contains(path, "/v1/responses") {
+		return "openai-compatible"
+	}
+	return ""
+}
+
+// llmProviders 是LLMHosts中可以指定的提供方，与DetectLLMProvider的返回值一致
+var llmProviders = []string{"openai", "claude", "gemini", "ollama", "openai-compatible"}
+
+// LLMHosts 是额外声明为LLM服务的主机，用于识别DetectLLMProvider认不出的自建或内网端点
+// 每一项为 pattern[=provider]，pattern 可以是 host:port、host、*.example.com 或 *，provider 缺省为 openai-compatible
+// 多个模式匹配时按Config.Transports的规则选择最具体的一项
+type LLMHosts struct {
+	providers map[string]string // 小写的模式到提供方
+}
+
+// ParseLLMHosts 解析逗号分隔的LLM主机列表，空列表返回nil
+func ParseLLMHosts(values ...string) (*LLMHosts, error) {
+	hosts := &LLMHosts{providers: make(map[string]string)}
+	for _, raw := range values {
+		for _, part := range strings.Split(raw, ",") {
+			pattern, provider, hasProvider := strings.Cut(strings.TrimSpace(part), "=")
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			provider = strings.ToLower(strings.TrimSpace(provider))
+			if pattern == "" {
+				if hasProvider {
+					return nil, fmt.Errorf("invalid LLM host %q: missing host pattern", part)
+				}
+				continue
+			}
+			if !hasProvider {
+				provider = "openai-compatible"
+			} else if !slices.Contains(llmProviders, provider) {
+				return nil, fmt.Errorf("invalid LLM host %q: unknown provider %q (want one of %s)", part, provider, strings.Join(llmProviders, ", "))
+			}
+			hosts.providers[pattern] = provider
+		}
+	}
+	if len(hosts.providers) == 0 {
+		return nil, nil
+	}
+	return hosts, nil
+}
+
+// Detect 先按声明的主机识别提供方，没有匹配时回退到DetectLLMProvider；hostPort可以不带端口
+func (h *LLMHosts) Detect(hostPort, path string) string {
+	if provider := h.lookup(hostPort); provider != "" {
+		return provider
+	}
+	return DetectLLMProvider(hostPort, path)
+}
+
+// lookup 返回声明的模式中与hostPort最匹配的一项的提供方，没有匹配时返回空字符串
+func (h *LLMHosts) lookup(hostPort string) string {
+	if h == nil {
+		return ""
+	}
+	host := hostPort
+	if splitHost, _, err := net.SplitHostPort(hostPort); err == nil {
+		host = splitHost
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	provider, bestRank := "", -1
+	for pattern, candidate := range h.providers {
+		if rank := transportPatternRank(pattern, host, strings.ToLower(hostPort)); rank > bestRank {
+			provider, bestRank = candidate, rank
+		}
+	}
+	return provider
+}
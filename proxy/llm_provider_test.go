@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLLMHosts(t *testing.T) {
+	hosts, err := ParseLLMHosts("llm.corp:8000, *.gpu.corp=ollama", "vllm.internal=openai")
+	require.NoError(t, err)
+	assert.Equal(t, "openai-compatible", hosts.Detect("LLM.corp:8000", "/generate"))
+	assert.Equal(t, "", hosts.Detect("llm.corp:9000", "/generate"), "a pattern with a port only matches that port")
+	assert.Equal(t, "ollama", hosts.Detect("a100.gpu.corp", "/"))
+	assert.Equal(t, "openai", hosts.Detect("vllm.internal:443", "/"))
+	assert.Equal(t, "claude", hosts.Detect("api.anthropic.com", "/v1/messages"), "built-in detection still applies")
+
+	var none *LLMHosts
+	assert.Equal(t, "gemini", none.Detect("generativelanguage.googleapis.com", "/"))
+
+	hosts, err = ParseLLMHosts("", " , ")
+	require.NoError(t, err)
+	assert.Nil(t, hosts)
+
+	_, err = ParseLLMHosts("llm.corp=mistral")
+	assert.Error(t, err)
+	_, err = ParseLLMHosts("=ollama")
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel 是代理日志的输出级别，数值越大输出越详细
+type LogLevel int
+
+const (
+	LogLevelError LogLevel = iota + 1 // 只输出错误
+	LogLevelWarn                      // 错误和警告，如TLS握手失败
+	LogLevelInfo                      // 默认级别，额外输出每个请求一行的摘要
+	LogLevelDebug                     // 额外输出响应头、SSE事件、解压和上游代理选择等细节，等价于 -v
+)
+
+// String 返回级别的名称，与 ParseLogLevel 接受的写法一致
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelError:
+		return "error"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelDebug:
+		return "debug"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// ParseLogLevel 解析 error、warn、info、debug（不区分大小写，warning 等同 warn）
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "error":
+		return LogLevelError, nil
+	case "warn", "warning":
+		return LogLevelWarn, nil
+	case "info":
+		return LogLevelInfo, nil
+	case "debug":
+		return LogLevelDebug, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q: want error, warn, info or debug", s)
+	}
+}
+
+// LeveledLogger 接收代理输出的日志，实现该接口即可把日志重定向到其他日志系统或在测试中捕获
+// 只有不高于Server当前级别的日志才会交给Logf
+type LeveledLogger interface {
+	Logf(level LogLevel, format string, args ...interface{})
+}
+
+// stdLeveledLogger 把日志原样写入标准库Logger
+type stdLeveledLogger struct {
+	logger *log.Logger
+}
+
+func (l stdLeveledLogger) Logf(_ LogLevel, format string, args ...interface{}) {
+	l.logger.Printf(format, args...)
+}
+
+// logLevel 返回生效的日志级别：未设置时为info，Verbose为true时至少为debug
+func (s *Server) logLevel() LogLevel {
+	level := s.LogLevel
+	if level == 0 {
+		level = LogLevelInfo
+	}
+	if s.Verbose && level < LogLevelDebug {
+		level = LogLevelDebug
+	}
+	return level
+}
+
+// logEnabled 判断指定级别的日志是否会输出
+func (s *Server) logEnabled(level LogLevel) bool {
+	return level <= s.logLevel()
+}
+
+// logAt 按级别输出日志，优先交给LeveledLogger
+func (s *Server) logAt(level LogLevel, format string, args ...interface{}) {
+	if !s.logEnabled(level) {
+		return
+	}
+	if s.LeveledLogger != nil {
+		s.LeveledLogger.Logf(level, format, args...)
+		return
+	}
+	stdLeveledLogger{s.logger()}.Logf(level, format, args...)
+}
+
+func (s *Server) errorf(format string, args ...interface{}) { s.logAt(LogLevelError, format, args...) }
+func (s *Server) warnf(format string, args ...interface{})  { s.logAt(LogLevelWarn, format, args...) }
+func (s *Server) infof(format string, args ...interface{})  { s.logAt(LogLevelInfo, format, args...) }
+func (s *Server) debugf(format string, args ...interface{}) { s.logAt(LogLevelDebug, format, args...) }
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedLog struct {
+	level LogLevel
+	msg   string
+}
+
+// captureLogger 记录收到的日志，供断言使用
+type captureLogger struct {
+	mu      sync.Mutex
+	entries []recordedLog
+}
+
+func (l *captureLogger) Logf(level LogLevel, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, recordedLog{level: level, msg: fmt.Sprintf(format, args...)})
+}
+
+func (l *captureLogger) levels() map[LogLevel]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts := make(map[LogLevel]int)
+	for _, entry := range l.entries {
+		counts[entry.level]++
+	}
+	return counts
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for input, want := range map[string]LogLevel{
+		"error":   LogLevelError,
+		"warn":    LogLevelWarn,
+		"WARNING": LogLevelWarn,
+		" info ":  LogLevelInfo,
+		"Debug":   LogLevelDebug,
+	} {
+		level, err := ParseLogLevel(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, level, input)
+		roundTrip, err := ParseLogLevel(want.String())
+		require.NoError(t, err)
+		assert.Equal(t, want, roundTrip)
+	}
+
+	_, err := ParseLogLevel("trace")
+	assert.Error(t, err)
+}
+
+func TestServerLogLevel(t *testing.T) {
+	assert.Equal(t, LogLevelInfo, (&Server{}).logLevel())
+	assert.Equal(t, LogLevelDebug, (&Server{Verbose: true}).logLevel())
+	assert.Equal(t, LogLevelDebug, (&Server{Verbose: true, LogLevel: LogLevelWarn}).logLevel())
+	assert.Equal(t, LogLevelError, (&Server{LogLevel: LogLevelError}).logLevel())
+}
+
+func TestLogLevelFiltersRequestLogs(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	run := func(level LogLevel) *captureLogger {
+		logs := &captureLogger{}
+		server := NewServerWithConfig(Config{LogLevel: level, LeveledLogger: logs})
+		proxyServer := httptest.NewServer(http.HandlerFunc(server.handleHTTP))
+		defer proxyServer.Close()
+
+		proxyURL, err := url.Parse(proxyServer.URL)
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		resp, err := client.Get(backend.URL + "/hello")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return logs
+	}
+
+	// warn 级别下正常请求不输出任何日志
+	assert.Empty(t, run(LogLevelWarn).levels())
+
+	// info 级别只输出每个请求的摘要行
+	info := run(LogLevelInfo).levels()
+	assert.NotZero(t, info[LogLevelInfo])
+	assert.Zero(t, info[LogLevelDebug])
+
+	// debug 级别额外输出细节
+	debug := run(LogLevelDebug).levels()
+	assert.NotZero(t, debug[LogLevelDebug])
+}
+
+func TestLogWriterReceivesLogsWithoutLeveledLogger(t *testing.T) {
+	var buf bytes.Buffer
+	server := NewServerWithConfig(Config{LogWriter: &buf})
+
+	server.debugf("hidden %d", 1)
+	server.infof("shown %d", 2)
+
+	assert.NotContains(t, buf.String(), "hidden 1")
+	assert.Contains(t, buf.String(), "shown 2")
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGzipJSONBackend 返回一个以gzip压缩的大JSON响应的上游服务器
+func newGzipJSONBackend(tb testing.TB, size int) (*httptest.Server, []byte) {
+	tb.Helper()
+	plain := bytes.Repeat([]byte(`{"id":12345,"name":"proxycraft"},`), size/33+1)[:size]
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(plain)
+	_ = zw.Close()
+	gzipped := compressed.Bytes()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(gzipped)))
+		_, _ = w.Write(gzipped)
+	}))
+	tb.Cleanup(backend.Close)
+	return backend, gzipped
+}
+
+func newPassthroughBodiesClient(tb testing.TB, config Config) *http.Client {
+	tb.Helper()
+	config.LogWriter = io.Discard
+	server, err := New(config)
+	require.NoError(tb, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	transport := &http.Transport{Proxy: http.ProxyURL(proxyURL), DisableCompression: true}
+	tb.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
+
+func TestPassthroughBodiesForwardsCompressedBodyAsIs(t *testing.T) {
+	backend, gzipped := newGzipJSONBackend(t, 64*1024)
+	client := newPassthroughBodiesClient(t, Config{PassthroughBodies: true})
+
+	req, err := http.NewRequest(http.MethodPost, backend.URL+"/data", bytes.NewBufferString(`{"q":1}`))
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, gzipped, body)
+}
+
+// bodyConsumer 是声明是否需要消息体的事件处理器
+type bodyConsumer struct {
+	NoOpEventHandler
+	consumes bool
+}
+
+func (h *bodyConsumer) ConsumesBodies() bool { return h.consumes }
+
+func TestPassthroughBodiesOnlyWithoutRecorders(t *testing.T) {
+	harLog := harlogger.NewLogger(filepath.Join(t.TempDir(), "capture.har"), "ProxyCraft", "test")
+	cases := []struct {
+		name   string
+		server *Server
+		want   bool
+	}{
+		{"disabled", &Server{}, false},
+		{"enabled", &Server{PassthroughBodies: true}, true},
+		{"noop handler", &Server{PassthroughBodies: true, EventHandler: &NoOpEventHandler{}}, true},
+		{"har", &Server{PassthroughBodies: true, HarLogger: harLog}, false},
+		{"dump", &Server{PassthroughBodies: true, DumpTraffic: true}, false},
+		{"event handler", &Server{PassthroughBodies: true, EventHandler: &sseEventRecorder{}}, false},
+		{"replacements", &Server{PassthroughBodies: true, BodyReplacements: []*BodyReplacement{{}}}, false},
+		{"handler without bodies", &Server{PassthroughBodies: true, EventHandler: &bodyConsumer{}}, true},
+		{"handler with bodies", &Server{PassthroughBodies: true, EventHandler: &bodyConsumer{consumes: true}}, false},
+		{"combined handlers", &Server{PassthroughBodies: true, EventHandler: NewMultiEventHandler(&bodyConsumer{}, &NoOpEventHandler{})}, true},
+		{"combined with recorder", &Server{PassthroughBodies: true, EventHandler: NewMultiEventHandler(&bodyConsumer{}, &sseEventRecorder{})}, false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, tc.server.passthroughBodies(), tc.name)
+	}
+}
+
+// BenchmarkForwardLargeCompressedBody 对比转发4MB gzip响应时缓存解压与直接转发的内存分配
+// 挂载一个不读取消息体的事件处理器，与CLI模式（CLIHandler未开启-dump）一致
+func BenchmarkForwardLargeCompressedBody(b *testing.B) {
+	backend, _ := newGzipJSONBackend(b, 4*1024*1024)
+	for _, bench := range []struct {
+		name        string
+		passthrough bool
+	}{
+		{"buffered", false},
+		{"passthrough", true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			client := newPassthroughBodiesClient(b, Config{PassthroughBodies: bench.passthrough, EventHandler: &bodyConsumer{}})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, _ := http.NewRequest(http.MethodGet, backend.URL+"/data", nil)
+				req.Header.Set("Accept-Encoding", "gzip")
+				resp, err := client.Do(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
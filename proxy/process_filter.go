@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	gopsnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessResolverFunc 根据客户端连接的远端地址返回发起连接的进程名，无法识别时返回空字符串
+type ProcessResolverFunc func(remoteAddr string) string
+
+// LookupProcess 根据客户端连接的远端地址查找本机上发起连接的进程，返回进程名和可执行文件路径
+// 只能识别与代理运行在同一台机器上的客户端，查找失败时返回空字符串
+func LookupProcess(remoteAddr string) (string, string) {
+	_, portStr, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return "", ""
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port == 0 {
+		return "", ""
+	}
+
+	connections, err := gopsnet.Connections("inet")
+	if err != nil {
+		return "", ""
+	}
+
+	for _, conn := range connections {
+		if conn.Laddr.Port != uint32(port) {
+			continue
+		}
+		if conn.Pid == 0 {
+			continue
+		}
+		proc, err := process.NewProcess(conn.Pid)
+		if err != nil {
+			continue
+		}
+		name, err := proc.Name()
+		if err != nil {
+			continue
+		}
+		exe, _ := proc.Exe()
+		return name, exe
+	}
+
+	return "", ""
+}
+
+// lookupProcessName 是ProcessResolver的默认实现
+func lookupProcessName(remoteAddr string) string {
+	name, _ := LookupProcess(remoteAddr)
+	return name
+}
+
+// interceptsProcess 返回是否对remoteAddr发起的CONNECT做MITM，以及识别出的进程名
+// 未设置MITMProcesses时总是拦截；设置后只拦截名称匹配的进程，无法识别进程的连接直接建立隧道
+func (s *Server) interceptsProcess(remoteAddr string) (bool, string) {
+	if len(s.MITMProcesses) == 0 {
+		return true, ""
+	}
+	resolve := s.ProcessResolver
+	if resolve == nil {
+		resolve = lookupProcessName
+	}
+	name := resolve(remoteAddr)
+	return matchProcessName(s.MITMProcesses, name), name
+}
+
+// matchProcessName 不区分大小写地比较进程名，忽略Windows上的.exe后缀
+func matchProcessName(names []string, name string) bool {
+	name = normalizeProcessName(name)
+	if name == "" {
+		return false
+	}
+	for _, candidate := range names {
+		if normalizeProcessName(candidate) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeProcessName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.TrimSuffix(name, ".exe")
+}
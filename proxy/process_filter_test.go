@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMITMProcessFilter(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secure "+r.URL.Path)
+	}))
+	defer backend.Close()
+	hostPort := strings.TrimPrefix(backend.URL, "https://")
+
+	for _, tc := range []struct {
+		process     string
+		intercepted bool
+	}{
+		{"curl", false},
+		{"MyApp.exe", true},
+		{"", false},
+	} {
+		recorder := &tunnelRecorder{}
+		var resolved []string
+		client := newViaTestClient(t, Config{
+			EventHandler:  recorder,
+			MITMProcesses: []string{"myapp"},
+			ProcessResolver: func(remoteAddr string) string {
+				resolved = append(resolved, remoteAddr)
+				return tc.process
+			},
+		})
+
+		resp, err := client.Get(backend.URL + "/status")
+		require.NoError(t, err, tc.process)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "secure /status", string(body), tc.process)
+
+		assert.NotEmpty(t, resolved, tc.process)
+		intercepted, ok := recorder.intercepted(hostPort)
+		require.True(t, ok, tc.process)
+		assert.Equal(t, tc.intercepted, intercepted, tc.process)
+		recorder.mu.Lock()
+		assert.Equal(t, tc.intercepted, len(recorder.requests) == 1, tc.process)
+		recorder.mu.Unlock()
+	}
+}
+
+func TestMatchProcessName(t *testing.T) {
+	names := []string{"Chrome", " node.exe "}
+	assert.True(t, matchProcessName(names, "chrome.exe"))
+	assert.True(t, matchProcessName(names, "NODE"))
+	assert.False(t, matchProcessName(names, "chromium"))
+	assert.False(t, matchProcessName(names, ""))
+
+	server := &Server{}
+	intercept, _ := server.interceptsProcess("127.0.0.1:1234")
+	assert.True(t, intercept, "no filter intercepts every process")
+}
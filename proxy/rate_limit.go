@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitMode 决定超过-rate-limit的请求如何处理
+type RateLimitMode string
+
+const (
+	// RateLimitDelay 让请求排队等待，直到令牌桶中有可用的令牌再转发
+	RateLimitDelay RateLimitMode = "delay"
+	// RateLimitReject 不转发，直接回复429 Too Many Requests
+	RateLimitReject RateLimitMode = "reject"
+)
+
+// RateLimitRejected 是RequestContext.RateLimit的取值之一，表示请求因超过速率限制被拒绝
+const RateLimitRejected = "rejected"
+
+// RateLimitHeader 标记代理因速率限制生成的429响应，便于和上游真实返回的429区分
+const RateLimitHeader = "X-ProxyCraft-Rate-Limit"
+
+// ParseRateLimitMode 解析超过速率限制时的处理方式，空字符串等同于RateLimitDelay
+func ParseRateLimitMode(value string) (RateLimitMode, error) {
+	switch mode := RateLimitMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return RateLimitDelay, nil
+	case RateLimitDelay, RateLimitReject:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported rate limit mode %q (want delay or reject)", value)
+	}
+}
+
+// RateLimiter 按目标主机限制转发到上游的请求速率，每个主机使用独立的令牌桶
+type RateLimiter struct {
+	rules []rateLimitRule
+	mode  RateLimitMode
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[rateLimitKey]*tokenBucket
+	sweptAt time.Time // 上次清理buckets的时间，见sweepLocked
+}
+
+// rateLimitSweepInterval 是两次清理已补满的令牌桶之间的最短间隔
+const rateLimitSweepInterval = time.Minute
+
+type rateLimitRule struct {
+	spec  string
+	hosts *BypassList
+	rate  float64 // 每秒补充的令牌数
+	burst float64 // 令牌桶容量，即允许的突发请求数
+}
+
+type rateLimitKey struct {
+	rule int
+	host string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ParseRateLimits 解析 -rate-limit 规则，每条格式为 "hosts=rate[/burst]"，例如 "api.example.com=5" 或 ".example.com=0.5/3"
+// hosts 是以 | 分隔的主机、域名后缀或CIDR，语法同 -no-upstream-for，"*" 匹配所有主机；rate 是每秒请求数，
+// burst 是允许的突发请求数，缺省为不小于1的 rate 向上取整。匹配多条规则时使用第一条，每个目标主机单独计数
+// 没有规则时返回nil
+func ParseRateLimits(specs []string, mode RateLimitMode) (*RateLimiter, error) {
+	limiter := &RateLimiter{mode: mode, now: time.Now, buckets: make(map[rateLimitKey]*tokenBucket)}
+	if limiter.mode == "" {
+		limiter.mode = RateLimitDelay
+	}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		hostsPart, limitPart, ok := strings.Cut(spec, "=")
+		if !ok || strings.TrimSpace(hostsPart) == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: want hosts=rate[/burst]", spec)
+		}
+		hosts, err := ParseBypassList(strings.ReplaceAll(hostsPart, "|", ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit hosts in %q: %w", spec, err)
+		}
+
+		ratePart, burstPart, hasBurst := strings.Cut(limitPart, "/")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(ratePart), 64)
+		if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("invalid rate limit %q: rate must be a positive number of requests per second", spec)
+		}
+		burst := math.Max(1, math.Ceil(rate))
+		if hasBurst {
+			n, err := strconv.Atoi(strings.TrimSpace(burstPart))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", spec)
+			}
+			burst = float64(n)
+		}
+		limiter.rules = append(limiter.rules, rateLimitRule{spec: spec, hosts: hosts, rate: rate, burst: burst})
+	}
+	if len(limiter.rules) == 0 {
+		return nil, nil
+	}
+	return limiter, nil
+}
+
+// String 返回便于日志输出的描述
+func (l *RateLimiter) String() string {
+	specs := make([]string, 0, len(l.rules))
+	for _, rule := range l.rules {
+		specs = append(specs, rule.spec)
+	}
+	return fmt.Sprintf("%s (%s beyond the limit)", strings.Join(specs, ", "), l.mode)
+}
+
+// reserve 为发往hostPort的请求取一个令牌，返回需要等待的时间
+// 排队模式下总是预留令牌，请求等待返回的时间后再转发；拒绝模式下没有可用令牌时不消耗令牌，返回rejected和令牌可用前的时间
+func (l *RateLimiter) reserve(hostPort string) (wait time.Duration, rejected bool) {
+	if l == nil {
+		return 0, false
+	}
+	host := hostPort
+	if h, _, err := net.SplitHostPort(hostPort); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+
+	for i, rule := range l.rules {
+		if !rule.hosts.Match(host) {
+			continue
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		now := l.now()
+		if now.Sub(l.sweptAt) >= rateLimitSweepInterval {
+			l.sweepLocked(now)
+		}
+		key := rateLimitKey{rule: i, host: host}
+		bucket := l.buckets[key]
+		if bucket == nil {
+			bucket = &tokenBucket{tokens: rule.burst, last: now}
+			l.buckets[key] = bucket
+		}
+		if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+			bucket.tokens = math.Min(rule.burst, bucket.tokens+elapsed*rule.rate)
+			bucket.last = now
+		}
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+			return 0, false
+		}
+		wait = time.Duration((1 - bucket.tokens) / rule.rate * float64(time.Second))
+		if l.mode == RateLimitReject {
+			return wait, true
+		}
+		bucket.tokens--
+		return wait, false
+	}
+	return 0, false
+}
+
+// sweepLocked 删除已经补满的令牌桶：补满的桶与新建的桶等价，删除后不影响限速，
+// 避免访问过的每个主机都一直占用内存。调用方需持有l.mu
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	l.sweptAt = now
+	for key, bucket := range l.buckets {
+		rule := l.rules[key.rule]
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rule.rate >= rule.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// applyRateLimit 为即将转发的请求执行速率限制，结果记录在reqCtx.RateLimit中
+func (s *Server) applyRateLimit(reqCtx *RequestContext, host string) {
+	wait, rejected := s.RateLimiter.reserve(host)
+	reqCtx.rateLimitWait = wait
+	switch {
+	case rejected:
+		reqCtx.RateLimit = RateLimitRejected
+		s.infof("[RateLimit] Rejecting %s %s: rate limit for %s exceeded", reqCtx.Request.Method, reqCtx.TargetURL, host)
+	case wait > 0:
+		reqCtx.RateLimit = wait.Round(time.Millisecond).String()
+		s.debugf("[RateLimit] Delaying %s %s by %s", reqCtx.Request.Method, reqCtx.TargetURL, reqCtx.RateLimit)
+	}
+}
+
+// rateLimitCtxKey 是转发请求context中保存速率限制结果的键
+type rateLimitCtxKey struct{}
+
+type rateLimitDecision struct {
+	wait     time.Duration
+	rejected bool
+}
+
+// withRateLimit 把速率限制的结果附加到转发请求上，由sendProxyRequest在发出前等待或直接回复429
+func withRateLimit(req *http.Request, reqCtx *RequestContext) *http.Request {
+	if reqCtx.RateLimit == "" {
+		return req
+	}
+	decision := rateLimitDecision{wait: reqCtx.rateLimitWait, rejected: reqCtx.RateLimit == RateLimitRejected}
+	return req.WithContext(context.WithValue(req.Context(), rateLimitCtxKey{}, decision))
+}
+
+// waitRateLimit 按转发请求上附加的速率限制结果等待，或生成429响应；请求在等待期间被取消时返回错误
+// 第二个返回值为true时调用方应使用返回的响应或错误，不再转发请求
+func waitRateLimit(req *http.Request) (*http.Response, bool, error) {
+	decision, ok := req.Context().Value(rateLimitCtxKey{}).(rateLimitDecision)
+	if !ok {
+		return nil, false, nil
+	}
+	if decision.rejected {
+		return rateLimitedResponse(req, decision.wait), true, nil
+	}
+
+	timer := time.NewTimer(decision.wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil, false, nil
+	case <-req.Context().Done():
+		return nil, true, req.Context().Err()
+	}
+}
+
+// rateLimitedResponse 生成因速率限制拒绝请求的429响应，Retry-After为令牌可用前的秒数
+func rateLimitedResponse(req *http.Request, retryAfter time.Duration) *http.Response {
+	body := "ProxyCraft rate limit: too many requests to " + req.URL.Host + "\n"
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	header.Set(RateLimitHeader, RateLimitRejected)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests)),
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
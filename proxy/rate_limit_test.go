@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limiter, err := ParseRateLimits([]string{"api.example.com=5/10", ".test|10.0.0.0/8=0.5"}, "")
+	require.NoError(t, err)
+	require.Len(t, limiter.rules, 2)
+	assert.Equal(t, RateLimitDelay, limiter.mode)
+	assert.Equal(t, 5.0, limiter.rules[0].rate)
+	assert.Equal(t, 10.0, limiter.rules[0].burst)
+	assert.Equal(t, 0.5, limiter.rules[1].rate)
+	assert.Equal(t, 1.0, limiter.rules[1].burst)
+
+	limiter, err = ParseRateLimits(nil, RateLimitReject)
+	require.NoError(t, err)
+	assert.Nil(t, limiter)
+
+	for _, spec := range []string{"api.example.com", "=5", "a.test=0", "a.test=-1", "a.test=fast", "a.test=5/0", "a.test=5/x", "10.0.0.0/99=1"} {
+		_, err := ParseRateLimits([]string{spec}, RateLimitDelay)
+		assert.Error(t, err, spec)
+	}
+
+	_, err = ParseRateLimitMode("drop")
+	assert.Error(t, err)
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	newLimiter := func(mode RateLimitMode) *RateLimiter {
+		limiter, err := ParseRateLimits([]string{"*.example.com=1/2"}, mode)
+		require.NoError(t, err)
+		limiter.now = func() time.Time { return now }
+		return limiter
+	}
+
+	t.Run("delay", func(t *testing.T) {
+		limiter := newLimiter(RateLimitDelay)
+		for i := 0; i < 2; i++ {
+			wait, rejected := limiter.reserve("api.example.com:443")
+			assert.Zero(t, wait)
+			assert.False(t, rejected)
+		}
+		wait, rejected := limiter.reserve("api.example.com:443")
+		assert.Equal(t, time.Second, wait)
+		assert.False(t, rejected)
+		// 排队的请求预留了令牌，下一个请求要再多等一秒
+		wait, _ = limiter.reserve("API.example.com")
+		assert.Equal(t, 2*time.Second, wait)
+
+		// 每个主机单独计数，不匹配的主机不受限
+		wait, _ = limiter.reserve("www.example.com")
+		assert.Zero(t, wait)
+		wait, _ = limiter.reserve("other.test")
+		assert.Zero(t, wait)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		limiter := newLimiter(RateLimitReject)
+		limiter.reserve("api.example.com")
+		limiter.reserve("api.example.com")
+		wait, rejected := limiter.reserve("api.example.com")
+		assert.True(t, rejected)
+		assert.Equal(t, time.Second, wait)
+
+		// 被拒绝的请求不消耗令牌
+		now = now.Add(time.Second)
+		wait, rejected = limiter.reserve("api.example.com")
+		assert.Zero(t, wait)
+		assert.False(t, rejected)
+	})
+
+	t.Run("refilled buckets are removed", func(t *testing.T) {
+		limiter := newLimiter(RateLimitDelay)
+		for _, host := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+			limiter.reserve(host)
+		}
+		limiter.reserve("c.example.com")
+		limiter.reserve("c.example.com")
+		assert.Len(t, limiter.buckets, 3)
+
+		// 一分钟后a、b早已补满被删除，c排队预留的令牌也已补回
+		now = now.Add(time.Minute)
+		wait, _ := limiter.reserve("a.example.com")
+		assert.Zero(t, wait)
+		assert.Len(t, limiter.buckets, 1)
+	})
+}
+
+// rateLimitRecorder 记录每个请求的RateLimit结果
+type rateLimitRecorder struct {
+	NoOpEventHandler
+	mu      sync.Mutex
+	results []string
+}
+
+func (h *rateLimitRecorder) OnRequest(ctx *RequestContext) *http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = append(h.results, ctx.RateLimit)
+	return ctx.Request
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	get := func(t *testing.T, client *http.Client) *http.Response {
+		t.Helper()
+		resp, err := client.Get(backend.URL + "/")
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("delay", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		limiter, err := ParseRateLimits([]string{"127.0.0.1=10/2"}, RateLimitDelay)
+		require.NoError(t, err)
+		recorder := &rateLimitRecorder{}
+		client := newViaTestClient(t, Config{RateLimiter: limiter, EventHandler: recorder})
+
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, http.StatusOK, get(t, client).StatusCode)
+		}
+		// 突发2个，之后每100ms放行一个
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		require.Len(t, recorder.results, 4)
+		assert.Empty(t, recorder.results[0])
+		assert.Empty(t, recorder.results[1])
+		assert.NotEmpty(t, recorder.results[2])
+		assert.NotEqual(t, RateLimitRejected, recorder.results[2])
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		limiter, err := ParseRateLimits([]string{"127.0.0.1=0.1/1"}, RateLimitReject)
+		require.NoError(t, err)
+		recorder := &rateLimitRecorder{}
+		client := newViaTestClient(t, Config{RateLimiter: limiter, EventHandler: recorder})
+
+		assert.Equal(t, http.StatusOK, get(t, client).StatusCode)
+		resp := get(t, client)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, RateLimitRejected, resp.Header.Get(RateLimitHeader))
+		assert.Equal(t, "10", resp.Header.Get("Retry-After"))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		assert.Equal(t, []string{"", RateLimitRejected}, recorder.results)
+	})
+}
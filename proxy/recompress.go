@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// recompressMinSize 是重新压缩的最小响应体大小，更小的响应体压缩后通常不会明显变小
+const recompressMinSize = 1024
+
+// recompressResponse 在开启Recompress时用gzip重新压缩即将写回客户端的响应体
+// 只处理没有Content-Encoding的文本响应，且客户端的Accept-Encoding接受gzip；SSE等流式响应不经过这里
+// 在事件处理器和HAR记录之后调用，记录的仍是未压缩（可能被修改过）的内容
+func (s *Server) recompressResponse(resp *http.Response, req *http.Request) {
+	if !s.Recompress || resp == nil || resp.Body == nil || req == nil || ResponseHasNoBody(resp) {
+		return
+	}
+	if s.isStreamingResponse(resp) || resp.StatusCode == http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" ||
+		!isTextContentType(resp.Header.Get("Content-Type")) || !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		return
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < recompressMinSize {
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.warnf("[Recompress] Error reading response body: %v", err)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return
+	}
+	if len(body) < recompressMinSize {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(body); err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		s.warnf("[Recompress] Error compressing response body: %v", err)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return
+	}
+
+	resp.Body = io.NopCloser(&compressed)
+	resp.ContentLength = int64(compressed.Len())
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.Header.Set("Content-Length", strconv.Itoa(compressed.Len()))
+	resp.Header.Del("Transfer-Encoding")
+	if !strings.Contains(strings.ToLower(strings.Join(resp.Header.Values("Vary"), ",")), "accept-encoding") {
+		resp.Header.Add("Vary", "Accept-Encoding")
+	}
+	s.debugf("[Recompress] Compressed response body from %d to %d bytes", len(body), compressed.Len())
+}
+
+// acceptsGzip 判断Accept-Encoding是否接受gzip，q=0表示明确拒绝
+func acceptsGzip(acceptEncoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+		rejected := false
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					rejected = true
+				}
+			}
+		}
+		// 明确写出的gzip优先于通配符
+		if coding != "*" {
+			return !rejected
+		}
+		accepted = !rejected
+	}
+	return accepted
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecompressResponse(t *testing.T) {
+	payload := `{"items":"` + strings.Repeat("recompress ", 300) + `"}`
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 上游总是返回gzip，代理会先解压再按客户端的Accept-Encoding决定是否重新压缩
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = io.WriteString(gz, payload)
+		_ = gz.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(buf.Bytes())
+	})
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(handler)
+	defer tlsBackend.Close()
+
+	for _, tc := range []struct {
+		name           string
+		recompress     bool
+		acceptEncoding string
+		gzipped        bool
+	}{
+		{"gzip", true, "gzip, deflate", true},
+		{"no accept-encoding", true, "", false},
+		{"gzip rejected", true, "gzip;q=0, br", false},
+		{"disabled", false, "gzip", false},
+	} {
+		client := newViaTestClient(t, Config{Recompress: tc.recompress})
+		for _, target := range []string{backend.URL, tlsBackend.URL} {
+			req, err := http.NewRequest(http.MethodGet, target+"/data", nil)
+			require.NoError(t, err)
+			// 手动设置Accept-Encoding后Transport不会自动解压，可以直接检查收到的响应体
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			resp, err := client.Do(req)
+			require.NoError(t, err, tc.name)
+			raw, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err, tc.name)
+
+			if !tc.gzipped {
+				assert.Empty(t, resp.Header.Get("Content-Encoding"), tc.name)
+				assert.Equal(t, payload, string(raw), tc.name)
+				continue
+			}
+			assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"), tc.name)
+			assert.Equal(t, int64(len(raw)), resp.ContentLength, tc.name)
+			assert.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding", tc.name)
+			assert.Less(t, len(raw), len(payload), tc.name)
+			gz, err := gzip.NewReader(bytes.NewReader(raw))
+			require.NoError(t, err, tc.name)
+			body, err := io.ReadAll(gz)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, payload, string(body), tc.name)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	assert.True(t, acceptsGzip("gzip"))
+	assert.True(t, acceptsGzip("br, GZIP;q=0.5"))
+	assert.True(t, acceptsGzip("*"))
+	assert.False(t, acceptsGzip(""))
+	assert.False(t, acceptsGzip("br, deflate"))
+	assert.False(t, acceptsGzip("gzip;q=0"))
+	assert.False(t, acceptsGzip("*, gzip;q=0.0"))
+	assert.False(t, acceptsGzip("identity, *;q=0"))
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+)
+
+// LoadTestConfig 是ReplayLoad的参数
+type LoadTestConfig struct {
+	Concurrency int     // 同时进行的请求数，小于1时按1处理，为1时按HAR中的顺序逐个发出
+	Rate        float64 // 每秒最多发出的请求数，为0或大于1e9时不限速
+	// BaseURL 非空时把请求发往这里而不是原来的目标：替换scheme和主机，路径前缀拼接在原路径之前
+	BaseURL string
+}
+
+// LoadTestResult 汇总一次ReplayLoad的结果
+type LoadTestResult struct {
+	Requests   int           // 已发出的请求数
+	Errors     int           // 没有得到响应的请求数（连接失败、超时等）
+	FirstError error         // 第一个出错请求的错误
+	Statuses   map[int]int   // 按状态码统计的响应数
+	Duration   time.Duration // 整个回放的耗时
+	// Latencies 是每个得到响应的请求从发出到读完响应体的耗时，从小到大排列
+	Latencies []time.Duration
+}
+
+// replayHeaderSkip 是回放时不复制的请求头：逐跳头、由Transport根据URL和请求体重新生成的头
+var replayHeaderSkip = map[string]bool{
+	"Connection":          true,
+	"Content-Length":      true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// ReplayLoad 把HAR中记录的请求重新发往原来的目标（或cfg.BaseURL）作为简单的压测，返回状态码分布和耗时统计
+// 请求使用与转发相同的Transport（上游代理、DoH、Transports等设置都生效），不经过代理的监听端口，也不会被记录；
+// 不跟随重定向。URL、请求头和请求体中的 {name} 占位符替换为Variables中的值，InjectRules照常注入，
+// ExtractRules从回放的响应中提取变量，因此登录等请求拿到的令牌可以用于后续请求（并发大于1时顺序不确定）
+// ctx取消时停止发出新请求并返回已完成部分的结果和ctx.Err()
+func (s *Server) ReplayLoad(ctx context.Context, entries []harlogger.Entry, cfg LoadTestConfig) (*LoadTestResult, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("no requests to replay")
+	}
+	var base *url.URL
+	if cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid replay base URL %q", cfg.BaseURL)
+		}
+		base = u
+	}
+	for i := range entries {
+		if _, err := url.Parse(entries[i].Request.URL); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := make(chan *harlogger.Entry)
+	go func() {
+		defer close(jobs)
+		var tick <-chan time.Time
+		// 速率高到间隔不足1ns时按不限速处理
+		if interval := time.Duration(float64(time.Second) / cfg.Rate); cfg.Rate > 0 && interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for i := range entries {
+			if tick != nil && i > 0 {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- &entries[i]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	result := &LoadTestResult{Statuses: make(map[int]int)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				status, latency, err := s.replayEntry(ctx, entry, base)
+				mu.Lock()
+				result.Requests++
+				if err != nil {
+					result.Errors++
+					if result.FirstError == nil {
+						result.FirstError = err
+					}
+				} else {
+					result.Statuses[status]++
+					result.Latencies = append(result.Latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, ctx.Err()
+}
+
+// replayEntry 发出一条记录的请求并读完响应体，返回状态码和耗时
+func (s *Server) replayEntry(ctx context.Context, entry *harlogger.Entry, base *url.URL) (int, time.Duration, error) {
+	req, err := s.replayRequest(ctx, entry, base)
+	if err != nil {
+		return 0, 0, err
+	}
+	s.injectVariables(req)
+
+	startTime := time.Now()
+	resp, err := s.roundTripperFor(req.URL.Host, req.URL.Scheme == "https", false).RoundTrip(req)
+	if err != nil {
+		s.debugf("[Replay] %s %s failed: %v", req.Method, req.URL, err)
+		return 0, 0, fmt.Errorf("%s %s: %w", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	s.extractVariables(resp, &RequestContext{Request: req, TargetURL: req.URL.String()})
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, 0, fmt.Errorf("%s %s: reading response body: %w", req.Method, req.URL, err)
+	}
+	return resp.StatusCode, time.Since(startTime), nil
+}
+
+// replayRequest 根据HAR条目构造请求，展开 {name} 占位符并按base改写目标
+func (s *Server) replayRequest(ctx context.Context, entry *harlogger.Entry, base *url.URL) (*http.Request, error) {
+	target, err := url.Parse(s.expandVariables(entry.Request.URL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", entry.Request.URL, err)
+	}
+	if base != nil {
+		target.Scheme = base.Scheme
+		target.Host = base.Host
+		target.Path = strings.TrimSuffix(base.Path, "/") + target.Path
+		target.RawPath = ""
+	}
+
+	body, err := entry.Request.PostData.Body()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: invalid request body: %w", entry.Request.Method, target, err)
+	}
+	var bodyReader io.Reader
+	if len(body) > 0 {
+		bodyReader = bytes.NewReader([]byte(s.expandVariables(string(body))))
+	}
+	req, err := http.NewRequestWithContext(ctx, entry.Request.Method, target.String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range entry.Request.Headers {
+		name := http.CanonicalHeaderKey(header.Name)
+		// HTTP/2的伪头部（:authority等）由Transport生成
+		if strings.HasPrefix(name, ":") || replayHeaderSkip[name] {
+			continue
+		}
+		req.Header.Add(name, s.expandVariables(header.Value))
+	}
+	return req, nil
+}
+
+// expandVariables 把text中已有值的 {name} 占位符替换为变量的当前值，未定义的占位符原样保留
+func (s *Server) expandVariables(text string) string {
+	if s.Variables == nil || !strings.Contains(text, "{") {
+		return text
+	}
+	return variablePattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := s.Variables.Get(placeholder[1 : len(placeholder)-1]); ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// Percentile 返回耗时的第p百分位（0-100），没有成功的请求时返回0
+func (r *LoadTestResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	index := int(p / 100 * float64(len(r.Latencies)-1))
+	if index < 0 {
+		index = 0
+	} else if index >= len(r.Latencies) {
+		index = len(r.Latencies) - 1
+	}
+	return r.Latencies[index]
+}
+
+// WriteSummary 输出请求数、吞吐量、状态码分布和耗时统计
+func (r *LoadTestResult) WriteSummary(w io.Writer) {
+	rate := 0.0
+	if r.Duration > 0 {
+		rate = float64(r.Requests) / r.Duration.Seconds()
+	}
+	fmt.Fprintf(w, "Replayed %d requests in %s (%.1f req/s), %d errors\n", r.Requests, r.Duration.Round(time.Millisecond), rate, r.Errors)
+
+	codes := make([]int, 0, len(r.Statuses))
+	for code := range r.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%d=%d", code, r.Statuses[code]))
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "Status codes: %s\n", strings.Join(parts, " "))
+	}
+
+	if len(r.Latencies) > 0 {
+		var total time.Duration
+		for _, latency := range r.Latencies {
+			total += latency
+		}
+		mean := total / time.Duration(len(r.Latencies))
+		fmt.Fprintf(w, "Latency: min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+			roundLatency(r.Latencies[0]), roundLatency(mean), roundLatency(r.Percentile(50)),
+			roundLatency(r.Percentile(90)), roundLatency(r.Percentile(99)), roundLatency(r.Latencies[len(r.Latencies)-1]))
+	}
+	if r.FirstError != nil {
+		fmt.Fprintf(w, "First error: %v\n", r.FirstError)
+	}
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d >= time.Millisecond {
+		return d.Round(100 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
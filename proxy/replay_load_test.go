@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replayEntry(method, url, body string, headers ...string) harlogger.Entry {
+	entry := harlogger.Entry{Request: harlogger.Request{Method: method, URL: url}}
+	for i := 0; i+1 < len(headers); i += 2 {
+		entry.Request.Headers = append(entry.Request.Headers, harlogger.NameValuePair{Name: headers[i], Value: headers[i+1]})
+	}
+	if body != "" {
+		entry.Request.PostData = &harlogger.PostData{MimeType: "application/json", Text: body}
+	}
+	return entry
+}
+
+func TestReplayLoad(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("Authorization")+" "+string(body))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/api/login":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"token":"fresh"}`)
+		case "/api/missing":
+			http.NotFound(w, r)
+		default:
+			_, _ = io.WriteString(w, "ok")
+		}
+	}))
+	defer backend.Close()
+
+	t.Run("summary", func(t *testing.T) {
+		entries := []harlogger.Entry{
+			replayEntry("GET", backend.URL+"/api/items?page=1", ""),
+			replayEntry("GET", backend.URL+"/api/items?page=2", ""),
+			replayEntry("POST", backend.URL+"/api/items", `{"name":"a"}`, "Content-Type", "application/json", ":authority", "ignored"),
+			replayEntry("GET", backend.URL+"/api/missing", ""),
+			replayEntry("GET", "http://127.0.0.1:1/unreachable", ""),
+		}
+		server, err := New(Config{LogWriter: io.Discard})
+		require.NoError(t, err)
+
+		result, err := server.ReplayLoad(context.Background(), entries, LoadTestConfig{Concurrency: 3, Rate: 200})
+		require.NoError(t, err)
+		assert.Equal(t, 5, result.Requests)
+		assert.Equal(t, 1, result.Errors)
+		assert.Error(t, result.FirstError)
+		assert.Equal(t, map[int]int{200: 3, 404: 1}, result.Statuses)
+		assert.Len(t, result.Latencies, 4)
+		assert.LessOrEqual(t, result.Percentile(50), result.Percentile(99))
+
+		var out bytes.Buffer
+		result.WriteSummary(&out)
+		assert.Contains(t, out.String(), "Replayed 5 requests")
+		assert.Contains(t, out.String(), "Status codes: 200=3 404=1")
+		assert.Contains(t, out.String(), "Latency: min ")
+	})
+
+	t.Run("rate above one per nanosecond is unlimited", func(t *testing.T) {
+		server, err := New(Config{LogWriter: io.Discard})
+		require.NoError(t, err)
+		entries := []harlogger.Entry{replayEntry("GET", backend.URL+"/", ""), replayEntry("GET", backend.URL+"/", "")}
+		result, err := server.ReplayLoad(context.Background(), entries, LoadTestConfig{Concurrency: 1, Rate: 2e9})
+		require.NoError(t, err)
+		assert.Equal(t, map[int]int{200: 2}, result.Statuses)
+	})
+
+	t.Run("base URL and variables", func(t *testing.T) {
+		mu.Lock()
+		seen = nil
+		mu.Unlock()
+		rule, err := ParseExtractRule("token=:/api/login:$.token")
+		require.NoError(t, err)
+		server, err := New(Config{LogWriter: io.Discard, ExtractRules: []*ExtractRule{rule}})
+		require.NoError(t, err)
+		server.Variables.Set("user", "alice")
+
+		entries := []harlogger.Entry{
+			replayEntry("POST", "https://recorded.example/login", `{"user":"{user}"}`),
+			replayEntry("GET", "https://recorded.example/profile?u={user}", "", "Authorization", "Bearer {token}"),
+			replayEntry("GET", "https://recorded.example/raw", "", "X-Template", "{undefined}"),
+		}
+		result, err := server.ReplayLoad(context.Background(), entries, LoadTestConfig{Concurrency: 1, BaseURL: backend.URL + "/api/"})
+		require.NoError(t, err)
+		assert.Equal(t, map[int]int{200: 3}, result.Statuses)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{
+			`POST /api/login  {"user":"alice"}`,
+			"GET /api/profile?u=alice Bearer fresh ",
+			"GET /api/raw  ",
+		}, seen)
+	})
+}
+
+func TestReplayLoadRejectsBadInput(t *testing.T) {
+	server, err := New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+	_, err = server.ReplayLoad(context.Background(), nil, LoadTestConfig{})
+	assert.Error(t, err)
+	_, err = server.ReplayLoad(context.Background(), []harlogger.Entry{replayEntry("GET", "http://example.com/", "")}, LoadTestConfig{BaseURL: "ftp://x"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import "fmt"
+
+// keepRequestBody 在转发前缓存请求体：转发会读完Request.Body，而HAR和-dump在收到响应后才记录请求，需要再次读取
+// 是否缓存只取决于请求是否带有请求体，与请求方法无关，GET、DELETE等方法携带的请求体（如Elasticsearch查询）同样会被记录
+// 跟随307/308重定向时也需要用缓存的请求体重新发出请求
+func (s *Server) keepRequestBody(ctx *RequestContext) error {
+	if ctx.continueBody != nil || (!s.recordsRequestBody() && s.FollowRedirects <= 0) {
+		return nil
+	}
+	body, err := readAndRestoreBody(&ctx.Request.Body, ctx.Request.ContentLength)
+	if err != nil {
+		return fmt.Errorf("read request body: %w", err)
+	}
+	ctx.recordedBody = body
+	return nil
+}
+
+// recordsRequestBody 返回收到响应后是否还需要读取请求体
+func (s *Server) recordsRequestBody() bool {
+	if s.NoBodies {
+		return false
+	}
+	return s.DumpTraffic || (s.HarLogger != nil && s.HarLogger.IsEnabled())
+}
+
+// passthroughBodies 返回是否可以跳过消息体的缓存和解压，直接流式转发
+// 只有设置了PassthroughBodies，且HAR、-dump、EventHandler（如WebHandler，见BodyConsumer）和响应体替换都不需要读取消息体时才生效
+func (s *Server) passthroughBodies() bool {
+	if !s.PassthroughBodies || s.recordsRequestBody() || len(s.BodyReplacements) > 0 || len(s.ExtractRules) > 0 {
+		return false
+	}
+	return !consumesBodies(s.EventHandler)
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// hasRequestContentEncoding 判断请求体是否声明了需要解压的Content-Encoding
+func hasRequestContentEncoding(header http.Header) bool {
+	encoding := strings.TrimSpace(header.Get("Content-Encoding"))
+	return encoding != "" && !strings.EqualFold(encoding, "identity")
+}
+
+// decodeRequestBody 按请求的Content-Encoding解压请求体，不需要解压或解压失败时返回false
+func decodeRequestBody(header http.Header, body []byte) ([]byte, bool) {
+	if len(body) == 0 || !hasRequestContentEncoding(header) {
+		return nil, false
+	}
+	decoded, err := decompressData(body, header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// decodedRequestForLog 返回请求体已解压的请求副本，供HAR记录使用
+// 原请求的Body会被还原为压缩的原始字节，转发给上游的内容不变；不需要解压时直接返回原请求
+func decodedRequestForLog(req *http.Request) *http.Request {
+	if req == nil || req.Body == nil || req.Body == http.NoBody || !hasRequestContentEncoding(req.Header) {
+		return req
+	}
+	body, err := readAndRestoreBody(&req.Body, req.ContentLength)
+	if err != nil {
+		return req
+	}
+	decoded, ok := decodeRequestBody(req.Header, body)
+	if !ok {
+		return req
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(decoded))
+	clone.ContentLength = int64(len(decoded))
+	return clone
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestGetRequestBodyDecodesContentEncoding(t *testing.T) {
+	compressed := gzipBytes(t, `{"hello":"world"}`)
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/api", bytes.NewReader(compressed))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	ctx := &RequestContext{Request: req}
+	body, err := ctx.GetRequestBody()
+	require.NoError(t, err)
+	assert.Equal(t, `{"hello":"world"}`, string(body))
+
+	// 转发的仍是原始压缩字节
+	forwarded, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, compressed, forwarded)
+}
+
+func TestDecodedRequestForLog(t *testing.T) {
+	compressed := gzipBytes(t, "plain text")
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/api", bytes.NewReader(compressed))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	logged := decodedRequestForLog(req)
+	require.NotSame(t, req, logged)
+	loggedBody, err := io.ReadAll(logged.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "plain text", string(loggedBody))
+	assert.Equal(t, int64(len("plain text")), logged.ContentLength)
+
+	original, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, compressed, original)
+
+	// 无法解压的请求体原样记录
+	broken, err := http.NewRequest(http.MethodPost, "http://example.com/api", bytes.NewReader([]byte("not gzip")))
+	require.NoError(t, err)
+	broken.Header.Set("Content-Encoding", "gzip")
+	assert.Same(t, broken, decodedRequestForLog(broken))
+
+	plain, err := http.NewRequest(http.MethodPost, "http://example.com/api", bytes.NewReader([]byte("x")))
+	require.NoError(t, err)
+	assert.Same(t, plain, decodedRequestForLog(plain))
+}
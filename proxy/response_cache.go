@@ -0,0 +1,544 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/bodystore"
+)
+
+// CacheHeader 标记由ResponseCache返回的响应：HIT表示直接使用缓存，REVALIDATED表示上游以304确认缓存仍然有效，
+// MISS表示离线模式下没有对应的缓存
+const CacheHeader = "X-ProxyCraft-Cache"
+
+// RequestContext.Cache 的取值，为空表示请求照常转发
+const (
+	// CacheHit 表示直接从缓存返回响应，不访问上游
+	CacheHit = "hit"
+	// CacheRevalidate 表示缓存已过期，转发时带上If-None-Match/If-Modified-Since，上游返回304时使用缓存
+	CacheRevalidate = "revalidate"
+	// CacheMiss 表示离线模式下没有缓存（或请求无法使用缓存），直接返回504
+	CacheMiss = "miss"
+)
+
+// errCacheOffline 是离线模式下拒绝建立不做MITM的隧道时的错误，隧道内的流量无法从缓存返回
+var errCacheOffline = errors.New("offline cache mode: refusing to tunnel without interception")
+
+// maxCachedBody 超过该大小的响应照常转发但不缓存
+const maxCachedBody = 32 << 20
+
+// cacheableStatus 是可以缓存的状态码，即RFC 9111中默认可缓存的状态码
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// ResponseCache 把GET/HEAD请求的响应按“方法 + URL”（以及响应Vary列出的请求头）缓存在目录中，之后相同的请求直接从缓存返回，适合离线演示
+// 响应体与-body-store一样由bodystore按sha256内容寻址保存，相同内容只保存一份；删除目录即可清空缓存
+type ResponseCache struct {
+	dir     string
+	bodies  *bodystore.Store
+	offline bool
+	now     func() time.Time
+}
+
+// NewResponseCache 创建保存在dir中的响应缓存，dir不存在时自动创建
+// offline为true时只从缓存返回响应，不访问上游，没有缓存的请求返回504
+func NewResponseCache(dir string, offline bool) (*ResponseCache, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory must not be empty")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "entries"), 0o755); err != nil {
+		return nil, err
+	}
+	bodies, err := bodystore.New(filepath.Join(dir, "bodies"))
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseCache{dir: dir, bodies: bodies, offline: offline, now: time.Now}, nil
+}
+
+// Offline 返回是否只从缓存返回响应
+func (c *ResponseCache) Offline() bool {
+	return c.offline
+}
+
+// String 返回便于日志输出的描述
+func (c *ResponseCache) String() string {
+	if c.offline {
+		return c.dir + " (offline: serving only from cache)"
+	}
+	return c.dir
+}
+
+// cachedResponse 是缓存目录中一个响应的元数据，响应体按BodyHash单独保存
+type cachedResponse struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Status     string      `json:"status"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	BodyHash   string      `json:"bodyHash"`
+	BodySize   int64       `json:"bodySize"`
+	StoredAt   time.Time   `json:"storedAt"`
+	// ExpiresAt 是按Cache-Control/Expires计算的过期时间，零值表示响应没有给出有效期，一直视为新鲜
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// fresh 判断缓存在now时是否仍然新鲜
+func (e *cachedResponse) fresh(now time.Time) bool {
+	return e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt)
+}
+
+// hasValidator 判断缓存是否带有可用于条件请求的ETag或Last-Modified
+func (e *cachedResponse) hasValidator() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// cacheKey 返回缓存键的sha256，作为缓存文件名；键由方法、URL以及vary列出的请求头的值组成
+func cacheKey(method, rawURL string, vary []string, header http.Header) string {
+	var key strings.Builder
+	key.WriteString(method + " " + rawURL)
+	for _, name := range vary {
+		key.WriteString("\n" + name + ": " + strings.Join(header.Values(name), ", "))
+	}
+	sum := sha256.Sum256([]byte(key.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyPath 返回缓存键对应的文件路径，按前两位分目录避免单个目录下文件过多
+func (c *ResponseCache) keyPath(key, ext string) string {
+	return filepath.Join(c.dir, "entries", key[:2], key+ext)
+}
+
+// varyHeaders 返回响应Vary列出的请求头，排序去重后用于缓存键
+// 压缩的响应没有声明Vary: Accept-Encoding时同样按Accept-Encoding区分，避免把br/gzip响应返回给不支持的客户端
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	if header.Get("Content-Encoding") != "" {
+		names = append(names, "Accept-Encoding")
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// loadVary 读取同一“方法 + URL”最近缓存的响应的Vary请求头列表
+func (c *ResponseCache) loadVary(method, rawURL string) []string {
+	data, err := os.ReadFile(c.keyPath(cacheKey(method, rawURL, nil, nil), ".vary"))
+	if err != nil {
+		return nil
+	}
+	var vary []string
+	_ = json.Unmarshal(data, &vary)
+	return vary
+}
+
+// load 按请求头读取缓存的响应，不存在或已损坏（包括响应体文件丢失）时返回nil
+func (c *ResponseCache) load(method, rawURL string, header http.Header) *cachedResponse {
+	vary := c.loadVary(method, rawURL)
+	data, err := os.ReadFile(c.keyPath(cacheKey(method, rawURL, vary, header), ".json"))
+	if err != nil {
+		return nil
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil || !c.bodies.Has(entry.BodyHash) {
+		return nil
+	}
+	return &entry
+}
+
+// store 保存响应体和元数据，header是产生该响应的请求头；body为nil时只更新元数据
+func (c *ResponseCache) store(entry *cachedResponse, header http.Header, body []byte) error {
+	if body != nil {
+		hash, err := c.bodies.Put(body)
+		if err != nil {
+			return err
+		}
+		entry.BodyHash, entry.BodySize = hash, int64(len(body))
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	vary := varyHeaders(entry.Header)
+	varyPath := c.keyPath(cacheKey(entry.Method, entry.URL, nil, nil), ".vary")
+	if len(vary) == 0 {
+		if err := os.Remove(varyPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else {
+		list, _ := json.Marshal(vary)
+		if err := bodystore.WriteFile(varyPath, list); err != nil {
+			return err
+		}
+	}
+	return bodystore.WriteFile(c.keyPath(cacheKey(entry.Method, entry.URL, vary, header), ".json"), data)
+}
+
+// response 用缓存构造返回给客户端的响应，marker写入CacheHeader
+func (c *ResponseCache) response(entry *cachedResponse, req *http.Request, marker string) (*http.Response, error) {
+	header := entry.Header.Clone()
+	header.Set(CacheHeader, marker)
+	if marker == "HIT" {
+		header.Set("Age", strconv.Itoa(int(c.now().Sub(entry.StoredAt).Seconds())))
+	}
+
+	resp := &http.Response{
+		Status:        entry.Status,
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: entry.BodySize,
+		Request:       req,
+	}
+	if major, minor, ok := http.ParseHTTPVersion(entry.Proto); ok {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = entry.Proto, major, minor
+	}
+	if req.Method == http.MethodHead {
+		resp.ContentLength = -1
+		if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+			resp.ContentLength = length
+		}
+	} else if entry.BodySize > 0 {
+		body, err := c.bodies.Open(entry.BodyHash)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+// missResponse 生成离线模式下没有缓存时返回的504响应
+func missResponse(req *http.Request) *http.Response {
+	body := fmt.Sprintf("ProxyCraft cache: no cached response for %s %s (offline mode)\n", req.Method, req.URL)
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set(CacheHeader, "MISS")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout)),
+		StatusCode:    http.StatusGatewayTimeout,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// cacheControl 解析Cache-Control头（以及Pragma: no-cache），返回小写的指令及其参数
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				directives[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(header.Get("Pragma")), "no-cache") {
+		if _, ok := directives["no-cache"]; !ok {
+			directives["no-cache"] = ""
+		}
+	}
+	return directives
+}
+
+// cacheExpiry 按响应的Cache-Control和Expires计算过期时间，没有给出有效期时返回零值
+func cacheExpiry(header http.Header, now time.Time) time.Time {
+	directives := cacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return now
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if arg, ok := directives[name]; ok {
+			seconds, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || seconds <= 0 {
+				return now
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// 无法解析的Expires表示已经过期
+			return now
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// cacheableRequest 判断请求是否可以使用缓存：只缓存不带Range的GET和HEAD请求，协议升级、SSE和带Authorization的请求除外
+func cacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Header.Get("Range") == "" && req.Header.Get("Authorization") == "" && !isUpgradeRequest(req) && !isSSERequest(req)
+}
+
+// cacheableResponse 判断上游响应是否可以写入缓存
+func (s *Server) cacheableResponse(resp *http.Response) bool {
+	if !cacheableStatus[resp.StatusCode] || s.isStreamingResponse(resp) {
+		return false
+	}
+	directives := cacheControl(resp.Header)
+	if _, noStore := directives["no-store"]; noStore {
+		return false
+	}
+	// private响应只属于发起请求的用户，不能返回给其他客户端
+	if _, private := directives["private"]; private {
+		return false
+	}
+	return strings.TrimSpace(resp.Header.Get("Vary")) != "*"
+}
+
+// cacheLookup 是一个请求的缓存查找结果，附加在转发请求的context中
+type cacheLookup struct {
+	server *Server
+	result string          // 同RequestContext.Cache
+	method string          // 缓存键中的方法
+	url    string          // 缓存键中的URL
+	header http.Header     // 客户端的请求头，按响应的Vary组成缓存键
+	entry  *cachedResponse // 命中或需要重新验证的缓存
+	store  bool            // 上游响应是否可以写入缓存
+}
+
+// lookupCache 在转发前查找缓存，结果记录在reqCtx.Cache中；返回true表示请求由缓存处理，不会发往上游
+func (s *Server) lookupCache(reqCtx *RequestContext) bool {
+	if s.Cache == nil {
+		return false
+	}
+	req := reqCtx.Request
+	cacheable := cacheableRequest(req)
+	if !cacheable && !s.Cache.offline {
+		return false
+	}
+	lookup := &cacheLookup{server: s, method: req.Method, url: reqCtx.TargetURL, header: req.Header.Clone()}
+	reqCtx.cacheLookup = lookup
+
+	// 离线模式下所有请求都不访问上游，无法使用缓存的请求同样返回504
+	if s.Cache.offline {
+		if cacheable {
+			lookup.entry = s.Cache.load(lookup.method, lookup.url, lookup.header)
+		}
+		if lookup.entry == nil {
+			lookup.result = CacheMiss
+			s.infof("[Cache] No cached response for %s %s in offline mode", req.Method, reqCtx.TargetURL)
+		} else {
+			lookup.result = CacheHit
+			s.debugf("[Cache] Serving %s %s from cache", req.Method, reqCtx.TargetURL)
+		}
+		reqCtx.Cache = lookup.result
+		return true
+	}
+
+	// 客户端要求不使用缓存（例如强制刷新）时照常转发，no-store时响应也不写入缓存
+	directives := cacheControl(req.Header)
+	_, noStore := directives["no-store"]
+	_, noCache := directives["no-cache"]
+	lookup.store = !noStore
+	if noStore || noCache {
+		return false
+	}
+
+	entry := s.Cache.load(lookup.method, lookup.url, lookup.header)
+	switch {
+	case entry == nil:
+		return false
+	case entry.fresh(s.Cache.now()):
+		lookup.entry, lookup.result = entry, CacheHit
+		s.debugf("[Cache] Serving %s %s from cache", req.Method, reqCtx.TargetURL)
+	case entry.hasValidator() && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "":
+		// 客户端自己的条件请求直接交给上游回答
+		lookup.entry, lookup.result = entry, CacheRevalidate
+	default:
+		return false
+	}
+	reqCtx.Cache = lookup.result
+	return lookup.result == CacheHit
+}
+
+// cacheCtxKey 是转发请求context中保存缓存查找结果的键
+type cacheCtxKey struct{}
+
+// withCache 把缓存查找结果附加到转发请求上，需要重新验证时添加条件请求头
+func withCache(req *http.Request, reqCtx *RequestContext) *http.Request {
+	lookup := reqCtx.cacheLookup
+	if lookup == nil {
+		return req
+	}
+	if lookup.result == CacheRevalidate {
+		if etag := lookup.entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := lookup.entry.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	return req.WithContext(context.WithValue(req.Context(), cacheCtxKey{}, lookup))
+}
+
+// serveFromCache 对命中缓存或离线模式下未命中的请求生成响应，第二个返回值为true时调用方不再转发请求
+func serveFromCache(req *http.Request) (*http.Response, bool) {
+	lookup, ok := req.Context().Value(cacheCtxKey{}).(*cacheLookup)
+	if !ok {
+		return nil, false
+	}
+	switch lookup.result {
+	case CacheMiss:
+		return missResponse(req), true
+	case CacheHit:
+		resp, err := lookup.server.Cache.response(lookup.entry, req, "HIT")
+		if err != nil {
+			lookup.server.warnf("[Cache] Failed to read cached response for %s %s: %v", lookup.method, lookup.url, err)
+			return missResponse(req), true
+		}
+		return resp, true
+	}
+	return nil, false
+}
+
+// cacheUpstreamResponse 处理上游的响应：重新验证得到304时改用缓存，可缓存的响应在读完响应体后写入缓存
+func cacheUpstreamResponse(req *http.Request, resp *http.Response) *http.Response {
+	lookup, ok := req.Context().Value(cacheCtxKey{}).(*cacheLookup)
+	if !ok {
+		return resp
+	}
+	cache := lookup.server.Cache
+	now := cache.now()
+
+	if lookup.result == CacheRevalidate && resp.StatusCode == http.StatusNotModified {
+		entry := lookup.entry
+		for name, values := range resp.Header {
+			switch http.CanonicalHeaderKey(name) {
+			case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			default:
+				entry.Header[name] = values
+			}
+		}
+		entry.StoredAt, entry.ExpiresAt = now, cacheExpiry(entry.Header, now)
+		if err := cache.store(entry, lookup.header, nil); err != nil {
+			lookup.server.warnf("[Cache] Failed to update cached response for %s %s: %v", lookup.method, lookup.url, err)
+		}
+		cached, err := cache.response(entry, req, "REVALIDATED")
+		if err != nil {
+			lookup.server.warnf("[Cache] Failed to read cached response for %s %s: %v", lookup.method, lookup.url, err)
+			return resp
+		}
+		_ = resp.Body.Close()
+		return cached
+	}
+
+	if !lookup.store || !lookup.server.cacheableResponse(resp) || resp.ContentLength > maxCachedBody {
+		return resp
+	}
+	recorder := &cacheRecorder{
+		ReadCloser: resp.Body,
+		lookup:     lookup,
+		length:     resp.ContentLength,
+		entry: &cachedResponse{
+			Method:     lookup.method,
+			URL:        lookup.url,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Proto:      resp.Proto,
+			Header:     resp.Header.Clone(),
+			StoredAt:   now,
+			ExpiresAt:  cacheExpiry(resp.Header, now),
+		},
+	}
+	if ResponseHasNoBody(resp) {
+		recorder.save()
+		return resp
+	}
+	resp.Body = recorder
+	return resp
+}
+
+// cacheRecorder 在响应体转发给客户端的同时保存一份，完整读完后写入缓存；超过maxCachedBody或中途断开的响应不缓存
+type cacheRecorder struct {
+	io.ReadCloser
+	lookup *cacheLookup
+	entry  *cachedResponse
+	length int64 // 响应的Content-Length，未知时为-1
+	buf    bytes.Buffer
+	done   bool
+}
+
+func (r *cacheRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if !r.done {
+		if int64(r.buf.Len()+n) > maxCachedBody {
+			r.done = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(p[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			r.save()
+		}
+	}
+	return n, err
+}
+
+func (r *cacheRecorder) Close() error {
+	// 读完Content-Length指定的字节后，读取方可能不再等待EOF就关闭响应体
+	if !r.done && r.length >= 0 && int64(r.buf.Len()) == r.length {
+		r.save()
+	}
+	r.done = true
+	return r.ReadCloser.Close()
+}
+
+// save 把已读取的响应体写入缓存
+func (r *cacheRecorder) save() {
+	r.done = true
+	body := r.buf.Bytes()
+	if body == nil {
+		body = []byte{}
+	}
+	if err := r.lookup.server.Cache.store(r.entry, r.lookup.header, body); err != nil {
+		r.lookup.server.warnf("[Cache] Failed to cache response for %s %s: %v", r.lookup.method, r.lookup.url, err)
+		return
+	}
+	r.lookup.server.debugf("[Cache] Cached %s %s (%d bytes)", r.lookup.method, r.lookup.url, r.buf.Len())
+}
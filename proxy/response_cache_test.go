@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheMarkHandler 记录每个请求的RequestContext.Cache
+type cacheMarkHandler struct {
+	NoOpEventHandler
+	mu    sync.Mutex
+	marks []string
+}
+
+func (h *cacheMarkHandler) OnRequest(ctx *RequestContext) *http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.marks = append(h.marks, ctx.Cache)
+	return ctx.Request
+}
+
+func (h *cacheMarkHandler) Marks() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.marks...)
+}
+
+// getCached 发送GET请求，返回状态码、响应体和CacheHeader
+func getCached(t *testing.T, client *http.Client, target string, header http.Header) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body), resp.Header.Get(CacheHeader)
+}
+
+func TestResponseCache(t *testing.T) {
+	var hits atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/gzip":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, _ = gz.Write([]byte("compressed " + strconv.Itoa(int(n))))
+			_ = gz.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		_, _ = io.WriteString(w, "response "+strconv.Itoa(int(n)))
+	})
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(handler)
+	defer tlsBackend.Close()
+
+	dir := t.TempDir()
+	cache, err := NewResponseCache(dir, false)
+	require.NoError(t, err)
+	marks := &cacheMarkHandler{}
+	client := newViaTestClient(t, Config{Cache: cache, EventHandler: marks})
+
+	t.Run("repeat served from cache", func(t *testing.T) {
+		for _, target := range []string{backend.URL + "/page", tlsBackend.URL + "/page", backend.URL + "/gzip"} {
+			before := hits.Load()
+			status, first, marker := getCached(t, client, target, nil)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Empty(t, marker)
+
+			status, second, marker := getCached(t, client, target, nil)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, first, second, target)
+			assert.Equal(t, "HIT", marker)
+			assert.Equal(t, before+1, hits.Load(), "second request must not reach %s", target)
+		}
+		assert.Equal(t, []string{"", CacheHit, "", CacheHit, "", CacheHit}, marks.Marks())
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		before := hits.Load()
+		getCached(t, client, backend.URL+"/no-store", nil)
+		getCached(t, client, backend.URL+"/no-store", nil)
+		// 客户端要求不使用缓存时照常转发
+		getCached(t, client, backend.URL+"/page", http.Header{"Cache-Control": {"no-cache"}})
+		resp, err := client.Post(backend.URL+"/page", "text/plain", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, before+4, hits.Load())
+	})
+
+	t.Run("offline", func(t *testing.T) {
+		offline, err := NewResponseCache(dir, true)
+		require.NoError(t, err)
+		client := newViaTestClient(t, Config{Cache: offline})
+		before := hits.Load()
+
+		status, body, marker := getCached(t, client, tlsBackend.URL+"/page", nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "response 2", body)
+		assert.Equal(t, "HIT", marker)
+
+		status, body, marker = getCached(t, client, backend.URL+"/never-fetched", nil)
+		assert.Equal(t, http.StatusGatewayTimeout, status)
+		assert.Contains(t, body, "no cached response")
+		assert.Equal(t, "MISS", marker)
+
+		// 无法使用缓存的请求同样不访问上游
+		resp, err := client.Post(backend.URL+"/page", "text/plain", strings.NewReader("data"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Equal(t, "MISS", resp.Header.Get(CacheHeader))
+		assert.Equal(t, before, hits.Load())
+	})
+}
+
+func TestResponseCacheOfflineRefusesTunnel(t *testing.T) {
+	cache, err := NewResponseCache(t.TempDir(), true)
+	require.NoError(t, err)
+	server, err := New(Config{Cache: cache, AutoPassthrough: true, AutoPassthroughTTL: time.Minute, LogWriter: io.Discard})
+	require.NoError(t, err)
+	server.rememberPassthrough("pinned.example.com:443")
+
+	rec := httptest.NewRecorder()
+	server.handleHTTPS(rec, httptest.NewRequest(http.MethodConnect, "pinned.example.com:443", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "MISS", rec.Header().Get(CacheHeader))
+}
+
+func TestResponseCacheVaryAndPrivate(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/lang":
+			w.Header().Set("Vary", "Accept-Language")
+			_, _ = io.WriteString(w, "lang "+r.Header.Get("Accept-Language"))
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+			_, _ = io.WriteString(w, "private")
+		default:
+			_, _ = io.WriteString(w, "user "+r.Header.Get("Authorization"))
+		}
+	}))
+	defer backend.Close()
+
+	cache, err := NewResponseCache(t.TempDir(), false)
+	require.NoError(t, err)
+	client := newViaTestClient(t, Config{Cache: cache})
+
+	// Vary列出的请求头不同的请求各自缓存
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		_, body, _ := getCached(t, client, backend.URL+"/lang", http.Header{"Accept-Language": {lang}})
+		assert.Equal(t, "lang "+lang, body)
+	}
+	assert.Equal(t, int32(2), hits.Load())
+
+	_, _, marker := getCached(t, client, backend.URL+"/private", nil)
+	assert.Empty(t, marker)
+	_, _, marker = getCached(t, client, backend.URL+"/private", nil)
+	assert.Empty(t, marker)
+
+	for _, user := range []string{"alice", "bob"} {
+		_, body, marker := getCached(t, client, backend.URL+"/me", http.Header{"Authorization": {user}})
+		assert.Equal(t, "user "+user, body)
+		assert.Empty(t, marker)
+	}
+	assert.Equal(t, int32(6), hits.Load())
+}
+
+func TestResponseCacheRevalidate(t *testing.T) {
+	var hits, notModified atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = io.WriteString(w, "versioned")
+	}))
+	defer backend.Close()
+
+	cache, err := NewResponseCache(t.TempDir(), false)
+	require.NoError(t, err)
+	client := newViaTestClient(t, Config{Cache: cache})
+
+	_, body, marker := getCached(t, client, backend.URL+"/doc", nil)
+	assert.Equal(t, "versioned", body)
+	assert.Empty(t, marker)
+
+	// 过期的缓存带上If-None-Match向上游确认，304时返回缓存的响应体
+	status, body, marker := getCached(t, client, backend.URL+"/doc", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "versioned", body)
+	assert.Equal(t, "REVALIDATED", marker)
+	assert.Equal(t, int32(2), hits.Load())
+	assert.Equal(t, int32(1), notModified.Load())
+
+	// 客户端自己的条件请求由上游直接回答
+	status, _, marker = getCached(t, client, backend.URL+"/doc", http.Header{"If-None-Match": {`"v1"`}})
+	assert.Equal(t, http.StatusNotModified, status)
+	assert.Empty(t, marker)
+}
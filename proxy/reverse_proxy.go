@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ParseReverseTarget 解析反向代理的后端地址，例如 "https://backend:443"
+func ParseReverseTarget(raw string) (*url.URL, error) {
+	target, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid reverse target %q: %w", raw, err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("invalid reverse target %q: scheme must be http or https", raw)
+	}
+	if target.Host == "" {
+		return nil, fmt.Errorf("invalid reverse target %q: missing host", raw)
+	}
+	return target, nil
+}
+
+// startReverse 以普通HTTPS服务器的方式监听，所有请求转发到ReverseTarget
+func (s *Server) startReverse() error {
+	s.infof("Reverse proxy starting on %s, forwarding to %s", s.Addr, s.ReverseTarget.String())
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.buildReverseServer().ServeTLS(s.trackConns(s.limitListener(l, false)), "", "")
+}
+
+func (s *Server) buildReverseServer() *http.Server {
+	tlsConfig := &tls.Config{
+		GetCertificate: s.reverseCertificate,
+	}
+	s.applyClientTLSSettings(tlsConfig)
+	server := &http.Server{
+		Addr:           s.Addr,
+		Handler:        http.HandlerFunc(s.handleReverse),
+		ErrorLog:       s.Logger,
+		TLSConfig:      tlsConfig,
+		MaxHeaderBytes: s.maxHeaderBytes(),
+	}
+	if s.NoClientHTTP2 {
+		// 否则http.Server会自动把h2加回ALPN列表
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server
+}
+
+// reverseCertificate 优先使用配置的证书，否则为后端主机名或ReverseHosts中的SNI签发MITM证书并缓存
+// 其他SNI使用后端主机名的证书，避免客户端通过任意SNI让代理签发并缓存无限多的证书
+func (s *Server) reverseCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.ReverseCertificate != nil {
+		return s.ReverseCertificate, nil
+	}
+	if s.CertManager == nil {
+		return nil, fmt.Errorf("no certificate configured for reverse proxy")
+	}
+
+	hostname := s.ReverseTarget.Hostname()
+	if s.isReverseHost(hello.ServerName) {
+		hostname = strings.ToLower(hello.ServerName)
+	}
+	// CA被轮换后缓存中旧CA签发的证书作废，重新签发
+	generation := s.CertManager.Generation()
+	if cached, ok := s.reverseCerts.Load(hostname); ok && cached.(*reverseCert).generation == generation {
+		return cached.(*reverseCert).cert, nil
+	}
+
+	cert, err := s.CertManager.GenerateServerTLSCert(hostname)
+	if err != nil {
+		return nil, err
+	}
+	s.reverseCerts.Store(hostname, &reverseCert{cert: cert, generation: generation})
+	return cert, nil
+}
+
+// reverseCert 是reverseCerts中缓存的证书及签发时CA的代数
+type reverseCert struct {
+	cert       *tls.Certificate
+	generation uint64
+}
+
+// isReverseHost 判断是否允许按该SNI签发证书
+func (s *Server) isReverseHost(serverName string) bool {
+	if serverName == "" {
+		return false
+	}
+	for _, host := range s.ReverseHosts {
+		if strings.EqualFold(strings.TrimSpace(host), serverName) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReverse 将收到的请求改写为发往ReverseTarget的请求，复用正向代理的转发与记录流程
+func (s *Server) handleReverse(w http.ResponseWriter, r *http.Request) {
+	s.infof("[Reverse] Received request: %s %s %s %s", r.Method, r.Host, r.URL.String(), r.Proto)
+
+	target := s.ReverseTarget
+	targetURL := s.resolveReverseTargetURL(r)
+
+	// 改写Host为后端地址，同时保留原始Host供后端参考
+	// X-Forwarded-Host和X-Forwarded-Proto总是覆盖，不转发客户端伪造的值
+	originalHost := r.Host
+	r.Host = target.Host
+	r.URL.Host = target.Host
+	r.URL.Scheme = target.Scheme
+	r.Header.Del("X-Forwarded-Host")
+	if originalHost != "" {
+		r.Header.Set("X-Forwarded-Host", originalHost)
+	}
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		r.Header.Set("X-Forwarded-For", clientIP)
+	}
+
+	s.forwardRequest(w, r, targetURL, target.Scheme == "https", "[Reverse]")
+}
+
+// resolveReverseTargetURL 将请求路径拼接到后端地址上
+func (s *Server) resolveReverseTargetURL(r *http.Request) string {
+	target := *s.ReverseTarget
+	target.Path = singleJoiningSlash(s.ReverseTarget.Path, r.URL.Path)
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+	return target.String()
+}
+
+func singleJoiningSlash(a, b string) string {
+	aSlash := strings.HasSuffix(a, "/")
+	bSlash := strings.HasPrefix(b, "/")
+	switch {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash && b != "":
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/LubyRuffy/ProxyCraft/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingEventHandler 记录收到的请求与响应事件
+type recordingEventHandler struct {
+	NoOpEventHandler
+	mu        sync.Mutex
+	requests  []string
+	responses []int
+}
+
+func (h *recordingEventHandler) OnRequest(ctx *RequestContext) *http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, ctx.TargetURL)
+	return ctx.Request
+}
+
+func (h *recordingEventHandler) OnResponse(ctx *ResponseContext) *http.Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.responses = append(h.responses, ctx.Response.StatusCode)
+	return ctx.Response
+}
+
+func TestParseReverseTarget(t *testing.T) {
+	target, err := ParseReverseTarget("https://backend.example.com:8443")
+	require.NoError(t, err)
+	assert.Equal(t, "backend.example.com:8443", target.Host)
+
+	_, err = ParseReverseTarget("backend.example.com")
+	assert.Error(t, err)
+	_, err = ParseReverseTarget("ftp://backend.example.com")
+	assert.Error(t, err)
+}
+
+func TestReverseProxyForwardsAndLogs(t *testing.T) {
+	var gotHost, gotForwardedHost, gotForwardedProto, gotPath string
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		gotForwardedHost = r.Header.Get("X-Forwarded-Host")
+		gotForwardedProto = r.Header.Get("X-Forwarded-Proto")
+		gotPath = r.URL.RequestURI()
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("hello from backend"))
+	}))
+	defer backend.Close()
+
+	certMgr, err := certs.NewManager()
+	require.NoError(t, err)
+	target, err := url.Parse(backend.URL + "/api")
+	require.NoError(t, err)
+
+	recorder := &recordingEventHandler{}
+	server := NewServerWithConfig(ServerConfig{
+		CertManager:   certMgr,
+		EventHandler:  recorder,
+		ReverseTarget: target,
+		ReverseHosts:  []string{"public.example.com"},
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer := server.buildReverseServer()
+	go func() { _ = httpServer.ServeTLS(listener, "", "") }()
+	defer httpServer.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: "public.example.com"},
+	}}
+	req, err := http.NewRequest(http.MethodGet, "https://"+listener.Addr().String()+"/users?id=1", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Forwarded-Host", "spoofed.example.com")
+	req.Header.Set("X-Forwarded-Proto", "http")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello from backend", string(body))
+
+	// 证书按允许的SNI签发
+	require.NotNil(t, resp.TLS)
+	require.NotEmpty(t, resp.TLS.PeerCertificates)
+	assert.Equal(t, "public.example.com", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// Host改写为后端地址，路径拼接到后端前缀
+	assert.Equal(t, target.Host, gotHost)
+	assert.Equal(t, listener.Addr().String(), gotForwardedHost)
+	assert.Equal(t, "https", gotForwardedProto)
+	assert.Equal(t, "/api/users?id=1", gotPath)
+
+	// 请求经过同一套事件流程被记录
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []string{backend.URL + "/api/users?id=1"}, recorder.requests)
+	assert.Equal(t, []int{http.StatusOK}, recorder.responses)
+}
+
+func TestReverseCertificateOnlyForAllowedHosts(t *testing.T) {
+	certMgr, err := certs.NewManager()
+	require.NoError(t, err)
+	target, err := url.Parse("https://backend.example.com")
+	require.NoError(t, err)
+	server := NewServerWithConfig(ServerConfig{
+		CertManager:   certMgr,
+		ReverseTarget: target,
+		ReverseHosts:  []string{"public.example.com"},
+	})
+
+	for serverName, want := range map[string]string{
+		"":                     "backend.example.com",
+		"PUBLIC.example.com":   "public.example.com",
+		"attacker.example.com": "backend.example.com",
+	} {
+		cert, err := server.reverseCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err)
+		require.NotNil(t, cert.Leaf)
+		assert.Equal(t, want, cert.Leaf.Subject.CommonName, serverName)
+	}
+
+	cached := 0
+	server.reverseCerts.Range(func(key, value any) bool {
+		cached++
+		return true
+	})
+	assert.Equal(t, 2, cached)
+}
+
+func TestReverseCertificateAfterCARotation(t *testing.T) {
+	certMgr, err := certs.NewInMemoryManager()
+	require.NoError(t, err)
+	target, err := url.Parse("https://backend.example.com")
+	require.NoError(t, err)
+	server := NewServerWithConfig(ServerConfig{CertManager: certMgr, ReverseTarget: target})
+
+	before, err := server.reverseCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	cached, err := server.reverseCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Same(t, before, cached)
+
+	// 轮换CA后不再使用旧CA签发的缓存证书
+	require.NoError(t, certMgr.RegenerateCA())
+	after, err := server.reverseCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.NotSame(t, before, after)
+	assert.NoError(t, after.Leaf.CheckSignatureFrom(certMgr.CACert))
+}
@@ -2,59 +2,136 @@ package proxy
 
 import (
 	"crypto/tls"
-	"log"
-	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
+// transportIdleTTL 是缓存的Transport多久未被使用后移除；长于IdleConnTimeout，移除时已经没有空闲连接
+const transportIdleTTL = 5 * time.Minute
+
+// transportSweepInterval 是两次清理缓存的Transport之间的最短间隔
+const transportSweepInterval = time.Minute
+
 // newTransport creates a transport configured for HTTP or HTTPS requests.
 func (s *Server) newTransport(targetHost string, secure bool) *http.Transport {
+	dialer := s.upstreamDialer()
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 10 * time.Second,
-		DisableCompression:    true,
-		ResponseHeaderTimeout: 20 * time.Second,
+		DialContext:            dialer.DialContext,
+		MaxIdleConns:           100,
+		IdleConnTimeout:        90 * time.Second,
+		TLSHandshakeTimeout:    10 * time.Second,
+		ExpectContinueTimeout:  10 * time.Second,
+		DisableCompression:     true,
+		ResponseHeaderTimeout:  s.requestTimeout(),
+		MaxResponseHeaderBytes: int64(s.maxHeaderBytes()),
 	}
 
 	if secure {
-		hostForSNI := targetHost
-		if host, _, err := net.SplitHostPort(targetHost); err == nil {
-			hostForSNI = host
-		}
 		transport.TLSClientConfig = &tls.Config{
 			InsecureSkipVerify: true,
-			ServerName:         hostForSNI,
+			ServerName:         extractHostname(targetHost),
+		}
+		// 固定了指纹的主机只接受指纹一致的证书
+		if verify := s.CertPins.verifier(targetHost); verify != nil {
+			transport.TLSClientConfig.VerifyPeerCertificate = verify
 		}
 	}
 
-	if s.UpstreamProxy != nil {
-		if s.Verbose {
-			log.Printf("[Proxy] Using upstream proxy: %s", s.UpstreamProxy.String())
+	// CONNECT隧道在本地完成MITM后同样经由此处转发，因此绕过列表只需在这里处理
+	if proxies := s.upstreamProxies(); len(proxies) > 0 && s.bypassUpstream(targetHost) {
+		s.debugf("[Proxy] Bypassing upstream proxy for %s", targetHost)
+	} else if len(proxies) > 0 {
+		last := proxies[len(proxies)-1]
+		s.debugf("[Proxy] Using upstream proxy: %s", last.String())
+		transport.Proxy = http.ProxyURL(last)
+		transport.OnProxyConnectResponse = checkProxyConnectResponse
+
+		// 多级代理链：前面的代理通过嵌套CONNECT隧道到达最后一跳
+		if len(proxies) > 1 {
+			s.debugf("[Proxy] Using upstream proxy chain with %d hops", len(proxies))
+			chain := &chainDialer{hops: proxies[:len(proxies)-1], base: dialer}
+			transport.DialContext = chain.DialContext
 		}
-		transport.Proxy = http.ProxyURL(s.UpstreamProxy)
 	}
 
-	s.handleHTTP2(transport)
+	if s.NoUpstreamHTTP2 {
+		// 非nil的空TLSNextProto禁止Transport升级到HTTP/2，ALPN也只声明http/1.1
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if transport.TLSClientConfig != nil {
+			transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+		}
+	} else {
+		s.handleHTTP2(transport)
+	}
 
 	return transport
 }
 
+// transportKey 区分缓存的上游Transport
+type transportKey struct {
+	host         string
+	secure       bool
+	potentialSSE bool
+}
+
+// cachedTransport 是transports中缓存的Transport及其最近一次被使用的时间（UnixNano）
+type cachedTransport struct {
+	transport *http.Transport
+	lastUsed  atomic.Int64
+}
+
+// transportFor 返回转发到targetHost使用的Transport，相同目标共用一个Transport，使上游连接可以被复用
+// 可能是SSE的请求不限制等待响应头的时间，因此使用单独的Transport；超过transportIdleTTL未使用的Transport会被移除
+func (s *Server) transportFor(targetHost string, secure, potentialSSE bool) *http.Transport {
+	key := transportKey{host: targetHost, secure: secure, potentialSSE: potentialSSE}
+	now := time.Now()
+	if cached, ok := s.transports.Load(key); ok {
+		entry := cached.(*cachedTransport)
+		entry.lastUsed.Store(now.UnixNano())
+		return entry.transport
+	}
+
+	s.sweepTransports(now)
+	entry := &cachedTransport{transport: s.newTransport(targetHost, secure)}
+	if potentialSSE {
+		entry.transport.ResponseHeaderTimeout = 0
+	}
+	entry.lastUsed.Store(now.UnixNano())
+	actual, loaded := s.transports.LoadOrStore(key, entry)
+	if loaded {
+		entry.transport.CloseIdleConnections()
+		entry = actual.(*cachedTransport)
+		entry.lastUsed.Store(now.UnixNano())
+	}
+	return entry.transport
+}
+
+// sweepTransports 移除超过transportIdleTTL未使用的Transport，避免访问过的每个主机都一直留在缓存中
+// 每transportSweepInterval最多执行一次；仍在进行的请求不受影响，其连接在完成后由IdleConnTimeout关闭
+func (s *Server) sweepTransports(now time.Time) {
+	last := s.transportsSweptAt.Load()
+	if now.UnixNano()-last < int64(transportSweepInterval) || !s.transportsSweptAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	s.transports.Range(func(key, value any) bool {
+		entry := value.(*cachedTransport)
+		if now.UnixNano()-entry.lastUsed.Load() > int64(transportIdleTTL) && s.transports.CompareAndDelete(key, value) {
+			entry.transport.CloseIdleConnections()
+		}
+		return true
+	})
+}
+
 // wrapTransportForSSE wraps the base transport so that SSE responses can be detected early.
-func (s *Server) wrapTransportForSSE(base *http.Transport) http.RoundTripper {
+func (s *Server) wrapTransportForSSE(base http.RoundTripper) http.RoundTripper {
 	if base == nil {
 		return nil
 	}
 	return &earlySSEDetector{
 		base:    base,
 		server:  s,
-		verbose: s.Verbose,
+		verbose: s.logEnabled(LogLevelDebug),
 	}
 }
 
@@ -63,52 +140,98 @@ func (s *Server) prepareProxyRequest(r *http.Request, targetURL string, isHTTPS
 	startTime := time.Now()
 
 	reqCtx := s.createRequestContext(r, targetURL, startTime, isHTTPS)
+	reqCtx.deferContinueBody()
+	if reqCtx.ChaosFault = s.Chaos.pick(r.Host); reqCtx.ChaosFault != "" {
+		s.warnf("[Chaos] Injecting %s for %s %s", reqCtx.ChaosFault, r.Method, targetURL)
+	} else if s.lookupCache(reqCtx) {
+		// 由缓存返回的请求同样不发往上游，不占用速率限制的令牌
+	} else if s.RateLimiter != nil {
+		// 注入的故障不发往上游，不占用速率限制的令牌
+		s.applyRateLimit(reqCtx, r.Host)
+	}
 	if modified := s.notifyRequest(reqCtx); modified != nil && modified != r {
 		r = modified
 		reqCtx.Request = modified
 	}
 
+	if err := s.keepRequestBody(reqCtx); err != nil {
+		s.notifyError(err, reqCtx)
+		return nil, reqCtx, false, startTime, err
+	}
+
 	proxyReq, err := cloneRequestWithURL(r, targetURL)
 	if err != nil {
 		s.notifyError(err, reqCtx)
 		return nil, reqCtx, false, startTime, err
 	}
 
+	s.applyOutboundHeaders(proxyReq)
+	s.injectVariables(proxyReq)
+	proxyReq = withChaosFault(proxyReq, reqCtx.ChaosFault)
+	proxyReq = withRateLimit(proxyReq, reqCtx)
+	proxyReq = withCache(proxyReq, reqCtx)
+	proxyReq = traceTiming(proxyReq, reqCtx)
 	potentialSSE := isSSERequest(proxyReq)
 
 	return proxyReq, reqCtx, potentialSSE, startTime, nil
 }
 
 // sendProxyRequest executes the outbound request using the provided transport.
+// RequestTimeout only bounds the wait for response headers; ResponseTimeout bounds the
+// total time of non-streaming responses and is lifted once the response turns out to be SSE.
+// Upgrade requests (e.g. WebSocket) are never bounded by ResponseTimeout.
 func (s *Server) sendProxyRequest(proxyReq *http.Request, transport http.RoundTripper, potentialSSE bool, startTime time.Time) (*http.Response, time.Duration, error) {
+	// 注入的故障不发送到上游，错误响应照常经过响应处理和记录
+	if resp, injected, err := injectChaos(proxyReq); injected {
+		return resp, time.Since(startTime), err
+	}
+	// 命中缓存或离线模式下未命中时不访问上游
+	if resp, served := serveFromCache(proxyReq); served {
+		return resp, time.Since(startTime), nil
+	}
+	// 超过速率限制的请求先排队等待，拒绝模式下直接返回429
+	if resp, limited, err := waitRateLimit(proxyReq); limited {
+		return resp, time.Since(startTime), err
+	}
+
+	// 重定向交给客户端处理，每一跳都作为单独的请求经过代理并被记录
 	client := &http.Client{
 		Transport: transport,
-		Timeout:   30 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 
+	var deadline *responseDeadline
 	if potentialSSE {
-		client.Timeout = 0
 		proxyReq.Header.Set("Accept", "text/event-stream")
 		proxyReq.Header.Set("Cache-Control", "no-cache")
 		proxyReq.Header.Set("Connection", "keep-alive")
-		if detector, ok := transport.(*earlySSEDetector); ok {
-			if baseTransport, ok := detector.base.(*http.Transport); ok {
-				baseTransport.ResponseHeaderTimeout = 0
-			}
-		} else if baseTransport, ok := transport.(*http.Transport); ok {
-			baseTransport.ResponseHeaderTimeout = 0
-		}
+	} else if limit := s.responseTimeout(); limit > 0 && !isUpgradeRequest(proxyReq) {
+		proxyReq, deadline = startResponseDeadline(proxyReq, limit)
 	}
 
 	resp, err := client.Do(proxyReq)
 	timeTaken := time.Since(startTime)
 	if err != nil {
+		if deadline != nil {
+			deadline.release()
+			err = deadline.wrapErr(err)
+		}
 		return nil, timeTaken, err
 	}
 
 	if resp.Request == nil {
 		resp.Request = proxyReq
 	}
+	resp = cacheUpstreamResponse(proxyReq, resp)
+
+	if deadline != nil {
+		if s.isStreamingResponse(resp) {
+			deadline.exempt()
+		}
+		resp.Body = &deadlineBody{ReadCloser: resp.Body, deadline: deadline}
+	}
 
 	return resp, timeTaken, nil
 }
@@ -119,7 +242,13 @@ func (s *Server) processProxyResponse(reqCtx *RequestContext, resp *http.Respons
 		return nil, false
 	}
 
-	s.processCompressedResponse(resp, reqCtx, s.Verbose)
+	reqCtx.restoreRequestBody()
+	s.applyResponseVia(resp)
+	s.processCompressedResponse(resp, reqCtx, s.logEnabled(LogLevelDebug))
+	s.rewriteSetCookies(resp, reqCtx)
+	s.rewriteResponseHeaders(resp)
+	s.replaceResponseBody(resp, reqCtx)
+	s.extractVariables(resp, reqCtx)
 
 	respCtx := s.createResponseContext(reqCtx, resp, timeTaken)
 	if modified := s.notifyResponse(respCtx); modified != nil && modified != resp {
@@ -127,7 +256,7 @@ func (s *Server) processProxyResponse(reqCtx *RequestContext, resp *http.Respons
 		respCtx.Response = resp
 	}
 
-	isSSE := isServerSentEvent(respCtx.Response)
+	isSSE := s.isStreamingResponse(respCtx.Response)
 
 	if s.DumpTraffic {
 		s.dumpRequestBody(reqCtx.Request)
@@ -136,12 +265,13 @@ func (s *Server) processProxyResponse(reqCtx *RequestContext, resp *http.Respons
 		}
 	}
 
-	if !isSSE {
-		s.logToHAR(reqCtx.Request, respCtx.Response, startTime, timeTaken, false)
+	// SSE和WebSocket在流结束后才写入HAR
+	if !isSSE && !respCtx.IsWebSocket && !respCtx.SkipRecord {
+		s.logHAREntry(reqCtx.Request, respCtx.Response, startTime, timeTaken, false, !respCtx.SkipBody, s.harEntryOptions(reqCtx)...)
 	}
 
-	if s.Verbose {
-		log.Printf("%s Received response from %s: %d %s", logPrefix, targetURL, respCtx.Response.StatusCode, respCtx.Response.Status)
+	if s.logEnabled(LogLevelDebug) {
+		s.debugf("%s Received response from %s: %d %s", logPrefix, targetURL, respCtx.Response.StatusCode, respCtx.Response.Status)
 	} else {
 		reqURL := reqCtx.Request.URL
 		host := reqCtx.Request.Host
@@ -149,9 +279,10 @@ func (s *Server) processProxyResponse(reqCtx *RequestContext, resp *http.Respons
 		if reqURL != nil {
 			path = reqURL.RequestURI()
 		}
-		log.Printf("%s %s %s%s -> %d %s", logPrefix, reqCtx.Request.Method, host, path, respCtx.Response.StatusCode, respCtx.Response.Header.Get("Content-Type"))
+		s.infof("%s %s %s%s -> %d %s", logPrefix, reqCtx.Request.Method, host, path, respCtx.Response.StatusCode, respCtx.Response.Header.Get("Content-Type"))
 	}
 
+	s.countResponseBody(reqCtx.Request, respCtx.Response)
 	return respCtx, isSSE
 }
 
@@ -160,7 +291,9 @@ func (s *Server) recordProxyError(err error, reqCtx *RequestContext, startTime t
 	if reqCtx == nil {
 		return
 	}
-	s.logToHAR(reqCtx.Request, nil, startTime, timeTaken, false)
+	reqCtx.fillUpstreamTrace()
+	reqCtx.restoreRequestBody()
+	s.logToHAR(reqCtx.Request, nil, startTime, timeTaken, false, s.harEntryOptions(reqCtx)...)
 	s.notifyError(err, reqCtx)
 }
 
@@ -187,6 +320,9 @@ func (s *Server) writeHTTPResponse(w http.ResponseWriter, respCtx *ResponseConte
 	if respCtx == nil || respCtx.Response == nil {
 		return nil
 	}
+	if respCtx.ReqCtx != nil {
+		s.recompressResponse(respCtx.Response, respCtx.ReqCtx.Request)
+	}
 
 	for k, vv := range respCtx.Response.Header {
 		for _, v := range vv {
@@ -198,13 +334,13 @@ func (s *Server) writeHTTPResponse(w http.ResponseWriter, respCtx *ResponseConte
 	w.WriteHeader(respCtx.Response.StatusCode)
 
 	contentType := respCtx.Response.Header.Get("Content-Type")
-	_, err := s.streamResponse(respCtx.Response.Body, w, contentType, s.Verbose)
+	_, err := s.streamResponse(respCtx.Response.Body, w, contentType, s.logEnabled(LogLevelDebug))
 	return err
 }
 
-func logPotentialSSE(verbose bool, prefix string, potential bool) {
-	if !verbose || !potential {
+func (s *Server) logPotentialSSE(prefix string, potential bool) {
+	if !potential {
 		return
 	}
-	log.Printf("%s Potential SSE request detected based on URL path or Accept header", prefix)
+	s.debugf("%s Potential SSE request detected based on URL path or Accept header", prefix)
 }
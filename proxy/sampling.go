@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// Sampler 按比例抽样保存流量，用于在高流量场景下限制内存和磁盘占用
+// 抽样按 方法+URL 的哈希确定，同一请求的重试和重复访问会得到相同的结果
+// 未被抽中的请求只有出错或返回5xx时才会被保存，其余只计数
+type Sampler struct {
+	threshold uint64 // 哈希值小于该阈值的请求被抽中
+	skipped   atomic.Uint64
+}
+
+// NewSampler 创建抽样器，rate取值范围为[0, 1]，例如0.1表示保存约10%的请求
+func NewSampler(rate float64) (*Sampler, error) {
+	if math.IsNaN(rate) || rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("sample rate must be between 0 and 1, got %v", rate)
+	}
+	return &Sampler{threshold: uint64(rate * float64(math.MaxUint32+1))}, nil
+}
+
+// Sampled 判断请求是否被抽中，nil抽样器总是返回true
+func (s *Sampler) Sampled(method string, rawURL string) bool {
+	if s == nil {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(method))
+	_, _ = h.Write([]byte{' '})
+	_, _ = h.Write([]byte(rawURL))
+	return uint64(h.Sum32()) < s.threshold
+}
+
+// Skipped 返回因未被抽中而没有保存的事务数
+func (s *Sampler) Skipped() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.skipped.Load()
+}
+
+// shouldRecord 判断事务是否需要保存：被抽中的请求总是保存，未被抽中的请求只保存5xx响应
+// 结果在第一次判断时保存到reqCtx上，同一事务重复判断时不会重复计入Skipped
+func (s *Server) shouldRecord(reqCtx *RequestContext, statusCode int) bool {
+	if reqCtx == nil || !reqCtx.SampledOut {
+		return true
+	}
+	if reqCtx.recordDecided {
+		return reqCtx.record
+	}
+	reqCtx.recordDecided = true
+	reqCtx.record = statusCode >= 500
+	if !reqCtx.record && s.Sampler != nil {
+		s.Sampler.skipped.Add(1)
+	}
+	return reqCtx.record
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldRecordCountsSkippedOncePerTransaction(t *testing.T) {
+	sampler, err := NewSampler(0)
+	require.NoError(t, err)
+	server := NewServerWithConfig(Config{Sampler: sampler})
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	require.NoError(t, err)
+	reqCtx := server.createRequestContext(req, req.URL.String(), time.Now(), false)
+	require.True(t, reqCtx.SampledOut)
+
+	// 同一事务在响应、SSE和出错路径上多次判断，只计数一次
+	for i := 0; i < 3; i++ {
+		assert.False(t, server.shouldRecord(reqCtx, http.StatusOK))
+	}
+	assert.Equal(t, uint64(1), sampler.Skipped())
+
+	// 5xx响应的事务总是保存，不计入Skipped
+	errCtx := server.createRequestContext(req, req.URL.String(), time.Now(), false)
+	assert.True(t, server.shouldRecord(errCtx, http.StatusBadGateway))
+	assert.True(t, server.shouldRecord(errCtx, http.StatusBadGateway))
+	assert.Equal(t, uint64(1), sampler.Skipped())
+}
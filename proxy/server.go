@@ -4,9 +4,19 @@ import (
 	// Added for reading requests from TLS connection
 	// Added for bytes.Buffer
 
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url" // Added for constructing target URLs
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/LubyRuffy/ProxyCraft/certs"
 	"github.com/LubyRuffy/ProxyCraft/harlogger" // Added for HAR logging
@@ -14,30 +24,186 @@ import (
 	"golang.org/x/net/http2/h2c"
 )
 
-// ServerConfig 包含所有服务器配置项
-type ServerConfig struct {
+// Config 包含所有服务器配置项，也是将代理嵌入其他Go程序时使用的入口，见 New
+type Config struct {
 	// 监听地址
 	Addr string
 
 	// 证书管理器
 	CertManager *certs.Manager
 
-	// 是否输出详细日志
+	// 用于MITM签发证书的CA，仅在CertManager为nil时使用；两者都为空时New会在内存中生成临时CA
+	CACert *x509.Certificate
+	CAKey  *rsa.PrivateKey
+
+	// 日志输出，为nil时使用标准库log的默认Logger
+	LogWriter io.Writer
+
+	// 是否输出详细日志，为true时日志级别至少为LogLevelDebug
 	Verbose bool
 
+	// 日志级别，为0时使用LogLevelInfo
+	LogLevel LogLevel
+
+	// 接收分级日志的Logger，设置后优先于LogWriter
+	LeveledLogger LeveledLogger
+
 	// HAR 日志记录器
 	HarLogger *harlogger.Logger
 
 	// 上游代理 URL
 	UpstreamProxy *url.URL
 
+	// 多级上游代理链，按顺序依次经过，设置后优先于 UpstreamProxy
+	UpstreamProxyChain []*url.URL
+
+	// 不经过上游代理、直接连接的目标主机（NO_PROXY）
+	UpstreamBypass *BypassList
+
+	// 通过DNS-over-HTTPS解析上游主机名，为nil时使用系统DNS
+	DoHResolver *DoHResolver
+
+	// 按主机名固定上游证书的SHA-256指纹，命中的主机只接受指纹一致的证书，为nil时不校验上游证书
+	CertPins CertPins
+
 	// 是否将抓包内容输出到控制台
 	DumpTraffic bool
 
+	// 是否在必要时改写Set-Cookie的Domain/Secure属性，默认关闭
+	RewriteCookies bool
+
+	// 是否保持压缩的响应体原样转发和记录，不做解压，默认关闭
+	NoDecompress bool
+
+	// 没有HAR、EventHandler、-dump和响应体替换需要读取消息体时，直接流式转发消息体，不做缓存和解压
+	// 用于只需要转发的高吞吐场景，有任何一项需要消息体时不生效
+	PassthroughBodies bool
+
+	// 隐私模式：只记录请求和响应的元数据及头部，WebHandler、HAR和-dump都不读取、不保存任何消息体，大小取自Content-Length
+	// 流量照常转发；与PassthroughBodies不同，记录方仍然工作
+	NoBodies bool
+
+	// 是否不与客户端协商HTTP/2（MITM和反向代理的ALPN只提供http/1.1，明文连接不支持h2c）
+	NoClientHTTP2 bool
+
+	// 是否只使用HTTP/1.1连接上游
+	NoUpstreamHTTP2 bool
+
+	// 决定是否保存响应体的回调，为nil时使用CaptureAllBodies
+	ShouldCaptureBody ShouldCaptureBodyFunc
+
+	// 流量抽样器，为nil时保存所有请求
+	Sampler *Sampler
+
+	// 转发前依次对文本响应体执行的正则替换规则
+	BodyReplacements []*BodyReplacement
+
+	// 转发给客户端前按顺序对响应头执行的删除和设置，HAR和EventHandler记录的是修改后的响应头
+	ResponseHeaderRules []*ResponseHeaderRule
+
+	// Transports 按主机为转发指定自定义的RoundTripper（例如HTTP/2 prior-knowledge或测试桩），键为主机模式：
+	// "api.example.com:8443"、"api.example.com"（任意端口）、"*.example.com"（子域名）或 "*"（所有主机）
+	// 多个模式匹配时最具体的生效：host:port 优先于 host，host 优先于通配，较长的通配后缀优先于较短的，"*" 最后
+	// 自定义RoundTripper替代默认Transport，上游代理、DoH、超时和TLS设置等需要由它自行处理；SSE识别和事件处理照常进行
+	Transports map[string]http.RoundTripper
+
+	// 等待上游响应头的超时时间，为0时使用20秒，为负数时不限制
+	RequestTimeout time.Duration
+
+	// 客户端请求头和上游响应头的大小上限，为0时使用1MB
+	// 超出时普通HTTP请求返回431，MITM隧道内回复431后关闭连接，上游响应按网关错误处理
+	MaxHeaderBytes int
+
+	// 非流式响应从发出请求到读完响应体的总时间上限，为0时使用30秒，为负数时不限制
+	// SSE响应在收到响应头后不再受此限制
+	ResponseTimeout time.Duration
+
+	// SSE流的上游空闲超过该时间时，向客户端注入 ": keep-alive" 注释作为心跳，为0时不注入
+	// 心跳不会交给EventHandler，也不会记录到响应体中
+	SSEKeepAlive time.Duration
+
+	// 额外声明为LLM服务的主机（见ParseLLMHosts），发往这些主机的Ollama风格接口（/api/generate等）
+	// 返回长度未知的JSON时按流式响应逐块转发；名称含ollama或使用11434端口的主机不需要声明
+	LLMHosts *LLMHosts
+
+	// 在转发的请求和响应上追加 "Via: 1.1 ProxyCraft"，并以508拒绝已带有该条目的请求以防代理环路
+	AddVia bool
+
+	// 非空时把转发请求的User-Agent改写为该值
+	OverrideUserAgent string
+
+	// 大于0时由代理跟随上游返回的重定向，最多跟随这么多次，把最终响应返回给客户端；每一跳都作为单独的请求记录
+	// 为0时重定向原样交给客户端处理
+	FollowRedirects int
+
+	// 反向代理模式的后端地址，设置后以HTTPS服务器方式直接接收请求并转发到该地址
+	ReverseTarget *url.URL
+
+	// 反向代理模式对外使用的证书，为nil时按主机名签发MITM证书
+	ReverseCertificate *tls.Certificate
+
+	// 反向代理模式下除后端主机名外允许按SNI签发证书的主机名，其他SNI一律使用后端主机名的证书
+	ReverseHosts []string
+
+	// 按比例对匹配的请求注入错误响应或断开连接，用于混沌测试，为nil时不注入
+	Chaos *Chaos
+
+	// 按目标主机限制转发到上游的请求速率，为nil时不限制
+	RateLimiter *RateLimiter
+
+	// 缓存GET/HEAD响应并对重复的请求直接返回缓存，为nil时不缓存
+	Cache *ResponseCache
+
+	// 从匹配的JSON响应中提取变量，以及把变量写入后续请求头的规则
+	ExtractRules []*ExtractRule
+	InjectRules  []*InjectRule
+
+	// 客户端收到MITM证书后中止握手（通常是证书固定）时，记住该主机并在AutoPassthroughTTL内直接建立隧道，不再拦截
+	AutoPassthrough bool
+
+	// 自动直通隧道的有效期，为0时使用DefaultAutoPassthroughTTL
+	AutoPassthroughTTL time.Duration
+
+	// 面向客户端（MITM和反向代理）的TLS版本范围，为0时使用TLS 1.2 ~ TLS 1.3
+	TLSMinVersion uint16
+	TLSMaxVersion uint16
+
+	// 面向客户端的TLS 1.2及以下版本的密码套件，为空时使用内置的ECDHE+AEAD列表
+	TLSCipherSuites []uint16
+
+	// 同时活动的客户端连接数上限，为0时不限制；达到上限后按ConnLimitMode排队或拒绝新连接
+	MaxConns      int
+	ConnLimitMode ConnLimitMode
+
 	// 事件处理器
 	EventHandler EventHandler
+
+	// EventHandlers 是与EventHandler同时挂载的其他事件处理器（输出目标），例如在WebHandler之外再写JSONL
+	// 按顺序排在EventHandler之后逐个调用，后面的处理器看到的是前面处理器修改后的请求、响应和SSE事件
+	EventHandlers []EventHandler
+
+	// MITMProcesses 非空时只对这些进程发起的CONNECT做MITM，其他进程（包括无法识别的）直接建立隧道
+	// 进程名不区分大小写，忽略.exe后缀；普通HTTP请求不受影响
+	MITMProcesses []string
+
+	// ProcessResolver 根据客户端地址查找发起连接的进程名，为nil时使用LookupProcess（只能识别本机进程）
+	ProcessResolver ProcessResolverFunc
+
+	// Recompress 为true时，客户端的Accept-Encoding接受gzip就用gzip重新压缩转发给客户端的文本响应体
+	// 只影响写回客户端的内容，事件处理器和HAR记录的仍是未压缩的响应体；SSE等流式响应不压缩
+	Recompress bool
+
+	// OnComplete 在每个事务完成后调用一次，参数汇总了请求、响应、消息体和耗时，只需要完整事务时比实现EventHandler简单
+	// 与EventHandler可以同时设置：它排在EventHandler之后，在其OnResponse（SSE为流结束）或OnError之后调用，
+	// 看到的是EventHandler修改后的请求和响应；设置后会缓存完整的请求体和响应体，PassthroughBodies不再生效
+	OnComplete func(tx *Transaction)
 }
 
+// ServerConfig 是Config的旧名称
+//
+// Deprecated: 使用 Config
+type ServerConfig = Config
+
 // Server struct will hold proxy server configuration and state
 type Server struct {
 	Addr          string
@@ -47,6 +213,84 @@ type Server struct {
 	UpstreamProxy *url.URL          // 上层代理服务器URL，如果为nil则直接连接
 	DumpTraffic   bool              // 是否将抓包内容输出到控制台
 	EventHandler  EventHandler      // 事件处理器
+
+	completeHandler *completeHandler // Config.OnComplete的适配器，见withCompleteHook
+
+	UpstreamProxyChain []*url.URL  // 多级上层代理链，按顺序建立嵌套CONNECT隧道
+	UpstreamBypass     *BypassList // 命中时不经过上层代理，直接连接目标
+
+	DoHResolver *DoHResolver // 连接上游时通过DoH解析主机名，为nil时使用系统DNS
+	CertPins    CertPins     // 固定的上游证书指纹
+
+	Chaos       *Chaos         // 混沌测试：按比例注入错误响应或断开连接，为nil时不注入
+	RateLimiter *RateLimiter   // 按目标主机限制转发速率，为nil时不限制
+	Cache       *ResponseCache // 响应缓存，为nil时不缓存
+
+	ExtractRules []*ExtractRule // 从匹配的JSON响应体中提取变量的规则
+	InjectRules  []*InjectRule  // 把已提取的变量写入转发请求头的规则
+	Variables    *VariableStore // 提取到的变量，NewServerWithConfig中创建
+
+	ReverseTarget      *url.URL         // 反向代理模式的后端地址，为nil时作为正向代理运行
+	ReverseCertificate *tls.Certificate // 反向代理模式对外使用的证书
+	ReverseHosts       []string         // 反向代理模式下允许按SNI签发证书的额外主机名
+	reverseCerts       sync.Map         // 反向代理模式按主机名缓存的MITM证书，只包含后端主机名和ReverseHosts
+	transports         sync.Map         // 按目标主机缓存的上游Transport，见transportFor
+	transportsSweptAt  atomic.Int64     // 上次清理transports的时间（UnixNano），见sweepTransports
+	hostStats          sync.Map         // 按主机统计的请求数、字节数和错误数，见Stats
+	activeConns        atomic.Int64     // 活动的客户端连接数，见Health
+	startedAt          time.Time        // 创建服务器的时间，用于计算Health中的运行时长
+
+	TLSMinVersion   uint16   // 面向客户端的最低TLS版本，为0时使用TLS 1.2
+	TLSMaxVersion   uint16   // 面向客户端的最高TLS版本，为0时使用TLS 1.3
+	TLSCipherSuites []uint16 // 面向客户端的密码套件，为空时使用默认列表
+
+	AutoPassthrough    bool          // 客户端拒绝MITM证书后，是否在一段时间内对该主机直接建立隧道
+	AutoPassthroughTTL time.Duration // 自动直通隧道的有效期，为0时使用DefaultAutoPassthroughTTL
+	passthroughHosts   sync.Map      // 自动直通的主机到过期时间的映射，见shouldPassthrough
+
+	RewriteCookies bool // 是否在必要时改写Set-Cookie的Domain/Secure属性
+	NoDecompress   bool // 为true时响应体保持压缩原样转发和记录，保留Content-Encoding
+
+	PassthroughBodies bool // 没有任何记录方需要消息体时直接流式转发，见passthroughBodies
+	NoBodies          bool // 隐私模式，任何记录方都不读取和保存消息体，见RequestContext.SkipBody和ResponseContext.SkipBody
+
+	NoClientHTTP2   bool // 为true时不与客户端协商HTTP/2，作为HTTP/2 MITM处理出问题时的兼容开关
+	NoUpstreamHTTP2 bool // 为true时只使用HTTP/1.1连接上游
+
+	BodyReplacements []*BodyReplacement // 转发和记录前对文本响应体执行的正则替换，SSE和压缩的响应体除外
+
+	ResponseHeaderRules []*ResponseHeaderRule // 转发和记录前按顺序对响应头执行的删除和设置
+
+	Transports map[string]http.RoundTripper // 按主机模式替代默认Transport的RoundTripper，见Config.Transports
+
+	MITMProcesses   []string            // 只对这些进程发起的CONNECT做MITM，为空时不限制，见interceptsProcess
+	ProcessResolver ProcessResolverFunc // 查找客户端进程名，为nil时使用LookupProcess
+
+	Recompress bool // 写回客户端前用gzip重新压缩文本响应体，见recompressResponse
+
+	// ShouldCaptureBody 在缓存响应体之前调用，返回false时WebHandler和HAR只记录元数据（大小取自Content-Length）
+	// 可用于跳过视频流等大响应或对大响应体抽样
+	ShouldCaptureBody ShouldCaptureBodyFunc
+
+	// Sampler 按比例抽样保存流量，未抽中的请求只有5xx或出错时才交给WebHandler和HAR保存
+	Sampler *Sampler
+
+	RequestTimeout  time.Duration // 等待上游响应头的超时时间，为0时使用默认值，为负数时不限制
+	MaxHeaderBytes  int           // 请求头和上游响应头的大小上限，为0时使用http.DefaultMaxHeaderBytes
+	ResponseTimeout time.Duration // 非流式响应的总读取时间上限，为0时使用默认值，为负数时不限制
+	SSEKeepAlive    time.Duration // SSE流上游空闲超过该时间时向客户端注入心跳注释，为0时不注入
+	LLMHosts        *LLMHosts     // 额外声明为LLM服务的主机，见isStreamingResponse
+
+	AddVia            bool   // 在转发的请求和响应上追加Via，并以508拒绝已经过本代理的请求
+	OverrideUserAgent string // 非空时改写转发请求的User-Agent
+	FollowRedirects   int    // 服务端跟随上游重定向的最大次数，为0时交给客户端
+
+	MaxConns      int           // 同时活动的客户端连接数上限（CONNECT隧道在关闭前一直占用名额），为0时不限制
+	ConnLimitMode ConnLimitMode // 达到MaxConns后排队等待还是回复503拒绝，为空时排队
+
+	Logger        *log.Logger   // 日志输出，为nil时使用标准库log的默认Logger
+	LogLevel      LogLevel      // 日志级别，为0时使用LogLevelInfo，Verbose为true时至少为LogLevelDebug
+	LeveledLogger LeveledLogger // 设置后代理日志交给它输出而不是Logger
 }
 
 // NewServer creates a new proxy server instance
@@ -59,11 +303,39 @@ func NewServer(addr string, certManager *certs.Manager, verbose bool, harLogger
 		UpstreamProxy: upstreamProxy,
 		DumpTraffic:   dumpTraffic,
 		EventHandler:  &NoOpEventHandler{}, // 默认使用空实现
+
+		ShouldCaptureBody: CaptureAllBodies,
+		startedAt:         time.Now(),
 	}
 }
 
+// New 根据配置创建可嵌入的代理服务器，不读写任何全局状态
+// 未提供CertManager时使用CACert/CAKey，二者都为空则在内存中生成临时CA，不会写入 ~/.proxycraft
+func New(cfg Config) (*Server, error) {
+	if cfg.CertManager == nil {
+		switch {
+		case cfg.CACert != nil && cfg.CAKey != nil:
+			certManager, err := certs.NewManagerFromCA(cfg.CACert, cfg.CAKey)
+			if err != nil {
+				return nil, err
+			}
+			cfg.CertManager = certManager
+		case cfg.CACert != nil || cfg.CAKey != nil:
+			return nil, errors.New("proxy: CACert and CAKey must be set together")
+		default:
+			certManager, err := certs.NewInMemoryManager()
+			if err != nil {
+				return nil, fmt.Errorf("proxy: generate in-memory CA: %w", err)
+			}
+			cfg.CertManager = certManager
+		}
+	}
+
+	return NewServerWithConfig(cfg), nil
+}
+
 // NewServerWithConfig 使用配置创建新的代理服务器实例
-func NewServerWithConfig(config ServerConfig) *Server {
+func NewServerWithConfig(config Config) *Server {
 	server := &Server{
 		Addr:          config.Addr,
 		CertManager:   config.CertManager,
@@ -72,33 +344,125 @@ func NewServerWithConfig(config ServerConfig) *Server {
 		UpstreamProxy: config.UpstreamProxy,
 		DumpTraffic:   config.DumpTraffic,
 		EventHandler:  config.EventHandler,
+
+		UpstreamProxyChain: config.UpstreamProxyChain,
+		UpstreamBypass:     config.UpstreamBypass,
+		DoHResolver:        config.DoHResolver,
+		CertPins:           config.CertPins,
+
+		Chaos:        config.Chaos,
+		RateLimiter:  config.RateLimiter,
+		Cache:        config.Cache,
+		ExtractRules: config.ExtractRules,
+		InjectRules:  config.InjectRules,
+		Variables:    NewVariableStore(),
+
+		ReverseTarget:      config.ReverseTarget,
+		ReverseCertificate: config.ReverseCertificate,
+		ReverseHosts:       config.ReverseHosts,
+		startedAt:          time.Now(),
+
+		TLSMinVersion:      config.TLSMinVersion,
+		TLSMaxVersion:      config.TLSMaxVersion,
+		TLSCipherSuites:    config.TLSCipherSuites,
+		AutoPassthrough:    config.AutoPassthrough,
+		AutoPassthroughTTL: config.AutoPassthroughTTL,
+
+		RewriteCookies:    config.RewriteCookies,
+		NoDecompress:      config.NoDecompress,
+		PassthroughBodies: config.PassthroughBodies,
+		NoBodies:          config.NoBodies,
+		NoClientHTTP2:     config.NoClientHTTP2,
+		NoUpstreamHTTP2:   config.NoUpstreamHTTP2,
+
+		BodyReplacements:    config.BodyReplacements,
+		ResponseHeaderRules: config.ResponseHeaderRules,
+		Transports:          config.Transports,
+		MITMProcesses:       config.MITMProcesses,
+		ProcessResolver:     config.ProcessResolver,
+		Recompress:          config.Recompress,
+		ShouldCaptureBody:   config.ShouldCaptureBody,
+		Sampler:             config.Sampler,
+
+		RequestTimeout:    config.RequestTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		ResponseTimeout:   config.ResponseTimeout,
+		SSEKeepAlive:      config.SSEKeepAlive,
+		LLMHosts:          config.LLMHosts,
+		AddVia:            config.AddVia,
+		OverrideUserAgent: config.OverrideUserAgent,
+		FollowRedirects:   config.FollowRedirects,
+		MaxConns:          config.MaxConns,
+		ConnLimitMode:     config.ConnLimitMode,
+		LogLevel:          config.LogLevel,
+		LeveledLogger:     config.LeveledLogger,
+	}
+
+	if config.LogWriter != nil {
+		server.Logger = log.New(config.LogWriter, "", log.LstdFlags)
+	}
+
+	if len(config.EventHandlers) > 0 {
+		server.EventHandler = combineEventHandlers(append([]EventHandler{config.EventHandler}, config.EventHandlers...)...)
 	}
 
 	// 如果没有提供事件处理器，使用默认的空实现
 	if server.EventHandler == nil {
 		server.EventHandler = &NoOpEventHandler{}
 	}
+	if config.OnComplete != nil {
+		server.completeHandler = newCompleteHandler(config.OnComplete)
+		server.EventHandler = server.withCompleteHook(server.EventHandler)
+	}
+
+	// 默认保存所有响应体
+	if server.ShouldCaptureBody == nil {
+		server.ShouldCaptureBody = CaptureAllBodies
+	}
 
 	return server
 }
 
-// SetEventHandler 设置事件处理器
+// SetEventHandler 设置事件处理器，设置了Config.OnComplete时仍会在新处理器之后调用
 func (s *Server) SetEventHandler(handler EventHandler) {
-	s.EventHandler = handler
+	s.EventHandler = s.withCompleteHook(handler)
 }
 
 // Start begins listening for incoming proxy requests
 func (s *Server) Start() error {
-	fmt.Printf("Proxy server starting on %s\n", s.Addr)
-	server := s.buildHTTPServer()
-	return server.ListenAndServe()
+	if s.ReverseTarget != nil {
+		return s.startReverse()
+	}
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在调用方提供的监听器上运行正向代理，便于嵌入时使用随机端口
+func (s *Server) Serve(l net.Listener) error {
+	s.infof("Proxy server starting on %s", l.Addr())
+	return s.buildHTTPServer().Serve(s.trackConns(s.limitListener(l, true)))
 }
 
 func (s *Server) buildHTTPServer() *http.Server {
-	h2Server := &http2.Server{}
-	handler := h2c.NewHandler(http.HandlerFunc(s.handleHTTP), h2Server)
+	var handler http.Handler = http.HandlerFunc(s.handleHTTP)
+	if !s.NoClientHTTP2 {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
 	return &http.Server{
-		Addr:    s.Addr,
-		Handler: handler,
+		Addr:           s.Addr,
+		Handler:        handler,
+		ErrorLog:       s.Logger,
+		MaxHeaderBytes: s.maxHeaderBytes(),
+	}
+}
+
+// logger 返回服务器使用的Logger
+func (s *Server) logger() *log.Logger {
+	if s.Logger != nil {
+		return s.Logger
 	}
+	return log.Default()
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -26,11 +27,12 @@ func (t *ResponseBodyTee) Write(p []byte) (n int, err error) {
 		return n, err
 	}
 
-	// 同时写入缓冲区
-	_, bufErr := t.buffer.Write(p)
-	if bufErr != nil {
-		// 如果缓冲区写入失败，仅记录日志，不影响原始写入
-		log.Printf("[SSE] Error writing to buffer: %v", bufErr)
+	// 同时写入缓冲区，不保存响应体时buffer为nil
+	if t.buffer != nil {
+		if _, bufErr := t.buffer.Write(p); bufErr != nil {
+			// 如果缓冲区写入失败，仅记录日志，不影响原始写入
+			log.Printf("[SSE] Error writing to buffer: %v", bufErr)
+		}
 	}
 
 	// 刷新数据
@@ -59,7 +61,10 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 	}
 
 	// Ensure critical headers are set for SSE streaming
-	w.Header().Set("Content-Type", "text/event-stream")
+	eventStream := isEventStream(respCtx.Response)
+	if eventStream {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Del("Content-Length") // Remove Content-Length to ensure chunked encoding
@@ -80,16 +85,30 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 	flusher.Flush()
 
 	// Log SSE handling
-	if s.Verbose {
-		log.Printf("[SSE] Handling Server-Sent Events stream")
-	}
+	s.debugf("[SSE] Handling Server-Sent Events stream")
 
-	// 创建一个 ResponseBodyTee 来同时处理流和记录数据
+	// 创建一个 ResponseBodyTee 来同时处理流和记录数据，不保存响应体时只转发
 	tee := &ResponseBodyTee{
-		buffer:  &bytes.Buffer{},
 		writer:  w,
 		flusher: flusher,
 	}
+	if !respCtx.SkipBody {
+		tee.buffer = &bytes.Buffer{}
+	}
+
+	// 上游空闲时在事件之间注入心跳；心跳写入失败说明客户端已断开，关闭上游响应体以结束读取
+	// 仍保持压缩的流中不能插入明文心跳
+	encoding := respCtx.Response.Header.Get("Content-Encoding")
+	compressed := encoding != "" && !strings.EqualFold(encoding, "identity")
+	if s.SSEKeepAlive > 0 && eventStream && !compressed {
+		keepAlive := newSSEKeepAliveWriter(w, flusher, s.SSEKeepAlive, func(err error) {
+			s.debugf("[SSE] Failed to write keep-alive, closing upstream stream: %v", err)
+			_ = respCtx.Response.Body.Close()
+		})
+		defer keepAlive.Close()
+		tee.writer = keepAlive
+		tee.flusher = nil
+	}
 
 	// 创建请求上下文，如果请求有效
 	respCtx.ReqCtx.IsSSE = true
@@ -126,6 +145,18 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 		payload := eventBuffer.Bytes()
 		eventBuffer.Reset()
 
+		// 先交给处理器，处理器可以修改或丢弃事件；修改后的事件沿用原事件结尾的换行
+		eventStr := strings.TrimRight(string(payload), "\r\n")
+		if respCtx != nil && strings.TrimSpace(eventStr) != "" {
+			switch modified := s.notifySSE(eventStr, respCtx); modified {
+			case "", eventStr:
+			case DropSSEEvent:
+				return nil
+			default:
+				payload = append([]byte(modified), payload[len(eventStr):]...)
+			}
+		}
+
 		_, err := tee.Write(payload)
 		if err != nil {
 			if respCtx.ReqCtx != nil {
@@ -134,15 +165,35 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 			return fmt.Errorf("error writing SSE data: %v", err)
 		}
 
-		eventStr := strings.TrimRight(string(payload), "\r\n")
-		if respCtx != nil && strings.TrimSpace(eventStr) != "" {
-			s.notifySSE(eventStr, respCtx)
-		}
-
 		return nil
 	}
 
-	for {
+	// 仍保持压缩的流无法按行拆分事件，按读到的数据块原样转发，避免等待压缩数据中的换行而缓冲
+	if compressed {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				if _, err := tee.Write(buf[:n]); err != nil {
+					if respCtx.ReqCtx != nil {
+						s.notifyError(fmt.Errorf("error writing SSE data: %v", err), respCtx.ReqCtx)
+					}
+					return fmt.Errorf("error writing SSE data: %v", err)
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				if respCtx.ReqCtx != nil {
+					s.notifyError(fmt.Errorf("error reading SSE stream: %v", err), respCtx.ReqCtx)
+				}
+				return fmt.Errorf("error reading SSE stream: %v", err)
+			}
+		}
+	}
+
+	for !compressed {
 		line, err := reader.ReadBytes('\n')
 		if err != nil {
 			if err == io.EOF {
@@ -157,15 +208,15 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 
 		// Log the event if verbose
 		lineStr := strings.TrimSpace(string(line))
-		logSSEEvent(lineStr, s.Verbose)
+		s.logSSEEvent(lineStr)
 
 		// 如果启用了流量输出，输出 SSE 事件
-		if s.DumpTraffic && lineStr != "" {
+		if s.DumpTraffic && !s.NoBodies && lineStr != "" {
 			fmt.Printf("%s %s\n", dumpPrefix, lineStr)
 		}
 
 		eventBuffer.Write(line)
-		if lineStr == "" {
+		if lineStr == "" || !eventStream {
 			if err := flushEvent(); err != nil {
 				return err
 			}
@@ -182,34 +233,37 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 		// 发送一个特殊的SSE完成事件
 		s.notifySSE("__SSE_COMPLETED__", respCtx)
 
-		if s.Verbose {
-			log.Printf("[SSE] Stream completed, notified handlers")
-		}
+		s.debugf("[SSE] Stream completed, notified handlers")
 	}
 
-	if s.HarLogger.IsEnabled() {
+	if s.HarLogger != nil && s.HarLogger.IsEnabled() && (respCtx == nil || !respCtx.SkipRecord) {
 		// 计算流处理时间
 		timeTaken := time.Since(startTime)
 		if respCtx != nil {
 			respCtx.TimeTaken = timeTaken
 		}
 
-		// 创建一个新的响应，包含收集到的完整数据
+		// 创建一个新的响应，包含收集到的完整数据；不保存响应体时只记录元数据
 		newResp := &http.Response{
-			Status:     respCtx.Response.Status,
-			StatusCode: respCtx.Response.StatusCode,
-			Header:     respCtx.Response.Header.Clone(),
-			Body:       io.NopCloser(bytes.NewReader(tee.GetBuffer().Bytes())),
-			Proto:      respCtx.Response.Proto,
-			ProtoMajor: respCtx.Response.ProtoMajor,
-			ProtoMinor: respCtx.Response.ProtoMinor,
+			Status:        respCtx.Response.Status,
+			StatusCode:    respCtx.Response.StatusCode,
+			Header:        respCtx.Response.Header.Clone(),
+			Body:          http.NoBody,
+			ContentLength: -1,
+			Proto:         respCtx.Response.Proto,
+			ProtoMajor:    respCtx.Response.ProtoMajor,
+			ProtoMinor:    respCtx.Response.ProtoMinor,
+		}
+		if buffer := tee.GetBuffer(); buffer != nil {
+			newResp.Body = io.NopCloser(bytes.NewReader(buffer.Bytes()))
+			newResp.ContentLength = int64(buffer.Len())
 		}
 
 		// 使用原始请求记录 HAR 条目
-		s.logToHAR(respCtx.Response.Request, newResp, startTime, timeTaken, false) // 这里使用 false 因为我们已经有了完整的数据
+		s.logHAREntry(respCtx.Response.Request, newResp, startTime, timeTaken, false, !respCtx.SkipBody, s.harEntryOptions(respCtx.ReqCtx)...) // 这里使用 false 因为我们已经有了完整的数据
 
-		if s.Verbose {
-			log.Printf("[SSE] Recorded complete SSE response in HAR log (%d bytes)", tee.GetBuffer().Len())
+		if s.logEnabled(LogLevelDebug) {
+			s.debugf("[SSE] Recorded complete SSE response in HAR log (%d bytes)", newResp.ContentLength)
 		}
 	}
 
@@ -218,21 +272,21 @@ func (s *Server) handleSSE(w http.ResponseWriter, respCtx *ResponseContext) erro
 
 // logSSEEvent 记录 SSE 事件的日志
 // 这个函数集中了所有 SSE 事件日志记录逻辑，避免代码重复
-func logSSEEvent(lineStr string, verbose bool) {
-	if !verbose || len(lineStr) <= 1 { // Skip empty lines or when verbose is disabled
+func (s *Server) logSSEEvent(lineStr string) {
+	if !s.logEnabled(LogLevelDebug) || len(lineStr) <= 1 { // Skip empty lines or when debug logging is disabled
 		return
 	}
 
 	if strings.HasPrefix(lineStr, "data:") {
-		log.Printf("[SSE] Event data: %s", lineStr)
+		s.debugf("[SSE] Event data: %s", lineStr)
 	} else if strings.HasPrefix(lineStr, "event:") {
-		log.Printf("[SSE] Event type: %s", lineStr)
+		s.debugf("[SSE] Event type: %s", lineStr)
 	} else if strings.HasPrefix(lineStr, "id:") {
-		log.Printf("[SSE] Event ID: %s", lineStr)
+		s.debugf("[SSE] Event ID: %s", lineStr)
 	} else if strings.HasPrefix(lineStr, "retry:") {
-		log.Printf("[SSE] Event retry: %s", lineStr)
+		s.debugf("[SSE] Event retry: %s", lineStr)
 	} else if lineStr != "" {
-		log.Printf("[SSE] Event line: %s", lineStr)
+		s.debugf("[SSE] Event line: %s", lineStr)
 	}
 }
 
@@ -259,6 +313,11 @@ func isServerSentEvent(resp *http.Response) bool {
 		return false
 	}
 
+	// 按行分隔的 JSON 流（如 Ollama 的 application/x-ndjson）
+	if isLineDelimitedJSON(contentType) {
+		return true
+	}
+
 	// 检查是否是 JSON 流
 	// 注意：httpbin.org/stream 返回的是 JSON 流，而不是真正的 SSE
 	// 但我们仍然可以将其作为流式处理
@@ -278,6 +337,75 @@ func isServerSentEvent(resp *http.Response) bool {
 	return false
 }
 
+// isStreamingResponse 在isServerSentEvent的基础上识别LLM服务的流式接口：发往LLM主机的streamingPaths请求
+// 返回长度未知（chunked）的JSON或无类型响应时按流式处理；带Content-Length的普通JSON响应和其他主机上的同名路径不受影响
+func (s *Server) isStreamingResponse(resp *http.Response) bool {
+	if isServerSentEvent(resp) {
+		return true
+	}
+	if resp.Request == nil || resp.Request.URL == nil || resp.ContentLength >= 0 {
+		return false
+	}
+	contentType := resp.Header.Get("Content-Type")
+	return (contentType == "" || strings.Contains(contentType, "application/json")) &&
+		isStreamingPath(resp.Request.URL.Path) && s.isLLMHost(resp.Request.URL.Host)
+}
+
+// ollamaDefaultPort 是Ollama默认监听的端口
+const ollamaDefaultPort = "11434"
+
+// isLLMHost 判断hostPort是否是可能提供streamingPaths接口的LLM服务：
+// LLMHosts中声明的主机、名称含ollama的主机或使用Ollama默认端口的主机
+func (s *Server) isLLMHost(hostPort string) bool {
+	if s.LLMHosts.lookup(hostPort) != "" {
+		return true
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = hostPort
+	}
+	return port == ollamaDefaultPort || strings.Contains(strings.ToLower(host), "ollama")
+}
+
+// streamingPaths 是默认以流式 JSON 返回结果的接口路径后缀（Ollama 的 generate/chat/pull 等）
+var streamingPaths = []string{
+	"/api/generate",
+	"/api/chat",
+	"/api/pull",
+	"/api/push",
+	"/api/create",
+}
+
+func isStreamingPath(path string) bool {
+	path = strings.TrimSuffix(strings.ToLower(path), "/")
+	for _, suffix := range streamingPaths {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLineDelimitedJSON 判断Content-Type是否是按行分隔的JSON流
+func isLineDelimitedJSON(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines", "application/stream+json":
+		return true
+	}
+	return false
+}
+
+// isEventStream 判断流式响应是否按SSE格式处理：text/event-stream，或没有Content-Type而请求接受text/event-stream
+// 其余流式响应（NDJSON、JSON流）保留原来的Content-Type，每行作为一个事件转发，也不注入SSE心跳
+func isEventStream(resp *http.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return resp.Request != nil && strings.Contains(resp.Request.Header.Get("Accept"), "text/event-stream")
+	}
+	return strings.Contains(contentType, "text/event-stream")
+}
+
 // isSSERequest checks if the request might be for a Server-Sent Event stream
 func isSSERequest(req *http.Request) bool {
 	// Check Accept header for SSE
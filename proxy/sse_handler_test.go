@@ -1,7 +1,9 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"net"
@@ -15,6 +17,7 @@ import (
 	"github.com/LubyRuffy/ProxyCraft/certs"
 	"github.com/LubyRuffy/ProxyCraft/harlogger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // 定义测试使用的助手结构体和函数
@@ -238,7 +241,7 @@ func TestSSEEventLogging(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.input, func(t *testing.T) {
 			// 调用测试函数，不期望报错
-			logSSEEvent(test.input, test.verbose)
+			(&Server{Verbose: test.verbose}).logSSEEvent(test.input)
 		})
 	}
 }
@@ -287,6 +290,133 @@ func TestIsSSE(t *testing.T) {
 	assert.True(t, isServerSentEvent(sseResp))
 	assert.False(t, isServerSentEvent(normalResp))
 	assert.True(t, isServerSentEvent(openaiResp))
+
+	// NDJSON 流以及已知流式接口的 chunked JSON 响应
+	ndjsonResp := &http.Response{
+		Header:        http.Header{"Content-Type": []string{"application/x-ndjson"}},
+		ContentLength: -1,
+		Request:       &http.Request{URL: &url.URL{Path: "/api/generate"}},
+	}
+	ollamaChunked := &http.Response{
+		Header:        http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		ContentLength: -1,
+		Request:       &http.Request{URL: &url.URL{Path: "/api/chat"}},
+	}
+	ollamaComplete := &http.Response{
+		Header:        http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		ContentLength: 120,
+		Request:       &http.Request{URL: &url.URL{Path: "/api/chat"}},
+	}
+	chunkedJSON := &http.Response{
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		ContentLength: -1,
+		Request:       &http.Request{URL: &url.URL{Path: "/api/users"}},
+	}
+	assert.True(t, isServerSentEvent(ndjsonResp))
+	assert.False(t, isServerSentEvent(ollamaChunked))
+
+	// 流式接口路径只对LLM主机生效：名称含ollama、使用11434端口或在LLMHosts中声明的主机
+	llmHosts, err := ParseLLMHosts("llm.corp:8000")
+	require.NoError(t, err)
+	server := &Server{LLMHosts: llmHosts}
+	for _, host := range []string{"localhost:11434", "ollama.internal", "llm.corp:8000"} {
+		ollamaChunked.Request.URL.Host = host
+		assert.True(t, server.isStreamingResponse(ollamaChunked), host)
+	}
+	ollamaChunked.Request.URL.Host = "api.example.com"
+	assert.False(t, server.isStreamingResponse(ollamaChunked))
+	ollamaComplete.Request.URL.Host = "localhost:11434"
+	assert.False(t, server.isStreamingResponse(ollamaComplete))
+	chunkedJSON.Request.URL.Host = "localhost:11434"
+	assert.False(t, server.isStreamingResponse(chunkedJSON))
+	assert.False(t, isEventStream(ndjsonResp))
+	assert.True(t, isEventStream(sseResp))
+}
+
+// TestNDJSONStreamIsNotBuffered 测试 Ollama 风格的 NDJSON 流逐行转发，不被缓冲、不被解压
+func TestNDJSONStreamIsNotBuffered(t *testing.T) {
+	lines := []string{
+		`{"model":"llama3","response":"Hel","done":false}`,
+		`{"model":"llama3","response":"lo","done":false}`,
+		`{"model":"llama3","response":"","done":true}`,
+	}
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		for i, line := range lines {
+			_, _ = io.WriteString(gz, line+"\n")
+			_ = gz.Flush()
+			w.(http.Flusher).Flush()
+			if i == 0 {
+				<-release
+			}
+		}
+		_ = gz.Close()
+	}))
+	defer backend.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	recorder := &sseEventRecorder{}
+	client := newViaTestClient(t, Config{EventHandler: recorder})
+	client.Transport.(*http.Transport).DisableCompression = true
+	req, err := http.NewRequest(http.MethodPost, backend.URL+"/api/generate", strings.NewReader(`{"model":"llama3","prompt":"Hello"}`))
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// 保持原始的Content-Type和压缩编码
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	// 上游还在等待时就能读到第一行，说明响应没有被缓冲
+	gz, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	reader := bufio.NewReader(gz)
+	first, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, lines[0]+"\n", first)
+	close(release)
+
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, lines[1]+"\n"+lines[2]+"\n", string(rest))
+}
+
+// TestNDJSONLinesAreEvents 测试未压缩的 NDJSON 流每行作为一个事件交给处理器，且不注入SSE心跳
+func TestNDJSONLinesAreEvents(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = io.WriteString(w, "{\"n\":1}\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.WriteString(w, "{\"n\":2}\n")
+	}))
+	defer backend.Close()
+
+	recorder := &sseEventRecorder{}
+	client := newViaTestClient(t, Config{EventHandler: recorder, SSEKeepAlive: 20 * time.Millisecond})
+	resp, err := client.Post(backend.URL+"/api/chat", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, "{\"n\":1}\n{\"n\":2}\n", string(body))
+	require.Eventually(t, func() bool {
+		events := recorder.recorded()
+		return len(events) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{`{"n":1}`, `{"n":2}`}, recorder.recorded()[:2])
 }
 
 // MyMockRoundTripper 是一个模拟的http.RoundTripper实现
@@ -360,3 +490,51 @@ func TestEarlyDetection(t *testing.T) {
 	// 管道中可能还没有完整的数据，但我们可以确保没有错误
 	assert.NotNil(t, body)
 }
+
+// redactingSSEHandler 在转发前替换事件中的令牌，并丢弃心跳事件
+type redactingSSEHandler struct {
+	NoOpEventHandler
+}
+
+func (h *redactingSSEHandler) OnSSE(event string, ctx *ResponseContext) string {
+	if strings.HasPrefix(event, "event: ping") {
+		return DropSSEEvent
+	}
+	if strings.Contains(event, "sk-secret") {
+		return strings.ReplaceAll(event, "sk-secret", "[REDACTED]")
+	}
+	return ""
+}
+
+func TestSSEHandlerCanModifyEvents(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "data: token sk-secret-1\n\n")
+		_, _ = io.WriteString(w, "event: ping\ndata: {}\n\n")
+		_, _ = io.WriteString(w, "data: plain\r\n\r\n")
+		_, _ = io.WriteString(w, "data: last sk-secret-2\n\n")
+	}))
+	defer backend.Close()
+
+	server, err := New(Config{
+		// 第二个处理器看到的是已经脱敏的事件，返回空字符串表示原样转发
+		EventHandler: NewMultiEventHandler(&redactingSSEHandler{}, &NoOpEventHandler{}),
+		LogWriter:    io.Discard,
+	})
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Get(backend.URL + "/stream")
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "data: token [REDACTED]-1\n\ndata: plain\r\n\r\ndata: last [REDACTED]-2\n\n", string(body))
+}
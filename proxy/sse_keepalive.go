@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseKeepAliveComment 是注入到SSE流中的心跳，SSE客户端会忽略以冒号开头的注释行
+const sseKeepAliveComment = ": keep-alive\n\n"
+
+// sseKeepAliveWriter 串行化SSE事件和心跳的写入，上游超过interval没有数据时向客户端写入心跳注释
+// 心跳只写给客户端，不经过 ResponseBodyTee，因此不会出现在记录的响应体中
+type sseKeepAliveWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+	last     time.Time
+	onError  func(error)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newSSEKeepAliveWriter 创建并启动心跳；onError 在心跳写入失败（通常是客户端已断开）时调用一次
+func newSSEKeepAliveWriter(w io.Writer, flusher http.Flusher, interval time.Duration, onError func(error)) *sseKeepAliveWriter {
+	k := &sseKeepAliveWriter{
+		w:        w,
+		flusher:  flusher,
+		interval: interval,
+		last:     time.Now(),
+		onError:  onError,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go k.run()
+	return k
+}
+
+// Write 写入一个完整的SSE事件并立即刷新，事件之间才会插入心跳
+func (k *sseKeepAliveWriter) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.writeLocked(p)
+}
+
+func (k *sseKeepAliveWriter) writeLocked(p []byte) (int, error) {
+	n, err := k.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if k.flusher != nil {
+		k.flusher.Flush()
+	}
+	k.last = time.Now()
+	return n, nil
+}
+
+func (k *sseKeepAliveWriter) run() {
+	defer close(k.done)
+	timer := time.NewTimer(k.interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-timer.C:
+		}
+
+		k.mu.Lock()
+		idle := time.Since(k.last)
+		var err error
+		if idle >= k.interval {
+			_, err = k.writeLocked([]byte(sseKeepAliveComment))
+			idle = 0
+		}
+		k.mu.Unlock()
+
+		if err != nil {
+			if k.onError != nil {
+				k.onError(err)
+			}
+			return
+		}
+		timer.Reset(k.interval - idle)
+	}
+}
+
+// Close 停止心跳并等待后台goroutine退出，之后不会再有心跳写入
+func (k *sseKeepAliveWriter) Close() {
+	close(k.stop)
+	<-k.done
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEventRecorder 记录交给EventHandler的SSE事件
+type sseEventRecorder struct {
+	NoOpEventHandler
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *sseEventRecorder) OnSSE(event string, ctx *ResponseContext) string {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+	return ""
+}
+
+func (r *sseEventRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestSSEKeepAliveDuringStall(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+
+		// 上游停顿，期间代理应向客户端发送心跳
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = io.WriteString(w, "data: second\n\n")
+	}))
+	defer backend.Close()
+
+	harPath := filepath.Join(t.TempDir(), "capture.har")
+	harLog := harlogger.NewLogger(harPath, "ProxyCraft", "0.1.0")
+	recorder := &sseEventRecorder{}
+	server, err := New(Config{
+		EventHandler: recorder,
+		HarLogger:    harLog,
+		SSEKeepAlive: 50 * time.Millisecond,
+		LogWriter:    io.Discard,
+	})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	resp, err := client.Get(backend.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	readLine := func() string {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		return line
+	}
+
+	assert.Equal(t, "data: first\n", readLine())
+	assert.Equal(t, "\n", readLine())
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, ": keep-alive\n", readLine())
+		assert.Equal(t, "\n", readLine())
+	}
+
+	close(release)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(rest), "data: second\n\n"), "unexpected tail %q", rest)
+	assert.Equal(t, "data: second\n\n", strings.ReplaceAll(string(rest), sseKeepAliveComment, ""))
+
+	// 心跳不交给EventHandler，也不记录到HAR的响应体中
+	assert.Eventually(t, func() bool {
+		events := recorder.recorded()
+		return len(events) > 0 && events[len(events)-1] == "__SSE_COMPLETED__"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"data: first", "data: second", "__SSE_COMPLETED__"}, recorder.recorded())
+
+	var har []byte
+	assert.Eventually(t, func() bool {
+		if err := harLog.Save(); err != nil {
+			return false
+		}
+		har, _ = os.ReadFile(harPath)
+		return strings.Contains(string(har), `data: first\n\ndata: second\n\n`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotContains(t, string(har), ": keep-alive")
+}
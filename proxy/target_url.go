@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// normalizeTargetURL 把请求重建为统一格式的绝对URL：scheme://host[:port]/path?query，用于转发、日志和记录
+// host是请求发往的主机（可带端口），reqURL可以是origin-form（只有路径）也可以是absolute-form，其中的主机被忽略
+// scheme和主机名转为小写，去掉与scheme对应的默认端口，空路径写作"/"，保留路径原有的转义，不含用户信息和片段
+func normalizeTargetURL(scheme, host string, reqURL *url.URL) string {
+	scheme = strings.ToLower(scheme)
+	target := &url.URL{
+		Scheme:   scheme,
+		Host:     normalizeURLHost(scheme, host),
+		Path:     reqURL.Path,
+		RawPath:  reqURL.RawPath,
+		RawQuery: reqURL.RawQuery,
+	}
+	if target.Path == "" {
+		target.Path, target.RawPath = "/", ""
+	}
+	return target.String()
+}
+
+// normalizeURLHost 返回URL中使用的主机部分：小写，IPv6地址加方括号，默认端口省略
+func normalizeURLHost(scheme, host string) string {
+	host = strings.ToLower(host)
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ""
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port == "" {
+		return urlHost(hostname)
+	}
+	return net.JoinHostPort(hostname, port)
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTargetURL(t *testing.T) {
+	for _, tc := range []struct {
+		scheme, host, target string
+		want                 string
+	}{
+		{"http", "Example.COM", "/a/b?x=1", "http://example.com/a/b?x=1"},
+		{"http", "example.com:80", "", "http://example.com/"},
+		{"HTTPS", "example.com:443", "/p", "https://example.com/p"},
+		{"https", "example.com:8443", "/p?q", "https://example.com:8443/p?q"},
+		{"http", "example.com:443", "/p", "http://example.com:443/p"},
+		{"https", "[::1]:443", "/v6", "https://[::1]/v6"},
+		{"https", "::1", "/v6", "https://[::1]/v6"},
+		{"https", "[::1]:8443", "/v6", "https://[::1]:8443/v6"},
+		// absolute-form中的主机、用户信息和片段被忽略，路径原有的转义保留
+		{"https", "api.example.com", "https://user:pw@other.example.com/a%2Fb/c%20d?k=v#frag", "https://api.example.com/a%2Fb/c%20d?k=v"},
+	} {
+		reqURL, err := url.Parse(tc.target)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, normalizeTargetURL(tc.scheme, tc.host, reqURL), "%s %s %s", tc.scheme, tc.host, tc.target)
+	}
+}
+
+func TestTargetURLOriginAndAbsoluteForm(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.RequestURI)
+		mu.Unlock()
+		_, _ = io.WriteString(w, "ok")
+	})
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(handler)
+	defer tlsBackend.Close()
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+	tlsHost := strings.TrimPrefix(tlsBackend.URL, "https://")
+
+	recorder := &recordingEventHandler{}
+	server, err := New(Config{EventHandler: recorder, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+	proxyAddr := listener.Addr().String()
+
+	// rawRequest 在conn上发送一个请求并读完响应
+	rawRequest := func(conn net.Conn, requestLine, host string) {
+		_, err := io.WriteString(conn, requestLine+"\r\nHost: "+host+"\r\nConnection: close\r\n\r\n")
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "ok", string(body), requestLine)
+	}
+	dial := func() net.Conn {
+		conn, err := net.DialTimeout("tcp", proxyAddr, 5*time.Second)
+		require.NoError(t, err)
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		return conn
+	}
+
+	// 普通HTTP：absolute-form（代理请求）和origin-form（只有Host头）
+	conn := dial()
+	rawRequest(conn, "GET "+backend.URL+"/abs/a%2Fb?x=1 HTTP/1.1", backendHost)
+	conn.Close()
+	conn = dial()
+	rawRequest(conn, "GET /origin?y=2 HTTP/1.1", backendHost)
+	conn.Close()
+
+	// MITM隧道中：origin-form和absolute-form
+	for _, requestLine := range []string{
+		"GET /tunnel/origin%2Fx?z=3 HTTP/1.1",
+		"GET https://" + tlsHost + "/tunnel/a%20b?q=4 HTTP/1.1",
+	} {
+		conn = dial()
+		_, err = io.WriteString(conn, "CONNECT "+tlsHost+" HTTP/1.1\r\nHost: "+tlsHost+"\r\n\r\n")
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: "127.0.0.1", NextProtos: []string{"http/1.1"}})
+		require.NoError(t, tlsConn.Handshake())
+		rawRequest(tlsConn, requestLine, tlsHost)
+		conn.Close()
+	}
+
+	// HTTP/2 MITM
+	proxyURL, _ := url.Parse("http://" + proxyAddr)
+	transport := &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport, Timeout: 10 * time.Second}).Get(tlsBackend.URL + "/h2%2Fy?w=5")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []string{
+		backend.URL + "/abs/a%2Fb?x=1",
+		backend.URL + "/origin?y=2",
+		tlsBackend.URL + "/tunnel/origin%2Fx?z=3",
+		tlsBackend.URL + "/tunnel/a%20b?q=4",
+		tlsBackend.URL + "/h2%2Fy?w=5",
+	}, recorder.requests)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/abs/a%2Fb?x=1", "/origin?y=2", "/tunnel/origin%2Fx?z=3", "/tunnel/a%20b?q=4", "/h2%2Fy?w=5"}, received)
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// 上游请求的默认超时
+const (
+	defaultRequestTimeout  = 20 * time.Second // 等待响应头的时间
+	defaultResponseTimeout = 30 * time.Second // 非流式响应从发出请求到读完响应体的总时间
+)
+
+// durationOrDefault 为0时返回默认值，为负数时返回0表示不限制
+func durationOrDefault(value, fallback time.Duration) time.Duration {
+	switch {
+	case value == 0:
+		return fallback
+	case value < 0:
+		return 0
+	}
+	return value
+}
+
+// requestTimeout 返回等待上游响应头的超时时间，0表示不限制
+func (s *Server) requestTimeout() time.Duration {
+	return durationOrDefault(s.RequestTimeout, defaultRequestTimeout)
+}
+
+// responseTimeout 返回非流式响应的总读取时间上限，0表示不限制
+func (s *Server) responseTimeout() time.Duration {
+	return durationOrDefault(s.ResponseTimeout, defaultResponseTimeout)
+}
+
+// responseTimeoutError 表示非流式响应没有在ResponseTimeout内读完
+type responseTimeoutError struct {
+	limit time.Duration
+}
+
+func (e *responseTimeoutError) Error() string {
+	return fmt.Sprintf("response not completed within %s", e.limit)
+}
+
+func (e *responseTimeoutError) Timeout() bool   { return true }
+func (e *responseTimeoutError) Temporary() bool { return true }
+
+// responseDeadline 限制一次上游请求的总时间，收到SSE响应头后可以解除，不影响流式响应体的读取
+type responseDeadline struct {
+	limit   time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
+}
+
+// startResponseDeadline 为请求设置总时间上限，返回绑定了可取消上下文的请求
+func startResponseDeadline(req *http.Request, limit time.Duration) (*http.Request, *responseDeadline) {
+	ctx, cancel := context.WithCancel(req.Context())
+	deadline := &responseDeadline{limit: limit, cancel: cancel}
+	deadline.timer = time.AfterFunc(limit, func() {
+		deadline.expired.Store(true)
+		cancel()
+	})
+	return req.WithContext(ctx), deadline
+}
+
+// exempt 解除时间上限，用于流式响应
+func (d *responseDeadline) exempt() {
+	d.timer.Stop()
+}
+
+// release 停止计时并释放上下文
+func (d *responseDeadline) release() {
+	d.timer.Stop()
+	d.cancel()
+}
+
+// wrapErr 在超时取消导致的错误上替换为带Timeout()的错误，便于WebHandler标记为超时
+func (d *responseDeadline) wrapErr(err error) error {
+	if err != nil && d.expired.Load() {
+		return &responseTimeoutError{limit: d.limit}
+	}
+	return err
+}
+
+// deadlineBody 在响应体关闭时释放responseDeadline
+type deadlineBody struct {
+	io.ReadCloser
+	deadline *responseDeadline
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = b.deadline.wrapErr(err)
+	}
+	return n, err
+}
+
+func (b *deadlineBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.deadline.release()
+	return err
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeoutErrorRecorder 记录OnError收到的错误
+type timeoutErrorRecorder struct {
+	mockEventHandler
+	errs chan error
+}
+
+func (h *timeoutErrorRecorder) OnError(err error, ctx *RequestContext) {
+	h.errs <- err
+}
+
+func TestRequestTimeoutSlowHeaders(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	handler := &timeoutErrorRecorder{errs: make(chan error, 1)}
+	server := &Server{
+		EventHandler:   handler,
+		RequestTimeout: 100 * time.Millisecond,
+	}
+
+	req, err := http.NewRequest("GET", backend.URL, nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	server.handleHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusBadGateway, recorder.Code)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	select {
+	case err := <-handler.errs:
+		assert.Contains(t, err.Error(), "timeout")
+	default:
+		t.Fatal("expected OnError to be called")
+	}
+}
+
+func TestResponseTimeoutExemptsSSE(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		flusher := w.(http.Flusher)
+		for i := 0; i < 5; i++ {
+			_, _ = w.Write([]byte("data: tick\n\n"))
+			flusher.Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer backend.Close()
+
+	server := &Server{
+		EventHandler:    &mockEventHandler{},
+		RequestTimeout:  100 * time.Millisecond,
+		ResponseTimeout: 150 * time.Millisecond,
+	}
+	proxyServer := httptest.NewServer(http.HandlerFunc(server.handleHTTP))
+	defer proxyServer.Close()
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	// 请求没有声明Accept: text/event-stream，只能在收到响应头后识别为SSE
+	resp, err := client.Get(backend.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{"tick", "tick", "tick", "tick", "tick", "[DONE]"}, events)
+}
+
+func TestResponseTimeoutBoundsSlowBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(time.Second)
+		_, _ = w.Write([]byte("too late"))
+	}))
+	defer backend.Close()
+
+	server := &Server{
+		EventHandler:    &mockEventHandler{},
+		ResponseTimeout: 100 * time.Millisecond,
+	}
+
+	req, err := http.NewRequest("GET", backend.URL, nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	server.handleHTTP(recorder, req)
+
+	assert.Less(t, time.Since(start), 900*time.Millisecond)
+	assert.NotContains(t, recorder.Body.String(), "too late")
+}
+
+func TestDurationOrDefault(t *testing.T) {
+	assert.Equal(t, 5*time.Second, durationOrDefault(0, 5*time.Second))
+	assert.Equal(t, time.Duration(0), durationOrDefault(-1, 5*time.Second))
+	assert.Equal(t, time.Second, durationOrDefault(time.Second, 5*time.Second))
+}
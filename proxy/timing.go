@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// InformationalResponse 是上游在最终响应之前发送的1xx响应，例如103 Early Hints
+type InformationalResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"headers"`
+	Time       time.Time   `json:"time"`
+}
+
+// requestTiming 记录上游请求的发送完成时间、响应首字节时间、使用的上游连接和收到的1xx响应
+// httptrace回调可能在传输层的其他goroutine中执行，因此需要加锁
+type requestTiming struct {
+	mu            sync.Mutex
+	sent          time.Time
+	firstByte     time.Time
+	connID        string
+	reused        bool
+	informational []InformationalResponse
+}
+
+// traceTiming 为发往上游的请求挂载httptrace，记录时间点到reqCtx
+func traceTiming(proxyReq *http.Request, reqCtx *RequestContext) *http.Request {
+	timing := &requestTiming{}
+	reqCtx.timing = timing
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			timing.mu.Lock()
+			timing.connID = upstreamConnID(info.Conn)
+			timing.reused = info.Reused
+			timing.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			timing.mu.Lock()
+			timing.sent = time.Now()
+			timing.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			timing.mu.Lock()
+			timing.firstByte = time.Now()
+			timing.mu.Unlock()
+		},
+		// 传输层会吞掉1xx响应，只能在这里记录；头部可能被传输层复用，需要复制
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			timing.mu.Lock()
+			timing.informational = append(timing.informational, InformationalResponse{
+				StatusCode: code,
+				Header:     http.Header(header).Clone(),
+				Time:       time.Now(),
+			})
+			timing.mu.Unlock()
+			return nil
+		},
+	}
+	return proxyReq.WithContext(httptrace.WithClientTrace(proxyReq.Context(), trace))
+}
+
+// upstreamTiming 返回请求发送完成和响应首字节的时间，未记录到的时间点为零值
+func (ctx *RequestContext) upstreamTiming() (time.Time, time.Time) {
+	if ctx == nil || ctx.timing == nil {
+		return time.Time{}, time.Time{}
+	}
+	ctx.timing.mu.Lock()
+	defer ctx.timing.mu.Unlock()
+	return ctx.timing.sent, ctx.timing.firstByte
+}
+
+// fillUpstreamTrace 用追踪结果填充SentTime、上游连接信息和1xx响应，没有追踪到发送时间时使用StartTime
+func (ctx *RequestContext) fillUpstreamTrace() {
+	if ctx == nil || !ctx.SentTime.IsZero() {
+		return
+	}
+	sent, _ := ctx.upstreamTiming()
+	if sent.IsZero() {
+		sent = ctx.StartTime
+	}
+	ctx.SentTime = sent
+
+	if ctx.timing != nil {
+		ctx.timing.mu.Lock()
+		ctx.UpstreamConnID = ctx.timing.connID
+		ctx.UpstreamConnReused = ctx.timing.reused
+		ctx.InformationalResponses = ctx.timing.informational
+		ctx.timing.mu.Unlock()
+	}
+}
+
+// upstreamConnID 用连接两端的地址标识一条上游连接，连接存活期间唯一且在复用时保持不变
+func upstreamConnID(conn net.Conn) string {
+	if conn == nil || conn.LocalAddr() == nil || conn.RemoteAddr() == nil {
+		return ""
+	}
+	return conn.LocalAddr().String() + "->" + conn.RemoteAddr().String()
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// 面向客户端的TLS默认设置
+const (
+	defaultTLSMinVersion = tls.VersionTLS12
+	defaultTLSMaxVersion = tls.VersionTLS13
+)
+
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion 解析 "1.0" ~ "1.3"（可带 "tls" 前缀）形式的TLS版本，空字符串返回0表示使用默认值
+func ParseTLSVersion(value string) (uint16, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "tls")
+	if normalized == "" {
+		return 0, nil
+	}
+	version, ok := tlsVersions[strings.TrimPrefix(normalized, "v")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", value)
+	}
+	return version, nil
+}
+
+// ParseTLSVersionRange 解析最小和最大TLS版本，并检查最小版本不大于最大版本（未设置的一侧按默认值比较）
+func ParseTLSVersionRange(minValue, maxValue string) (uint16, uint16, error) {
+	minVersion, err := ParseTLSVersion(minValue)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxVersion, err := ParseTLSVersion(maxValue)
+	if err != nil {
+		return 0, 0, err
+	}
+	if effectiveMin, effectiveMax := orDefault(minVersion, defaultTLSMinVersion), orDefault(maxVersion, defaultTLSMaxVersion); effectiveMin > effectiveMax {
+		return 0, 0, fmt.Errorf("TLS min version %s is greater than max version %s",
+			tls.VersionName(effectiveMin), tls.VersionName(effectiveMax))
+	}
+	return minVersion, maxVersion, nil
+}
+
+// ParseCipherSuites 解析逗号分隔的密码套件名称（如 TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA），空字符串返回nil表示使用默认值
+// 只影响 TLS 1.2 及以下版本，TLS 1.3 的密码套件不可配置
+func ParseCipherSuites(value string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	var suites []uint16
+	for _, part := range strings.Split(value, ",") {
+		name := strings.ToUpper(strings.TrimSpace(part))
+		if name == "" {
+			continue
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", part)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// applyClientTLSSettings 将面向客户端的TLS版本、密码套件和ALPN协议列表写入配置，非法的版本范围回退到默认值
+func (s *Server) applyClientTLSSettings(config *tls.Config) {
+	config.NextProtos = s.clientNextProtos()
+
+	minVersion := orDefault(s.TLSMinVersion, defaultTLSMinVersion)
+	maxVersion := orDefault(s.TLSMaxVersion, defaultTLSMaxVersion)
+	if minVersion > maxVersion {
+		s.warnf("Invalid TLS version range %s-%s, falling back to defaults",
+			tls.VersionName(minVersion), tls.VersionName(maxVersion))
+		minVersion, maxVersion = defaultTLSMinVersion, defaultTLSMaxVersion
+	}
+	config.MinVersion = minVersion
+	config.MaxVersion = maxVersion
+
+	config.CipherSuites = defaultCipherSuites
+	if len(s.TLSCipherSuites) > 0 {
+		config.CipherSuites = s.TLSCipherSuites
+	}
+}
+
+// clientNextProtos 返回面向客户端的ALPN协议列表，NoClientHTTP2为true时只提供http/1.1
+func (s *Server) clientNextProtos() []string {
+	if s.NoClientHTTP2 {
+		return []string{"http/1.1"}
+	}
+	return []string{"h2", "http/1.1"}
+}
+
+func orDefault(version, fallback uint16) uint16 {
+	if version == 0 {
+		return fallback
+	}
+	return version
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialMITM 通过代理的CONNECT隧道与MITM证书握手
+func dialMITM(t *testing.T, proxyAddr string, clientConfig *tls.Config) error {
+	_, err := handshakeMITM(t, proxyAddr, clientConfig)
+	return err
+}
+
+// handshakeMITM 与dialMITM相同，同时返回握手后的连接状态
+func handshakeMITM(t *testing.T, proxyAddr string, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	conn, err := net.DialTimeout("tcp", proxyAddr, 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	_, err = io.WriteString(conn, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tlsConn := tls.Client(conn, clientConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return tlsConn.ConnectionState(), nil
+}
+
+func TestMITMTLS13OnlyRejectsTLS12Client(t *testing.T) {
+	server, err := New(Config{
+		TLSMinVersion: tls.VersionTLS13,
+		TLSMaxVersion: tls.VersionTLS13,
+		LogWriter:     io.Discard,
+	})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	err = dialMITM(t, listener.Addr().String(), &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	assert.Error(t, err)
+
+	err = dialMITM(t, listener.Addr().String(), &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+	})
+	assert.NoError(t, err)
+}
+
+func TestParseTLSSettings(t *testing.T) {
+	minVersion, maxVersion, err := ParseTLSVersionRange("1.3", "TLS1.3")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), minVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), maxVersion)
+
+	minVersion, maxVersion, err = ParseTLSVersionRange("", "")
+	require.NoError(t, err)
+	assert.Zero(t, minVersion)
+	assert.Zero(t, maxVersion)
+
+	_, _, err = ParseTLSVersionRange("1.3", "1.2")
+	assert.Error(t, err)
+	_, _, err = ParseTLSVersionRange("", "1.1")
+	assert.Error(t, err, "max below the default min")
+	_, _, err = ParseTLSVersionRange("2.0", "")
+	assert.Error(t, err)
+
+	suites, err := ParseCipherSuites("tls_rsa_with_aes_128_cbc_sha, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+	_, err = ParseCipherSuites("TLS_NOT_A_CIPHER")
+	assert.Error(t, err)
+}
+
+func TestApplyClientTLSSettingsFallsBackOnInvalidRange(t *testing.T) {
+	server := &Server{TLSMinVersion: tls.VersionTLS13, TLSMaxVersion: tls.VersionTLS11}
+	config := &tls.Config{}
+	server.applyClientTLSSettings(config)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MaxVersion)
+	assert.Equal(t, defaultCipherSuites, config.CipherSuites)
+}
+
+func TestMITMNoClientHTTP2NegotiatesHTTP11(t *testing.T) {
+	clientConfig := &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	}
+	for _, noClientHTTP2 := range []bool{false, true} {
+		server, err := New(Config{NoClientHTTP2: noClientHTTP2, LogWriter: io.Discard})
+		require.NoError(t, err)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() { _ = server.Serve(listener) }()
+
+		state, err := handshakeMITM(t, listener.Addr().String(), clientConfig)
+		require.NoError(t, err)
+		if noClientHTTP2 {
+			assert.Equal(t, "http/1.1", state.NegotiatedProtocol)
+		} else {
+			assert.Equal(t, "h2", state.NegotiatedProtocol)
+		}
+		listener.Close()
+	}
+}
+
+func TestNoUpstreamHTTP2Transport(t *testing.T) {
+	server, err := New(Config{NoUpstreamHTTP2: true, LogWriter: io.Discard})
+	require.NoError(t, err)
+	transport := server.newTransport("example.com:443", true)
+	assert.NotNil(t, transport.TLSNextProto)
+	assert.Empty(t, transport.TLSNextProto)
+	assert.Equal(t, []string{"http/1.1"}, transport.TLSClientConfig.NextProtos)
+
+	server, err = New(Config{LogWriter: io.Discard})
+	require.NoError(t, err)
+	transport = server.newTransport("example.com:443", true)
+	assert.Contains(t, transport.TLSClientConfig.NextProtos, "h2")
+}
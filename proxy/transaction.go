@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Transaction 汇总一次已完成事务的请求、响应和耗时，由Config.OnComplete接收
+type Transaction struct {
+	// 请求及其请求体，请求体经过解压；开启NoBodies时为nil
+	Request     *http.Request
+	RequestBody []byte
+
+	// 响应及其响应体，出错时Response为nil；SSE和流式响应的ResponseBody是转发给客户端的全部事件，
+	// WebSocket升级响应和跳过保存响应体（ShouldCaptureBody、NoBodies）时为nil
+	Response     *http.Response
+	ResponseBody []byte
+
+	// Err 是事务失败的原因，成功时为nil；SSE流中途出错时Response和已转发的事件仍然保留
+	Err error
+
+	// StartTime 是收到请求的时间，Duration 是到响应体读完（SSE为流结束）或出错的耗时
+	StartTime time.Time
+	Duration  time.Duration
+
+	IsHTTPS     bool
+	IsSSE       bool
+	IsWebSocket bool
+
+	// 原始的事件上下文，用于读取Transaction未汇总的信息，例如时间线和抽样结果；出错时RespCtx可能为nil
+	ReqCtx  *RequestContext
+	RespCtx *ResponseContext
+}
+
+// completeHandler 把EventHandler的事件汇总为Transaction，每个事务只调用一次onComplete
+// 它总是排在用户的事件处理器之后，看到的是其他处理器修改后的请求、响应和SSE事件
+type completeHandler struct {
+	NoOpEventHandler
+	onComplete func(tx *Transaction)
+	id         uint64 // 区分同一请求上的多个completeHandler，见key
+}
+
+// completeHandlerSeq 为每个completeHandler分配id
+var completeHandlerSeq atomic.Uint64
+
+// newCompleteHandler 创建汇总适配器，每个实例在UserData中使用自己的键，可以同时注册多个
+func newCompleteHandler(onComplete func(tx *Transaction)) *completeHandler {
+	return &completeHandler{onComplete: onComplete, id: completeHandlerSeq.Add(1)}
+}
+
+// NewTransactionHandler 返回把事件汇总为Transaction并交给onComplete的事件处理器，每个事务只调用一次
+// 适合只关心完整事务的输出目标（例如JSONL），可以放进Config.EventHandlers；它看到的是排在它前面的处理器修改后的内容
+func NewTransactionHandler(onComplete func(tx *Transaction)) EventHandler {
+	return newCompleteHandler(onComplete)
+}
+
+// 保存在RequestContext.UserData中的汇总状态，实际的键带有处理器的id
+const (
+	completeRequestBodyKey = "proxy.complete.requestBody"
+	completeStreamKey      = "proxy.complete.stream"
+	completeDoneKey        = "proxy.complete.done"
+)
+
+// completeStream 是进行中的SSE事务，流结束或出错时汇总
+type completeStream struct {
+	respCtx *ResponseContext
+	events  strings.Builder
+}
+
+// withCompleteHook 在设置了OnComplete时把handler和汇总适配器组合起来
+func (s *Server) withCompleteHook(handler EventHandler) EventHandler {
+	if s.completeHandler == nil {
+		return handler
+	}
+	if handler == nil {
+		handler = &NoOpEventHandler{}
+	}
+	return NewMultiEventHandler(handler, s.completeHandler)
+}
+
+// OnRequest 在转发前缓存请求体，转发后请求体已被读完
+func (h *completeHandler) OnRequest(ctx *RequestContext) *http.Request {
+	if body, err := ctx.GetRequestBody(); err == nil && body != nil {
+		ctx.UserData[h.key(completeRequestBodyKey)] = body
+	}
+	return ctx.Request
+}
+
+// OnResponse 汇总普通响应；SSE响应等到流结束再汇总
+func (h *completeHandler) OnResponse(ctx *ResponseContext) *http.Response {
+	if ctx.ReqCtx == nil || h.done(ctx.ReqCtx) {
+		return ctx.Response
+	}
+	if ctx.IsSSE {
+		ctx.ReqCtx.UserData[h.key(completeStreamKey)] = &completeStream{respCtx: ctx}
+		return ctx.Response
+	}
+
+	tx := h.newTransaction(ctx.ReqCtx, ctx)
+	if !ctx.IsWebSocket && !ctx.SkipBody && !ResponseHasNoBody(ctx.Response) {
+		if body, err := ctx.GetResponseBody(); err == nil {
+			tx.ResponseBody = body
+		}
+	}
+	h.complete(tx)
+	return ctx.Response
+}
+
+// OnSSE 记录转发给客户端的事件，流结束时汇总
+func (h *completeHandler) OnSSE(event string, ctx *ResponseContext) string {
+	if ctx.ReqCtx == nil {
+		return ""
+	}
+	stream, ok := ctx.ReqCtx.UserData[h.key(completeStreamKey)].(*completeStream)
+	if !ok || h.done(ctx.ReqCtx) {
+		return ""
+	}
+	if event != "__SSE_COMPLETED__" {
+		stream.events.WriteString(event)
+		stream.events.WriteString("\n\n")
+		return ""
+	}
+	tx := h.newTransaction(ctx.ReqCtx, ctx)
+	if !ctx.SkipBody {
+		tx.ResponseBody = []byte(stream.events.String())
+	}
+	h.complete(tx)
+	return ""
+}
+
+// OnError 汇总失败的事务；同一事务之后的错误（例如SSE写入失败后的重复通知）被忽略
+func (h *completeHandler) OnError(err error, reqCtx *RequestContext) {
+	if reqCtx == nil || h.done(reqCtx) {
+		return
+	}
+	var tx *Transaction
+	if stream, ok := reqCtx.UserData[h.key(completeStreamKey)].(*completeStream); ok {
+		tx = h.newTransaction(reqCtx, stream.respCtx)
+		tx.ResponseBody = []byte(stream.events.String())
+	} else {
+		tx = h.newTransaction(reqCtx, nil)
+	}
+	tx.Err = err
+	h.complete(tx)
+}
+
+// key 返回本处理器在UserData中使用的键
+func (h *completeHandler) key(name string) string {
+	return name + "." + strconv.FormatUint(h.id, 10)
+}
+
+// newTransaction 用事件上下文填充Transaction的公共字段
+func (h *completeHandler) newTransaction(reqCtx *RequestContext, respCtx *ResponseContext) *Transaction {
+	tx := &Transaction{
+		Request:   reqCtx.Request,
+		StartTime: reqCtx.StartTime,
+		Duration:  time.Since(reqCtx.StartTime),
+		IsHTTPS:   reqCtx.IsHTTPS,
+		ReqCtx:    reqCtx,
+		RespCtx:   respCtx,
+	}
+	if body, ok := reqCtx.UserData[h.key(completeRequestBodyKey)].([]byte); ok {
+		tx.RequestBody = body
+	} else if reqCtx.Request != nil && expectsContinue(reqCtx.Request) {
+		// Expect: 100-continue的请求体在转发时才读取，OnRequest中拿不到，此时补充
+		if body, err := reqCtx.GetRequestBody(); err == nil && len(body) > 0 {
+			tx.RequestBody = body
+		}
+	}
+	if respCtx != nil {
+		tx.Response = respCtx.Response
+		tx.IsSSE = respCtx.IsSSE
+		tx.IsWebSocket = respCtx.IsWebSocket
+	}
+	return tx
+}
+
+// done 返回事务是否已经汇总过
+func (h *completeHandler) done(reqCtx *RequestContext) bool {
+	done, _ := reqCtx.UserData[h.key(completeDoneKey)].(bool)
+	return done
+}
+
+// complete 标记事务已汇总并调用onComplete
+func (h *completeHandler) complete(tx *Transaction) {
+	tx.ReqCtx.UserData[h.key(completeDoneKey)] = true
+	h.onComplete(tx)
+}
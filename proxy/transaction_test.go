@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderRecorder 记录EventHandler回调的顺序，并在响应上添加一个头
+type orderRecorder struct {
+	NoOpEventHandler
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *orderRecorder) add(call string) {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+}
+
+func (r *orderRecorder) OnResponse(ctx *ResponseContext) *http.Response {
+	r.add("response " + ctx.ReqCtx.Request.URL.Path)
+	ctx.Response.Header.Set("X-Handled", "yes")
+	return ctx.Response
+}
+
+func (r *orderRecorder) OnError(err error, reqCtx *RequestContext) {
+	r.add("error " + reqCtx.Request.URL.Path)
+}
+
+func (r *orderRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestOnCompleteOncePerTransaction(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, "data: one\n\ndata: two\n\n")
+		default:
+			body, _ := io.ReadAll(r.Body)
+			_, _ = io.WriteString(w, "echo "+string(body))
+		}
+	}))
+	defer backend.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := "http://" + closed.Addr().String() + "/down"
+	closed.Close()
+
+	recorder := &orderRecorder{}
+	var mu sync.Mutex
+	var transactions []*Transaction
+	client := newViaTestClient(t, Config{
+		EventHandler: recorder,
+		OnComplete: func(tx *Transaction) {
+			recorder.add("complete " + tx.Request.URL.Path)
+			mu.Lock()
+			transactions = append(transactions, tx)
+			mu.Unlock()
+		},
+	})
+
+	resp, err := client.Post(backend.URL+"/echo", "text/plain", strings.NewReader("ping"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "echo ping", string(body))
+
+	resp, err = client.Get(backend.URL + "/events")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	resp, err = client.Get(unreachable)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(transactions) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	// 等待可能的重复调用
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, transactions, 3)
+
+	echo := transactions[0]
+	assert.Equal(t, http.MethodPost, echo.Request.Method)
+	assert.Equal(t, "ping", string(echo.RequestBody))
+	require.NotNil(t, echo.Response)
+	assert.Equal(t, http.StatusOK, echo.Response.StatusCode)
+	assert.Equal(t, "yes", echo.Response.Header.Get("X-Handled"), "OnComplete sees the response modified by the EventHandler")
+	assert.Equal(t, "echo ping", string(echo.ResponseBody))
+	assert.NoError(t, echo.Err)
+	assert.False(t, echo.IsSSE)
+	assert.Positive(t, echo.Duration)
+
+	events := transactions[1]
+	assert.True(t, events.IsSSE)
+	assert.Equal(t, "data: one\n\ndata: two\n\n", string(events.ResponseBody))
+	assert.NoError(t, events.Err)
+
+	failed := transactions[2]
+	assert.Error(t, failed.Err)
+	assert.Nil(t, failed.Response)
+	assert.Equal(t, "/down", failed.Request.URL.Path)
+
+	assert.Equal(t, []string{
+		"response /echo", "complete /echo",
+		"response /events", "complete /events",
+		"error /down", "complete /down",
+	}, recorder.recorded())
+}
+
+func TestEventHandlersFanOut(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	first := &recordingEventHandler{}
+	second := &recordingEventHandler{}
+	var mu sync.Mutex
+	var completed []string
+	complete := func(name string) func(tx *Transaction) {
+		return func(tx *Transaction) {
+			mu.Lock()
+			completed = append(completed, name+" "+string(tx.ResponseBody))
+			mu.Unlock()
+		}
+	}
+	client := newViaTestClient(t, Config{
+		EventHandler:  first,
+		EventHandlers: []EventHandler{nil, second, NewTransactionHandler(complete("sink"))},
+		OnComplete:    complete("hook"),
+	})
+
+	resp, err := client.Get(backend.URL + "/fan-out")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	for _, handler := range []*recordingEventHandler{first, second} {
+		handler.mu.Lock()
+		assert.Equal(t, []string{backend.URL + "/fan-out"}, handler.requests)
+		assert.Equal(t, []int{http.StatusOK}, handler.responses)
+		handler.mu.Unlock()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"sink ok", "hook ok"}, completed)
+}
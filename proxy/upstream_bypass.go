@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// BypassList 描述不经过上游代理、直接连接的目标主机，语法与 NO_PROXY 环境变量一致
+//   - "*" 匹配所有主机
+//   - "example.com" 匹配 example.com 及其子域名
+//   - ".local" 或 "*.local" 只匹配子域名，例如 printer.local
+//   - "10.0.0.0/8" 按CIDR匹配IP地址，"127.0.0.1" 精确匹配IP
+type BypassList struct {
+	all      bool
+	domains  []string // 匹配自身及子域名
+	suffixes []string // 只匹配子域名，带前导点
+	ips      []net.IP
+	networks []*net.IPNet
+}
+
+// ParseBypassList 解析逗号分隔的绕过列表，多个来源（例如命令行参数和 NO_PROXY）可以一起传入
+// 空列表返回nil
+func ParseBypassList(values ...string) (*BypassList, error) {
+	list := &BypassList{}
+	empty := true
+	for _, raw := range values {
+		for _, part := range strings.Split(raw, ",") {
+			entry := strings.ToLower(strings.TrimSpace(part))
+			if entry == "" {
+				continue
+			}
+			empty = false
+
+			if entry == "*" {
+				list.all = true
+				continue
+			}
+			if strings.Contains(entry, "/") {
+				_, network, err := net.ParseCIDR(entry)
+				if err != nil {
+					return nil, fmt.Errorf("invalid bypass entry %q: %w", part, err)
+				}
+				list.networks = append(list.networks, network)
+				continue
+			}
+
+			// 忽略端口，例如 "localhost:8080"
+			if host, _, err := net.SplitHostPort(entry); err == nil {
+				entry = host
+			}
+			entry = strings.TrimSuffix(strings.Trim(entry, "[]"), ".")
+			if ip := net.ParseIP(entry); ip != nil {
+				list.ips = append(list.ips, ip)
+				continue
+			}
+
+			switch {
+			case strings.HasPrefix(entry, "*."):
+				list.suffixes = append(list.suffixes, entry[1:])
+			case strings.HasPrefix(entry, "."):
+				list.suffixes = append(list.suffixes, entry)
+			default:
+				list.domains = append(list.domains, entry)
+			}
+		}
+	}
+	if empty {
+		return nil, nil
+	}
+	return list, nil
+}
+
+// Match 判断目标主机（可带端口）是否应直接连接
+func (b *BypassList) Match(hostPort string) bool {
+	if b == nil {
+		return false
+	}
+	if b.all {
+		return true
+	}
+
+	host := hostPort
+	if h, _, err := net.SplitHostPort(hostPort); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, candidate := range b.ips {
+			if candidate.Equal(ip) {
+				return true
+			}
+		}
+		for _, network := range b.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, domain := range b.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	for _, suffix := range b.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bypassUpstream 判断目标是否在绕过列表中，命中时不使用上游代理
+func (s *Server) bypassUpstream(targetHost string) bool {
+	return s.UpstreamBypass.Match(targetHost)
+}
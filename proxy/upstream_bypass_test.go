@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBypassList(t *testing.T) {
+	list, err := ParseBypassList("localhost, .local,10.0.0.0/8", "example.com:8080,*.corp.example,::1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		host  string
+		match bool
+	}{
+		{"localhost:8080", true},
+		{"LOCALHOST", true},
+		{"printer.local:443", true},
+		{"local", false},
+		{"10.1.2.3:80", true},
+		{"11.1.2.3:80", false},
+		{"example.com", true},
+		{"api.example.com:443", true},
+		{"notexample.com", false},
+		{"git.corp.example", true},
+		{"corp.example", false},
+		{"[::1]:8080", true},
+		{"github.com:443", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, list.Match(tt.host), tt.host)
+	}
+
+	list, err = ParseBypassList("", " , ")
+	require.NoError(t, err)
+	assert.Nil(t, list)
+	assert.False(t, list.Match("localhost"))
+
+	list, err = ParseBypassList("*")
+	require.NoError(t, err)
+	assert.True(t, list.Match("anything.example:443"))
+
+	_, err = ParseBypassList("10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestUpstreamBypassConnectsDirectly(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("direct"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	upstream := newConnectProxy(t, "", "", &hits)
+	upstreamURL, _ := url.Parse(upstream.URL)
+	targetURL, _ := url.Parse(target.URL)
+
+	// 未命中绕过列表时经过上游代理
+	server := &Server{UpstreamProxy: upstreamURL}
+	client := &http.Client{Transport: server.newTransport(targetURL.Host, true)}
+	resp, err := client.Get(target.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// 命中绕过列表时直接连接目标
+	bypass, err := ParseBypassList("127.0.0.0/8")
+	require.NoError(t, err)
+	server = &Server{UpstreamProxy: upstreamURL, UpstreamBypass: bypass}
+	client = &http.Client{Transport: server.newTransport(targetURL.Host, true)}
+	resp, err = client.Get(target.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "direct", string(body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "bypassed host must not go through the upstream proxy")
+}
@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// upstreamProxySchemes 是上层代理支持的协议，代理链的每一跳都按各自的协议建立隧道
+var upstreamProxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// ParseUpstreamProxyChain 解析逗号分隔的上层代理列表，按顺序组成代理链
+// 例如 "http://a:8080,socks5://user:pass@b:1080" 表示 本地 -> a -> b -> 目标
+func ParseUpstreamProxyChain(raw string) ([]*url.URL, error) {
+	var chain []*url.URL
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		proxyURL, err := url.Parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream proxy %q: %w", part, err)
+		}
+		if proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid upstream proxy %q: missing host", part)
+		}
+		if !upstreamProxySchemes[proxyURL.Scheme] {
+			return nil, fmt.Errorf("invalid upstream proxy %q: unsupported scheme %q (want http, https, socks5 or socks5h)", part, proxyURL.Scheme)
+		}
+		chain = append(chain, proxyURL)
+	}
+	return chain, nil
+}
+
+// CheckUpstreamProxy 尝试与上层代理建立TCP连接，用于启动前检查代理地址是否可达
+func CheckUpstreamProxy(proxyURL *url.URL, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", proxyHostPort(proxyURL), timeout)
+	if err != nil {
+		return fmt.Errorf("dial upstream proxy %s: %w", proxyURL.Host, err)
+	}
+	return conn.Close()
+}
+
+// upstreamProxies 返回生效的上层代理链，未配置代理链时回退到单个UpstreamProxy
+func (s *Server) upstreamProxies() []*url.URL {
+	if len(s.UpstreamProxyChain) > 0 {
+		return s.UpstreamProxyChain
+	}
+	if s.UpstreamProxy != nil {
+		return []*url.URL{s.UpstreamProxy}
+	}
+	return nil
+}
+
+// chainDialer 通过多级代理逐跳建立嵌套的隧道，HTTP(S)代理使用CONNECT，SOCKS5代理使用SOCKS5握手
+// hops 为最后一跳之前的所有代理，最后一跳由 http.Transport 自身负责
+type chainDialer struct {
+	hops []*url.URL
+	base contextDialer
+}
+
+// DialContext 连接第一跳代理，并依次通过各跳的隧道到达下一跳，最终到达addr
+func (d *chainDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(d.hops) == 0 {
+		return d.base.DialContext(ctx, network, addr)
+	}
+
+	first := d.hops[0]
+	conn, err := d.base.DialContext(ctx, network, proxyHostPort(first))
+	if err != nil {
+		return nil, &upstreamProxyError{fmt.Errorf("dial upstream proxy %s: %w", first.Host, err)}
+	}
+
+	for i, hop := range d.hops {
+		next := addr
+		if i+1 < len(d.hops) {
+			next = proxyHostPort(d.hops[i+1])
+		}
+
+		conn, err = tunnelThroughProxy(ctx, conn, hop, next)
+		if err != nil {
+			return nil, &upstreamProxyError{err}
+		}
+	}
+
+	return conn, nil
+}
+
+// tunnelThroughProxy 在已连接到proxyURL的conn上按代理的协议建立到target的隧道，失败时关闭conn
+func tunnelThroughProxy(ctx context.Context, conn net.Conn, proxyURL *url.URL, target string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "http":
+	case "https":
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("tls handshake with upstream proxy %s: %w", proxyURL.Host, err)
+		}
+		conn = tlsConn
+	case "socks5", "socks5h":
+		return socks5Connect(ctx, conn, proxyURL, target)
+	default:
+		_ = conn.Close()
+		return nil, fmt.Errorf("unsupported upstream proxy scheme %q", proxyURL.Scheme)
+	}
+	return connectThroughProxy(ctx, conn, proxyURL, target)
+}
+
+// socks5Connect 在已连接到SOCKS5代理的conn上完成握手（带用户名密码时进行认证），请求代理连接target
+func socks5Connect(ctx context.Context, conn net.Conn, proxyURL *url.URL, target string) (net.Conn, error) {
+	var auth *xproxy.Auth
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		auth = &xproxy.Auth{User: proxyURL.User.Username(), Password: password}
+	}
+	dialer, err := xproxy.SOCKS5("tcp", proxyHostPort(proxyURL), auth, existingConnDialer{conn})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	tunnel, err := dialer.(xproxy.ContextDialer).DialContext(ctx, "tcp", target)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("upstream proxy %s refused SOCKS5 connect to %s: %w", proxyURL.Host, target, err)
+	}
+	return tunnel, nil
+}
+
+// existingConnDialer 让SOCKS5握手在已经建立的连接（代理链的上一段隧道）上进行
+type existingConnDialer struct {
+	conn net.Conn
+}
+
+func (d existingConnDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.conn, nil
+}
+
+func (d existingConnDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.conn, nil
+}
+
+// checkProxyConnectResponse 在http.Transport收到最后一跳代理的CONNECT响应时调用，
+// 把非200响应转为可被ClassifyError识别的错误（Transport自身只返回状态文本）
+func checkProxyConnectResponse(_ context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+	if connectRes.StatusCode == http.StatusOK {
+		return nil
+	}
+	return &upstreamProxyError{fmt.Errorf("upstream proxy %s refused CONNECT to %s: %s", proxyURL.Host, connectReq.Host, connectRes.Status)}
+}
+
+// connectThroughProxy 在已连接到proxyURL的conn上发起CONNECT请求，建立到target的隧道
+func connectThroughProxy(ctx context.Context, conn net.Conn, proxyURL *url.URL, target string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		connectReq.Header.Set("Proxy-Authorization", auth)
+	}
+
+	if err := connectReq.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("write CONNECT to upstream proxy %s: %w", proxyURL.Host, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, connectReq)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("read CONNECT response from upstream proxy %s: %w", proxyURL.Host, err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("upstream proxy %s refused CONNECT to %s: %s", proxyURL.Host, target, resp.Status)
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// proxyAuthorization 根据代理URL中的用户信息生成Basic认证头
+func proxyAuthorization(proxyURL *url.URL) string {
+	if proxyURL == nil || proxyURL.User == nil {
+		return ""
+	}
+	password, _ := proxyURL.User.Password()
+	credentials := proxyURL.User.Username() + ":" + password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// proxyHostPort 返回代理的host:port，缺省端口按协议补全
+func proxyHostPort(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+	port := "80"
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// bufferedConn 保留CONNECT响应后已被缓冲的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NetConn 返回被包装的连接
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -5,19 +5,60 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
-	"crypto/tls"
+	"compress/zlib"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 	"unicode/utf8"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
 )
 
 // logToHAR 是一个辅助方法，用于统一处理 HAR 日志记录
 // 这个方法集中了所有 HAR 日志记录逻辑，避免代码重复
-func (s *Server) logToHAR(req *http.Request, resp *http.Response, startTime time.Time, timeTaken time.Duration, isSSE bool) {
+func (s *Server) logToHAR(req *http.Request, resp *http.Response, startTime time.Time, timeTaken time.Duration, isSSE bool, opts ...harlogger.EntryOption) {
+	s.logHAREntry(req, resp, startTime, timeTaken, isSSE, true, opts...)
+}
+
+// harEntryOptions 返回写入HAR条目的代理上下文：comment中的注解（例如 "_mode: mitm; llm: openai"）和上游连接
+func (s *Server) harEntryOptions(reqCtx *RequestContext) []harlogger.EntryOption {
+	if reqCtx == nil || reqCtx.Request == nil {
+		return nil
+	}
+
+	mode := "http"
+	switch {
+	case s.ReverseTarget != nil:
+		mode = "reverse"
+	case reqCtx.IsHTTPS:
+		mode = "mitm"
+	}
+
+	path := ""
+	if reqCtx.Request.URL != nil {
+		path = reqCtx.Request.URL.Path
+	}
+	mismatchedSNI := ""
+	if reqCtx.SNIMismatch {
+		mismatchedSNI = reqCtx.ClientSNI
+	}
+	return []harlogger.EntryOption{
+		harlogger.WithAnnotations(
+			harlogger.Annotation{Key: "_mode", Value: mode},
+			harlogger.Annotation{Key: "llm", Value: DetectLLMProvider(reqCtx.Request.Host, path)},
+			harlogger.Annotation{Key: "sni_mismatch", Value: mismatchedSNI},
+			harlogger.Annotation{Key: "chaos", Value: reqCtx.ChaosFault},
+			harlogger.Annotation{Key: "rate_limit", Value: reqCtx.RateLimit},
+			harlogger.Annotation{Key: "cache", Value: reqCtx.Cache},
+		),
+		harlogger.WithConnection(reqCtx.UpstreamConnID, reqCtx.UpstreamConnReused),
+	}
+}
+
+// logHAREntry 记录HAR条目，captureBody为false时只记录响应元数据
+func (s *Server) logHAREntry(req *http.Request, resp *http.Response, startTime time.Time, timeTaken time.Duration, isSSE bool, captureBody bool, opts ...harlogger.EntryOption) {
 	if s.HarLogger == nil || !s.HarLogger.IsEnabled() {
 		return
 	}
@@ -34,14 +75,24 @@ func (s *Server) logToHAR(req *http.Request, resp *http.Response, startTime time
 		}
 	}
 
+	// 压缩的请求体解压后记录，转发的仍是原始字节；NoBodies模式下不读取请求体
+	if !s.NoBodies {
+		req = decodedRequestForLog(req)
+	}
+
+	if !captureBody && resp != nil {
+		s.HarLogger.AddEntryWithoutBody(req, resp, startTime, timeTaken, serverIP, connectionID, opts...)
+		return
+	}
+
 	// 对于 SSE 响应，创建一个没有响应体的副本，以避免读取整个响应体
 	if isSSE && resp != nil {
 		respCopy := *resp
 		respCopy.Body = nil
-		s.HarLogger.AddEntry(req, &respCopy, startTime, timeTaken, serverIP, connectionID)
+		s.HarLogger.AddEntry(req, &respCopy, startTime, timeTaken, serverIP, connectionID, opts...)
 	} else {
 		// 对于非 SSE 响应或错误情况，正常记录
-		s.HarLogger.AddEntry(req, resp, startTime, timeTaken, serverIP, connectionID)
+		s.HarLogger.AddEntry(req, resp, startTime, timeTaken, serverIP, connectionID, opts...)
 	}
 }
 
@@ -54,29 +105,72 @@ func (s *Server) createRequestContext(req *http.Request, targetURL string, start
 			req.URL.Scheme = "http"
 		}
 	}
-	return &RequestContext{
+	reqCtx := &RequestContext{
 		Request:   req,
 		StartTime: startTime,
 		IsSSE:     isSSERequest(req),
 		IsHTTPS:   isHTTPS,
 		TargetURL: targetURL,
 		UserData:  make(map[string]interface{}),
+
+		SampledOut: !s.Sampler.Sampled(req.Method, targetURL),
+		SkipBody:   s.NoBodies,
+	}
+	if info, ok := connectInfoFrom(req); ok {
+		reqCtx.ConnectHost = info.host
+		reqCtx.ClientSNI = info.sni
+		reqCtx.SNIMismatch = sniMismatch(info.host, info.sni)
 	}
+	return reqCtx
 }
 
 // createResponseContext 创建一个响应上下文
 func (s *Server) createResponseContext(reqCtx *RequestContext, resp *http.Response, timeTaken time.Duration) *ResponseContext {
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	var firstByteTime time.Time
+	if reqCtx != nil {
+		reqCtx.fillUpstreamTrace()
+		_, firstByteTime = reqCtx.upstreamTiming()
+		if firstByteTime.IsZero() {
+			firstByteTime = reqCtx.StartTime.Add(timeTaken)
+		}
+	}
 	return &ResponseContext{
-		ReqCtx:    reqCtx,
-		Response:  resp,
-		TimeTaken: timeTaken,
-		IsSSE:     isServerSentEvent(resp),
-		UserData:  make(map[string]interface{}),
+		ReqCtx:        reqCtx,
+		Response:      resp,
+		TimeTaken:     timeTaken,
+		FirstByteTime: firstByteTime,
+		IsSSE:         s.isStreamingResponse(resp),
+		IsWebSocket:   isWebSocketUpgrade(resp),
+		SkipBody:      !s.shouldCaptureBody(reqCtx, resp),
+		SkipRecord:    !s.shouldRecord(reqCtx, statusCode),
+		UserData:      make(map[string]interface{}),
 	}
 }
 
+// shouldCaptureBody 调用ShouldCaptureBody回调，未设置时保存所有响应体；开启NoBodies时不保存任何响应体
+func (s *Server) shouldCaptureBody(reqCtx *RequestContext, resp *http.Response) bool {
+	if s.NoBodies {
+		return false
+	}
+	if s.ShouldCaptureBody == nil || resp == nil {
+		return true
+	}
+	return s.ShouldCaptureBody(reqCtx, resp)
+}
+
+// ResponseHasNoBody 判断响应按HTTP语义不能携带响应体：HEAD请求的响应以及1xx、204、304响应
+// 这类响应的Content-Length描述的是对应GET响应的大小，不能当作响应体大小；与HAR记录使用同一个判断
+func ResponseHasNoBody(resp *http.Response) bool {
+	return harlogger.ResponseHasNoBody(resp)
+}
+
 // notifyRequest 通知请求事件
 func (s *Server) notifyRequest(ctx *RequestContext) *http.Request {
+	s.recordHostRequest(ctx.Request)
 	if s.EventHandler != nil {
 		return s.EventHandler.OnRequest(ctx)
 	}
@@ -93,6 +187,9 @@ func (s *Server) notifyResponse(ctx *ResponseContext) *http.Response {
 
 // notifyError 通知错误事件
 func (s *Server) notifyError(err error, reqCtx *RequestContext) {
+	if reqCtx != nil {
+		s.recordHostError(reqCtx.Request)
+	}
 	if s.EventHandler != nil {
 		s.EventHandler.OnError(err, reqCtx)
 	}
@@ -100,15 +197,28 @@ func (s *Server) notifyError(err error, reqCtx *RequestContext) {
 
 // notifyTunnelEstablished 通知隧道建立事件
 func (s *Server) notifyTunnelEstablished(host string, isIntercepted bool) {
+	if c, ok := s.hostStats.Load(statsHost(host)); ok && s.logEnabled(LogLevelDebug) {
+		counter := c.(*hostCounter)
+		s.debugf("[Stats] %s: %d requests, %d errors, %d bytes sent, %d bytes received",
+			host, counter.requests.Load(), counter.errors.Load(), counter.bytesSent.Load(), counter.bytesReceived.Load())
+	}
 	if s.EventHandler != nil {
 		s.EventHandler.OnTunnelEstablished(host, isIntercepted)
 	}
 }
 
-// notifySSE 通知SSE事件
-func (s *Server) notifySSE(event string, ctx *ResponseContext) {
+// notifySSE 通知SSE事件，返回处理器修改后的事件，语义同EventHandler.OnSSE
+func (s *Server) notifySSE(event string, ctx *ResponseContext) string {
 	if s.EventHandler != nil {
-		s.EventHandler.OnSSE(event, ctx)
+		return s.EventHandler.OnSSE(event, ctx)
+	}
+	return ""
+}
+
+// notifyWebSocketMessage 把转发的WebSocket帧通知给实现了WebSocketEventHandler的处理器
+func (s *Server) notifyWebSocketMessage(msg *WebSocketMessage, ctx *ResponseContext) {
+	if handler, ok := s.EventHandler.(WebSocketEventHandler); ok {
+		handler.OnWebSocketMessage(msg, ctx)
 	}
 }
 
@@ -152,16 +262,18 @@ func (t *earlySSEDetector) RoundTrip(req *http.Request) (*http.Response, error)
 		verbose: t.verbose,
 		callback: func(resp *http.Response) (*http.Response, error) {
 			// 检查是否是SSE响应
-			if isServerSentEvent(resp) {
+			if t.server.isStreamingResponse(resp) {
 				if t.verbose {
-					log.Printf("[SSE] Detected SSE response early based on Content-Type header")
+					t.server.debugf("[SSE] Detected SSE response early based on Content-Type header")
 				}
 
 				// 我们不再在这里开始处理SSE事件，只设置适当的头部
 				// 将完整的事件处理交给handleSSE函数
 
 				// 设置正确的头部以确保正确的流传输
-				resp.Header.Set("Content-Type", "text/event-stream")
+				if isEventStream(resp) {
+					resp.Header.Set("Content-Type", "text/event-stream")
+				}
 				resp.Header.Set("Cache-Control", "no-cache")
 				resp.Header.Set("Connection", "keep-alive")
 				resp.Header.Set("Transfer-Encoding", "chunked")
@@ -291,7 +403,7 @@ func (s *Server) streamResponse(body io.ReadCloser, writer interface{}, contentT
 
 	// 对于非文本内容，使用流式传输
 	if verbose {
-		log.Printf("[Proxy] Streaming non-text content: %s", contentType)
+		s.debugf("[Proxy] Streaming non-text content: %s", contentType)
 	}
 
 	// 创建缓冲读取器
@@ -307,7 +419,7 @@ func (s *Server) streamResponse(body io.ReadCloser, writer interface{}, contentT
 		if !ok {
 			// 如果不支持Flusher，则回退到一次性复制
 			if verbose {
-				log.Printf("[Proxy] Streaming not supported, falling back to io.Copy")
+				s.debugf("[Proxy] Streaming not supported, falling back to io.Copy")
 			}
 			return io.Copy(w, body)
 		}
@@ -334,8 +446,8 @@ func (s *Server) streamResponse(body io.ReadCloser, writer interface{}, contentT
 			}
 		}
 
-	case *tls.Conn:
-		// 对于TLS连接，直接写入
+	case io.Writer:
+		// 对于TLS连接（可能包装了chunked编码），直接写入
 		for {
 			n, err := bufReader.Read(buf)
 			if n > 0 {
@@ -360,7 +472,7 @@ func (s *Server) streamResponse(body io.ReadCloser, writer interface{}, contentT
 	}
 
 	if verbose {
-		log.Printf("[Proxy] Streamed %d bytes of non-text content", totalWritten)
+		s.debugf("[Proxy] Streamed %d bytes of non-text content", totalWritten)
 	}
 
 	return totalWritten, nil
@@ -405,17 +517,32 @@ func (s *Server) dumpRequestBody(req *http.Request) {
 		}
 	}
 
+	if s.NoBodies {
+		fmt.Println("\n(body not captured: -no-bodies)")
+		return
+	}
+
 	// 读取并恢复请求体
 	bodyBytes, err := readAndRestoreBody(&req.Body, req.ContentLength)
 	if err != nil {
-		log.Printf("Error reading request body for dump: %v\n", err)
+		s.warnf("Error reading request body for dump: %v\n", err)
 		return
 	}
+	if decoded, ok := decodeRequestBody(req.Header, bodyBytes); ok {
+		fmt.Printf("\n(已自动解压 %s 编码的请求体)\n", req.Header.Get("Content-Encoding"))
+		bodyBytes = decoded
+	}
 
-	// 检查是否为二进制内容
+	// 非UTF-8编码的文本转换为UTF-8后输出，转发的请求体不受影响
 	contentType := req.Header.Get("Content-Type")
+	if decoded, name, ok := DecodeText(bodyBytes, contentType); ok {
+		fmt.Printf("\n(已从 %s 编码转换为 UTF-8 显示)\n", name)
+		bodyBytes = decoded
+	}
+
+	// 检查是否为二进制内容
 	if isBinaryContent(bodyBytes, contentType) {
-		log.Printf("Binary request body detected (%d bytes), not displaying\n", len(bodyBytes))
+		s.debugf("Binary request body detected (%d bytes), not displaying\n", len(bodyBytes))
 		fmt.Println("\n(binary data)")
 		return
 	}
@@ -450,6 +577,11 @@ func (s *Server) dumpResponseBody(resp *http.Response) {
 	}
 	fmt.Println()
 
+	if s.NoBodies {
+		fmt.Println("(body not captured: -no-bodies)")
+		return
+	}
+
 	// 获取内容类型和编码
 	contentType := resp.Header.Get("Content-Type")
 	contentEncoding := resp.Header.Get("Content-Encoding")
@@ -458,10 +590,13 @@ func (s *Server) dumpResponseBody(resp *http.Response) {
 	respCopy := *resp
 	respCopy.Body = resp.Body
 
-	// 如果响应体被压缩，先进行解压
-	if contentEncoding != "" {
+	// 关闭解压时按原样输出压缩内容
+	if contentEncoding != "" && s.NoDecompress {
+		fmt.Printf("(未解压的 %s 编码内容，已关闭解压)\n", contentEncoding)
+	} else if contentEncoding != "" {
+		// 如果响应体被压缩，先进行解压
 		if err := decompressBody(&respCopy); err != nil {
-			log.Printf("解压响应体失败: %v", err)
+			s.warnf("解压响应体失败: %v", err)
 			// 添加提示信息
 			fmt.Printf("(压缩内容解析失败，显示原始数据，编码: %s)\n", contentEncoding)
 			// 即使解压失败，仍然继续尝试读取原始内容
@@ -474,7 +609,7 @@ func (s *Server) dumpResponseBody(resp *http.Response) {
 	// 读取响应体（可能是已解压的内容）
 	bodyBytes, err := readAndRestoreBody(&respCopy.Body, respCopy.ContentLength)
 	if err != nil {
-		log.Printf("读取响应体失败: %v", err)
+		s.warnf("读取响应体失败: %v", err)
 		return
 	}
 
@@ -487,6 +622,12 @@ func (s *Server) dumpResponseBody(resp *http.Response) {
 		return
 	}
 
+	// 非UTF-8编码的文本转换为UTF-8后输出，转发的响应体不受影响
+	if decoded, name, ok := DecodeText(bodyBytes, contentType); ok {
+		fmt.Printf("(已从 %s 编码转换为 UTF-8 显示)\n", name)
+		bodyBytes = decoded
+	}
+
 	// 检查是否为二进制内容
 	if isBinaryContent(bodyBytes, contentType) {
 		fmt.Printf("(binary data, %d bytes)\n", len(bodyBytes))
@@ -559,6 +700,11 @@ func decompressBody(resp *http.Response) error {
 	return nil
 }
 
+// DecompressData 按Content-Encoding解压数据，支持逗号分隔的多层编码，例如 "gzip, br"
+func DecompressData(data []byte, encoding string) ([]byte, error) {
+	return decompressData(data, encoding)
+}
+
 // decompressData 根据指定的编码方式解压数据
 func decompressData(data []byte, encoding string) ([]byte, error) {
 	if len(data) == 0 {
@@ -598,21 +744,9 @@ func decompressData(data []byte, encoding string) ([]byte, error) {
 			result = decompressed
 
 		case "deflate":
-			// deflate没有明确的魔术数字，但我们可以尝试解压
-			reader := flate.NewReader(bytes.NewReader(result))
-			defer reader.Close()
-
-			decompressed, err := io.ReadAll(reader)
+			decompressed, err := inflateData(result)
 			if err != nil {
-				// 尝试旧式deflate（不带zlib头部）
-				// 某些服务器可能发送的是原始deflate数据而非zlib格式的deflate数据
-				r := flate.NewReader(bytes.NewReader(result))
-				defer r.Close()
-
-				decompressed, err = io.ReadAll(r)
-				if err != nil {
-					return nil, fmt.Errorf("读取deflate解压数据失败: %w", err)
-				}
+				return nil, err
 			}
 
 			result = decompressed
@@ -640,15 +774,50 @@ func decompressData(data []byte, encoding string) ([]byte, error) {
 	return result, nil
 }
 
+// inflateData 解压deflate编码的数据
+// 按规范deflate应带zlib头部（RFC 1950），但部分服务器发送的是原始deflate数据（RFC 1951），因此先按zlib解压，失败后再按原始deflate解压
+func inflateData(data []byte) ([]byte, error) {
+	zr, zlibErr := zlib.NewReader(bytes.NewReader(data))
+	if zlibErr == nil {
+		decompressed, err := io.ReadAll(zr)
+		zr.Close()
+		if err == nil {
+			return decompressed, nil
+		}
+		zlibErr = err
+	}
+
+	fr := flate.NewReader(bytes.NewReader(data))
+	defer fr.Close()
+	decompressed, err := io.ReadAll(fr)
+	if err != nil {
+		return nil, fmt.Errorf("读取deflate解压数据失败: zlib: %v, raw deflate: %w", zlibErr, err)
+	}
+	return decompressed, nil
+}
+
 // handleCompressedResponse 已被processCompressedResponse替代
 
 // processCompressedResponse 处理压缩响应体，包括解压缩和处理Content-Encoding/Content-Length头
 // 这是一个更简单的辅助函数，专注于处理压缩，而不涉及上下文创建和事件通知
 func (s *Server) processCompressedResponse(resp *http.Response, reqCtx *RequestContext, verbose bool) {
 	// 先检查是否是SSE响应，如果是则跳过解压步骤
-	if resp != nil && isServerSentEvent(resp) {
+	if resp != nil && s.isStreamingResponse(resp) {
 		if verbose {
-			log.Printf("[HTTP] 检测到SSE响应，跳过解压缩处理以保持流式传输")
+			s.debugf("[HTTP] 检测到SSE响应，跳过解压缩处理以保持流式传输")
+		}
+		return
+	}
+
+	// 没有记录方需要读取响应体时，解压只会把整个响应体读入内存，直接原样转发
+	if s.passthroughBodies() || s.NoBodies {
+		return
+	}
+
+	// 关闭解压时保持响应体和Content-Encoding原样，由客户端和HAR读取方自行解码
+	if s.NoDecompress {
+		if verbose && resp != nil && resp.Header.Get("Content-Encoding") != "" {
+			s.debugf("[HTTP] 已关闭解压，保持 %s 编码的响应体原样转发", resp.Header.Get("Content-Encoding"))
 		}
 		return
 	}
@@ -660,19 +829,19 @@ func (s *Server) processCompressedResponse(resp *http.Response, reqCtx *RequestC
 
 	if isCompressed {
 		if verbose {
-			log.Printf("[HTTP] 检测到压缩的文本内容: %s, 编码: %s",
+			s.debugf("[HTTP] 检测到压缩的文本内容: %s, 编码: %s",
 				resp.Header.Get("Content-Type"),
 				resp.Header.Get("Content-Encoding"))
 		}
 
 		err := decompressBody(resp)
 		if err != nil {
-			log.Printf("[HTTP] 解压响应体失败: %v", err)
+			s.warnf("[HTTP] 解压响应体失败: %v", err)
 			if reqCtx != nil {
 				s.notifyError(err, reqCtx)
 			}
 		} else if verbose {
-			log.Printf("[HTTP] 成功解压响应体")
+			s.debugf("[HTTP] 成功解压响应体")
 		}
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,6 +15,8 @@ import (
 
 	"github.com/LubyRuffy/ProxyCraft/harlogger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 // TestRealUtilsFunctions contains the tests for utility functions in utils.go
@@ -462,7 +465,7 @@ func TestDecompressBody(t *testing.T) {
 	})
 
 	t.Run("Deflate压缩内容", func(t *testing.T) {
-		// 创建Deflate压缩的测试数据
+		// 创建不带zlib头部的原始Deflate压缩数据
 		var compressedData bytes.Buffer
 		deflateWriter, err := flate.NewWriter(&compressedData, flate.DefaultCompression)
 		assert.NoError(t, err)
@@ -496,6 +499,35 @@ func TestDecompressBody(t *testing.T) {
 		assert.Equal(t, fmt.Sprint(len("<html><body>这是一个测试HTML</body></html>")), resp.Header.Get("Content-Length"))
 	})
 
+	t.Run("带zlib头部的Deflate压缩内容", func(t *testing.T) {
+		var compressedData bytes.Buffer
+		zlibWriter := zlib.NewWriter(&compressedData)
+		_, err := zlibWriter.Write([]byte(`{"message":"zlib格式的deflate"}`))
+		assert.NoError(t, err)
+		assert.NoError(t, zlibWriter.Close())
+
+		resp := &http.Response{
+			StatusCode: 200,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(bytes.NewReader(compressedData.Bytes())),
+		}
+		resp.Header.Set("Content-Encoding", "deflate")
+
+		err = decompressBody(resp)
+		assert.NoError(t, err)
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"message":"zlib格式的deflate"}`, string(bodyBytes))
+		assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	})
+
+	t.Run("无效的Deflate内容", func(t *testing.T) {
+		_, err := decompressData([]byte{0xff, 0xff, 0xff, 0xff}, "deflate")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "读取deflate解压数据失败")
+	})
+
 	t.Run("无效的Gzip内容", func(t *testing.T) {
 		// 创建无效的Gzip数据
 		invalidData := []byte("这不是有效的gzip压缩数据")
@@ -592,3 +624,35 @@ func TestIsTextContentType(t *testing.T) {
 		})
 	}
 }
+
+// TestDumpResponseBodyDecodesGBK 测试GBK编码的HTML在输出时转换为UTF-8，转发的响应体保持原始字节
+func TestDumpResponseBodyDecodesGBK(t *testing.T) {
+	server := &Server{DumpTraffic: true}
+	html := "<html><head><title>你好，世界</title></head><body>中文页面</body></html>"
+	gbkBody, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(html))
+	require.NoError(t, err)
+
+	resp := &http.Response{
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=GBK"}},
+		Body:       io.NopCloser(bytes.NewReader(gbkBody)),
+	}
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	server.dumpResponseBody(resp)
+	w.Close()
+	os.Stdout = oldStdout
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+	assert.Contains(t, output, html)
+	assert.Contains(t, output, "gbk")
+
+	forwarded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, gbkBody, forwarded)
+}
@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// maxExtractBodySize 是提取变量时读取的响应体上限，更大的响应体不做提取
+const maxExtractBodySize = 10 * 1024 * 1024
+
+// variableNamePattern 是合法的变量名，variablePattern 匹配注入模板中的 {name} 占位符
+var (
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	variablePattern     = regexp.MustCompile(`\{[A-Za-z_][A-Za-z0-9_.-]*\}`)
+)
+
+// VariableStore 保存从响应中提取的命名变量，供后续请求注入，可并发使用
+type VariableStore struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewVariableStore 创建空的变量存储
+func NewVariableStore() *VariableStore {
+	return &VariableStore{values: make(map[string]string)}
+}
+
+// Get 返回变量的当前值，尚未提取到时返回false
+func (v *VariableStore) Get(name string) (string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// Set 设置变量的值，已有的值被覆盖
+func (v *VariableStore) Set(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[name] = value
+}
+
+// ExtractRule 从匹配的JSON响应体中按JSONPath提取一个值，保存为命名变量
+type ExtractRule struct {
+	Name       string
+	Hosts      *BypassList // 生效的主机范围，语法与 -no-upstream-for 相同，为nil时对所有主机生效
+	PathPrefix string      // 请求路径前缀，为空时匹配所有路径
+	JSONPath   string
+	steps      []interface{} // 解析后的路径，string为对象键，int为数组下标（负数从末尾计）
+}
+
+// ParseExtractRule 解析 "name=host:path:jsonpath"，例如 "token=api.example.com:/login:$.data.access_token"
+// host 和 path 可以为空，分别表示所有主机和所有路径；jsonpath 支持 $.a.b、$['a']、$.items[0] 和 $.items[-1]
+func ParseExtractRule(spec string) (*ExtractRule, error) {
+	name, rest, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !validVariableName(name) {
+		return nil, fmt.Errorf("invalid extract rule %q: want name=host:path:jsonpath", spec)
+	}
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid extract rule %q: want name=host:path:jsonpath", spec)
+	}
+
+	rule := &ExtractRule{Name: name, PathPrefix: strings.TrimSpace(parts[1]), JSONPath: strings.TrimSpace(parts[2])}
+	steps, err := parseJSONPath(rule.JSONPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extract rule %q: %w", spec, err)
+	}
+	rule.steps = steps
+	if host := strings.TrimSpace(parts[0]); host != "" {
+		hosts, err := ParseBypassList(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extract rule host %q: %w", host, err)
+		}
+		rule.Hosts = hosts
+	}
+	return rule, nil
+}
+
+// Matches 判断规则是否对目标主机（可带端口）和请求路径生效
+func (r *ExtractRule) Matches(hostPort, path string) bool {
+	if r.Hosts != nil && !r.Hosts.Match(hostPort) {
+		return false
+	}
+	return strings.HasPrefix(path, r.PathPrefix)
+}
+
+// Extract 在已解析的JSON文档中查找路径对应的值：字符串原样返回，数字和布尔值返回其文本，对象和数组返回紧凑的JSON
+// 路径不存在或值为null时返回false
+func (r *ExtractRule) Extract(doc interface{}) (string, bool) {
+	value := doc
+	for _, step := range r.steps {
+		switch key := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if value, ok = object[key]; !ok {
+				return "", false
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok {
+				return "", false
+			}
+			if key < 0 {
+				key += len(array)
+			}
+			if key < 0 || key >= len(array) {
+				return "", false
+			}
+			value = array[key]
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(encoded), true
+	}
+}
+
+// parseJSONPath 把 $.a['b'].c[0] 形式的路径解析为键和下标的序列
+func parseJSONPath(expr string) ([]interface{}, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+	var steps []interface{}
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty key", expr)
+			}
+			steps = append(steps, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has an unclosed [", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, inner[1:len(inner)-1])
+			} else if index, err := strconv.Atoi(inner); err == nil {
+				steps = append(steps, index)
+			} else {
+				return nil, fmt.Errorf("JSONPath %q: unsupported selector [%s]", expr, inner)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath %q: unexpected %q", expr, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// InjectRule 把变量写入后续匹配请求的请求头
+type InjectRule struct {
+	Header   string      // 规范化后的请求头名称
+	Template string      // 请求头的值，{name} 替换为变量的当前值
+	Hosts    *BypassList // 生效的主机范围，为nil时对所有主机生效
+}
+
+// ParseInjectRule 解析 "name->Header[@hosts][: template]"，例如：
+//   - "token->X-Auth-Token" 把变量token的值设置为X-Auth-Token请求头
+//   - "token->Authorization@api.example.com: Bearer {token}" 只对api.example.com按模板设置Authorization
+//   - "token->Authorization@api.example.com:8443: Bearer {token}" 主机带端口时，模板前的冒号后面必须有空格
+//
+// 模板中可以引用任意变量，有变量尚未提取到时不设置该请求头
+func ParseInjectRule(spec string) (*InjectRule, error) {
+	name, target, ok := strings.Cut(spec, "->")
+	name = strings.TrimSpace(name)
+	if !ok || !validVariableName(name) {
+		return nil, fmt.Errorf("invalid inject rule %q: want name->Header[@hosts][: template]", spec)
+	}
+	// 请求头名称不含@和冒号；@之后的主机列表可能带端口，只以": "与模板分隔
+	var header, hosts, template string
+	var hasHosts, hasTemplate bool
+	switch i := strings.IndexAny(target, "@:"); {
+	case i < 0:
+		header = target
+	case target[i] == ':':
+		header, template, hasTemplate = target[:i], target[i+1:], true
+	default:
+		header, hasHosts = target[:i], true
+		hosts, template, hasTemplate = strings.Cut(target[i+1:], ": ")
+	}
+	header = strings.TrimSpace(header)
+	if !httpguts.ValidHeaderFieldName(header) {
+		return nil, fmt.Errorf("invalid inject rule %q: bad header name %q", spec, header)
+	}
+
+	rule := &InjectRule{Header: http.CanonicalHeaderKey(header), Template: "{" + name + "}"}
+	if hasTemplate {
+		rule.Template = strings.TrimSpace(template)
+		if !httpguts.ValidHeaderFieldValue(rule.Template) {
+			return nil, fmt.Errorf("invalid inject rule %q: bad header value", spec)
+		}
+	}
+	if hasHosts {
+		list, err := ParseBypassList(hosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inject rule hosts %q: %w", hosts, err)
+		}
+		rule.Hosts = list
+	}
+	return rule, nil
+}
+
+// Render 用变量的当前值展开模板，有引用的变量尚未提取到时返回false
+func (r *InjectRule) Render(vars *VariableStore) (string, bool) {
+	complete := true
+	value := variablePattern.ReplaceAllStringFunc(r.Template, func(placeholder string) string {
+		v, ok := vars.Get(placeholder[1 : len(placeholder)-1])
+		if !ok {
+			complete = false
+		}
+		return v
+	})
+	return value, complete
+}
+
+func validVariableName(name string) bool {
+	return variableNamePattern.MatchString(name)
+}
+
+// extractVariables 对匹配的JSON响应体执行ExtractRules，在响应体替换之后、事件通知之前调用
+// SSE、没有响应体、仍保持压缩或超过maxExtractBodySize的响应不做提取，路径不存在时保留变量原来的值
+func (s *Server) extractVariables(resp *http.Response, reqCtx *RequestContext) {
+	if len(s.ExtractRules) == 0 || s.Variables == nil || resp == nil || resp.Body == nil || reqCtx == nil || reqCtx.Request == nil {
+		return
+	}
+	if ResponseHasNoBody(resp) || s.isStreamingResponse(resp) || !isTextContentType(resp.Header.Get("Content-Type")) {
+		return
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return
+	}
+
+	host := replacementTargetHost(reqCtx)
+	path := reqCtx.Request.URL.Path
+	var rules []*ExtractRule
+	for _, rule := range s.ExtractRules {
+		if rule.Matches(host, path) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	original := resp.Body
+	body, err := io.ReadAll(io.LimitReader(original, maxExtractBodySize+1))
+	if err != nil || len(body) > maxExtractBodySize {
+		// 读取失败或过大时把已读部分和剩余内容拼回去，照常转发
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), original), original}
+		if err != nil {
+			s.warnf("[Extract] Failed to read response body: %v", err)
+		}
+		return
+	}
+	original.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		s.debugf("[Extract] Response body of %s%s is not JSON: %v", host, path, err)
+		return
+	}
+	for _, rule := range rules {
+		value, ok := rule.Extract(doc)
+		if !ok {
+			s.debugf("[Extract] %s: %s not found in the response of %s%s", rule.Name, rule.JSONPath, host, path)
+			continue
+		}
+		s.Variables.Set(rule.Name, value)
+		s.infof("[Extract] Captured variable %s from %s%s (%d bytes)", rule.Name, host, path, len(value))
+	}
+}
+
+// injectVariables 按InjectRules把已提取的变量写入转发的请求头，只影响发往上游的请求
+// 变量来自响应内容，展开后不是合法请求头值（例如包含换行）时不设置，避免请求头注入
+func (s *Server) injectVariables(proxyReq *http.Request) {
+	if len(s.InjectRules) == 0 || s.Variables == nil {
+		return
+	}
+	for _, rule := range s.InjectRules {
+		if rule.Hosts != nil && !rule.Hosts.Match(proxyReq.URL.Host) {
+			continue
+		}
+		value, ok := rule.Render(s.Variables)
+		if !ok {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			s.warnf("[Inject] Not setting %s for %s: the captured value is not a valid header value", rule.Header, proxyReq.URL.Host)
+			continue
+		}
+		proxyReq.Header.Set(rule.Header, value)
+	}
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractTokenAndInjectIntoNextRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login":
+			_, _ = io.WriteString(w, `{"data":{"access_token":"secret-123","expires":3600}}`)
+		case "/profile":
+			// 缺少令牌字段，不应覆盖已提取的值
+			_, _ = io.WriteString(w, `{"data":{}}`)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]string{"authorization": r.Header.Get("Authorization")})
+		}
+	}))
+	defer backend.Close()
+
+	extract, err := ParseExtractRule("token=127.0.0.1:/:$.data.access_token")
+	require.NoError(t, err)
+	inject, err := ParseInjectRule("token->Authorization@127.0.0.1: Bearer {token}")
+	require.NoError(t, err)
+	client := newViaTestClient(t, Config{ExtractRules: []*ExtractRule{extract}, InjectRules: []*InjectRule{inject}})
+
+	authorization := func() string {
+		resp, err := client.Get(backend.URL + "/api/items")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body["authorization"]
+	}
+
+	assert.Empty(t, authorization(), "nothing is injected before the variable is captured")
+
+	resp, err := client.Get(backend.URL + "/login")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), "secret-123", "the response is forwarded unchanged")
+
+	assert.Equal(t, "Bearer secret-123", authorization())
+
+	resp, err = client.Get(backend.URL + "/profile")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer secret-123", authorization())
+}
+
+func TestExtractRuleValues(t *testing.T) {
+	var doc interface{}
+	decoder := json.NewDecoder(strings.NewReader(`{"a-b":{"items":[{"id":7},{"id":8.5}],"ok":true,"none":null}}`))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&doc))
+
+	cases := map[string]string{
+		"$['a-b'].items[0].id":  "7",
+		"$['a-b'].items[-1].id": "8.5",
+		`$["a-b"].ok`:           "true",
+		"$['a-b'].items[0]":     `{"id":7}`,
+	}
+	for path, want := range cases {
+		rule, err := ParseExtractRule("v=::" + path)
+		require.NoError(t, err, path)
+		got, ok := rule.Extract(doc)
+		assert.True(t, ok, path)
+		assert.Equal(t, want, got, path)
+	}
+
+	for _, path := range []string{"$.missing", "$['a-b'].items[5]", "$['a-b'].none", "$['a-b'].ok.deeper"} {
+		rule, err := ParseExtractRule("v=::" + path)
+		require.NoError(t, err, path)
+		_, ok := rule.Extract(doc)
+		assert.False(t, ok, path)
+	}
+
+	for _, spec := range []string{"token", "=::$.a", "token=api.example.com:/login", "token=::data.a", "token=::$.a[x]", "token=::$..a"} {
+		_, err := ParseExtractRule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestInjectVariablesSkipsInvalidValues(t *testing.T) {
+	rule, err := ParseInjectRule("token->X-Auth-Token")
+	require.NoError(t, err)
+	server, err := New(Config{InjectRules: []*InjectRule{rule}, LogWriter: io.Discard})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	server.Variables.Set("token", "abc\r\nX-Injected: 1")
+	server.injectVariables(req)
+	assert.Empty(t, req.Header.Get("X-Auth-Token"))
+
+	server.Variables.Set("token", "abc")
+	server.injectVariables(req)
+	assert.Equal(t, "abc", req.Header.Get("X-Auth-Token"))
+}
+
+func TestInjectRuleRender(t *testing.T) {
+	vars := NewVariableStore()
+	rule, err := ParseInjectRule("token->x-auth-token")
+	require.NoError(t, err)
+	assert.Equal(t, "X-Auth-Token", rule.Header)
+	assert.Nil(t, rule.Hosts)
+	_, ok := rule.Render(vars)
+	assert.False(t, ok)
+
+	vars.Set("token", "abc")
+	value, ok := rule.Render(vars)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", value)
+
+	rule, err = ParseInjectRule("token->Cookie: session={token}; user={user}")
+	require.NoError(t, err)
+	_, ok = rule.Render(vars)
+	assert.False(t, ok, "user has not been captured yet")
+	vars.Set("user", "alice")
+	value, _ = rule.Render(vars)
+	assert.Equal(t, "session=abc; user=alice", value)
+
+	// 主机带端口时以": "分隔模板
+	rule, err = ParseInjectRule("token->Authorization@api.example.com:8443: Bearer {token}")
+	require.NoError(t, err)
+	assert.Equal(t, "Authorization", rule.Header)
+	assert.Equal(t, "Bearer {token}", rule.Template)
+	require.NotNil(t, rule.Hosts)
+	assert.True(t, rule.Hosts.Match("api.example.com:8443"))
+	rule, err = ParseInjectRule("token->X-Auth-Token@127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "{token}", rule.Template)
+	assert.True(t, rule.Hosts.Match("127.0.0.1:8080"))
+
+	for _, spec := range []string{"token", "->Authorization", "token->", "token->Bad Header"} {
+		_, err := ParseInjectRule(spec)
+		assert.Error(t, err, spec)
+	}
+}
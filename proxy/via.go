@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// viaPseudonym 是代理在Via头中使用的名称（RFC 9110 7.6.3 的 received-by）
+const viaPseudonym = "ProxyCraft"
+
+// viaValue 是添加到转发的请求和响应上的Via条目
+const viaValue = "1.1 " + viaPseudonym
+
+// hasOwnVia 判断Via头中是否已经有本代理的条目，出现时说明请求又绕回了代理
+func hasOwnVia(header http.Header) bool {
+	for _, value := range header.Values("Via") {
+		for _, entry := range strings.Split(value, ",") {
+			// 每个条目为 "protocol received-by [comment]"
+			fields := strings.Fields(entry)
+			if len(fields) >= 2 && strings.EqualFold(fields[1], viaPseudonym) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isProxyLoop 在启用AddVia时判断请求是否已经经过本代理
+func (s *Server) isProxyLoop(r *http.Request) bool {
+	return s.AddVia && hasOwnVia(r.Header)
+}
+
+// applyOutboundHeaders 按配置在转发的请求上追加Via并改写User-Agent
+func (s *Server) applyOutboundHeaders(proxyReq *http.Request) {
+	if s.AddVia {
+		proxyReq.Header.Add("Via", viaValue)
+	}
+	if s.OverrideUserAgent != "" {
+		proxyReq.Header.Set("User-Agent", s.OverrideUserAgent)
+	}
+}
+
+// applyResponseVia 按配置在返回给客户端的响应上追加Via
+func (s *Server) applyResponseVia(resp *http.Response) {
+	if s.AddVia {
+		resp.Header.Add("Via", viaValue)
+	}
+}
+
+// writeLoopDetected 在MITM连接上回复508，随后由调用方关闭连接
+func writeLoopDetected(conn net.Conn, proto string) {
+	if conn == nil {
+		return
+	}
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	_, _ = conn.Write([]byte(fmt.Sprintf("%s 508 Loop Detected\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", proto)))
+}
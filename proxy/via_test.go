@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newViaTestClient(t *testing.T, config Config) *http.Client {
+	t.Helper()
+	config.LogWriter = io.Discard
+	server, err := New(config)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = server.Serve(listener) }()
+
+	proxyURL, _ := url.Parse("http://" + listener.Addr().String())
+	transport := &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+func TestAddViaAndOverrideUserAgent(t *testing.T) {
+	var gotVia, gotUA string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotVia = r.Header.Get("Via")
+		gotUA = r.Header.Get("User-Agent")
+		_, _ = io.WriteString(w, "ok")
+	})
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(handler)
+	defer tlsBackend.Close()
+
+	client := newViaTestClient(t, Config{AddVia: true, OverrideUserAgent: "ProxyCraft-Test/1.0"})
+
+	for _, target := range []string{backend.URL, tlsBackend.URL} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", "original-agent")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, target)
+		assert.Equal(t, "1.1 ProxyCraft", gotVia, target)
+		assert.Equal(t, "ProxyCraft-Test/1.0", gotUA, target)
+		assert.Equal(t, "1.1 ProxyCraft", resp.Header.Get("Via"), target)
+	}
+}
+
+func TestAddViaRejectsLoopedRequest(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(handler)
+	defer tlsBackend.Close()
+
+	client := newViaTestClient(t, Config{AddVia: true})
+
+	for _, target := range []string{backend.URL, tlsBackend.URL} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		req.Header.Set("Via", "1.0 corp-gateway, 1.1 ProxyCraft")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusLoopDetected, resp.StatusCode, target)
+	}
+	assert.False(t, called)
+}
+
+func TestHasOwnVia(t *testing.T) {
+	header := http.Header{}
+	assert.False(t, hasOwnVia(header))
+	header.Set("Via", "1.1 squid (squid/5.7), 1.0 other")
+	assert.False(t, hasOwnVia(header))
+	header.Add("Via", "HTTP/1.1 proxycraft")
+	assert.True(t, hasOwnVia(header))
+}
@@ -0,0 +1,341 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"golang.org/x/net/http/httpguts"
+)
+
+// maxWebSocketCapture 是每个WebSocket帧保存的负载上限，超出部分照常转发但不记录
+const maxWebSocketCapture = 64 * 1024
+
+// 一个WebSocket连接写入HAR的帧数和负载字节数上限，长连接超出部分照常转发但不再写入HAR
+const (
+	maxHARWebSocketMessages = 10000
+	maxHARWebSocketBytes    = 16 << 20
+)
+
+// WebSocket帧的操作码
+const (
+	WebSocketContinuation byte = 0x0
+	WebSocketText         byte = 0x1
+	WebSocketBinary       byte = 0x2
+	WebSocketClose        byte = 0x8
+	WebSocketPing         byte = 0x9
+	WebSocketPong         byte = 0xa
+)
+
+// WebSocketMessage 是升级后的WebSocket连接上转发的一个帧
+type WebSocketMessage struct {
+	// Time 是读完该帧的时间
+	Time time.Time
+
+	// FromClient 表示帧由客户端发往服务器，否则由服务器发往客户端
+	FromClient bool
+
+	// Opcode 是帧的操作码，分片消息的后续帧为WebSocketContinuation
+	Opcode byte
+
+	// Final 表示这是消息的最后一帧
+	Final bool
+
+	// Length 是帧负载的实际长度
+	Length int64
+
+	// Data 是去掉掩码后的负载，最多保存maxWebSocketCapture字节；开启Server.NoBodies时为空
+	Data []byte
+
+	// Compressed 表示帧属于permessage-deflate压缩的消息，此时Data是解压后的内容：
+	// 整条消息解压后的内容保存在最后一帧中，之前的分片帧Data为空；无法解压时Data也为空
+	Compressed bool
+}
+
+// isUpgradeRequest 判断请求是否要求切换协议（Connection: Upgrade）
+func isUpgradeRequest(req *http.Request) bool {
+	return req != nil && req.Header.Get("Upgrade") != "" &&
+		httpguts.HeaderValuesContainsToken(req.Header["Connection"], "upgrade")
+}
+
+// isWebSocketUpgrade 判断响应是否同意把连接升级为WebSocket
+func isWebSocketUpgrade(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusSwitchingProtocols &&
+		strings.EqualFold(resp.Header.Get("Upgrade"), "websocket")
+}
+
+// takeUpgradedConn 取出101响应中已升级的上游连接，并把响应体换成http.NoBody
+// 之后的响应处理、事件通知和HAR记录都把它当作没有响应体的握手响应
+func takeUpgradedConn(resp *http.Response) io.ReadWriteCloser {
+	if resp == nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil
+	}
+	upgraded, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil
+	}
+	resp.Body = http.NoBody
+	return upgraded
+}
+
+// relayUpgradedConn 把101响应写回客户端，然后在客户端连接和升级后的上游连接之间双向转发，直到任一方关闭
+// WebSocket连接按帧解析，每个帧通知EventHandler并在连接结束后连同握手写入HAR；其他协议原样转发
+// clientReader 是客户端连接上可能已缓冲了数据的读取端，两个连接在返回时都已关闭
+func (s *Server) relayUpgradedConn(clientConn net.Conn, clientReader io.Reader, upstream io.ReadWriteCloser, respCtx *ResponseContext) error {
+	defer clientConn.Close()
+	defer upstream.Close()
+
+	resp := respCtx.Response
+	header := resp.Header.Clone()
+	header.Add("X-Protocol", resp.Proto)
+	writer := bufio.NewWriter(clientConn)
+	_, _ = fmt.Fprintf(writer, "HTTP/1.1 %s\r\n", resp.Status)
+	if err := header.Write(writer); err != nil {
+		return fmt.Errorf("write upgrade response: %w", err)
+	}
+	_, _ = writer.WriteString("\r\n")
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("write upgrade response: %w", err)
+	}
+
+	target := ""
+	if resp.Request != nil && resp.Request.URL != nil {
+		target = resp.Request.URL.String()
+	}
+	webSocket := respCtx.IsWebSocket
+	s.infof("[Upgrade] Switched %s to %s", target, resp.Header.Get("Upgrade"))
+	if protocol := resp.Header.Get("Sec-WebSocket-Protocol"); webSocket && protocol != "" {
+		s.debugf("[Upgrade] WebSocket subprotocol for %s: %s", target, protocol)
+	}
+
+	// 协商了permessage-deflate时按方向解压消息用于记录，转发的帧保持原样
+	var clientInflater, serverInflater *webSocketInflater
+	if webSocket && !s.NoBodies {
+		clientInflater, serverInflater = newWebSocketInflaters(resp.Header)
+	}
+
+	// 只有写HAR时才需要保留帧，在连接关闭后一起写入
+	recordHAR := webSocket && !respCtx.SkipRecord && s.HarLogger != nil && s.HarLogger.IsEnabled()
+	var (
+		mu     sync.Mutex
+		frames int
+		kept   = webSocketFrameBuffer{maxMessages: maxHARWebSocketMessages, maxBytes: maxHARWebSocketBytes}
+	)
+	onFrame := func(msg WebSocketMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		frames++
+		if recordHAR {
+			kept.add(msg)
+		}
+		s.logWebSocketMessage(msg, target)
+		s.notifyWebSocketMessage(&msg, respCtx)
+	}
+
+	copyStream := func(dst io.Writer, src io.Reader, fromClient bool) error {
+		if !webSocket {
+			_, err := io.Copy(dst, src)
+			return err
+		}
+		inflater := serverInflater
+		if fromClient {
+			inflater = clientInflater
+		}
+		return s.copyWebSocketFrames(dst, src, fromClient, inflater, onFrame)
+	}
+
+	// 任一方向结束后关闭两个连接，使另一方向的读取返回
+	errs := make(chan error, 2)
+	go func() {
+		errs <- copyStream(upstream, clientReader, true)
+		clientConn.Close()
+		upstream.Close()
+	}()
+	go func() {
+		errs <- copyStream(clientConn, upstream, false)
+		clientConn.Close()
+		upstream.Close()
+	}()
+	firstErr := <-errs
+	<-errs
+
+	s.debugf("[Upgrade] Connection to %s closed after %d WebSocket frames", target, frames)
+	if recordHAR {
+		if kept.dropped > 0 {
+			s.warnf("[Upgrade] HAR entry for %s omits %d WebSocket frames beyond the recording limit", target, kept.dropped)
+		}
+		reqCtx := respCtx.ReqCtx
+		opts := append(s.harEntryOptions(reqCtx), harlogger.WithWebSocketMessages(harWebSocketMessages(kept.messages)))
+		s.logHAREntry(reqCtx.Request, resp, reqCtx.StartTime, respCtx.TimeTaken, false, false, opts...)
+	}
+
+	if firstErr != nil && !errors.Is(firstErr, io.EOF) && !errors.Is(firstErr, net.ErrClosed) {
+		return firstErr
+	}
+	return nil
+}
+
+// webSocketFrameBuffer 保存要写入HAR的帧，帧数或负载字节数达到上限后丢弃之后的帧并计数
+type webSocketFrameBuffer struct {
+	maxMessages int
+	maxBytes    int
+	messages    []WebSocketMessage
+	bytes       int
+	dropped     int
+}
+
+func (b *webSocketFrameBuffer) add(msg WebSocketMessage) {
+	if len(b.messages) >= b.maxMessages || b.bytes+len(msg.Data) > b.maxBytes {
+		b.dropped++
+		return
+	}
+	b.messages = append(b.messages, msg)
+	b.bytes += len(msg.Data)
+}
+
+// copyWebSocketFrames 从src逐帧读取WebSocket帧并原样写入dst，每读完一帧调用onFrame
+// 负载按块转发，大帧不会整个缓存在内存中；inflater不为nil时压缩消息的负载会完整缓存以便解压后记录
+func (s *Server) copyWebSocketFrames(dst io.Writer, src io.Reader, fromClient bool, inflater *webSocketInflater, onFrame func(WebSocketMessage)) error {
+	reader := bufio.NewReader(src)
+	header := make([]byte, 14)
+	for {
+		if _, err := io.ReadFull(reader, header[:2]); err != nil {
+			return err
+		}
+		size := 2
+		length := int64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			if _, err := io.ReadFull(reader, header[2:4]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint16(header[2:4]))
+			size = 4
+		case 127:
+			if _, err := io.ReadFull(reader, header[2:10]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint64(header[2:10]) & (1<<63 - 1))
+			size = 10
+		}
+		masked := header[1]&0x80 != 0
+		var maskKey []byte
+		if masked {
+			if _, err := io.ReadFull(reader, header[size:size+4]); err != nil {
+				return err
+			}
+			maskKey = header[size : size+4]
+			size += 4
+		}
+		if _, err := dst.Write(header[:size]); err != nil {
+			return err
+		}
+
+		msg := WebSocketMessage{
+			FromClient: fromClient,
+			Opcode:     header[0] & 0x0f,
+			Final:      header[0]&0x80 != 0,
+			Length:     length,
+			Compressed: inflater.startFrame(header[0]),
+		}
+		inflate := msg.Compressed && inflater.accept(length)
+
+		remaining := length
+		if !s.NoBodies {
+			capture := min64(length, maxWebSocketCapture)
+			if inflate {
+				capture = length
+			}
+			captured := make([]byte, capture)
+			if _, err := io.ReadFull(reader, captured); err != nil {
+				return err
+			}
+			if _, err := dst.Write(captured); err != nil {
+				return err
+			}
+			remaining -= int64(len(captured))
+			if masked {
+				for i := range captured {
+					captured[i] ^= maskKey[i%4]
+				}
+			}
+			msg.Data = captured
+		}
+		if remaining > 0 {
+			if _, err := io.CopyN(dst, reader, remaining); err != nil {
+				return err
+			}
+		}
+
+		if msg.Compressed {
+			payload := msg.Data
+			msg.Data = nil
+			if inflate {
+				msg.Data = inflater.add(payload, msg.Final)
+			}
+		}
+
+		msg.Time = time.Now()
+		onFrame(msg)
+	}
+}
+
+// isText 判断帧负载按文本记录：文本帧，以及内容是合法UTF-8的后续帧
+func (m WebSocketMessage) isText() bool {
+	return m.Opcode == WebSocketText || (m.Opcode == WebSocketContinuation && utf8.Valid(m.Data))
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// logWebSocketMessage 在调试日志和流量转储中输出WebSocket帧
+func (s *Server) logWebSocketMessage(msg WebSocketMessage, target string) {
+	direction := "<-"
+	if msg.FromClient {
+		direction = "->"
+	}
+	s.debugf("[WebSocket] %s %s opcode=%d fin=%t %d bytes", direction, target, msg.Opcode, msg.Final, msg.Length)
+
+	if s.DumpTraffic && !s.NoBodies {
+		if msg.isText() {
+			fmt.Printf("[DUMP] %s WebSocket %s %s\n", target, direction, msg.Data)
+		} else {
+			fmt.Printf("[DUMP] %s WebSocket %s opcode=%d (%d bytes)\n", target, direction, msg.Opcode, msg.Length)
+		}
+	}
+}
+
+// harWebSocketMessages 把转发的帧转换为HAR的 _webSocketMessages 记录，二进制负载使用base64编码
+func harWebSocketMessages(messages []WebSocketMessage) []harlogger.WebSocketMessage {
+	result := make([]harlogger.WebSocketMessage, 0, len(messages))
+	for _, msg := range messages {
+		entry := harlogger.WebSocketMessage{
+			Type:   "receive",
+			Time:   float64(msg.Time.UnixNano()) / float64(time.Second),
+			Opcode: int(msg.Opcode),
+			Data:   string(msg.Data),
+		}
+		if msg.FromClient {
+			entry.Type = "send"
+		}
+		if !msg.isText() {
+			entry.Data = base64.StdEncoding.EncodeToString(msg.Data)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// permessage-deflate（RFC 7692）解压的限制：单条消息缓存的压缩数据和解压后的数据超过上限时放弃解压，
+// 启用上下文接管时该方向之后的消息也无法再解压
+const (
+	maxWebSocketDeflateMessage  = 16 << 20
+	maxWebSocketInflatedMessage = 64 << 20
+)
+
+// deflateWindowSize 是DEFLATE的最大滑动窗口，上下文接管时后续消息可以引用之前这么多字节的解压数据
+const deflateWindowSize = 32 * 1024
+
+// deflateTail 是发送方压缩每条消息后去掉的同步刷新尾部，解压前需要补回
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// webSocketInflater 解压一个方向上permessage-deflate压缩的消息，只用于记录，转发的帧保持原样
+type webSocketInflater struct {
+	// noContextTakeover 表示发送方每条消息都重置压缩上下文，对应 client/server_no_context_takeover
+	noContextTakeover bool
+
+	window     []byte // 之前消息解压数据的最后deflateWindowSize字节，作为下一条消息的字典
+	message    []byte // 当前消息已收到的压缩数据
+	compressed bool   // 当前消息是否压缩（首帧RSV1）
+	skip       bool   // 当前消息放弃解压
+	broken     bool   // 上下文已丢失，该方向之后的消息都不再解压
+}
+
+// newWebSocketInflaters 根据101响应中协商的Sec-WebSocket-Extensions创建两个方向的解压器，未启用permessage-deflate时返回nil
+func newWebSocketInflaters(header http.Header) (fromClient, fromServer *webSocketInflater) {
+	params, ok := perMessageDeflateParams(header)
+	if !ok {
+		return nil, nil
+	}
+	_, clientReset := params["client_no_context_takeover"]
+	_, serverReset := params["server_no_context_takeover"]
+	return &webSocketInflater{noContextTakeover: clientReset}, &webSocketInflater{noContextTakeover: serverReset}
+}
+
+// perMessageDeflateParams 返回服务器接受的permessage-deflate扩展参数
+func perMessageDeflateParams(header http.Header) (map[string]string, bool) {
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(value, ",") {
+			parts := strings.Split(extension, ";")
+			if !strings.EqualFold(strings.TrimSpace(parts[0]), "permessage-deflate") {
+				continue
+			}
+			params := make(map[string]string)
+			for _, param := range parts[1:] {
+				name, val, _ := strings.Cut(param, "=")
+				params[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+			}
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// startFrame 根据帧头判断帧是否属于压缩的消息，数据消息的首帧通过RSV1标记压缩，后续帧沿用首帧的标记
+func (in *webSocketInflater) startFrame(b0 byte) bool {
+	if in == nil {
+		return false
+	}
+	switch b0 & 0x0f {
+	case WebSocketText, WebSocketBinary:
+		in.compressed = b0&0x40 != 0
+		in.message = in.message[:0]
+		in.skip = in.broken
+	case WebSocketContinuation:
+	default:
+		// 控制帧不压缩，也不影响进行中的消息
+		return false
+	}
+	return in.compressed
+}
+
+// accept 判断是否继续缓存当前消息接下来length字节的压缩数据，超过上限时放弃当前消息
+func (in *webSocketInflater) accept(length int64) bool {
+	if in.skip {
+		return false
+	}
+	if int64(len(in.message))+length > maxWebSocketDeflateMessage {
+		in.abandon()
+		return false
+	}
+	return true
+}
+
+// abandon 放弃当前消息；启用上下文接管时丢失了后续消息依赖的窗口，之后不再解压
+func (in *webSocketInflater) abandon() {
+	in.skip = true
+	in.message = nil
+	if !in.noContextTakeover {
+		in.broken = true
+		in.window = nil
+	}
+}
+
+// add 追加一帧去掉掩码的压缩负载，最后一帧时返回整条消息解压后的前maxWebSocketCapture字节，无法解压时返回nil
+func (in *webSocketInflater) add(payload []byte, final bool) []byte {
+	if in.skip {
+		return nil
+	}
+	in.message = append(in.message, payload...)
+	if !final {
+		return nil
+	}
+	data, err := in.inflate()
+	in.message = in.message[:0]
+	if err != nil {
+		in.abandon()
+		return nil
+	}
+	return data
+}
+
+// inflate 解压当前消息，并为启用上下文接管的下一条消息保留滑动窗口
+func (in *webSocketInflater) inflate() ([]byte, error) {
+	var dict []byte
+	if !in.noContextTakeover {
+		dict = in.window
+	}
+	reader := flate.NewReaderDict(io.MultiReader(bytes.NewReader(in.message), bytes.NewReader(deflateTail)), dict)
+	defer reader.Close()
+
+	var (
+		captured []byte
+		window   = append([]byte(nil), dict...)
+		total    int64
+		buf      = make([]byte, 32*1024)
+	)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			total += int64(n)
+			if total > maxWebSocketInflatedMessage {
+				return nil, errors.New("inflated WebSocket message too large")
+			}
+			if room := maxWebSocketCapture - len(captured); room > 0 {
+				captured = append(captured, buf[:min(n, room)]...)
+			}
+			if !in.noContextTakeover {
+				window = append(window, buf[:n]...)
+				if len(window) > deflateWindowSize {
+					window = append(window[:0], window[len(window)-deflateWindowSize:]...)
+				}
+			}
+		}
+		// 同步刷新后没有最终块，读完补回的尾部后返回ErrUnexpectedEOF
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !in.noContextTakeover {
+		in.window = window
+	}
+	if captured == nil {
+		captured = []byte{}
+	}
+	return captured, nil
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deflateMessage 按permessage-deflate压缩一条消息：同步刷新后去掉末尾的 00 00 ff ff
+// 复用同一个flate.Writer即为上下文接管
+func deflateMessage(t *testing.T, w *flate.Writer, buf *bytes.Buffer, text string) []byte {
+	t.Helper()
+	buf.Reset()
+	_, err := w.Write([]byte(text))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	return append([]byte(nil), bytes.TrimSuffix(buf.Bytes(), deflateTail)...)
+}
+
+func newDeflateWriter(t *testing.T, buf *bytes.Buffer) *flate.Writer {
+	t.Helper()
+	w, err := flate.NewWriter(buf, flate.BestCompression)
+	require.NoError(t, err)
+	return w
+}
+
+func TestWebSocketPerMessageDeflate(t *testing.T) {
+	const serverText = "server says: the quick brown fox jumps over the lazy dog"
+	var serverBuf bytes.Buffer
+	serverWriter := newDeflateWriter(t, &serverBuf)
+	first := deflateMessage(t, serverWriter, &serverBuf, serverText)
+	second := deflateMessage(t, serverWriter, &serverBuf, serverText)
+	fragmented := deflateMessage(t, serverWriter, &serverBuf, "fragmented "+serverText)
+	// 第二条消息引用了第一条的内容，只有保留上下文才能解压
+	require.Less(t, len(second), len(first))
+
+	received := make(chan []byte, 2)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "chat, superchat", r.Header.Get("Sec-WebSocket-Protocol"))
+		assert.Equal(t, "permessage-deflate; client_max_window_bits", r.Header.Get("Sec-WebSocket-Extensions"))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: test-accept\r\n" +
+			"Sec-WebSocket-Protocol: chat\r\nSec-WebSocket-Extensions: permessage-deflate; client_max_window_bits=15\r\n\r\n")
+		_ = rw.Flush()
+		for i := 0; i < 2; i++ {
+			_, payload, err := readTestFrame(rw)
+			if err != nil {
+				return
+			}
+			received <- payload
+		}
+		_ = writeTestFrame(conn, 0x40|WebSocketText, first, false)
+		_ = writeTestFrame(conn, 0x40|WebSocketText, second, false)
+		// 分片消息：首帧带RSV1但没有FIN，后续帧为continuation
+		half := len(fragmented) / 2
+		_, _ = conn.Write(append([]byte{0x40 | WebSocketText, byte(half)}, fragmented[:half]...))
+		_ = writeTestFrame(conn, WebSocketContinuation, fragmented[half:], false)
+		if opcode, _, err := readTestFrame(rw); err == nil && opcode == WebSocketClose {
+			_ = writeTestFrame(conn, WebSocketClose, []byte{0x03, 0xe8}, false)
+		}
+	}))
+	defer backend.Close()
+
+	recorder := &webSocketRecorder{}
+	server, err := New(Config{EventHandler: recorder, LogWriter: io.Discard})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.Serve(listener) }()
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+	_, err = io.WriteString(conn, "GET "+backend.URL+"/stream HTTP/1.1\r\nHost: "+backendHost+"\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: chat, superchat\r\n"+
+		"Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "chat", resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "permessage-deflate; client_max_window_bits=15", resp.Header.Get("Sec-WebSocket-Extensions"))
+
+	// 客户端同样使用上下文接管压缩两条消息，帧原样转发给服务器
+	var clientBuf bytes.Buffer
+	clientWriter := newDeflateWriter(t, &clientBuf)
+	for i := 0; i < 2; i++ {
+		payload := deflateMessage(t, clientWriter, &clientBuf, "client hello")
+		require.NoError(t, writeTestFrame(conn, 0x40|WebSocketText, payload, true))
+		select {
+		case got := <-received:
+			assert.Equal(t, payload, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend did not receive the client frame")
+		}
+	}
+
+	for _, want := range [][]byte{first, second, fragmented[:len(fragmented)/2], fragmented[len(fragmented)/2:]} {
+		_, payload, err := readTestFrame(reader)
+		require.NoError(t, err)
+		assert.Equal(t, want, payload, "compressed frames reach the client untouched")
+	}
+	require.NoError(t, writeTestFrame(conn, WebSocketClose, []byte{0x03, 0xe8}, true))
+	_, _, err = readTestFrame(reader)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(recorder.recorded()) == 8 }, 5*time.Second, 10*time.Millisecond)
+	messages := recorder.recorded()
+	for i, want := range []string{"client hello", "client hello", serverText, serverText, "", "fragmented " + serverText} {
+		assert.True(t, messages[i].Compressed, i)
+		assert.Equal(t, want, string(messages[i].Data), i)
+	}
+	assert.Equal(t, int64(len(second)), messages[3].Length, "Length is the size on the wire")
+	assert.False(t, messages[6].Compressed, "control frames are never compressed")
+	assert.Equal(t, []byte{0x03, 0xe8}, messages[6].Data)
+}
+
+func TestWebSocketInflaterNoContextTakeover(t *testing.T) {
+	header := http.Header{"Sec-Websocket-Extensions": {"x-custom, permessage-deflate; server_no_context_takeover; server_max_window_bits=10"}}
+	fromClient, fromServer := newWebSocketInflaters(header)
+	require.NotNil(t, fromServer)
+	assert.False(t, fromClient.noContextTakeover)
+	assert.True(t, fromServer.noContextTakeover)
+
+	// 每条消息使用新的压缩上下文
+	for _, text := range []string{"reset each time", "reset each time"} {
+		var buf bytes.Buffer
+		payload := deflateMessage(t, newDeflateWriter(t, &buf), &buf, text)
+		require.True(t, fromServer.startFrame(0x80|0x40|WebSocketBinary))
+		require.True(t, fromServer.accept(int64(len(payload))))
+		assert.Equal(t, text, string(fromServer.add(payload, true)))
+	}
+
+	// 未压缩的消息和无法解压的消息
+	assert.False(t, fromServer.startFrame(0x80|WebSocketText))
+	require.True(t, fromServer.startFrame(0x80|0x40|WebSocketText))
+	require.True(t, fromServer.accept(3))
+	assert.Nil(t, fromServer.add([]byte{0xff, 0xff, 0xff}, true))
+	assert.False(t, fromServer.broken, "without context takeover the next message can still be inflated")
+
+	fromClient, fromServer = newWebSocketInflaters(http.Header{"Sec-Websocket-Extensions": {"x-custom"}})
+	assert.Nil(t, fromClient)
+	assert.Nil(t, fromServer)
+}
@@ -0,0 +1,312 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/ProxyCraft/harlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFrame 写入一个未分片的WebSocket帧，客户端发出的帧需要掩码
+func writeTestFrame(w io.Writer, opcode byte, payload []byte, mask bool) error {
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	data := append([]byte(nil), payload...)
+	if mask {
+		key := []byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, key...)
+		for i := range data {
+			data[i] ^= key[i%4]
+		}
+	}
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+// readTestFrame 读取一个WebSocket帧并去掉掩码
+func readTestFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	var key []byte
+	if header[1]&0x80 != 0 {
+		key = make([]byte, 4)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if key != nil {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return header[0] & 0x0f, payload, nil
+}
+
+// newWebSocketEchoBackend 完成WebSocket握手后把收到的数据帧原样发回，收到关闭帧时回复关闭帧并断开
+func newWebSocketEchoBackend(tlsBackend bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: test-accept\r\n\r\n")
+		_ = rw.Flush()
+		for {
+			opcode, payload, err := readTestFrame(rw)
+			if err != nil {
+				return
+			}
+			if writeTestFrame(conn, opcode, payload, false) != nil || opcode == WebSocketClose {
+				return
+			}
+		}
+	})
+	if tlsBackend {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+// webSocketRecorder 记录交给EventHandler的WebSocket帧
+type webSocketRecorder struct {
+	NoOpEventHandler
+	mu       sync.Mutex
+	messages []WebSocketMessage
+	upgrades int
+}
+
+func (r *webSocketRecorder) OnResponse(ctx *ResponseContext) *http.Response {
+	if ctx.IsWebSocket {
+		r.mu.Lock()
+		r.upgrades++
+		r.mu.Unlock()
+	}
+	return ctx.Response
+}
+
+func (r *webSocketRecorder) OnWebSocketMessage(msg *WebSocketMessage, ctx *ResponseContext) {
+	r.mu.Lock()
+	r.messages = append(r.messages, *msg)
+	r.mu.Unlock()
+}
+
+func (r *webSocketRecorder) recorded() []WebSocketMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]WebSocketMessage(nil), r.messages...)
+}
+
+func TestWebSocketRelayedAndLogged(t *testing.T) {
+	for _, mode := range []string{"http", "mitm"} {
+		t.Run(mode, func(t *testing.T) {
+			backend := newWebSocketEchoBackend(mode == "mitm")
+			defer backend.Close()
+			backendHost := strings.TrimPrefix(strings.TrimPrefix(backend.URL, "http://"), "https://")
+
+			recorder := &webSocketRecorder{}
+			harPath := filepath.Join(t.TempDir(), "capture.har")
+			harLogger := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+			server, err := New(Config{EventHandler: recorder, HarLogger: harLogger, ResponseTimeout: 50 * time.Millisecond, LogWriter: io.Discard})
+			require.NoError(t, err)
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			go func() { _ = server.Serve(listener) }()
+
+			rawConn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+			require.NoError(t, err)
+			defer rawConn.Close()
+			_ = rawConn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			var conn net.Conn = rawConn
+			requestTarget := backend.URL + "/chat"
+			if mode == "mitm" {
+				_, err = io.WriteString(rawConn, "CONNECT "+backendHost+" HTTP/1.1\r\nHost: "+backendHost+"\r\n\r\n")
+				require.NoError(t, err)
+				resp, err := http.ReadResponse(bufio.NewReader(rawConn), nil)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				tlsConn := tls.Client(rawConn, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+				require.NoError(t, tlsConn.Handshake())
+				conn = tlsConn
+				requestTarget = "/chat"
+			}
+
+			_, err = io.WriteString(conn, "GET "+requestTarget+" HTTP/1.1\r\nHost: "+backendHost+"\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+				"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+			require.NoError(t, err)
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+			assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+			assert.Equal(t, "test-accept", resp.Header.Get("Sec-WebSocket-Accept"))
+
+			// 超过ResponseTimeout之后连接仍然可用
+			time.Sleep(100 * time.Millisecond)
+
+			large := strings.Repeat("x", 70000)
+			for _, payload := range []string{"hello", large} {
+				require.NoError(t, writeTestFrame(conn, WebSocketText, []byte(payload), true))
+				opcode, echoed, err := readTestFrame(reader)
+				require.NoError(t, err)
+				assert.Equal(t, WebSocketText, opcode)
+				assert.Equal(t, payload, string(echoed))
+			}
+			require.NoError(t, writeTestFrame(conn, WebSocketBinary, []byte{0, 1, 2}, true))
+			opcode, echoed, err := readTestFrame(reader)
+			require.NoError(t, err)
+			assert.Equal(t, WebSocketBinary, opcode)
+			assert.Equal(t, []byte{0, 1, 2}, echoed)
+			require.NoError(t, writeTestFrame(conn, WebSocketClose, []byte{0x03, 0xe8}, true))
+			opcode, _, err = readTestFrame(reader)
+			require.NoError(t, err)
+			assert.Equal(t, WebSocketClose, opcode)
+
+			require.Eventually(t, func() bool { return len(recorder.recorded()) == 8 }, 5*time.Second, 10*time.Millisecond)
+			messages := recorder.recorded()
+			assert.Equal(t, 1, recorder.upgrades)
+			assert.True(t, messages[0].FromClient)
+			assert.Equal(t, "hello", string(messages[0].Data))
+			assert.False(t, messages[1].FromClient)
+			assert.Equal(t, "hello", string(messages[1].Data))
+			assert.Equal(t, int64(len(large)), messages[2].Length)
+			assert.Len(t, messages[2].Data, maxWebSocketCapture, "large payloads are truncated in the log")
+
+			// 连接关闭后握手连同帧写入HAR
+			var har harlogger.HAR
+			require.Eventually(t, func() bool {
+				require.NoError(t, harLogger.Save())
+				data, err := os.ReadFile(harPath)
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(data, &har))
+				return len(har.Log.Entries) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			entry := har.Log.Entries[0]
+			assert.Equal(t, http.StatusSwitchingProtocols, entry.Response.Status)
+			assert.Contains(t, entry.Comment, "_mode: "+mode)
+			require.Len(t, entry.WebSocketMessages, 8)
+			assert.Equal(t, harlogger.WebSocketMessage{Type: "send", Time: entry.WebSocketMessages[0].Time, Opcode: 1, Data: "hello"}, entry.WebSocketMessages[0])
+			assert.Equal(t, "receive", entry.WebSocketMessages[1].Type)
+			assert.Equal(t, "AAEC", entry.WebSocketMessages[4].Data, "binary payloads are base64 encoded")
+		})
+	}
+}
+
+func TestWebSocketFrameBufferLimits(t *testing.T) {
+	buffer := webSocketFrameBuffer{maxMessages: 3, maxBytes: 8}
+	// "world"超过字节上限被丢弃，之后更小的帧仍可保存，直到帧数达到上限
+	for _, payload := range []string{"hello", "world", "x", "", "y"} {
+		buffer.add(WebSocketMessage{Data: []byte(payload)})
+	}
+	require.Len(t, buffer.messages, 3)
+	assert.Equal(t, "x", string(buffer.messages[1].Data))
+	assert.Equal(t, 6, buffer.bytes)
+	assert.Equal(t, 2, buffer.dropped)
+}
+
+func TestPlainHTTPSSEIsStreamed(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = io.WriteString(w, "data: second\n\n")
+	}))
+	defer backend.Close()
+
+	recorder := &sseEventRecorder{}
+	harPath := filepath.Join(t.TempDir(), "capture.har")
+	harLogger := harlogger.NewLogger(harPath, "ProxyCraft", "test")
+	client := newViaTestClient(t, Config{EventHandler: recorder, HarLogger: harLogger})
+
+	resp, err := client.Get(backend.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// 第一个事件在上游结束之前就到达客户端
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+
+	close(release)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(rest), "data: second")
+
+	require.Eventually(t, func() bool {
+		events := recorder.recorded()
+		return len(events) == 3 && events[2] == "__SSE_COMPLETED__"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"data: first", "data: second"}, recorder.recorded()[:2])
+
+	var har harlogger.HAR
+	require.Eventually(t, func() bool {
+		require.NoError(t, harLogger.Save())
+		data, err := os.ReadFile(harPath)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &har))
+		return len(har.Log.Entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, har.Log.Entries[0].Response.Content.Text, "data: second")
+}
@@ -63,6 +63,8 @@ const getBodyString = (body?: unknown) => {
 };
 
 const getContentType = (message?: HttpMessage) => {
+  // 响应头缺失或笼统（如application/octet-stream）时服务端会给出探测到的类型
+  if (message?.detectedContentType) return message.detectedContentType.toLowerCase();
   const headers = message?.headers;
   if (!headers) return '';
   const header = Object.entries(headers).find(([key]) => key.toLowerCase() === 'content-type');
@@ -271,7 +273,9 @@ export function RequestResponsePanel({ entry, detail, loading }: RequestResponse
       streaming: detail?.request?.llm?.streaming ?? detail?.response?.llm?.streaming,
     };
     const hasLLMMeta = Boolean(llmMeta.provider || llmMeta.model || llmMeta.streaming);
-    const hasLLMRequest = Boolean(llmRequest?.prompt || llmRequest?.toolCalls || llmRequest?.tools);
+    const hasLLMRequest = Boolean(
+      llmRequest?.prompt || llmRequest?.toolCalls || llmRequest?.tools || llmRequest?.toolResults?.length
+    );
     const hasLLMResponse = Boolean(llmResponse?.content || llmResponse?.toolCalls || llmResponse?.reasoning);
 
     const renderLLMBadges = () =>
@@ -377,6 +381,14 @@ export function RequestResponsePanel({ entry, detail, loading }: RequestResponse
               </AccordionItem>
             </Accordion>
           ) : null}
+          {llmRequest?.toolResults?.length ? (
+            <Accordion type="multiple">
+              <AccordionItem value="llm-request-tool-results">
+                <AccordionTrigger>Tool Results</AccordionTrigger>
+                <AccordionContent>{renderJsonPanel(llmRequest.toolResults)}</AccordionContent>
+              </AccordionItem>
+            </Accordion>
+          ) : null}
         </div>
       );
     };
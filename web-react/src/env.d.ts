@@ -7,3 +7,8 @@ declare interface ImportMetaEnv {
 declare interface ImportMeta {
   readonly env: ImportMetaEnv;
 }
+
+declare interface Window {
+  // 后端以 -ui-base-path 提供界面时注入的路径前缀，例如 "/proxycraft"
+  __PROXYCRAFT_BASE_PATH__?: string;
+}
@@ -17,6 +17,7 @@ export function useTrafficStream() {
   const setTransport = useTrafficStore((state) => state.setTransport);
   const mergeDetail = useTrafficStore((state) => state.mergeDetail);
   const clearDetail = useTrafficStore((state) => state.clearDetail);
+  const removeEntries = useTrafficStore((state) => state.removeEntries);
   const selectedId = useTrafficStore((state) => state.selectedId);
   const entries = useTrafficStore((state) => state.entries);
   const selectEntry = useTrafficStore((state) => state.selectEntry);
@@ -87,6 +88,9 @@ export function useTrafficStream() {
         setError(null);
         setLoading(false);
       }),
+      trafficSocket.onTrafficDeleted((ids) => {
+        removeEntries(ids);
+      }),
       trafficSocket.onRequestDetails((request) => {
         mergeDetail({ request });
         setError(null);
@@ -108,6 +112,7 @@ export function useTrafficStream() {
     clearDetail,
     clearEntries,
     mergeDetail,
+    removeEntries,
     selectEntry,
     setConnected,
     setEntries,
@@ -0,0 +1,5 @@
+// 后端以 -ui-base-path 提供界面时会在 index.html 中注入路径前缀，API 和 socket.io 都挂在该前缀之下
+export const BASE_PATH = typeof window !== 'undefined' ? window.__PROXYCRAFT_BASE_PATH__ ?? '' : '';
+
+// 设置了路径前缀时界面一定由后端提供，socket.io 连接当前页面的地址
+export const SERVED_WITH_BASE_PATH = BASE_PATH !== '';
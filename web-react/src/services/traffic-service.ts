@@ -1,6 +1,7 @@
+import { BASE_PATH } from '@/lib/base-path';
 import { HttpMessage, TrafficDetail, TrafficEntry } from '@/types/traffic';
 
-const API_BASE = '/api';
+const API_BASE = `${BASE_PATH}/api`;
 
 const MOCK_ENTRIES: TrafficEntry[] = [
   {
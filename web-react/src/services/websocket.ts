@@ -1,6 +1,7 @@
 import io from 'socket.io-client';
 
-import { HttpMessage, TrafficEntry } from '@/types/traffic';
+import { BASE_PATH, SERVED_WITH_BASE_PATH } from '@/lib/base-path';
+import { HttpMessage, TrafficEntry, TrafficEntryDetail } from '@/types/traffic';
 
 export enum TrafficSocketEvent {
   CONNECT = 'connect',
@@ -8,12 +9,17 @@ export enum TrafficSocketEvent {
   CONNECT_ERROR = 'connect_error',
   TRAFFIC_ENTRIES = 'traffic_entries',
   TRAFFIC_NEW_ENTRY = 'traffic_new_entry',
+  TRAFFIC_NEW_ENTRIES = 'traffic_new_entries',
   TRAFFIC_CLEAR = 'traffic_clear',
+  TRAFFIC_DELETED = 'traffic_deleted',
   REQUEST_DETAILS = 'request_details',
   RESPONSE_DETAILS = 'response_details',
+  TRAFFIC_ENTRY = 'traffic_entry',
 }
 
-const DEFAULT_WS_URL = import.meta.env.VITE_PROXYCRAFT_SOCKET_URL ?? 'http://localhost:8081';
+const DEFAULT_WS_URL =
+  import.meta.env.VITE_PROXYCRAFT_SOCKET_URL ??
+  (SERVED_WITH_BASE_PATH ? window.location.origin : 'http://localhost:8081');
 
 type Unsubscribe = () => void;
 type TrafficEntriesMode = 'full' | 'delta';
@@ -36,6 +42,7 @@ class TrafficWebSocketService {
     }
 
     this.socket = io(this.url, {
+      path: `${BASE_PATH}/socket.io`,
       transports: ['websocket'],
       reconnection: true,
       reconnectionAttempts: Infinity,
@@ -138,6 +145,13 @@ class TrafficWebSocketService {
     }
   }
 
+  requestTrafficEntry(id: string) {
+    const socket = this.getSocket();
+    if (socket?.connected) {
+      socket.emit(TrafficSocketEvent.TRAFFIC_ENTRY, id);
+    }
+  }
+
   requestClearTraffic() {
     const socket = this.getSocket();
     if (socket?.connected) {
@@ -176,8 +190,16 @@ class TrafficWebSocketService {
 
   onNewTrafficEntry(callback: (entry: TrafficEntry) => void): Unsubscribe {
     const socket = this.getSocket();
+    // 高流量时服务端会把一个时间窗口内的更新合并为一个数组推送
+    const batchHandler = (entries: TrafficEntry[]) => {
+      entries.forEach((entry) => callback(entry));
+    };
     socket?.on(TrafficSocketEvent.TRAFFIC_NEW_ENTRY, callback);
-    return () => socket?.off(TrafficSocketEvent.TRAFFIC_NEW_ENTRY, callback);
+    socket?.on(TrafficSocketEvent.TRAFFIC_NEW_ENTRIES, batchHandler);
+    return () => {
+      socket?.off(TrafficSocketEvent.TRAFFIC_NEW_ENTRY, callback);
+      socket?.off(TrafficSocketEvent.TRAFFIC_NEW_ENTRIES, batchHandler);
+    };
   }
 
   onTrafficClear(callback: () => void): Unsubscribe {
@@ -186,6 +208,12 @@ class TrafficWebSocketService {
     return () => socket?.off(TrafficSocketEvent.TRAFFIC_CLEAR, callback);
   }
 
+  onTrafficDeleted(callback: (ids: string[]) => void): Unsubscribe {
+    const socket = this.getSocket();
+    socket?.on(TrafficSocketEvent.TRAFFIC_DELETED, callback);
+    return () => socket?.off(TrafficSocketEvent.TRAFFIC_DELETED, callback);
+  }
+
   onRequestDetails(callback: (details: HttpMessage) => void): Unsubscribe {
     const socket = this.getSocket();
     socket?.on(TrafficSocketEvent.REQUEST_DETAILS, callback);
@@ -198,6 +226,12 @@ class TrafficWebSocketService {
     return () => socket?.off(TrafficSocketEvent.RESPONSE_DETAILS, callback);
   }
 
+  onTrafficEntry(callback: (detail: TrafficEntryDetail) => void): Unsubscribe {
+    const socket = this.getSocket();
+    socket?.on(TrafficSocketEvent.TRAFFIC_ENTRY, callback);
+    return () => socket?.off(TrafficSocketEvent.TRAFFIC_ENTRY, callback);
+  }
+
   isConnected(): boolean {
     const socket = this.getSocket();
     return Boolean(socket?.connected);
@@ -30,6 +30,7 @@ export type TrafficState = {
   setConnected: (connected: boolean) => void;
   setTransport: (transport: string) => void;
   clearEntries: () => void;
+  removeEntries: (ids: string[]) => void;
 };
 
 // 默认设置值
@@ -92,6 +93,16 @@ const store = create<TrafficState>()(
           selectedId: null,
           detail: undefined,
         }),
+      removeEntries: (ids) =>
+        set((state) => {
+          const removed = new Set(ids);
+          const selectedRemoved = state.selectedId !== null && removed.has(state.selectedId);
+          return {
+            entries: state.entries.filter((entry) => !removed.has(entry.id)),
+            selectedId: selectedRemoved ? null : state.selectedId,
+            detail: selectedRemoved ? undefined : state.detail,
+          };
+        }),
     }),
     { name: 'traffic-store' }
   )
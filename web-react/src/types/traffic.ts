@@ -20,10 +20,18 @@ export type TrafficEntry = {
   error?: string;
 };
 
+export type LLMToolResult = {
+  toolCallId?: string;
+  name?: string;
+  content?: unknown;
+  isError?: boolean;
+};
+
 export type LLMRequestInfo = {
   prompt?: string;
   toolCalls?: unknown;
   tools?: unknown;
+  toolResults?: LLMToolResult[];
 };
 
 export type LLMResponseInfo = {
@@ -43,6 +51,7 @@ export type LLMExtracted = {
 export type HttpMessage = {
   headers: Record<string, string>;
   body?: unknown;
+  detectedContentType?: string;
   llm?: LLMExtracted;
 };
 
@@ -51,6 +60,12 @@ export type TrafficDetail = {
   response?: HttpMessage;
 };
 
+// traffic_entry 事件返回的单个条目，包含请求和响应详情
+export type TrafficEntryDetail = TrafficDetail & {
+  id: string;
+  entry: TrafficEntry;
+};
+
 export type ConnectionState = {
   connected: boolean;
   transport: string;